@@ -0,0 +1,118 @@
+package gatt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/rand"
+	"fmt"
+	"net"
+)
+
+// An AddrType is the type of a device address. A device has either a
+// public address, assigned by the IEEE, or a random one, which is either
+// static, or private and changed every so often.
+type AddrType uint8
+
+const (
+	AddrPublic               AddrType = iota
+	AddrRandomStatic                  // random, kept until the device power cycles
+	AddrResolvablePrivate             // random, resolved with the IRK of the device
+	AddrNonResolvablePrivate          // random, not resolvable; not connectable
+)
+
+func (t AddrType) String() string {
+	switch t {
+	case AddrPublic:
+		return "public"
+	case AddrRandomStatic:
+		return "random static"
+	case AddrResolvablePrivate:
+		return "resolvable private"
+	case AddrNonResolvablePrivate:
+		return "non-resolvable private"
+	}
+	return fmt.Sprintf("address type %d", uint8(t))
+}
+
+// Random reports whether the addresses of type t are random ones, as
+// they are told apart on the air, and by the controller.
+func (t AddrType) Random() bool { return t != AddrPublic }
+
+// An Addr is the address of a peer device, with its type. Those of the
+// advertisements scanned, and of the connections, carry the type the
+// controller reports them with, and connecting to one requires it: the
+// same bytes, as a public and as a random address, are two devices.
+type Addr struct {
+	BDAddr
+	Type AddrType
+}
+
+// PublicAddr returns the public address a.
+func PublicAddr(a BDAddr) Addr { return Addr{a, AddrPublic} }
+
+// RandomAddr returns the random address a, whose type is told by its
+// two most significant bits; a is in the byte order of the controller,
+// least significant byte first.
+func RandomAddr(a BDAddr) Addr {
+	t := AddrRandomStatic
+	if len(a.HardwareAddr) == 6 {
+		switch a.HardwareAddr[5] >> 6 {
+		case 0x1:
+			t = AddrResolvablePrivate
+		case 0x0:
+			t = AddrNonResolvablePrivate
+		}
+	}
+	return Addr{a, t}
+}
+
+func (a Addr) String() string { return fmt.Sprintf("%s (%s)", a.BDAddr, a.Type) }
+
+// same reports whether a and b are the address of the same device.
+func (a Addr) same(b Addr) bool {
+	return a.Type.Random() == b.Type.Random() && bytes.Equal(a.HardwareAddr, b.HardwareAddr)
+}
+
+// check checks that the address is one to connect to, of a type
+// matching its bytes.
+func (a Addr) check() error {
+	if len(a.HardwareAddr) != 6 {
+		return invalid(ErrInvalidParameter{Param: "len(Addr)", Value: len(a.HardwareAddr), Min: 6, Max: 6})
+	}
+	if err := checkRange("Addr.Type", int(a.Type), int(AddrPublic), int(AddrResolvablePrivate)); err != nil {
+		return err
+	}
+	if a.Type.Random() && RandomAddr(a.BDAddr).Type != a.Type {
+		return fmt.Errorf("gatt: address %s is not a %s one", a.BDAddr, a.Type)
+	}
+	return nil
+}
+
+// resolvablePrivateAddr returns a resolvable private address of the IRK
+// irk, least significant byte first, with the random part prand, of
+// which the two most significant bits are overwritten: its hash is
+// ah(irk, prand), of the Security Manager (Vol 3, Part H, 2.2.2).
+func resolvablePrivateAddr(irk [16]byte, prand [3]byte) BDAddr {
+	prand[2] = prand[2]&0x3F | 0x40
+	// e takes, and returns, the most significant byte first.
+	c, _ := aes.NewCipher(reverse(irk[:]))
+	b := make([]byte, aes.BlockSize)
+	b[13], b[14], b[15] = prand[2], prand[1], prand[0]
+	c.Encrypt(b, b)
+	return BDAddr{net.HardwareAddr{b[15], b[14], b[13], prand[0], prand[1], prand[2]}}
+}
+
+// newResolvablePrivateAddr returns a resolvable private address of irk,
+// with a random part drawn anew, neither all zeros nor all ones.
+func newResolvablePrivateAddr(irk [16]byte) (BDAddr, error) {
+	var prand [3]byte
+	for {
+		if _, err := rand.Read(prand[:]); err != nil {
+			return BDAddr{}, err
+		}
+		r := uint32(prand[0]) | uint32(prand[1])<<8 | uint32(prand[2]&0x3F)<<16
+		if r != 0 && r != 1<<22-1 {
+			return resolvablePrivateAddr(irk, prand), nil
+		}
+	}
+}
@@ -78,6 +78,7 @@ func (p *advPacket) appendManufactureDataFit(cid uint16, data []byte) bool {
 // packet field if it fits in the packet, and reports
 // whether the UUID fit.
 func (p *advPacket) appendUUIDFit(u UUID) bool {
+	u = u.short()
 	if len(p.data)+u.Len()+2 > MaxEIRPacketLength {
 		return false
 	}
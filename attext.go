@@ -0,0 +1,115 @@
+package gatt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// An ATTHandler handles the ATT PDUs of an opcode gatt does not handle,
+// e.g. those of the proprietary extension of a DFU protocol, received on
+// the connection c; pdu starts with the opcode. It returns the PDU to
+// respond with, if any, e.g. nil for a command. It is called from the
+// goroutine reading the connection: the next PDU is read once it has
+// returned.
+type ATTHandler func(c Conn, pdu []byte) (rsp []byte)
+
+// HandleATT registers f as the handler of the ATT PDUs of opcode op
+// received, in either role, in place of the Request Not Supported error
+// responses. op must be one the specification leaves unused; that of a
+// response the Client is waiting for goes to the Client still. The PDUs
+// are counted by LimitRequests. A nil f drops the handler of op.
+// See also Server.NewServer.
+// HandleATT cannot be used with Server.Option.
+func HandleATT(op byte, f ATTHandler) option {
+	return func(s *Server) option {
+		prev := s.attHandlers[op]
+		if f == nil {
+			delete(s.attHandlers, op)
+		} else {
+			if s.attHandlers == nil {
+				s.attHandlers = make(map[byte]ATTHandler)
+			}
+			s.attHandlers[op] = f
+		}
+		return HandleATT(op, prev)
+	}
+}
+
+// attDefined reports whether the specification defines the ATT opcode op,
+// as of Bluetooth 5.2.
+func attDefined(op byte) bool {
+	switch {
+	case op >= attOpError && op <= attOpWriteResp,
+		op >= attOpPrepWriteReq && op <= attOpExecWriteResp,
+		op == attOpHandleNotify, op == attOpHandleInd, op == attOpHandleCnf,
+		op >= 0x20 && op <= 0x23, // Read Multiple Variable, Multiple Handle Value Notification
+		op == attOpWriteCmd, op == attOpSignedWriteCmd:
+		return true
+	}
+	return false
+}
+
+// checkATTHandlers returns an error if a handler is registered for an
+// opcode the specification defines.
+func (s *Server) checkATTHandlers() error {
+	for op := range s.attHandlers {
+		if attDefined(op) {
+			return fmt.Errorf("gatt: HandleATT of opcode 0x%02X, defined by the specification", op)
+		}
+	}
+	return nil
+}
+
+// handleExt hands b to the ATTHandler of its opcode, if any, and reports
+// whether there was one.
+func (c *conn) handleExt(b []byte) bool {
+	f := c.server.attHandlers[b[0]]
+	if f == nil {
+		return false
+	}
+	c.traceATT(true, b, nil)
+	var rsp []byte
+	c.server.call(fmt.Sprintf("att opcode 0x%02X", b[0]), func() { rsp = f(c, b) })
+	if len(rsp) > 0 {
+		c.traceATT(false, rsp, b)
+		c.l2conn.Write(rsp)
+	}
+	return true
+}
+
+// Request sends the ATT PDU req, of an opcode gatt does not issue, e.g.
+// that of a proprietary extension, and returns the response of opcode
+// rspOp, or the ATTError the peer responded with. Requests are carried
+// out one at a time, those of Client included.
+func (cl *Client) Request(ctx context.Context, req []byte, rspOp byte) ([]byte, error) {
+	if len(req) == 0 {
+		return nil, errors.New("gatt: empty ATT request")
+	}
+	c := cl.conn()
+	atomic.StoreUint32(c.extRsp, extPending|uint32(rspOp))
+	defer atomic.StoreUint32(c.extRsp, 0)
+	return c.attRequest(ctx, req, rspOp)
+}
+
+// Command sends the ATT PDU pdu, e.g. a proprietary command, to which the
+// peer does not respond.
+func (cl *Client) Command(pdu []byte) error {
+	if len(pdu) == 0 {
+		return errors.New("gatt: empty ATT command")
+	}
+	c := cl.conn()
+	c.touch()
+	_, err := c.l2conn.Write(pdu)
+	return err
+}
+
+// extPending marks the opcode of the response to a Request awaited.
+const extPending = 0x100
+
+// isExtRsp reports whether op is that of the response to the Request
+// awaited, if any.
+func (c *conn) isExtRsp(op byte) bool {
+	return atomic.LoadUint32(c.extRsp) == extPending|uint32(op)
+}
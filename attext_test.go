@@ -0,0 +1,80 @@
+package gatt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestATTExtension(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cmds := make(chan []byte, 1)
+	peer := NewServer(Name(""),
+		HandleATT(0xF0, func(c Conn, pdu []byte) []byte {
+			if len(pdu) < 2 {
+				return attErrorResp(pdu[0], 0x0000, attEcodeInvalidPDU)
+			}
+			return []byte{0xF1, pdu[2], pdu[1]}
+		}),
+		HandleATT(0xF4, func(c Conn, pdu []byte) []byte {
+			cmds <- append([]byte(nil), pdu...)
+			return nil
+		}),
+	)
+	if err := peer.validate(); err != nil {
+		t.Fatal(err)
+	}
+	c, _ := link(t, NewServer(Name("")), peer)
+	cl, err := NewClient(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rsp, err := cl.Request(ctx, []byte{0xF0, 0x01, 0x02}, 0xF1); err != nil || !bytes.Equal(rsp, []byte{0xF1, 0x02, 0x01}) {
+		t.Errorf("Request() = [% X], %v, want [F1 02 01]", rsp, err)
+	}
+	var e *ATTError
+	if _, err := cl.Request(ctx, []byte{0xF0}, 0xF1); !errors.As(err, &e) || e.Status != attEcodeInvalidPDU {
+		t.Errorf("Request() of an invalid PDU = %v, want an ATTError of status 0x%02X", err, attEcodeInvalidPDU)
+	}
+	if _, err := cl.Request(ctx, []byte{0xF0}, 0xF1); !errors.Is(err, ATTStatus(attEcodeInvalidPDU)) || errors.Is(err, ATTStatus(attEcodeUnlikely)) {
+		t.Errorf("Request() of an invalid PDU = %v, want ATTStatus(0x%02X) only", err, attEcodeInvalidPDU)
+	}
+	for s, want := range map[ATTStatus]string{0x0A: "Attribute Not Found (0x0A)", 0x80: "Application Error (0x80)", 0x70: "Reserved (0x70)"} {
+		if got := s.String(); got != want {
+			t.Errorf("ATTStatus(0x%02X) = %q, want %q", byte(s), got, want)
+		}
+	}
+	if _, err := cl.Request(ctx, []byte{0xF6}, 0xF7); !errors.As(err, &e) || e.Status != attEcodeReqNotSupp {
+		t.Errorf("Request() of an opcode not handled = %v, want an ATTError of status 0x%02X", err, attEcodeReqNotSupp)
+	}
+
+	if err := cl.Command([]byte{0xF4, 0x09}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case b := <-cmds:
+		if !bytes.Equal(b, []byte{0xF4, 0x09}) {
+			t.Errorf("command handled: [% X], want [F4 09]", b)
+		}
+	case <-ctx.Done():
+		t.Fatal("command not handled")
+	}
+	// The client still works as usual.
+	if mtu, err := cl.ExchangeMTU(ctx, 100); err != nil || mtu != 100 {
+		t.Errorf("ExchangeMTU() = %d, %v, want 100", mtu, err)
+	}
+
+	noop := func(c Conn, pdu []byte) []byte { return nil }
+	if err := NewServer(HandleATT(attOpReadReq, noop)).validate(); err == nil {
+		t.Error("HandleATT of the Read Request: got no error")
+	}
+	s := NewServer(HandleATT(0xF0, noop))
+	s.Option(HandleATT(0xF0, nil))
+	if len(s.attHandlers) != 0 {
+		t.Error("HandleATT(nil) left the handler registered")
+	}
+}
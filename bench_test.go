@@ -0,0 +1,45 @@
+package gatt
+
+import "testing"
+
+// BenchmarkNotification measures the latency from a notifier write to the
+// notification being handed to the L2CAP connection.
+func BenchmarkNotification(b *testing.B) {
+	h := &testHandler{readc: make(chan []byte), writec: make(chan []byte, 1)}
+	srv := NewServer(Name(""))
+	c := newConn(srv, h, Addr{})
+	n := newNotifier(c, &Characteristic{valuen: 0x0d}, int(c.mtu)-3)
+	data := []byte("Count: 0")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := n.Write(data); err != nil {
+			b.Fatal(err)
+		}
+		<-h.writec
+	}
+}
+
+func BenchmarkServeRead(b *testing.B) {
+	h := &testHandler{readc: make(chan []byte), writec: make(chan []byte)}
+	srv := NewServer(Name(""))
+	svc := srv.AddService(MustParseUUID("09fc95c0-c111-11e3-9904-0002a5d5c51b"))
+	svc.AddCharacteristic(MustParseUUID("11fac9e0-c111-11e3-9246-0002a5d5c51b")).HandleReadFunc(
+		func(resp ReadResponseWriter, req *ReadRequest) {
+			resp.Write([]byte("count: 1"))
+		})
+	srv.setServices()
+	c := newConn(srv, h, Addr{})
+	go c.loop()
+	req := []byte{attOpReadReq, 0x0C, 0x00} // same handle as in TestServing
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.readc <- req
+		if rsp := <-h.writec; rsp[0] != attOpReadResp {
+			b.Fatalf("got response % X", rsp)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package gatt
+
+import "fmt"
+
+// A ServiceBuilder declares a Service, to be added to a Device:
+//
+//	svc, err := gatt.NewService(svcUUID).
+//		AddCharacteristic(countUUID).SetReadHandler(count).EnableNotify(countNotify).
+//		AddCharacteristic(resetUUID).SetWriteHandler(reset).
+//		Build()
+//
+// Mistakes, such as characteristics without handlers, are reported by
+// Build.
+type ServiceBuilder struct {
+	uuid  UUID
+	chars []*CharacteristicBuilder
+}
+
+// NewService starts the declaration of a Service.
+// See also Server.AddService.
+func NewService(u UUID) *ServiceBuilder {
+	return &ServiceBuilder{uuid: u}
+}
+
+// AddCharacteristic adds a characteristic to the service, and returns
+// its builder.
+func (b *ServiceBuilder) AddCharacteristic(u UUID) *CharacteristicBuilder {
+	cb := &CharacteristicBuilder{svc: b, char: &Characteristic{uuid: u}}
+	b.chars = append(b.chars, cb)
+	return cb
+}
+
+// Build validates the declaration, and returns the Service.
+func (b *ServiceBuilder) Build() (*Service, error) {
+	if err := lenErr(b.uuid.Len()); err != nil {
+		return nil, fmt.Errorf("service %v: %v", b.uuid, err)
+	}
+	svc := &Service{uuid: b.uuid}
+	for _, cb := range b.chars {
+		c := cb.char
+		if err := lenErr(c.uuid.Len()); err != nil {
+			return nil, fmt.Errorf("service %v: characteristic %v: %v", b.uuid, c.uuid, err)
+		}
+		for _, other := range svc.chars {
+			if other.uuid.Equal(c.uuid) {
+				return nil, fmt.Errorf("service %v: duplicate characteristic %v", b.uuid, c.uuid)
+			}
+		}
+		if c.rhandler == nil && c.whandler == nil && c.nhandler == nil {
+			return nil, fmt.Errorf("service %v: characteristic %v has no handler", b.uuid, c.uuid)
+		}
+		if c.npolicy != NotifyBlock && c.nhandler == nil {
+			return nil, fmt.Errorf("service %v: characteristic %v has a notify policy, but no notify handler", b.uuid, c.uuid)
+		}
+		for _, d := range c.descs {
+			if err := lenErr(d.uuid.Len()); err != nil {
+				return nil, fmt.Errorf("service %v: characteristic %v: descriptor %v: %v", b.uuid, c.uuid, d.uuid, err)
+			}
+		}
+		c.service = svc
+		svc.chars = append(svc.chars, c)
+	}
+	return svc, nil
+}
+
+// A CharacteristicBuilder declares a characteristic of a service.
+// Its methods return it, so that calls can be chained, and those of
+// its ServiceBuilder are at hand to carry on with the service.
+type CharacteristicBuilder struct {
+	svc  *ServiceBuilder
+	char *Characteristic
+}
+
+// SetReadHandler makes the characteristic readable, by h.
+// See also Characteristic.HandleRead.
+func (b *CharacteristicBuilder) SetReadHandler(h ReadHandler) *CharacteristicBuilder {
+	b.char.HandleRead(h)
+	return b
+}
+
+// SetWriteHandler makes the characteristic writable, by h.
+// See also Characteristic.HandleWrite.
+func (b *CharacteristicBuilder) SetWriteHandler(h WriteHandler) *CharacteristicBuilder {
+	b.char.HandleWrite(h)
+	return b
+}
+
+// EnableNotify makes the characteristic support notifications, sent
+// through the Notifiers h is handed.
+// See also Characteristic.HandleNotify.
+func (b *CharacteristicBuilder) EnableNotify(h NotifyHandler) *CharacteristicBuilder {
+	b.char.HandleNotify(h)
+	return b
+}
+
+// SetNotifyPolicy sets how the notifications are sent.
+// See also Characteristic.SetNotifyPolicy.
+func (b *CharacteristicBuilder) SetNotifyPolicy(p NotifyPolicy) *CharacteristicBuilder {
+	b.char.SetNotifyPolicy(p)
+	return b
+}
+
+// AddDescriptor adds a read-only descriptor of static value v.
+func (b *CharacteristicBuilder) AddDescriptor(u UUID, v []byte) *CharacteristicBuilder {
+	b.char.descs = append(b.char.descs, &desc{uuid: u, value: v})
+	return b
+}
+
+// AddCharacteristic carries on with the service, adding another
+// characteristic to it.
+func (b *CharacteristicBuilder) AddCharacteristic(u UUID) *CharacteristicBuilder {
+	return b.svc.AddCharacteristic(u)
+}
+
+// Build builds the service.
+// See ServiceBuilder.Build.
+func (b *CharacteristicBuilder) Build() (*Service, error) {
+	return b.svc.Build()
+}
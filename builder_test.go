@@ -0,0 +1,47 @@
+package gatt
+
+import "testing"
+
+func TestServiceBuilder(t *testing.T) {
+	read := ReadHandlerFunc(func(resp ReadResponseWriter, req *ReadRequest) {})
+	write := WriteHandlerFunc(func(r Request, data []byte) byte { return StatusSuccess })
+	notify := NotifyHandlerFunc(func(r Request, n Notifier) {})
+
+	svc, err := NewService(UUID16(0x180D)).
+		AddCharacteristic(UUID16(0x2A37)).EnableNotify(notify).SetNotifyPolicy(NotifyLatest).
+		AddCharacteristic(UUID16(0x2A38)).SetReadHandler(read).AddDescriptor(UUID16(0x2901), []byte("location")).
+		AddCharacteristic(UUID16(0x2A39)).SetWriteHandler(write).
+		Build()
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if len(svc.chars) != 3 {
+		t.Fatalf("Build: got %d characteristics, want 3", len(svc.chars))
+	}
+	for _, c := range svc.chars {
+		if c.service != svc {
+			t.Errorf("characteristic %v does not belong to its service", c.uuid)
+		}
+	}
+	if p := svc.chars[0].props; p != charNotify {
+		t.Errorf("characteristic %v: got props 0x%02X, want 0x%02X", svc.chars[0].uuid, p, charNotify)
+	}
+	if n, _ := svc.generateHandles(1, false); n != 10 {
+		t.Errorf("generateHandles: got next handle %d, want 10", n)
+	}
+
+	invalid := []*ServiceBuilder{
+		NewService(UUID{}),
+		NewService(UUID16(0x180D)).AddCharacteristic(UUID16(0x2A37)).svc,
+		NewService(UUID16(0x180D)).
+			AddCharacteristic(UUID16(0x2A37)).SetReadHandler(read).
+			AddCharacteristic(UUID16(0x2A37)).SetWriteHandler(write).svc,
+		NewService(UUID16(0x180D)).AddCharacteristic(UUID16(0x2A37)).SetReadHandler(read).SetNotifyPolicy(NotifyLatest).svc,
+		NewService(UUID16(0x180D)).AddCharacteristic(UUID16(0x2A37)).SetReadHandler(read).AddDescriptor(UUID{}, nil).svc,
+	}
+	for i, b := range invalid {
+		if _, err := b.Build(); err == nil {
+			t.Errorf("invalid declaration %d: Build succeeded", i)
+		}
+	}
+}
@@ -10,10 +10,11 @@ import (
 
 // Characteristic property flags.
 const (
-	charRead    = 1 << (iota + 1) // the characteristic may be read
-	charWriteNR                   // the characteristic may be written to, with no reply
-	charWrite                     // the characteristic may be written to, with a reply
-	charNotify                    // the characteristic supports notifications
+	charRead     = 1 << (iota + 1) // the characteristic may be read
+	charWriteNR                    // the characteristic may be written to, with no reply
+	charWrite                      // the characteristic may be written to, with a reply
+	charNotify                     // the characteristic supports notifications
+	charIndicate                   // the characteristic supports indications
 )
 
 // Supported statuses for GATT characteristic read/write operations.
@@ -123,6 +124,7 @@ type Characteristic struct {
 	rhandler ReadHandler
 	whandler WriteHandler
 	nhandler NotifyHandler
+	npolicy  NotifyPolicy
 
 	// storage used by other types
 	service *Service
@@ -172,8 +174,39 @@ func (c *Characteristic) HandleNotifyFunc(f func(r Request, n Notifier)) {
 	c.HandleNotify(NotifyHandlerFunc(f))
 }
 
-// TODO: Add Indication support. It should be transparent and appear
-// as a Notify, the way that Write and WriteNR are handled.
+// A NotifyPolicy tells what a Notifier does when values are written
+// faster than the link can carry them.
+type NotifyPolicy int
+
+const (
+	// NotifyBlock makes Write block until the notification has been
+	// handed to the link. Every value is sent, in order.
+	NotifyBlock NotifyPolicy = iota
+
+	// NotifyLatest makes Write return immediately. While a notification
+	// is being sent, later values replace each other, and only the latest
+	// one is sent next; intermediate values are dropped.
+	NotifyLatest
+
+	// NotifyQueue makes Write return immediately, and queues the value,
+	// to be sent in order, at the pace of the link of the central. Each
+	// central subscribed has its own queue: a slow link never delays the
+	// notifications of the others, and a loop writing a value to each
+	// of them never blocks. A queue holds up to 32 values; once it is
+	// full, the oldest value is dropped.
+	NotifyQueue
+)
+
+// SetNotifyPolicy sets how notifications of the characteristic are
+// sent. The default is NotifyBlock. SetNotifyPolicy must be called
+// before any server using c has been started.
+func (c *Characteristic) SetNotifyPolicy(p NotifyPolicy) {
+	c.npolicy = p
+}
+
+// TODO: Add Indication support to the API. It should be transparent and
+// appear as a Notify, the way that Write and WriteNR are handled. Only the
+// Service Changed characteristic indicates so far.
 
 func (c *Characteristic) generateHandles(n uint16) (uint16, []handle) {
 	var h handle
@@ -201,14 +234,14 @@ func (c *Characteristic) generateHandles(n uint16) (uint16, []handle) {
 	}
 	handles = append(handles, h)
 
-	if c.props&charNotify != 0 {
+	if c.props&(charNotify|charIndicate) != 0 {
 		// add ccc (client characteristic configuration) descriptor
 		n++
 		cccn := n
 		secure := uint(0)
 		// If the characteristic requested secure notifications,
 		// then set ccc security to r/w.
-		if c.secure&charNotify != 0 {
+		if c.secure&(charNotify|charIndicate) != 0 {
 			secure = charRead | charWrite
 		}
 		h = handle{
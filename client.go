@@ -0,0 +1,508 @@
+package gatt
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// attTimeout is how long the peer is waited for to respond to an ATT
+// request: the ATT transaction timeout. A transaction that times out is
+// the last one of the connection.
+var attTimeout = 30 * time.Second
+
+// An ATTError is the Error Response of the peer to an ATT request. It
+// matches the ATTStatus of its Status with errors.Is.
+type ATTError struct {
+	Opcode byte   // of the request
+	Handle uint16 // the request was about
+	Status byte   // e.g. 0x0A, attribute not found
+}
+
+func (e *ATTError) Error() string {
+	return fmt.Sprintf("gatt: att request 0x%02X on handle 0x%04X: %s", e.Opcode, e.Handle, ATTStatus(e.Status).String())
+}
+
+func (e *ATTError) Is(target error) bool {
+	s, ok := target.(ATTStatus)
+	return ok && byte(s) == e.Status
+}
+
+// An ATTStatus is an ATT error code, such as the Status of an ATTError,
+// which matches it with errors.Is. It prints as its name, and code, e.g.
+// "Insufficient Authentication (0x05)".
+type ATTStatus byte
+
+// attStatusNames are the names of the ATT error codes, and of those of
+// the Core Specification Supplement common to the profiles.
+var attStatusNames = map[ATTStatus]string{
+	attEcodeInvalidHandle:     "Invalid Handle",
+	attEcodeReadNotPerm:       "Read Not Permitted",
+	attEcodeWriteNotPerm:      "Write Not Permitted",
+	attEcodeInvalidPDU:        "Invalid PDU",
+	attEcodeAuthentication:    "Insufficient Authentication",
+	attEcodeReqNotSupp:        "Request Not Supported",
+	attEcodeInvalidOffset:     "Invalid Offset",
+	attEcodeAuthorization:     "Insufficient Authorization",
+	attEcodePrepQueueFull:     "Prepare Queue Full",
+	attEcodeAttrNotFound:      "Attribute Not Found",
+	attEcodeAttrNotLong:       "Attribute Not Long",
+	attEcodeInsuffEncrKeySize: "Encryption Key Size Too Short",
+	attEcodeInvalAttrValueLen: "Invalid Attribute Value Length",
+	attEcodeUnlikely:          "Unlikely Error",
+	attEcodeInsuffEnc:         "Insufficient Encryption",
+	attEcodeUnsuppGrpType:     "Unsupported Group Type",
+	attEcodeInsuffResources:   "Insufficient Resources",
+	0x12:                      "Database Out Of Sync",
+	0x13:                      "Value Not Allowed",
+	0xFC:                      "Write Request Rejected",
+	0xFD:                      "Client Characteristic Configuration Descriptor Improperly Configured",
+	0xFE:                      "Procedure Already in Progress",
+	0xFF:                      "Out of Range",
+}
+
+// String returns the name of s, and its code, e.g. "Attribute Not Found
+// (0x0A)".
+func (s ATTStatus) String() string {
+	name, found := attStatusNames[s]
+	switch {
+	case found:
+	case s >= 0x80 && s <= 0x9F:
+		name = "Application Error"
+	default:
+		name = "Reserved"
+	}
+	return fmt.Sprintf("%s (0x%02X)", name, byte(s))
+}
+
+func (s ATTStatus) Error() string { return "gatt: att error " + s.String() }
+
+// A RemoteService is a primary service discovered on the peer of a
+// connection.
+type RemoteService struct {
+	UUID            UUID
+	Handle, End     uint16 // the range of its attributes
+	Characteristics []*RemoteCharacteristic
+}
+
+// A RemoteCharacteristic is a characteristic discovered on the peer of a
+// connection.
+type RemoteCharacteristic struct {
+	UUID        UUID
+	Handle      uint16 // of its declaration
+	ValueHandle uint16
+
+	// Properties are those declared, as bits of the specification:
+	// 0x02 read, 0x04 write without response, 0x08 write, 0x10 notify
+	// and 0x20 indicate, among others.
+	Properties  byte
+	Descriptors []*RemoteDescriptor
+}
+
+// A RemoteDescriptor is a descriptor discovered on the peer of a
+// connection.
+type RemoteDescriptor struct {
+	UUID   UUID
+	Handle uint16
+}
+
+// cccd returns the handle of the Client Characteristic Configuration
+// descriptor of c, or 0 if it has none.
+func (c *RemoteCharacteristic) cccd() uint16 {
+	for _, d := range c.Descriptors {
+		if d.UUID.Equal(gattAttrClientCharacteristicConfigUUID) {
+			return d.Handle
+		}
+	}
+	return 0
+}
+
+// A Client issues GATT requests to the peer of a connection, whichever
+// role the connection holds, while the local services are served to it.
+// One request is carried out at a time; a Client may be used from
+// several goroutines. The requests of an operation given a context of
+// WithRetry are retried as per its RetryPolicy.
+type Client struct {
+	mu sync.Mutex // guards c, replaced as the RetryPolicy reconnects
+	c  *conn
+}
+
+// NewClient returns a Client of the peer of c, a connection of a Server,
+// or a Device.
+func NewClient(c Conn) (*Client, error) {
+	cc, ok := c.(*conn)
+	if !ok {
+		return nil, fmt.Errorf("gatt: %T is not a connection of gatt", c)
+	}
+	return &Client{c: cc}, nil
+}
+
+// Conn returns the connection of the client.
+func (cl *Client) Conn() Conn { return cl.conn() }
+
+func (cl *Client) conn() *conn {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	return cl.c
+}
+
+// ExchangeMTU proposes an ATT MTU of up to max bytes to the peer, and
+// returns the one agreed upon.
+func (cl *Client) ExchangeMTU(ctx context.Context, max int) (int, error) {
+	if err := checkRange("MTU", max, minMTU, maxMTU); err != nil {
+		return 0, err
+	}
+	rsp, err := cl.request(ctx, []byte{attOpMtuReq, uint8(max), uint8(max >> 8)}, attOpMtuResp)
+	if err != nil {
+		return 0, err
+	}
+	if len(rsp) != 3 {
+		return 0, errors.New("gatt: malformed exchange mtu response")
+	}
+	mtu := int(binary.LittleEndian.Uint16(rsp[1:]))
+	if mtu > max {
+		mtu = max
+	}
+	if mtu < minMTU {
+		mtu = minMTU
+	}
+	cl.conn().mtu = uint16(mtu)
+	return mtu, nil
+}
+
+// DiscoverServices discovers the primary services of the peer, along
+// with their characteristics and descriptors.
+func (cl *Client) DiscoverServices(ctx context.Context) ([]*RemoteService, error) {
+	var svcs []*RemoteService
+	err := cl.attEach(ctx, 0x0001, 0xFFFF, attOpReadByGroupReq, gattAttrPrimaryServiceUUID, func(e []byte) (uint16, error) {
+		if len(e) != 6 && len(e) != 20 {
+			return 0, errors.New("gatt: malformed read by group type response")
+		}
+		s := &RemoteService{
+			UUID:   uuidFromLE(e[4:]),
+			Handle: binary.LittleEndian.Uint16(e),
+			End:    binary.LittleEndian.Uint16(e[2:]),
+		}
+		svcs = append(svcs, s)
+		return s.End, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range svcs {
+		if err := cl.discoverCharacteristics(ctx, s); err != nil {
+			return nil, err
+		}
+	}
+	return svcs, nil
+}
+
+func (cl *Client) discoverCharacteristics(ctx context.Context, s *RemoteService) error {
+	err := cl.attEach(ctx, s.Handle, s.End, attOpReadByTypeReq, gattAttrCharacteristicUUID, func(e []byte) (uint16, error) {
+		if len(e) != 7 && len(e) != 21 {
+			return 0, errors.New("gatt: malformed read by type response")
+		}
+		c := &RemoteCharacteristic{
+			UUID:        uuidFromLE(e[5:]),
+			Handle:      binary.LittleEndian.Uint16(e),
+			Properties:  e[2],
+			ValueHandle: binary.LittleEndian.Uint16(e[3:]),
+		}
+		s.Characteristics = append(s.Characteristics, c)
+		return c.Handle, nil
+	})
+	if err != nil {
+		return err
+	}
+	for i, c := range s.Characteristics {
+		end := s.End
+		if i+1 < len(s.Characteristics) {
+			end = s.Characteristics[i+1].Handle - 1
+		}
+		if c.ValueHandle < end {
+			if err := cl.discoverDescriptors(ctx, c, end); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (cl *Client) discoverDescriptors(ctx context.Context, c *RemoteCharacteristic, end uint16) error {
+	for start := c.ValueHandle + 1; start <= end; {
+		rsp, err := cl.request(ctx, []byte{attOpFindInfoReq, uint8(start), uint8(start >> 8), uint8(end), uint8(end >> 8)}, attOpFindInfoResp)
+		var e *ATTError
+		if errors.As(err, &e) && e.Status == attEcodeAttrNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		n := 4
+		if len(rsp) > 1 && rsp[1] == 0x02 {
+			n = 18
+		}
+		if len(rsp) < 2+n || (len(rsp)-2)%n != 0 {
+			return errors.New("gatt: malformed find information response")
+		}
+		var last uint16
+		for b := rsp[2:]; len(b) > 0; b = b[n:] {
+			last = binary.LittleEndian.Uint16(b)
+			c.Descriptors = append(c.Descriptors, &RemoteDescriptor{UUID: uuidFromLE(b[2:n]), Handle: last})
+		}
+		if last >= end || last < start {
+			return nil
+		}
+		start = last + 1
+	}
+	return nil
+}
+
+// Read reads the whole value of the attribute of handle h, with Read
+// Blob Requests if it does not fit in a single response.
+func (cl *Client) Read(ctx context.Context, h uint16) ([]byte, error) {
+	var v []byte
+	for {
+		b, err := cl.readAt(ctx, h, len(v))
+		var e *ATTError
+		if len(v) > 0 && errors.As(err, &e) && (e.Status == attEcodeAttrNotLong || e.Status == attEcodeInvalidOffset) {
+			return v, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		v = append(v, b...)
+		if len(b) < cl.conn().MTU()-1 {
+			return v, nil
+		}
+	}
+}
+
+// Write writes v to the attribute of handle h, with a Write Request, or
+// with a Write Command if noResponse is set. v must fit in a single
+// request, of up to the ATT MTU less 3 bytes.
+func (cl *Client) Write(ctx context.Context, h uint16, v []byte, noResponse bool) error {
+	c := cl.conn()
+	if len(v) > int(c.mtu)-3 {
+		return fmt.Errorf("gatt: writing %d bytes, above the %d the mtu allows", len(v), c.mtu-3)
+	}
+	op := byte(attOpWriteReq)
+	if noResponse {
+		op = attOpWriteCmd
+	}
+	req := append([]byte{op, uint8(h), uint8(h >> 8)}, v...)
+	if noResponse {
+		c.touch()
+		_, err := c.l2conn.Write(req)
+		return err
+	}
+	_, err := cl.request(ctx, req, attOpWriteResp)
+	return err
+}
+
+// Subscribe calls f with each value c is notified, or indicated, with,
+// and enables the notifications, or the indications if c does not
+// support notifications. f is called from the goroutine serving the
+// connection: it must not block, nor issue requests of its own.
+func (cl *Client) Subscribe(ctx context.Context, c *RemoteCharacteristic, f func(value []byte)) error {
+	return cl.SubscribeTimed(ctx, c, func(value []byte, _ time.Time) { f(value) })
+}
+
+// SubscribeTimed subscribes to c as Subscribe does, f being also told
+// when the host received each value: on Linux, when the device was read
+// the packet completing it, rather than when f gets to be called, for
+// the values of sensors to be laid on a time line. The times hold a
+// monotonic clock reading; compare them with Sub, not by their wall
+// clock.
+func (cl *Client) SubscribeTimed(ctx context.Context, c *RemoteCharacteristic, f func(value []byte, at time.Time)) error {
+	var flag uint16
+	switch {
+	case c.Properties&charNotify != 0:
+		flag = gattCCCNotifyFlag
+	case c.Properties&charIndicate != 0:
+		flag = gattCCCIndicateFlag
+	default:
+		return fmt.Errorf("gatt: characteristic %v supports neither notifications nor indications", c.UUID)
+	}
+	cccd := c.cccd()
+	if cccd == 0 {
+		return fmt.Errorf("gatt: characteristic %v has no client characteristic configuration", c.UUID)
+	}
+	cc := cl.conn()
+	cc.subsmu.Lock()
+	cc.subs[c.ValueHandle] = f
+	cc.subsmu.Unlock()
+	if err := cl.Write(ctx, cccd, []byte{uint8(flag), uint8(flag >> 8)}, false); err != nil {
+		cc = cl.conn()
+		cc.subsmu.Lock()
+		delete(cc.subs, c.ValueHandle)
+		cc.subsmu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Unsubscribe disables the notifications, or indications, of c.
+func (cl *Client) Unsubscribe(ctx context.Context, c *RemoteCharacteristic) error {
+	cc := cl.conn()
+	cc.subsmu.Lock()
+	delete(cc.subs, c.ValueHandle)
+	cc.subsmu.Unlock()
+	cccd := c.cccd()
+	if cccd == 0 {
+		return fmt.Errorf("gatt: characteristic %v has no client characteristic configuration", c.UUID)
+	}
+	return cl.Write(ctx, cccd, []byte{0x00, 0x00}, false)
+}
+
+// readAt reads the value of the attribute of handle h from offset on,
+// with a single Read, or Read Blob, Request.
+func (cl *Client) readAt(ctx context.Context, h uint16, offset int) ([]byte, error) {
+	var rsp []byte
+	var err error
+	if offset == 0 {
+		rsp, err = cl.request(ctx, []byte{attOpReadReq, uint8(h), uint8(h >> 8)}, attOpReadResp)
+	} else {
+		rsp, err = cl.request(ctx, []byte{attOpReadBlobReq, uint8(h), uint8(h >> 8), uint8(offset), uint8(offset >> 8)}, attOpReadBlobResp)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rsp[1:], nil
+}
+
+// attEach issues the Read By Group Type, or Read By Type, Requests op of
+// type typ, over the handles from start to end, and calls f with each
+// entry of the responses. f returns the last handle the entry covers,
+// from which the next request carries on.
+func (cl *Client) attEach(ctx context.Context, start, end uint16, op byte, typ UUID, f func(e []byte) (uint16, error)) error {
+	for start <= end {
+		req := append([]byte{op, uint8(start), uint8(start >> 8), uint8(end), uint8(end >> 8)}, typ.reverseBytes()...)
+		rsp, err := cl.request(ctx, req, attRespFor[op])
+		var e *ATTError
+		if errors.As(err, &e) && e.Status == attEcodeAttrNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(rsp) < 2 || rsp[1] == 0 || (len(rsp)-2)%int(rsp[1]) != 0 {
+			return fmt.Errorf("gatt: malformed response 0x%02X", rsp[0])
+		}
+		n := int(rsp[1])
+		var last uint16
+		for b := rsp[2:]; len(b) > 0; b = b[n:] {
+			if last, err = f(b[:n]); err != nil {
+				return err
+			}
+		}
+		if last >= end || last < start {
+			return nil
+		}
+		start = last + 1
+	}
+	return nil
+}
+
+// attRequest sends the ATT request req, and returns the response, of
+// opcode rspOp, or the ATTError the peer responded with. If ctx is done
+// first, the response is still waited for, so that the next request does
+// not mistake it for its own.
+func (c *conn) attRequest(ctx context.Context, req []byte, rspOp byte) ([]byte, error) {
+	c.reqmu.Lock()
+	if c.attTimedOut {
+		c.reqmu.Unlock()
+		return nil, errors.New("gatt: an att request timed out on the connection")
+	}
+	select {
+	case <-c.rspc: // unsolicited
+	default:
+	}
+	c.touch()
+	if _, err := c.l2conn.Write(req); err != nil {
+		c.reqmu.Unlock()
+		return nil, err
+	}
+	t := time.NewTimer(attTimeout)
+	select {
+	case rsp := <-c.rspc:
+		t.Stop()
+		c.reqmu.Unlock()
+		if rsp[0] == attOpError && len(rsp) == 5 && rsp[1] == req[0] {
+			return nil, &ATTError{Opcode: rsp[1], Handle: binary.LittleEndian.Uint16(rsp[2:]), Status: rsp[4]}
+		}
+		if rsp[0] != rspOp {
+			return nil, fmt.Errorf("gatt: unexpected response 0x%02X to request 0x%02X", rsp[0], req[0])
+		}
+		return rsp, nil
+	case <-t.C:
+		c.attTimedOut = true
+		c.reqmu.Unlock()
+		return nil, fmt.Errorf("gatt: att request 0x%02X timed out", req[0])
+	case <-c.done:
+		t.Stop()
+		c.reqmu.Unlock()
+		return nil, c.closedErr()
+	case <-ctx.Done():
+		go func() {
+			defer c.reqmu.Unlock()
+			defer t.Stop()
+			select {
+			case <-c.rspc:
+			case <-t.C:
+				c.attTimedOut = true
+			case <-c.done:
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// handleClient handles b if it is a response to a request of the
+// client, or a notification, or indication, of the peer, and reports
+// whether it was.
+func (c *conn) handleClient(b []byte, at time.Time) bool {
+	if c.isExtRsp(b[0]) {
+		select {
+		case c.rspc <- b:
+		default: // unsolicited
+		}
+		return true
+	}
+	switch b[0] {
+	case attOpError, attOpMtuResp, attOpFindInfoResp, attOpFindByTypeResp,
+		attOpReadByTypeResp, attOpReadResp, attOpReadBlobResp, attOpReadMultiResp,
+		attOpReadByGroupResp, attOpWriteResp, attOpPrepWriteResp, attOpExecWriteResp:
+		select {
+		case c.rspc <- b:
+		default: // unsolicited
+		}
+		return true
+	case attOpHandleNotify, attOpHandleInd:
+		if len(b) < 3 {
+			return true
+		}
+		h := binary.LittleEndian.Uint16(b[1:])
+		c.subsmu.Lock()
+		f := c.subs[h]
+		c.subsmu.Unlock()
+		if f != nil {
+			c.server.call(fmt.Sprintf("notification 0x%04X", h), func() { f(b[3:], at) })
+		}
+		if b[0] == attOpHandleInd {
+			c.l2conn.Write([]byte{attOpHandleCnf})
+		}
+		return true
+	case attOpHandleCnf: // of an indication of the server
+		c.traceATT(true, b, nil)
+		select {
+		case c.cnfc <- struct{}{}:
+		default: // unsolicited
+		}
+		return true
+	}
+	return false
+}
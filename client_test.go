@@ -0,0 +1,54 @@
+package gatt
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// timedHandler is a testHandler whose PDUs are all received at at.
+type timedHandler struct {
+	*testHandler
+	at time.Time
+}
+
+func (t timedHandler) ReadTimed(b []byte) (int, time.Time, error) {
+	n, err := t.Read(b)
+	return n, t.at, err
+}
+
+func TestSubscribeTimed(t *testing.T) {
+	at := time.Now().Add(-time.Second)
+	h := timedHandler{&testHandler{readc: make(chan []byte, 2), writec: make(chan []byte, 8)}, at}
+	cl, err := NewServer(Name("")).Attach(h, Addr{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Conn().Close()
+	go func() {
+		for b := range h.writec {
+			if b[0] == attOpWriteReq {
+				h.readc <- []byte{attOpWriteResp}
+				h.readc <- []byte{attOpHandleNotify, 0x03, 0x00, 'v'}
+				return
+			}
+		}
+	}()
+	rc := &RemoteCharacteristic{
+		ValueHandle: 0x0003,
+		Properties:  charNotify,
+		Descriptors: []*RemoteDescriptor{{UUID: gattAttrClientCharacteristicConfigUUID, Handle: 0x0004}},
+	}
+	got := make(chan time.Time, 1)
+	if err := cl.SubscribeTimed(context.Background(), rc, func(v []byte, at time.Time) { got <- at }); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case t0 := <-got:
+		if !t0.Equal(at) {
+			t.Errorf("notification received at %v, want %v, as the link read it", t0, at)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("notification not delivered")
+	}
+}
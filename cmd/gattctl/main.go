@@ -0,0 +1,490 @@
+// Command gattctl drives a local BLE device from the command line. It is
+// built on the public API of gatt only, and doubles as a diagnostic tool.
+//
+// Usage:
+//
+//	gattctl [-dev n] [-down] <command> [flags] [args]
+//
+// The commands are:
+//
+//	scan       print the advertisements received
+//	connect    connect to a peripheral, and report on the connection
+//	advertise  advertise an iBeacon, or a list of services
+//	services   list the services of a peripheral
+//	read       read a characteristic of a peripheral
+//	write      write a characteristic of a peripheral
+//	subscribe  subscribe to a characteristic of a peripheral
+//	pair       pair with a peripheral, by LE Secure Connections
+//
+// Addresses are printed, and parsed, in the byte order of the controller,
+// so that those printed by scan can be passed to connect as they are, with
+// -random for those of a random type.
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/paypal/gatt"
+)
+
+var (
+	devID    = flag.Int("dev", -1, "index of the HCI device, e.g. 0 for hci0; negative selects one")
+	takeDown = flag.Bool("down", false, "take the HCI device down, from the kernel and bluetoothd, before opening it")
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(ctx context.Context, args []string) error
+}
+
+var commands = []command{
+	{"scan", "[-active] [-dup] [-t duration] [-service uuid]", scan},
+	{"connect", "[-random] [-t duration] addr", connect},
+	{"advertise", "[-name name] [-t duration] (-beacon uuid [-major n] [-minor n] [-power dBm] | service-uuid...)", advertise},
+	{"services", "[-random] addr", services},
+	{"read", "[-random] addr char-uuid", read},
+	{"write", "[-random] [-cmd] addr char-uuid hex-value", write},
+	{"subscribe", "[-random] [-t duration] addr char-uuid", subscribe},
+	{"pair", "[-random] [-keys file] addr", pair},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: gattctl [-dev n] [-down] <command> [flags] [args]\n\ncommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", c.name, c.usage)
+	}
+	os.Exit(2)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	for _, c := range commands {
+		if c.name == flag.Arg(0) {
+			if err := c.run(ctx, flag.Args()[1:]); err != nil {
+				fmt.Fprintf(os.Stderr, "gattctl %s: %v\n", c.name, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+	usage()
+}
+
+// withDevice initializes the device, calls f with it, and stops it.
+func withDevice(ctx context.Context, opts gatt.DeviceOptions, f func(d gatt.Device) error) error {
+	d := gatt.NewDevice()
+	opts.ID, opts.TakeDown = *devID, *takeDown
+	if err := d.Init(ctx, opts); err != nil {
+		return err
+	}
+	err := f(d)
+	sctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if serr := d.Stop(sctx); err == nil {
+		err = serr
+	}
+	return err
+}
+
+// withTimeout returns a context derived from ctx, and done after d if d
+// is not zero.
+func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d == 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+// interrupted reports whether err only tells that the command was
+// interrupted, or ran for as long as it was told to.
+func interrupted(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+func parseAddr(s string, random bool) (gatt.Addr, error) {
+	a, err := net.ParseMAC(s)
+	if err != nil || len(a) != 6 {
+		return gatt.Addr{}, fmt.Errorf("invalid address %q", s)
+	}
+	if random {
+		return gatt.RandomAddr(gatt.BDAddr{HardwareAddr: a}), nil
+	}
+	return gatt.PublicAddr(gatt.BDAddr{HardwareAddr: a}), nil
+}
+
+func scan(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("scan", flag.ExitOnError)
+	active := fs.Bool("active", false, "request the scan responses as well")
+	dup := fs.Bool("dup", false, "report each advertiser each time it advertises")
+	d := fs.Duration("t", 0, "scan for this long; zero scans until interrupted")
+	svc := fs.String("service", "", "only print the advertisers of this service")
+	fs.Parse(args)
+	var filter gatt.UUID
+	if *svc != "" {
+		u, err := gatt.ParseUUID(*svc)
+		if err != nil {
+			return err
+		}
+		filter = u
+	}
+
+	return withDevice(ctx, gatt.DeviceOptions{}, func(dev gatt.Device) error {
+		ctx, cancel := withTimeout(ctx, *d)
+		defer cancel()
+		err := dev.Scan(ctx, gatt.ScanOptions{Active: *active, FilterDuplicates: !*dup}, func(a *gatt.Advertisement) {
+			if *svc != "" && !a.HasService(filter) {
+				return
+			}
+			kind := "adv"
+			if a.ScanResponse {
+				kind = "rsp"
+			}
+			fmt.Printf("%s %s rssi %4d", a.Addr, kind, a.RSSI)
+			if name := localName(a.Data); name != "" {
+				fmt.Printf(" name %q", name)
+			}
+			for _, u := range a.Services() {
+				fmt.Printf(" %v", u)
+			}
+			fmt.Println()
+		})
+		if interrupted(err) {
+			return nil
+		}
+		return err
+	})
+}
+
+// localName returns the local name, complete or shortened, advertised
+// in b, if any.
+func localName(b []byte) string {
+	for len(b) > 1 && b[0] > 0 && len(b) > int(b[0]) {
+		if t := b[1]; t == 0x08 || t == 0x09 {
+			return string(b[2 : 1+b[0]])
+		}
+		b = b[1+b[0]:]
+	}
+	return ""
+}
+
+func connect(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("connect", flag.ExitOnError)
+	random := fs.Bool("random", false, "the address is a random one")
+	d := fs.Duration("t", 0, "stay connected for this long; zero stays until interrupted")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("usage: gattctl connect [-random] [-t duration] addr")
+	}
+	addr, err := parseAddr(fs.Arg(0), *random)
+	if err != nil {
+		return err
+	}
+
+	events := make(chan gatt.ConnEvent, 4)
+	return withDevice(ctx, gatt.DeviceOptions{}, func(dev gatt.Device) error {
+		dev.SubscribeConns(events, gatt.DropOldest)
+		cctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		c, err := dev.Connect(cctx, addr, gatt.ConnectOptions{})
+		cancel()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("connected to %s, mtu %d\n", c.RemoteAddr(), c.MTU())
+
+		ctx, cancel := withTimeout(ctx, *d)
+		defer cancel()
+		t := time.NewTicker(5 * time.Second)
+		defer t.Stop()
+		for {
+			select {
+			case e := <-events:
+				if !e.Connected && e.Conn == c {
+					fmt.Println("disconnected")
+					return nil
+				}
+			case <-t.C:
+				if r, ok := c.(gatt.StatsReporter); ok {
+					s := r.Stats()
+					fmt.Printf("tx %d bytes %.0f B/s, rx %d bytes %.0f B/s, latency %v\n",
+						s.TxBytes, s.TxRate, s.RxBytes, s.RxRate, s.Latency)
+				}
+			case <-ctx.Done():
+				return c.Close()
+			}
+		}
+	})
+}
+
+func advertise(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("advertise", flag.ExitOnError)
+	name := fs.String("name", "gattctl", "device name")
+	d := fs.Duration("t", 0, "advertise for this long; zero advertises until interrupted")
+	beacon := fs.String("beacon", "", "advertise an iBeacon of this proximity UUID")
+	major := fs.Uint("major", 0, "major of the iBeacon")
+	minor := fs.Uint("minor", 0, "minor of the iBeacon")
+	power := fs.Int("power", -59, "measured power of the iBeacon, at 1 m, in dBm")
+	fs.Parse(args)
+
+	var opts gatt.AdvertiseOptions
+	if *beacon != "" {
+		u, err := gatt.ParseUUID(*beacon)
+		if err != nil {
+			return err
+		}
+		if u.Len() != 16 || *major > 0xFFFF || *minor > 0xFFFF || *power < -128 || *power > 127 {
+			return errors.New("an iBeacon has a 128-bit UUID, a 16-bit major and minor, and a power in [-128, 127]")
+		}
+		opts.AdvertisingPacket = iBeacon(u, uint16(*major), uint16(*minor), int8(*power))
+	} else {
+		for _, s := range fs.Args() {
+			u, err := gatt.ParseUUID(s)
+			if err != nil {
+				return err
+			}
+			opts.AdvertiseServices = append(opts.AdvertiseServices, u)
+		}
+	}
+
+	return withDevice(ctx, gatt.DeviceOptions{
+		Name:       *name,
+		Connect:    func(c gatt.Conn) { fmt.Printf("%s connected\n", c.RemoteAddr()) },
+		Disconnect: func(c gatt.Conn) { fmt.Printf("%s disconnected\n", c.RemoteAddr()) },
+	}, func(dev gatt.Device) error {
+		ctx, cancel := withTimeout(ctx, *d)
+		defer cancel()
+		fmt.Println("advertising")
+		if err := dev.Advertise(ctx, opts); !interrupted(err) {
+			return err
+		}
+		return nil
+	})
+}
+
+// iBeacon returns the advertising packet of an iBeacon.
+func iBeacon(u gatt.UUID, major, minor uint16, power int8) []byte {
+	id, _ := hex.DecodeString(strings.Replace(u.String(), "-", "", -1))
+	b := []byte{
+		0x02, 0x01, 0x06, // flags: LE general discoverable, BR/EDR not supported
+		0x1A, 0xFF, 0x4C, 0x00, 0x02, 0x15, // Apple manufacturer data, iBeacon
+	}
+	b = append(b, id...)
+	return append(b, byte(major>>8), byte(major), byte(minor>>8), byte(minor), byte(power))
+}
+
+// withPeer connects to the peripheral of address addr, discovers its
+// services, and calls f with a client of it, its services, and a channel
+// closed once it disconnects, before disconnecting from it.
+func withPeer(ctx context.Context, addr gatt.Addr, f func(cl *gatt.Client, svcs []*gatt.RemoteService, gone <-chan struct{}) error) error {
+	events := make(chan gatt.ConnEvent, 4)
+	return withDevice(ctx, gatt.DeviceOptions{}, func(dev gatt.Device) error {
+		dev.SubscribeConns(events, gatt.DropOldest)
+		cctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		defer cancel()
+		c, err := dev.Connect(cctx, addr, gatt.ConnectOptions{})
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+		gone := make(chan struct{})
+		go func() {
+			for e := range events {
+				if !e.Connected && e.Conn == c {
+					close(gone)
+					return
+				}
+			}
+		}()
+		cl, err := gatt.NewClient(c)
+		if err != nil {
+			return err
+		}
+		var aerr *gatt.ATTError
+		if _, err := cl.ExchangeMTU(cctx, 517); err != nil && !errors.As(err, &aerr) {
+			return err
+		}
+		svcs, err := cl.DiscoverServices(cctx)
+		if err != nil {
+			return err
+		}
+		return f(cl, svcs, gone)
+	})
+}
+
+// peerArgs parses the flags of fs, then the address, and the n other
+// arguments, of args, as usage tells.
+func peerArgs(fs *flag.FlagSet, args []string, n int, usage string) (gatt.Addr, []string, error) {
+	random := fs.Bool("random", false, "the address is a random one")
+	fs.Parse(args)
+	if fs.NArg() != 1+n {
+		return gatt.Addr{}, nil, errors.New("usage: gattctl " + usage)
+	}
+	addr, err := parseAddr(fs.Arg(0), *random)
+	return addr, fs.Args()[1:], err
+}
+
+// findChar returns the characteristic of UUID s among those of svcs.
+func findChar(svcs []*gatt.RemoteService, s string) (*gatt.RemoteCharacteristic, error) {
+	u, err := gatt.ParseUUID(s)
+	if err != nil {
+		return nil, err
+	}
+	for _, svc := range svcs {
+		for _, c := range svc.Characteristics {
+			if c.UUID.Equal(u) {
+				return c, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no characteristic %v", u)
+}
+
+// propNames are the names of the bits of the properties of a
+// characteristic.
+var propNames = []string{"broadcast", "read", "write-without-response", "write", "notify", "indicate", "signed-write", "extended"}
+
+func properties(p byte) string {
+	var names []string
+	for i, name := range propNames {
+		if p&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+func services(ctx context.Context, args []string) error {
+	addr, _, err := peerArgs(flag.NewFlagSet("services", flag.ExitOnError), args, 0, "services [-random] addr")
+	if err != nil {
+		return err
+	}
+	return withPeer(ctx, addr, func(cl *gatt.Client, svcs []*gatt.RemoteService, gone <-chan struct{}) error {
+		for _, s := range svcs {
+			fmt.Printf("service %v [0x%04X-0x%04X]\n", s.UUID, s.Handle, s.End)
+			for _, c := range s.Characteristics {
+				fmt.Printf("  characteristic %v value 0x%04X %s\n", c.UUID, c.ValueHandle, properties(c.Properties))
+				for _, d := range c.Descriptors {
+					fmt.Printf("    descriptor %v 0x%04X\n", d.UUID, d.Handle)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func read(ctx context.Context, args []string) error {
+	addr, rest, err := peerArgs(flag.NewFlagSet("read", flag.ExitOnError), args, 1, "read [-random] addr char-uuid")
+	if err != nil {
+		return err
+	}
+	return withPeer(ctx, addr, func(cl *gatt.Client, svcs []*gatt.RemoteService, gone <-chan struct{}) error {
+		c, err := findChar(svcs, rest[0])
+		if err != nil {
+			return err
+		}
+		v, err := cl.Read(ctx, c.ValueHandle)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%x\n", v)
+		return nil
+	})
+}
+
+func write(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("write", flag.ExitOnError)
+	noResponse := fs.Bool("cmd", false, "write without response")
+	addr, rest, err := peerArgs(fs, args, 2, "write [-random] [-cmd] addr char-uuid hex-value")
+	if err != nil {
+		return err
+	}
+	v, err := hex.DecodeString(rest[1])
+	if err != nil {
+		return fmt.Errorf("invalid value: %v", err)
+	}
+	return withPeer(ctx, addr, func(cl *gatt.Client, svcs []*gatt.RemoteService, gone <-chan struct{}) error {
+		c, err := findChar(svcs, rest[0])
+		if err != nil {
+			return err
+		}
+		return cl.Write(ctx, c.ValueHandle, v, *noResponse)
+	})
+}
+
+func subscribe(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("subscribe", flag.ExitOnError)
+	d := fs.Duration("t", 0, "stay subscribed for this long; zero stays until interrupted")
+	addr, rest, err := peerArgs(fs, args, 1, "subscribe [-random] [-t duration] addr char-uuid")
+	if err != nil {
+		return err
+	}
+	return withPeer(ctx, addr, func(cl *gatt.Client, svcs []*gatt.RemoteService, gone <-chan struct{}) error {
+		c, err := findChar(svcs, rest[0])
+		if err != nil {
+			return err
+		}
+		start := time.Now()
+		err = cl.SubscribeTimed(ctx, c, func(v []byte, at time.Time) {
+			fmt.Printf("%10.3f %x\n", at.Sub(start).Seconds(), v)
+		})
+		if err != nil {
+			return err
+		}
+		ctx, cancel := withTimeout(ctx, *d)
+		defer cancel()
+		select {
+		case <-gone:
+			fmt.Println("disconnected")
+			return nil
+		case <-ctx.Done():
+			return nil
+		}
+	})
+}
+
+func pair(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("pair", flag.ExitOnError)
+	keys := fs.String("keys", "", "keep the bond in this file, its keys in the clear")
+	addr, _, err := peerArgs(fs, args, 0, "pair [-random] [-keys file] addr")
+	if err != nil {
+		return err
+	}
+	var opts gatt.DeviceOptions
+	if *keys != "" {
+		opts.KeyStore = gatt.NewFileKeyStore(*keys, nil)
+	}
+	return withDevice(ctx, opts, func(dev gatt.Device) error {
+		ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		defer cancel()
+		c, err := dev.Connect(ctx, addr, gatt.ConnectOptions{})
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+		b, err := gatt.Pair(ctx, c)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("paired with %s, identity %s", c.RemoteAddr(), b.Addr)
+		if b.IRK != ([16]byte{}) {
+			fmt.Print(", IRK distributed")
+		}
+		fmt.Println()
+		return nil
+	})
+}
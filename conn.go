@@ -1,11 +1,15 @@
 package gatt
 
 import (
+	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
+	"runtime/pprof"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type security int
@@ -19,19 +23,54 @@ const (
 type conn struct {
 	server      *Server
 	localAddr   BDAddr
-	remoteAddr  BDAddr
-	rssi        int
+	remoteAddr  Addr
+	rssi        *int32 // last read, or -1; updated atomically
 	mtu         uint16
 	security    security
 	l2conn      io.ReadWriteCloser
 	notifiers   map[*Characteristic]*notifier
 	notifiersmu *sync.Mutex
+	stats       func() ConnStats
+	indmu       *sync.Mutex // held while an indication is outstanding
+	cnfc        chan struct{}
+	channels    func() (ConnChannels, error)
+	phy         func() (tx, rx PHY, err error)
+	setPHY      func(tx, rx PHY) error
+	readRSSI    func() (int, error)
+	pair        func(ctx context.Context) (Bond, error)
+
+	// Backend of the parameters of the connection, negotiated as per the
+	// ConnPolicy of the server; updateParams is nil if not supported.
+	central      bool
+	params       func() ConnParams
+	updateParams func(p ConnParams) error
+	classc       chan string     // to the negotiation
+	wakec        chan chan error // to the negotiation, from Wake, or nil from touch
+	activity     *activity
+	classmu      *sync.Mutex
+	class        string
+	done         chan struct{} // closed as the connection is closed
+	closeOnce    *sync.Once
+	readErr      error // the reads failed with, set before done is closed, if they did
+
+	bond *Addr // identity address of the peer, if bonded; see Bonds
+
+	reqLimit  *limiter // of the ATT requests of the peer, if limited
+	limitOnce *sync.Once
+
+	// Client side of the connection; see Client.
+	reqmu       *sync.Mutex // held for the duration of a request
+	rspc        chan []byte
+	attTimedOut bool
+	subsmu      *sync.Mutex
+	subs        map[uint16]func(value []byte, at time.Time) // by value handle
+	extRsp      *uint32                                     // opcode of the response to a Request awaited; see isExtRsp
 }
 
-func newConn(server *Server, l2conn io.ReadWriteCloser, addr BDAddr) *conn {
-	return &conn{
+func newConn(server *Server, l2conn io.ReadWriteCloser, addr Addr) *conn {
+	c := &conn{
 		server:      server,
-		rssi:        -1,
+		rssi:        new(int32),
 		localAddr:   server.addr,
 		remoteAddr:  addr,
 		mtu:         23,
@@ -39,12 +78,32 @@ func newConn(server *Server, l2conn io.ReadWriteCloser, addr BDAddr) *conn {
 		l2conn:      l2conn,
 		notifiers:   make(map[*Characteristic]*notifier),
 		notifiersmu: &sync.Mutex{},
-	}
+		indmu:       &sync.Mutex{},
+		cnfc:        make(chan struct{}, 1),
+		classc:      make(chan string, 1),
+		wakec:       make(chan chan error, 1),
+		activity:    &activity{last: time.Now().UnixNano(), rx: time.Now().UnixNano()},
+		classmu:     &sync.Mutex{},
+		done:        make(chan struct{}),
+		closeOnce:   &sync.Once{},
+		reqmu:       &sync.Mutex{},
+		rspc:        make(chan []byte, 1),
+		subsmu:      &sync.Mutex{},
+		subs:        make(map[uint16]func([]byte, time.Time)),
+		extRsp:      new(uint32),
+		reqLimit:    newLimiter(server.requestLimit),
+		limitOnce:   &sync.Once{},
+	}
+	atomic.StoreInt32(c.rssi, -1)
+	if server.recordATT != nil {
+		c.l2conn = recorder{l2conn, c, server.recordATT}
+	}
+	return c
 }
 
-func (c *conn) String() string     { return c.remoteAddr.String() }
-func (c *conn) LocalAddr() BDAddr  { return c.localAddr }
-func (c *conn) RemoteAddr() BDAddr { return c.remoteAddr }
+func (c *conn) String() string    { return c.remoteAddr.String() }
+func (c *conn) LocalAddr() BDAddr { return c.localAddr }
+func (c *conn) RemoteAddr() Addr  { return c.remoteAddr }
 func (c *conn) Close() error {
 	if err := c.close(); err != nil {
 		return err
@@ -54,13 +113,53 @@ func (c *conn) Close() error {
 	}
 	return nil
 }
-func (c *conn) RSSI() int { return c.rssi }
+func (c *conn) RSSI() int { return int(atomic.LoadInt32(c.rssi)) }
 func (c *conn) MTU() int  { return int(c.mtu) }
+func (c *conn) Stats() ConnStats {
+	if c.stats == nil {
+		return ConnStats{}
+	}
+	return c.stats()
+}
+func (c *conn) Channels() (ConnChannels, error) {
+	if c.channels == nil {
+		return ConnChannels{}, errors.New("gatt: channels not reported on this platform")
+	}
+	return c.channels()
+}
+func (c *conn) PHY() (tx, rx PHY, err error) {
+	if c.phy == nil {
+		return 0, 0, errPHYs
+	}
+	return c.phy()
+}
+func (c *conn) SetPHY(tx, rx PHY) error {
+	if c.setPHY == nil {
+		return errPHYs
+	}
+	return c.setPHY(tx, rx)
+}
 func (c *conn) UpdateRSSI() (rssi int, err error) {
-	// TODO
-	return 0, errors.New("not implemented yet")
+	if c.readRSSI == nil {
+		return 0, errors.New("gatt: RSSI not read on this platform")
+	}
+	if rssi, err = c.readRSSI(); err != nil {
+		return 0, err
+	}
+	atomic.StoreInt32(c.rssi, int32(rssi))
+	if f := c.server.receiveRSSI; f != nil {
+		c.server.call("receive rssi", func() { f(c, rssi) })
+	}
+	return rssi, nil
 }
-func (c *conn) close() error {
+func (c *conn) close() error { return c.closeWith(nil) }
+
+// closeWith closes c, whose reads failed with err, if they did.
+func (c *conn) closeWith(err error) error {
+	c.closeOnce.Do(func() {
+		c.readErr = err
+		close(c.done)
+	})
 	// Stop all notifiers
 	// TODO: Clear all descriptor CCC values?
 	c.notifiersmu.Lock()
@@ -71,22 +170,109 @@ func (c *conn) close() error {
 	return nil
 }
 
+// closedErr returns the error of the requests of c, closed: that its
+// reads failed with, if the connection was lost.
+func (c *conn) closedErr() error {
+	if c.readErr != nil {
+		return fmt.Errorf("gatt: connection closed: %w", c.readErr)
+	}
+	return errors.New("gatt: connection closed")
+}
+
 func (c *conn) loop() {
+	pprof.SetGoroutineLabels(pprof.WithLabels(context.Background(), pprof.Labels("gatt", "att-conn", "peer", c.remoteAddr.String())))
 	// TODO: rework the usage io.ReadWriterCloser to conform the semantic.
 	// Or, alternatively, cook a more stiuable interface between L2CAP layer.
+	var wg sync.WaitGroup
+	if p := c.server.paramsPolicy(); p != nil && c.updateParams != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.negotiateParams(p)
+		}()
+	}
+	if f := c.server.lossWarning; f != nil {
+		percent := c.server.lossPercent
+		if percent == 0 {
+			percent = defaultLossPercent
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.watchSilence(percent, f)
+		}()
+	}
+	c.restoreSubscriptions()
+	var readErr error
 	for {
 		// L2CAP implementations shall support a minimum MTU size of 48 bytes.
 		// The default value is 672 bytes
 		b := make([]byte, 672)
-		n, err := c.l2conn.Read(b)
-		if n == 0 || err != nil {
+		n, at, err := readTimed(c.l2conn, b)
+		if errors.Is(err, io.ErrShortBuffer) {
+			// Larger than any MTU supported; dropped by the L2CAP.
+			continue
+		}
+		if err != nil {
+			readErr = err
 			break
 		}
-		if rsp := c.handleReq(b[:n]); rsp != nil {
+		c.received()
+		if n == 0 {
+			// Not even an opcode to reject.
+			continue
+		}
+		c.touch()
+		if c.handleClient(b[:n], at) {
+			continue
+		}
+		if c.reqLimit != nil && !c.reqLimit.allow(time.Now()) {
+			c.exceeded("ATT requests")
+			continue
+		}
+		if c.handleExt(b[:n]) {
+			continue
+		}
+		if rsp := c.serveReq(b[:n]); rsp != nil {
 			c.l2conn.Write(rsp)
 		}
 	}
-	c.close()
+	c.closeWith(readErr)
+	wg.Wait()
+}
+
+// A timedReader is a link that tells when the host received the PDUs
+// read from it, such as the connections of the linux package.
+type timedReader interface {
+	ReadTimed(b []byte) (int, time.Time, error)
+}
+
+// readTimed reads the next PDU from r, and reports when the host received
+// it: as r tells, if it does, or now.
+func readTimed(r io.Reader, b []byte) (int, time.Time, error) {
+	if r, ok := r.(timedReader); ok {
+		return r.ReadTimed(b)
+	}
+	n, err := r.Read(b)
+	return n, time.Now(), err
+}
+
+// serveReq handles a request, within a span if the server traces them,
+// and traces the PDUs if it does.
+func (c *conn) serveReq(b []byte) (rsp []byte) {
+	c.traceATT(true, b, nil)
+	defer func() { c.traceATT(false, rsp, b) }()
+	if c.server.span == nil {
+		return c.handleReq(b)
+	}
+	end := c.server.span(fmt.Sprintf("att: 0x%02X", b[0]))
+	rsp = c.handleReq(b)
+	if len(rsp) == 5 && rsp[0] == attOpError {
+		end(ATTStatus(rsp[4]))
+	} else {
+		end(nil)
+	}
+	return rsp
 }
 
 // handleReq dispatches a raw request from the conn shim
@@ -95,7 +281,20 @@ func (c *conn) loop() {
 func (c *conn) handleReq(b []byte) []byte {
 	var resp []byte
 
-	switch reqType, req := b[0], b[1:]; reqType {
+	reqType, req := b[0], b[1:]
+	if !validReq(reqType, req) {
+		if reqType == attOpWriteCmd {
+			return nil // commands get no response, not even an error
+		}
+		return attErrorResp(reqType, 0x0000, attEcodeInvalidPDU)
+	}
+	if reqHasRange(reqType) {
+		if start, end := readHandleRange(req); start == 0x0000 || start > end {
+			return attErrorResp(reqType, start, attEcodeInvalidHandle)
+		}
+	}
+
+	switch reqType {
 	case attOpMtuReq:
 		resp = c.handleMTU(req)
 	case attOpFindInfoReq:
@@ -130,10 +329,9 @@ func (c *conn) handleMTU(b []byte) []byte {
 	if c.mtu < 23 {
 		c.mtu = 23
 	}
-	// Clip the value to a reasonably safe value.
-	// TODO: make this value configurable.
-	if c.mtu >= 256 {
-		c.mtu = 256
+	// Clip the value to the MaxMTU of the server.
+	if max := uint16(c.server.maxMTU); c.mtu > max {
+		c.mtu = max
 	}
 	return []byte{attOpMtuResp, uint8(c.mtu), uint8(c.mtu >> 8)}
 }
@@ -188,11 +386,11 @@ func (c *conn) handleFindInfo(b []byte) []byte {
 func (c *conn) handleFindByType(b []byte) []byte {
 	start, end := readHandleRange(b)
 
-	if uuid := (UUID{reverse(b[4:6])}); !uuidEqual(uuid, gattAttrPrimaryServiceUUID) {
+	if uuid := uuidFromLE(b[4:6]); !uuid.Equal(gattAttrPrimaryServiceUUID) {
 		return attErrorResp(attOpFindByTypeReq, start, attEcodeAttrNotFound)
 	}
 
-	uuid := UUID{reverse(b[6:])}
+	uuid := uuidFromLE(b[6:])
 
 	w := newL2capWriter(c.mtu)
 	w.WriteByteFit(attOpFindByTypeResp)
@@ -220,10 +418,10 @@ func (c *conn) handleFindByType(b []byte) []byte {
 
 func (c *conn) handleReadByType(b []byte) []byte {
 	start, end := readHandleRange(b)
-	uuid := UUID{reverse(b[4:])}
+	uuid := uuidFromLE(b[4:])
 
 	// TODO: Refactor out into two extra helper handle* functions?
-	if uuidEqual(uuid, gattAttrCharacteristicUUID) {
+	if uuid.Equal(gattAttrCharacteristicUUID) {
 		w := newL2capWriter(c.mtu)
 		w.WriteByteFit(attOpReadByTypeResp)
 		uuidLen := -1
@@ -363,13 +561,13 @@ func (c *conn) handleRead(reqType byte, b []byte) []byte {
 
 func (c *conn) handleReadByGroup(b []byte) []byte {
 	start, end := readHandleRange(b)
-	uuid := UUID{reverse(b[4:])}
+	uuid := uuidFromLE(b[4:])
 
 	var typ handleType
 	switch {
-	case uuidEqual(uuid, gattAttrPrimaryServiceUUID):
+	case uuid.Equal(gattAttrPrimaryServiceUUID):
 		typ = typService
-	case uuidEqual(uuid, gattAttrIncludeUUID):
+	case uuid.Equal(gattAttrIncludeUUID):
 		typ = typIncludedService
 	default:
 		return attErrorResp(attOpReadByGroupReq, start, attEcodeUnsuppGrpType)
@@ -434,7 +632,7 @@ func (c *conn) handleWrite(reqType byte, b []byte) []byte {
 		return attErrorResp(reqType, valuen, attEcodeAuthentication)
 	}
 
-	if h.typ != typDescriptor && !uuidEqual(h.uuid, gattAttrClientCharacteristicConfigUUID) {
+	if h.typ != typDescriptor && !h.uuid.Equal(gattAttrClientCharacteristicConfigUUID) {
 		// Regular write, not CCC
 		result := c.writeChar(h.attr.(*Characteristic), data, noResp)
 		if noResp {
@@ -454,8 +652,9 @@ func (c *conn) handleWrite(reqType byte, b []byte) []byte {
 	ccc := binary.LittleEndian.Uint16(data)
 	char := h.attr.(*Characteristic)
 	h.value = data
+	c.saveSubscription(h.n, ccc)
 
-	if ccc&gattCCCNotifyFlag == 0 {
+	if ccc&(gattCCCNotifyFlag|gattCCCIndicateFlag) == 0 {
 		// TODO: Suppress these calls if the notification state hasn't actually changed
 		c.stopNotify(char)
 		if noResp {
@@ -464,22 +663,96 @@ func (c *conn) handleWrite(reqType byte, b []byte) []byte {
 		return []byte{attOpWriteResp}
 	}
 
-	c.startNotify(char, int(c.mtu-3))
+	started := c.startNotify(char, int(c.mtu-3))
 	if noResp {
 		return nil
 	}
+	if !started {
+		return attErrorResp(reqType, valuen, attEcodeUnlikely)
+	}
 	return []byte{attOpWriteResp}
 }
 
 func (c *conn) sendNotification(char *Characteristic, data []byte) (int, error) {
+	if char.props&(charNotify|charIndicate) == charIndicate {
+		return c.sendIndication(char, data)
+	}
+	if !c.awaitWake() {
+		return 0, errors.New("gatt: connection closed")
+	}
 	w := newL2capWriter(c.mtu)
 	w.WriteByteFit(attOpHandleNotify)
 	w.WriteUint16Fit(char.valuen)
 	w.WriteFit(data)
 	b := w.Bytes()
+	c.touch()
+	c.traceATT(false, b, nil)
 	return c.l2conn.Write(b)
 }
 
+// sendIndication indicates data, and waits for the central to confirm it.
+// It must not be called from the goroutine serving the connection, which
+// delivers the confirmation.
+func (c *conn) sendIndication(char *Characteristic, data []byte) (int, error) {
+	c.indmu.Lock()
+	defer c.indmu.Unlock()
+	if !c.awaitWake() {
+		return 0, errors.New("gatt: connection closed")
+	}
+	select {
+	case <-c.cnfc: // stale
+	default:
+	}
+	w := newL2capWriter(c.mtu)
+	w.WriteByteFit(attOpHandleInd)
+	w.WriteUint16Fit(char.valuen)
+	w.WriteFit(data)
+	c.touch()
+	c.traceATT(false, w.Bytes(), nil)
+	if _, err := c.l2conn.Write(w.Bytes()); err != nil {
+		return 0, err
+	}
+	t := time.NewTimer(attTimeout)
+	defer t.Stop()
+	select {
+	case <-c.cnfc:
+		return len(data), nil
+	case <-t.C:
+		return 0, errors.New("gatt: indication not confirmed")
+	case <-c.done:
+		return 0, errors.New("gatt: connection closed")
+	}
+}
+
+// validReq reports whether the parameters b of a request of type op are
+// of a legal length, for its handler to decode them; those received from
+// the peer are not to be trusted.
+func validReq(op byte, b []byte) bool {
+	switch op {
+	case attOpMtuReq, attOpReadReq:
+		return len(b) == 2
+	case attOpFindInfoReq, attOpReadBlobReq:
+		return len(b) == 4
+	case attOpFindByTypeReq:
+		return len(b) >= 6
+	case attOpReadByTypeReq, attOpReadByGroupReq:
+		return len(b) == 4+2 || len(b) == 4+16
+	case attOpWriteReq, attOpWriteCmd:
+		return len(b) >= 2
+	}
+	return true
+}
+
+// reqHasRange reports whether the requests of type op start with a
+// handle range.
+func reqHasRange(op byte) bool {
+	switch op {
+	case attOpFindInfoReq, attOpFindByTypeReq, attOpReadByTypeReq, attOpReadByGroupReq:
+		return true
+	}
+	return false
+}
+
 func readHandleRange(b []byte) (start, end uint16) {
 	return binary.LittleEndian.Uint16(b), binary.LittleEndian.Uint16(b[2:])
 }
@@ -496,23 +769,34 @@ func (c *conn) request(char *Characteristic) Request {
 func (c *conn) readChar(char *Characteristic, maxlen int, offset int) (data []byte, status byte) {
 	req := &ReadRequest{Request: c.request(char), Cap: maxlen, Offset: offset}
 	resp := newReadResponseWriter(maxlen)
-	char.rhandler.ServeRead(resp, req)
+	if !c.server.call("read "+char.uuid.String(), func() { char.rhandler.ServeRead(resp, req) }) {
+		return nil, StatusUnexpectedError
+	}
 	return resp.bytes(), resp.status
 }
 
 func (c *conn) writeChar(char *Characteristic, data []byte, noResponse bool) (status byte) {
-	return char.whandler.ServeWrite(c.request(char), data)
+	if !c.server.call("write "+char.uuid.String(), func() { status = char.whandler.ServeWrite(c.request(char), data) }) {
+		return StatusUnexpectedError
+	}
+	return status
 }
 
-func (c *conn) startNotify(char *Characteristic, maxlen int) {
+// startNotify starts notifying char, unless it is already, and reports
+// whether its handler returned without panicking.
+func (c *conn) startNotify(char *Characteristic, maxlen int) bool {
 	c.notifiersmu.Lock()
 	defer c.notifiersmu.Unlock()
 	if _, found := c.notifiers[char]; found {
-		return
+		return true
 	}
 	n := newNotifier(c, char, maxlen)
+	if !c.server.call("notify "+char.uuid.String(), func() { char.nhandler.ServeNotify(c.request(char), n) }) {
+		n.stop()
+		return false
+	}
 	c.notifiers[char] = n
-	char.nhandler.ServeNotify(c.request(char), n)
+	return true
 }
 
 func (c *conn) stopNotify(char *Characteristic) {
@@ -0,0 +1,183 @@
+package gatt
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/paypal/gatt/linux"
+)
+
+// paramsConn is the part of an HCI connection its parameters are managed
+// through.
+type paramsConn interface {
+	Params() linux.ConnParams
+	UpdateParams(p linux.ConnParams) error
+	OnParamsRequest(f func(p linux.ConnParams) (linux.ConnParams, bool))
+}
+
+// channelsConn is the part of an HCI connection its channels are read
+// through.
+type channelsConn interface {
+	ChannelSelection() int
+	ChannelMap() (linux.ChannelMap, error)
+}
+
+// channelsOf returns the backend of the Channels method of a connection
+// over the HCI connection l.
+func channelsOf(l channelsConn) func() (ConnChannels, error) {
+	return func() (ConnChannels, error) {
+		m, err := l.ChannelMap()
+		if err != nil {
+			return ConnChannels{}, err
+		}
+		return ConnChannels{Algorithm: l.ChannelSelection(), Map: uint64(m)}, nil
+	}
+}
+
+// rssiOf returns the backend of the UpdateRSSI method of a connection
+// over the HCI connection l.
+func rssiOf(l interface{ ReadRSSI() (int8, error) }) func() (int, error) {
+	return func() (int, error) {
+		rssi, err := l.ReadRSSI()
+		if err != nil {
+			return 0, err
+		}
+		if rssi == linux.RSSIUnavailable {
+			return 0, ErrNoRSSI
+		}
+		return int(rssi), nil
+	}
+}
+
+// pairOf returns the backend of Pair for the HCI connection l, with the
+// peer of address peer, paired by pair.
+func pairOf[C any](pair func(ctx context.Context, l C) (linux.PairingKeys, error), l C, peer Addr) func(ctx context.Context) (Bond, error) {
+	return func(ctx context.Context) (Bond, error) {
+		k, err := pair(ctx, l)
+		if err != nil {
+			return Bond{}, err
+		}
+		b := Bond{Addr: peer, LTK: k.LTK}
+		if k.Identity {
+			b.Addr, b.IRK = addrOf(k.IdentityAddr, k.IdentityAddrType), k.IRK
+		}
+		return b, nil
+	}
+}
+
+// phyConn is the part of an HCI connection its PHYs are managed through.
+type phyConn interface {
+	ReadPHY() (tx, rx uint8, err error)
+	SetPHY(tx, rx uint8, options uint16) error
+	OnPHYUpdate(f func(status, tx, rx uint8))
+}
+
+// managePHY lets the PHYs of the HCI connection l be read, and set, and
+// their updates be reported to the PHYUpdate function of the server.
+func (c *conn) managePHY(l phyConn) {
+	c.phy = func() (PHY, PHY, error) {
+		tx, rx, err := l.ReadPHY()
+		return PHY(tx), PHY(rx), err
+	}
+	c.setPHY = func(tx, rx PHY) error {
+		return l.SetPHY(phyPreference(tx), phyPreference(rx), linux.PHYCodingAny)
+	}
+	l.OnPHYUpdate(func(status, tx, rx uint8) {
+		if status != 0x00 {
+			c.server.report(fmt.Errorf("gatt: %v: PHY update failed: %w", c.remoteAddr, linux.Status(status)))
+			return
+		}
+		if f := c.server.phyUpdate; f != nil {
+			c.server.call("phy update", func() { f(c, PHY(tx), PHY(rx)) })
+		}
+	})
+}
+
+// limitSignaling limits the signaling commands of the HCI connection l to
+// the signaling RateLimit of the server, if any.
+func (c *conn) limitSignaling(l interface{ OnSignal(f func() bool) }) {
+	b := newLimiter(c.server.signalingLimit)
+	if b == nil {
+		return
+	}
+	l.OnSignal(func() bool {
+		if b.allow(time.Now()) {
+			return true
+		}
+		c.exceeded("signaling commands")
+		return false
+	})
+}
+
+// phyPreference returns the bit preferring p, of LE Set PHY.
+func phyPreference(p PHY) uint8 {
+	switch p {
+	case PHY2M:
+		return linux.PreferPHY2M
+	case PHYCoded:
+		return linux.PreferPHYCoded
+	}
+	return linux.PreferPHY1M
+}
+
+// addrOf returns the address b, in the byte order of the controller, of
+// the type t the HCI reports it with.
+func addrOf(b [6]byte, t uint8) Addr {
+	a := BDAddr{net.HardwareAddr(append([]byte(nil), b[:]...))}
+	if t == linux.AddrPublic || t == linux.AddrPublicIdentity {
+		return PublicAddr(a)
+	}
+	return RandomAddr(a)
+}
+
+// hciAddr returns the address a, and its type, as the HCI encodes them.
+func hciAddr(a Addr) ([6]byte, uint8) {
+	var b [6]byte
+	copy(b[:], a.HardwareAddr)
+	if a.Type.Random() {
+		return b, linux.AddrRandom
+	}
+	return b, linux.AddrPublic
+}
+
+// manageParams lets the ConnPolicy of the server, if any, manage the
+// parameters of the HCI connection l, of which c is the central if
+// central is set.
+func (c *conn) manageParams(l paramsConn, central bool) {
+	c.central = central
+	c.params = func() ConnParams { return fromHCIParams(l.Params()) }
+	p := c.server.paramsPolicy()
+	if p == nil {
+		return
+	}
+	c.updateParams = func(p ConnParams) error { return l.UpdateParams(toHCIParams(p)) }
+	l.OnParamsRequest(func(req linux.ConnParams) (linux.ConnParams, bool) {
+		q, ok := c.paramsRequest(p, fromHCIParams(req))
+		return toHCIParams(q), ok
+	})
+}
+
+// fromHCIParams converts the parameters of an HCI connection, in units of
+// 1.25 ms for the interval, and of 10 ms for the timeout.
+func fromHCIParams(p linux.ConnParams) ConnParams {
+	return ConnParams{
+		IntervalMin:        time.Duration(p.IntervalMin) * 1250 * time.Microsecond,
+		IntervalMax:        time.Duration(p.IntervalMax) * 1250 * time.Microsecond,
+		Latency:            int(p.Latency),
+		SupervisionTimeout: time.Duration(p.SupervisionTimeout) * 10 * time.Millisecond,
+	}
+}
+
+// toHCIParams converts parameters to those of an HCI connection, rounding
+// the interval range inwards.
+func toHCIParams(p ConnParams) linux.ConnParams {
+	const unit = 1250 * time.Microsecond
+	return linux.ConnParams{
+		IntervalMin:        uint16((p.IntervalMin + unit - 1) / unit),
+		IntervalMax:        uint16(p.IntervalMax / unit),
+		Latency:            uint16(p.Latency),
+		SupervisionTimeout: uint16(p.SupervisionTimeout / (10 * time.Millisecond)),
+	}
+}
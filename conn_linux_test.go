@@ -0,0 +1,77 @@
+package gatt
+
+import (
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/paypal/gatt/linux"
+)
+
+// rssiReader is an HCI connection whose RSSI reads rssi.
+type rssiReader int8
+
+func (r rssiReader) ReadRSSI() (int8, error) { return int8(r), nil }
+
+func TestUpdateRSSI(t *testing.T) {
+	received := make(chan int, 1)
+	s := NewServer(Name(""), ReceiveRSSI(func(c Conn, rssi int) { received <- rssi }))
+	c := newConn(s, &testHandler{}, Addr{})
+	if rssi := c.RSSI(); rssi != -1 {
+		t.Errorf("RSSI before any read = %d, want -1", rssi)
+	}
+	if _, err := c.UpdateRSSI(); err == nil {
+		t.Error("UpdateRSSI without a backend succeeded")
+	}
+	c.readRSSI = rssiOf(rssiReader(linux.RSSIUnavailable))
+	if _, err := c.UpdateRSSI(); !errors.Is(err, ErrNoRSSI) {
+		t.Errorf("UpdateRSSI before any measurement = %v, want ErrNoRSSI", err)
+	}
+	c.readRSSI = rssiOf(rssiReader(-58))
+	if rssi, err := c.UpdateRSSI(); err != nil || rssi != -58 {
+		t.Fatalf("UpdateRSSI = %d, %v; want -58", rssi, err)
+	}
+	if rssi := c.RSSI(); rssi != -58 {
+		t.Errorf("RSSI = %d, want -58", rssi)
+	}
+	if rssi := <-received; rssi != -58 {
+		t.Errorf("ReceiveRSSI got %d, want -58", rssi)
+	}
+}
+
+// pairer is an HCI connection pairing with keys.
+type pairer linux.PairingKeys
+
+func pairWith(ctx context.Context, p pairer) (linux.PairingKeys, error) {
+	return linux.PairingKeys(p), nil
+}
+
+func TestPair(t *testing.T) {
+	ks := NewFileKeyStore(filepath.Join(t.TempDir(), "bonds.json"), nil)
+	s := NewServer(Name(""), Bonds(ks))
+	peer := RandomAddr(BDAddr{net.HardwareAddr{0x11, 0x22, 0x33, 0x44, 0x55, 0x66}}) // resolvable private
+	c := newConn(s, &testHandler{}, peer)
+	if _, err := Pair(context.Background(), c); err == nil {
+		t.Error("Pair without a backend succeeded")
+	}
+	events := make(chan PairingEvent, 1)
+	s.SubscribePairings(events, DropNewest)
+	keys := pairer{LTK: [16]byte{1}, Identity: true, IRK: [16]byte{2}, IdentityAddr: [6]byte{0xA1, 0xA2, 0xA3, 0xA4, 0xA5, 0xC6}, IdentityAddrType: linux.AddrRandom}
+	c.pair = pairOf(pairWith, keys, peer)
+	b, err := Pair(context.Background(), c)
+	if err != nil {
+		t.Fatalf("Pair = %v", err)
+	}
+	id := RandomAddr(BDAddr{net.HardwareAddr{0xA1, 0xA2, 0xA3, 0xA4, 0xA5, 0xC6}})
+	if !b.Addr.same(id) || b.LTK != keys.LTK || b.IRK != keys.IRK {
+		t.Errorf("Pair = %+v, want the keys of the identity %s", b, id)
+	}
+	if kept, err := ks.Get(id); err != nil || kept.LTK != keys.LTK {
+		t.Errorf("bond kept = %+v, %v", kept, err)
+	}
+	if e := <-events; e.Conn != Conn(c) || e.Err != nil || e.Bond.LTK != keys.LTK {
+		t.Errorf("PairingEvent = %+v, want the bond", e)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -75,7 +76,7 @@ func TestServing(t *testing.T) {
 		})
 
 	srv.setServices()
-	go newConn(srv, h, BDAddr{}).loop()
+	go newConn(srv, h, Addr{}).loop()
 
 	// Generated handles:
 	//   {1 1 0 5 service [24 0] <ptr> 0 0 []}
@@ -83,15 +84,18 @@ func TestServing(t *testing.T) {
 	//   {3 0 0 0 characteristicValue [42 0] <nil> 0 0 []}
 	//   {4 4 5 0 characteristic [42 1] <ptr> 2 2 []}
 	//   {5 0 0 0 characteristicValue [42 1] <nil> 0 0 [0 128]}
-	//   {6 6 0 6 service [24 1] <ptr> 0 0 []}
-	//   {7 7 0 65535 service [9 252 149 192 193 17 17 227 153 4 0 2 165 213 197 27] <ptr> 0 0 []}
-	//   {8 8 9 0 characteristic [17 250 201 224 193 17 17 227 146 70 0 2 165 213 197 27] <ptr> 2 2 []}
-	//   {9 0 0 0 characteristicValue [17 250 201 224 193 17 17 227 146 70 0 2 165 213 197 27] <nil> 0 0 []}
-	//   {10 10 11 0 characteristic [22 254 13 128 193 17 17 227 184 200 0 2 165 213 197 27] <ptr> 12 12 []}
-	//   {11 0 0 0 characteristicValue [22 254 13 128 193 17 17 227 184 200 0 2 165 213 197 27] <nil> 0 0 []}
-	//   {12 12 13 0 characteristic [28 146 123 80 193 22 17 227 138 51 8 0 32 12 154 102] <ptr> 16 16 []}
-	//   {13 0 0 0 characteristicValue [28 146 123 80 193 22 17 227 138 51 8 0 32 12 154 102] <nil> 0 0 []}
-	//   {14 0 0 0 descriptor [41 2] <ptr> 10 10 [0 0]}] 1}
+	//   {6 6 0 9 service [24 1] <ptr> 0 0 []}
+	//   {7 7 8 0 characteristic [42 5] <ptr> 32 32 []}
+	//   {8 0 0 0 characteristicValue [42 5] <nil> 0 0 []}
+	//   {9 0 0 0 descriptor [41 2] <ptr> 10 10 [0 0]}
+	//   {10 10 0 65535 service [9 252 149 192 193 17 17 227 153 4 0 2 165 213 197 27] <ptr> 0 0 []}
+	//   {11 11 12 0 characteristic [17 250 201 224 193 17 17 227 146 70 0 2 165 213 197 27] <ptr> 2 2 []}
+	//   {12 0 0 0 characteristicValue [17 250 201 224 193 17 17 227 146 70 0 2 165 213 197 27] <nil> 0 0 []}
+	//   {13 13 14 0 characteristic [22 254 13 128 193 17 17 227 184 200 0 2 165 213 197 27] <ptr> 12 12 []}
+	//   {14 0 0 0 characteristicValue [22 254 13 128 193 17 17 227 184 200 0 2 165 213 197 27] <nil> 0 0 []}
+	//   {15 15 16 0 characteristic [28 146 123 80 193 22 17 227 138 51 8 0 32 12 154 102] <ptr> 16 16 []}
+	//   {16 0 0 0 characteristicValue [28 146 123 80 193 22 17 227 138 51 8 0 32 12 154 102] <nil> 0 0 []}
+	//   {17 0 0 0 descriptor [41 2] <ptr> 10 10 [0 0]}] 1}
 
 	rxtx := []struct {
 		name  string
@@ -125,9 +129,9 @@ func TestServing(t *testing.T) {
 			want: "05010100002802000328",
 		},
 		{
-			name: "find by type [1,11] svc uuid -- handle range [7,14]",
+			name: "find by type [1,11] svc uuid -- handle range [10,17]",
 			send: "0601000B0000281bc5d5a502000499e31111c1c095fc09",
-			want: "070700ffff",
+			want: "070a00ffff",
 		},
 		{
 			name: "read by group [1,3] svc uuid -- unsupported group type at handle 1",
@@ -140,9 +144,9 @@ func TestServing(t *testing.T) {
 			want: "1106010005000018",
 		},
 		{
-			name: "read by group [1,14] 0x2800 -- group at [1,5]: 0x1800, [6,6]: 0x1801",
+			name: "read by group [1,14] 0x2800 -- group at [1,5]: 0x1800, [6,9]: 0x1801",
 			send: "1001000E000028",
-			want: "1106010005000018060006000118",
+			want: "1106010005000018060009000118",
 		},
 		{
 			name: "read by type [1,5] 0x2a00 (device name) -- found 2, 3",
@@ -161,12 +165,12 @@ func TestServing(t *testing.T) {
 		},
 		{
 			name: "read char -- 'count: 1'",
-			send: "0a0900",
+			send: "0a0c00",
 			want: "0b636f756e743a2031",
 		},
 		{
 			name: "write char 'abcdef' -- ok",
-			send: "120b00616263646566",
+			send: "120e00616263646566",
 			want: "13",
 			after: func() {
 				if string(wrote) != "abcdef" {
@@ -176,28 +180,28 @@ func TestServing(t *testing.T) {
 		},
 		{
 			name: "start notify -- ok",
-			send: "120e000100",
+			send: "1211000100",
 			want: "13",
 		},
 		{
 			name: "-- notified 'Count: 0'",
-			want: "1b0d00436f756e743a2030",
+			want: "1b1000436f756e743a2030",
 		},
 		{
 			name: "-- notified 'Count: 1'",
-			want: "1b0d00436f756e743a2031",
+			want: "1b1000436f756e743a2031",
 		},
 		{
 			name: "-- notified 'Count: 2'",
-			want: "1b0d00436f756e743a2032",
+			want: "1b1000436f756e743a2032",
 		},
 		{
 			name: "-- notified 'Count: 3'",
-			want: "1b0d00436f756e743a2033",
+			want: "1b1000436f756e743a2033",
 		},
 		{
 			name: "stop notify -- ok",
-			send: "120e000000",
+			send: "1211000000",
 			want: "13",
 		},
 	}
@@ -217,3 +221,76 @@ func TestServing(t *testing.T) {
 		}
 	}
 }
+
+func TestDefaultServices(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "layout.json")
+	serve := func() (*testHandler, func()) {
+		h := &testHandler{readc: make(chan []byte), writec: make(chan []byte)}
+		srv := NewServer(
+			Name("gopher"),
+			Appearance(AppearanceGenericTag),
+			PreferredConnParams(ConnParams{IntervalMin: 15 * time.Millisecond, IntervalMax: 30 * time.Millisecond, SupervisionTimeout: 4 * time.Second}),
+			HandleLayout(path),
+		)
+		if err := srv.setServices(); err != nil {
+			t.Fatal(err)
+		}
+		c := newConn(srv, h, Addr{})
+		go c.loop()
+		return h, func() { c.close() }
+	}
+	rxtx := func(h *testHandler, send string) string {
+		b, _ := hex.DecodeString(send)
+		h.readc <- b
+		select {
+		case b := <-h.writec:
+			return hex.EncodeToString(b)
+		case <-time.After(time.Second):
+			return ""
+		}
+	}
+
+	// Generated handles: 1-7 Generic Access, with the device name at 3,
+	// the appearance at 5, and the preferred parameters at 7; 8-11
+	// Generic Attribute, with Service Changed at 10, and its cccd at 11.
+	h, stop := serve()
+	for _, tt := range []struct{ name, send, want string }{
+		{"read appearance", "0a0500", "0b0002"},
+		{"read preferred connection parameters", "0a0700", "0b0c00180000009001"},
+		{"read by group [1,ffff] 0x2800", "100100ffff0028", "110601000700001808000b000118"},
+	} {
+		if got := rxtx(h, tt.send); got != tt.want {
+			t.Errorf("%s: sent %s got %s want %s", tt.name, tt.send, got, tt.want)
+		}
+	}
+
+	// The database is new: the subscribers to Service Changed are told
+	// it has changed, in whole.
+	b, _ := hex.DecodeString("120b000200")
+	h.readc <- b
+	got := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		select {
+		case b := <-h.writec:
+			got[hex.EncodeToString(b)] = true
+		case <-time.After(time.Second):
+		}
+	}
+	if !got["13"] || !got["1d0a000100ffff"] {
+		t.Errorf("subscribe to service changed: got %v, want a write response, and an indication", got)
+	}
+	h.readc <- []byte{attOpHandleCnf}
+	stop()
+
+	// Restarted unchanged: they are not.
+	h, stop = serve()
+	defer stop()
+	if got := rxtx(h, "120b000200"); got != "13" {
+		t.Errorf("subscribe to service changed: got %s, want a write response", got)
+	}
+	select {
+	case b := <-h.writec:
+		t.Errorf("indicated %x, once the database is unchanged", b)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,373 @@
+package gatt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// ConnParams are the parameters of a connection.
+type ConnParams struct {
+	// IntervalMin and IntervalMax bound the connection interval, from
+	// 7.5 ms to 4 s, in steps of 1.25 ms. The current parameters of a
+	// connection report its interval as both.
+	IntervalMin, IntervalMax time.Duration
+
+	// Latency is the number of connection events the peripheral may
+	// skip, up to 499.
+	Latency int
+
+	// SupervisionTimeout is how long the link may go silent before it
+	// is considered lost, from 100 ms to 32 s, in steps of 10 ms. It
+	// must exceed twice the IntervalMax, times the Latency plus one.
+	SupervisionTimeout time.Duration
+}
+
+// check checks the ranges of the parameters, named after param.
+func (p ConnParams) check(param string) error {
+	if err := checkDuration(param+".IntervalMin", p.IntervalMin, 7500*time.Microsecond, 4*time.Second); err != nil {
+		return err
+	}
+	if err := checkDuration(param+".IntervalMax", p.IntervalMax, p.IntervalMin, 4*time.Second); err != nil {
+		return err
+	}
+	if err := checkRange(param+".Latency", p.Latency, 0, 499); err != nil {
+		return err
+	}
+	min := 2*time.Duration(1+p.Latency)*p.IntervalMax + 10*time.Millisecond
+	if min < 100*time.Millisecond {
+		min = 100 * time.Millisecond
+	}
+	return checkDuration(param+".SupervisionTimeout", p.SupervisionTimeout, min, 32*time.Second)
+}
+
+// satisfiedBy reports whether the current parameters of a connection,
+// cur, are those wanted, p.
+func (p ConnParams) satisfiedBy(cur ConnParams) bool {
+	return cur.IntervalMin >= p.IntervalMin && cur.IntervalMax <= p.IntervalMax &&
+		cur.Latency == p.Latency && cur.SupervisionTimeout == p.SupervisionTimeout
+}
+
+// A ConnPolicy declares the parameters wanted for the connections, per
+// class of peer, or of use: e.g. a "fast" class for a firmware update,
+// and an "idle" one the rest of the time. The parameters of the class of
+// each connection are negotiated from whichever role the device holds:
+// as the central, it updates the connection; as the peripheral, it
+// requests the central to, which may reject the request.
+//
+// The negotiation follows the timing rules of the GAP: it starts 1 s
+// after the connection is established as the central, and 5 s after as
+// the peripheral; the central is waited for up to 30 s, and a request
+// that fails is retried 30 s later, up to 3 times. Failures are reported
+// to the HandlerErrors function.
+//
+// As the central, the requests of the peripheral are accepted if their
+// interval range meets that of the class of the connection, if any, and
+// the connection is then updated to an interval within both.
+//
+// With IdleAfter set, the connections left without ATT traffic are
+// switched to parameters saving the battery, of both devices, and back
+// to those of their class, or to those they were established with, as
+// the traffic resumes, or as Conn.Wake is called ahead of a burst.
+type ConnPolicy struct {
+	// Classes maps the name of each class to its parameters.
+	Classes map[string]ConnParams
+
+	// Classify, if set, returns the class of a connection as it is
+	// established. An empty class, or a nil Classify, leaves the
+	// parameters of the connection as they are, until Conn.SetClass
+	// is called.
+	Classify func(c Conn) string
+
+	// IdleAfter, if set, is how long a connection is left without ATT
+	// traffic, either way, before it is switched to the Idle
+	// parameters, from 1 s to 1 h.
+	IdleAfter time.Duration
+
+	// Idle are the parameters of the idle connections. A zero value
+	// selects IdleParams.
+	Idle ConnParams
+}
+
+// IdleParams are the default parameters of the idle connections: the
+// longest interval and latency that the common centrals, such as
+// phones, accept.
+var IdleParams = ConnParams{
+	IntervalMin:        400 * time.Millisecond,
+	IntervalMax:        500 * time.Millisecond,
+	Latency:            2,
+	SupervisionTimeout: 6 * time.Second,
+}
+
+func (p *ConnPolicy) check() error {
+	for name, c := range p.Classes {
+		if err := c.check(fmt.Sprintf("ConnPolicy.Classes[%q]", name)); err != nil {
+			return err
+		}
+	}
+	if p.IdleAfter == 0 {
+		return nil
+	}
+	if err := checkDuration("ConnPolicy.IdleAfter", p.IdleAfter, time.Second, time.Hour); err != nil {
+		return err
+	}
+	return p.idle().check("ConnPolicy.Idle")
+}
+
+// idle returns the parameters of the idle connections.
+func (p *ConnPolicy) idle() ConnParams {
+	if p.Idle == (ConnParams{}) {
+		return IdleParams
+	}
+	return p.Idle
+}
+
+// ConnParamsPolicy sets the policy the parameters of the connections
+// are negotiated with. If nil, the default, a connection accepted with a
+// latency, or an interval above 30 ms, is requested to be updated to an
+// interval of 10 to 30 ms, and is left alone otherwise, unless the server
+// has PreferredConnParams, which are requested instead.
+// See also Server.NewServer.
+// ConnParamsPolicy cannot be used with Server.Option.
+func ConnParamsPolicy(p *ConnPolicy) option {
+	return func(s *Server) option {
+		prev := s.connPolicy
+		s.connPolicy = p
+		return ConnParamsPolicy(prev)
+	}
+}
+
+// paramsPolicy returns the policy the parameters of the connections are
+// negotiated with: the ConnPolicy, if any, or else an empty one, if the
+// server has PreferredConnParams to request, or nil.
+func (s *Server) paramsPolicy() *ConnPolicy {
+	if s.connPolicy == nil && s.preferredParams != (ConnParams{}) {
+		return &ConnPolicy{}
+	}
+	return s.connPolicy
+}
+
+// Timing of the connection parameter update procedures, from the GAP.
+var (
+	connPauseCentral    = 1 * time.Second  // TGAP(conn_pause_central)
+	connPausePeripheral = 5 * time.Second  // TGAP(conn_pause_peripheral)
+	connParamTimeout    = 30 * time.Second // TGAP(conn_param_timeout)
+)
+
+// maxParamsAttempts is the number of times the parameters of a class
+// are negotiated, before giving up until the class changes.
+const maxParamsAttempts = 3
+
+func (c *conn) Params() ConnParams {
+	if c.params == nil {
+		return ConnParams{}
+	}
+	return c.params()
+}
+
+// activity tracks the ATT traffic of a connection, for its policy to
+// tell when it is idle.
+type activity struct {
+	last int64 // time of the latest PDU, in Unix nanoseconds
+	rx   int64 // time of the latest data received, in Unix nanoseconds
+	idle int32 // set while the connection is idle
+}
+
+// touch records ATT traffic on the connection, and wakes it up, if it is
+// idle.
+func (c *conn) touch() {
+	atomic.StoreInt64(&c.activity.last, time.Now().UnixNano())
+	if atomic.LoadInt32(&c.activity.idle) != 0 {
+		select {
+		case c.wakec <- nil:
+		default:
+		}
+	}
+}
+
+// idleFor returns how long the connection has been without ATT traffic.
+func (c *conn) idleFor() time.Duration {
+	return time.Since(time.Unix(0, atomic.LoadInt64(&c.activity.last)))
+}
+
+func (c *conn) Wake(ctx context.Context) error {
+	if c.server.connPolicy == nil || c.updateParams == nil {
+		return errors.New("gatt: no ConnPolicy")
+	}
+	w := make(chan error, 1)
+	select {
+	case c.wakec <- w:
+	case <-c.done:
+		return errors.New("gatt: connection closed")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-w:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *conn) SetClass(class string) error {
+	p := c.server.connPolicy
+	if p == nil || c.updateParams == nil {
+		return errors.New("gatt: no ConnPolicy")
+	}
+	if _, ok := p.Classes[class]; !ok {
+		return fmt.Errorf("gatt: unknown connection class %q", class)
+	}
+	for {
+		select {
+		case <-c.done:
+			return errors.New("gatt: connection closed")
+		case c.classc <- class:
+			return nil
+		default:
+			select {
+			case <-c.classc: // superseded
+			default:
+			}
+		}
+	}
+}
+
+// negotiateParams negotiates the parameters of the class of the
+// connection, as classified by p, and then set by SetClass, or those of
+// idle connections, until the connection is closed. Connections of no
+// class, accepted as the peripheral, get the PreferredConnParams of the
+// server, if any, once the central has not applied them by itself.
+func (c *conn) negotiateParams(p *ConnPolicy) {
+	class := ""
+	if p.Classify != nil {
+		c.server.call("classify", func() { class = p.Classify(c) })
+	}
+	pause := connPausePeripheral
+	if c.central {
+		pause = connPauseCentral
+	}
+	c.setClass(class)
+	initial := c.Params()
+	t := time.NewTimer(pause)
+	defer t.Stop()
+	var it *time.Timer
+	var idlec <-chan time.Time
+	if p.IdleAfter != 0 {
+		it = time.NewTimer(p.IdleAfter)
+		defer it.Stop()
+		idlec = it.C
+	}
+	var waiters []chan error // of Wake
+	wake := func(err error) {
+		for _, w := range waiters {
+			w <- err
+		}
+		waiters = nil
+	}
+	idle, due, attempts := false, false, 0
+	var lastErr error
+	for {
+		select {
+		case class = <-c.classc:
+			c.setClass(class)
+			attempts = 0
+		case <-t.C:
+			due = true
+		case w := <-c.wakec:
+			if w != nil {
+				waiters = append(waiters, w)
+			}
+			if idle {
+				idle, attempts = false, 0
+				atomic.StoreInt32(&c.activity.idle, 0)
+			}
+			if it != nil {
+				it.Reset(p.IdleAfter)
+			}
+		case <-idlec:
+			if d := c.idleFor(); d < p.IdleAfter {
+				it.Reset(p.IdleAfter - d)
+				continue
+			}
+			idle, attempts = true, 0
+			atomic.StoreInt32(&c.activity.idle, 1)
+		case <-c.done:
+			wake(errors.New("gatt: connection closed"))
+			return
+		}
+		want, ok := p.Classes[class]
+		switch {
+		case idle:
+			want, ok = p.idle(), true
+		case !ok && !c.central && c.server.preferredParams != (ConnParams{}):
+			want, ok = c.server.preferredParams, true
+		case !ok:
+			want, ok = initial, initial != (ConnParams{})
+		}
+		if !ok || want.satisfiedBy(c.Params()) {
+			if !idle {
+				wake(nil)
+			}
+			continue
+		}
+		if attempts == maxParamsAttempts {
+			wake(lastErr)
+			continue
+		}
+		if !due {
+			continue
+		}
+		err := c.updateParams(want)
+		if err == nil && !want.satisfiedBy(c.Params()) {
+			err = fmt.Errorf("updated to %+v instead", c.Params())
+		}
+		if err == nil {
+			if !idle {
+				wake(nil)
+			}
+			continue
+		}
+		select {
+		case <-c.done:
+			return
+		default:
+		}
+		attempts++
+		name := class
+		if idle {
+			name = "idle"
+		}
+		lastErr = fmt.Errorf("gatt: negotiating the %q parameters of %s, attempt %d: %w", name, c.remoteAddr, attempts, err)
+		c.server.report(lastErr)
+		wake(lastErr)
+		due = false
+		t.Reset(connParamTimeout)
+	}
+}
+
+func (c *conn) setClass(class string) {
+	c.classmu.Lock()
+	defer c.classmu.Unlock()
+	c.class = class
+}
+
+// paramsRequest answers the request of the peripheral for the
+// parameters req, as the central, as per the class of the connection.
+func (c *conn) paramsRequest(p *ConnPolicy, req ConnParams) (ConnParams, bool) {
+	c.classmu.Lock()
+	want, ok := p.Classes[c.class]
+	c.classmu.Unlock()
+	if !ok {
+		return req, true
+	}
+	if req.IntervalMin < want.IntervalMin {
+		req.IntervalMin = want.IntervalMin
+	}
+	if req.IntervalMax > want.IntervalMax {
+		req.IntervalMax = want.IntervalMax
+	}
+	return req, req.IntervalMin <= req.IntervalMax
+}
@@ -0,0 +1,216 @@
+package gatt
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConnPolicy(t *testing.T) {
+	defer func(c, p, r time.Duration) {
+		connPauseCentral, connPausePeripheral, connParamTimeout = c, p, r
+	}(connPauseCentral, connPausePeripheral, connParamTimeout)
+	connPauseCentral, connPausePeripheral, connParamTimeout = time.Millisecond, time.Millisecond, time.Millisecond
+
+	fast := ConnParams{IntervalMin: 7500 * time.Microsecond, IntervalMax: 15 * time.Millisecond, SupervisionTimeout: time.Second}
+	idle := ConnParams{IntervalMin: 500 * time.Millisecond, IntervalMax: time.Second, Latency: 4, SupervisionTimeout: 12 * time.Second}
+	policy := &ConnPolicy{
+		Classes:  map[string]ConnParams{"fast": fast, "idle": idle},
+		Classify: func(c Conn) string { return "idle" },
+	}
+	if err := policy.check(); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	bad := idle
+	bad.SupervisionTimeout = 5 * time.Second // below 2 * 5 * 1 s
+	var e ErrInvalidParameter
+	if err := (&ConnPolicy{Classes: map[string]ConnParams{"bad": bad}}).check(); !errors.As(err, &e) || e.Param != `ConnPolicy.Classes["bad"].SupervisionTimeout` {
+		t.Errorf("check: got %v, want an ErrInvalidParameter of the SupervisionTimeout", err)
+	}
+
+	errc := make(chan error, 10)
+	srv := NewServer(Name(""), ConnParamsPolicy(policy), HandlerErrors(func(err error) { errc <- err }))
+	c := newConn(srv, &testHandler{}, Addr{})
+
+	var mu sync.Mutex
+	cur := ConnParams{IntervalMin: 30 * time.Millisecond, IntervalMax: 30 * time.Millisecond, SupervisionTimeout: 5 * time.Second}
+	rejects := 2
+	updated := make(chan ConnParams, 10)
+	c.params = func() ConnParams {
+		mu.Lock()
+		defer mu.Unlock()
+		return cur
+	}
+	c.updateParams = func(p ConnParams) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if rejects > 0 {
+			rejects--
+			return errors.New("rejected")
+		}
+		cur = ConnParams{IntervalMin: p.IntervalMax, IntervalMax: p.IntervalMax, Latency: p.Latency, SupervisionTimeout: p.SupervisionTimeout}
+		updated <- cur
+		return nil
+	}
+	done := make(chan struct{})
+	go func() {
+		c.negotiateParams(policy)
+		close(done)
+	}()
+
+	// Rejected twice, and then updated.
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-errc:
+			t.Logf("attempt %d: %v", i+1, err)
+		case <-time.After(time.Second):
+			t.Fatalf("attempt %d not reported", i+1)
+		}
+	}
+	if p := <-updated; !idle.satisfiedBy(p) {
+		t.Errorf("updated to %+v, want %+v", p, idle)
+	}
+
+	if err := c.SetClass("unknown"); err == nil {
+		t.Error("SetClass of an unknown class: got no error")
+	}
+	if err := c.SetClass("fast"); err != nil {
+		t.Fatalf("SetClass: %v", err)
+	}
+	if p := <-updated; !fast.satisfiedBy(p) {
+		t.Errorf("updated to %+v, want %+v", p, fast)
+	}
+
+	// As the central, the requests of the peripheral are narrowed to the
+	// class of the connection.
+	req := ConnParams{IntervalMin: 10 * time.Millisecond, IntervalMax: 50 * time.Millisecond, SupervisionTimeout: 2 * time.Second}
+	if p, ok := c.paramsRequest(policy, req); !ok || p.IntervalMin != 10*time.Millisecond || p.IntervalMax != 15*time.Millisecond {
+		t.Errorf("paramsRequest(%+v): got %+v, %v", req, p, ok)
+	}
+	req.IntervalMin = 20 * time.Millisecond
+	if _, ok := c.paramsRequest(policy, req); ok {
+		t.Errorf("paramsRequest(%+v): accepted", req)
+	}
+
+	c.close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("negotiateParams did not return once closed")
+	}
+	select {
+	case err := <-errc:
+		t.Errorf("unexpected error: %v", err)
+	default:
+	}
+}
+
+func TestConnIdle(t *testing.T) {
+	defer func(c, p time.Duration) {
+		connPauseCentral, connPausePeripheral = c, p
+	}(connPauseCentral, connPausePeripheral)
+	connPauseCentral, connPausePeripheral = time.Millisecond, time.Millisecond
+
+	fast := ConnParams{IntervalMin: 7500 * time.Microsecond, IntervalMax: 15 * time.Millisecond, SupervisionTimeout: time.Second}
+	policy := &ConnPolicy{
+		Classes:   map[string]ConnParams{"fast": fast},
+		Classify:  func(c Conn) string { return "fast" },
+		IdleAfter: 20 * time.Millisecond, // below the legal range, for the test
+	}
+	srv := NewServer(Name(""), ConnParamsPolicy(policy))
+	c := newConn(srv, &testHandler{}, Addr{})
+	var mu sync.Mutex
+	var cur ConnParams
+	updated := make(chan ConnParams, 10)
+	c.params = func() ConnParams {
+		mu.Lock()
+		defer mu.Unlock()
+		return cur
+	}
+	c.updateParams = func(p ConnParams) error {
+		mu.Lock()
+		defer mu.Unlock()
+		cur = ConnParams{IntervalMin: p.IntervalMax, IntervalMax: p.IntervalMax, Latency: p.Latency, SupervisionTimeout: p.SupervisionTimeout}
+		updated <- cur
+		return nil
+	}
+	go c.negotiateParams(policy)
+	defer c.close()
+
+	next := func(want ConnParams, what string) {
+		t.Helper()
+		select {
+		case p := <-updated:
+			if !want.satisfiedBy(p) {
+				t.Fatalf("%s: updated to %+v, want %+v", what, p, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s: not updated", what)
+		}
+	}
+	next(fast, "connected")
+	next(IdleParams, "idle")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := c.Wake(ctx); err != nil {
+		t.Fatalf("Wake: %v", err)
+	}
+	next(fast, "woken up")
+	next(IdleParams, "idle again")
+	c.touch()
+	next(fast, "traffic resumed")
+}
+
+func TestPreferredConnParams(t *testing.T) {
+	defer func(p time.Duration) { connPausePeripheral = p }(connPausePeripheral)
+	connPausePeripheral = time.Millisecond
+
+	preferred := ConnParams{IntervalMin: 15 * time.Millisecond, IntervalMax: 30 * time.Millisecond, SupervisionTimeout: 4 * time.Second}
+	srv := NewServer(Name(""), PreferredConnParams(preferred))
+	if srv.paramsPolicy() == nil {
+		t.Fatal("no policy for the preferred parameters")
+	}
+	for _, tt := range []struct {
+		name    string
+		central bool
+		cur     ConnParams
+		want    bool // an update
+	}{
+		{"peripheral, not applied", false, ConnParams{IntervalMin: 50 * time.Millisecond, IntervalMax: 50 * time.Millisecond, SupervisionTimeout: 5 * time.Second}, true},
+		{"peripheral, applied", false, ConnParams{IntervalMin: 20 * time.Millisecond, IntervalMax: 20 * time.Millisecond, SupervisionTimeout: 4 * time.Second}, false},
+		{"central", true, ConnParams{IntervalMin: 50 * time.Millisecond, IntervalMax: 50 * time.Millisecond, SupervisionTimeout: 5 * time.Second}, false},
+	} {
+		c := newConn(srv, &testHandler{}, Addr{})
+		c.central = tt.central
+		cur := tt.cur
+		updated := make(chan ConnParams, 1)
+		c.params = func() ConnParams { return cur }
+		c.updateParams = func(p ConnParams) error {
+			updated <- p
+			cur = p
+			return nil
+		}
+		done := make(chan struct{})
+		go func() {
+			c.negotiateParams(srv.paramsPolicy())
+			close(done)
+		}()
+		select {
+		case p := <-updated:
+			if !tt.want {
+				t.Errorf("%s: updated to %+v", tt.name, p)
+			} else if p != preferred {
+				t.Errorf("%s: updated to %+v, want %+v", tt.name, p, preferred)
+			}
+		case <-time.After(50 * time.Millisecond):
+			if tt.want {
+				t.Errorf("%s: not updated", tt.name)
+			}
+		}
+		c.close()
+		<-done
+	}
+}
@@ -14,11 +14,13 @@ var (
 	gattAttrClientCharacteristicConfigUUID = UUID16(0x2902)
 	gattAttrServerCharacteristicConfigUUID = UUID16(0x2903)
 
-	gattAttrDeviceNameUUID = UUID16(0x2A00)
-	gattAttrAppearanceUUID = UUID16(0x2A01)
+	gattAttrDeviceNameUUID                    = UUID16(0x2A00)
+	gattAttrAppearanceUUID                    = UUID16(0x2A01)
+	gattAttrPeripheralPreferredConnParamsUUID = UUID16(0x2A04)
+	gattAttrServiceChangedUUID                = UUID16(0x2A05)
 )
 
-// https://developer.bluetooth.org/gatt/characteristics/Pages/CharacteristicViewer.aspx?u=org.bluetooth.characteristic.gap.appearance.xml
-var gapCharAppearanceGenericComputer = []byte{0x00, 0x80}
-
-const gattCCCNotifyFlag = 1
+const (
+	gattCCCNotifyFlag   = 1
+	gattCCCIndicateFlag = 2
+)
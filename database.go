@@ -0,0 +1,279 @@
+package gatt
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// The JSON of a GATT database, as written by ExportJSON.
+type (
+	dbJSON struct {
+		Services []serviceJSON `json:"services"`
+	}
+	serviceJSON struct {
+		UUID            string     `json:"uuid"`
+		Characteristics []charJSON `json:"characteristics,omitempty"`
+	}
+	charJSON struct {
+		UUID         string     `json:"uuid"`
+		Properties   []string   `json:"properties"`
+		Secure       []string   `json:"secure"` // the Properties if left out
+		NotifyPolicy string     `json:"notifyPolicy,omitempty"`
+		Descriptors  []descJSON `json:"descriptors,omitempty"`
+	}
+	descJSON struct {
+		UUID  string `json:"uuid"`
+		Value string `json:"value"` // in hex
+	}
+)
+
+// charPropNames are the names of the properties of the characteristics,
+// in the JSON of a database.
+var charPropNames = []struct {
+	prop uint
+	name string
+}{
+	{charRead, "read"},
+	{charWriteNR, "writeWithoutResponse"},
+	{charWrite, "write"},
+	{charNotify, "notify"},
+	{charIndicate, "indicate"},
+}
+
+// ExportJSON writes the GATT database of the services svcs, such as those
+// added to a Device, in JSON, for it to be reviewed, diffed, and imported
+// back with ImportJSON: the UUIDs of the services, of their
+// characteristics and descriptors, the properties of the characteristics,
+// those requiring security, and the values of the descriptors, e.g., with
+// the arrays folded,
+//
+//	{
+//	  "services": [
+//	    {
+//	      "uuid": "09fc95c0-c111-11e3-9904-0002a5d5c51b",
+//	      "characteristics": [
+//	        {
+//	          "uuid": "11fac9e0-c111-11e3-9246-0002a5d5c51b",
+//	          "properties": ["read", "notify"],
+//	          "secure": ["read", "notify"],
+//	          "descriptors": [{"uuid": "2901", "value": "636f756e74"}]
+//	        }
+//	      ]
+//	    }
+//	  ]
+//	}
+//
+// The handlers, being code, are not.
+func ExportJSON(w io.Writer, svcs ...*Service) error {
+	db := dbJSON{Services: []serviceJSON{}}
+	for _, svc := range svcs {
+		sj := serviceJSON{UUID: svc.uuid.String()}
+		for _, c := range svc.chars {
+			cj := charJSON{
+				UUID:       c.uuid.String(),
+				Properties: propNames(c.props),
+				Secure:     propNames(c.secure),
+			}
+			switch c.npolicy {
+			case NotifyLatest:
+				cj.NotifyPolicy = "latest"
+			case NotifyQueue:
+				cj.NotifyPolicy = "queue"
+			}
+			for _, d := range c.descs {
+				cj.Descriptors = append(cj.Descriptors, descJSON{UUID: d.uuid.String(), Value: hex.EncodeToString(d.value)})
+			}
+			sj.Characteristics = append(sj.Characteristics, cj)
+		}
+		db.Services = append(db.Services, sj)
+	}
+	b, err := json.MarshalIndent(db, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// ExportJSON writes the GATT database of the services added to s.
+// See ExportJSON.
+func (s *Server) ExportJSON(w io.Writer) error {
+	return ExportJSON(w, s.services...)
+}
+
+// propNames returns the names of the properties props.
+func propNames(props uint) []string {
+	names := []string{}
+	for _, p := range charPropNames {
+		if props&p.prop != 0 {
+			names = append(names, p.name)
+		}
+	}
+	return names
+}
+
+// CharHandlers are the handlers of a characteristic of a database
+// imported with ImportJSON. Each property declared requires its handler:
+// read the Read handler, write and writeWithoutResponse the Write one,
+// and notify and indicate the Notify one.
+type CharHandlers struct {
+	Read   ReadHandler
+	Write  WriteHandler
+	Notify NotifyHandler
+}
+
+// ImportJSON reads a GATT database, in the JSON written by ExportJSON, and
+// returns its services, to be added to a Device. The handlers of each
+// characteristic are those bind returns for it, given the UUIDs of its
+// service and its own; the properties of the characteristic are those
+// declared, rather than those the handlers imply, and those requiring
+// security, if left out, are all of them.
+//
+// A database with mistakes, such as a property with no handler, or a
+// handler of no property, is reported with an error, as by
+// ServiceBuilder.Build.
+func ImportJSON(r io.Reader, bind func(svc, char UUID) CharHandlers) ([]*Service, error) {
+	var db dbJSON
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&db); err != nil {
+		return nil, fmt.Errorf("gatt: database: %v", err)
+	}
+	var svcs []*Service
+	for _, sj := range db.Services {
+		svc, err := sj.service(bind)
+		if err != nil {
+			return nil, fmt.Errorf("gatt: database: %v", err)
+		}
+		svcs = append(svcs, svc)
+	}
+	return svcs, nil
+}
+
+// ImportJSON adds the services of the GATT database read from r to s.
+// See ImportJSON.
+func (s *Server) ImportJSON(r io.Reader, bind func(svc, char UUID) CharHandlers) error {
+	if s.serving {
+		return errors.New("cannot add services while serving")
+	}
+	svcs, err := ImportJSON(r, bind)
+	if err != nil {
+		return err
+	}
+	s.services = append(s.services, svcs...)
+	return nil
+}
+
+// service returns the service declared, bound to its handlers.
+func (sj serviceJSON) service(bind func(svc, char UUID) CharHandlers) (*Service, error) {
+	u, err := ParseUUID(sj.UUID)
+	if err != nil {
+		return nil, err
+	}
+	b := NewService(u)
+	type declared struct {
+		char          *Characteristic
+		props, secure uint
+	}
+	var decls []declared
+	for _, cj := range sj.Characteristics {
+		cu, err := ParseUUID(cj.UUID)
+		if err != nil {
+			return nil, fmt.Errorf("service %v: %v", u, err)
+		}
+		props, err := propsOf(cj.Properties)
+		if err != nil {
+			return nil, fmt.Errorf("service %v: characteristic %v: %v", u, cu, err)
+		}
+		secure := props
+		if cj.Secure != nil {
+			if secure, err = propsOf(cj.Secure); err != nil {
+				return nil, fmt.Errorf("service %v: characteristic %v: secure: %v", u, cu, err)
+			}
+			if secure&^props != 0 {
+				return nil, fmt.Errorf("service %v: characteristic %v: secure %v, not among its properties", u, cu, propNames(secure&^props))
+			}
+		}
+		h := bind(u, cu)
+		for _, p := range []struct {
+			declared, handled bool
+			props, handler    string
+		}{
+			{props&charRead != 0, h.Read != nil, "read", "Read"},
+			{props&(charWrite|charWriteNR) != 0, h.Write != nil, "write", "Write"},
+			{props&(charNotify|charIndicate) != 0, h.Notify != nil, "notify", "Notify"},
+		} {
+			switch {
+			case p.declared && !p.handled:
+				return nil, fmt.Errorf("service %v: characteristic %v can %s, but has no %s handler", u, cu, p.props, p.handler)
+			case p.handled && !p.declared:
+				return nil, fmt.Errorf("service %v: characteristic %v has a %s handler, but cannot %s", u, cu, p.handler, p.props)
+			}
+		}
+		cb := b.AddCharacteristic(cu)
+		if h.Read != nil {
+			cb.SetReadHandler(h.Read)
+		}
+		if h.Write != nil {
+			cb.SetWriteHandler(h.Write)
+		}
+		if h.Notify != nil {
+			cb.EnableNotify(h.Notify)
+		}
+		switch cj.NotifyPolicy {
+		case "":
+		case "latest":
+			cb.SetNotifyPolicy(NotifyLatest)
+		case "queue":
+			cb.SetNotifyPolicy(NotifyQueue)
+		default:
+			return nil, fmt.Errorf("service %v: characteristic %v: unknown notify policy %q", u, cu, cj.NotifyPolicy)
+		}
+		for _, dj := range cj.Descriptors {
+			du, err := ParseUUID(dj.UUID)
+			if err != nil {
+				return nil, fmt.Errorf("service %v: characteristic %v: %v", u, cu, err)
+			}
+			v, err := hex.DecodeString(dj.Value)
+			if err != nil {
+				return nil, fmt.Errorf("service %v: characteristic %v: descriptor %v: %v", u, cu, du, err)
+			}
+			cb.AddDescriptor(du, v)
+		}
+		decls = append(decls, declared{cb.char, props, secure})
+	}
+	svc, err := b.Build()
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range decls {
+		d.char.props, d.char.secure = d.props, d.secure
+	}
+	return svc, nil
+}
+
+// propsOf returns the properties of the names.
+func propsOf(names []string) (uint, error) {
+	var props uint
+	for _, name := range names {
+		p := propNamed(name)
+		if p == 0 {
+			return 0, fmt.Errorf("unknown property %q", name)
+		}
+		props |= p
+	}
+	return props, nil
+}
+
+// propNamed returns the property of the name, or zero.
+func propNamed(name string) uint {
+	for _, p := range charPropNames {
+		if p.name == name {
+			return p.prop
+		}
+	}
+	return 0
+}
@@ -0,0 +1,71 @@
+package gatt
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDatabaseJSON(t *testing.T) {
+	read := ReadHandlerFunc(func(resp ReadResponseWriter, req *ReadRequest) {})
+	write := WriteHandlerFunc(func(r Request, data []byte) byte { return StatusSuccess })
+	notify := NotifyHandlerFunc(func(r Request, n Notifier) {})
+	svc, err := NewService(UUID16(0x180D)).
+		AddCharacteristic(UUID16(0x2A37)).EnableNotify(notify).SetNotifyPolicy(NotifyLatest).
+		AddCharacteristic(UUID16(0x2A38)).SetReadHandler(read).AddDescriptor(UUID16(0x2901), []byte("location")).
+		AddCharacteristic(UUID16(0x2A39)).SetWriteHandler(write).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var exported bytes.Buffer
+	if err := ExportJSON(&exported, svc); err != nil {
+		t.Fatal(err)
+	}
+	bind := func(svc, char UUID) CharHandlers {
+		switch {
+		case char.Equal(UUID16(0x2A37)):
+			return CharHandlers{Notify: notify}
+		case char.Equal(UUID16(0x2A38)):
+			return CharHandlers{Read: read}
+		}
+		return CharHandlers{Write: write}
+	}
+	svcs, err := ImportJSON(bytes.NewReader(exported.Bytes()), bind)
+	if err != nil {
+		t.Fatalf("ImportJSON of\n%s: %v", exported.Bytes(), err)
+	}
+	var reexported bytes.Buffer
+	if err := ExportJSON(&reexported, svcs...); err != nil {
+		t.Fatal(err)
+	}
+	if reexported.String() != exported.String() {
+		t.Errorf("exported:\n%s\nimported and exported again:\n%s", exported.Bytes(), reexported.Bytes())
+	}
+
+	// The properties declared, rather than those of the handlers.
+	svcs, err = ImportJSON(strings.NewReader(`{"services": [{"uuid": "180d", "characteristics": [
+		{"uuid": "2a39", "properties": ["write"], "secure": []}
+	]}]}`), bind)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := svcs[0].chars[0]; c.props != charWrite || c.secure != 0 {
+		t.Errorf("write only, not secure: got properties %v, secure %v", propNames(c.props), propNames(c.secure))
+	}
+
+	for _, bad := range []string{
+		`{"services": [{"uuid": "18"}]}`,
+		`{"services": [{"uuid": "180d", "characteristics": [{"uuid": "2a39", "properties": ["read"]}]}]}`,
+		`{"services": [{"uuid": "180d", "characteristics": [{"uuid": "2a39", "properties": []}]}]}`,
+		`{"services": [{"uuid": "180d", "characteristics": [{"uuid": "2a39", "properties": ["erase"]}]}]}`,
+		`{"services": [{"uuid": "180d", "characteristics": [{"uuid": "2a39", "properties": ["write"], "secure": ["read"]}]}]}`,
+		`{"services": [{"uuid": "180d", "characteristics": [{"uuid": "2a39", "properties": ["write"], "notifyPolicy": "first"}]}]}`,
+		`{"services": [{"uuid": "180d", "characteristics": [{"uuid": "2a39", "properties": ["write"]}, {"uuid": "2a39", "properties": ["write"]}]}]}`,
+		`{"services": [], "handles": {}}`,
+	} {
+		if _, err := ImportJSON(strings.NewReader(bad), bind); err == nil {
+			t.Errorf("ImportJSON of %s: got no error", bad)
+		}
+	}
+}
@@ -0,0 +1,588 @@
+package gatt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// A Device is a local BLE device, driven by a backend of the platform,
+// such as the HCI user channel on Linux. It lets applications advertise
+// services, scan and connect without depending on the backend.
+//
+// A Device is single-shot, like a Server: it is initialized once with
+// Init, and once stopped, it cannot be restarted.
+//
+// Advertise, Scan and Connect may run concurrently: the device serves
+// centrals, such as phones, while it scans for peripherals, and connects
+// to them. Controllers support only some combinations of those roles;
+// scanning and advertising are paused while Connect initiates a
+// connection, if they cannot run along, and starting either one when the
+// controller cannot run it along with the others fails with an error
+// matching linux.ErrUnsupported, rather than silently stopping them.
+type Device interface {
+	// Init opens and resets the device. It must be called, once, before
+	// any other method.
+	//
+	// Options out of their legal range, here and in the other methods,
+	// are reported with an ErrInvalidParameter before the controller is
+	// involved.
+	Init(ctx context.Context, opts DeviceOptions) error
+
+	// AddService registers a service, declared with NewService, with
+	// the device.
+	// All services must be added before advertising starts.
+	AddService(svc *Service) error
+
+	// Advertise serves the services added and advertises them, until
+	// ctx is done. It returns ctx.Err(), or the error advertising
+	// failed with. Connections accepted stay up once it has returned.
+	Advertise(ctx context.Context, opts AdvertiseOptions) error
+
+	// Scan scans for advertisements, calling f with each, until ctx is
+	// done. It returns ctx.Err(), or the error scanning failed with.
+	Scan(ctx context.Context, opts ScanOptions, f func(a *Advertisement)) error
+
+	// Connect connects, as the central, to the peripheral of address
+	// addr, such as the Addr of one of its advertisements; its type must
+	// be that of the address the peripheral advertises with. It blocks
+	// until the connection is established, or fails, or ctx is done, in
+	// which case the connection is canceled. It fails with an error
+	// matching linux.ErrPeerNotSeen once the deadline of ctx passes,
+	// linux.ErrConnectFailed when the connection failed to be
+	// established, and linux.ErrControllerBusy when the controller
+	// cannot initiate it now, e.g. as another Connect is running.
+	Connect(ctx context.Context, addr Addr, opts ConnectOptions) (Conn, error)
+
+	// SubscribeConns delivers the connections and disconnections on c,
+	// as an alternative to the Connect and Disconnect options.
+	// See Server.SubscribeConns.
+	SubscribeConns(c chan ConnEvent, p SubscriptionPolicy)
+
+	// SubscribePairings delivers the outcome of the pairings, by Pair,
+	// on c. See Server.SubscribePairings.
+	SubscribePairings(c chan PairingEvent, p SubscriptionPolicy)
+
+	// Stop stops advertising and scanning, closes the connections and
+	// the device, and returns once every goroutine of the device, and
+	// the callbacks running, have returned, or once ctx is done, in
+	// which case it returns ctx.Err(). It may be called more than once.
+	Stop(ctx context.Context) error
+}
+
+// Handover moves the logical peripheral served by d, e.g. off a USB
+// dongle that failed, to the adapter of index id: it returns a new
+// Device, initialized with the options of d, serving its services, and
+// delivering the connections to its subscriptions, and then stops d.
+// The Advertise call running on d, if any, carries on advertising with
+// the new Device, rather than returning; the centrals connected to d are
+// dropped, and reconnect to the new adapter, whose address is its own.
+// If the new adapter cannot be initialized, d is left as it is.
+func Handover(ctx context.Context, d Device, id int) (Device, error) {
+	h, ok := d.(interface {
+		handover(ctx context.Context, id int) (Device, error)
+	})
+	if !ok {
+		return nil, fmt.Errorf("gatt: %T cannot be handed over", d)
+	}
+	return h.handover(ctx, id)
+}
+
+// SetAcceptList sets the accept list, formerly the white list, of the
+// controller of d to the devices of addrs, for the controller, rather
+// than the host, to filter the advertisements scanned, as set by the
+// AcceptListOnly field of ScanOptions, and the peripherals connected to,
+// as set by the AcceptList field of ConnectOptions. The list holds a few
+// devices, e.g. 8; the controller fails those beyond with an error
+// matching linux.StatusMemoryExceeded. It cannot be set while scanning,
+// or connecting, with it.
+func SetAcceptList(d Device, addrs []Addr) error {
+	l, ok := d.(interface {
+		setAcceptList(addrs []Addr) error
+	})
+	if !ok {
+		return fmt.Errorf("gatt: %T has no accept list", d)
+	}
+	return l.setAcceptList(addrs)
+}
+
+// DeviceOptions configure a Device.
+type DeviceOptions struct {
+	// ID is the index of the device to use, e.g. 0 for hci0.
+	// A negative ID selects one automatically.
+	ID int
+
+	// AdapterAddr, if set, selects the device by its public address
+	// rather than by ID. See the DeviceAddr option of the linux package.
+	AdapterAddr BDAddr
+
+	// TakeDown, if set, takes the device down before opening it, for
+	// the kernel, and bluetoothd, to let go of it; a device up fails to
+	// open otherwise. See the TakeDown option of the linux package.
+	TakeDown bool
+
+	// UART, if set, is the path of the tty, e.g. /dev/ttyAMA0, to which
+	// the controller is attached, driven over the HCI UART transport
+	// rather than the device of index ID, at UARTBaud, 115200 if zero,
+	// with RTS/CTS flow control unless UARTNoFlowControl. See the UART
+	// option of the linux package.
+	UART              string
+	UARTBaud          int
+	UARTNoFlowControl bool
+
+	// DataLength is the payload, in bytes, of the link-layer data PDUs
+	// negotiated for the connections, from 27 to 251. Zero means the
+	// largest the controller supports. See the DataLength option of the
+	// linux package.
+	DataLength int
+
+	// Patchram, if set, is the path of the firmware patch, in the .hcd
+	// format of Broadcom, downloaded to the controller as it starts. See
+	// the Patchram option of the linux package.
+	Patchram string
+
+	// Name is the device name, exposed via the Generic Access Service
+	// (0x1800), and advertised in the default scan response.
+	Name string
+
+	// Appearance is the appearance of the device, exposed via the
+	// Generic Access Service. Zero means AppearanceGenericComputer.
+	Appearance uint16
+
+	// PreferredConnParams, if set, are the parameters of the connections
+	// preferred by the device, as the peripheral. See the
+	// PreferredConnParams option of Server.
+	PreferredConnParams ConnParams
+
+	// MaxConnections is the maximum number of concurrent connections.
+	// Zero means 1.
+	MaxConnections int
+
+	// MaxMTU is the largest ATT MTU accepted from centrals, from 23 to
+	// 517 bytes. Zero means 256.
+	MaxMTU int
+
+	// RequestLimit and SignalingLimit, if set, limit the ATT requests,
+	// and the L2CAP signaling commands, each peer sends, disconnecting
+	// those exceeding them. See the LimitRequests and LimitSignaling
+	// options of Server.
+	RequestLimit   RateLimit
+	SignalingLimit RateLimit
+
+	// ATTHandlers, if set, handle the ATT PDUs of the opcodes gatt does
+	// not, by opcode. See the HandleATT option of Server.
+	ATTHandlers map[byte]ATTHandler
+
+	// KeyStore, if set, keeps the bonds of the peers, whose long term
+	// keys encrypt the links the centrals bonded with the device request
+	// to be, and the subscriptions of the bonded clients, restored as
+	// they reconnect. See NewFileKeyStore, and KeyWrapper, for those kept
+	// encrypted at rest, and the Bonds option of Server. gatt pairs as
+	// the central only, with Pair, which puts the bonds of the
+	// peripherals; those of the centrals are put by the application.
+	KeyStore KeyStore
+
+	// ConnPolicy, if set, declares the parameters wanted for the
+	// connections, of either role. See the ConnParamsPolicy option of
+	// Server.
+	ConnPolicy *ConnPolicy
+
+	// HandleLayout, if set, is the path of a file recording the handles
+	// of the services and characteristics, so that they keep them across
+	// restarts. See the HandleLayout option of Server.
+	HandleLayout string
+
+	// Connect and Disconnect, if set, are called as connections, of
+	// either role, are established and torn down.
+	Connect    func(c Conn)
+	Disconnect func(c Conn)
+
+	// HandlerErrors, if set, is called with the errors of the handlers
+	// and callbacks of the application, such as a HandlerPanic.
+	// See the HandlerErrors option of Server.
+	HandlerErrors func(err error)
+
+	// Spans, if set, traces ATT requests and HCI commands.
+	// See the Spans option of Server.
+	Spans func(op string) (end func(err error))
+
+	// TraceATT, if set, logs the ATT PDUs exchanged with the centrals,
+	// decoded, leaving out the values of the attributes TraceRedact
+	// reports true for. See the TraceATT option of Server.
+	TraceATT    func(format string, v ...interface{})
+	TraceRedact func(u UUID) bool
+
+	// PHYUpdate, if set, is called as the PHYs of a connection change.
+	// See the PHYUpdate option of Server.
+	PHYUpdate func(c Conn, tx, rx PHY)
+
+	// RecordATT, if set, is handed every ATT PDU exchanged, raw. See the
+	// RecordATT option of Server.
+	RecordATT func(c Conn, sent bool, pdu []byte)
+
+	// AlignNotifications, if set, holds the notifications sent to the
+	// peripherals that skip connection events until just ahead of those
+	// they wake up for. See the AlignNotifications option of Server.
+	AlignNotifications bool
+
+	// LinkLossWarning, if set, is called once a connection has received
+	// nothing for LinkLossPercent of its supervision timeout, 75 if zero.
+	// See the LinkLossWarning option of Server.
+	LinkLossWarning func(c Conn, silent time.Duration)
+	LinkLossPercent int
+
+	// Snoop, if set, captures the HCI traffic of the device, in the
+	// btsnoop format Wireshark opens. See the Snoop option of the linux
+	// package.
+	Snoop io.Writer
+
+	// Failed, if set, is called, from a goroutine of its own, with the
+	// error of the device once it fails, e.g. as its USB dongle is
+	// unplugged, rather than being stopped. See Handover.
+	Failed func(err error)
+
+	// Recover, if set, recovers the device once it fails, e.g. as its
+	// controller crashes, or is power cycled, after Failed is called:
+	// the adapter, selected as by Init, is reopened and reset, every
+	// RecoverInterval, 1 s if zero, until it succeeds, or the device is
+	// stopped, and the device is handed over to it, as by Handover, so
+	// that the Advertise call running carries on advertising. Recovered,
+	// if set, is then called with the new Device, which recovers alike,
+	// in place of the device stopped. The errors of the attempts are
+	// reported to HandlerErrors.
+	Recover         bool
+	RecoverInterval time.Duration
+	Recovered       func(next Device)
+
+	// Identities are the identities, by name, the device switches
+	// between with SwitchIdentity. Until it first does, it has that of
+	// Name and Appearance, and the public address of the adapter.
+	Identities map[string]Identity
+}
+
+// An Identity is the local identity of a device, as the centrals see it:
+// its address, name, appearance and advertised services. Test rigs
+// switch between several, to impersonate one product after another.
+type Identity struct {
+	Name       string
+	Appearance uint16 // AppearanceGenericComputer if zero
+
+	// Addr, if set, is the static random address of the identity, in
+	// the byte order of the controller, least significant byte first;
+	// if not, the public address of the adapter is used.
+	Addr BDAddr
+
+	// IRK, if not zero, is the Identity Resolving Key of the identity,
+	// least significant byte first: the device advertises with a
+	// resolvable private address generated from it, anew at each
+	// switch, rather than with Addr.
+	IRK [16]byte
+
+	// AdvertiseServices are advertised, in place of those of the
+	// AdvertiseOptions, unless an AdvertisingPacket is given.
+	AdvertiseServices []UUID
+}
+
+// check checks the address, and the lengths of the UUIDs, of the
+// identity of that name.
+func (id Identity) check(name string) error {
+	if id.Addr.HardwareAddr != nil {
+		if err := (Addr{id.Addr, AddrRandomStatic}).check(); err != nil {
+			return fmt.Errorf("gatt: identity %q: %w", name, err)
+		}
+	}
+	for _, u := range id.AdvertiseServices {
+		if err := lenErr(u.Len()); err != nil {
+			return fmt.Errorf("gatt: identity %q: AdvertiseServices: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// SwitchIdentity switches the local identity of d to that of
+// DeviceOptions.Identities of that name. The connections are dropped,
+// having been made with the previous identity, and the Generic Access
+// Service exposes the new name and appearance, unless the application
+// declares its own. Advertising, if running, goes on with the address,
+// the services and the name of the identity; the packets given to
+// Advertise explicitly are kept. SwitchIdentity fails while Connect is
+// connecting, or scanning is running, as the controller takes no new
+// address meanwhile.
+func SwitchIdentity(ctx context.Context, d Device, name string) error {
+	sw, ok := d.(interface {
+		switchIdentity(ctx context.Context, name string) error
+	})
+	if !ok {
+		return fmt.Errorf("gatt: %T cannot switch identities", d)
+	}
+	return sw.switchIdentity(ctx, name)
+}
+
+// AdvertiseOptions configure advertising. Zero values select the
+// defaults of the Server options of the same names.
+type AdvertiseOptions struct {
+	AdvertiseServices  []UUID
+	AdvertisingPacket  []byte
+	ScanResponsePacket []byte
+	ManufacturerData   []byte
+
+	// Extended, if set, advertises with the extended advertising of
+	// Bluetooth 5.0, so that the packets run longer than
+	// MaxEIRPacketLength, up to the advertising data the controller
+	// takes, which fails Advertise if it has no such support. The scan
+	// response packet is advertised after the advertising packet, and
+	// the manufacturer data, as extended connectable advertising takes
+	// no scan requests. Only centrals of Bluetooth 5.0 and later see the
+	// advertisements. Scanning fails once the device has advertised so,
+	// until it is reopened, as the controller then takes no legacy
+	// commands.
+	Extended bool
+
+	// Rotation, if set, emulates as many advertisers, e.g. beacons, with
+	// a controller that advertises a single set at a time: its payloads
+	// are advertised in turn, in place of the packets above, switching
+	// to the next every RotationPeriod, give or take a random delay of up
+	// to RotationJitter, which keeps the rotation from falling into step
+	// with that of another device. They share the address of the device.
+	Rotation       []AdvPayload
+	RotationPeriod time.Duration // 500 ms if zero; no shorter than the advertising interval
+	RotationJitter time.Duration // up to half the period
+
+	// Schedule, if set, advertises its payloads in turn, in place of the
+	// packets above, each for its Duration, keeping to the schedule, for
+	// campaigns comparing how well different payloads are discovered.
+	// ScheduleReport, if set, is called with the report of each turn as
+	// it ends. It cannot be used with Rotation.
+	Schedule       []AdvSlot
+	ScheduleReport func(r AdvSlotReport)
+}
+
+// An AdvPayload is the advertising packet, and the scan response packet,
+// of one of the advertisements of a Rotation.
+type AdvPayload struct {
+	AdvertisingPacket  []byte
+	ScanResponsePacket []byte
+}
+
+// An AdvSlot is one of the payloads of a Schedule, and the time it is
+// advertised for, each time its turn comes: no shorter than the
+// advertising interval.
+type AdvSlot struct {
+	AdvPayload
+	Duration time.Duration
+}
+
+// An AdvSlotReport reports a turn of a slot of a Schedule.
+type AdvSlotReport struct {
+	Slot  int           // index of the slot in the Schedule
+	Start time.Time     // at which the controller took its payload
+	OnAir time.Duration // from Start until the next payload was taken
+
+	// Events is the number of advertising events the payload went out
+	// in, as estimated from OnAir and the advertising interval, the
+	// controllers reporting none.
+	Events int
+}
+
+const defaultRecoverInterval = time.Second
+
+// recoverInterval returns the RecoverInterval, or its default.
+func (o DeviceOptions) recoverInterval() time.Duration {
+	if o.RecoverInterval <= 0 {
+		return defaultRecoverInterval
+	}
+	return o.RecoverInterval
+}
+
+const defaultRotationPeriod = 500 * time.Millisecond
+
+// rotationPeriod returns the RotationPeriod, or its default.
+func (o AdvertiseOptions) rotationPeriod() time.Duration {
+	if o.RotationPeriod == 0 {
+		return defaultRotationPeriod
+	}
+	return o.RotationPeriod
+}
+
+// check checks the lengths of the packets, and of the UUIDs.
+func (o AdvertiseOptions) check() error {
+	for _, u := range o.AdvertiseServices {
+		if err := lenErr(u.Len()); err != nil {
+			return fmt.Errorf("gatt: AdvertiseServices: %v", err)
+		}
+	}
+	if len(o.Rotation) > 0 {
+		if err := checkDuration("RotationJitter", o.RotationJitter, 0, o.rotationPeriod()/2); err != nil {
+			return err
+		}
+	}
+	if len(o.Rotation) > 0 && len(o.Schedule) > 0 {
+		return errors.New("gatt: Rotation cannot be used with Schedule")
+	}
+	if o.Extended {
+		return nil // the lengths are checked by the HCI, which knows the limit
+	}
+	for _, p := range o.Rotation {
+		if err := checkAdvertising(p.AdvertisingPacket, p.ScanResponsePacket, nil); err != nil {
+			return err
+		}
+	}
+	for _, s := range o.Schedule {
+		if err := checkAdvertising(s.AdvertisingPacket, s.ScanResponsePacket, nil); err != nil {
+			return err
+		}
+	}
+	return checkAdvertising(o.AdvertisingPacket, o.ScanResponsePacket, o.ManufacturerData)
+}
+
+// ScanOptions configure scanning.
+type ScanOptions struct {
+	// Active requests the scan responses of the advertisers as well.
+	Active bool
+
+	// FilterDuplicates lets the controller report each advertiser
+	// once only.
+	FilterDuplicates bool
+
+	// Store, if set, records the advertisements, with the time they are
+	// received, ahead of the function of Scan, to be queried later.
+	Store ScanStore
+
+	// Peers, if set, records the advertisers, as peers merged across the
+	// rotations of their addresses, ahead of the function of Scan, which
+	// looks each up with Peers.Lookup.
+	Peers *PeerRegistry
+
+	// Raw captures every advertising PDU, FilterDuplicates notwithstanding,
+	// each Advertisement carrying the report of the controller, undecoded,
+	// in its Raw field; see RawAdvertisement.
+	Raw bool
+
+	// AcceptListOnly lets the controller report the advertisements of
+	// the devices of its accept list only, and those directed to the
+	// device; see SetAcceptList.
+	AcceptListOnly bool
+}
+
+// ConnectOptions configure a connection.
+type ConnectOptions struct {
+	// IntervalMin and IntervalMax bound the connection interval, from
+	// 7.5 ms to 4 s, in steps of 1.25 ms. Zero values select 30 ms and
+	// 50 ms respectively.
+	IntervalMin, IntervalMax time.Duration
+
+	// Latency is the number of connection events the peripheral may
+	// skip, up to 499.
+	Latency int
+
+	// SupervisionTimeout is how long the link may go silent before it
+	// is considered lost, from 100 ms to 32 s, in steps of 10 ms. It
+	// must exceed twice the IntervalMax, times the Latency plus one.
+	// Zero selects 5 s.
+	SupervisionTimeout time.Duration
+
+	// AcceptList connects to the first peripheral of the accept list
+	// found advertising, whichever it is, rather than to the address
+	// given to Connect, which is then ignored; see SetAcceptList.
+	AcceptList bool
+}
+
+// check checks the ranges of the options.
+func (o ConnectOptions) check() error {
+	if o.IntervalMin != 0 {
+		if err := checkDuration("IntervalMin", o.IntervalMin, 7500*time.Microsecond, 4*time.Second); err != nil {
+			return err
+		}
+	}
+	if o.IntervalMax != 0 {
+		if err := checkDuration("IntervalMax", o.IntervalMax, 7500*time.Microsecond, 4*time.Second); err != nil {
+			return err
+		}
+	}
+	if err := checkRange("Latency", o.Latency, 0, 499); err != nil {
+		return err
+	}
+	if o.SupervisionTimeout != 0 {
+		return checkDuration("SupervisionTimeout", o.SupervisionTimeout, 100*time.Millisecond, 32*time.Second)
+	}
+	return nil
+}
+
+// An Advertisement is an advertising, or scan response, packet received
+// while scanning.
+type Advertisement struct {
+	Addr         Addr
+	ScanResponse bool
+	RSSI         int
+
+	// Data holds the advertising data structures of the packet.
+	Data []byte
+
+	// Raw is the report of the controller, if scanning in the raw mode.
+	Raw *RawAdvertisement
+}
+
+// A RawAdvertisement is an advertising report as the controller sent it,
+// for sniffers and protocol analysis tools. The HCI reports neither the
+// channel the PDU was received on, nor the time the controller received
+// it; Time is that the host read it.
+type RawAdvertisement struct {
+	// EventType is the type of the PDU: ADV_IND 0x00, ADV_DIRECT_IND
+	// 0x01, ADV_SCAN_IND 0x02, ADV_NONCONN_IND 0x03 or SCAN_RSP 0x04.
+	EventType byte
+
+	// AddressType is that of the advertiser, as reported.
+	AddressType byte
+
+	Time time.Time
+
+	// Report holds the report, as in the LE Advertising Report event:
+	// event type, address type, address, data length, data, with the
+	// original AD bytes, and RSSI.
+	Report []byte
+}
+
+// Services returns the UUIDs of the services listed by the packet.
+func (a *Advertisement) Services() []UUID {
+	var uu []UUID
+	for b := a.Data; len(b) > 1 && b[0] > 0 && len(b) > int(b[0]); b = b[1+b[0]:] {
+		n := 0
+		switch b[1] {
+		case typeSomeUUID16, typeAllUUID16:
+			n = 2
+		case typeSomeUUID128, typeAllUUID128:
+			n = 16
+		default:
+			continue
+		}
+		for d := b[2 : 1+b[0]]; len(d) >= n; d = d[n:] {
+			uu = append(uu, uuidFromLE(d[:n]))
+		}
+	}
+	return uu
+}
+
+// HasService reports whether the packet lists the service of UUID u.
+func (a *Advertisement) HasService(u UUID) bool {
+	for _, v := range a.Services() {
+		if v.Equal(u) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	// ErrDeviceNotInitialized is returned when a Device is used
+	// before Init.
+	ErrDeviceNotInitialized = errors.New("device not initialized")
+
+	// ErrDeviceStopped is returned when a Device is used after Stop.
+	ErrDeviceStopped = errors.New("device stopped")
+
+	// ErrNoRSSI is returned by UpdateRSSI when the controller has not
+	// measured the RSSI of the connection yet.
+	ErrNoRSSI = errors.New("no RSSI measured yet")
+)
@@ -0,0 +1,26 @@
+package gatt
+
+import "context"
+
+// This is a placeholder so that gatt can build on OS X.
+
+type unsupportedDevice struct{}
+
+// NewDevice returns the Device of the platform, to be initialized with
+// Init.
+func NewDevice() Device { return unsupportedDevice{} }
+
+func (unsupportedDevice) Init(ctx context.Context, opts DeviceOptions) error { return notImplemented }
+func (unsupportedDevice) AddService(svc *Service) error                      { return notImplemented }
+func (unsupportedDevice) Advertise(ctx context.Context, opts AdvertiseOptions) error {
+	return notImplemented
+}
+func (unsupportedDevice) Scan(ctx context.Context, opts ScanOptions, f func(a *Advertisement)) error {
+	return notImplemented
+}
+func (unsupportedDevice) Connect(ctx context.Context, addr Addr, opts ConnectOptions) (Conn, error) {
+	return nil, notImplemented
+}
+func (unsupportedDevice) SubscribeConns(c chan ConnEvent, p SubscriptionPolicy)       {}
+func (unsupportedDevice) SubscribePairings(c chan PairingEvent, p SubscriptionPolicy) {}
+func (unsupportedDevice) Stop(ctx context.Context) error                              { return notImplemented }
@@ -0,0 +1,851 @@
+package gatt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/paypal/gatt/linux"
+)
+
+// hciDevice is the Device of the Linux HCI backend. The services it
+// serves, and the connections, are those of a Server, which it drives
+// in place of Server.start.
+type hciDevice struct {
+	mu      sync.Mutex
+	hci     *linux.HCI
+	srv     *Server
+	stopped bool
+	wg      sync.WaitGroup // accept, readAdvReports, watch and the connections
+
+	scanf func(a *Advertisement) // of the running Scan, if any
+
+	connc    chan *conn // of the running Connect, if any
+	connPeer Addr
+
+	opts DeviceOptions // of Init
+	next Device        // the device handed over to, if any
+
+	conns    map[*conn]chan struct{} // served, each with a channel closed once done
+	identity *Identity               // switched to, if any
+
+	advmu   sync.Mutex        // serializes advertising changes, and identity switches
+	advOpts *AdvertiseOptions // of the running Advertise, if any
+}
+
+// openHCI opens the HCI of a device; tests replace it to script the
+// controller.
+var openHCI = linux.OpenHCI
+
+// NewDevice returns the Device of the platform, to be initialized with
+// Init.
+func NewDevice() Device { return &hciDevice{srv: NewServer()} }
+
+func (d *hciDevice) Init(ctx context.Context, opts DeviceOptions) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stopped {
+		return ErrDeviceStopped
+	}
+	if d.hci != nil {
+		return errors.New("device already initialized")
+	}
+	maxConn := opts.MaxConnections
+	if maxConn == 0 {
+		maxConn = 1
+	}
+	mtu := opts.MaxMTU
+	if mtu == 0 {
+		mtu = defaultMaxMTU
+	}
+	appearance := opts.Appearance
+	if appearance == 0 {
+		appearance = AppearanceGenericComputer
+	}
+	baud := opts.UARTBaud
+	if baud == 0 {
+		baud = 115200
+	}
+	if err := checkRange("MaxConnections", maxConn, 1, 0xEFF); err != nil {
+		return err
+	}
+	if err := checkRange("MaxMTU", mtu, minMTU, maxMTU); err != nil {
+		return err
+	}
+	if opts.PreferredConnParams != (ConnParams{}) {
+		if err := opts.PreferredConnParams.check("PreferredConnParams"); err != nil {
+			return err
+		}
+	}
+	if opts.ConnPolicy != nil {
+		if err := opts.ConnPolicy.check(); err != nil {
+			return err
+		}
+	}
+	if opts.LinkLossPercent != 0 {
+		if err := checkRange("LinkLossPercent", opts.LinkLossPercent, 1, 99); err != nil {
+			return err
+		}
+	}
+	for name, id := range opts.Identities {
+		if err := id.check(name); err != nil {
+			return err
+		}
+	}
+	for op := range opts.ATTHandlers {
+		if attDefined(op) {
+			return fmt.Errorf("gatt: ATTHandlers of opcode 0x%02X, defined by the specification", op)
+		}
+	}
+	var adapter [6]byte
+	copy(adapter[:], opts.AdapterAddr.HardwareAddr)
+	s := d.srv
+	hopts := []linux.HCIOption{
+		linux.DeviceID(opts.ID),
+		linux.DeviceAddr(adapter),
+		linux.TakeDown(opts.TakeDown),
+		linux.MaxConnections(maxConn),
+		linux.HandlerErrors(opts.HandlerErrors),
+		linux.Snoop(opts.Snoop),
+		linux.UART(opts.UART, baud, !opts.UARTNoFlowControl),
+		linux.DataLength(opts.DataLength),
+		linux.Patchram(opts.Patchram),
+	}
+	var h *linux.HCI
+	if ks := opts.KeyStore; ks != nil {
+		hopts = append(hopts, linux.LongTermKeys(func(handle uint16, rand uint64, ediv uint16) ([16]byte, bool) {
+			l2c, found := h.L2CAP().Conn(handle)
+			if !found {
+				return [16]byte{}, false
+			}
+			ltk, ok, err := longTermKey(ks, addrOf(l2c.Param.PeerAddress, l2c.Param.PeerAddressType), rand, ediv)
+			if err != nil {
+				s.report(fmt.Errorf("gatt: looking up the long term key: %w", err))
+			}
+			return ltk, ok
+		}))
+	}
+	h, err := openHCI(hopts...)
+	if err != nil {
+		return err
+	}
+	s.Option(
+		Name(opts.Name),
+		Appearance(appearance),
+		PreferredConnParams(opts.PreferredConnParams),
+		MaxConnections(maxConn),
+		MaxMTU(mtu),
+		HandleLayout(opts.HandleLayout),
+		Bonds(opts.KeyStore),
+		ConnParamsPolicy(opts.ConnPolicy),
+		LimitRequests(opts.RequestLimit),
+		LimitSignaling(opts.SignalingLimit),
+		LinkLossWarning(opts.LinkLossPercent, opts.LinkLossWarning),
+		AlignNotifications(opts.AlignNotifications),
+		Connect(opts.Connect),
+		Disconnect(opts.Disconnect),
+		Spans(opts.Spans),
+		TraceATT(opts.TraceATT, opts.TraceRedact),
+		RecordATT(opts.RecordATT),
+		PHYUpdate(opts.PHYUpdate),
+		HandlerErrors(opts.HandlerErrors),
+	)
+	for op, f := range opts.ATTHandlers {
+		s.Option(HandleATT(op, f))
+	}
+	a := h.NewAdvertiser()
+	l := h.L2CAP()
+	l.Adv = a
+	l.ManageParams = s.paramsPolicy() != nil
+	if s.span != nil {
+		h.SetSpanHook(s.span)
+	}
+	s.adv = a
+	s.quit = make(chan struct{})
+	s.stats = func() ConnStats { return ConnStats(l.Stats()) }
+
+	if err := h.StartCtx(ctx); err != nil {
+		h.Close()
+		return err
+	}
+	d.hci = h
+	d.opts = opts
+	d.wg.Add(3)
+	go d.accept()
+	go d.readAdvReports()
+	go d.watch(opts.Failed)
+	return nil
+}
+
+// watch calls failed, if not nil, once the HCI fails, and recovers d, if
+// set to.
+func (d *hciDevice) watch(failed func(err error)) {
+	defer d.wg.Done()
+	select {
+	case <-d.hci.Done():
+	case <-d.srv.quit:
+		return
+	}
+	d.mu.Lock()
+	stopped := d.stopped
+	d.mu.Unlock()
+	if stopped {
+		return
+	}
+	if failed != nil {
+		d.srv.call("failed", func() { failed(d.hci.Err()) })
+	}
+	if d.opts.Recover {
+		// Not waited for by Stop, which the handover calls.
+		go d.recover()
+	}
+}
+
+// recoverTimeout bounds each attempt at reopening the adapter.
+const recoverTimeout = 10 * time.Second
+
+// recover reopens the adapter of d, once failed, until it succeeds, or d
+// is stopped, and hands d over to it. The failed HCI is shut down first:
+// the kernel refuses to bind a second user channel to the adapter while
+// the socket of the first is open.
+func (d *hciDevice) recover() {
+	h, s, err := d.device()
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), recoverTimeout)
+	err = h.Shutdown(ctx)
+	cancel()
+	if err != nil {
+		s.report(fmt.Errorf("gatt: closing the failed adapter: %w", err))
+	}
+	t := time.NewTimer(0)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-s.quit:
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), recoverTimeout)
+		next, err := d.moveTo(ctx, d.opts)
+		cancel()
+		if err == nil {
+			if f := d.opts.Recovered; f != nil {
+				s.call("recovered", func() { f(next) })
+			}
+			return
+		}
+		if errors.Is(err, ErrDeviceStopped) {
+			return
+		}
+		s.report(fmt.Errorf("gatt: recovering the device: %w", err))
+		t.Reset(d.opts.recoverInterval())
+	}
+}
+
+// device returns the HCI and the server of an initialized device, which
+// has not been stopped.
+func (d *hciDevice) device() (*linux.HCI, *Server, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stopped {
+		return nil, nil, ErrDeviceStopped
+	}
+	if d.hci == nil {
+		return nil, nil, ErrDeviceNotInitialized
+	}
+	return d.hci, d.srv, nil
+}
+
+func (d *hciDevice) AddService(svc *Service) error {
+	_, s, err := d.device()
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if s.serving {
+		return errors.New("cannot add services while advertising")
+	}
+	s.services = append(s.services, svc)
+	return nil
+}
+
+func (d *hciDevice) Advertise(ctx context.Context, opts AdvertiseOptions) error {
+	_, s, err := d.device()
+	if err != nil {
+		return err
+	}
+	if err := opts.check(); err != nil {
+		return err
+	}
+	d.mu.Lock()
+	if !s.serving {
+		if err := s.setServices(); err != nil {
+			d.mu.Unlock()
+			return err
+		}
+		s.serving = true
+	}
+	d.mu.Unlock()
+
+	d.advmu.Lock()
+	if err := d.setAdvertisement(s, opts); err != nil {
+		d.advmu.Unlock()
+		return err
+	}
+	if err := s.adv.Start(); err != nil {
+		d.advmu.Unlock()
+		return err
+	}
+	d.advOpts = &opts
+	d.advmu.Unlock()
+	actx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-s.quit:
+			cancel()
+		case <-actx.Done():
+		}
+	}()
+	switch {
+	case len(opts.Rotation) > 0:
+		err = s.adv.Rotate(actx, opts.payloads(), opts.rotationPeriod(), opts.RotationJitter)
+	case len(opts.Schedule) > 0:
+		err = s.adv.Schedule(actx, opts.slots(), opts.scheduleReport())
+	default:
+		<-actx.Done()
+		err = actx.Err()
+	}
+	d.advmu.Lock()
+	d.advOpts = nil
+	select {
+	case <-s.quit:
+		d.advmu.Unlock()
+		if next := d.successor(); next != nil {
+			// Handed over: carry on advertising with the new adapter.
+			return next.Advertise(ctx, opts)
+		}
+		return ErrDeviceStopped
+	default:
+	}
+	e := s.adv.Stop()
+	d.advmu.Unlock()
+	if e != nil {
+		return e
+	}
+	return err
+}
+
+// setAdvertisement sets the packets advertised with opts, the services
+// advertised by default being those of the identity switched to, if any.
+func (d *hciDevice) setAdvertisement(s *Server, opts AdvertiseOptions) error {
+	d.mu.Lock()
+	if id := d.identity; id != nil && len(id.AdvertiseServices) > 0 {
+		opts.AdvertiseServices = id.AdvertiseServices
+	}
+	d.mu.Unlock()
+	s.advertisingPacket = opts.AdvertisingPacket
+	if len(s.advertisingPacket) == 0 && len(opts.AdvertiseServices) > 0 {
+		s.advertisingPacket, _ = serviceAdvertisingPacket(opts.AdvertiseServices)
+	}
+	s.scanResponsePacket = opts.ScanResponsePacket
+	s.manufacturerData = opts.ManufacturerData
+	s.extendedAdv = opts.Extended
+	s.adv.Option(
+		linux.AdvertisingPacket(s.advertisingPacket),
+		linux.ScanResponsePacket(s.scanResponsePacket),
+		linux.ManufacturerData(s.manufacturerData),
+		linux.ExtendedAdvertising(opts.Extended),
+	)
+	return s.setDefaultAdvertisement()
+}
+
+// payloads returns the payloads of the Rotation, for the HCI.
+func (o AdvertiseOptions) payloads() []linux.AdvPayload {
+	ps := make([]linux.AdvPayload, len(o.Rotation))
+	for i, p := range o.Rotation {
+		ps[i] = linux.AdvPayload{AdvertisingData: p.AdvertisingPacket, ScanResponseData: p.ScanResponsePacket}
+	}
+	return ps
+}
+
+// slots returns the slots of the Schedule, for the HCI.
+func (o AdvertiseOptions) slots() []linux.AdvSlot {
+	ss := make([]linux.AdvSlot, len(o.Schedule))
+	for i, s := range o.Schedule {
+		ss[i] = linux.AdvSlot{
+			AdvPayload: linux.AdvPayload{AdvertisingData: s.AdvertisingPacket, ScanResponseData: s.ScanResponsePacket},
+			Duration:   s.Duration,
+		}
+	}
+	return ss
+}
+
+// scheduleReport returns the ScheduleReport, if any, for the HCI.
+func (o AdvertiseOptions) scheduleReport() func(r linux.AdvSlotReport) {
+	f := o.ScheduleReport
+	if f == nil {
+		return nil
+	}
+	return func(r linux.AdvSlotReport) {
+		f(AdvSlotReport{Slot: r.Slot, Start: r.Start, OnAir: r.OnAir, Events: r.Events})
+	}
+}
+
+func (d *hciDevice) Scan(ctx context.Context, opts ScanOptions, f func(a *Advertisement)) error {
+	h, s, err := d.device()
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	if d.scanf != nil {
+		d.mu.Unlock()
+		return errors.New("already scanning")
+	}
+	d.scanf = opts.recording(f, s.report)
+	d.mu.Unlock()
+	defer func() {
+		d.mu.Lock()
+		d.scanf = nil
+		d.mu.Unlock()
+	}()
+
+	h.SetRawAdvReports(opts.Raw)
+	h.FilterScanByAcceptList(opts.AcceptListOnly)
+	if err := h.Scan(opts.Active, opts.FilterDuplicates && !opts.Raw); err != nil {
+		return err
+	}
+	select {
+	case <-ctx.Done():
+	case <-s.quit:
+		return ErrDeviceStopped
+	}
+	if err := h.StopScan(); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+func (d *hciDevice) setAcceptList(addrs []Addr) error {
+	h, _, err := d.device()
+	if err != nil {
+		return err
+	}
+	for _, a := range addrs {
+		if err := a.check(); err != nil {
+			return err
+		}
+	}
+	if err := h.ClearAcceptList(); err != nil {
+		return err
+	}
+	for _, a := range addrs {
+		peer, typ := hciAddr(a)
+		if err := h.AddToAcceptList(peer, typ); err != nil {
+			return fmt.Errorf("gatt: adding %s to the accept list: %w", a, err)
+		}
+	}
+	return nil
+}
+
+// readAdvReports hands the advertising reports over to the running Scan,
+// until the device is closed.
+func (d *hciDevice) readAdvReports() {
+	defer d.wg.Done()
+	rs := make([]linux.AdvReport, 16)
+	for {
+		n, err := d.hci.ReadAdvReports(rs)
+		if err != nil {
+			return
+		}
+		d.mu.Lock()
+		f := d.scanf
+		d.mu.Unlock()
+		if f == nil {
+			continue
+		}
+		for i := range rs[:n] {
+			r := &rs[i]
+			d.srv.call("scan", func() {
+				a := &Advertisement{
+					Addr:         addrOf(r.Address, r.AddressType),
+					ScanResponse: r.EventType == 0x04,
+					RSSI:         int(r.RSSI),
+					Data:         append([]byte(nil), r.AdvertisingData()...),
+				}
+				if r.Raw != nil {
+					a.Raw = &RawAdvertisement{
+						EventType:   r.EventType,
+						AddressType: r.AddressType,
+						Time:        r.Time,
+						Report:      r.Raw,
+					}
+				}
+				f(a)
+			})
+		}
+	}
+}
+
+func (d *hciDevice) Connect(ctx context.Context, addr Addr, opts ConnectOptions) (Conn, error) {
+	h, s, err := d.device()
+	if err != nil {
+		return nil, err
+	}
+	if opts.AcceptList {
+		addr = Addr{} // any of the accept list
+	} else if err := addr.check(); err != nil {
+		return nil, err
+	}
+	if err := opts.check(); err != nil {
+		return nil, err
+	}
+	c := make(chan *conn, 1)
+	d.mu.Lock()
+	if d.connc != nil {
+		d.mu.Unlock()
+		return nil, fmt.Errorf("gatt: already connecting: %w", linux.ErrControllerBusy)
+	}
+	d.connc = c
+	d.connPeer = addr
+	d.mu.Unlock()
+	defer func() {
+		d.mu.Lock()
+		d.connc = nil
+		d.mu.Unlock()
+	}()
+
+	peer, typ := hciAddr(addr)
+	cctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-s.quit:
+			cancel()
+		case <-cctx.Done():
+		}
+	}()
+	connect := func() error { return h.ConnectCtx(cctx, peer, typ, opts.connParams()) }
+	if opts.AcceptList {
+		connect = func() error { return h.ConnectAcceptListCtx(cctx, opts.connParams()) }
+	}
+	if err := connect(); err != nil {
+		select {
+		case <-s.quit:
+			return nil, ErrDeviceStopped
+		default:
+			return nil, err
+		}
+	}
+	// Established: the connection is on its way from accept, unless ctx
+	// is done meanwhile, e.g. as the connection completed just as it was
+	// canceled. It is then returned if accept has handed it over already,
+	// and dropped by accept otherwise.
+	select {
+	case cn := <-c:
+		return cn, nil
+	case <-ctx.Done():
+	case <-s.quit:
+		return nil, ErrDeviceStopped
+	}
+	d.mu.Lock()
+	d.connc = nil
+	d.mu.Unlock()
+	select {
+	case cn := <-c:
+		return cn, nil
+	default:
+		return nil, ctx.Err()
+	}
+}
+
+// connParams returns the linux.ConnParams of the options, the zero
+// values being replaced with the defaults.
+func (o ConnectOptions) connParams() linux.ConnParams {
+	p := linux.DefaultConnParams
+	if o.IntervalMin != 0 {
+		p.IntervalMin = uint16(o.IntervalMin / (1250 * time.Microsecond))
+	}
+	if o.IntervalMax != 0 {
+		p.IntervalMax = uint16(o.IntervalMax / (1250 * time.Microsecond))
+	}
+	p.Latency = uint16(o.Latency)
+	if o.SupervisionTimeout != 0 {
+		p.SupervisionTimeout = uint16(o.SupervisionTimeout / (10 * time.Millisecond))
+	}
+	return p
+}
+
+// accept serves the connections, until the device is stopped. Those
+// established as the central are handed over to the running Connect, and
+// dropped if it has given up; those established as the peripheral are
+// dropped unless the AcceptConn function accepts them.
+func (d *hciDevice) accept() {
+	defer d.wg.Done()
+	s, h := d.srv, d.hci
+	l := h.L2CAP()
+	for {
+		select {
+		case l2c := <-l.ConnC():
+			remoteAddr := addrOf(l2c.Param.PeerAddress, l2c.Param.PeerAddressType)
+			if l2c.Param.Role != 0x00 && !s.accepts(remoteAddr) { // peripheral
+				l2c.Close()
+				continue
+			}
+			c := newConn(s, l2c, remoteAddr)
+			c.stats = func() ConnStats { return ConnStats(l2c.Stats()) }
+			c.channels = channelsOf(l2c)
+			c.readRSSI = rssiOf(l2c)
+			c.pair = pairOf(h.Pair, l2c, remoteAddr)
+			c.managePHY(l2c)
+			c.limitSignaling(l2c)
+			c.manageParams(l2c, l2c.Param.Role == 0x00)
+			if l2c.Param.Role == 0x00 { // central
+				// Handed over under d.mu, so that a Connect giving up
+				// either receives it, or leaves it to be dropped.
+				d.mu.Lock()
+				cc := d.connc
+				if cc != nil && (len(d.connPeer.HardwareAddr) == 0 || d.connPeer.same(remoteAddr)) {
+					d.connc = nil
+					cc <- c
+				} else {
+					cc = nil
+				}
+				d.mu.Unlock()
+				if cc == nil {
+					l2c.Close()
+					continue
+				}
+			}
+			done := make(chan struct{})
+			d.mu.Lock()
+			if d.conns == nil {
+				d.conns = make(map[*conn]chan struct{})
+			}
+			d.conns[c] = done
+			d.mu.Unlock()
+			d.wg.Add(1)
+			go func() {
+				defer d.wg.Done()
+				defer close(done)
+				s.connected(c)
+				c.loop()
+				s.disconnected(c)
+				d.mu.Lock()
+				delete(d.conns, c)
+				d.mu.Unlock()
+			}()
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// handover implements Handover.
+func (d *hciDevice) handover(ctx context.Context, id int) (Device, error) {
+	d.mu.Lock()
+	opts := d.opts
+	d.mu.Unlock()
+	opts.ID, opts.AdapterAddr, opts.UART = id, BDAddr{}, ""
+	return d.moveTo(ctx, opts)
+}
+
+// inspect implements Inspect.
+func (d *hciDevice) inspect() (DeviceState, error) {
+	d.mu.Lock()
+	h, next, ks := d.hci, d.next, d.opts.KeyStore
+	connecting := d.connc != nil
+	conns := make([]*conn, 0, len(d.conns))
+	for c := range d.conns {
+		conns = append(conns, c)
+	}
+	d.mu.Unlock()
+	if next != nil {
+		return Inspect(next)
+	}
+	if h == nil {
+		return DeviceState{}, ErrDeviceNotInitialized
+	}
+	st, now := h.Inspect(), time.Now()
+	s := DeviceState{
+		Advertising:     st.Advertising,
+		Scanning:        st.Scanning,
+		Connecting:      connecting || st.Initiating,
+		PendingCommands: []PendingCommand{},
+		QueuedPackets:   st.QueuedPackets,
+		HeldBuffers:     st.HeldBuffers,
+		Dropped:         st.Dropped,
+		Malformed:       st.Malformed,
+	}
+	for _, p := range st.PendingCommands {
+		s.PendingCommands = append(s.PendingCommands, PendingCommand{Name: p.Name, Opcode: p.Opcode, Waiting: waiting(p.Sent, now)})
+	}
+	s.addConns(conns)
+	s.listBonds(ks)
+	return s, nil
+}
+
+// moveTo hands d over to a new device, initialized with opts.
+func (d *hciDevice) moveTo(ctx context.Context, opts DeviceOptions) (Device, error) {
+	_, s, err := d.device()
+	if err != nil {
+		return nil, err
+	}
+	d.mu.Lock()
+	svcs := append([]*Service(nil), s.services...)
+	d.mu.Unlock()
+	s.subsmu.Lock()
+	subs := append([]connSub(nil), s.connSubs...)
+	pairingSubs := append([]pairingSub(nil), s.pairingSubs...)
+	s.subsmu.Unlock()
+
+	next := &hciDevice{srv: NewServer()}
+	if err := next.Init(ctx, opts); err != nil {
+		return nil, err
+	}
+	for _, svc := range svcs {
+		if err := next.AddService(svc); err != nil {
+			next.Stop(ctx)
+			return nil, err
+		}
+	}
+	next.srv.connSubs = subs
+	next.srv.pairingSubs = pairingSubs
+
+	d.mu.Lock()
+	if d.stopped {
+		// Stopped meanwhile.
+		d.mu.Unlock()
+		next.Stop(ctx)
+		return nil, ErrDeviceStopped
+	}
+	d.next = next
+	d.mu.Unlock()
+	// The adapter may well be dead already, and fail to disconnect the
+	// centrals; they are dropped regardless.
+	d.Stop(ctx)
+	return next, nil
+}
+
+// successor returns the device d was handed over to, if any.
+func (d *hciDevice) successor() Device {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.next
+}
+
+// switchIdentity implements SwitchIdentity.
+func (d *hciDevice) switchIdentity(ctx context.Context, name string) error {
+	_, s, err := d.device()
+	if err != nil {
+		return err
+	}
+	id, ok := d.opts.Identities[name]
+	if !ok {
+		return fmt.Errorf("gatt: no identity %q", name)
+	}
+	var addr [6]byte
+	if id.IRK != ([16]byte{}) {
+		a, err := newResolvablePrivateAddr(id.IRK)
+		if err != nil {
+			return err
+		}
+		copy(addr[:], a.HardwareAddr)
+	} else {
+		copy(addr[:], id.Addr.HardwareAddr)
+	}
+	appearance := id.Appearance
+	if appearance == 0 {
+		appearance = AppearanceGenericComputer
+	}
+
+	d.advmu.Lock()
+	defer d.advmu.Unlock()
+	d.mu.Lock()
+	if d.scanf != nil || d.connc != nil {
+		d.mu.Unlock()
+		return errors.New("cannot switch identities while scanning or connecting")
+	}
+	conns := make(map[*conn]chan struct{}, len(d.conns))
+	for c, done := range d.conns {
+		conns[c] = done
+	}
+	d.mu.Unlock()
+
+	// No central is to connect meanwhile, nor to read the values of
+	// the previous identity.
+	opts := d.advOpts
+	if opts != nil {
+		if err := s.adv.Stop(); err != nil {
+			return err
+		}
+	}
+	for c := range conns {
+		c.Close()
+	}
+	for _, done := range conns {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			if opts != nil {
+				s.adv.Start()
+			}
+			return ctx.Err()
+		}
+	}
+
+	d.mu.Lock()
+	d.identity = &id
+	d.mu.Unlock()
+	s.setIdentity(id.Name, appearance)
+	s.adv.Option(linux.RandomAddress(addr))
+	if opts == nil {
+		return nil
+	}
+	if err := d.setAdvertisement(s, *opts); err != nil {
+		return err
+	}
+	return s.adv.Start()
+}
+
+func (d *hciDevice) SubscribeConns(c chan ConnEvent, p SubscriptionPolicy) {
+	d.srv.SubscribeConns(c, p)
+}
+
+func (d *hciDevice) SubscribePairings(c chan PairingEvent, p SubscriptionPolicy) {
+	d.srv.SubscribePairings(c, p)
+}
+
+func (d *hciDevice) Stop(ctx context.Context) error {
+	d.mu.Lock()
+	h := d.hci
+	if h == nil {
+		d.mu.Unlock()
+		return ErrDeviceNotInitialized
+	}
+	if !d.stopped {
+		d.stopped = true
+		close(d.srv.quit)
+	}
+	d.mu.Unlock()
+
+	if err := h.Shutdown(ctx); err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
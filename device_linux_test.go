@@ -0,0 +1,76 @@
+package gatt
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/paypal/gatt/linux"
+	"github.com/paypal/gatt/linux/hcitest"
+)
+
+// userChannel opens scripted controllers in place of the adapter, one at
+// a time, as the kernel binds a single user channel to it: opened again
+// before the HCI holding it closes it, it is busy.
+type userChannel struct {
+	mu     sync.Mutex
+	bound  *hcitest.Controller
+	opened chan *hcitest.Controller
+}
+
+func (u *userChannel) openHCI(opts ...linux.HCIOption) (*linux.HCI, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.bound != nil {
+		return nil, errors.New("adapter busy")
+	}
+	c := hcitest.NewController()
+	u.bound = c
+	u.opened <- c
+	return linux.OpenHCI(append(opts, linux.Transport(boundController{c, u}))...)
+}
+
+// boundController unbinds the user channel as the HCI closes it.
+type boundController struct {
+	*hcitest.Controller
+	u *userChannel
+}
+
+func (b boundController) Close() error {
+	b.u.mu.Lock()
+	if b.u.bound == b.Controller {
+		b.u.bound = nil
+	}
+	b.u.mu.Unlock()
+	return b.Controller.Close()
+}
+
+func TestRecoverReopensAdapter(t *testing.T) {
+	u := &userChannel{opened: make(chan *hcitest.Controller, 4)}
+	defer func(f func(...linux.HCIOption) (*linux.HCI, error)) { openHCI = f }(openHCI)
+	openHCI = u.openHCI
+
+	recovered := make(chan Device, 1)
+	d := NewDevice()
+	err := d.Init(context.Background(), DeviceOptions{
+		Recover:         true,
+		RecoverInterval: 10 * time.Millisecond,
+		Recovered:       func(next Device) { recovered <- next },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	(<-u.opened).Close() // the controller crashes; the HCI holds on to it
+
+	select {
+	case next := <-recovered:
+		if err := next.Stop(context.Background()); err != nil {
+			t.Errorf("Stop of the recovered device = %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		d.Stop(context.Background())
+		t.Fatal("device not recovered: the failed adapter was reopened before being closed")
+	}
+}
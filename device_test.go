@@ -0,0 +1,134 @@
+package gatt
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestAdvertisementServices(t *testing.T) {
+	u128 := MustParseUUID("34DA3AD1-7110-41A1-B1EF-4430F509CDE7")
+	pkt, _ := serviceAdvertisingPacket([]UUID{UUID16(0x180D), u128})
+	a := &Advertisement{Data: append(pkt, 0x00, 0x00)} // zero padding
+	uu := a.Services()
+	if len(uu) != 2 || !uu[0].Equal(UUID16(0x180D)) || !uu[1].Equal(u128) {
+		t.Errorf("Services(): got %v, want [%v %v]", uu, UUID16(0x180D), u128)
+	}
+	if !a.HasService(MustParseUUID("0000180d-0000-1000-8000-00805f9b34fb")) {
+		t.Errorf("HasService: 128-bit form of %v not found", UUID16(0x180D))
+	}
+	if a.HasService(UUID16(0x180E)) {
+		t.Errorf("HasService(%v): got true, want false", UUID16(0x180E))
+	}
+}
+
+func TestSendConnEvent(t *testing.T) {
+	c := make(chan ConnEvent, 2)
+	for i := 0; i < 3; i++ {
+		deliver(c, DropNewest, ConnEvent{Connected: i%2 == 0})
+	}
+	if e := <-c; !e.Connected {
+		t.Errorf("DropNewest: got %+v first, want the first event", e)
+	}
+	<-c
+
+	for i := 0; i < 3; i++ {
+		deliver(c, DropOldest, ConnEvent{Connected: i%2 == 0})
+	}
+	if e := <-c; e.Connected {
+		t.Errorf("DropOldest: got %+v first, want the second event", e)
+	}
+	<-c
+
+	// Unbuffered, with no receiver: dropped rather than stuck.
+	deliver(make(chan ConnEvent), DropOldest, ConnEvent{})
+}
+
+func TestAddr(t *testing.T) {
+	addr := func(msb byte) BDAddr { return BDAddr{net.HardwareAddr{0x01, 0x02, 0x03, 0x04, 0x05, msb}} }
+	for _, tt := range []struct {
+		msb  byte
+		want AddrType
+	}{
+		{0xC5, AddrRandomStatic},
+		{0x45, AddrResolvablePrivate},
+		{0x05, AddrNonResolvablePrivate},
+	} {
+		if a := RandomAddr(addr(tt.msb)); a.Type != tt.want {
+			t.Errorf("RandomAddr(%v): got a %v address, want %v", a.BDAddr, a.Type, tt.want)
+		}
+	}
+
+	if err := PublicAddr(addr(0x05)).check(); err != nil {
+		t.Errorf("check of a public address: %v", err)
+	}
+	if err := RandomAddr(addr(0x45)).check(); err != nil {
+		t.Errorf("check of a resolvable private address: %v", err)
+	}
+	var e ErrInvalidParameter
+	if err := RandomAddr(addr(0x05)).check(); !errors.As(err, &e) {
+		t.Errorf("check of a non-resolvable private address: got %v, want an ErrInvalidParameter", err)
+	}
+	if err := (Addr{addr(0x45), AddrRandomStatic}).check(); err == nil {
+		t.Error("check of a resolvable private address typed as static: got no error")
+	}
+
+	// The same bytes, as a public and as a random address, are two devices.
+	if PublicAddr(addr(0xC5)).same(RandomAddr(addr(0xC5))) {
+		t.Error("same: a public address matches the random one of the same bytes")
+	}
+	if !RandomAddr(addr(0xC5)).same(Addr{addr(0xC5), AddrRandomStatic}) {
+		t.Error("same: a random address does not match itself")
+	}
+}
+
+func TestAcceptConn(t *testing.T) {
+	allowed := RandomAddr(BDAddr{net.HardwareAddr{0x01, 0x02, 0x03, 0x04, 0x05, 0xC6}})
+	other := PublicAddr(BDAddr{net.HardwareAddr{0x01, 0x02, 0x03, 0x04, 0x05, 0xC6}})
+	srv := NewServer(Name(""), HandlerErrors(func(err error) {}))
+	if !srv.accepts(other) {
+		t.Error("without AcceptConn: rejected")
+	}
+	srv.Option(AcceptConn(func(a Addr) bool { return a.same(allowed) }))
+	if !srv.accepts(allowed) || srv.accepts(other) {
+		t.Errorf("allow-list of %v: got %v and %v, want true and false", allowed, srv.accepts(allowed), srv.accepts(other))
+	}
+	srv.Option(AcceptConn(func(a Addr) bool { panic("policy") }))
+	if srv.accepts(allowed) {
+		t.Error("panicking AcceptConn: accepted")
+	}
+}
+
+func TestIdentity(t *testing.T) {
+	// The sample data of ah, in the Security Manager (Vol 3, Part H,
+	// D.7), least significant byte first.
+	irk := [16]byte{0x9b, 0x7d, 0x39, 0x0a, 0xa6, 0x10, 0x10, 0x34, 0x05, 0xad, 0xc8, 0x57, 0xa3, 0x34, 0x02, 0xec}
+	a := resolvablePrivateAddr(irk, [3]byte{0x94, 0x81, 0x70})
+	if want := (net.HardwareAddr{0xaa, 0xfb, 0x0d, 0x94, 0x81, 0x70}); !bytes.Equal(a.HardwareAddr, want) {
+		t.Errorf("resolvablePrivateAddr: got %v, want %v", a, want)
+	}
+	if a, err := newResolvablePrivateAddr(irk); err != nil || RandomAddr(a).Type != AddrResolvablePrivate {
+		t.Errorf("newResolvablePrivateAddr: got %v, %v, want a resolvable private address", a, err)
+	}
+
+	if err := (Identity{Addr: BDAddr{net.HardwareAddr{0x01, 0x02, 0x03, 0x04, 0x05, 0x45}}}).check("sku"); err == nil {
+		t.Error("check of an identity of a private address: got no error")
+	}
+
+	s := NewServer(Name("before"))
+	if err := s.setServices(); err != nil {
+		t.Fatal(err)
+	}
+	s.setIdentity("after", AppearanceGenericTag)
+	want := map[string][]byte{
+		gattAttrDeviceNameUUID.String(): []byte("after"),
+		gattAttrAppearanceUUID.String(): {0x00, 0x02},
+	}
+	for _, c := range s.gap.chars {
+		h, _ := s.handles.At(c.valuen)
+		if w, ok := want[c.uuid.String()]; ok && !bytes.Equal(h.value, w) {
+			t.Errorf("%v: got % X, want % X", c.uuid, h.value, w)
+		}
+	}
+}
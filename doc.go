@@ -30,9 +30,9 @@
 // Note that because gatt uses HCI_CHANNEL_USER, once gatt has opened the
 // device no other program may access it.
 //
-// Before starting a gatt program, make sure that your BLE device is down:
+// The kernel grants HCI_CHANNEL_USER only on a device that is down; gatt
+// takes it down as it opens it, as would
 //
-//     sudo hciconfig
 //     sudo hciconfig hci0 down  # or whatever hci device you want to use
 //
 // If you have BlueZ 5.14+ (or aren't sure), stop the built-in
@@ -0,0 +1,149 @@
+package gatt
+
+import "context"
+
+// A SubscriptionPolicy tells what happens to an event delivered on a
+// subscription channel that is full.
+type SubscriptionPolicy int
+
+const (
+	// DropNewest drops the event being delivered.
+	DropNewest SubscriptionPolicy = iota
+
+	// DropOldest drops the oldest event buffered by the channel, to make
+	// room for the one being delivered. It behaves like DropNewest on
+	// an unbuffered channel.
+	DropOldest
+
+	// BlockSend blocks until the channel has room. The connections, or
+	// the scan, delivering the events stall meanwhile.
+	BlockSend
+)
+
+// A ConnEvent is a connection, or a disconnection, of a Conn.
+type ConnEvent struct {
+	Conn      Conn
+	Connected bool // false once disconnected
+}
+
+// connSub is a subscription to the ConnEvents.
+type connSub struct {
+	c chan ConnEvent
+	p SubscriptionPolicy
+}
+
+// SubscribeConns delivers the ConnEvents on c, as an alternative to the
+// Connect and Disconnect callbacks. The capacity of c sets how many
+// events may be buffered; p tells what happens to those that do not
+// fit. c is never closed.
+func (s *Server) SubscribeConns(c chan ConnEvent, p SubscriptionPolicy) {
+	s.subsmu.Lock()
+	defer s.subsmu.Unlock()
+	s.connSubs = append(s.connSubs, connSub{c, p})
+}
+
+// accepts reports whether the central of address a, connected to the
+// server, is accepted by the AcceptConn function.
+func (s *Server) accepts(a Addr) bool {
+	if s.accept == nil {
+		return true
+	}
+	ok := false
+	s.call("accept", func() { ok = s.accept(a) })
+	return ok
+}
+
+// connected reports that c connected, to the PeerRegistry, the Connect
+// callback and the subscriptions.
+func (s *Server) connected(c Conn) {
+	s.trackPeer(c, true)
+	if s.connect != nil {
+		s.call("connect", func() { s.connect(c) })
+	}
+	s.publishConn(ConnEvent{Conn: c, Connected: true})
+}
+
+// disconnected reports that c disconnected, to the PeerRegistry, the
+// Disconnect callback and the subscriptions.
+func (s *Server) disconnected(c Conn) {
+	s.trackPeer(c, false)
+	if s.disconnect != nil {
+		s.call("disconnect", func() { s.disconnect(c) })
+	}
+	s.publishConn(ConnEvent{Conn: c})
+}
+
+func (s *Server) publishConn(e ConnEvent) {
+	s.subsmu.Lock()
+	subs := s.connSubs
+	s.subsmu.Unlock()
+	for _, sub := range subs {
+		deliver(sub.c, sub.p, e)
+	}
+}
+
+// A PairingEvent is the outcome of a pairing, by Pair: the bond of the
+// peer, or the error the pairing failed with.
+type PairingEvent struct {
+	Conn Conn
+	Bond Bond
+	Err  error
+}
+
+// pairingSub is a subscription to the PairingEvents.
+type pairingSub struct {
+	c chan PairingEvent
+	p SubscriptionPolicy
+}
+
+// SubscribePairings delivers the PairingEvents of the connections of the
+// server on c, as Pair returns. The capacity of c sets how many events
+// may be buffered; p tells what happens to those that do not fit. c is
+// never closed.
+func (s *Server) SubscribePairings(c chan PairingEvent, p SubscriptionPolicy) {
+	s.subsmu.Lock()
+	defer s.subsmu.Unlock()
+	s.pairingSubs = append(s.pairingSubs, pairingSub{c, p})
+}
+
+func (s *Server) publishPairing(e PairingEvent) {
+	s.subsmu.Lock()
+	subs := s.pairingSubs
+	s.subsmu.Unlock()
+	for _, sub := range subs {
+		deliver(sub.c, sub.p, e)
+	}
+}
+
+// deliver sends v on c, dropping v, or the oldest value buffered by c,
+// as p tells, should c be full.
+func deliver[T any](c chan T, p SubscriptionPolicy, v T) {
+	if p == BlockSend {
+		c <- v
+		return
+	}
+	for {
+		select {
+		case c <- v:
+			return
+		default:
+		}
+		if p != DropOldest || cap(c) == 0 {
+			return
+		}
+		select {
+		case <-c:
+		default:
+		}
+	}
+}
+
+// ScanChan scans with d, like Device.Scan, but delivers the
+// advertisements on c rather than to a callback. The capacity of c sets
+// how many advertisements may be buffered; p tells what happens to those
+// that do not fit. c is never closed.
+func ScanChan(ctx context.Context, d Device, opts ScanOptions, c chan *Advertisement, p SubscriptionPolicy) error {
+	return d.Scan(ctx, opts, func(a *Advertisement) {
+		deliver(c, p, a)
+	})
+}
@@ -0,0 +1,125 @@
+// Command collector is a central that collects the sensors advertising a
+// service, the Heart Rate service by default. It prints a summary of the
+// sensors seen every few seconds and, with -connect, connects to each of
+// them in turn and reports on the connection.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/paypal/gatt"
+)
+
+type sensor struct {
+	addr     gatt.Addr
+	rssi     int
+	seen     time.Time
+	reports  int
+	services []gatt.UUID
+}
+
+func main() {
+	dev := flag.Int("dev", -1, "index of the HCI device; negative selects one")
+	svc := flag.String("service", "180d", "UUID of the service the sensors advertise")
+	every := flag.Duration("every", 5*time.Second, "how often to print the summary")
+	connect := flag.Bool("connect", false, "connect to each sensor found, in turn")
+	flag.Parse()
+	u, err := gatt.ParseUUID(*svc)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	d := gatt.NewDevice()
+	if err := d.Init(ctx, gatt.DeviceOptions{ID: *dev}); err != nil {
+		log.Fatal(err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		d.Stop(ctx)
+	}()
+
+	var mu sync.Mutex
+	sensors := map[string]*sensor{}
+	found := make(chan *sensor, 16)
+	advs := make(chan *gatt.Advertisement, 64)
+	go gatt.ScanChan(ctx, d, gatt.ScanOptions{Active: true}, advs, gatt.DropOldest)
+
+	t := time.NewTicker(*every)
+	defer t.Stop()
+	for {
+		select {
+		case a := <-advs:
+			if !a.HasService(u) {
+				continue
+			}
+			mu.Lock()
+			s, ok := sensors[a.Addr.String()]
+			if !ok {
+				s = &sensor{addr: a.Addr, services: a.Services()}
+				sensors[a.Addr.String()] = s
+				if *connect {
+					found <- s
+				}
+			}
+			s.rssi, s.seen = a.RSSI, time.Now()
+			s.reports++
+			mu.Unlock()
+		case s := <-found:
+			// The advertisements received meanwhile are dropped, but
+			// for the latest ones.
+			report(ctx, d, s)
+		case <-t.C:
+			mu.Lock()
+			printSummary(sensors)
+			mu.Unlock()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func printSummary(sensors map[string]*sensor) {
+	keys := make([]string, 0, len(sensors))
+	for k := range sensors {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	fmt.Printf("%d sensors\n", len(keys))
+	for _, k := range keys {
+		s := sensors[k]
+		fmt.Printf("  %s rssi %4d, %5d reports, last %v ago, services %v\n",
+			s.addr, s.rssi, s.reports, time.Since(s.seen).Round(time.Second), s.services)
+	}
+}
+
+// report connects to the sensor, prints what the connection looks like,
+// and disconnects.
+func report(ctx context.Context, d gatt.Device, s *sensor) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	c, err := d.Connect(ctx, s.addr, gatt.ConnectOptions{})
+	if err != nil {
+		log.Printf("%s: %v", s.addr, err)
+		return
+	}
+	defer c.Close()
+	select {
+	case <-time.After(2 * time.Second):
+	case <-ctx.Done():
+	}
+	if r, ok := c.(gatt.StatsReporter); ok {
+		st := r.Stats()
+		log.Printf("%s: connected, mtu %d, rx %d bytes, latency %v", s.addr, c.MTU(), st.RxBytes, st.Latency)
+	}
+}
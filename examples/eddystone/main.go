@@ -0,0 +1,95 @@
+// Command eddystone is an Eddystone-URL broadcaster: it advertises a URL,
+// and serves no services.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/paypal/gatt"
+)
+
+func main() {
+	dev := flag.Int("dev", -1, "index of the HCI device; negative selects one")
+	url := flag.String("url", "https://github.com/paypal/gatt", "URL to broadcast")
+	power := flag.Int("power", -20, "calibrated transmit power, at 0 m, in dBm")
+	flag.Parse()
+	frame, err := urlFrame(*url, int8(*power))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	d := gatt.NewDevice()
+	if err := d.Init(ctx, gatt.DeviceOptions{ID: *dev}); err != nil {
+		log.Fatal(err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		d.Stop(ctx)
+	}()
+
+	log.Printf("broadcasting %s", *url)
+	err = d.Advertise(ctx, gatt.AdvertiseOptions{AdvertisingPacket: advertisingPacket(frame)})
+	if err != nil && err != context.Canceled {
+		log.Print(err)
+	}
+}
+
+// Eddystone URL scheme prefixes, and expansions of common suffixes.
+var (
+	schemes    = []string{"http://www.", "https://www.", "http://", "https://"}
+	expansions = []string{
+		".com/", ".org/", ".edu/", ".net/", ".info/", ".biz/", ".gov/",
+		".com", ".org", ".edu", ".net", ".info", ".biz", ".gov",
+	}
+)
+
+// urlFrame returns the Eddystone-URL frame of url.
+func urlFrame(url string, power int8) ([]byte, error) {
+	b := []byte{0x10, byte(power)} // frame type: URL
+	scheme := -1
+	for i, s := range schemes {
+		if strings.HasPrefix(url, s) && (scheme < 0 || len(s) > len(schemes[scheme])) {
+			scheme = i
+		}
+	}
+	if scheme < 0 {
+		return nil, errors.New("eddystone: the URL must start with http:// or https://")
+	}
+	b = append(b, byte(scheme))
+	for rest := url[len(schemes[scheme]):]; rest != ""; {
+		n := 1
+		c := rest[0]
+		for i, e := range expansions {
+			if strings.HasPrefix(rest, e) {
+				n, c = len(e), byte(i)
+				break
+			}
+		}
+		b = append(b, c)
+		rest = rest[n:]
+	}
+	if len(b) > 20 {
+		return nil, errors.New("eddystone: the encoded URL is longer than 17 bytes")
+	}
+	return b, nil
+}
+
+// advertisingPacket returns the advertising packet of an Eddystone frame.
+func advertisingPacket(frame []byte) []byte {
+	b := []byte{
+		0x02, 0x01, 0x06, // flags: LE general discoverable, BR/EDR not supported
+		0x03, 0x03, 0xAA, 0xFE, // complete list of 16-bit UUIDs: Eddystone
+		byte(3 + len(frame)), 0x16, 0xAA, 0xFE, // service data: Eddystone
+	}
+	return append(b, frame...)
+}
@@ -0,0 +1,88 @@
+// Command heartrate is a heart rate monitor peripheral. It serves the
+// Heart Rate service, and notifies subscribed centrals of a simulated
+// heart rate every second.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"math/rand"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/paypal/gatt"
+	"github.com/paypal/gatt/value"
+)
+
+var (
+	heartRateService     = gatt.UUID16(0x180D)
+	heartRateMeasurement = gatt.UUID16(0x2A37)
+	bodySensorLocation   = gatt.UUID16(0x2A38)
+)
+
+func main() {
+	dev := flag.Int("dev", -1, "index of the HCI device; negative selects one")
+	name := flag.String("name", "gatt-hrm", "device name")
+	flag.Parse()
+
+	svc, err := gatt.NewService(heartRateService).
+		AddCharacteristic(heartRateMeasurement).
+		EnableNotify(gatt.NotifyHandlerFunc(notifyHeartRate)).
+		SetNotifyPolicy(gatt.NotifyLatest).
+		AddCharacteristic(bodySensorLocation).
+		SetReadHandler(gatt.ReadHandlerFunc(func(resp gatt.ReadResponseWriter, req *gatt.ReadRequest) {
+			resp.Write([]byte{0x02}) // wrist
+		})).
+		Build()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	d := gatt.NewDevice()
+	if err := d.Init(ctx, gatt.DeviceOptions{
+		ID:         *dev,
+		Name:       *name,
+		Connect:    func(c gatt.Conn) { log.Printf("%s connected", c.RemoteAddr()) },
+		Disconnect: func(c gatt.Conn) { log.Printf("%s disconnected", c.RemoteAddr()) },
+	}); err != nil {
+		log.Fatal(err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		d.Stop(ctx)
+	}()
+	if err := d.AddService(svc); err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("advertising as %q", *name)
+	err = d.Advertise(ctx, gatt.AdvertiseOptions{AdvertiseServices: []gatt.UUID{heartRateService}})
+	if err != nil && err != context.Canceled {
+		log.Print(err)
+	}
+}
+
+// notifyHeartRate sends a Heart Rate Measurement every second, until the
+// central unsubscribes. The handler must return, so the measurements are
+// sent by a goroutine of their own.
+func notifyHeartRate(r gatt.Request, n gatt.Notifier) {
+	go func() {
+		bpm := 70
+		for !n.Done() {
+			bpm += rand.Intn(5) - 2
+			if bpm < 50 || bpm > 180 {
+				bpm = 70
+			}
+			b, _ := value.HeartRateMeasurement{BPM: bpm}.MarshalBinary()
+			if _, err := n.Write(b); err != nil {
+				log.Printf("notify: %v", err)
+			}
+			time.Sleep(time.Second)
+		}
+	}()
+}
@@ -0,0 +1,80 @@
+package gatt
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+// discardConn is an L2CAP connection writing nowhere, for the PDUs to be
+// served in the calling goroutine rather than by the loop of the
+// connection.
+type discardConn struct{}
+
+func (discardConn) Read(b []byte) (int, error)  { return 0, io.EOF }
+func (discardConn) Write(b []byte) (int, error) { return len(b), nil }
+func (discardConn) Close() error                { return nil }
+
+// fuzzServer returns a server with characteristics of every kind, for the
+// PDUs fuzzed to reach their handlers.
+func fuzzServer() *Server {
+	srv := NewServer(Name("fuzz"), TraceATT(func(string, ...interface{}) {}, func(u UUID) bool { return u.Len() == 16 }))
+	svc := srv.AddService(MustParseUUID("09fc95c0-c111-11e3-9904-0002a5d5c51b"))
+	svc.AddCharacteristic(MustParseUUID("11fac9e0-c111-11e3-9246-0002a5d5c51b")).HandleReadFunc(
+		func(resp ReadResponseWriter, req *ReadRequest) {
+			resp.Write(make([]byte, 600))
+		})
+	svc.AddCharacteristic(MustParseUUID("16fe0d80-c111-11e3-b8c8-0002a5d5c51b")).HandleWriteFunc(
+		func(r Request, data []byte) (status byte) {
+			return StatusSuccess
+		})
+	svc.AddCharacteristic(MustParseUUID("1c927b50-c116-11e3-8a33-0800200c9a66")).HandleNotifyFunc(
+		func(r Request, n Notifier) {})
+	srv.setServices()
+	return srv
+}
+
+// FuzzATT feeds ATT PDUs, received from the peer, to the server, and to
+// the client, of a connection, as its loop does. Each input is a sequence
+// of PDUs, each preceded by its length.
+func FuzzATT(f *testing.F) {
+	for _, pdus := range [][]byte{
+		{attOpMtuReq, 0x17, 0x00},
+		{attOpFindInfoReq, 0x01, 0x00, 0xFF, 0xFF},
+		{attOpFindByTypeReq, 0x01, 0x00, 0xFF, 0xFF, 0x00, 0x28, 0x00, 0x18},
+		{attOpReadByTypeReq, 0x01, 0x00, 0xFF, 0xFF, 0x03, 0x28},
+		{attOpReadByGroupReq, 0x01, 0x00, 0xFF, 0xFF, 0x00, 0x28},
+		{attOpReadReq, 0x0C, 0x00},
+		{attOpReadBlobReq, 0x0C, 0x00, 0x40, 0x00},
+		{attOpWriteReq, 0x0E, 0x00, 'g', 'a', 't', 't'},
+		{attOpWriteCmd, 0x0E, 0x00, 'g', 'a', 't', 't'},
+		{attOpPrepWriteReq, 0x0E, 0x00, 0x00, 0x00, 'g', 'a'},
+		{attOpExecWriteReq, 0x01},
+		{attOpWriteReq, 0x11, 0x00, 0x01, 0x00}, // subscribe
+		{attOpHandleNotify, 0x0C, 0x00, 0x01},
+		{attOpHandleCnf},
+
+		// Found by the fuzzer: truncated, with an empty value, and with an
+		// inverted range.
+		{attOpMtuReq, 0x17},
+		{attOpFindByTypeReq, 0x01, 0x00, 0xFF, 0xFF, 0x00, 0x28},
+		{attOpFindInfoReq, 0x05, 0x00, 0x01, 0x00},
+	} {
+		f.Add(append([]byte{byte(len(pdus))}, pdus...))
+	}
+	srv := fuzzServer()
+	f.Fuzz(func(t *testing.T, b []byte) {
+		c := newConn(srv, discardConn{}, Addr{})
+		defer c.close()
+		for len(b) > 0 {
+			n := int(b[0])
+			if b = b[1:]; n > len(b) {
+				n = len(b)
+			}
+			if pdu := b[:n]; n > 0 && !c.handleClient(pdu, time.Now()) {
+				c.serveReq(pdu)
+			}
+			b = b[n:]
+		}
+	})
+}
@@ -0,0 +1,179 @@
+package gatt
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"time"
+)
+
+// Appearances of the device, exposed by the Appearance characteristic of
+// the Generic Access service. See the Assigned Numbers of the Bluetooth
+// SIG for the others.
+const (
+	AppearanceUnknown         = 0x0000
+	AppearanceGenericPhone    = 0x0040
+	AppearanceGenericComputer = 0x0080
+	AppearanceGenericWatch    = 0x00C0
+	AppearanceGenericTag      = 0x0200
+	AppearanceGenericSensor   = 0x0540
+)
+
+// Appearance sets the appearance of the device, exposed via the Generic
+// Access Service (0x1800). The default is AppearanceGenericComputer.
+// See also Server.NewServer.
+// Appearance cannot be used with Server.Option.
+func Appearance(a uint16) option {
+	return func(s *Server) option {
+		prev := s.appearance
+		s.appearance = a
+		return Appearance(prev)
+	}
+}
+
+// PreferredConnParams sets the parameters of the connections preferred by
+// the device, as the peripheral, exposed via the Peripheral Preferred
+// Connection Parameters characteristic of the Generic Access Service, for
+// centrals to connect with. The characteristic is left out by default.
+//
+// Once connected as the peripheral, the device requests them from the
+// centrals that have not applied them within TGAP(conn_pause_peripheral),
+// 5 s; with a ConnPolicy, only for the connections it assigns no class.
+// See also Server.NewServer.
+// PreferredConnParams cannot be used with Server.Option.
+func PreferredConnParams(p ConnParams) option {
+	return func(s *Server) option {
+		prev := s.preferredParams
+		s.preferredParams = p
+		return PreferredConnParams(prev)
+	}
+}
+
+// defaultServices returns the Generic Access and Generic Attribute
+// services, mandatory on every device, but for those the application
+// declares itself, which replace them.
+func (s *Server) defaultServices() []*Service {
+	var gap, gatt bool
+	for _, svc := range s.services {
+		gap = gap || svc.uuid.Equal(gatAttrGAPUUID)
+		gatt = gatt || svc.uuid.Equal(gatAttrGATTUUID)
+	}
+	var svcs []*Service
+	s.gap = nil
+	if !gap {
+		s.gap = s.gapService()
+		svcs = append(svcs, s.gap)
+	}
+	if !gatt {
+		svcs = append(svcs, s.gattService())
+	}
+	return svcs
+}
+
+func (s *Server) gapService() *Service {
+	appearance := make([]byte, 2)
+	binary.LittleEndian.PutUint16(appearance, s.appearance)
+	svc := &Service{
+		uuid: gatAttrGAPUUID,
+		chars: []*Characteristic{
+			&Characteristic{
+				uuid:   gattAttrDeviceNameUUID,
+				props:  charRead,
+				secure: charRead,
+				value:  []byte(s.name),
+			},
+			&Characteristic{
+				uuid:   gattAttrAppearanceUUID,
+				props:  charRead,
+				secure: charRead,
+				value:  appearance,
+			},
+		},
+	}
+	if p := s.preferredParams; p != (ConnParams{}) {
+		// In units of 1.25 ms for the interval, and of 10 ms for the
+		// timeout.
+		v := make([]byte, 8)
+		binary.LittleEndian.PutUint16(v[0:], uint16(p.IntervalMin/(1250*time.Microsecond)))
+		binary.LittleEndian.PutUint16(v[2:], uint16(p.IntervalMax/(1250*time.Microsecond)))
+		binary.LittleEndian.PutUint16(v[4:], uint16(p.Latency))
+		binary.LittleEndian.PutUint16(v[6:], uint16(p.SupervisionTimeout/(10*time.Millisecond)))
+		svc.chars = append(svc.chars, &Characteristic{
+			uuid:   gattAttrPeripheralPreferredConnParamsUUID,
+			props:  charRead,
+			secure: charRead,
+			value:  v,
+		})
+	}
+	return svc
+}
+
+// setIdentity sets the name and the appearance of the device, and the
+// values of the Device Name and Appearance characteristics of the
+// default Generic Access service, if served. It must not be called while
+// connections are served, which read the values.
+func (s *Server) setIdentity(name string, appearance uint16) {
+	s.name, s.appearance = name, appearance
+	if s.gap == nil || s.handles == nil {
+		return
+	}
+	for _, c := range s.gap.chars {
+		switch {
+		case c.uuid.Equal(gattAttrDeviceNameUUID):
+			c.value = []byte(name)
+		case c.uuid.Equal(gattAttrAppearanceUUID):
+			c.value = make([]byte, 2)
+			binary.LittleEndian.PutUint16(c.value, appearance)
+		default:
+			continue
+		}
+		if i := s.handles.idx(int(c.valuen)); i >= 0 {
+			s.handles.hh[i].value = c.value
+		}
+	}
+}
+
+func (s *Server) gattService() *Service {
+	svc := &Service{uuid: gatAttrGATTUUID}
+	svc.chars = []*Characteristic{&Characteristic{
+		uuid:     gattAttrServiceChangedUUID,
+		props:    charIndicate,
+		secure:   charIndicate,
+		nhandler: NotifyHandlerFunc(s.serveServiceChanged),
+		service:  svc,
+	}}
+	return svc
+}
+
+// serveServiceChanged indicates to the centrals subscribing to the Service
+// Changed characteristic that the handles of the whole database may have
+// changed since they last discovered them, unless the handle layout of the
+// server tells otherwise, so that they discover them again rather than use
+// those cached.
+func (s *Server) serveServiceChanged(r Request, n Notifier) {
+	if !s.dbChanged {
+		return
+	}
+	// Not from the goroutine serving the connection, which delivers the
+	// confirmation.
+	go func() {
+		if _, err := n.Write([]byte{0x01, 0x00, 0xFF, 0xFF}); err != nil && !n.Done() {
+			s.report(fmt.Errorf("gatt: service changed: %v", err))
+		}
+	}()
+}
+
+// dbHash returns a hash of the handles of the database, their types,
+// UUIDs and properties, folded to fit in a handle layout.
+func dbHash(r *handleRange) uint16 {
+	h := fnv.New32a()
+	b := make([]byte, 5)
+	for _, hh := range r.hh {
+		binary.LittleEndian.PutUint16(b, hh.n)
+		b[2], b[3], b[4] = byte(hh.typ), byte(hh.props), byte(hh.secure)
+		h.Write(b)
+		h.Write(hh.uuid.b)
+	}
+	v := h.Sum32()
+	return uint16(v) ^ uint16(v>>16)
+}
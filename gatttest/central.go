@@ -0,0 +1,229 @@
+// Package gatttest provides a virtual central, scripted by the tests of
+// GATT services, so that the handlers of the application are tested
+// without radio hardware: it connects, in process, to a Server, discovers
+// its services, and reads, writes and subscribes to their
+// characteristics through real ATT PDUs, failing the test as the
+// responses differ from those expected:
+//
+//	func TestCounter(t *testing.T) {
+//		svc, err := gatt.NewService(svcUUID).
+//			AddCharacteristic(countUUID).SetReadHandler(count).EnableNotify(countNotify).
+//			AddCharacteristic(resetUUID).SetWriteHandler(reset).
+//			Build()
+//		...
+//		c := gatttest.Serve(t, svc)
+//		c.ExpectRead(countUUID, []byte{0})
+//		n := c.Subscribe(countUUID)
+//		n.Expect([]byte{1})
+//		c.Write(resetUUID, []byte{1})
+//		c.ExpectWriteError(resetUUID, nil, gatt.StatusUnexpectedError)
+//	}
+//
+// Conversely, a Recorder captures the sessions of an application, as a
+// client, with the devices of third parties, for Replay to play them
+// back to it in tests, without the devices.
+package gatttest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/paypal/gatt"
+)
+
+// peerAddr is the address of the virtual peers.
+var peerAddr = gatt.PublicAddr(gatt.BDAddr{HardwareAddr: []byte{0xC0, 0xFF, 0xEE, 0xC0, 0xFF, 0xEE}})
+
+// DefaultTimeout is how long a Central waits for each response, or
+// value notified, by default.
+const DefaultTimeout = 5 * time.Second
+
+// A Central is a virtual central, connected to a Server in process. Its
+// methods fail the test, with t.Fatalf, as the server responds
+// otherwise than expected.
+type Central struct {
+	// Client issues the requests of the central, for the tests going
+	// beyond the methods of Central.
+	Client *gatt.Client
+
+	// Services are those discovered as the central connected.
+	Services []*gatt.RemoteService
+
+	// Timeout bounds each request; DefaultTimeout if zero.
+	Timeout time.Duration
+
+	t testing.TB
+}
+
+// Serve serves svcs, built with gatt.NewService, with a server of its
+// own, and connects a Central to it.
+func Serve(t testing.TB, svcs ...*gatt.Service) *Central {
+	t.Helper()
+	return Connect(t, gatt.NewServer(), svcs...)
+}
+
+// Connect connects a Central to the server s, which must not be serving,
+// and discovers its services, along with svcs, served as those of
+// Server.Loopback. The central is disconnected as the test completes.
+func Connect(t testing.TB, s *gatt.Server, svcs ...*gatt.Service) *Central {
+	t.Helper()
+	cl, err := s.Loopback(peerAddr, svcs...)
+	if err != nil {
+		t.Fatalf("gatttest: connecting: %v", err)
+	}
+	t.Cleanup(func() { cl.Conn().Close() })
+	c := &Central{Client: cl, t: t}
+	ctx, cancel := c.context()
+	defer cancel()
+	if c.Services, err = cl.DiscoverServices(ctx); err != nil {
+		t.Fatalf("gatttest: discovering services: %v", err)
+	}
+	return c
+}
+
+func (c *Central) context() (context.Context, context.CancelFunc) {
+	d := c.Timeout
+	if d == 0 {
+		d = DefaultTimeout
+	}
+	return context.WithTimeout(context.Background(), d)
+}
+
+// Characteristic returns the first characteristic of UUID u discovered.
+func (c *Central) Characteristic(u gatt.UUID) *gatt.RemoteCharacteristic {
+	c.t.Helper()
+	for _, s := range c.Services {
+		for _, ch := range s.Characteristics {
+			if ch.UUID.Equal(u) {
+				return ch
+			}
+		}
+	}
+	c.t.Fatalf("gatttest: no characteristic %v", u)
+	return nil
+}
+
+// Read reads the value of the characteristic of UUID u.
+func (c *Central) Read(u gatt.UUID) []byte {
+	c.t.Helper()
+	v, err := c.read(u)
+	if err != nil {
+		c.t.Fatalf("gatttest: reading %v: %v", u, err)
+	}
+	return v
+}
+
+// ExpectRead reads the value of the characteristic of UUID u, and
+// checks that it is want.
+func (c *Central) ExpectRead(u gatt.UUID, want []byte) {
+	c.t.Helper()
+	if v := c.Read(u); !bytes.Equal(v, want) {
+		c.t.Fatalf("gatttest: read %v: got [% X], want [% X]", u, v, want)
+	}
+}
+
+// ExpectReadError reads the characteristic of UUID u, and checks that
+// the server responds with an error of status.
+func (c *Central) ExpectReadError(u gatt.UUID, status byte) {
+	c.t.Helper()
+	v, err := c.read(u)
+	c.expectError("read", u, err, status, v)
+}
+
+func (c *Central) read(u gatt.UUID) ([]byte, error) {
+	c.t.Helper()
+	ch := c.Characteristic(u)
+	ctx, cancel := c.context()
+	defer cancel()
+	return c.Client.Read(ctx, ch.ValueHandle)
+}
+
+// Write writes v to the characteristic of UUID u, with a Write Request.
+func (c *Central) Write(u gatt.UUID, v []byte) {
+	c.t.Helper()
+	if err := c.write(u, v); err != nil {
+		c.t.Fatalf("gatttest: writing [% X] to %v: %v", v, u, err)
+	}
+}
+
+// ExpectWriteError writes v to the characteristic of UUID u, and checks
+// that the server responds with an error of status.
+func (c *Central) ExpectWriteError(u gatt.UUID, v []byte, status byte) {
+	c.t.Helper()
+	c.expectError("write", u, c.write(u, v), status, nil)
+}
+
+func (c *Central) write(u gatt.UUID, v []byte) error {
+	c.t.Helper()
+	ch := c.Characteristic(u)
+	ctx, cancel := c.context()
+	defer cancel()
+	return c.Client.Write(ctx, ch.ValueHandle, v, false)
+}
+
+func (c *Central) expectError(op string, u gatt.UUID, err error, status byte, v []byte) {
+	c.t.Helper()
+	var e *gatt.ATTError
+	switch {
+	case err == nil:
+		c.t.Fatalf("gatttest: %s %v: got success [% X], want error 0x%02X", op, u, v, status)
+	case !errors.As(err, &e):
+		c.t.Fatalf("gatttest: %s %v: got %v, want error 0x%02X", op, u, err, status)
+	case e.Status != status:
+		c.t.Fatalf("gatttest: %s %v: got error 0x%02X, want 0x%02X", op, u, e.Status, status)
+	}
+}
+
+// A Subscription is the values a characteristic notifies, or indicates,
+// the central with, as subscribed to by Central.Subscribe.
+type Subscription struct {
+	c      *Central
+	u      gatt.UUID
+	values chan []byte
+}
+
+// Subscribe subscribes to the notifications, or indications, of the
+// characteristic of UUID u.
+func (c *Central) Subscribe(u gatt.UUID) *Subscription {
+	c.t.Helper()
+	ch := c.Characteristic(u)
+	s := &Subscription{c: c, u: u, values: make(chan []byte, 64)}
+	ctx, cancel := c.context()
+	defer cancel()
+	err := c.Client.Subscribe(ctx, ch, func(v []byte) {
+		select {
+		case s.values <- append([]byte(nil), v...):
+		default: // not expected by the test
+		}
+	})
+	if err != nil {
+		c.t.Fatalf("gatttest: subscribing to %v: %v", u, err)
+	}
+	return s
+}
+
+// Next returns the next value notified, waiting for it for up to the
+// Timeout of the central.
+func (s *Subscription) Next() []byte {
+	s.c.t.Helper()
+	ctx, cancel := s.c.context()
+	defer cancel()
+	select {
+	case v := <-s.values:
+		return v
+	case <-ctx.Done():
+		s.c.t.Fatalf("gatttest: %v notified nothing", s.u)
+		return nil
+	}
+}
+
+// Expect checks that the next value notified is want.
+func (s *Subscription) Expect(want []byte) {
+	s.c.t.Helper()
+	if v := s.Next(); !bytes.Equal(v, want) {
+		s.c.t.Fatalf("gatttest: %v notified [% X], want [% X]", s.u, v, want)
+	}
+}
@@ -0,0 +1,62 @@
+package gatttest
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/paypal/gatt"
+)
+
+var (
+	svcUUID   = gatt.MustParseUUID("09fc95c0-c111-11e3-9904-0002a5d5c51b")
+	countUUID = gatt.MustParseUUID("11fac9e0-c111-11e3-9246-0002a5d5c51b")
+	resetUUID = gatt.MustParseUUID("16fe0d80-c111-11e3-b8c8-0002a5d5c51b")
+)
+
+func counter(t *testing.T) *gatt.Service {
+	var (
+		mu sync.Mutex
+		n  byte
+		nc = make(chan gatt.Notifier, 1)
+	)
+	svc, err := gatt.NewService(svcUUID).
+		AddCharacteristic(countUUID).
+		SetReadHandler(gatt.ReadHandlerFunc(func(resp gatt.ReadResponseWriter, req *gatt.ReadRequest) {
+			mu.Lock()
+			defer mu.Unlock()
+			resp.Write([]byte{n})
+		})).
+		EnableNotify(gatt.NotifyHandlerFunc(func(r gatt.Request, ntf gatt.Notifier) { nc <- ntf })).
+		AddCharacteristic(resetUUID).
+		SetWriteHandler(gatt.WriteHandlerFunc(func(r gatt.Request, data []byte) byte {
+			if len(data) != 1 {
+				return gatt.StatusUnexpectedError
+			}
+			mu.Lock()
+			n = data[0]
+			mu.Unlock()
+			select {
+			case ntf := <-nc:
+				ntf.Write(data)
+				nc <- ntf
+			default:
+			}
+			return gatt.StatusSuccess
+		})).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return svc
+}
+
+func TestCentral(t *testing.T) {
+	c := Serve(t, counter(t))
+	c.ExpectRead(countUUID, []byte{0})
+	n := c.Subscribe(countUUID)
+	c.Write(resetUUID, []byte{7})
+	n.Expect([]byte{7})
+	c.ExpectRead(countUUID, []byte{7})
+	c.ExpectWriteError(resetUUID, nil, gatt.StatusUnexpectedError)
+	c.ExpectReadError(resetUUID, 0x02) // read not permitted
+}
@@ -0,0 +1,182 @@
+package gatttest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/paypal/gatt"
+)
+
+// A Recorder records the ATT PDUs of the connections of a Device, or a
+// Server, as the transcripts Replay serves back, e.g. those of a session
+// with the device of a third party, captured once, and checked in:
+//
+//	rec := new(gatttest.Recorder)
+//	d, err := gatt.NewDevice(gatt.DeviceOptions{RecordATT: rec.Record})
+//	...
+//	c, err := d.Connect(ctx, thermometer)
+//	... discover, read and subscribe, as the application does ...
+//	err = os.WriteFile("testdata/thermometer.att", rec.Transcript(c), 0o644)
+//
+// A transcript is text, one PDU per line, in hexadecimal, after "send" for
+// those sent, or "recv" for those received; blank lines, and those
+// starting with #, are skipped, for the transcripts to be annotated.
+type Recorder struct {
+	mu    sync.Mutex
+	lines map[gatt.Conn]*bytes.Buffer
+}
+
+// Record records the PDU b, of the connection c. It is a RecordATT
+// function.
+func (r *Recorder) Record(c gatt.Conn, sent bool, b []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.lines == nil {
+		r.lines = map[gatt.Conn]*bytes.Buffer{}
+	}
+	l := r.lines[c]
+	if l == nil {
+		l = new(bytes.Buffer)
+		fmt.Fprintf(l, "# %v\n", c.RemoteAddr())
+		r.lines[c] = l
+	}
+	fmt.Fprintf(l, "%s %X\n", pduDir(sent), b)
+}
+
+// Transcript returns the transcript of the connection c, recorded so far.
+func (r *Recorder) Transcript(c gatt.Conn) []byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if b := r.lines[c]; b != nil {
+		return append([]byte(nil), b.Bytes()...)
+	}
+	return nil
+}
+
+// A pdu is a line of a transcript.
+type pdu struct {
+	sent bool
+	b    []byte
+	line int
+}
+
+func parseTranscript(transcript []byte) ([]pdu, error) {
+	var pdus []pdu
+	sc := bufio.NewScanner(bytes.NewReader(transcript))
+	for n := 1; sc.Scan(); n++ {
+		l := strings.TrimSpace(sc.Text())
+		if l == "" || l[0] == '#' {
+			continue
+		}
+		f := strings.Fields(l)
+		if len(f) != 2 || f[0] != "send" && f[0] != "recv" {
+			return nil, fmt.Errorf("line %d: %q, want send, or recv, and a PDU", n, l)
+		}
+		b, err := hex.DecodeString(f[1])
+		if err != nil || len(b) == 0 {
+			return nil, fmt.Errorf("line %d: malformed PDU %q", n, f[1])
+		}
+		pdus = append(pdus, pdu{sent: f[0] == "send", b: b, line: n})
+	}
+	return pdus, sc.Err()
+}
+
+// Replay returns a Client of a peer played back from transcript, as
+// recorded by a Recorder, so that the application is tested against the
+// device recorded without it: the PDUs received are read by the Client in
+// turn, each once the PDUs recorded as sent before it have been sent
+// again. The test fails as the Client sends a PDU other than that
+// recorded next, which fails the request, or, as the test completes,
+// leaves PDUs of the transcript unplayed. The Client is disconnected as
+// the test completes.
+func Replay(t testing.TB, transcript []byte) *gatt.Client {
+	t.Helper()
+	pdus, err := parseTranscript(transcript)
+	if err != nil {
+		t.Fatalf("gatttest: transcript: %v", err)
+	}
+	p := &player{t: t, pdus: pdus}
+	p.cond = sync.NewCond(&p.mu)
+	cl, err := gatt.NewServer(gatt.Name("")).Attach(p, peerAddr)
+	if err != nil {
+		t.Fatalf("gatttest: replaying: %v", err)
+	}
+	t.Cleanup(func() {
+		cl.Conn().Close()
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if len(p.pdus) > 0 {
+			t.Errorf("gatttest: %d PDUs of the transcript left unplayed, from line %d", len(p.pdus), p.pdus[0].line)
+		}
+	})
+	return cl
+}
+
+// A player plays a transcript back, as the link of a connection.
+type player struct {
+	t      testing.TB
+	mu     sync.Mutex
+	cond   *sync.Cond // signaled as pdus, or closed, change
+	pdus   []pdu      // yet to be played
+	closed bool
+}
+
+// Read returns the next PDU received, once those sent before it have
+// been.
+func (p *player) Read(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for !p.closed && (len(p.pdus) == 0 || p.pdus[0].sent) {
+		p.cond.Wait()
+	}
+	if p.closed {
+		return 0, io.EOF
+	}
+	n := copy(b, p.pdus[0].b)
+	p.pdus = p.pdus[1:]
+	p.cond.Broadcast()
+	return n, nil
+}
+
+// Write checks that b is the next PDU sent.
+func (p *player) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return 0, io.ErrClosedPipe
+	}
+	if len(p.pdus) == 0 || !p.pdus[0].sent || !bytes.Equal(p.pdus[0].b, b) {
+		msg := fmt.Sprintf("gatttest: sent %X, not in the transcript", b)
+		if len(p.pdus) > 0 {
+			msg += fmt.Sprintf(": want line %d, %s %X", p.pdus[0].line, pduDir(p.pdus[0].sent), p.pdus[0].b)
+		}
+		p.t.Error(msg)
+		return 0, errors.New(msg)
+	}
+	p.pdus = p.pdus[1:]
+	p.cond.Broadcast()
+	return len(b), nil
+}
+
+func (p *player) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	p.cond.Broadcast()
+	return nil
+}
+
+// pduDir returns the direction of a PDU, as in the transcripts.
+func pduDir(sent bool) string {
+	if sent {
+		return "send"
+	}
+	return "recv"
+}
@@ -0,0 +1,70 @@
+package gatttest
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/paypal/gatt"
+)
+
+func TestRecordReplay(t *testing.T) {
+	// Record the session of a central with the server, as the server
+	// sees it: the client sees it the other way around.
+	rec := new(Recorder)
+	var sc gatt.Conn
+	s := gatt.NewServer(gatt.RecordATT(rec.Record), gatt.Connect(func(c gatt.Conn) { sc = c }))
+	c := Connect(t, s, counter(t))
+	c.ExpectRead(countUUID, []byte{0})
+	c.Write(resetUUID, []byte{7})
+	c.Client.Conn().Close()
+	tr := strings.NewReplacer("send ", "recv ", "recv ", "send ").Replace(string(rec.Transcript(sc)))
+
+	cl := Replay(t, []byte(tr))
+	ctx := context.Background()
+	svcs, err := cl.DiscoverServices(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chars := svcs[len(svcs)-1].Characteristics
+	if v, err := cl.Read(ctx, chars[0].ValueHandle); err != nil || !bytes.Equal(v, []byte{0}) {
+		t.Errorf("Read replayed = [% X], %v, want [00]", v, err)
+	}
+	if err := cl.Write(ctx, chars[1].ValueHandle, []byte{7}, false); err != nil {
+		t.Errorf("Write replayed = %v", err)
+	}
+}
+
+func TestReplayMismatch(t *testing.T) {
+	ft := &fakeT{TB: t}
+	cl := Replay(ft, []byte("# a read\nsend 0A0300\nrecv 0B2A\n"))
+	if _, err := cl.Read(context.Background(), 0x0004); err == nil {
+		t.Error("Read of a handle other than recorded succeeded")
+	}
+	if !ft.Failed() {
+		t.Error("Read of a handle other than recorded did not fail the test")
+	}
+}
+
+// fakeT records the failures of a test, rather than failing it.
+type fakeT struct {
+	testing.TB
+	mu     sync.Mutex
+	failed bool
+}
+
+func (t *fakeT) Error(args ...interface{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.failed = true
+}
+
+func (t *fakeT) Errorf(format string, args ...interface{}) { t.Error() }
+
+func (t *fakeT) Failed() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.failed
+}
@@ -1,5 +1,7 @@
 package gatt
 
+import "sort"
+
 type handleType int
 
 const (
@@ -33,23 +35,22 @@ type handle struct {
 // isPrimaryService reports whether this handle is
 // the primary service with uuid uuid.
 func (h handle) isPrimaryService(uuid UUID) bool {
-	return h.typ == typService && uuidEqual(uuid, h.uuid)
+	return h.typ == typService && uuid.Equal(h.uuid)
 }
 
 // isCharacteristic reports whether this handle is the
 // characteristic with uuid uuid.
 func (h handle) isCharacteristic(uuid UUID) bool {
-	return h.typ == typCharacteristic && uuidEqual(uuid, h.uuid)
+	return h.typ == typCharacteristic && uuid.Equal(h.uuid)
 }
 
 // isDescriptor reports whether this handle is the
 // descriptor with uuid uuid.
 func (h handle) isDescriptor(uuid UUID) bool {
-	return h.typ == typDescriptor && uuidEqual(uuid, h.uuid)
+	return h.typ == typDescriptor && uuid.Equal(h.uuid)
 }
 
-func generateHandles(name string, svcs []*Service, base uint16) *handleRange {
-	svcs = append(defaultServices(name), svcs...)
+func generateHandles(svcs []*Service, base uint16) *handleRange {
 	var handles []handle
 	n := base
 
@@ -63,33 +64,21 @@ func generateHandles(name string, svcs []*Service, base uint16) *handleRange {
 	return &handleRange{hh: handles, base: base}
 }
 
-func defaultServices(name string) []*Service {
-	gapService := &Service{
-		uuid: gatAttrGAPUUID,
-		chars: []*Characteristic{
-			&Characteristic{
-				uuid:   gattAttrDeviceNameUUID,
-				props:  charRead,
-				secure: charRead,
-				value:  []byte(name),
-			},
-			&Characteristic{
-				uuid:   gattAttrAppearanceUUID,
-				props:  charRead,
-				secure: charRead,
-				value:  gapCharAppearanceGenericComputer,
-			},
-		},
-	}
-
-	gattService := &Service{uuid: gatAttrGATTUUID}
-	return []*Service{gapService, gattService}
+// A handleRange is a contiguous range of handles, or, if sparse, a
+// list of handles sorted by number, with gaps.
+type handleRange struct {
+	hh     []handle
+	base   uint16 // handle number for first handle in hh
+	sparse bool
 }
 
-// A handleRange is a contiguous range of handles.
-type handleRange struct {
-	hh   []handle
-	base uint16 // handle number for first handle in hh
+// newSparseHandleRange returns the handleRange of hh, sorted by number.
+func newSparseHandleRange(hh []handle) *handleRange {
+	r := &handleRange{hh: hh, sparse: true}
+	if len(hh) > 0 {
+		r.base = hh[0].n
+	}
+	return r
 }
 
 const (
@@ -101,6 +90,9 @@ const (
 // If n is too small, idx returns tooSmall (-1).
 // If n is too large, idx returns tooLarge (-2).
 func (r *handleRange) idx(n int) int {
+	if r.sparse {
+		return r.search(n)
+	}
 	if n < int(r.base) {
 		return tooSmall
 	}
@@ -110,10 +102,23 @@ func (r *handleRange) idx(n int) int {
 	return n - int(r.base)
 }
 
+// search is idx for sparse ranges; n is rounded up to the next handle
+// in use.
+func (r *handleRange) search(n int) int {
+	i := sort.Search(len(r.hh), func(i int) bool { return int(r.hh[i].n) >= n })
+	switch {
+	case i == len(r.hh):
+		return tooLarge
+	case i == 0 && n < int(r.hh[0].n):
+		return tooSmall
+	}
+	return i
+}
+
 // At returns handle n.
 func (r *handleRange) At(n uint16) (h handle, ok bool) {
 	i := r.idx(int(n))
-	if i < 0 {
+	if i < 0 || r.sparse && r.hh[i].n != n {
 		return handle{}, false
 	}
 	return r.hh[i], true
@@ -0,0 +1,143 @@
+package gatt
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// DeviceState is a snapshot of the state of a Device, as Inspect returns
+// it, laid out for JSON. It holds no keys: the bonds are listed by the
+// addresses of their peers only.
+type DeviceState struct {
+	Advertising bool        `json:"advertising"`
+	Scanning    bool        `json:"scanning"`
+	Connecting  bool        `json:"connecting"`
+	Connections []ConnState `json:"connections"`
+
+	// PendingCommands are the HCI commands the controller is yet to
+	// answer, oldest first.
+	PendingCommands []PendingCommand `json:"pendingCommands"`
+
+	QueuedPackets int    `json:"queuedPackets"` // ACL packets not written to the controller yet
+	HeldBuffers   int    `json:"heldBuffers"`   // ACL buffers of the controller not completed yet
+	Dropped       uint64 `json:"dropped"`       // packets dropped by the linux.DropPolicy
+	Malformed     uint64 `json:"malformed"`     // packets dropped as malformed
+
+	Bonds      []string `json:"bonds"`
+	BondsError string   `json:"bondsError,omitempty"` // of the KeyStore, listing them
+}
+
+// ConnState is the state of a connection of a DeviceState.
+type ConnState struct {
+	Peer string `json:"peer"`
+	Role string `json:"role"` // of the device: central, or peripheral
+	MTU  int    `json:"mtu"`
+	RSSI int    `json:"rssi"` // as last read; -1 if never
+
+	Interval           string `json:"interval"`
+	Latency            int    `json:"latency"`
+	SupervisionTimeout string `json:"supervisionTimeout"`
+
+	TxBytes   uint64 `json:"txBytes"`
+	RxBytes   uint64 `json:"rxBytes"`
+	TxPackets uint64 `json:"txPackets"`
+	RxPackets uint64 `json:"rxPackets"`
+
+	// Notifying are the UUIDs of the characteristics the peer is
+	// subscribed to, and Subscribed the value handles of those of the
+	// peer the device is subscribed to, as a Client.
+	Notifying  []string `json:"notifying"`
+	Subscribed []uint16 `json:"subscribed"`
+}
+
+// PendingCommand is an HCI command of a DeviceState, awaiting its event.
+type PendingCommand struct {
+	Name    string `json:"name"`
+	Opcode  uint16 `json:"opcode"`
+	Waiting string `json:"waiting"` // since sent
+}
+
+// Inspect returns a snapshot of the state of d: its roles, connections,
+// and the GATT subscriptions over them, the commands its controller is
+// yet to answer, and its bonds, for an operator to find what a device
+// stuck is waiting for, without attaching a debugger. It changes
+// nothing, and sends nothing to the controller. Only the devices of the
+// Linux HCI can be inspected. See the inspect package for serving it
+// over HTTP.
+func Inspect(d Device) (DeviceState, error) {
+	i, ok := d.(interface {
+		inspect() (DeviceState, error)
+	})
+	if !ok {
+		return DeviceState{}, fmt.Errorf("gatt: %T cannot be inspected", d)
+	}
+	return i.inspect()
+}
+
+// state returns the state of c, for Inspect.
+func (c *conn) state() ConnState {
+	role := "peripheral"
+	if c.central {
+		role = "central"
+	}
+	p, st := c.Params(), c.Stats()
+	s := ConnState{
+		Peer:               c.remoteAddr.String(),
+		Role:               role,
+		MTU:                c.MTU(),
+		RSSI:               c.RSSI(),
+		Interval:           p.IntervalMin.String(),
+		Latency:            p.Latency,
+		SupervisionTimeout: p.SupervisionTimeout.String(),
+		TxBytes:            st.TxBytes,
+		RxBytes:            st.RxBytes,
+		TxPackets:          st.TxPackets,
+		RxPackets:          st.RxPackets,
+		Notifying:          []string{},
+		Subscribed:         []uint16{},
+	}
+	c.notifiersmu.Lock()
+	for char := range c.notifiers {
+		s.Notifying = append(s.Notifying, char.uuid.String())
+	}
+	c.notifiersmu.Unlock()
+	sort.Strings(s.Notifying)
+	c.subsmu.Lock()
+	for h := range c.subs {
+		s.Subscribed = append(s.Subscribed, h)
+	}
+	c.subsmu.Unlock()
+	sort.Slice(s.Subscribed, func(i, j int) bool { return s.Subscribed[i] < s.Subscribed[j] })
+	return s
+}
+
+// addConns adds the states of conns, by peer, into s.
+func (s *DeviceState) addConns(conns []*conn) {
+	s.Connections = make([]ConnState, 0, len(conns))
+	for _, c := range conns {
+		s.Connections = append(s.Connections, c.state())
+	}
+	sort.Slice(s.Connections, func(i, j int) bool { return s.Connections[i].Peer < s.Connections[j].Peer })
+}
+
+// listBonds lists the addresses of the bonds of ks, into s.
+func (s *DeviceState) listBonds(ks KeyStore) {
+	s.Bonds = []string{}
+	if ks == nil {
+		return
+	}
+	bs, err := ks.Bonds()
+	if err != nil {
+		s.BondsError = err.Error()
+		return
+	}
+	for _, b := range bs {
+		s.Bonds = append(s.Bonds, b.Addr.String())
+	}
+	sort.Strings(s.Bonds)
+}
+
+// waiting returns how long a command sent at sent has been waiting, at
+// now, rounded for display.
+func waiting(sent, now time.Time) string { return now.Sub(sent).Round(time.Millisecond).String() }
@@ -0,0 +1,18 @@
+// Package inspect serves the state of a gatt.Device over HTTP, as JSON,
+// for an operator to inspect a gateway stuck without attaching a
+// debugger: its connections, and the GATT subscriptions over them, its
+// advertising and scanning, the HCI commands the controller is yet to
+// answer, and the addresses of its bonds.
+//
+// The handler is mounted on a debug listener of its own, kept off the
+// networks the peers' addresses are not to be disclosed to:
+//
+//	mux := http.NewServeMux()
+//	mux.Handle("/debug/gatt", inspect.Handler(d))
+//	go http.ListenAndServe("localhost:6061", mux)
+//
+// It is kept out of the gatt package for the devices not serving it not
+// to link net/http.
+//
+// This package is work in progress. We expect the APIs to change.
+package inspect
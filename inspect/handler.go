@@ -0,0 +1,32 @@
+package inspect
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/paypal/gatt"
+)
+
+// Handler returns an http.Handler answering GET requests with the state
+// of d, as gatt.Inspect returns it, in JSON. It changes nothing: other
+// methods are refused. A device that cannot be inspected, e.g. not
+// initialized yet, is reported as unavailable.
+func Handler(d gatt.Device) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s, err := gatt.Inspect(d)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(s)
+	})
+}
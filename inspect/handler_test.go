@@ -0,0 +1,29 @@
+package inspect
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/paypal/gatt"
+)
+
+// device is a gatt.Device that cannot be inspected.
+type device struct{ gatt.Device }
+
+func TestHandler(t *testing.T) {
+	h := Handler(device{})
+	for _, tt := range []struct {
+		method string
+		code   int
+	}{
+		{http.MethodGet, http.StatusServiceUnavailable},
+		{http.MethodPost, http.StatusMethodNotAllowed},
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(tt.method, "/debug/gatt", nil))
+		if w.Code != tt.code {
+			t.Errorf("%s: got %d, want %d", tt.method, w.Code, tt.code)
+		}
+	}
+}
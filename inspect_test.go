@@ -0,0 +1,52 @@
+package gatt
+
+import (
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInspectState(t *testing.T) {
+	if _, err := Inspect(&fakeDevice{}); err == nil {
+		t.Error("Inspect of a device that cannot be inspected succeeded")
+	}
+	peer := PublicAddr(BDAddr{net.HardwareAddr{1, 2, 3, 4, 5, 6}})
+	c := newConn(NewServer(Name("")), &testHandler{}, peer)
+	c.notifiers[&Characteristic{uuid: UUID16(0x2A37)}] = nil
+	c.subs[0x0010] = func([]byte, time.Time) {}
+	ks := NewFileKeyStore(filepath.Join(t.TempDir(), "bonds.json"), nil)
+	if err := ks.Put(Bond{Addr: peer, LTK: [16]byte{0xA5}}); err != nil {
+		t.Fatal(err)
+	}
+
+	var s DeviceState
+	s.addConns([]*conn{c})
+	s.listBonds(ks)
+	want := ConnState{
+		Peer:               peer.String(),
+		Role:               "peripheral",
+		MTU:                c.MTU(),
+		RSSI:               -1,
+		Interval:           "0s",
+		SupervisionTimeout: "0s",
+		Notifying:          []string{UUID16(0x2A37).String()},
+		Subscribed:         []uint16{0x0010},
+	}
+	if len(s.Connections) != 1 || !reflect.DeepEqual(s.Connections[0], want) {
+		t.Errorf("Connections = %+v, want [%+v]", s.Connections, want)
+	}
+	if !reflect.DeepEqual(s.Bonds, []string{peer.String()}) {
+		t.Errorf("Bonds = %q, want the peer", s.Bonds)
+	}
+	b, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(strings.ToLower(string(b)), "a5") {
+		t.Errorf("state discloses the key of the bond: %s", b)
+	}
+}
@@ -0,0 +1,41 @@
+// Package handler recovers the panics of the handlers of the
+// application, for gatt and its linux package to report them alike.
+package handler
+
+import (
+	"fmt"
+	"log"
+	"runtime/debug"
+)
+
+// A Panic is the error reported when a handler, or a callback, provided
+// by the application panics.
+type Panic struct {
+	Handler string      // e.g. "read 2a37", or "connect"
+	Value   interface{} // as passed to panic
+	Stack   []byte      // of the goroutine that panicked
+}
+
+func (e *Panic) Error() string {
+	return fmt.Sprintf("gatt: %s handler panicked: %v", e.Handler, e.Value)
+}
+
+// Call calls f, which calls the handler of the application named name,
+// and reports whether it returned without panicking. A panic is
+// recovered, and passed to report as a *Panic, or logged, with its
+// stack, if report is nil.
+func Call(name string, f func(), report func(err error)) (ok bool) {
+	defer func() {
+		if v := recover(); v != nil {
+			err := &Panic{Handler: name, Value: v, Stack: debug.Stack()}
+			if report == nil {
+				log.Printf("%s\n%s", err, err.Stack)
+			} else {
+				report(err)
+			}
+			ok = false
+		}
+	}()
+	f()
+	return true
+}
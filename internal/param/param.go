@@ -0,0 +1,25 @@
+// Package param checks the parameters of the API against their legal
+// ranges, for gatt and its linux package to report them alike.
+package param
+
+import "fmt"
+
+// ErrInvalid is returned when a parameter is out of its legal range. Its
+// message has no prefix: each package wraps it with its own.
+type ErrInvalid struct {
+	Param    string      // e.g. "MaxMTU", or "ConnParams.IntervalMin"
+	Value    interface{} // an int, or a time.Duration
+	Min, Max interface{} // legal range, inclusive
+}
+
+func (e ErrInvalid) Error() string {
+	return fmt.Sprintf("%s = %v, out of range [%v, %v]", e.Param, e.Value, e.Min, e.Max)
+}
+
+// CheckRange returns an ErrInvalid if v is out of [min, max].
+func CheckRange(param string, v, min, max int) error {
+	if v < min || v > max {
+		return ErrInvalid{Param: param, Value: v, Min: min, Max: max}
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+// Package inventory takes the inventory of a fleet of peripherals: it
+// connects to each of the addresses it is given in turn, as the central,
+// reads the fields of its Device Information service, its model, serial
+// number and firmware revision among them, and disconnects, round after
+// round, so that the firmware deployed is tracked as devices are updated:
+//
+//	s := inventory.NewScanner(d, inventory.Options{
+//		Interval: time.Hour,
+//		Report: func(info inventory.Info) {
+//			log.Printf("%s: %s %s", info.Addr, info.Model, info.Firmware)
+//		},
+//	})
+//	err := s.Run(ctx, targets)
+//
+// The connections are scheduled for the application: a few at once, each
+// bounded in time, those failing being retried in the next round.
+// ReadInfo reads the Device Information service over a connection of the
+// application's own.
+//
+// This package is work in progress. We expect the APIs to change.
+package inventory
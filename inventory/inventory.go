@@ -0,0 +1,263 @@
+package inventory
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/paypal/gatt"
+)
+
+// ErrNoService is returned by ReadInfo when the peripheral does not serve
+// the Device Information service.
+var ErrNoService = errors.New("inventory: device information service not served")
+
+// DeviceInformationServiceUUID is the UUID of the Device Information
+// service.
+var DeviceInformationServiceUUID = gatt.UUID16(0x180A)
+
+// The characteristics of the Device Information service.
+var (
+	systemIDUUID         = gatt.UUID16(0x2A23)
+	modelNumberUUID      = gatt.UUID16(0x2A24)
+	serialNumberUUID     = gatt.UUID16(0x2A25)
+	firmwareRevisionUUID = gatt.UUID16(0x2A26)
+	hardwareRevisionUUID = gatt.UUID16(0x2A27)
+	softwareRevisionUUID = gatt.UUID16(0x2A28)
+	manufacturerNameUUID = gatt.UUID16(0x2A29)
+	pnpIDUUID            = gatt.UUID16(0x2A50)
+)
+
+// A PnPID identifies the vendor, product and version of a device, as in
+// the PnP ID of the Device Information service.
+type PnPID struct {
+	VendorIDSource uint8 // 1 for the Bluetooth SIG, 2 for the USB-IF
+	VendorID       uint16
+	ProductID      uint16
+	ProductVersion uint16
+}
+
+// An Info is the inventory of a device: the fields of its Device
+// Information service, empty for those it does not serve.
+type Info struct {
+	Addr gatt.Addr
+
+	Manufacturer string
+	Model        string
+	Serial       string
+	Hardware     string // hardware revision
+	Firmware     string // firmware revision
+	Software     string // software revision
+	SystemID     []byte
+	PnPID        *PnPID
+
+	// Time is when the fields were last read.
+	Time time.Time
+
+	// Err is the error the last attempt at reading the fields failed
+	// with, if it did; the fields are then those read before, if any.
+	Err error
+}
+
+// ReadInfo reads the fields of the Device Information service of the
+// peripheral connected to on c, as the central. It returns ErrNoService
+// if the peripheral does not serve it.
+func ReadInfo(ctx context.Context, c gatt.Conn) (Info, error) {
+	info := Info{Addr: c.RemoteAddr()}
+	cl, err := gatt.NewClient(c)
+	if err != nil {
+		return info, err
+	}
+	svcs, err := cl.DiscoverServices(ctx)
+	if err != nil {
+		return info, err
+	}
+	var dis *gatt.RemoteService
+	for _, s := range svcs {
+		if s.UUID.Equal(DeviceInformationServiceUUID) {
+			dis = s
+		}
+	}
+	if dis == nil {
+		return info, ErrNoService
+	}
+	fields := map[string]*string{
+		manufacturerNameUUID.String(): &info.Manufacturer,
+		modelNumberUUID.String():      &info.Model,
+		serialNumberUUID.String():     &info.Serial,
+		hardwareRevisionUUID.String(): &info.Hardware,
+		firmwareRevisionUUID.String(): &info.Firmware,
+		softwareRevisionUUID.String(): &info.Software,
+	}
+	for _, ch := range dis.Characteristics {
+		f, isString := fields[ch.UUID.String()]
+		if !isString && !ch.UUID.Equal(systemIDUUID) && !ch.UUID.Equal(pnpIDUUID) {
+			continue
+		}
+		v, err := cl.Read(ctx, ch.ValueHandle)
+		if err != nil {
+			return info, err
+		}
+		switch {
+		case isString:
+			*f = string(v)
+		case ch.UUID.Equal(systemIDUUID):
+			info.SystemID = v
+		case len(v) == 7:
+			info.PnPID = &PnPID{
+				VendorIDSource: v[0],
+				VendorID:       binary.LittleEndian.Uint16(v[1:]),
+				ProductID:      binary.LittleEndian.Uint16(v[3:]),
+				ProductVersion: binary.LittleEndian.Uint16(v[5:]),
+			}
+		}
+	}
+	info.Time = time.Now()
+	return info, nil
+}
+
+// A Connector connects to peripherals, as the central, as a gatt.Device
+// does.
+type Connector interface {
+	Connect(ctx context.Context, addr gatt.Addr, opts gatt.ConnectOptions) (gatt.Conn, error)
+}
+
+// Options are the options of a Scanner.
+type Options struct {
+	// Connect are the options of the connections.
+	Connect gatt.ConnectOptions
+
+	// Timeout bounds the visit of each device, from connecting to it to
+	// reading its fields; 30 s if zero.
+	Timeout time.Duration
+
+	// Concurrency is the number of devices visited at once; 1 if zero,
+	// as most controllers initiate a single connection at a time.
+	Concurrency int
+
+	// Interval is the time from the start of a round to that of the
+	// next. If zero, Run returns after a single round.
+	Interval time.Duration
+
+	// Report, if set, is called with the Info of each device visited,
+	// as it is taken. The calls are serialized.
+	Report func(info Info)
+}
+
+const defaultTimeout = 30 * time.Second
+
+// A Scanner takes the inventory of a fleet of devices, round after round,
+// and keeps the latest Info of each.
+type Scanner struct {
+	c    Connector
+	opts Options
+
+	mu    sync.Mutex
+	infos map[string]Info // by address
+}
+
+// NewScanner returns a Scanner connecting to the devices with c, e.g. a
+// gatt.Device, initialized.
+func NewScanner(c Connector, opts Options) *Scanner {
+	if opts.Timeout == 0 {
+		opts.Timeout = defaultTimeout
+	}
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 1
+	}
+	return &Scanner{c: c, opts: opts, infos: make(map[string]Info)}
+}
+
+// Run takes the inventory of the devices of the addresses targets, in
+// turn, every Interval, until ctx is done, in which case it returns
+// ctx.Err(), or, if Interval is zero, once each has been visited.
+func (s *Scanner) Run(ctx context.Context, targets []gatt.Addr) error {
+	t := time.NewTimer(0)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		start := time.Now()
+		s.round(ctx, targets)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if s.opts.Interval == 0 {
+			return nil
+		}
+		t.Reset(s.opts.Interval - time.Since(start))
+	}
+}
+
+// round visits each of targets once, Concurrency at a time.
+func (s *Scanner) round(ctx context.Context, targets []gatt.Addr) {
+	sem := make(chan struct{}, s.opts.Concurrency)
+	var wg sync.WaitGroup
+	for _, a := range targets {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(a gatt.Addr) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			info, err := s.visit(ctx, a)
+			if ctx.Err() == nil {
+				s.record(a, info, err)
+			}
+		}(a)
+	}
+	wg.Wait()
+}
+
+// visit connects to the device of address a, reads its fields, and
+// disconnects.
+func (s *Scanner) visit(ctx context.Context, a gatt.Addr) (Info, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.opts.Timeout)
+	defer cancel()
+	c, err := s.c.Connect(ctx, a, s.opts.Connect)
+	if err != nil {
+		return Info{}, err
+	}
+	defer c.Close()
+	return ReadInfo(ctx, c)
+}
+
+// record records the Info of the device of address a, visited, or the
+// error the visit failed with, and reports it.
+func (s *Scanner) record(a gatt.Addr, info Info, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		info = s.infos[a.String()]
+		info.Err = err
+	}
+	info.Addr = a
+	s.infos[a.String()] = info
+	if s.opts.Report != nil {
+		s.opts.Report(info)
+	}
+}
+
+// Inventory returns the latest Info of each device visited, sorted by
+// address.
+func (s *Scanner) Inventory() []Info {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	infos := make([]Info, 0, len(s.infos))
+	for _, info := range s.infos {
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Addr.String() < infos[j].Addr.String() })
+	return infos
+}
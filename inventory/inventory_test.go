@@ -0,0 +1,100 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/paypal/gatt"
+)
+
+// fakeDevice connects to in-process servers of the Device Information
+// service, of the firmware revisions by address, failing for the others.
+type fakeDevice struct {
+	mu       sync.Mutex
+	firmware map[string]string
+}
+
+func (d *fakeDevice) Connect(ctx context.Context, addr gatt.Addr, opts gatt.ConnectOptions) (gatt.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	fw, found := d.firmware[addr.String()]
+	if !found {
+		return nil, errors.New("connection timed out")
+	}
+	svc, err := gatt.NewService(DeviceInformationServiceUUID).
+		AddCharacteristic(modelNumberUUID).SetReadHandler(value("TAG-1")).
+		AddCharacteristic(firmwareRevisionUUID).SetReadHandler(value(fw)).
+		AddCharacteristic(pnpIDUUID).SetReadHandler(value("\x01\x0F\x00\x34\x12\x02\x01")).
+		Build()
+	if err != nil {
+		return nil, err
+	}
+	cl, err := gatt.NewServer().Loopback(addr, svc)
+	if err != nil {
+		return nil, err
+	}
+	return cl.Conn(), nil
+}
+
+func value(v string) gatt.ReadHandler {
+	return gatt.ReadHandlerFunc(func(resp gatt.ReadResponseWriter, req *gatt.ReadRequest) {
+		resp.Write([]byte(v)[req.Offset:])
+	})
+}
+
+func addr(b byte) gatt.Addr {
+	return gatt.PublicAddr(gatt.BDAddr{HardwareAddr: []byte{1, 2, 3, 4, 5, b}})
+}
+
+func TestScanner(t *testing.T) {
+	d := &fakeDevice{firmware: map[string]string{addr(1).String(): "1.0", addr(2).String(): "2.1"}}
+	var reported int
+	s := NewScanner(d, Options{Concurrency: 2, Report: func(Info) { reported++ }})
+	if err := s.Run(context.Background(), []gatt.Addr{addr(1), addr(2), addr(3)}); err != nil {
+		t.Fatal(err)
+	}
+	infos := s.Inventory()
+	if len(infos) != 3 || reported != 3 {
+		t.Fatalf("inventory of %d devices, %d reported, want 3", len(infos), reported)
+	}
+	for i, fw := range []string{"1.0", "2.1"} {
+		info := infos[i]
+		if info.Err != nil || info.Model != "TAG-1" || info.Firmware != fw {
+			t.Errorf("%s: %+v, want model TAG-1, firmware %s", info.Addr, info, fw)
+		}
+		if want := (PnPID{1, 0x000F, 0x1234, 0x0102}); info.PnPID == nil || *info.PnPID != want {
+			t.Errorf("%s: PnP ID %+v, want %+v", info.Addr, info.PnPID, want)
+		}
+	}
+	if infos[2].Err == nil {
+		t.Errorf("%s: no error", infos[2].Addr)
+	}
+
+	// Once updated, the next round finds the new firmware; the fields of
+	// a device failing are kept.
+	d.mu.Lock()
+	d.firmware[addr(1).String()] = "1.1"
+	delete(d.firmware, addr(2).String())
+	d.mu.Unlock()
+	ctx, cancel := context.WithCancel(context.Background())
+	reported = 0
+	s.opts.Interval = time.Hour
+	s.opts.Report = func(Info) {
+		if reported++; reported == 2 {
+			cancel()
+		}
+	}
+	if err := s.Run(ctx, []gatt.Addr{addr(1), addr(2)}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Run() = %v, want %v", err, context.Canceled)
+	}
+	infos = s.Inventory()
+	if infos[0].Firmware != "1.1" {
+		t.Errorf("%s: firmware %s, want 1.1", infos[0].Addr, infos[0].Firmware)
+	}
+	if infos[1].Err == nil || infos[1].Firmware != "2.1" {
+		t.Errorf("%s: %+v, want an error, and firmware 2.1", infos[1].Addr, infos[1])
+	}
+}
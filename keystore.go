@@ -0,0 +1,409 @@
+package gatt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"sort"
+	"sync"
+)
+
+// ErrNoBond is returned by a KeyStore holding no bond of the address
+// looked up.
+var ErrNoBond = errors.New("no bond")
+
+// A Bond holds the keys distributed as a peer paired with the device:
+// the long term key encrypting the links, and the Identity Resolving Key
+// of the peer, resolving its private addresses, if it distributed one.
+// Keys are least significant byte first, as on the air.
+type Bond struct {
+	// Addr is the identity address of the peer.
+	Addr Addr
+
+	// LTK is the long term key, identified, if generated by legacy
+	// pairing, by EDiv and Rand; both are zero for those of LE Secure
+	// Connections.
+	LTK  [16]byte
+	EDiv uint16
+	Rand uint64
+
+	// IRK, if not zero, is the Identity Resolving Key of the peer.
+	IRK [16]byte
+
+	// CCCDs are the values the peer wrote to the Client Characteristic
+	// Configuration descriptors, by handle, but zeros; see Bonds.
+	CCCDs map[uint16]uint16
+}
+
+// A KeyStore keeps the bonds of the device, by the identity address of
+// the peer. Get returns ErrNoBond if it holds none of the address. Its
+// methods may be called concurrently.
+type KeyStore interface {
+	Put(b Bond) error
+	Get(a Addr) (Bond, error)
+	Delete(a Addr) error
+	Bonds() ([]Bond, error)
+}
+
+// A KeyWrapper wraps the keys a KeyStore keeps at rest, and unwraps them
+// as they are read back, e.g. with a key held by a KMS, sealed by a TPM,
+// or derived from a passphrase, none of which leaves the wrapper.
+// NewAESKeyWrapper returns one of a key given.
+//
+// The wrapped key is bound to label, which names where it is kept, e.g.
+// the field of the bond of a peer: it unwraps under the same label only,
+// so that it cannot be moved to another bond, or field, unnoticed.
+type KeyWrapper interface {
+	Wrap(key, label []byte) ([]byte, error)
+	Unwrap(wrapped, label []byte) ([]byte, error)
+}
+
+// aesKeyWrapper wraps keys with AES-GCM, each under a nonce of its own,
+// prepended to the ciphertext, their labels authenticated as additional
+// data.
+type aesKeyWrapper struct{ aead cipher.AEAD }
+
+// NewAESKeyWrapper returns a KeyWrapper sealing the keys with AES-GCM,
+// under the key encryption key kek, of 16, 24 or 32 bytes. Keys wrapped
+// under another kek, or label, or altered, fail to unwrap.
+func NewAESKeyWrapper(kek []byte) (KeyWrapper, error) {
+	c, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, fmt.Errorf("gatt: key encryption key: %w", err)
+	}
+	aead, err := cipher.NewGCM(c)
+	if err != nil {
+		return nil, err
+	}
+	return aesKeyWrapper{aead}, nil
+}
+
+func (w aesKeyWrapper) Wrap(key, label []byte) ([]byte, error) {
+	nonce := make([]byte, w.aead.NonceSize(), w.aead.NonceSize()+len(key)+w.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return w.aead.Seal(nonce, nonce, key, label), nil
+}
+
+func (w aesKeyWrapper) Unwrap(wrapped, label []byte) ([]byte, error) {
+	n := w.aead.NonceSize()
+	if len(wrapped) < n {
+		return nil, errors.New("gatt: wrapped key too short")
+	}
+	key, err := w.aead.Open(nil, wrapped[:n], wrapped[n:], label)
+	if err != nil {
+		return nil, fmt.Errorf("gatt: unwrapping key: %w", err)
+	}
+	return key, nil
+}
+
+// A FileKeyStore is a KeyStore saving the bonds in a JSON file, readable
+// by its owner only, with their keys wrapped by a KeyWrapper.
+type FileKeyStore struct {
+	path string
+	w    KeyWrapper
+	mu   sync.Mutex
+}
+
+// storedBond is a Bond as saved by a FileKeyStore, its keys wrapped.
+type storedBond struct {
+	Addr string
+	Type AddrType
+	LTK  []byte
+	EDiv uint16
+	Rand uint64
+	IRK  []byte `json:",omitempty"`
+
+	CCCDs map[uint16]uint16 `json:",omitempty"`
+}
+
+// NewFileKeyStore returns a KeyStore saving the bonds at path, with their
+// keys wrapped by w. If w is nil, the keys are saved in the clear.
+func NewFileKeyStore(path string, w KeyWrapper) *FileKeyStore {
+	return &FileKeyStore{path: path, w: w}
+}
+
+// bondKey is the key of the bonds of the address a in the file.
+func bondKey(a Addr) string {
+	if a.Type.Random() {
+		return a.HardwareAddr.String() + " random"
+	}
+	return a.HardwareAddr.String() + " public"
+}
+
+// load reads the bonds saved; a file that does not exist yet holds none.
+func (s *FileKeyStore) load() (map[string]storedBond, error) {
+	m := map[string]storedBond{}
+	b, err := ioutil.ReadFile(s.path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(b, &m); err != nil {
+			return nil, fmt.Errorf("key store %s: %v", s.path, err)
+		}
+	}
+	return m, nil
+}
+
+// save writes the bonds to the file, replacing it atomically.
+func (s *FileKeyStore) save(m map[string]storedBond) error {
+	b, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, append(b, '\n'), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// keyLabel is the label the key of the field of the bond of the address
+// a is wrapped under.
+func keyLabel(a Addr, field string) []byte { return []byte(bondKey(a) + " " + field) }
+
+func (s *FileKeyStore) wrap(key [16]byte, label []byte) ([]byte, error) {
+	if s.w == nil {
+		return key[:], nil
+	}
+	return s.w.Wrap(key[:], label)
+}
+
+func (s *FileKeyStore) unwrap(b, label []byte) ([16]byte, error) {
+	var key [16]byte
+	if s.w != nil {
+		var err error
+		if b, err = s.w.Unwrap(b, label); err != nil {
+			return key, err
+		}
+	}
+	if len(b) != len(key) {
+		return key, fmt.Errorf("gatt: key of %d bytes", len(b))
+	}
+	copy(key[:], b)
+	return key, nil
+}
+
+// Put saves the bond b, in place of that of its address, if any.
+func (s *FileKeyStore) Put(b Bond) error {
+	if err := b.Addr.check(); err != nil {
+		return err
+	}
+	ltk, err := s.wrap(b.LTK, keyLabel(b.Addr, "ltk"))
+	if err != nil {
+		return err
+	}
+	sb := storedBond{Addr: b.Addr.HardwareAddr.String(), Type: b.Addr.Type, LTK: ltk, EDiv: b.EDiv, Rand: b.Rand, CCCDs: b.CCCDs}
+	if b.IRK != ([16]byte{}) {
+		if sb.IRK, err = s.wrap(b.IRK, keyLabel(b.Addr, "irk")); err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, err := s.load()
+	if err != nil {
+		return err
+	}
+	m[bondKey(b.Addr)] = sb
+	return s.save(m)
+}
+
+// Get returns the bond of the address a, its keys unwrapped.
+func (s *FileKeyStore) Get(a Addr) (Bond, error) {
+	s.mu.Lock()
+	m, err := s.load()
+	s.mu.Unlock()
+	if err != nil {
+		return Bond{}, err
+	}
+	sb, found := m[bondKey(a)]
+	if !found {
+		return Bond{}, ErrNoBond
+	}
+	return s.bond(sb)
+}
+
+// bond returns the bond saved as sb, its keys unwrapped.
+func (s *FileKeyStore) bond(sb storedBond) (Bond, error) {
+	hw, err := net.ParseMAC(sb.Addr)
+	if err != nil {
+		return Bond{}, fmt.Errorf("key store %s: %v", s.path, err)
+	}
+	b := Bond{Addr: Addr{BDAddr{hw}, sb.Type}, EDiv: sb.EDiv, Rand: sb.Rand, CCCDs: sb.CCCDs}
+	if b.LTK, err = s.unwrap(sb.LTK, keyLabel(b.Addr, "ltk")); err != nil {
+		return Bond{}, fmt.Errorf("gatt: bond of %s: %w", b.Addr, err)
+	}
+	if sb.IRK != nil {
+		if b.IRK, err = s.unwrap(sb.IRK, keyLabel(b.Addr, "irk")); err != nil {
+			return Bond{}, fmt.Errorf("gatt: bond of %s: %w", b.Addr, err)
+		}
+	}
+	return b, nil
+}
+
+// Delete removes the bond of the address a, if any.
+func (s *FileKeyStore) Delete(a Addr) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, err := s.load()
+	if err != nil {
+		return err
+	}
+	if _, found := m[bondKey(a)]; !found {
+		return nil
+	}
+	delete(m, bondKey(a))
+	return s.save(m)
+}
+
+// Bonds returns all the bonds, their keys unwrapped, sorted by address.
+func (s *FileKeyStore) Bonds() ([]Bond, error) {
+	s.mu.Lock()
+	m, err := s.load()
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	bonds := make([]Bond, 0, len(keys))
+	for _, k := range keys {
+		b, err := s.bond(m[k])
+		if err != nil {
+			return nil, err
+		}
+		bonds = append(bonds, b)
+	}
+	return bonds, nil
+}
+
+// resolves reports whether a is a resolvable private address of irk.
+func resolves(irk [16]byte, a BDAddr) bool {
+	if len(a.HardwareAddr) != 6 || a.HardwareAddr[5]>>6 != 0x1 {
+		return false
+	}
+	var prand [3]byte
+	copy(prand[:], a.HardwareAddr[3:])
+	return resolvablePrivateAddr(irk, prand).String() == a.HardwareAddr.String()
+}
+
+// BondOf returns the bond of ks of the peer of address peer, looked up
+// by its identity address, or, if it is a resolvable private one, by the
+// IRKs of the bonds, and whether there is one.
+func BondOf(ks KeyStore, peer Addr) (Bond, bool, error) {
+	return bondOf(ks, peer)
+}
+
+// bondOf returns the bond of ks of the peer of address peer, looked up
+// by its identity address, or, if it is a resolvable private one, by the
+// IRKs of the bonds, and whether there is one.
+func bondOf(ks KeyStore, peer Addr) (Bond, bool, error) {
+	b, err := ks.Get(peer)
+	if errors.Is(err, ErrNoBond) && peer.Type == AddrResolvablePrivate {
+		bonds, err := ks.Bonds()
+		if err != nil {
+			return Bond{}, false, err
+		}
+		for _, b := range bonds {
+			if b.IRK != ([16]byte{}) && resolves(b.IRK, peer.BDAddr) {
+				return b, true, nil
+			}
+		}
+		return Bond{}, false, nil
+	}
+	if errors.Is(err, ErrNoBond) {
+		return Bond{}, false, nil
+	}
+	if err != nil {
+		return Bond{}, false, err
+	}
+	return b, true, nil
+}
+
+// longTermKey returns the long term key of the bond of ks of the peer of
+// address peer, if it is that identified by rand and ediv.
+func longTermKey(ks KeyStore, peer Addr, rand uint64, ediv uint16) ([16]byte, bool, error) {
+	b, found, err := bondOf(ks, peer)
+	if !found || b.EDiv != ediv || b.Rand != rand {
+		return [16]byte{}, false, err
+	}
+	return b.LTK, true, nil
+}
+
+// Bonds sets the KeyStore keeping the bonds of the peers, in which the
+// subscriptions of the bonded clients, the values they write to the
+// Client Characteristic Configuration descriptors, are kept, and
+// restored as they reconnect: they resume receiving the notifications,
+// and indications, without subscribing anew, as the specification
+// requires. Those restored are capped by the default ATT MTU, the
+// notifications being started ahead of any MTU exchange.
+// See also Server.NewServer.
+// Bonds cannot be used with Server.Option.
+func Bonds(ks KeyStore) option {
+	return func(s *Server) option {
+		prev := s.keyStore
+		s.keyStore = ks
+		return Bonds(prev)
+	}
+}
+
+// restoreSubscriptions restores the subscriptions the peer of c, if
+// bonded, had, as it connects, and records its identity for those it
+// changes to be saved.
+func (c *conn) restoreSubscriptions() {
+	ks := c.server.keyStore
+	if ks == nil {
+		return
+	}
+	b, found, err := bondOf(ks, c.remoteAddr)
+	if err != nil {
+		c.server.report(fmt.Errorf("gatt: looking up the bond of %s: %w", c.remoteAddr, err))
+	}
+	if !found {
+		return
+	}
+	c.bond = &b.Addr
+	for n, ccc := range b.CCCDs {
+		h, ok := c.server.handles.At(n)
+		if !ok || !h.uuid.Equal(gattAttrClientCharacteristicConfigUUID) || ccc&(gattCCCNotifyFlag|gattCCCIndicateFlag) == 0 {
+			continue
+		}
+		c.startNotify(h.attr.(*Characteristic), int(c.mtu-3))
+	}
+}
+
+// saveSubscription saves the value ccc the peer of c, if bonded, wrote to
+// the Client Characteristic Configuration descriptor of handle n.
+func (c *conn) saveSubscription(n uint16, ccc uint16) {
+	if c.bond == nil {
+		return
+	}
+	ks := c.server.keyStore
+	b, err := ks.Get(*c.bond)
+	if err == nil {
+		if ccc == 0 {
+			delete(b.CCCDs, n)
+		} else {
+			if b.CCCDs == nil {
+				b.CCCDs = make(map[uint16]uint16)
+			}
+			b.CCCDs[n] = ccc
+		}
+		err = ks.Put(b)
+	}
+	if err != nil && !errors.Is(err, ErrNoBond) {
+		c.server.report(fmt.Errorf("gatt: saving the subscription of %s: %w", c.remoteAddr, err))
+	}
+}
@@ -0,0 +1,203 @@
+package gatt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFileKeyStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bonds.json")
+	w, err := NewAESKeyWrapper(bytes.Repeat([]byte{0x5A}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks := NewFileKeyStore(path, w)
+	a := PublicAddr(BDAddr{net.HardwareAddr{1, 2, 3, 4, 5, 6}})
+	if _, err := ks.Get(a); !errors.Is(err, ErrNoBond) {
+		t.Fatalf("Get() = %v, want %v", err, ErrNoBond)
+	}
+	b := Bond{Addr: a, EDiv: 0x1234, Rand: 0x0102030405060708}
+	copy(b.LTK[:], "long term key 16")
+	copy(b.IRK[:], "identity resolvg")
+	if err := ks.Put(b); err != nil {
+		t.Fatal(err)
+	}
+
+	// The keys are at rest wrapped only.
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(raw, b.LTK[:]) || bytes.Contains(raw, []byte("bG9uZyB0ZXJtIGtleSAxNg")) {
+		t.Errorf("key store holds the long term key in the clear: %s", raw)
+	}
+
+	got, err := NewFileKeyStore(path, w).Get(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, b) {
+		t.Errorf("Get() = %+v, want %+v", got, b)
+	}
+	other, _ := NewAESKeyWrapper(bytes.Repeat([]byte{0xA5}, 32))
+	if _, err := NewFileKeyStore(path, other).Get(a); err == nil {
+		t.Error("Get() with another key encryption key succeeded")
+	}
+
+	if err := ks.Delete(a); err != nil {
+		t.Fatal(err)
+	}
+	if bonds, err := ks.Bonds(); err != nil || len(bonds) != 0 {
+		t.Errorf("Bonds() = %v, %v, want none", bonds, err)
+	}
+}
+
+// A wrapped key moved to another bond, or another field, fails to
+// unwrap.
+func TestFileKeyStoreMovedKeys(t *testing.T) {
+	w, _ := NewAESKeyWrapper(bytes.Repeat([]byte{0x5A}, 32))
+	ks := NewFileKeyStore(filepath.Join(t.TempDir(), "bonds.json"), w)
+	a := PublicAddr(BDAddr{net.HardwareAddr{1, 2, 3, 4, 5, 6}})
+	c := PublicAddr(BDAddr{net.HardwareAddr{6, 5, 4, 3, 2, 1}})
+	for _, addr := range []Addr{a, c} {
+		if err := ks.Put(Bond{Addr: addr, LTK: [16]byte{1}, IRK: [16]byte{2}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tt := range []struct {
+		name string
+		move func(m map[string]storedBond)
+	}{
+		{"LTK of another bond", func(m map[string]storedBond) {
+			sa, sc := m[bondKey(a)], m[bondKey(c)]
+			sa.LTK = sc.LTK
+			m[bondKey(a)] = sa
+		}},
+		{"IRK as the LTK", func(m map[string]storedBond) {
+			sa := m[bondKey(a)]
+			sa.LTK = sa.IRK
+			m[bondKey(a)] = sa
+		}},
+	} {
+		m, err := ks.load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		saved := m[bondKey(a)]
+		tt.move(m)
+		if err := ks.save(m); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ks.Get(a); err == nil {
+			t.Errorf("%s: Get() succeeded", tt.name)
+		}
+		m[bondKey(a)] = saved
+		if err := ks.save(m); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ks.Get(a); err != nil {
+			t.Errorf("%s: Get() once restored = %v", tt.name, err)
+		}
+	}
+}
+
+func TestLongTermKey(t *testing.T) {
+	ks := NewFileKeyStore(filepath.Join(t.TempDir(), "bonds.json"), nil)
+	id := RandomAddr(BDAddr{net.HardwareAddr{1, 2, 3, 4, 5, 0xC6}})
+	b := Bond{Addr: id, LTK: [16]byte{1}, IRK: [16]byte{2}}
+	if err := ks.Put(b); err != nil {
+		t.Fatal(err)
+	}
+	rpa, err := newResolvablePrivateAddr(b.IRK)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _ := newResolvablePrivateAddr([16]byte{3})
+	for _, tt := range []struct {
+		peer Addr
+		rand uint64
+		ok   bool
+	}{
+		{id, 0, true},
+		{RandomAddr(rpa), 0, true},
+		{RandomAddr(other), 0, false},
+		{id, 1, false}, // a legacy key of another bond
+	} {
+		ltk, ok, err := longTermKey(ks, tt.peer, tt.rand, 0)
+		if err != nil || ok != tt.ok || ok && ltk != b.LTK {
+			t.Errorf("longTermKey(%s, %d) = %v, %t, %v, want ok %t", tt.peer, tt.rand, ltk, ok, err, tt.ok)
+		}
+	}
+}
+
+func TestBondSubscriptions(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ks := NewFileKeyStore(filepath.Join(t.TempDir(), "bonds.json"), nil)
+	bonded := PublicAddr(BDAddr{net.HardwareAddr{1, 2, 3, 4, 5, 6}})
+	if err := ks.Put(Bond{Addr: bonded, LTK: [16]byte{1}}); err != nil {
+		t.Fatal(err)
+	}
+	notifiers := make(chan Notifier, 1)
+	s := NewServer(Name(""), Bonds(ks))
+	s.AddService(UUID16(0x180D)).AddCharacteristic(UUID16(0x2A37)).
+		HandleNotifyFunc(func(r Request, n Notifier) { notifiers <- n })
+	s.setServices()
+
+	// connect connects the peer of address a to s, and returns its end.
+	connect := func(a Addr) (*conn, func()) {
+		pa, pb := newPipe()
+		ca, cb := newConn(s, pa, a), newConn(NewServer(Name("")), pb, Addr{})
+		go ca.loop()
+		go cb.loop()
+		return cb, func() {
+			pa.Close()
+			<-ca.done
+		}
+	}
+	notified := func() bool {
+		select {
+		case n := <-notifiers:
+			return !n.Done()
+		case <-time.After(50 * time.Millisecond):
+			return false
+		}
+	}
+
+	c, disconnect := connect(bonded)
+	cl, _ := NewClient(c)
+	svcs, err := cl.DiscoverServices(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := svcs[len(svcs)-1].Characteristics[0]
+	if err := cl.Subscribe(ctx, m, func(v []byte) {}); err != nil {
+		t.Fatal(err)
+	}
+	if !notified() {
+		t.Fatal("not subscribed")
+	}
+	disconnect()
+	if b, err := ks.Get(bonded); err != nil || b.CCCDs[m.cccd()] != gattCCCNotifyFlag {
+		t.Fatalf("bond = %+v, %v, want the subscription saved", b, err)
+	}
+
+	// Reconnected, the bonded client is notified at once; another is not.
+	_, disconnect = connect(bonded)
+	if !notified() {
+		t.Error("subscription of the bonded client not restored")
+	}
+	disconnect()
+	_, disconnect = connect(PublicAddr(BDAddr{net.HardwareAddr{6, 5, 4, 3, 2, 1}}))
+	if notified() {
+		t.Error("subscription restored for a client not bonded")
+	}
+	disconnect()
+}
@@ -0,0 +1,194 @@
+package gatt
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+// A handleLayout records the handles assigned to the services and
+// characteristics of the GATT database, so that they can be assigned the
+// same handles once the server restarts, even if the database has changed
+// in the meantime. Clients that cache the handles of a bonded server thus
+// keep working.
+//
+// It is keyed by the UUID of each service, suffixed with ~2, ~3... for the
+// second and later services of the same UUID, and the end of the range of
+// a service under its key suffixed with #end. A characteristic is keyed by
+// the key of its service, a slash, and its UUID. The hash of the database
+// is recorded under dbHashKey, to tell whether it has changed since.
+//
+// Attributes keep their handles as long as they fit: a characteristic that
+// has grown, e.g. with a descriptor, moves to a free range of its service;
+// a service that can no longer hold its characteristics moves to the end
+// of the database. New attributes are assigned handles that have not been
+// used before, and those of attributes removed are left unused.
+type handleLayout struct {
+	m    map[string]uint16
+	next uint16 // first handle never assigned
+}
+
+// dbHashKey is the key of the hash of the database; see dbHash.
+const dbHashKey = "#hash"
+
+func newHandleLayout(m map[string]uint16, base uint16) *handleLayout {
+	l := &handleLayout{m: m, next: base}
+	for k, n := range m {
+		if k != dbHashKey && n >= l.next {
+			l.next = n + 1
+		}
+	}
+	return l
+}
+
+// loadHandleLayout reads the layout saved at path; a file that does not
+// exist yet holds an empty layout.
+func loadHandleLayout(path string, base uint16) (*handleLayout, error) {
+	m := map[string]uint16{}
+	b, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(b, &m); err != nil {
+			return nil, fmt.Errorf("handle layout %s: %v", path, err)
+		}
+	}
+	return newHandleLayout(m, base), nil
+}
+
+// save writes the layout to path, replacing the file atomically.
+func (l *handleLayout) save(path string) error {
+	b, err := json.MarshalIndent(l.m, "", "\t")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, append(b, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// span is a range of handles, [start, end].
+type span struct{ start, end uint16 }
+
+func overlaps(ss []span, s span) bool {
+	for _, o := range ss {
+		if s.start <= o.end && o.start <= s.end {
+			return true
+		}
+	}
+	return false
+}
+
+// generateHandles assigns the handles of the services, as generateHandles
+// does, but keeping those recorded in the layout, which it updates.
+func (l *handleLayout) generateHandles(svcs []*Service) *handleRange {
+	var used []span // by the services placed so far
+	var handles []handle
+	seen := map[string]int{}
+	for _, svc := range svcs {
+		key := svc.uuid.String()
+		if seen[key]++; seen[key] > 1 {
+			key = fmt.Sprintf("%s~%d", key, seen[key])
+		}
+		s, chars, ok := l.place(key, svc, used)
+		if !ok {
+			s, chars = l.append(svc)
+		}
+		used = append(used, s)
+		handles = append(handles, svc.handlesAt(s, chars)...)
+
+		l.m[key] = s.start
+		l.m[key+"#end"] = s.end
+		for i, c := range svc.chars {
+			l.m[key+"/"+c.uuid.String()] = chars[i]
+		}
+	}
+	sort.Slice(handles, func(i, j int) bool { return handles[i].n < handles[j].n })
+	return newSparseHandleRange(handles)
+}
+
+// charSize returns the number of handles of a characteristic.
+func charSize(c *Characteristic) uint16 {
+	valuen := c.valuen
+	_, hh := c.generateHandles(0)
+	c.valuen = valuen
+	return uint16(len(hh))
+}
+
+// place places the service, and its characteristics, within the range it
+// is recorded with, if it still fits there.
+func (l *handleLayout) place(key string, svc *Service, used []span) (span, []uint16, bool) {
+	start, ok1 := l.m[key]
+	end, ok2 := l.m[key+"#end"]
+	s := span{start, end}
+	if !ok1 || !ok2 || start == 0 || end < start || overlaps(used, s) {
+		return span{}, nil, false
+	}
+	chars := make([]uint16, len(svc.chars))
+	var taken []span
+	var moved []int
+	for i, c := range svc.chars {
+		n, ok := l.m[key+"/"+c.uuid.String()]
+		cs := span{n, n + charSize(c) - 1}
+		if !ok || n <= start || cs.end > end || cs.end < n || overlaps(taken, cs) {
+			moved = append(moved, i)
+			continue
+		}
+		chars[i] = n
+		taken = append(taken, cs)
+	}
+	for _, i := range moved {
+		size := charSize(svc.chars[i])
+		found := false
+		for n := start + 1; n+size-1 <= end && n+size-1 >= n; n++ {
+			if cs := (span{n, n + size - 1}); !overlaps(taken, cs) {
+				chars[i] = n
+				taken = append(taken, cs)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return span{}, nil, false
+		}
+	}
+	return s, chars, true
+}
+
+// append places the service, and its characteristics, at handles that
+// have never been used.
+func (l *handleLayout) append(svc *Service) (span, []uint16) {
+	s := span{start: l.next}
+	n := s.start
+	chars := make([]uint16, len(svc.chars))
+	for i, c := range svc.chars {
+		chars[i] = n + 1
+		n += charSize(c)
+	}
+	s.end = n
+	l.next = n + 1
+	return s, chars
+}
+
+// handlesAt generates the handles of the service, within the range s, its
+// characteristics starting at the handles chars.
+func (s *Service) handlesAt(r span, chars []uint16) []handle {
+	handles := []handle{{
+		typ:    typService,
+		n:      r.start,
+		uuid:   s.uuid,
+		attr:   s,
+		startn: r.start,
+		endn:   r.end,
+	}}
+	for i, c := range s.chars {
+		_, hh := c.generateHandles(chars[i])
+		handles = append(handles, hh...)
+	}
+	return handles
+}
@@ -0,0 +1,89 @@
+package gatt
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// layoutHandles returns the handle of each service and characteristic
+// declaration served, by UUID.
+func layoutHandles(r *handleRange) map[string]uint16 {
+	m := map[string]uint16{}
+	for _, h := range r.hh {
+		if h.typ == typService || h.typ == typCharacteristic {
+			m[h.uuid.String()] = h.n
+		}
+	}
+	return m
+}
+
+func TestHandleLayout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "layout.json")
+	serve := func(svcs ...*Service) *handleRange {
+		s := NewServer(HandleLayout(path))
+		s.services = svcs
+		if err := s.setServices(); err != nil {
+			t.Fatal(err)
+		}
+		return s.handles
+	}
+
+	a := &Service{uuid: UUID16(0xA000)}
+	a.AddCharacteristic(UUID16(0xA001))
+	a.AddCharacteristic(UUID16(0xA002))
+	b := &Service{uuid: UUID16(0xB000)}
+	b.AddCharacteristic(UUID16(0xB001))
+	before := layoutHandles(serve(a, b))
+
+	// A loses a characteristic, and gains one that fits in its place;
+	// B gains a descriptor, and no longer fits in its range; C is new.
+	a = &Service{uuid: UUID16(0xA000)}
+	a.AddCharacteristic(UUID16(0xA002))
+	a.AddCharacteristic(UUID16(0xA003))
+	b = &Service{uuid: UUID16(0xB000)}
+	b.AddCharacteristic(UUID16(0xB001)).HandleNotifyFunc(func(r Request, n Notifier) {})
+	c := &Service{uuid: UUID16(0xC000)}
+	c.AddCharacteristic(UUID16(0xC001))
+	r := serve(c, b, a)
+	after := layoutHandles(r)
+
+	for _, u := range []string{"1800", "2a00", "2a01", "1801", "a000", "a002"} {
+		if before[u] != after[u] {
+			t.Errorf("handle of %s: got 0x%04X, want 0x%04X", u, after[u], before[u])
+		}
+	}
+	if after["a003"] != before["a001"] {
+		t.Errorf("handle of a003: got 0x%04X, want that of a001, 0x%04X", after["a003"], before["a001"])
+	}
+	for _, u := range []string{"b000", "c000"} {
+		if after[u] <= before["b001"] {
+			t.Errorf("handle of %s: got 0x%04X, want one never used", u, after[u])
+		}
+	}
+
+	// The handles stay put once the services are unchanged.
+	if again := layoutHandles(serve(c, b, a)); len(again) != len(after) {
+		t.Errorf("got %d handles, want %d", len(again), len(after))
+	} else {
+		for u, n := range after {
+			if again[u] != n {
+				t.Errorf("handle of %s: got 0x%04X, want 0x%04X", u, again[u], n)
+			}
+		}
+	}
+
+	// The sparse range is searched by handle number.
+	for i, h := range r.hh {
+		if got, ok := r.At(h.n); !ok || got.n != h.n {
+			t.Errorf("At(0x%04X) = 0x%04X, %v", h.n, got.n, ok)
+		}
+		if i > 0 && h.n > r.hh[i-1].n+1 {
+			if _, ok := r.At(h.n - 1); ok {
+				t.Errorf("At(0x%04X) is ok, want a gap", h.n-1)
+			}
+			if hh := r.Subrange(r.hh[i-1].n+1, h.n); len(hh) != 1 || hh[0].n != h.n {
+				t.Errorf("Subrange(0x%04X, 0x%04X) = %v", r.hh[i-1].n+1, h.n, hh)
+			}
+		}
+	}
+}
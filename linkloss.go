@@ -0,0 +1,76 @@
+package gatt
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// defaultLossPercent is the share of the supervision timeout a connection
+// goes silent for before LinkLossWarning warns of it, by default.
+const defaultLossPercent = 75
+
+// LinkLossWarning sets a function called, from a goroutine of its own,
+// once a connection has received nothing for percent of its supervision
+// timeout, from 1 to 99, or 75 if zero: the link is likely to be lost
+// soon, and the application saves the state of the session while it
+// still can. It is called once per silence, with how long the connection
+// has been silent for; the timeout is that of the current parameters of
+// the connection, see Conn.Params, and connections that do not report
+// them are not watched.
+//
+// The host only sees the packets carrying data: a peer left with nothing
+// to send looks silent, even though its link is alive. The warning is
+// thus best heeded by peers that poll, or notify, periodically.
+// See also Server.NewServer.
+// LinkLossWarning cannot be used with Server.Option.
+func LinkLossWarning(percent int, f func(c Conn, silent time.Duration)) option {
+	return func(s *Server) option {
+		prev, prevPercent := s.lossWarning, s.lossPercent
+		s.lossWarning, s.lossPercent = f, percent
+		return LinkLossWarning(prevPercent, prev)
+	}
+}
+
+// received records data received on the connection, of any channel.
+func (c *conn) received() {
+	atomic.StoreInt64(&c.activity.rx, time.Now().UnixNano())
+}
+
+// watchSilence calls f once the connection has received nothing for
+// percent of its supervision timeout, once per silence, until the
+// connection is closed.
+func (c *conn) watchSilence(percent int, f func(c Conn, silent time.Duration)) {
+	rxPackets := c.Stats().RxPackets
+	var warned int64 // time of the packet the silence after was warned of
+	t := time.NewTimer(0)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-c.done:
+			return
+		}
+		timeout := c.Params().SupervisionTimeout
+		if timeout == 0 {
+			return
+		}
+		// The packets of the channels other than ATT, e.g. signaling,
+		// count too.
+		if n := c.Stats().RxPackets; n != rxPackets {
+			rxPackets = n
+			c.received()
+		}
+		after := timeout * time.Duration(percent) / 100
+		last := atomic.LoadInt64(&c.activity.rx)
+		silent := time.Since(time.Unix(0, last))
+		if silent < after {
+			t.Reset(after - silent)
+			continue
+		}
+		if last != warned {
+			warned = last
+			c.server.call("link loss warning", func() { f(c, silent) })
+		}
+		t.Reset(after)
+	}
+}
@@ -0,0 +1,36 @@
+package gatt
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLinkLossWarning(t *testing.T) {
+	srv := NewServer(Name(""))
+	c := newConn(srv, discardConn{}, Addr{})
+	c.params = func() ConnParams { return ConnParams{SupervisionTimeout: 100 * time.Millisecond} }
+	warnings := make(chan time.Duration, 2)
+	start := time.Now()
+	go c.watchSilence(50, func(_ Conn, silent time.Duration) { warnings <- silent })
+	defer c.close()
+
+	if silent := <-warnings; silent < 50*time.Millisecond || time.Since(start) < 50*time.Millisecond {
+		t.Errorf("warned of a silence of %v, after %v, want 50ms", silent, time.Since(start))
+	}
+	// Once per silence.
+	select {
+	case silent := <-warnings:
+		t.Errorf("warned again of a silence of %v", silent)
+	case <-time.After(120 * time.Millisecond):
+	}
+	c.received()
+	select {
+	case <-warnings:
+	case <-time.After(time.Second):
+		t.Error("not warned of the silence after data was received")
+	}
+
+	if err := NewServer(LinkLossWarning(100, func(Conn, time.Duration) {})).validate(); err == nil {
+		t.Error("LinkLossWarning of 100%: got no error")
+	}
+}
@@ -0,0 +1,122 @@
+package linux
+
+import (
+	"context"
+	"sync"
+
+	"github.com/paypal/gatt/linux/internal/cmd"
+)
+
+// AddrAnonymous is the address type of the entry of the accept list
+// matching the advertisements sent without an address.
+const AddrAnonymous = 0xFF
+
+// An AcceptListEntry is a device of the accept list of the controller.
+type AcceptListEntry struct {
+	Address     [6]byte
+	AddressType uint8 // AddrPublic, AddrRandom, or AddrAnonymous
+}
+
+// acceptList holds the entries added to the accept list of the
+// controller, added again as it is reset, which clears it.
+type acceptList struct {
+	mu      sync.Mutex
+	entries []AcceptListEntry
+}
+
+// AddToAcceptList adds the device of address addr, of type typ, to the
+// accept list, formerly the white list, of the controller, which filters
+// the advertisements scanned, see FilterScanByAcceptList, and the
+// peripherals connected to, see ConnectAcceptListCtx, for the host not
+// to. Its size is the WhiteListSize of the Capabilities; the controller
+// fails the entries beyond it with Memory Capacity Exceeded. The list
+// cannot be changed while it is in use, the controller then failing the
+// command with Command Disallowed.
+func (h HCI) AddToAcceptList(addr [6]byte, typ uint8) error {
+	if err := checkAcceptListType(typ); err != nil {
+		return err
+	}
+	h.accept.mu.Lock()
+	defer h.accept.mu.Unlock()
+	e := AcceptListEntry{addr, typ}
+	for _, f := range h.accept.entries {
+		if f == e {
+			return nil
+		}
+	}
+	if err := h.cmd.SendAndCheckResp(cmd.LEAddDeviceToWhiteList{AddressType: typ, Address: addr}, expSuccess); err != nil {
+		return err
+	}
+	h.accept.entries = append(h.accept.entries, e)
+	return nil
+}
+
+// RemoveFromAcceptList removes the device of address addr, of type typ,
+// from the accept list.
+func (h HCI) RemoveFromAcceptList(addr [6]byte, typ uint8) error {
+	if err := checkAcceptListType(typ); err != nil {
+		return err
+	}
+	h.accept.mu.Lock()
+	defer h.accept.mu.Unlock()
+	if err := h.cmd.SendAndCheckResp(cmd.LERemoveDeviceFromWhiteList{AddressType: typ, Address: addr}, expSuccess); err != nil {
+		return err
+	}
+	e := AcceptListEntry{addr, typ}
+	for i, f := range h.accept.entries {
+		if f == e {
+			h.accept.entries = append(h.accept.entries[:i], h.accept.entries[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// ClearAcceptList removes all the devices from the accept list.
+func (h HCI) ClearAcceptList() error {
+	h.accept.mu.Lock()
+	defer h.accept.mu.Unlock()
+	if err := h.cmd.SendAndCheckResp(cmd.LEClearWhiteList{}, expSuccess); err != nil {
+		return err
+	}
+	h.accept.entries = nil
+	return nil
+}
+
+// AcceptList returns the devices of the accept list, in the order they
+// were added.
+func (h HCI) AcceptList() []AcceptListEntry {
+	h.accept.mu.Lock()
+	defer h.accept.mu.Unlock()
+	return append([]AcceptListEntry(nil), h.accept.entries...)
+}
+
+// restoreAcceptList adds the devices of the accept list again, once the
+// controller has been reset. Those it no longer takes are dropped.
+func (h HCI) restoreAcceptList(ctx context.Context) {
+	h.accept.mu.Lock()
+	defer h.accept.mu.Unlock()
+	entries := h.accept.entries[:0]
+	for _, e := range h.accept.entries {
+		if h.cmd.SendAndCheckRespCtx(ctx, cmd.LEAddDeviceToWhiteList{AddressType: e.AddressType, Address: e.Address}, expSuccess) == nil {
+			entries = append(entries, e)
+		}
+	}
+	h.accept.entries = entries
+}
+
+func checkAcceptListType(typ uint8) error {
+	if typ == AddrAnonymous {
+		return nil
+	}
+	return checkRange("AddressType", int(typ), AddrPublic, AddrRandom)
+}
+
+// FilterScanByAcceptList sets whether scanning reports the advertisements
+// of the devices of the accept list only, and those directed to the
+// device, from the next Scan on.
+func (h HCI) FilterScanByAcceptList(on bool) {
+	h.roles.mu.Lock()
+	defer h.roles.mu.Unlock()
+	h.roles.scanAcceptList = on
+}
@@ -0,0 +1,80 @@
+package linux
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/paypal/gatt/linux/internal/cmd"
+)
+
+func TestAcceptList(t *testing.T) {
+	h, d := newTestHCI(new(uint64))
+	defer h.Close()
+	a := [6]byte{1, 2, 3, 4, 5, 6}
+	b := [6]byte{1, 2, 3, 4, 5, 0xC7}
+	if err := h.AddToAcceptList(a, AddrPublic); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.AddToAcceptList(b, AddrRandom); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.AddToAcceptList(a, AddrPublic); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.AddToAcceptList(a, AddrRandomIdentity); err == nil {
+		t.Error("AddToAcceptList of an identity address type succeeded")
+	}
+	sent := d.sent()
+	if len(sent) != 2 || !bytes.Equal(sent[0][3:], []byte{7, AddrPublic, 6, 5, 4, 3, 2, 1}) {
+		t.Errorf("commands sent adding 2 devices, one twice:\n\t% X", sent)
+	}
+	if err := h.RemoveFromAcceptList(a, AddrPublic); err != nil {
+		t.Fatal(err)
+	}
+	if l := h.AcceptList(); len(l) != 1 || l[0] != (AcceptListEntry{b, AddrRandom}) {
+		t.Errorf("AcceptList = %v, want the random device only", l)
+	}
+
+	// The controller, once reset, has the devices added again.
+	d.sent()
+	if err := h.ResetDeviceCtx(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	added := 0
+	for _, p := range d.sent() {
+		if cmd.Opcode(uint16(p[1])|uint16(p[2])<<8) == (cmd.LEAddDeviceToWhiteList{}).Opcode() {
+			added++
+		}
+	}
+	if added != 1 {
+		t.Errorf("%d devices added to the accept list once reset, want 1", added)
+	}
+	if err := h.ClearAcceptList(); err != nil || len(h.AcceptList()) != 0 {
+		t.Errorf("ClearAcceptList = %v, leaving %v", err, h.AcceptList())
+	}
+}
+
+func TestAcceptListFilters(t *testing.T) {
+	h, d := newTestHCI(new(uint64))
+	defer h.Close()
+	h.FilterScanByAcceptList(true)
+	if err := h.Scan(false, false); err != nil {
+		t.Fatal(err)
+	}
+	if p := d.sent()[0]; p[10] != 0x01 {
+		t.Errorf("LE Set Scan Parameters % X, want the accept list filter policy", p)
+	}
+	if err := h.StopScan(); err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		waitSent(t, d, scanOff, "LE Create Connection 96")
+		d.rc <- centralComplete(0x00)
+		<-h.l2c.ConnC()
+	}()
+	if err := h.ConnectAcceptListCtx(context.Background(), ConnParams{}); err != nil {
+		t.Fatal(err)
+	}
+}
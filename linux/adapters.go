@@ -0,0 +1,128 @@
+package linux
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/paypal/gatt/linux/internal/device"
+)
+
+// An Adapter is an HCI device of the kernel, as listed by Adapters.
+type Adapter = device.Adapter
+
+// Adapters returns the HCI devices of the kernel, in the order of their
+// indexes, for DeviceID or DeviceAddr to select one of.
+func Adapters() ([]Adapter, error) {
+	return device.List()
+}
+
+// ErrNoAdapter is returned by OpenHCI when the adapter selected is
+// missing. It lists those found instead.
+type ErrNoAdapter struct {
+	Want  string // e.g. "hci2", or the address selected
+	Found []Adapter
+}
+
+func (e ErrNoAdapter) Error() string {
+	if len(e.Found) == 0 {
+		return fmt.Sprintf("hci: no adapter %s, nor any other", e.Want)
+	}
+	found := make([]string, len(e.Found))
+	for i, a := range e.Found {
+		found[i] = a.String()
+	}
+	return fmt.Sprintf("hci: no adapter %s, only %s", e.Want, strings.Join(found, ", "))
+}
+
+// noAdapter returns the ErrNoAdapter of the adapter want, listing those
+// found, if they can be listed.
+func noAdapter(want string) error {
+	as, _ := Adapters()
+	return ErrNoAdapter{Want: want, Found: as}
+}
+
+// selectAdapter returns the index of the adapter of address addr.
+func selectAdapter(addr [6]byte) (int, error) {
+	as, err := Adapters()
+	if err != nil {
+		return 0, err
+	}
+	for _, a := range as {
+		if a.Addr == addr {
+			return a.ID, nil
+		}
+	}
+	want := fmt.Sprintf("%02X:%02X:%02X:%02X:%02X:%02X", addr[0], addr[1], addr[2], addr[3], addr[4], addr[5])
+	return 0, ErrNoAdapter{Want: want, Found: as}
+}
+
+// Events of the management interface of the kernel.
+const (
+	mgmtIndexAdded   = 0x0004
+	mgmtIndexRemoved = 0x0005
+)
+
+// monitorPoll is how often MonitorAdapters checks whether its context is
+// done, while no adapter comes and goes.
+var monitorPoll = time.Second
+
+// MonitorAdapters calls added with each HCI device of the kernel as it is
+// added, e.g. a USB dongle plugged in, and removed with the index of each
+// one as it is removed, until ctx is done, in which case it returns
+// ctx.Err(), or the management interface of the kernel fails. The calls
+// are made from the calling goroutine, in order; those already present
+// are listed by Adapters. The Addr of an adapter added may be zero, if it
+// has never been up.
+//
+// It lets a long-running gateway open the adapters that appear after it
+// started. The kernel reports an adapter removed as well as it is opened,
+// by this process or another, which takes it over with the user channel,
+// and added back as it is closed; the HCI of an adapter unplugged fails
+// to read instead.
+func MonitorAdapters(ctx context.Context, added func(a Adapter), removed func(id int)) error {
+	ctl, err := device.NewControl(monitorPoll)
+	if err != nil {
+		return fmt.Errorf("hci: control channel: %w", err)
+	}
+	defer ctl.Close()
+	return monitorAdapters(ctx, ctl, device.Get, added, removed)
+}
+
+// monitorAdapters reads the events of the management interface from r,
+// and calls added with the adapter, got with get, of index each one added,
+// and removed with that of each one removed.
+func monitorAdapters(ctx context.Context, r io.Reader, get func(id int) (Adapter, error), added func(a Adapter), removed func(id int)) error {
+	b := make([]byte, 512)
+	for {
+		n, err := r.Read(b)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EINTR) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("hci: control channel: %w", err)
+		}
+		if n < 6 {
+			continue
+		}
+		id := int(binary.LittleEndian.Uint16(b[2:]))
+		switch binary.LittleEndian.Uint16(b) {
+		case mgmtIndexAdded:
+			a, err := get(id)
+			if err != nil {
+				a = Adapter{ID: id} // not ready to be queried yet
+			}
+			added(a)
+		case mgmtIndexRemoved:
+			removed(id)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package linux
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+func TestErrNoAdapter(t *testing.T) {
+	for _, tt := range []struct {
+		err  ErrNoAdapter
+		want string
+	}{
+		{ErrNoAdapter{Want: "hci2"}, "hci: no adapter hci2, nor any other"},
+		{
+			ErrNoAdapter{Want: "hci2", Found: []Adapter{
+				{ID: 0, Addr: [6]byte{0x00, 0x1A, 0x7D, 0xDA, 0x71, 0x13}, Up: true},
+				{ID: 1},
+			}},
+			"hci: no adapter hci2, only hci0 (00:1A:7D:DA:71:13, up), hci1 (00:00:00:00:00:00, down)",
+		},
+	} {
+		if got := tt.err.Error(); got != tt.want {
+			t.Errorf("Error() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+// controlEvents stands in for the control channel, its reads timing out
+// once the events are read.
+type controlEvents struct {
+	evts   chan []byte
+	cancel context.CancelFunc
+}
+
+func (c controlEvents) Read(b []byte) (int, error) {
+	select {
+	case e := <-c.evts:
+		return copy(b, e), nil
+	default:
+		c.cancel()
+		return 0, syscall.EAGAIN
+	}
+}
+
+func TestMonitorAdapters(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := controlEvents{evts: make(chan []byte, 8), cancel: cancel}
+	c.evts <- []byte{0x04, 0x00, 0x01, 0x00, 0x00, 0x00}       // Index Added, hci1
+	c.evts <- []byte{0x06, 0x00, 0x01, 0x00, 0x01, 0x00, 0x01} // New Settings: ignored
+	c.evts <- []byte{0x04, 0x00, 0x02, 0x00, 0x00, 0x00}       // Index Added, hci2, not ready
+	c.evts <- []byte{0x05, 0x00, 0x01, 0x00, 0x00, 0x00}       // Index Removed, hci1
+	c.evts <- []byte{0x05, 0x00}                               // truncated
+	get := func(id int) (Adapter, error) {
+		if id != 1 {
+			return Adapter{}, syscall.ENODEV
+		}
+		return Adapter{ID: 1, Addr: [6]byte{0x00, 0x1A, 0x7D, 0xDA, 0x71, 0x13}, Up: true}, nil
+	}
+	var got []string
+	err := monitorAdapters(ctx, c, get,
+		func(a Adapter) { got = append(got, "added "+a.String()) },
+		func(id int) { got = append(got, fmt.Sprintf("removed hci%d", id)) },
+	)
+	if err != context.Canceled {
+		t.Errorf("monitorAdapters() = %v, want context.Canceled", err)
+	}
+	want := []string{
+		"added hci1 (00:1A:7D:DA:71:13, up)",
+		"added hci2 (00:00:00:00:00:00, down)",
+		"removed hci1",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("reported %q, want %q", got, want)
+	}
+
+	failing := func(b []byte) (int, error) { return 0, syscall.EBADF }
+	if err := monitorAdapters(context.Background(), readerFunc(failing), get, nil, nil); !errors.Is(err, syscall.EBADF) {
+		t.Errorf("monitorAdapters() over a channel failing = %v, want EBADF", err)
+	}
+}
+
+type readerFunc func(b []byte) (int, error)
+
+func (f readerFunc) Read(b []byte) (int, error) { return f(b) }
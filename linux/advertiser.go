@@ -14,11 +14,16 @@ type advertiser struct {
 	advertisingIntervalMin uint16
 	advertisingIntervalMax uint16
 	advertisingChannelMap  uint8
+	randomAddress          [6]byte // advertised with, if not zero
+	extended               bool    // with the extended advertising commands
 
-	serving   bool
+	serving   bool // advertising is enabled
+	wanted    bool // advertising is started, and not stopped by Stop
 	servingmu *sync.RWMutex
 
-	cmd *cmd.Cmd
+	cmd   *cmd.Cmd
+	roles *roles     // of the HCI, if created by HCI.NewAdvertiser
+	caps  *capsState // likewise
 }
 
 func NewAdvertiser(c *cmd.Cmd) *advertiser {
@@ -47,59 +52,109 @@ func (a *advertiser) Serving() bool {
 	return a.serving
 }
 
-// Start starts advertising.
+// Start starts advertising. While a connection is initiated, by a
+// controller that cannot advertise at the same time, advertising starts
+// once the connection completes. Start fails with ErrUnsupported if the
+// controller cannot advertise while scanning, or while connected, as it
+// is.
 func (a *advertiser) Start() error {
-	a.SetServing(true)
-	return a.cmd.SendAndCheckResp(cmd.LESetAdvertiseEnable{AdvertisingEnable: 1}, []byte{0x00})
+	a.servingmu.Lock()
+	a.wanted = true
+	a.servingmu.Unlock()
+	if a.roles != nil {
+		return a.roles.startAdv(a)
+	}
+	return a.enable()
 }
 
 // Stop stops advertising.
 func (a *advertiser) Stop() error {
+	a.servingmu.Lock()
+	a.wanted = false
+	a.servingmu.Unlock()
+	if a.roles != nil {
+		a.roles.stopAdv(a)
+	}
+	return a.disable()
+}
+
+// Resume restarts advertising, stopped by the controller as it accepted
+// a connection, unless it has been stopped with Stop since.
+func (a *advertiser) Resume() error {
+	a.servingmu.RLock()
+	resume := a.wanted && !a.serving
+	a.servingmu.RUnlock()
+	if !resume {
+		return nil
+	}
+	return a.Start()
+}
+
+func (a *advertiser) enable() error {
+	a.SetServing(true)
+	if a.extended {
+		return a.setExtEnable(true)
+	}
+	return a.cmd.SendAndCheckResp(cmd.LESetAdvertiseEnable{AdvertisingEnable: 1}, []byte{0x00})
+}
+
+func (a *advertiser) disable() error {
 	a.SetServing(false)
+	if a.extended {
+		return a.setExtEnable(false)
+	}
 	return a.cmd.SendAndCheckResp(cmd.LESetAdvertiseEnable{AdvertisingEnable: 0}, []byte{0x00})
 }
 
 func (a *advertiser) AdvertiseService() error {
+	if err := a.check(); err != nil {
+		return err
+	}
 	if a.Serving() {
-		a.Stop()
-		defer a.Start()
+		a.disable()
+		defer a.enable()
 	}
 	a.servingmu.RLock()
 	defer a.servingmu.RUnlock()
 
+	ownAddressType := uint8(AddrPublic)
+	var ra [6]byte
+	if a.randomAddress != ([6]byte{}) {
+		// Most significant byte first, as marshaled.
+		for i, b := range a.randomAddress {
+			ra[5-i] = b
+		}
+		ownAddressType = AddrRandom
+	}
+	if a.extended {
+		if err := a.setExtParameters(ownAddressType, ra); err != nil {
+			return err
+		}
+		return a.setExtData(extData(append(a.advertisingPacket, a.manufacturerData...), a.scanResponsePacket), false)
+	}
+	if ownAddressType == AddrRandom {
+		if err := a.cmd.SendAndCheckResp(cmd.LESetRandomAddress{RandomAddress: ra}, []byte{0x00}); err != nil {
+			return err
+		}
+	}
 	if err := a.cmd.SendAndCheckResp(
 		cmd.LESetAdvertisingParameters{
 			AdvertisingIntervalMin: a.advertisingIntervalMin,
 			AdvertisingIntervalMax: a.advertisingIntervalMax,
+			OwnAddressType:         ownAddressType,
 			AdvertisingChannelMap:  a.advertisingChannelMap,
 		}, []byte{0x00}); err != nil {
 		return err
 	}
 
 	if len(a.scanResponsePacket) > 0 {
-		// Scan response command takes exactly 31 bytes data
-		// The length indicating the significant part of the data.
-		data := [31]byte{}
-		n := copy(data[:31], a.scanResponsePacket)
-		if err := a.cmd.SendAndCheckResp(
-			cmd.LESetScanResponseData{
-				ScanResponseDataLength: uint8(n),
-				ScanResponseData:       data,
-			}, []byte{0x00}); err != nil {
+		if err := a.setScanResponseData(a.scanResponsePacket); err != nil {
 			return err
 		}
 	}
 
 	if len(a.advertisingPacket) > 0 {
-		// Advertising data command takes exactly 31 bytes data, including manufacture data.
-		// The length indicating the significant part of the data.
-		data := [31]byte{}
-		n := copy(data[:31], append(a.advertisingPacket, a.manufacturerData...))
-		if err := a.cmd.SendAndCheckResp(
-			cmd.LESetAdvertisingData{
-				AdvertisingDataLength: uint8(n),
-				AdvertisingData:       data,
-			}, []byte{0x00}); err != nil {
+		if err := a.setAdvertisingData(append(a.advertisingPacket, a.manufacturerData...)); err != nil {
 			return err
 		}
 	}
@@ -107,6 +162,45 @@ func (a *advertiser) AdvertiseService() error {
 	return nil
 }
 
+// setAdvertisingData sets the advertising data, which the controller
+// takes even while advertising.
+func (a *advertiser) setAdvertisingData(b []byte) error {
+	// Advertising data command takes exactly 31 bytes data, including manufacture data.
+	// The length indicating the significant part of the data.
+	data := [31]byte{}
+	n := copy(data[:31], b)
+	return a.cmd.SendAndCheckResp(
+		cmd.LESetAdvertisingData{
+			AdvertisingDataLength: uint8(n),
+			AdvertisingData:       data,
+		}, []byte{0x00})
+}
+
+// setData sets the advertising data ad, and the scan response data sr.
+func (a *advertiser) setData(ad, sr []byte) error {
+	if a.extended {
+		return a.setExtData(extData(ad, sr), a.Serving())
+	}
+	if err := a.setAdvertisingData(ad); err != nil {
+		return err
+	}
+	return a.setScanResponseData(sr)
+}
+
+// setScanResponseData sets the scan response data, which the controller
+// takes even while advertising.
+func (a *advertiser) setScanResponseData(b []byte) error {
+	// Scan response command takes exactly 31 bytes data
+	// The length indicating the significant part of the data.
+	data := [31]byte{}
+	n := copy(data[:31], b)
+	return a.cmd.SendAndCheckResp(
+		cmd.LESetScanResponseData{
+			ScanResponseDataLength: uint8(n),
+			ScanResponseData:       data,
+		}, []byte{0x00})
+}
+
 type Option func(*advertiser) Option
 
 // Option sets the options specified.
@@ -147,7 +241,7 @@ func ScanResponsePacket(b []byte) Option {
 // ManufacturerData is an optional custom data.
 // If set, it will be appended in the advertising data.
 // The length of AdvertisingPacket ManufactureData must be no longer
-// than MaxAdvertisingPacketLength .
+// than MaxAdvertisingPacketLength.
 func ManufacturerData(b []byte) Option {
 	return func(a *advertiser) Option {
 		prev := a.manufacturerData
@@ -187,3 +281,16 @@ func AdvertisingChannelMap(n uint8) Option {
 		return AdvertisingChannelMap(prev)
 	}
 }
+
+// RandomAddress is an optional parameter.
+// If set, the random address b, least significant byte first, as in the
+// advertising reports, is advertised with, rather than the public
+// address of the controller. The controller takes it only while it is
+// neither advertising nor scanning.
+func RandomAddress(b [6]byte) Option {
+	return func(a *advertiser) Option {
+		prev := a.randomAddress
+		a.randomAddress = b
+		return RandomAddress(prev)
+	}
+}
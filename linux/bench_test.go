@@ -0,0 +1,349 @@
+package linux
+
+import (
+	"flag"
+	"io"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/paypal/gatt/linux/internal/cmd"
+	"github.com/paypal/gatt/linux/internal/event"
+)
+
+var soak = flag.Duration("soak", 0, "run the soak test for the given duration")
+
+// fakeDevice stands in for the HCI socket. Packets sent on rc are read by
+// the HCI. Commands written by the HCI succeed, as they would with a
+// controller, unless status says otherwise, returning the parameters of
+// rsp, if any, and are recorded, as is the L2CAP payload of the ACL data
+// it writes, and the ISO data.
+type fakeDevice struct {
+	rc chan []byte
+
+	mu     sync.Mutex
+	closed bool
+	rsp    map[cmd.Opcode][]byte
+	status map[cmd.Opcode][]uint8 // of the next commands of each opcode; 0 once used up
+	cmds   [][]byte
+	acl    [][]byte
+	iso    [][]byte
+}
+
+func newFakeDevice() *fakeDevice { return &fakeDevice{rc: make(chan []byte, 256)} }
+
+func (d *fakeDevice) Read(b []byte) (int, error) {
+	p, ok := <-d.rc
+	if !ok {
+		return 0, io.EOF
+	}
+	return copy(b, p), nil
+}
+
+func (d *fakeDevice) Write(b []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return 0, io.ErrClosedPipe
+	}
+	if len(b) > 9 && PacketType(b[0]) == ptypeACLDataPkt {
+		d.acl = append(d.acl, append([]byte(nil), b[9:]...))
+	}
+	if len(b) > 0 && PacketType(b[0]) == ptypeISODataPkt {
+		d.iso = append(d.iso, append([]byte(nil), b[1:]...))
+	}
+	if len(b) < 4 || PacketType(b[0]) != ptypeCommandPkt {
+		return len(b), nil
+	}
+	op := cmd.Opcode(uint16(b[1]) | uint16(b[2])<<8)
+	d.cmds = append(d.cmds, append([]byte(nil), b...))
+	if op == (cmd.Disconnect{}).Opcode() {
+		d.rc <- []byte{0x04, 0x0F, 0x04, 0x00, 0x01, b[1], b[2]} // Command Status
+		d.rc <- []byte{0x04, 0x05, 0x04, 0x00, b[4], b[5], b[6]} // Disconnection Complete
+	} else {
+		var st uint8
+		if s := d.status[op]; len(s) > 0 {
+			st, d.status[op] = s[0], s[1:]
+		}
+		rp := append([]byte{st}, d.rsp[op]...)
+		d.rc <- append([]byte{0x04, 0x0E, byte(3 + len(rp)), 0x01, b[1], b[2]}, rp...) // Command Complete
+	}
+	return len(b), nil
+}
+
+// sent returns the commands written so far, and forgets them.
+func (d *fakeDevice) sent() [][]byte {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	cmds := d.cmds
+	d.cmds = nil
+	return cmds
+}
+
+// sentACL returns the L2CAP payloads written so far, and forgets them.
+func (d *fakeDevice) sentACL() [][]byte {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	acl := d.acl
+	d.acl = nil
+	return acl
+}
+
+// sentISO returns the ISO data packets written so far, their header
+// first, and forgets them.
+func (d *fakeDevice) sentISO() [][]byte {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	iso := d.iso
+	d.iso = nil
+	return iso
+}
+
+func (d *fakeDevice) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.closed {
+		d.closed = true
+		close(d.rc)
+	}
+	return nil
+}
+
+type fakeAdv struct{}
+
+func (fakeAdv) Start() error    { return nil }
+func (fakeAdv) Stop() error     { return nil }
+func (fakeAdv) Serving() bool   { return false }
+func (fakeAdv) SetServing(bool) {}
+func (fakeAdv) Resume() error   { return nil }
+
+var advReportPkt = []byte{
+	0x04, 0x3E, 0x1E, // LE Meta event
+	0x02, 0x01, // LE Advertising Report, 1 report
+	0x00, 0x00, // ADV_IND, public address
+	0x11, 0x22, 0x33, 0x44, 0x55, 0x66,
+	0x12, // data length
+	0x02, 0x01, 0x06,
+	0x0E, 0x09, 'g', 'a', 't', 't', '-', 'b', 'e', 'n', 'c', 'h', 'm', 'a', 'r',
+	0xC5, // RSSI
+}
+
+var connCompletePkt = []byte{
+	0x04, 0x3E, 0x13, // LE Meta event
+	0x01, 0x00, // LE Connection Complete, success
+	0x40, 0x00, // handle
+	0x01, 0x00, // slave, public address
+	0x11, 0x22, 0x33, 0x44, 0x55, 0x66,
+	0x18, 0x00, // interval
+	0x00, 0x00, // latency
+	0xC8, 0x00, // supervision timeout
+	0x00,
+}
+
+var aclPkt = []byte{
+	0x02,       // ACL data
+	0x40, 0x20, // handle, first flushable
+	0x0B, 0x00, // data length
+	0x07, 0x00, 0x04, 0x00, // L2CAP header: length, ATT channel
+	0x1B, 0x0D, 0x00, 'g', 'a', 't', 't',
+}
+
+// newTestHCI returns an HCI reading from a fake device, and counts the LE
+// advertising reports it dispatches.
+func newTestHCI(reports *uint64) (*HCI, *fakeDevice) {
+	d := newFakeDevice()
+	h := newHCI(d, defaultHCIConfig())
+	h.l2c.Adv = fakeAdv{}
+	h.evt.HandleEvent(event.LEMeta, event.HandlerFunc(func(b []byte) error {
+		if len(b) > 0 && event.LEEventCode(b[0]) == event.LEAdvertisingReport {
+			atomic.AddUint64(reports, 1)
+			return nil
+		}
+		return h.handleLEMeta(b)
+	}))
+	h.startReading()
+	return h, d
+}
+
+func waitFor(n *uint64, want uint64) {
+	for atomic.LoadUint64(n) < want {
+		runtime.Gosched()
+	}
+}
+
+func BenchmarkAdvertisingReports(b *testing.B) {
+	var n uint64
+	h, d := newTestHCI(&n)
+	defer h.Close()
+	h.SetDropPolicy(WaitWhenFull) // every packet handled
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		d.rc <- advReportPkt
+	}
+	waitFor(&n, uint64(b.N))
+}
+
+func BenchmarkAdvertisingReportRing(b *testing.B) {
+	var n uint64
+	h, d := newTestHCI(&n)
+	defer h.Close()
+	h.scan.setEnabled(true)
+	done := make(chan struct{})
+	go func() {
+		rs := make([]AdvReport, 32)
+		for got := 0; got+int(h.DroppedAdvReports()) < b.N; {
+			k, err := h.ReadAdvReports(rs)
+			if err != nil {
+				break
+			}
+			got += k
+		}
+		close(done)
+	}()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		d.rc <- advReportPkt
+	}
+	<-done
+}
+
+func BenchmarkACLData(b *testing.B) {
+	var n uint64
+	h, d := newTestHCI(&n)
+	defer h.Close()
+	h.SetDropPolicy(WaitWhenFull) // every packet handled
+	d.rc <- connCompletePkt
+	c := <-h.l2c.ConnC()
+	buf := make([]byte, 64)
+	b.ReportAllocs()
+	b.ResetTimer()
+	go func() {
+		for i := 0; i < b.N; i++ {
+			d.rc <- aclPkt
+		}
+	}()
+	for i := 0; i < b.N; i++ {
+		if _, err := c.Read(buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// TestSoak floods the HCI with a mix of advertising reports and ACL data,
+// and checks that nothing is dropped, under WaitWhenFull, and that neither goroutines nor the
+// heap grow over time. It only runs with -soak.
+func TestSoak(t *testing.T) {
+	if *soak == 0 {
+		t.Skip("soak test skipped; enable it with -soak <duration>")
+	}
+	gb := runtime.NumGoroutine()
+	var n uint64
+	h, d := newTestHCI(&n)
+	h.SetDropPolicy(WaitWhenFull) // the flood outruns the handlers
+	d.rc <- connCompletePkt
+	c := <-h.l2c.ConnC()
+
+	var acl uint64
+	read := make(chan struct{})
+	go func() {
+		defer close(read)
+		buf := make([]byte, 64)
+		for {
+			if _, err := c.Read(buf); err != nil {
+				return
+			}
+			atomic.AddUint64(&acl, 1)
+		}
+	}()
+	g0 := runtime.NumGoroutine()
+
+	var m0, m1 runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&m0)
+	start := time.Now()
+	var sent uint64
+	for time.Since(start) < *soak {
+		for i := 0; i < 1000; i++ {
+			d.rc <- advReportPkt
+			d.rc <- aclPkt
+		}
+		sent += 1000
+	}
+	waitFor(&n, sent)
+	waitFor(&acl, sent)
+	elapsed := time.Since(start)
+	runtime.GC()
+	runtime.ReadMemStats(&m1)
+
+	t.Logf("%d reports and %d ACL packets in %v: %.0f pkts/s, %.1f allocs/pkt",
+		n, acl, elapsed, float64(2*sent)/elapsed.Seconds(),
+		float64(m1.Mallocs-m0.Mallocs)/float64(2*sent))
+	if d := h.Dropped(); d != 0 {
+		t.Errorf("dropped %d packets", d)
+	}
+	if m1.HeapInuse > 2*m0.HeapInuse+1<<20 {
+		t.Errorf("heap grew from %d to %d bytes", m0.HeapInuse, m1.HeapInuse)
+	}
+
+	if err := h.Close(); err != nil {
+		t.Fatalf("Close = %v", err)
+	}
+	<-read
+	if g := settledGoroutines(gb); g > gb {
+		t.Errorf("goroutines: %d before, %d while running, %d after", gb, g0, g)
+	}
+}
+
+// settledGoroutines returns the number of goroutines, once it has dropped
+// to n, or after a second. Goroutines that have signalled they are done
+// may take a moment to exit.
+func settledGoroutines(n int) int {
+	g := runtime.NumGoroutine()
+	for deadline := time.Now().Add(time.Second); g > n && time.Now().Before(deadline); g = runtime.NumGoroutine() {
+		time.Sleep(time.Millisecond)
+	}
+	return g
+}
+
+// notificationPkt returns an ACL data packet of handle 0x0040 carrying an
+// ATT notification of value v, in a single fragment.
+func notificationPkt(v []byte) []byte {
+	n := 3 + len(v)
+	b := []byte{
+		0x02,       // ACL data
+		0x40, 0x20, // handle, first flushable
+		byte(n + 4), byte((n + 4) >> 8),
+		byte(n), byte(n >> 8), 0x04, 0x00, // L2CAP header: length, ATT channel
+		0x1B, 0x0D, 0x00, // Handle Value Notification, handle 0x000D
+	}
+	return append(b, v...)
+}
+
+// BenchmarkNotifications receives notifications of the longest value the
+// LE data packets of 251 bytes carry, whose buffers are pooled.
+func BenchmarkNotifications(b *testing.B) {
+	var n uint64
+	h, d := newTestHCI(&n)
+	defer h.Close()
+	h.SetDropPolicy(WaitWhenFull) // every packet handled
+	d.rc <- connCompletePkt
+	c := <-h.l2c.ConnC()
+	pkt := notificationPkt(make([]byte, 251-4-3))
+	buf := make([]byte, 512)
+	b.ReportAllocs()
+	b.ResetTimer()
+	go func() {
+		for i := 0; i < b.N; i++ {
+			d.rc <- pkt
+		}
+	}()
+	for i := 0; i < b.N; i++ {
+		if _, err := c.Read(buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package linux
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"sync"
+
+	"github.com/paypal/gatt/linux/internal/cmd"
+)
+
+// Capabilities are those of the controller, read once, as the HCI
+// starts, so that the application, and the layers of the HCI, tell what
+// it supports without querying it. Those it cannot report, e.g. as it
+// predates the commands reporting them, are left zero.
+type Capabilities struct {
+	// ACLDataLength is the largest LE ACL data packet the controller
+	// takes, in bytes, and ACLDataPackets the number it buffers; both
+	// are zero if they are shared with BR/EDR.
+	ACLDataLength  int
+	ACLDataPackets int
+
+	// LEFeatures are the LE features supported, as the bits of the LE
+	// Features of the Core Specification, e.g. bit 0 for LE Encryption,
+	// or bit 12 for LE Extended Advertising.
+	LEFeatures uint64
+
+	// States are the combinations of LE states supported, as the bits of
+	// LE_States.
+	States uint64
+
+	// WhiteListSize and ResolvingListSize are the numbers of entries of
+	// the white list, and of the resolving list of the LE Privacy
+	// feature (Bluetooth 4.2).
+	WhiteListSize     int
+	ResolvingListSize int
+
+	// Manufacturer is the company identifier of the manufacturer of the
+	// controller, e.g. ManufacturerBroadcom, and HCIVersion the version
+	// of the Core Specification it implements, e.g. 9 for 5.0.
+	Manufacturer int
+	HCIVersion   int
+
+	// MaxDataLength is the largest payload of the link-layer data PDUs
+	// the controller sends, in bytes, and MaxDataTime the time they
+	// take, in µs: 27 bytes without the LE Data Packet Length Extension
+	// feature (Bluetooth 4.2), up to 251 with it.
+	MaxDataLength int
+	MaxDataTime   int
+
+	// MaxAdvDataLength is the longest advertising data the controller
+	// takes, in bytes: 31 without the LE Extended Advertising feature
+	// (Bluetooth 5.0), up to 1650 with it.
+	MaxAdvDataLength int
+
+	// Commands are the HCI commands supported, as the octets of the
+	// Supported_Commands of the Core Specification, Vol 4, Part E, 6.27;
+	// see SupportsCommand.
+	Commands [64]byte
+}
+
+// SupportsCommand reports whether the controller supports the command of
+// the given bit of the given octet of the Commands, e.g. octet 25, bit 2
+// for LE Read Local Supported Features. Controllers predating the Read
+// Local Supported Commands command report none.
+func (c Capabilities) SupportsCommand(octet, bit uint) bool {
+	return octet < uint(len(c.Commands)) && bit < 8 && c.Commands[octet]&(1<<bit) != 0
+}
+
+// commandBits are the octets, and bits, of the Supported_Commands of the
+// commands of the setup sequences, but those of the vendors, which the
+// sequences skip when unsupported.
+var commandBits = map[cmd.Opcode][2]uint{
+	cmd.WriteDefaultLinkPolicy{}.Opcode(): {5, 4},
+	cmd.WritePageTimeout{}.Opcode():       {7, 5},
+	cmd.WriteClassOfDevice{}.Opcode():     {9, 1},
+	cmd.HostBufferSize{}.Opcode():         {10, 6},
+	cmd.WriteInquiryScanType{}.Opcode():   {12, 5},
+	cmd.WriteInquiryMode{}.Opcode():       {12, 7},
+	cmd.WritePageScanType{}.Opcode():      {13, 1},
+	cmd.WriteLEHostSupported{}.Opcode():   {24, 6},
+}
+
+// capsState holds the Capabilities, once read.
+type capsState struct {
+	mu       sync.Mutex
+	caps     Capabilities
+	version  cmd.ReadLocalVersionInformationRP // read ahead of the setup
+	commands [64]byte                          // likewise, none if not reported
+}
+
+// Capabilities returns the capabilities of the controller, read as the
+// HCI started, or zero values before.
+func (h HCI) Capabilities() Capabilities {
+	h.caps.mu.Lock()
+	defer h.caps.mu.Unlock()
+	return h.caps.caps
+}
+
+// readSupportedCommands reads the commands the controller supports, ahead
+// of its setup, for the setup sequences to skip those it does not.
+func (h HCI) readSupportedCommands(ctx context.Context) {
+	var rp cmd.ReadLocalSupportedCommandsRP
+	h.read(ctx, cmd.ReadLocalSupportedCommands{}, &rp)
+	h.caps.mu.Lock()
+	h.caps.commands = rp.SupportedCommands
+	h.caps.mu.Unlock()
+}
+
+// supportsCommand reports whether the controller supports the command of
+// the opcode, as far as it tells: it is assumed to if it does not report
+// its commands, or the command is not among those of commandBits.
+func (h HCI) supportsCommand(op cmd.Opcode) bool {
+	b, found := commandBits[op]
+	if !found {
+		return true
+	}
+	h.caps.mu.Lock()
+	defer h.caps.mu.Unlock()
+	cs := h.caps.commands
+	return cs == [64]byte{} || cs[b[0]]&(1<<b[1]) != 0
+}
+
+// readCapabilities reads the capabilities of the controller, once it has
+// been reset, and its supported states read.
+func (h HCI) readCapabilities(ctx context.Context) {
+	var c Capabilities
+	var buf cmd.LEReadBufferSizeRP
+	if h.read(ctx, cmd.LEReadBufferSize{}, &buf) {
+		c.ACLDataLength, c.ACLDataPackets = int(buf.HCLEACLDataPacketLength), int(buf.HCTotalNumLEACLDataPackets)
+	}
+	var feat cmd.LEReadLocalSupportedFeaturesRP
+	if h.read(ctx, cmd.LEReadLocalSupportedFeatures{}, &feat) {
+		c.LEFeatures = feat.LEFeatures
+	}
+	h.roles.mu.Lock()
+	c.States = h.roles.states
+	h.roles.mu.Unlock()
+	var wl cmd.LEReadWhiteListSizeRP
+	if h.read(ctx, cmd.LEReadWhiteListSize{}, &wl) {
+		c.WhiteListSize = int(wl.WhiteListSize)
+	}
+	var rl cmd.LEReadResolvingListSizeRP
+	if h.read(ctx, cmd.LEReadResolvingListSize{}, &rl) {
+		c.ResolvingListSize = int(rl.ResolvingListSize)
+	}
+	c.MaxDataLength, c.MaxDataTime = 27, 328
+	var dl cmd.LEReadMaximumDataLengthRP
+	if c.LEFeatures&leDataPacketLengthExtension != 0 && h.read(ctx, cmd.LEReadMaximumDataLength{}, &dl) {
+		c.MaxDataLength, c.MaxDataTime = int(dl.SupportedMaxTxOctets), int(dl.SupportedMaxTxTime)
+	}
+	c.MaxAdvDataLength = 31
+	var adv cmd.LEReadMaximumAdvertisingDataLengthRP
+	if c.LEFeatures&leExtendedAdvertising != 0 && h.read(ctx, cmd.LEReadMaximumAdvertisingDataLength{}, &adv) {
+		c.MaxAdvDataLength = int(adv.MaximumAdvertisingDataLength)
+	}
+	h.caps.mu.Lock()
+	c.Manufacturer, c.HCIVersion = int(h.caps.version.ManufacturerName), int(h.caps.version.HCIVersion)
+	c.Commands = h.caps.commands
+	h.caps.caps = c
+	h.caps.mu.Unlock()
+}
+
+// setDataLength sets the L2CAP up to fragment the ACL data to the size
+// the controller takes, and, if the controller supports the LE Data
+// Packet Length Extension, to negotiate the data length set by the
+// DataLength option for each connection, which the controller is set to
+// suggest by default as well.
+func (h HCI) setDataLength(ctx context.Context) {
+	c := h.Capabilities()
+	octets, time := c.MaxDataLength, c.MaxDataTime
+	if h.dataLength > 0 && h.dataLength < octets {
+		octets = h.dataLength
+	}
+	if octets > 27 {
+		// Not all the controllers take the command, which is only a
+		// hint; the connections are set up regardless.
+		h.cmd.SendAndCheckRespCtx(ctx, cmd.LEWriteSuggestedDefaultDataLength{
+			SuggestedMaxTxOctets: uint16(octets),
+			SuggestedMaxTxTime:   uint16(time),
+		}, expSuccess)
+	}
+	h.l2c.SetDataLength(uint16(octets), uint16(time), c.ACLDataLength)
+}
+
+// Bits of the LE features.
+const (
+	leDataPacketLengthExtension = 1 << 5
+	leExtendedAdvertising       = 1 << 12
+	lePeriodicAdvertising       = 1 << 13
+	leCISCentral                = 1 << 28
+	leCISPeripheral             = 1 << 29
+)
+
+// Host-controlled LE features, numbered as the bits of the LE Features,
+// that the host enables with SetHostFeature (Bluetooth 5.2).
+const (
+	HostFeatureCIS = 32 // Connected Isochronous Stream (Host Support)
+)
+
+// SetHostFeature sets the host-controlled LE feature of the given bit, e.g.
+// HostFeatureCIS, on or off, and reflects it in the LEFeatures of the
+// Capabilities. Some features, CIS among them, are shared by all the
+// connections, and cannot be changed while any is established; the
+// controller then fails the command with Command Disallowed.
+func (h HCI) SetHostFeature(bit uint8, on bool) error {
+	var v uint8
+	if on {
+		v = 1
+	}
+	if err := h.cmd.SendAndCheckResp(cmd.LESetHostFeature{BitNumber: bit, BitValue: v}, expSuccess); err != nil {
+		return err
+	}
+	h.caps.mu.Lock()
+	defer h.caps.mu.Unlock()
+	if on {
+		h.caps.caps.LEFeatures |= 1 << bit
+	} else {
+		h.caps.caps.LEFeatures &^= 1 << bit
+	}
+	return nil
+}
+
+// read sends the command cp, and decodes its return parameters into rp,
+// whose first field is the status, and reports whether it succeeded.
+func (h HCI) read(ctx context.Context, cp cmd.CmdParam, rp interface{}) bool {
+	b, err := h.cmd.SendCtx(ctx, cp)
+	if err != nil || len(b) == 0 || b[0] != 0x00 {
+		return false
+	}
+	return binary.Read(bytes.NewReader(b), binary.LittleEndian, rp) == nil
+}
@@ -0,0 +1,125 @@
+package linux
+
+import (
+	"context"
+	"testing"
+
+	"github.com/paypal/gatt/linux/internal/cmd"
+)
+
+func TestCapabilities(t *testing.T) {
+	d := newFakeDevice()
+	d.rsp = map[cmd.Opcode][]byte{
+		cmd.LEReadBufferSize{}.Opcode():                   {0xFB, 0x00, 0x08},
+		cmd.LEReadLocalSupportedFeatures{}.Opcode():       {0x21, 0x10, 0, 0, 0, 0, 0, 0},
+		cmd.LEReadSupportedStates{}.Opcode():              {0xFF, 0x03, 0, 0, 0, 0, 0, 0},
+		cmd.LEReadWhiteListSize{}.Opcode():                {8},
+		cmd.LEReadResolvingListSize{}.Opcode():            {16},
+		cmd.LEReadMaximumAdvertisingDataLength{}.Opcode(): {0x72, 0x06},
+		cmd.LEReadMaximumDataLength{}.Opcode():            {0xFB, 0x00, 0x48, 0x08, 0xFB, 0x00, 0x48, 0x08},
+	}
+	h := newHCI(d, defaultHCIConfig())
+	defer h.Close()
+	if c := h.Capabilities(); c != (Capabilities{}) {
+		t.Errorf("Capabilities before Start = %+v", c)
+	}
+	if err := h.StartCtx(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want := Capabilities{
+		ACLDataLength:     251,
+		ACLDataPackets:    8,
+		LEFeatures:        0x1021,
+		States:            0x3FF,
+		WhiteListSize:     8,
+		ResolvingListSize: 16,
+		MaxDataLength:     251,
+		MaxDataTime:       2120,
+		MaxAdvDataLength:  1650,
+	}
+	if c := h.Capabilities(); c != want {
+		t.Errorf("Capabilities = %+v, want %+v", c, want)
+	}
+
+	// A controller that reports nothing: the advertising data, and the
+	// link-layer data, are those of Bluetooth 4.0.
+	d = newFakeDevice()
+	h = newHCI(d, defaultHCIConfig())
+	defer h.Close()
+	if err := h.StartCtx(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if c := h.Capabilities(); c != (Capabilities{MaxDataLength: 27, MaxDataTime: 328, MaxAdvDataLength: 31}) {
+		t.Errorf("Capabilities = %+v, want only the defaults of Bluetooth 4.0", c)
+	}
+}
+
+func TestEnableISOSetsCISHostSupport(t *testing.T) {
+	for _, tt := range []struct {
+		features []byte
+		set      bool
+	}{
+		{[]byte{0, 0, 0, 0x10, 0, 0, 0, 0}, true}, // CIS Central
+		{[]byte{0, 0, 0, 0x20, 0, 0, 0, 0}, true}, // CIS Peripheral
+		{[]byte{0, 0, 0, 0x00, 0, 0, 0, 0}, false},
+	} {
+		d := newFakeDevice()
+		d.rsp = map[cmd.Opcode][]byte{
+			cmd.LEReadLocalSupportedFeatures{}.Opcode(): tt.features,
+			cmd.LEReadBufferSizeV2{}.Opcode():           {0xFB, 0x00, 0x08, 0x40, 0x00, 0x04},
+		}
+		h := newHCI(d, defaultHCIConfig())
+		if err := h.StartCtx(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		d.sent()
+		if err := h.EnableISO(); err != nil {
+			t.Fatal(err)
+		}
+		set := false
+		for _, b := range d.sent() {
+			if cmd.Opcode(uint16(b[1])|uint16(b[2])<<8) == (cmd.LESetHostFeature{}).Opcode() {
+				if b[3] != 2 || b[4] != HostFeatureCIS || b[5] != 1 {
+					t.Errorf("LE Set Host Feature = % X", b)
+				}
+				set = true
+			}
+		}
+		if set != tt.set {
+			t.Errorf("features % X: CIS host support set = %t, want %t", tt.features, set, tt.set)
+		}
+		if got := h.Capabilities().LEFeatures&(1<<HostFeatureCIS) != 0; got != tt.set {
+			t.Errorf("features % X: CIS host support in LEFeatures = %t, want %t", tt.features, got, tt.set)
+		}
+		h.Close()
+	}
+}
+
+func TestSetupSkipsUnsupportedCommands(t *testing.T) {
+	commands := make([]byte, 64)
+	commands[5], commands[7], commands[9], commands[10], commands[12], commands[24] = 0x10, 0x20, 0x02, 0x40, 0xA0, 0x40
+	d := newFakeDevice()
+	d.rsp = map[cmd.Opcode][]byte{
+		cmd.ReadLocalVersionInformation{}.Opcode(): {0x09, 0x00, 0x00, 0x09, ManufacturerBroadcom, 0x00, 0x00, 0x00},
+		cmd.ReadLocalSupportedCommands{}.Opcode():  commands,
+	}
+	d.status = map[cmd.Opcode][]uint8{cmd.WriteInquiryMode{}.Opcode(): {uint8(StatusUnknownCommand)}}
+	h := newHCI(d, defaultHCIConfig())
+	defer h.Close()
+	if err := h.StartCtx(context.Background()); err != nil {
+		t.Fatalf("Start, with a command unsupported, and another rejected = %v", err)
+	}
+	sent := map[cmd.Opcode]bool{}
+	for _, b := range d.sent() {
+		sent[cmd.Opcode(uint16(b[1])|uint16(b[2])<<8)] = true
+	}
+	if sent[cmd.WritePageScanType{}.Opcode()] {
+		t.Error("Write Page Scan Type sent, though not supported")
+	}
+	if !sent[cmd.WriteLEHostSupported{}.Opcode()] || !sent[cmd.HostBufferSize{}.Opcode()] {
+		t.Error("commands supported skipped")
+	}
+	if c := h.Capabilities(); !c.SupportsCommand(24, 6) || c.SupportsCommand(13, 1) {
+		t.Errorf("Commands = % X, want those reported", c.Commands)
+	}
+}
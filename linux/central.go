@@ -0,0 +1,214 @@
+package linux
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/paypal/gatt/linux/internal/cmd"
+	"github.com/paypal/gatt/linux/internal/l2cap"
+)
+
+// ConnParams are the parameters of a connection, initiated by Connect,
+// or updated by the UpdateParams method of the connection.
+type ConnParams = l2cap.ConnParams
+
+// ChannelMap is the set of the data channels a connection hops over, as
+// returned by its ChannelMap method.
+type ChannelMap = l2cap.ChannelMap
+
+// RSSIUnavailable is the RSSI the ReadRSSI method of a connection returns
+// while the controller has not measured any.
+const RSSIUnavailable = l2cap.RSSIUnavailable
+
+// Types of the peer addresses, as the HCI encodes them.
+const (
+	AddrPublic         = 0x00
+	AddrRandom         = 0x01
+	AddrPublicIdentity = 0x02 // resolved by the controller from a private address
+	AddrRandomIdentity = 0x03 // resolved by the controller from a private address
+)
+
+// DefaultConnParams are the ConnParams used when none are specified.
+var DefaultConnParams = ConnParams{
+	IntervalMin:        0x0018, // 30 ms
+	IntervalMax:        0x0028, // 50 ms
+	SupervisionTimeout: 0x01F4, // 5 s
+}
+
+// Errors of the connections initiated by Connect and ConnectCtx.
+var (
+	// ErrPeerNotSeen is returned by ConnectCtx once the deadline of its
+	// context passes before the peer is seen advertising, connectable,
+	// e.g. by directed advertising. It matches context.DeadlineExceeded.
+	ErrPeerNotSeen error = peerNotSeen{}
+
+	// ErrConnectFailed is returned when the peer was seen, and the
+	// connection requested, but it failed to be established, e.g. as the
+	// peer went out of range.
+	ErrConnectFailed = errors.New("hci: connection failed to be established")
+
+	// ErrControllerBusy is returned when the controller cannot initiate
+	// a connection now: it is initiating one already, has as many as it
+	// can, or lacks the resources.
+	ErrControllerBusy = errors.New("hci: controller busy")
+)
+
+type peerNotSeen struct{}
+
+func (peerNotSeen) Error() string     { return "hci: peer not seen advertising" }
+func (peerNotSeen) Is(err error) bool { return err == context.DeadlineExceeded }
+func (peerNotSeen) Timeout() bool     { return true }
+
+// Status codes of the LE Connection Complete event.
+const (
+	statusUnknownConnID     = 0x02 // once canceled
+	statusMemoryExceeded    = 0x07
+	statusConnLimitExceeded = 0x09
+	statusCommandDisallowed = 0x0C
+	statusLimitedResources  = 0x0D
+	statusControllerBusy    = 0x3A
+	statusAdvTimeout        = 0x3C
+	statusConnFailed        = 0x3E
+)
+
+// connectCancelTimeout bounds how long ConnectCtx waits for the
+// connection canceled to complete.
+const connectCancelTimeout = time.Second
+
+// connectErr returns the error of a connection initiated that completed
+// with status.
+func connectErr(status uint8) error {
+	switch status {
+	case 0x00:
+		return nil
+	case statusConnFailed:
+		return fmt.Errorf("%w: %s", ErrConnectFailed, Status(status).String())
+	case statusMemoryExceeded, statusConnLimitExceeded, statusCommandDisallowed, statusLimitedResources, statusControllerBusy:
+		return fmt.Errorf("%w: %s", ErrControllerBusy, Status(status).String())
+	}
+	return ErrCommandFailed{Opcode: cmd.LECreateConn{}.Opcode(), Status: status}
+}
+
+// Connect initiates a connection, as the central, to the peripheral of
+// address peer, of type typ, with the parameters p, or DefaultConnParams if p is the zero value. It returns
+// once the controller has started connecting; the connection, once
+// established, is delivered by the L2CAP's ConnC, like the ones accepted
+// while advertising. Only one connection may be initiated at a time;
+// another one fails with an error matching ErrControllerBusy.
+//
+// Scanning and advertising, if the controller cannot keep them running
+// while it initiates the connection, are paused until it completes, or
+// is canceled.
+func (h HCI) Connect(peer [6]byte, typ uint8, p ConnParams) error {
+	return h.connect(peer, typ, p, false, nil)
+}
+
+// ConnectCtx initiates a connection, like Connect, and waits until it is
+// established, or fails, or ctx is done, in which case the connection is
+// canceled, unless it was established meanwhile. It returns ctx.Err()
+// once ctx is canceled, and otherwise an error matching:
+//
+//   - ErrPeerNotSeen, once the deadline of ctx passes;
+//   - ErrConnectFailed, when the connection failed to be established;
+//   - ErrControllerBusy, when the controller cannot initiate it now.
+//
+// The connection, once established, is delivered by the L2CAP's ConnC.
+func (h HCI) ConnectCtx(ctx context.Context, peer [6]byte, typ uint8, p ConnParams) error {
+	return h.connectCtx(ctx, peer, typ, p, false)
+}
+
+// ConnectAcceptListCtx initiates a connection, like ConnectCtx, to the
+// first peripheral of the accept list found advertising, rather than to
+// a given one; see AddToAcceptList.
+func (h HCI) ConnectAcceptListCtx(ctx context.Context, p ConnParams) error {
+	return h.connectCtx(ctx, [6]byte{}, AddrPublic, p, true)
+}
+
+func (h HCI) connectCtx(ctx context.Context, peer [6]byte, typ uint8, p ConnParams, acceptList bool) error {
+	done := make(chan uint8, 1)
+	if err := h.connect(peer, typ, p, acceptList, done); err != nil {
+		return err
+	}
+	select {
+	case status := <-done:
+		return connectErr(status)
+	case <-ctx.Done():
+	}
+	// Once canceled, the connection completes with Unknown Connection
+	// Identifier, unless it was established meanwhile. One that does not
+	// complete leaves the initiator state to be reset here, rather than
+	// stuck.
+	cerr := h.CancelConnect()
+	select {
+	case status := <-done:
+		if status == 0x00 {
+			return nil
+		}
+	case <-time.After(connectCancelTimeout):
+		h.initiated(statusUnknownConnID)
+		if cerr != nil {
+			return cerr
+		}
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return ErrPeerNotSeen
+	}
+	return ctx.Err()
+}
+
+// connect initiates a connection, to peer, or, if acceptList is set, to
+// the first peripheral of the accept list found, whose status, once it
+// completes, is sent on done, if not nil.
+func (h HCI) connect(peer [6]byte, typ uint8, p ConnParams, acceptList bool, done chan uint8) error {
+	if p == (ConnParams{}) {
+		p = DefaultConnParams
+	}
+	if err := checks(checkRange("PeerAddressType", int(typ), AddrPublic, AddrRandomIdentity), checkConnParams(p)); err != nil {
+		return err
+	}
+	r := h.roles
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := h.initiate(); err != nil {
+		return err
+	}
+	r.connDone = done
+	cp := cmd.LECreateConn{
+		LEScanInterval:     0x0060, // 60 ms
+		LEScanWindow:       0x0030, // 30 ms
+		PeerAddressType:    typ,
+		PeerAddress:        peer,
+		ConnIntervalMin:    p.IntervalMin,
+		ConnIntervalMax:    p.IntervalMax,
+		ConnLatency:        p.Latency,
+		SupervisionTimeout: p.SupervisionTimeout,
+	}
+	if acceptList {
+		cp.InitiatorFilterPolicy = 0x01
+	}
+	err := h.cmd.SendAndCheckResp(cp, expSuccess)
+	var failed ErrCommandFailed
+	if errors.As(err, &failed) && failed.Status == statusCommandDisallowed && h.disallowedInit() {
+		err = h.cmd.SendAndCheckResp(cp, expSuccess)
+	}
+	if err != nil {
+		r.initiating, r.connDone = false, nil
+		h.resume()
+		if errors.As(err, &failed) {
+			return connectErr(failed.Status)
+		}
+		return err
+	}
+	return nil
+}
+
+// CancelConnect cancels the connection being initiated by Connect. The
+// controller then completes it with Unknown Connection Identifier, or,
+// if it was established just as canceled, as usual; CancelConnect then
+// fails with Command Disallowed, as it does when no connection is being
+// initiated.
+func (h HCI) CancelConnect() error {
+	return h.cmd.SendAndCheckResp(cmd.LECreateConnCancel{}, expSuccess)
+}
@@ -0,0 +1,100 @@
+package linux
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// centralComplete returns an LE Connection Complete, as the central,
+// with status.
+func centralComplete(status uint8) []byte {
+	b := append([]byte(nil), connCompletePkt...)
+	b[4], b[7] = status, 0x00
+	return b
+}
+
+func TestConnectCtx(t *testing.T) {
+	peer := [6]byte{1, 2, 3, 4, 5, 6}
+	for _, tt := range []struct {
+		status uint8
+		want   error
+	}{
+		{0x00, nil},
+		{statusConnFailed, ErrConnectFailed},
+		{statusConnLimitExceeded, ErrControllerBusy},
+	} {
+		h, d := newTestHCI(new(uint64))
+		go func(status uint8) {
+			waitSent(t, d, "LE Create Connection 96")
+			d.rc <- centralComplete(status)
+			if status == 0x00 {
+				<-h.l2c.ConnC()
+			}
+		}(tt.status)
+		err := h.ConnectCtx(context.Background(), peer, AddrPublic, ConnParams{})
+		if tt.want == nil && err != nil || tt.want != nil && !errors.Is(err, tt.want) {
+			t.Errorf("status 0x%02X: ConnectCtx = %v, want %v", tt.status, err, tt.want)
+		}
+		h.Close()
+	}
+}
+
+func TestConnectCtxBusy(t *testing.T) {
+	h, d := newTestHCI(new(uint64))
+	defer h.Close()
+	if err := h.Connect([6]byte{1, 2, 3, 4, 5, 6}, AddrPublic, ConnParams{}); err != nil {
+		t.Fatal(err)
+	}
+	d.sent()
+	if err := h.ConnectCtx(context.Background(), [6]byte{1, 2, 3, 4, 5, 7}, AddrPublic, ConnParams{}); !errors.Is(err, ErrControllerBusy) {
+		t.Errorf("ConnectCtx while connecting = %v, want ErrControllerBusy", err)
+	}
+}
+
+func TestConnectCtxCanceled(t *testing.T) {
+	peer := [6]byte{1, 2, 3, 4, 5, 6}
+	h, d := newTestHCI(new(uint64))
+	defer h.Close()
+
+	// The peer is never seen: once canceled, the controller completes
+	// the connection with Unknown Connection Identifier.
+	go func() {
+		waitSent(t, d, "LE Create Connection 96", "LE Create Connection Cancel")
+		d.rc <- centralComplete(statusUnknownConnID)
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := h.ConnectCtx(ctx, peer, AddrPublic, ConnParams{})
+	if !errors.Is(err, ErrPeerNotSeen) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ConnectCtx past its deadline = %v, want ErrPeerNotSeen", err)
+	}
+
+	// A controller that never completes the connection canceled does not
+	// leave the initiator stuck.
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if err := h.ConnectCtx(ctx, peer, AddrPublic, ConnParams{}); err != context.Canceled {
+		t.Errorf("ConnectCtx canceled = %v, want context.Canceled", err)
+	}
+	d.sent()
+	if err := h.Connect(peer, AddrPublic, ConnParams{}); err != nil {
+		t.Errorf("Connect once canceled = %v", err)
+	}
+}
+
+func TestConnectCtxCompletedAsCanceled(t *testing.T) {
+	h, d := newTestHCI(new(uint64))
+	defer h.Close()
+	go func() {
+		waitSent(t, d, "LE Create Connection 96", "LE Create Connection Cancel")
+		d.rc <- centralComplete(0x00)
+		<-h.l2c.ConnC()
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := h.ConnectCtx(ctx, [6]byte{1, 2, 3, 4, 5, 6}, AddrPublic, ConnParams{}); err != nil {
+		t.Errorf("ConnectCtx established as canceled = %v, want nil", err)
+	}
+}
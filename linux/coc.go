@@ -0,0 +1,27 @@
+package linux
+
+import "github.com/paypal/gatt/linux/internal/l2cap"
+
+// A Channel is an LE credit based connection, over the link of a
+// connection, for the protocols that do not run over ATT, e.g. IPSP. It
+// is a net.Conn, opened by the OpenChannel method of a connection, or
+// accepted from a ChannelListener.
+type Channel = l2cap.Channel
+
+// A ChannelListener accepts the channels the peers open to a PSM; see
+// ListenChannels.
+type ChannelListener = l2cap.ChannelListener
+
+// A ChannelAddr is the address of an end of a Channel.
+type ChannelAddr = l2cap.ChannelAddr
+
+// ChannelMTU is the largest SDU the channels receive.
+const ChannelMTU = l2cap.ChannelMTU
+
+// ListenChannels listens to the channels the peers of all the
+// connections open to the LE PSM psm: assigned by the SIG, e.g. 0x0023
+// for IPSP, or dynamic, from 0x0080 to 0x00FF. Those opened to the PSMs
+// not listened to are refused.
+func (h HCI) ListenChannels(psm uint16) (*ChannelListener, error) {
+	return h.l2c.ListenChannels(psm)
+}
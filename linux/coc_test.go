@@ -0,0 +1,167 @@
+package linux
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+// l2capPkt is an ACL data packet of the connection 0x0040, carrying the
+// PDU b of the channel cid, unfragmented.
+func l2capPkt(cid uint16, b ...byte) []byte {
+	return append([]byte{
+		0x02, 0x40, 0x20, byte(len(b) + 4), 0x00,
+		byte(len(b)), 0x00, byte(cid), byte(cid >> 8),
+	}, b...)
+}
+
+func TestOpenChannel(t *testing.T) {
+	h, d := newTestHCI(new(uint64))
+	defer h.Close()
+	d.rc <- connCompletePkt
+	c := <-h.l2c.ConnC()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	open := func(result byte) (*Channel, error) {
+		type opened struct {
+			ch  *Channel
+			err error
+		}
+		done := make(chan opened, 1)
+		go func() {
+			ch, err := c.OpenChannel(ctx, 0x0080)
+			done <- opened{ch, err}
+		}()
+		req := waitACL(t, d)
+		if want := []byte{0x80, 0x00, 0x40, 0x00, 0x00, 0x05, 0xF7, 0x00, 0x10, 0x00}; len(req) != 14 || req[0] != 0x14 || !bytes.Equal(req[4:], want) {
+			t.Fatalf("request: got % X", req)
+		}
+		d.rc <- l2capPkt(0x0005, 0x15, req[1], 0x0A, 0x00, 0x41, 0x00, 23, 0x00, 23, 0x00, 0x01, 0x00, result, 0x00)
+		o := <-done
+		return o.ch, o.err
+	}
+	var e ErrChannelRefused
+	if _, err := open(0x02); !errors.As(err, &e) || e.Result != 0x0002 {
+		t.Fatalf("OpenChannel refused = %v, want ErrChannelRefused", err)
+	}
+	ch, err := open(0x00)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a := ch.RemoteAddr().(ChannelAddr); a.CID != 0x0041 || a.PSM != 0x0080 || ch.MTU() != 23 {
+		t.Errorf("channel to %v, of MTU %d; want the CID 0x0041, and an MTU of 23", a, ch.MTU())
+	}
+
+	// An SDU above the MTU of the peer is written as two, in K-frames
+	// of its MPS, as it grants credits.
+	data := []byte("abcdefghijklmnopqrstuvwxyz0123")
+	written := make(chan error, 1)
+	go func() {
+		_, err := ch.Write(data)
+		written <- err
+	}()
+	if k := waitACL(t, d); !bytes.Equal(k, append([]byte{23, 0x00}, data[:21]...)) {
+		t.Errorf("first K-frame: got % X", k)
+	}
+	select {
+	case err := <-written:
+		t.Fatalf("Write returned without credits: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	d.rc <- l2capPkt(0x0005, 0x16, 0x09, 0x04, 0x00, 0x41, 0x00, 0x08, 0x00)
+	if err := <-written; err != nil {
+		t.Fatal(err)
+	}
+	var got [][]byte
+	for deadline := time.Now().Add(time.Second); len(got) < 2 && time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		got = append(got, d.sentACL()...)
+	}
+	want := [][]byte{data[21:23], append([]byte{7, 0x00}, data[23:]...)}
+	if len(got) != 2 || !bytes.Equal(got[0], want[0]) || !bytes.Equal(got[1], want[1]) {
+		t.Errorf("K-frames: got % X, want % X", got, want)
+	}
+
+	// An SDU received in two K-frames, the first fragmented, is read
+	// once complete, and credited.
+	d.rc <- []byte{0x02, 0x40, 0x20, 0x07, 0x00, 0x05, 0x00, 0x40, 0x00, 0x05, 0x00, 'h'}
+	d.rc <- []byte{0x02, 0x40, 0x10, 0x02, 0x00, 'e', 'l'}
+	d.rc <- l2capPkt(0x0040, 'l', 'o')
+	b := make([]byte, 3)
+	if n, err := ch.Read(b); err != nil || string(b[:n]) != "hel" {
+		t.Fatalf("Read = %q, %v; want hel", b[:n], err)
+	}
+	if n, err := ch.Read(b); err != nil || string(b[:n]) != "lo" {
+		t.Fatalf("Read = %q, %v; want the rest, lo", b[:n], err)
+	}
+	if k := waitACL(t, d); len(k) != 8 || k[0] != 0x16 || !bytes.Equal(k[4:], []byte{0x40, 0x00, 0x02, 0x00}) {
+		t.Errorf("credits: got % X, want 2 for the channel 0x0040", k)
+	}
+	ch.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	if _, err := ch.Read(b); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Read past the deadline = %v, want it exceeded", err)
+	}
+	ch.SetReadDeadline(time.Time{})
+
+	// The peer disconnects the channel.
+	d.rc <- l2capPkt(0x0005, 0x06, 0x0B, 0x04, 0x00, 0x40, 0x00, 0x41, 0x00)
+	if rsp := waitACL(t, d); !bytes.Equal(rsp, []byte{0x07, 0x0B, 0x04, 0x00, 0x40, 0x00, 0x41, 0x00}) {
+		t.Errorf("disconnection response: got % X", rsp)
+	}
+	if _, err := ch.Read(b); err != io.EOF {
+		t.Errorf("Read once disconnected = %v, want io.EOF", err)
+	}
+}
+
+func TestListenChannels(t *testing.T) {
+	h, d := newTestHCI(new(uint64))
+	defer h.Close()
+	d.rc <- connCompletePkt
+	<-h.l2c.ConnC()
+	ln, err := h.ListenChannels(0x0080)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	if _, err := h.ListenChannels(0x0080); err == nil {
+		t.Error("ListenChannels of a PSM listened to succeeded")
+	}
+
+	d.rc <- l2capPkt(0x0005, 0x14, 0x05, 0x0A, 0x00, 0x81, 0x00, 0x41, 0x00, 23, 0x00, 23, 0x00, 0x04, 0x00)
+	if rsp := waitACL(t, d); len(rsp) != 14 || !bytes.Equal(rsp[12:], []byte{0x02, 0x00}) {
+		t.Errorf("response to a PSM not listened to: got % X, want it refused", rsp)
+	}
+	d.rc <- l2capPkt(0x0005, 0x14, 0x06, 0x0A, 0x00, 0x80, 0x00, 0x41, 0x00, 23, 0x00, 23, 0x00, 0x04, 0x00)
+	if rsp := waitACL(t, d); !bytes.Equal(rsp, []byte{0x15, 0x06, 0x0A, 0x00, 0x40, 0x00, 0x00, 0x05, 0xF7, 0x00, 0x10, 0x00, 0x00, 0x00}) {
+		t.Errorf("response: got % X, want it accepted", rsp)
+	}
+	ch, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a := ch.RemoteAddr().(ChannelAddr); a.CID != 0x0041 {
+		t.Errorf("channel to %v, want the CID 0x0041", a)
+	}
+	d.rc <- l2capPkt(0x0005, 0x14, 0x07, 0x0A, 0x00, 0x80, 0x00, 0x41, 0x00, 23, 0x00, 23, 0x00, 0x04, 0x00)
+	if rsp := waitACL(t, d); len(rsp) != 14 || !bytes.Equal(rsp[12:], []byte{0x0A, 0x00}) {
+		t.Errorf("response to a CID in use: got % X, want it refused", rsp)
+	}
+
+	closed := make(chan error, 1)
+	go func() { closed <- ch.Close() }()
+	req := waitACL(t, d)
+	if len(req) != 8 || req[0] != 0x06 || !bytes.Equal(req[4:], []byte{0x41, 0x00, 0x40, 0x00}) {
+		t.Fatalf("disconnection request: got % X", req)
+	}
+	d.rc <- l2capPkt(0x0005, 0x07, req[1], 0x04, 0x00, 0x41, 0x00, 0x40, 0x00)
+	if err := <-closed; err != nil {
+		t.Errorf("Close = %v", err)
+	}
+	if _, err := ch.Write([]byte("x")); err == nil {
+		t.Error("Write once closed succeeded")
+	}
+}
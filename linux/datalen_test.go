@@ -0,0 +1,64 @@
+package linux
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/paypal/gatt/linux/internal/cmd"
+)
+
+func TestDataLength(t *testing.T) {
+	d := newFakeDevice()
+	d.rsp = map[cmd.Opcode][]byte{
+		cmd.LEReadBufferSize{}.Opcode():             {0xFB, 0x00, 0x08},
+		cmd.LEReadLocalSupportedFeatures{}.Opcode(): {0x20, 0, 0, 0, 0, 0, 0, 0},
+		cmd.LEReadMaximumDataLength{}.Opcode():      {0xFB, 0x00, 0x48, 0x08, 0xFB, 0x00, 0x48, 0x08},
+	}
+	cfg := defaultHCIConfig()
+	DataLength(200)(&cfg)
+	h := newHCI(d, cfg)
+	defer h.Close()
+	h.l2c.Adv = fakeAdv{}
+	if err := h.StartCtx(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	var suggested bool
+	for _, b := range d.sent() {
+		if cmd.Opcode(uint16(b[1])|uint16(b[2])<<8) == (cmd.LEWriteSuggestedDefaultDataLength{}).Opcode() {
+			suggested = b[4] == 200 && b[6] == 0x48
+		}
+	}
+	if !suggested {
+		t.Error("suggested default data length not set to 200 bytes")
+	}
+
+	d.rc <- connCompletePkt
+	c := <-h.l2c.ConnC()
+	waitSent(t, d, "LE Set Data Length 64")
+	if tx, rx := c.DataLength(); tx != 27 || rx != 27 {
+		t.Errorf("DataLength before the change = %d, %d; want 27, 27", tx, rx)
+	}
+	d.rc <- []byte{
+		0x04, 0x3E, 0x0B, // LE Meta event
+		0x07,       // LE Data Length Change
+		0x40, 0x00, // handle
+		0xC8, 0x00, 0x48, 0x08, // tx
+		0xFB, 0x00, 0x48, 0x08, // rx
+	}
+	deadline := time.Now().Add(time.Second)
+	for tx, _ := c.DataLength(); tx == 27 && time.Now().Before(deadline); tx, _ = c.DataLength() {
+		time.Sleep(time.Millisecond)
+	}
+	if tx, rx := c.DataLength(); tx != 200 || rx != 251 {
+		t.Errorf("DataLength = %d, %d; want 200, 251", tx, rx)
+	}
+
+	// Unfragmented, as the controller takes 251 bytes.
+	if _, err := c.Write(make([]byte, 100)); err != nil {
+		t.Fatal(err)
+	}
+	if acl := waitACL(t, d); len(acl) != 100 {
+		t.Errorf("first ACL fragment of %d bytes, want 100", len(acl))
+	}
+}
@@ -0,0 +1,263 @@
+package linux
+
+import (
+	"context"
+	"runtime/pprof"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/paypal/gatt/linux/internal/event"
+)
+
+// DropPolicy tells what the packet dispatcher does with a packet, when the
+// queue of the worker it is destined to is full: each worker queues
+// workerQueueLen packets at most.
+type DropPolicy int32
+
+const (
+	// DropWhenFull, the default, discards the packet, and counts it in
+	// Dropped. Reading from the device never waits on the workers, for
+	// they may well be waiting on the events of the commands they sent,
+	// read from it.
+	DropWhenFull DropPolicy = iota
+
+	// WaitWhenFull drops nothing: reading from the device waits for the
+	// worker to catch up. A handler waiting on the controller, e.g. on
+	// a command it sent, with its queue full, then waits forever, the
+	// event answering it never read; it suits handlers which do not.
+	WaitWhenFull
+)
+
+// DispatchMode tells how the packets read from the device are spread
+// over the workers handling them.
+type DispatchMode int
+
+const (
+	// PerConnection, the default, hands the packets of each connection
+	// to a worker of its own, in the order they are received, while
+	// different connections proceed in parallel. The events of no
+	// connection, and some of those of a connection, such as Encryption
+	// Change, go to a worker shared with other connections, and may be
+	// handled ahead of the ACL data received before them.
+	PerConnection DispatchMode = iota
+
+	// Ordered hands all the packets to a single worker, handled one at a
+	// time, in the order they are received, at the expense of the
+	// connections waiting on each other. Command Complete, Command Status
+	// and Number Of Completed Packets events are still handled as they
+	// are read, ahead of the packets queued, as in either mode: a handler
+	// waiting on a command holds up every packet behind it, but not the
+	// event answering it.
+	Ordered
+)
+
+const (
+	defaultWorkers = 4
+	workerQueueLen = 64
+)
+
+// workers returns the number of workers of the mode m.
+func (m DispatchMode) workers() int {
+	if m == Ordered {
+		return 1
+	}
+	return defaultWorkers
+}
+
+// dispatcher hands packets over to a fixed set of workers. Packets that
+// belong to a connection are hashed by its handle, so they are processed
+// in the order they are received, while different connections proceed
+// in parallel.
+type dispatcher struct {
+	workers []*queue
+	handle  func(packet)
+	policy  int32
+	dropped uint64
+
+	wg   sync.WaitGroup
+	done chan struct{} // closed once the workers have returned
+}
+
+func newDispatcher(n int, handle func(packet)) *dispatcher {
+	d := &dispatcher{
+		workers: make([]*queue, n),
+		handle:  handle,
+		done:    make(chan struct{}),
+	}
+	d.wg.Add(n)
+	for i := range d.workers {
+		d.workers[i] = newQueue()
+		go d.work(i, d.workers[i])
+	}
+	go func() {
+		d.wg.Wait()
+		close(d.done)
+	}()
+	return d
+}
+
+func (d *dispatcher) work(i int, q *queue) {
+	pprof.SetGoroutineLabels(pprof.WithLabels(context.Background(), pprof.Labels("gatt", "dispatch", "worker", strconv.Itoa(i))))
+	defer d.wg.Done()
+	for {
+		pk, ok := q.pop()
+		if !ok {
+			return
+		}
+		d.handle(pk)
+	}
+}
+
+// dispatch queues the packet to its worker, or handles it in the calling
+// goroutine if it must not wait behind other packets.
+func (d *dispatcher) dispatch(pk packet) {
+	key, inline := packetKey(pk.b)
+	if inline {
+		d.handle(pk)
+		return
+	}
+	wait := DropPolicy(atomic.LoadInt32(&d.policy)) == WaitWhenFull
+	if !d.workers[int(key)%len(d.workers)].push(pk, workerQueueLen, wait) {
+		atomic.AddUint64(&d.dropped, 1)
+		pk.release()
+	}
+}
+
+// stop lets the workers return, once they have handled the packets
+// queued. done is closed once they all have.
+func (d *dispatcher) stop() {
+	for _, q := range d.workers {
+		q.close()
+	}
+}
+
+// A queue holds the packets of a worker, in the order they are received.
+type queue struct {
+	mu     sync.Mutex
+	pks    []packet
+	head   int           // of the oldest packet in pks
+	ready  chan struct{} // holds a token once a packet is pushed, or the queue closed
+	room   chan struct{} // holds a token once a packet is popped, or the queue closed
+	closed bool
+}
+
+func newQueue() *queue {
+	return &queue{ready: make(chan struct{}, 1), room: make(chan struct{}, 1)}
+}
+
+// push queues pk, unless max packets are queued already, in which case it
+// waits for one to be popped if wait is set. It reports whether pk was
+// queued.
+func (q *queue) push(pk packet, max int, wait bool) bool {
+	for {
+		q.mu.Lock()
+		if q.closed {
+			q.mu.Unlock()
+			return false
+		}
+		if len(q.pks)-q.head < max {
+			q.pks = append(q.pks, pk)
+			signal(q.ready)
+			q.mu.Unlock()
+			return true
+		}
+		q.mu.Unlock()
+		if !wait {
+			return false
+		}
+		<-q.room
+	}
+}
+
+// pop returns the oldest packet, waiting for one to be pushed. It returns
+// false once the queue is closed, and empty.
+func (q *queue) pop() (packet, bool) {
+	for {
+		q.mu.Lock()
+		if q.head < len(q.pks) {
+			pk := q.pks[q.head]
+			q.pks[q.head] = packet{}
+			if q.head++; q.head == len(q.pks) {
+				q.pks, q.head = q.pks[:0], 0
+			}
+			signal(q.room)
+			q.mu.Unlock()
+			return pk, true
+		}
+		closed := q.closed
+		q.mu.Unlock()
+		if closed {
+			return packet{}, false
+		}
+		<-q.ready
+	}
+}
+
+// close lets pop return false, once the packets queued are popped.
+func (q *queue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	signal(q.ready)
+	signal(q.room)
+}
+
+// signal leaves a token in c, of capacity 1, unless one is there already.
+func signal(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
+
+// packetKey returns the connection handle a packet belongs to, or 0 if it
+// belongs to none. Command Complete, Command Status and Number Of Completed
+// Packets events are reported as inline: they unblock the senders of
+// commands and data, which may well be the workers themselves.
+func packetKey(b []byte) (key uint16, inline bool) {
+	if len(b) < 3 {
+		return 0, false
+	}
+	switch PacketType(b[0]) {
+	case ptypeACLDataPkt, ptypeISODataPkt:
+		return (uint16(b[1]) | uint16(b[2])<<8) & 0x0fff, false
+	case ptypeEventPkt:
+	default:
+		return 0, false
+	}
+	p := b[3:] // event parameters
+	switch event.EventCode(b[1]) {
+	case event.CommandComplete, event.CommandStatus, event.NumberOfCompletedPkts:
+		return 0, true
+	case event.DisconnectionComplete, event.EncryptionChange:
+		if len(p) >= 3 {
+			return (uint16(p[1]) | uint16(p[2])<<8) & 0x0fff, false
+		}
+	case event.LEMeta:
+		if len(p) < 4 {
+			break
+		}
+		switch event.LEEventCode(p[0]) {
+		case event.LEConnectionComplete, event.LEConnectionUpdateComplete,
+			event.LEReadRemoteUsedFeaturesComplete, event.LECISEstablished,
+			event.LETransmitPowerReporting:
+			return (uint16(p[2]) | uint16(p[3])<<8) & 0x0fff, false
+		case event.LELTKRequest, event.LERemoteConnectionParameterRequest,
+			event.LEChannelSelectionAlgorithm, event.LEPathLossThreshold:
+			return (uint16(p[1]) | uint16(p[2])<<8) & 0x0fff, false
+		}
+	}
+	return 0, false
+}
+
+// SetDropPolicy sets what happens to incoming packets when the workers
+// handling them fall behind. The default is DropWhenFull.
+func (h HCI) SetDropPolicy(p DropPolicy) {
+	atomic.StoreInt32(&h.disp.policy, int32(p))
+}
+
+// Dropped returns the number of incoming packets dropped so far.
+func (h HCI) Dropped() uint64 {
+	return atomic.LoadUint64(&h.disp.dropped)
+}
@@ -0,0 +1,149 @@
+package linux
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/paypal/gatt/linux/internal/cmd"
+	"github.com/paypal/gatt/linux/internal/event"
+)
+
+func TestDispatchOrder(t *testing.T) {
+	var pkts [][]byte
+	for i := 0; i < 200; i++ {
+		h := byte(0x40 + i%5)
+		pkts = append(pkts,
+			[]byte{0x02, h, 0x20, 0x01, 0x00, byte(i)},                   // ACL data
+			[]byte{0x04, 0x08, 0x04, 0x00, h, 0x00, byte(i)},             // Encryption Change, of no key
+			[]byte{0x04, 0x3E, 0x04, 0x12, byte(i), 0x00, 0x00, 0x00, 0}, // LE Meta, of no key
+		)
+	}
+	for _, m := range []DispatchMode{PerConnection, Ordered} {
+		var mu sync.Mutex
+		var got [][]byte
+		d := newDispatcher(m.workers(), func(pk packet) {
+			mu.Lock()
+			got = append(got, pk.b)
+			mu.Unlock()
+		})
+		d.policy = int32(WaitWhenFull)
+		for _, b := range pkts {
+			d.dispatch(packet{b: b})
+		}
+		d.stop()
+		<-d.done
+
+		// Each connection's ACL data comes in order either way.
+		last := map[byte]int{}
+		for _, b := range got {
+			if b[0] != 0x02 {
+				continue
+			}
+			if i, found := last[b[1]]; found && int(b[5]) < i {
+				t.Fatalf("mode %d: ACL data of handle 0x%02X out of order", m, b[1])
+			}
+			last[b[1]] = int(b[5])
+		}
+		if m != Ordered {
+			continue
+		}
+		for i := range pkts {
+			if &got[i][0] != &pkts[i][0] {
+				t.Fatalf("Ordered: packet %d handled out of order", i)
+			}
+		}
+	}
+
+	cfg := defaultHCIConfig()
+	Dispatch(Ordered)(&cfg)
+	h := newHCI(newFakeDevice(), cfg)
+	defer h.Close()
+	if n := len(h.disp.workers); n != 1 {
+		t.Errorf("Dispatch(Ordered): %d workers, want 1", n)
+	}
+}
+
+// A worker sending a command behind a queue overflowing with packets is
+// answered: by default, reading from the device never waits on the
+// workers.
+func TestDispatchCommandFromWorker(t *testing.T) {
+	for _, m := range []DispatchMode{PerConnection, Ordered} {
+		cfg := defaultHCIConfig()
+		Dispatch(m)(&cfg)
+		d := newFakeDevice()
+		h := newHCI(d, cfg)
+		filled, done := make(chan struct{}), make(chan error, 1)
+		var once sync.Once
+		h.evt.HandleEvent(event.LEMeta, event.HandlerFunc(func(b []byte) error {
+			once.Do(func() {
+				<-filled
+				_, err := h.cmd.Send(cmd.Reset{})
+				done <- err
+			})
+			return nil
+		}))
+		h.startReading()
+
+		// The reports, of no connection, all go to the worker waiting.
+		for i := 0; i < 3*workerQueueLen; i++ {
+			d.rc <- advReportPkt
+		}
+		for deadline := time.Now().Add(time.Second); len(d.rc) > 0 && time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		}
+		close(filled)
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("mode %d: %v", m, err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("mode %d: the command of a worker behind a full queue never completed", m)
+		}
+		h.Close()
+	}
+}
+
+func TestDispatchQueueFull(t *testing.T) {
+	for _, p := range []DropPolicy{DropWhenFull, WaitWhenFull} {
+		release := make(chan struct{})
+		var handled uint64
+		d := newDispatcher(1, func(pk packet) {
+			<-release
+			atomic.AddUint64(&handled, 1)
+		})
+		d.policy = int32(p)
+		dispatched := make(chan struct{})
+		go func() {
+			for i := 0; i < 2*workerQueueLen; i++ {
+				d.dispatch(packet{b: advReportPkt})
+			}
+			close(dispatched)
+		}()
+		select {
+		case <-dispatched:
+			if p == WaitWhenFull {
+				t.Fatal("WaitWhenFull: dispatch did not wait for the worker")
+			}
+		case <-time.After(50 * time.Millisecond):
+			if p == DropWhenFull {
+				t.Fatal("DropWhenFull: dispatch waited for the worker")
+			}
+		}
+		close(release)
+		<-dispatched
+		d.stop()
+		<-d.done
+		want := uint64(2 * workerQueueLen)
+		if p == DropWhenFull {
+			// The worker holds one packet, and queues workerQueueLen more.
+			want = workerQueueLen + 1
+		}
+		if n, dropped := atomic.LoadUint64(&handled), atomic.LoadUint64(&d.dropped); n+dropped != 2*workerQueueLen || n < workerQueueLen || n > want {
+			t.Errorf("policy %d: %d packets handled, %d dropped, want at most %d handled, none lost", p, n, dropped, want)
+		} else if p == WaitWhenFull && dropped != 0 {
+			t.Errorf("WaitWhenFull: %d packets dropped", dropped)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package linux
+
+import (
+	"fmt"
+
+	"github.com/paypal/gatt/linux/internal/cmd"
+	"github.com/paypal/gatt/linux/internal/hci"
+	"github.com/paypal/gatt/linux/internal/l2cap"
+)
+
+// Errors of the layers underneath the HCI, re-exported so that users
+// outside of this package can match them with errors.Is and errors.As.
+type (
+	// ErrCommandFailed is returned when an HCI command, or the procedure
+	// it started, completes with an unexpected status. It matches the
+	// Status it failed with.
+	ErrCommandFailed = cmd.ErrCommandFailed
+
+	// ErrDisconnected is returned by the reads and writes of a
+	// connection once it is disconnected. It matches io.EOF, and the
+	// Status of its reason.
+	ErrDisconnected = l2cap.ErrDisconnected
+
+	// ErrChannelRefused is returned by the OpenChannel method of a
+	// connection when the peer refuses the channel, with the result of
+	// its response.
+	ErrChannelRefused = l2cap.ErrChannelRefused
+
+	// A Status is an HCI error code: the status an ErrCommandFailed
+	// failed with, or the Reason of an ErrDisconnected, either matching
+	// it with errors.Is. It prints as its name, and code, e.g.
+	// "Connection Timeout (0x08)".
+	Status = hci.Status
+)
+
+// Statuses commonly matched with errors.Is; see Status.
+const (
+	StatusUnknownCommand           Status = 0x01
+	StatusUnknownConnection        Status = 0x02
+	StatusAuthenticationFailure    Status = 0x05
+	StatusKeyMissing               Status = 0x06
+	StatusMemoryExceeded           Status = 0x07
+	StatusConnectionTimeout        Status = 0x08
+	StatusConnectionLimitExceeded  Status = 0x09
+	StatusCommandDisallowed        Status = 0x0C
+	StatusInvalidParameters        Status = 0x12
+	StatusRemoteUserTerminated     Status = 0x13
+	StatusLocalHostTerminated      Status = 0x16
+	StatusUnsupportedRemoteFeature Status = 0x1A
+	StatusLLResponseTimeout        Status = 0x22
+	StatusInstantPassed            Status = 0x28
+	StatusControllerBusy           Status = 0x3A
+	StatusUnacceptableConnParams   Status = 0x3B
+	StatusAdvertisingTimeout       Status = 0x3C
+	StatusMICFailure               Status = 0x3D
+	StatusConnectionFailed         Status = 0x3E
+)
+
+var (
+	// ErrUnsupported is returned for packets, events and requests not
+	// supported by gatt, or by the controller.
+	ErrUnsupported = hci.ErrUnsupported
+
+	// ErrMalformed is returned for packets and events that cannot be
+	// decoded.
+	ErrMalformed = hci.ErrMalformed
+
+	// ErrClosed is returned for commands pending, or issued, once the
+	// HCI is closed.
+	ErrClosed = hci.ErrClosed
+
+	// ErrParamsRejected is returned by the UpdateParams method of a
+	// connection when the central rejects the parameters requested.
+	ErrParamsRejected = l2cap.ErrParamsRejected
+)
+
+// An SMPReason is the reason of a Pairing Failed command of the Security
+// Manager Protocol, which Pair fails with; it prints as its name, and
+// code, e.g. "Confirm Value Failed (0x04)".
+type SMPReason uint8
+
+// smpReasonNames are the names of the reasons, as in the Core
+// specification, Vol 3, Part H.
+var smpReasonNames = map[SMPReason]string{
+	0x01: "Passkey Entry Failed",
+	0x02: "OOB Not Available",
+	0x03: "Authentication Requirements",
+	0x04: "Confirm Value Failed",
+	0x05: "Pairing Not Supported",
+	0x06: "Encryption Key Size",
+	0x07: "Command Not Supported",
+	0x08: "Unspecified Reason",
+	0x09: "Repeated Attempts",
+	0x0A: "Invalid Parameters",
+	0x0B: "DHKey Check Failed",
+	0x0C: "Numeric Comparison Failed",
+	0x0D: "BR/EDR Pairing In Progress",
+	0x0E: "Cross-transport Key Derivation/Generation Not Allowed",
+	0x0F: "Key Rejected",
+	0x10: "Busy",
+}
+
+func (r SMPReason) String() string {
+	name, found := smpReasonNames[r]
+	if !found {
+		name = "Reserved"
+	}
+	return fmt.Sprintf("%s (0x%02X)", name, uint8(r))
+}
+
+func (r SMPReason) Error() string { return "smp: pairing failed: " + r.String() }
@@ -0,0 +1,103 @@
+package linux
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/paypal/gatt/linux/internal/cmd"
+	"github.com/paypal/gatt/linux/internal/event"
+)
+
+func TestErrors(t *testing.T) {
+	var failed ErrCommandFailed
+	err := fmt.Errorf("wrapped: %w", cmd.ErrCommandFailed{Opcode: cmd.Reset{}.Opcode(), Status: 0x0C})
+	if !errors.As(err, &failed) || failed.Status != 0x0C || failed.Opcode != (cmd.Reset{}).Opcode() {
+		t.Errorf("errors.As(%v) = %+v, want status 0x0C", err, failed)
+	}
+
+	var disc ErrDisconnected
+	err = ErrDisconnected{Reason: 0x13}
+	if !errors.As(err, &disc) || disc.Reason != 0x13 {
+		t.Errorf("errors.As(%v) = %+v, want reason 0x13", err, disc)
+	}
+	if !errors.Is(err, io.EOF) {
+		t.Errorf("errors.Is(%v, io.EOF) = false, want true", err)
+	}
+	if !errors.Is(err, StatusRemoteUserTerminated) || errors.Is(err, StatusConnectionTimeout) {
+		t.Errorf("errors.Is(%v) matches not only its reason", err)
+	}
+	if got, want := err.Error(), "l2cap: disconnected: Remote User Terminated Connection (0x13)"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	err = connectErr(0x3E)
+	if got, want := err.Error(), "hci: connection failed to be established: Connection Failed to be Established (0x3E)"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	err = fmt.Errorf("wrapped: %w", cmd.ErrCommandFailed{Opcode: cmd.Reset{}.Opcode(), Status: 0x0C})
+	if !errors.Is(err, StatusCommandDisallowed) {
+		t.Errorf("errors.Is(%v, StatusCommandDisallowed) = false, want true", err)
+	}
+	for s, want := range map[Status]string{0x08: "Connection Timeout (0x08)", 0xF0: "Unknown Error (0xF0)"} {
+		if got := s.String(); got != want {
+			t.Errorf("Status(0x%02X) = %q, want %q", uint8(s), got, want)
+		}
+	}
+	if got, want := SMPReason(0x04).String(), "Confirm Value Failed (0x04)"; got != want {
+		t.Errorf("SMPReason(0x04) = %q, want %q", got, want)
+	}
+
+	var h event.EventHeader
+	if err := h.Unmarshal([]byte{0x0E}); !errors.Is(err, ErrMalformed) {
+		t.Errorf("EventHeader.Unmarshal = %v, want ErrMalformed", err)
+	}
+
+	h2, _ := newTestHCI(new(uint64))
+	if err := h2.handleSCO(nil); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("handleSCO = %v, want ErrUnsupported", err)
+	}
+}
+
+func TestMalformed(t *testing.T) {
+	h, d := newTestHCI(new(uint64))
+	defer h.Close()
+	d.rc <- connCompletePkt
+	c := <-h.l2c.ConnC()
+
+	for _, p := range [][]byte{
+		{0x04, 0x0E, 0x05, 0x01},             // event header: wrong length
+		{0x04, 0x3E, 0x02, 0x20, 0x40},       // LE Path Loss Threshold: truncated
+		{0x06, 0x00},                         // unknown packet type
+		{0x02, 0x40, 0x20, 0x02, 0x00, 0x01}, // ACL data: wrong length
+	} {
+		d.rc <- p
+	}
+	for deadline := time.Now().Add(time.Second); h.Malformed() < 4 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if n := h.Malformed(); n != 4 {
+		t.Errorf("Malformed() = %d, want 4", n)
+	}
+
+	// A PDU cut short by the start of another, and a continuation of
+	// none, are dropped; the PDUs around them are read.
+	for _, p := range [][]byte{
+		{0x02, 0x40, 0x20, 0x08, 0x00, 0x08, 0x00, 0x04, 0x00, 'g', 'a', 't', 't'},
+		{0x02, 0x40, 0x20, 0x07, 0x00, 0x03, 0x00, 0x04, 0x00, 'a', 't', 't'},
+		{0x02, 0x40, 0x10, 0x02, 0x00, 'x', 'y'},
+		{0x02, 0x40, 0x20, 0x06, 0x00, 0x02, 0x00, 0x04, 0x00, 'o', 'k'},
+	} {
+		d.rc <- p
+	}
+	b := make([]byte, 64)
+	for _, want := range []string{"att", "ok"} {
+		if n, err := c.Read(b); err != nil || string(b[:n]) != want {
+			t.Errorf("Read = %q, %v, want %q", b[:n], err, want)
+		}
+	}
+	if n := c.Stats().Malformed; n != 2 {
+		t.Errorf("Stats().Malformed = %d, want 2", n)
+	}
+}
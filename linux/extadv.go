@@ -0,0 +1,127 @@
+package linux
+
+import (
+	"github.com/paypal/gatt/linux/internal/cmd"
+)
+
+const (
+	extAdvHandle      = 0x00   // of the single set advertised
+	extAdvConnectable = 0x0001 // event properties: connectable, with extended PDUs
+	extAdvNoTxPref    = 0x7F
+	phyLE1M           = 0x01
+)
+
+// ExtendedAdvertising is an optional parameter.
+// If set, the advertiser advertises with the extended advertising
+// commands, and PDUs, of Bluetooth 5.0, so that the advertising data runs
+// up to the MaxAdvDataLength of the Capabilities, rather than
+// MaxAdvertisingPacketLength. Extended connectable advertising takes no
+// scan requests: the scan response packet is advertised appended to the
+// advertising data, and ManufacturerData. Only centrals of Bluetooth 5.0
+// and later see the advertisements. Controllers without the LE Extended
+// Advertising feature fail AdvertiseService with ErrUnsupported. Once a
+// controller has taken an extended advertising command, it takes no
+// legacy advertising, or scanning, command until it is reset.
+func ExtendedAdvertising(on bool) Option {
+	return func(a *advertiser) Option {
+		prev := a.extended
+		a.extended = on
+		return ExtendedAdvertising(prev)
+	}
+}
+
+// maxDataLength returns the longest advertising data a takes, or an
+// error if it is extended, and the controller supports no extended
+// advertising.
+func (a *advertiser) maxDataLength() (int, error) {
+	if !a.extended {
+		return MaxAdvertisingPacketLength, nil
+	}
+	var c Capabilities
+	if a.caps != nil {
+		a.caps.mu.Lock()
+		c = a.caps.caps
+		a.caps.mu.Unlock()
+	}
+	if c.LEFeatures&leExtendedAdvertising == 0 {
+		return 0, unsupported("extended advertising")
+	}
+	return c.MaxAdvDataLength, nil
+}
+
+// setExtParameters sets the parameters of the advertising set, and its
+// random address, if any. It is called while a is not advertising.
+func (a *advertiser) setExtParameters(ownAddressType uint8, ra [6]byte) error {
+	if ownAddressType == AddrRandom {
+		if err := a.cmd.SendAndCheckResp(cmd.LESetAdvertisingSetRandomAddress{AdvertisingHandle: extAdvHandle, RandomAddress: ra}, expSuccess); err != nil {
+			return err
+		}
+	}
+	return a.cmd.SendAndCheckResp(
+		cmd.LESetExtendedAdvertisingParameters{
+			AdvertisingHandle:             extAdvHandle,
+			AdvertisingEventProperties:    extAdvConnectable,
+			PrimaryAdvertisingIntervalMin: uint32(a.advertisingIntervalMin),
+			PrimaryAdvertisingIntervalMax: uint32(a.advertisingIntervalMax),
+			PrimaryAdvertisingChannelMap:  a.advertisingChannelMap,
+			OwnAddressType:                ownAddressType,
+			AdvertisingTxPower:            extAdvNoTxPref,
+			PrimaryAdvertisingPHY:         phyLE1M,
+			SecondaryAdvertisingPHY:       phyLE1M,
+		}, expSuccess)
+}
+
+// extData returns the data of the advertising set: the advertising data
+// ad, then the scan response data sr, as extended connectable
+// advertising takes no scan requests.
+func extData(ad, sr []byte) []byte {
+	return append(append([]byte(nil), ad...), sr...)
+}
+
+// setExtData sets the data of the advertising set, fragmented as the
+// commands take no more than cmd.MaxExtAdvFragmentLength bytes each. The
+// controller takes fragmented data only while the set is disabled: if
+// serving, it is disabled meanwhile.
+func (a *advertiser) setExtData(b []byte, serving bool) error {
+	if len(b) > cmd.MaxExtAdvFragmentLength && serving {
+		if err := a.disable(); err != nil {
+			return err
+		}
+		defer a.enable()
+	}
+	op := uint8(cmd.ExtAdvFirstFragment)
+	for {
+		n := len(b)
+		if n > cmd.MaxExtAdvFragmentLength {
+			n = cmd.MaxExtAdvFragmentLength
+		}
+		switch last := n == len(b); {
+		case last && op == cmd.ExtAdvFirstFragment:
+			op = cmd.ExtAdvCompleteData
+		case last:
+			op = cmd.ExtAdvLastFragment
+		}
+		c := cmd.LESetExtendedAdvertisingData{
+			AdvertisingHandle:  extAdvHandle,
+			Operation:          op,
+			FragmentPreference: 0x01, // the controller should not fragment it
+			AdvertisingData:    b[:n],
+		}
+		if err := a.cmd.SendAndCheckResp(c, expSuccess); err != nil {
+			return err
+		}
+		if b = b[n:]; len(b) == 0 {
+			return nil
+		}
+		op = cmd.ExtAdvIntermediateFragment
+	}
+}
+
+// setExtEnable enables, or disables, the advertising set.
+func (a *advertiser) setExtEnable(on bool) error {
+	c := cmd.LESetExtendedAdvertisingEnable{Sets: []cmd.ExtAdvSet{{AdvertisingHandle: extAdvHandle}}}
+	if on {
+		c.Enable = 1
+	}
+	return a.cmd.SendAndCheckResp(c, expSuccess)
+}
@@ -0,0 +1,73 @@
+package linux
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/paypal/gatt/linux/internal/cmd"
+	"github.com/paypal/gatt/linux/internal/hci"
+)
+
+func TestExtendedAdvertising(t *testing.T) {
+	h, d := newTestHCI(new(uint64))
+	defer h.Close()
+	a := h.NewAdvertiser()
+	ad := bytes.Repeat([]byte{'a'}, 300)
+	a.Option(ExtendedAdvertising(true), AdvertisingPacket(ad), ScanResponsePacket([]byte{'s'}))
+	if err := a.AdvertiseService(); !errors.Is(err, hci.ErrUnsupported) {
+		t.Errorf("AdvertiseService without the feature = %v, want ErrUnsupported", err)
+	}
+
+	h.caps.mu.Lock()
+	h.caps.caps.LEFeatures |= leExtendedAdvertising
+	h.caps.caps.MaxAdvDataLength = 300
+	h.caps.mu.Unlock()
+	var e ErrInvalidParameter
+	if err := a.AdvertiseService(); !errors.As(err, &e) {
+		t.Errorf("AdvertiseService of 301 bytes = %v, want an ErrInvalidParameter", err)
+	}
+	d.sent()
+
+	a.Option(ScanResponsePacket(nil))
+	if err := a.Start(); err != nil {
+		t.Fatal(err)
+	}
+	a.Option(AdvertisingPacket([]byte{'b'}), ScanResponsePacket([]byte{'s'}))
+
+	// Parameters, then the data in two fragments, then enabled; then,
+	// disabled meanwhile, the data of a single command.
+	type sent struct {
+		op   cmd.Opcode
+		data string
+	}
+	want := []sent{
+		{cmd.LESetExtendedAdvertisingParameters{}.Opcode(), ""},
+		{cmd.LESetExtendedAdvertisingData{}.Opcode(), "\x01" + string(ad[:251])},
+		{cmd.LESetExtendedAdvertisingData{}.Opcode(), "\x02" + string(ad[251:])},
+		{cmd.LESetExtendedAdvertisingEnable{}.Opcode(), "\x01"},
+		{cmd.LESetExtendedAdvertisingEnable{}.Opcode(), "\x00"},
+		{cmd.LESetExtendedAdvertisingParameters{}.Opcode(), ""},
+		{cmd.LESetExtendedAdvertisingData{}.Opcode(), "\x03bs"},
+		{cmd.LESetExtendedAdvertisingEnable{}.Opcode(), "\x01"},
+	}
+	var got []sent
+	for _, b := range d.sent() {
+		s := sent{op: cmd.Opcode(uint16(b[1]) | uint16(b[2])<<8)}
+		switch s.op {
+		case cmd.LESetExtendedAdvertisingData{}.Opcode():
+			s.data = string(b[5:6]) + string(b[8:])
+		case cmd.LESetExtendedAdvertisingEnable{}.Opcode():
+			s.data = string(b[4:5])
+		}
+		got = append(got, s)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("%d commands sent, want %d: %v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("command %d: %v %q, want %v %q", i, got[i].op, got[i].data, want[i].op, want[i].data)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package linux
+
+import (
+	"errors"
+	"io"
+	"testing"
+)
+
+// FuzzHCI feeds packets, received from the controller, to the parsers of
+// an HCI with a connection up, as its read loop does, but in the calling
+// goroutine. Each input is a sequence of packets, each preceded by its
+// length; the ACL data of the connection is read, and reassembled, as it
+// is delivered.
+func FuzzHCI(f *testing.F) {
+	for _, pkts := range [][]byte{
+		advReportPkt,
+		connCompletePkt,
+		aclPkt,
+		connParamUpdateReq,
+		{0x02, 0x40, 0x20, 0x08, 0x00, 0x0A, 0x00, 0x04, 0x00, 0x1B, 0x0D, 0x00, 'g'},  // first fragment
+		{0x02, 0x40, 0x10, 0x03, 0x00, 'a', 't', 't'},                                  // continuation
+		{0x04, 0x13, 0x05, 0x01, 0x40, 0x00, 0x01, 0x00},                               // Number Of Completed Packets
+		{0x04, 0x0E, 0x04, 0x01, 0x03, 0x0C, 0x00},                                     // Command Complete, Reset
+		{0x04, 0x0F, 0x04, 0x00, 0x01, 0x0D, 0x20},                                     // Command Status, LE Create Connection
+		{0x04, 0x05, 0x04, 0x00, 0x40, 0x00, 0x13},                                     // Disconnection Complete
+		{0x04, 0x3E, 0x0A, 0x03, 0x00, 0x40, 0x00, 0x18, 0x00, 0x00, 0x00, 0xC8, 0x00}, // LE Connection Update Complete
+		{0x04, 0x3E, 0x04, 0x14, 0x40, 0x00, 0x01},                                     // LE Channel Selection Algorithm
+		{0x04, 0x3E, 0x05, 0x20, 0x40, 0x00, 70, 0x02},                                 // LE Path Loss Threshold
+		{0x05, 0x40, 0x00, 0x08, 0x00, 0x00, 0x00, 0x04, 0x00, 1, 2, 3, 4},             // ISO data
+	} {
+		f.Add(append([]byte{byte(len(pkts))}, pkts...))
+	}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		h, _ := newTestHCI(new(uint64))
+		done := make(chan struct{})
+		defer func() {
+			h.Close()
+			close(done)
+		}()
+		h.scan.setEnabled(true)
+		go acceptAll(h, done)
+		h.handlePacket(connCompletePkt)
+		for len(b) > 0 {
+			n := int(b[0])
+			if b = b[1:]; n > len(b) {
+				n = len(b)
+			}
+			// Copied, as by the read loop: the data is kept past the call.
+			if p := append([]byte(nil), b[:n]...); n > 0 {
+				if h.scan.isAdvReport(p) {
+					h.scan.put(p)
+				} else {
+					h.handlePacket(p)
+				}
+				// Complete the packets written in response, if any.
+				h.l2c.ReleaseBuffers(0x40, 14)
+			}
+			b = b[n:]
+		}
+	})
+}
+
+// acceptAll accepts the connections of h, and reads the ACL data of each,
+// until done is closed.
+func acceptAll(h *HCI, done chan struct{}) {
+	for {
+		select {
+		case c := <-h.l2c.ConnC():
+			go func() {
+				b := make([]byte, 512)
+				for {
+					if _, err := c.Read(b); errors.Is(err, io.EOF) {
+						return
+					}
+				}
+			}()
+		case <-done:
+			return
+		}
+	}
+}
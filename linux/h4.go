@@ -0,0 +1,83 @@
+package linux
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/paypal/gatt/linux/internal/hci"
+)
+
+// h4 frames the packets of the HCI UART transport (H4), a byte stream in
+// which each packet is its type, then its header, which tells the length
+// of the rest, so that each Read returns one packet, as an HCI socket
+// does.
+type h4 struct {
+	io.ReadWriteCloser
+	r *bufio.Reader
+}
+
+func newH4(d io.ReadWriteCloser) *h4 {
+	return &h4{ReadWriteCloser: d, r: bufio.NewReaderSize(d, defaultReadBufferSize)}
+}
+
+// h4HeaderLen returns the length of the header of the packets of type t,
+// and reads the length of their parameters, or data, from the header.
+func h4HeaderLen(t PacketType) (int, func(hdr []byte) int) {
+	switch t {
+	case ptypeCommandPkt, ptypeSCODataPkt:
+		return 3, func(hdr []byte) int { return int(hdr[2]) }
+	case ptypeACLDataPkt:
+		return 4, func(hdr []byte) int { return int(hdr[2]) | int(hdr[3])<<8 }
+	case ptypeEventPkt:
+		return 2, func(hdr []byte) int { return int(hdr[1]) }
+	case ptypeISODataPkt:
+		return 4, func(hdr []byte) int { return (int(hdr[2]) | int(hdr[3])<<8) & 0x3fff }
+	}
+	return 0, nil
+}
+
+// Read reads the next packet into b. A packet longer than b is truncated
+// to it, the rest discarded, so that the stream stays in sync; the layers
+// above reject it as malformed. A packet of an unknown type leaves no way
+// to tell where the next one starts, and fails the read.
+func (d *h4) Read(b []byte) (int, error) {
+	t, err := d.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	hl, plen := h4HeaderLen(PacketType(t))
+	if plen == nil {
+		return 0, fmt.Errorf("h4: %w packet of type 0x%02X", hci.ErrMalformed, t)
+	}
+	var hdr [5]byte
+	hdr[0] = t
+	if _, err := io.ReadFull(d.r, hdr[1:1+hl]); err != nil {
+		return 0, err
+	}
+	n := plen(hdr[1 : 1+hl])
+	k := copy(b, hdr[:1+hl])
+	m := n
+	if m > len(b)-k {
+		m = len(b) - k
+	}
+	if _, err := io.ReadFull(d.r, b[k:k+m]); err != nil {
+		return 0, err
+	}
+	if _, err := d.r.Discard(n - m); err != nil {
+		return 0, err
+	}
+	return k + m, nil
+}
+
+// Write writes the packet b whole; a tty may take only part of it at once.
+func (d *h4) Write(b []byte) (int, error) {
+	for w := 0; w < len(b); {
+		n, err := d.ReadWriteCloser.Write(b[w:])
+		if err != nil {
+			return w, err
+		}
+		w += n
+	}
+	return len(b), nil
+}
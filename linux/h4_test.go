@@ -0,0 +1,102 @@
+package linux
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/paypal/gatt/linux/internal/hci"
+)
+
+// stream is a byte stream, as a tty carries, with the writes it takes
+// in chunks of at most n bytes.
+type stream struct {
+	io.Reader
+	n int
+	w bytes.Buffer
+}
+
+func (s *stream) Write(b []byte) (int, error) {
+	if len(b) > s.n {
+		b = b[:s.n]
+	}
+	return s.w.Write(b)
+}
+
+func (s *stream) Close() error { return nil }
+
+func TestH4Read(t *testing.T) {
+	pkts := [][]byte{
+		{0x04, 0x0E, 0x04, 0x01, 0x03, 0x0C, 0x00},                   // Command Complete
+		{0x02, 0x40, 0x20, 0x05, 0x00, 0x01, 0x00, 0x04, 0x00, 0x0B}, // ACL
+		{0x05, 0x60, 0x00, 0x02, 0x00, 0xAA, 0xBB},                   // ISO
+		{0x04, 0x3E, 0x00}, // no parameters
+	}
+	var b []byte
+	for _, p := range pkts {
+		b = append(b, p...)
+	}
+	// Trickled in a byte at a time, as a slow UART delivers them.
+	d := newH4(&stream{Reader: &oneByteReader{b}})
+	buf := make([]byte, 64)
+	for _, want := range pkts {
+		n, err := d.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf[:n], want) {
+			t.Errorf("Read = [% X], want [% X]", buf[:n], want)
+		}
+	}
+	if _, err := d.Read(buf); err != io.EOF {
+		t.Errorf("Read at the end = %v, want EOF", err)
+	}
+}
+
+func TestH4ReadTruncated(t *testing.T) {
+	long := append([]byte{0x02, 0x40, 0x20, 0x08, 0x00}, 1, 2, 3, 4, 5, 6, 7, 8)
+	next := []byte{0x04, 0x05, 0x04, 0x00, 0x40, 0x00, 0x13}
+	d := newH4(&stream{Reader: bytes.NewReader(append(append([]byte(nil), long...), next...))})
+	buf := make([]byte, 8)
+	n, err := d.Read(buf)
+	if err != nil || !bytes.Equal(buf[:n], long[:8]) {
+		t.Errorf("Read = [% X], %v, want [% X]", buf[:n], err, long[:8])
+	}
+	n, err = d.Read(buf)
+	if err != nil || !bytes.Equal(buf[:n], next) {
+		t.Errorf("Read after the truncated packet = [% X], %v, want [% X]", buf[:n], err, next)
+	}
+}
+
+func TestH4ReadUnknownType(t *testing.T) {
+	d := newH4(&stream{Reader: bytes.NewReader([]byte{0x07, 0x00, 0x00})})
+	if _, err := d.Read(make([]byte, 8)); !errors.Is(err, hci.ErrMalformed) {
+		t.Errorf("Read = %v, want ErrMalformed", err)
+	}
+}
+
+func TestH4Write(t *testing.T) {
+	s := &stream{n: 3}
+	d := newH4(s)
+	p := []byte{0x01, 0x03, 0x0C, 0x00, 0x01, 0x02, 0x03}
+	if n, err := d.Write(p); n != len(p) || err != nil {
+		t.Fatalf("Write = %d, %v", n, err)
+	}
+	if !bytes.Equal(s.w.Bytes(), p) {
+		t.Errorf("written [% X], want [% X]", s.w.Bytes(), p)
+	}
+}
+
+type oneByteReader struct{ b []byte }
+
+func (r *oneByteReader) Read(p []byte) (int, error) {
+	if len(r.b) == 0 {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	p[0], r.b = r.b[0], r.b[1:]
+	return 1, nil
+}
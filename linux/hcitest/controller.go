@@ -0,0 +1,250 @@
+// Package hcitest provides a scripted controller, standing in for the
+// radio, so that the HCI, and the L2CAP and event handling above it, are
+// exercised in tests, and in CI, without hardware:
+//
+//	c := hcitest.NewController()
+//	h, err := linux.OpenHCI(linux.Transport(c))
+//	err = h.Start() // each command completes with success
+//	c.Connect(0x0040, peer, hcitest.RolePeripheral)
+//	l := <-h.L2CAP().ConnC()
+//	c.L2CAP(0x0040, 0x0004, []byte{0x0A, 0x03, 0x00}) // an ATT Read Request
+//
+// Commands complete with success, and no return parameters, unless
+// scripted otherwise with Respond, Fail or HandleCommand; those sent, and
+// the ACL data, are recorded for the test to check.
+package hcitest
+
+import (
+	"encoding/binary"
+	"io"
+	"sync"
+)
+
+// Packet types of the HCI UART transport, leading each packet.
+const (
+	CommandPkt = 0x01
+	ACLDataPkt = 0x02
+	EventPkt   = 0x04
+)
+
+// Roles of a connection, as in the LE Connection Complete event.
+const (
+	RoleCentral    = 0x00
+	RolePeripheral = 0x01
+)
+
+// opDisconnect is the opcode of the Disconnect command.
+const opDisconnect = 0x0406
+
+// A Command is a command the HCI sent.
+type Command struct {
+	Opcode uint16
+	Params []byte
+}
+
+// A Controller is a scripted controller, to be handed to the HCI as its
+// transport: linux.Transport(c). Its methods may be called concurrently.
+type Controller struct {
+	rc chan []byte
+
+	mu       sync.Mutex
+	closed   bool
+	rsp      map[uint16][]byte
+	status   map[uint16][]uint8 // of the next commands of each opcode
+	handlers map[uint16]func(params []byte) [][]byte
+	cmds     []Command
+	acl      [][]byte
+}
+
+// NewController returns a Controller of no script.
+func NewController() *Controller {
+	return &Controller{
+		rc:       make(chan []byte, 256),
+		rsp:      make(map[uint16][]byte),
+		status:   make(map[uint16][]uint8),
+		handlers: make(map[uint16]func(params []byte) [][]byte),
+	}
+}
+
+// Read returns the next packet the controller sends, or io.EOF once it
+// is closed.
+func (c *Controller) Read(b []byte) (int, error) {
+	p, ok := <-c.rc
+	if !ok {
+		return 0, io.EOF
+	}
+	return copy(b, p), nil
+}
+
+// Write takes the packet b, sent by the HCI: a command is recorded, and
+// answered as scripted; the ACL data is recorded.
+func (c *Controller) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return 0, io.ErrClosedPipe
+	}
+	switch {
+	case len(b) >= 5 && b[0] == ACLDataPkt:
+		c.acl = append(c.acl, append([]byte(nil), b[1:]...))
+	case len(b) >= 4 && b[0] == CommandPkt:
+		op := binary.LittleEndian.Uint16(b[1:])
+		params := append([]byte(nil), b[4:]...)
+		c.cmds = append(c.cmds, Command{op, params})
+		for _, e := range c.answer(op, params) {
+			c.rc <- e
+		}
+	}
+	return len(b), nil
+}
+
+// answer returns the events answering the command of opcode op, and
+// parameters params.
+func (c *Controller) answer(op uint16, params []byte) [][]byte {
+	if f := c.handlers[op]; f != nil {
+		return f(params)
+	}
+	var st uint8
+	if s := c.status[op]; len(s) > 0 {
+		st, c.status[op] = s[0], s[1:]
+	}
+	if op == opDisconnect && len(params) >= 3 {
+		return [][]byte{
+			CommandStatus(st, op),
+			event(0x05, []byte{0x00, params[0], params[1], params[2]}), // Disconnection Complete
+		}
+	}
+	return [][]byte{CommandComplete(op, append([]byte{st}, c.rsp[op]...))}
+}
+
+// Close closes the controller: the reads of the HCI return io.EOF.
+func (c *Controller) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		c.closed = true
+		close(c.rc)
+	}
+	return nil
+}
+
+// Respond sets the return parameters, following the status, of the
+// commands of opcode op.
+func (c *Controller) Respond(op uint16, params []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rsp[op] = params
+}
+
+// Fail has the next commands of opcode op complete with the statuses
+// given, one each; those following succeed.
+func (c *Controller) Fail(op uint16, status ...uint8) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.status[op] = append(c.status[op], status...)
+}
+
+// HandleCommand has f answer the commands of opcode op, in place of the
+// Command Complete event: it returns the packets sent back, e.g. built
+// with CommandStatus, and LEMeta. A nil f drops the handler of op.
+// f is called with the controller locked.
+func (c *Controller) HandleCommand(op uint16, f func(params []byte) [][]byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if f == nil {
+		delete(c.handlers, op)
+		return
+	}
+	c.handlers[op] = f
+}
+
+// Send sends the packet b, its packet type first, to the HCI.
+func (c *Controller) Send(b []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		c.rc <- b
+	}
+}
+
+// Event sends the event of code, and parameters params, to the HCI.
+func (c *Controller) Event(code uint8, params []byte) { c.Send(event(code, params)) }
+
+// LEMeta sends the LE Meta event of the subevent code, and parameters
+// params, to the HCI.
+func (c *Controller) LEMeta(subevent uint8, params []byte) { c.Send(LEMeta(subevent, params)) }
+
+// Connect sends the LE Connection Complete event of the connection of
+// handle, with the peer of public address peer, most significant byte
+// first, the local device having the role given.
+func (c *Controller) Connect(handle uint16, peer [6]byte, role uint8) {
+	p := make([]byte, 18)
+	binary.LittleEndian.PutUint16(p[1:], handle)
+	p[3] = role
+	for i := range peer {
+		p[5+i] = peer[5-i]
+	}
+	binary.LittleEndian.PutUint16(p[11:], 0x0018) // interval, 30 ms
+	binary.LittleEndian.PutUint16(p[15:], 0x00C8) // supervision timeout, 2 s
+	c.LEMeta(0x01, p)
+}
+
+// ACL sends the ACL data of the connection of handle, data being a whole
+// L2CAP PDU, to the HCI.
+func (c *Controller) ACL(handle uint16, data []byte) {
+	b := make([]byte, 5, 5+len(data))
+	b[0] = ACLDataPkt
+	binary.LittleEndian.PutUint16(b[1:], handle&0x0FFF|0x2000) // first, flushable
+	binary.LittleEndian.PutUint16(b[3:], uint16(len(data)))
+	c.Send(append(b, data...))
+}
+
+// L2CAP sends the payload, on the L2CAP channel cid, of the connection of
+// handle, to the HCI, e.g. an ATT PDU on channel 0x0004.
+func (c *Controller) L2CAP(handle, cid uint16, payload []byte) {
+	b := make([]byte, 4, 4+len(payload))
+	binary.LittleEndian.PutUint16(b, uint16(len(payload)))
+	binary.LittleEndian.PutUint16(b[2:], cid)
+	c.ACL(handle, append(b, payload...))
+}
+
+// Commands returns the commands sent so far, and forgets them.
+func (c *Controller) Commands() []Command {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cmds := c.cmds
+	c.cmds = nil
+	return cmds
+}
+
+// ACLSent returns the ACL data sent so far, each its header, handle and
+// length, first, and forgets them.
+func (c *Controller) ACLSent() [][]byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	acl := c.acl
+	c.acl = nil
+	return acl
+}
+
+func event(code uint8, params []byte) []byte {
+	return append([]byte{EventPkt, code, byte(len(params))}, params...)
+}
+
+// CommandComplete returns the Command Complete event of the command of
+// opcode op, of return parameters rp, its status first.
+func CommandComplete(op uint16, rp []byte) []byte {
+	return event(0x0E, append([]byte{0x01, byte(op), byte(op >> 8)}, rp...))
+}
+
+// CommandStatus returns the Command Status event of the command of
+// opcode op.
+func CommandStatus(status uint8, op uint16) []byte {
+	return event(0x0F, []byte{status, 0x01, byte(op), byte(op >> 8)})
+}
+
+// LEMeta returns the LE Meta event of the subevent code, and parameters
+// params.
+func LEMeta(subevent uint8, params []byte) []byte {
+	return event(0x3E, append([]byte{subevent}, params...))
+}
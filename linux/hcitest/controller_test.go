@@ -0,0 +1,61 @@
+package hcitest
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/paypal/gatt/linux"
+)
+
+func TestController(t *testing.T) {
+	c := NewController()
+	c.Respond(0x1009, []byte{0x66, 0x55, 0x44, 0x33, 0x22, 0x11}) // Read BD_ADDR
+	h, err := linux.OpenHCI(linux.Transport(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	if err := h.StartCtx(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if cmds := c.Commands(); len(cmds) == 0 || cmds[0].Opcode != 0x0C03 {
+		t.Fatalf("sent %v, want a Reset first", cmds)
+	}
+
+	// A scripted failure surfaces as the error of the command.
+	c.Fail(0xFC01, 0x0C)
+	if _, err := h.SendCommand(context.Background(), linux.Command{Opcode: 0xFC01}); err == nil {
+		t.Error("SendCommand of a failing command succeeded")
+	}
+
+	// An ATT PDU, received and answered over a connection.
+	l := h.L2CAP()
+	l.Adv = h.NewAdvertiser()
+	c.Connect(0x0040, [6]byte{1, 2, 3, 4, 5, 6}, RolePeripheral)
+	conn := <-l.ConnC()
+	c.L2CAP(0x0040, 0x0004, []byte{0x0A, 0x03, 0x00})
+	b := make([]byte, 64)
+	n, err := conn.Read(b)
+	if err != nil || !bytes.Equal(b[:n], []byte{0x0A, 0x03, 0x00}) {
+		t.Fatalf("Read() = % X, %v", b[:n], err)
+	}
+	if _, err := conn.Write([]byte{0x0B, 'o', 'k'}); err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{0x40, 0x00, 0x07, 0x00, 0x03, 0x00, 0x04, 0x00, 0x0B, 'o', 'k'}
+	deadline := time.Now().Add(time.Second)
+	for {
+		if acl := c.ACLSent(); len(acl) > 0 {
+			if !bytes.Equal(acl[0], want) {
+				t.Errorf("ACL sent % X, want % X", acl[0], want)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("no ACL data sent")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,192 @@
+package linux
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/paypal/gatt/linux/internal/cmd"
+	"github.com/paypal/gatt/linux/internal/event"
+)
+
+// giac is the General Inquiry Access Code, which all the discoverable
+// BR/EDR devices respond to.
+const giac = 0x9E8B33
+
+// inquiryUnit is the unit of the length of an inquiry.
+const inquiryUnit = 1280 * time.Millisecond
+
+// An InquiryResult is a classic, BR/EDR, device found by Inquiry.
+type InquiryResult struct {
+	Addr          [6]byte // most significant byte first
+	ClassOfDevice uint32  // 24 bits: the service classes, and the device class
+	RSSI          int8    // in dBm; 127 if not reported
+	EIR           []byte  // extended inquiry response data, if any, e.g. the name
+
+	// The page scan repetition mode, and the clock offset, of the
+	// device, for RemoteName to page it the sooner. Bit 15 of
+	// ClockOffset is set if it is valid.
+	PageScanRepetitionMode uint8
+	ClockOffset            uint16
+}
+
+type inquiryState struct {
+	mu    sync.Mutex
+	f     func(r InquiryResult) // of the running Inquiry, if any
+	done  chan uint8            // the status of Inquiry Complete
+	names map[[6]byte]chan *event.RemoteNameReqCompleteEP
+}
+
+func newInquiryState() *inquiryState {
+	return &inquiryState{names: map[[6]byte]chan *event.RemoteNameReqCompleteEP{}}
+}
+
+// Inquiry enumerates the classic, BR/EDR, devices nearby, discoverable,
+// alongside the LE advertisers scanning finds, for up to length, rounded
+// to a multiple of 1.28 s, from 1.28 s to 61.44 s, or until ctx is done,
+// in which case the inquiry is canceled, and ctx.Err() returned. f is
+// called with each device found, the same device possibly more than
+// once, from a goroutine of the HCI. The controller is set to report
+// their RSSI, and extended inquiry response, if it can. Controllers of LE
+// only fail it with ErrCommandFailed.
+func (h HCI) Inquiry(ctx context.Context, length time.Duration, f func(r InquiryResult)) error {
+	n := int((length + inquiryUnit/2) / inquiryUnit)
+	if err := checkRange("Inquiry length, in units of 1.28 s", n, 0x01, 0x30); err != nil {
+		return err
+	}
+	done := make(chan uint8, 1)
+	h.inquiry.mu.Lock()
+	if h.inquiry.f != nil {
+		h.inquiry.mu.Unlock()
+		return errors.New("hci: inquiry already running")
+	}
+	h.inquiry.f, h.inquiry.done = f, done
+	h.inquiry.mu.Unlock()
+	defer func() {
+		h.inquiry.mu.Lock()
+		defer h.inquiry.mu.Unlock()
+		h.inquiry.f, h.inquiry.done = nil, nil
+	}()
+
+	// Extended results, with RSSI, or, on older controllers, results
+	// with RSSI; the standard results otherwise.
+	if h.cmd.SendAndCheckRespCtx(ctx, cmd.WriteInquiryMode{InquiryMode: 2}, expSuccess) != nil {
+		h.cmd.SendAndCheckRespCtx(ctx, cmd.WriteInquiryMode{InquiryMode: 1}, expSuccess)
+	}
+	c := cmd.Inquiry{LAP: giac, InquiryLength: uint8(n)}
+	if err := h.cmd.SendAndCheckRespCtx(ctx, c, expSuccess); err != nil {
+		return err
+	}
+	select {
+	case st := <-done:
+		if st != 0x00 {
+			return cmd.ErrCommandFailed{Opcode: c.Opcode(), Status: st}
+		}
+		return nil
+	case <-ctx.Done():
+		h.cmd.SendAndCheckResp(cmd.InquiryCancel{}, expSuccess)
+		return ctx.Err()
+	case <-h.readDone:
+		return fmt.Errorf("hci: inquiry: %w", ErrClosed)
+	}
+}
+
+// RemoteName requests the name of the classic device r, found by Inquiry,
+// or of which only the Addr is known, and waits for the controller to
+// report it, or for ctx to be done, in which case the request is
+// canceled, and ctx.Err() returned. The device is paged, and the
+// controller connects to it for the time of the request, which fails
+// with ErrCommandFailed if the device does not respond.
+func (h HCI) RemoteName(ctx context.Context, r InquiryResult) (string, error) {
+	c := make(chan *event.RemoteNameReqCompleteEP, 1)
+	h.inquiry.mu.Lock()
+	if h.inquiry.names[r.Addr] != nil {
+		h.inquiry.mu.Unlock()
+		return "", fmt.Errorf("hci: name of %X already being requested", r.Addr)
+	}
+	h.inquiry.names[r.Addr] = c
+	h.inquiry.mu.Unlock()
+	defer func() {
+		h.inquiry.mu.Lock()
+		defer h.inquiry.mu.Unlock()
+		delete(h.inquiry.names, r.Addr)
+	}()
+
+	p := cmd.RemoteNameRequest{BDAddr: r.Addr, PageScanRepetitionMode: r.PageScanRepetitionMode, ClockOffset: r.ClockOffset}
+	if err := h.cmd.SendAndCheckRespCtx(ctx, p, expSuccess); err != nil {
+		return "", err
+	}
+	select {
+	case ep := <-c:
+		if ep.Status != 0x00 {
+			return "", cmd.ErrCommandFailed{Opcode: p.Opcode(), Status: ep.Status}
+		}
+		return ep.RemoteName, nil
+	case <-ctx.Done():
+		h.cmd.SendAndCheckResp(cmd.RemoteNameRequestCancel{BDAddr: r.Addr}, expSuccess)
+		return "", ctx.Err()
+	case <-h.readDone:
+		return "", fmt.Errorf("hci: remote name: %w", ErrClosed)
+	}
+}
+
+func (h HCI) handleInquiryComplete(b []byte) error {
+	ep := &event.InquiryCompleteEP{}
+	if err := ep.Unmarshal(b); err != nil {
+		return err
+	}
+	h.inquiry.mu.Lock()
+	defer h.inquiry.mu.Unlock()
+	if h.inquiry.done != nil {
+		h.inquiry.done <- ep.Status
+		h.inquiry.done = nil
+	}
+	return nil
+}
+
+// handleInquiryResult returns the handler of the Inquiry Result events
+// unmarshaled by unmarshal.
+func (h HCI) handleInquiryResult(unmarshal func(ep *event.InquiryResultEP, b []byte) error) func(b []byte) error {
+	return func(b []byte) error {
+		var ep event.InquiryResultEP
+		if err := unmarshal(&ep, b); err != nil {
+			return err
+		}
+		h.inquiry.mu.Lock()
+		f := h.inquiry.f
+		h.inquiry.mu.Unlock()
+		if f == nil {
+			return nil
+		}
+		for _, r := range ep.Responses {
+			res := InquiryResult{
+				Addr:                   r.BDAddr,
+				ClassOfDevice:          r.ClassOfDevice,
+				RSSI:                   r.RSSI,
+				EIR:                    r.EIR,
+				PageScanRepetitionMode: r.PageScanRepetitionMode,
+				ClockOffset:            r.ClockOffset | 0x8000,
+			}
+			h.call("inquiry", func() { f(res) })
+		}
+		return nil
+	}
+}
+
+func (h HCI) handleRemoteNameComplete(b []byte) error {
+	ep := &event.RemoteNameReqCompleteEP{}
+	if err := ep.Unmarshal(b); err != nil {
+		return err
+	}
+	h.inquiry.mu.Lock()
+	defer h.inquiry.mu.Unlock()
+	if c := h.inquiry.names[ep.BDAddr]; c != nil {
+		select {
+		case c <- ep:
+		default:
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package linux
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestInquiry(t *testing.T) {
+	h, d := newTestHCI(new(uint64))
+	defer h.Close()
+
+	var mu sync.Mutex
+	var got []InquiryResult
+	errc := make(chan error, 1)
+	go func() {
+		errc <- h.Inquiry(context.Background(), 2*time.Second, func(r InquiryResult) {
+			mu.Lock()
+			defer mu.Unlock()
+			got = append(got, r)
+		})
+	}()
+	waitSent(t, d, "Write Inquiry Mode 2", "Inquiry 51")
+
+	// An Extended Inquiry Result, with a name in its EIR.
+	eir := make([]byte, 255)
+	copy(eir, []byte{0x01, 0x06, 0x05, 0x04, 0x03, 0x02, 0x01, 0x01, 0x00, 0x0C, 0x02, 0x5A, 0x34, 0x12, 0xC4})
+	copy(eir[15:], []byte{0x04, 0x09, 'c', 'a', 'r'})
+	d.rc <- append([]byte{0x04, 0x2F, 255}, eir...)
+	// An Inquiry Result with RSSI, of 2 responses.
+	d.rc <- []byte{0x04, 0x22, 29, 0x02,
+		0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x22, 0x22, 0x22, 0x22, 0x22, 0x22, // BD_ADDR
+		0x01, 0x02, // Page_Scan_Repetition_Mode
+		0x00, 0x00, // Reserved
+		0x04, 0x01, 0x24, 0x0C, 0x02, 0x5A, // Class_Of_Device
+		0x00, 0x10, 0x00, 0x20, // Clock_Offset
+		0xB0, 0xA0, // RSSI
+	}
+	d.rc <- []byte{0x04, 0x01, 0x01, 0x00} // Inquiry Complete
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Inquiry did not return")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	want := []InquiryResult{
+		{Addr: [6]byte{1, 2, 3, 4, 5, 6}, ClassOfDevice: 0x5A020C, RSSI: -60, EIR: []byte{0x04, 0x09, 'c', 'a', 'r'}, PageScanRepetitionMode: 1, ClockOffset: 0x9234},
+		{Addr: [6]byte{0x11, 0x11, 0x11, 0x11, 0x11, 0x11}, ClassOfDevice: 0x240104, RSSI: -80, PageScanRepetitionMode: 1, ClockOffset: 0x9000},
+		{Addr: [6]byte{0x22, 0x22, 0x22, 0x22, 0x22, 0x22}, ClassOfDevice: 0x5A020C, RSSI: -96, PageScanRepetitionMode: 2, ClockOffset: 0xA000},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d results, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		if g.Addr != w.Addr || g.ClassOfDevice != w.ClassOfDevice || g.RSSI != w.RSSI || !bytes.Equal(g.EIR, w.EIR) ||
+			g.PageScanRepetitionMode != w.PageScanRepetitionMode || g.ClockOffset != w.ClockOffset {
+			t.Errorf("result %d: %+v, want %+v", i, g, w)
+		}
+	}
+
+	var e ErrInvalidParameter
+	if err := h.Inquiry(context.Background(), time.Minute*2, nil); !errors.As(err, &e) {
+		t.Errorf("Inquiry of 2 minutes: got %v, want an ErrInvalidParameter", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() { errc <- h.Inquiry(ctx, 5*time.Second, func(InquiryResult) {}) }()
+	waitSent(t, d, "Write Inquiry Mode 2", "Inquiry 51")
+	cancel()
+	if err := <-errc; err != context.Canceled {
+		t.Errorf("Inquiry canceled: got %v, want %v", err, context.Canceled)
+	}
+	waitSent(t, d, "Inquiry Cancel")
+}
+
+func TestRemoteName(t *testing.T) {
+	h, d := newTestHCI(new(uint64))
+	defer h.Close()
+
+	type result struct {
+		name string
+		err  error
+	}
+	rc := make(chan result, 1)
+	r := InquiryResult{Addr: [6]byte{1, 2, 3, 4, 5, 6}, PageScanRepetitionMode: 1, ClockOffset: 0x9234}
+	go func() {
+		name, err := h.RemoteName(context.Background(), r)
+		rc <- result{name, err}
+	}()
+	waitSent(t, d, "Remote Name Request 6")
+
+	ev := make([]byte, 255)
+	copy(ev, []byte{0x00, 0x06, 0x05, 0x04, 0x03, 0x02, 0x01, 'p', 'h', 'o', 'n', 'e'})
+	d.rc <- append([]byte{0x04, 0x07, 255}, ev...)
+	select {
+	case res := <-rc:
+		if res.err != nil || res.name != "phone" {
+			t.Errorf("RemoteName() = %q, %v, want %q", res.name, res.err, "phone")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("RemoteName did not return")
+	}
+
+	go func() {
+		name, err := h.RemoteName(context.Background(), r)
+		rc <- result{name, err}
+	}()
+	waitSent(t, d, "Remote Name Request 6")
+	ev[0] = 0x04 // Page Timeout
+	d.rc <- append([]byte{0x04, 0x07, 255}, ev...)
+	var failed ErrCommandFailed
+	if res := <-rc; !errors.As(res.err, &failed) || failed.Status != 0x04 {
+		t.Errorf("RemoteName() of a device out of range = %q, %v, want an ErrCommandFailed", res.name, res.err)
+	}
+}
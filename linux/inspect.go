@@ -0,0 +1,57 @@
+package linux
+
+import "time"
+
+// A StackState is a snapshot of the state of the HCI, as Inspect returns
+// it.
+type StackState struct {
+	Scanning    bool
+	ScanActive  bool
+	ScanPaused  bool // while a connection is initiated
+	Advertising bool
+	AdvPaused   bool // while a connection is initiated
+	Initiating  bool
+
+	Central, Peripheral int // connections, in either role
+
+	// PendingCommands are the commands sent to the controller whose
+	// events are awaited, oldest first: one pending for long tells
+	// what the controller is stuck on.
+	PendingCommands []PendingCommand
+
+	QueuedPackets int // ACL packets not written to the device yet
+	HeldBuffers   int // ACL buffers of the controller written to, not completed yet
+
+	Dropped           uint64 // see Dropped
+	Malformed         uint64 // see Malformed
+	DroppedAdvReports uint64 // see DroppedAdvReports
+}
+
+// A PendingCommand is a command sent to the controller, whose event is
+// awaited.
+type PendingCommand struct {
+	ID     uint64 // as in the logs, and the spans
+	Name   string
+	Opcode uint16
+	Sent   time.Time
+}
+
+// Inspect returns a snapshot of the state of the HCI, for an operator to
+// find what a controller stuck is waiting for. It sends nothing to the
+// controller.
+func (h HCI) Inspect() StackState {
+	var s StackState
+	r := h.roles
+	r.mu.Lock()
+	s.Scanning, s.ScanActive, s.ScanPaused = r.scanning, r.scanActive, r.scanPaused
+	s.Advertising, s.AdvPaused = r.adv != nil && r.adv.Serving(), r.advPaused
+	s.Initiating = r.initiating
+	r.mu.Unlock()
+	s.Central, s.Peripheral = h.l2c.Roles()
+	for _, p := range h.cmd.Pending() {
+		s.PendingCommands = append(s.PendingCommands, PendingCommand{ID: p.ID, Name: p.Opcode.String(), Opcode: uint16(p.Opcode), Sent: p.Sent})
+	}
+	s.QueuedPackets, s.HeldBuffers = h.l2c.Queued()
+	s.Dropped, s.Malformed, s.DroppedAdvReports = h.Dropped(), h.Malformed(), h.DroppedAdvReports()
+	return s
+}
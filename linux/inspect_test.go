@@ -0,0 +1,17 @@
+package linux
+
+import "testing"
+
+func TestInspect(t *testing.T) {
+	h, d := newTestHCI(new(uint64))
+	defer h.Close()
+	d.rc <- connCompletePkt
+	<-h.l2c.ConnC()
+	s := h.Inspect()
+	if s.Central+s.Peripheral != 1 {
+		t.Errorf("connections: %d central, %d peripheral; want 1", s.Central, s.Peripheral)
+	}
+	if len(s.PendingCommands) != 0 || s.QueuedPackets != 0 || s.HeldBuffers != 0 {
+		t.Errorf("state = %+v, want nothing pending", s)
+	}
+}
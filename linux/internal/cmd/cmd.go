@@ -2,11 +2,15 @@ package cmd
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
-	"errors"
 	"fmt"
 	"io"
 	"log"
+	"runtime/pprof"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/paypal/gatt/linux/internal/event"
 	"github.com/paypal/gatt/linux/internal/hci"
@@ -25,15 +29,19 @@ func NewCmd(d io.Writer, l *log.Logger) *Cmd {
 		sent:    []*cmdPkt{},
 		compc:   make(chan event.CommandCompleteEP),
 		statusc: make(chan event.CommandStatusEP),
+		quit:    make(chan struct{}),
+		done:    make(chan struct{}),
 	}
 	go c.processCmdEvents()
 	return c
 }
 
 type cmdPkt struct {
+	id   uint64 // correlates the command with its event, in logs and spans
 	op   Opcode
 	cp   CmdParam
 	done chan []byte
+	sent time.Time
 }
 
 func (c cmdPkt) marshal() []byte {
@@ -48,12 +56,36 @@ func (c cmdPkt) marshal() []byte {
 type Cmd struct {
 	dev     io.Writer
 	logger  *log.Logger
+	mu      sync.Mutex // guards sent, appended to by the senders
 	sent    []*cmdPkt
 	compc   chan event.CommandCompleteEP
 	statusc chan event.CommandStatusEP
+	span    func(name string) (end func(err error))
+	lastID  uint64 // of the latest command sent; atomic
+
+	closeOnce sync.Once
+	quit      chan struct{} // closed by Close
+	done      chan struct{} // closed once processCmdEvents has returned
+}
+
+// Close fails the commands pending, and those sent later, with
+// hci.ErrClosed, and stops processing command events. It returns once
+// the processing has stopped.
+func (c *Cmd) Close() {
+	c.closeOnce.Do(func() { close(c.quit) })
+	<-c.done
 }
 
-func (c Cmd) trace(fmt string, v ...interface{}) {
+// SetSpanHook sets a function called as each command is sent; the
+// function it returns is called once the command completes. It lets
+// tracers, such as OpenTelemetry, observe command round trips. The span
+// of a command is named after it, and its correlation ID, as in its log
+// lines, e.g. "hci: Reset #1". It must be set before any command is sent.
+func (c *Cmd) SetSpanHook(f func(name string) (end func(err error))) {
+	c.span = f
+}
+
+func (c *Cmd) trace(fmt string, v ...interface{}) {
 	if c.logger == nil {
 		return
 	}
@@ -65,7 +97,10 @@ func (c *Cmd) HandleComplete(b []byte) error {
 	if err := ep.Unmarshal(b); err != nil {
 		return err
 	}
-	c.compc <- ep
+	select {
+	case c.compc <- ep:
+	case <-c.quit:
+	}
 	return nil
 }
 
@@ -74,27 +109,90 @@ func (c *Cmd) HandleStatus(b []byte) error {
 	if err := ep.Unmarshal(b); err != nil {
 		return err
 	}
-	c.statusc <- ep
+	select {
+	case c.statusc <- ep:
+	case <-c.quit:
+	}
 	return nil
 }
 
 func (c *Cmd) Send(cp CmdParam) ([]byte, error) {
+	return c.SendCtx(context.Background(), cp)
+}
+
+// SendCtx sends the command cp, and returns its return parameters, like
+// Send, unless ctx is done first, in which case it returns ctx.Err().
+// The command is then forgotten: the event completing it, should the
+// controller still send it, is not matched to it, nor waited for.
+func (c *Cmd) SendCtx(ctx context.Context, cp CmdParam) ([]byte, error) {
+	id := atomic.AddUint64(&c.lastID, 1)
+	if c.span == nil {
+		return c.send(ctx, id, cp)
+	}
+	end := c.span(fmt.Sprintf("hci: %s #%d", cp.Opcode(), id))
+	rsp, err := c.send(ctx, id, cp)
+	if err == nil && len(rsp) > 0 && rsp[0] != 0x00 {
+		end(ErrCommandFailed{Opcode: cp.Opcode(), Status: rsp[0]})
+	} else {
+		end(err)
+	}
+	return rsp, err
+}
+
+func (c *Cmd) send(ctx context.Context, id uint64, cp CmdParam) ([]byte, error) {
 	op := cp.Opcode()
-	p := &cmdPkt{op: op, cp: cp, done: make(chan []byte)}
+	select {
+	case <-c.quit:
+		return nil, fmt.Errorf("hci: send %s: %w", op, hci.ErrClosed)
+	case <-ctx.Done():
+		return nil, fmt.Errorf("hci: send %s: %w", op, ctx.Err())
+	default:
+	}
+	p := &cmdPkt{id: id, op: op, cp: cp, done: make(chan []byte, 1), sent: time.Now()}
 	raw := p.marshal()
 
-	c.trace("< HCI Command: %s (0x%02X|0x%04X) plen: %d [ % X ]\n", op, op.ogf(), uint16(op.ocf()), len(raw)-4, raw) // FIXME: plen
+	c.trace("< HCI Command #%d: %s (0x%02X|0x%04X) plen: %d [ % X ]\n", id, op, op.ogf(), uint16(op.ocf()), len(raw)-4, raw) // FIXME: plen
+	c.mu.Lock()
 	c.sent = append(c.sent, p)
+	c.mu.Unlock()
 	if n, err := c.dev.Write(raw); err != nil {
-		return nil, err
+		return nil, fmt.Errorf("hci: send %s: %w", op, err)
 	} else if n != len(raw) {
-		return nil, errors.New("Failed to send whole cmd pkt to HCI socket")
+		return nil, fmt.Errorf("hci: send %s: %w", op, io.ErrShortWrite)
+	}
+	select {
+	case rsp := <-p.done:
+		return rsp, nil
+	case <-c.quit:
+		return nil, fmt.Errorf("hci: send %s: %w", op, hci.ErrClosed)
+	case <-ctx.Done():
+		c.forget(p)
+		c.trace("< HCI Command #%d: %s given up: %v\n", id, op, ctx.Err())
+		return nil, fmt.Errorf("hci: send %s: %w", op, ctx.Err())
+	}
+}
+
+// forget drops p from the commands waiting for their event, unless it
+// has just been answered.
+func (c *Cmd) forget(p *cmdPkt) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, q := range c.sent {
+		if q == p {
+			c.sent = append(c.sent[:i], c.sent[i+1:]...)
+			return
+		}
 	}
-	return <-p.done, nil
 }
 
 func (c *Cmd) SendAndCheckResp(cp CmdParam, exp []byte) error {
-	rsp, err := c.Send(cp)
+	return c.SendAndCheckRespCtx(context.Background(), cp, exp)
+}
+
+// SendAndCheckRespCtx is SendAndCheckResp, giving up once ctx is done,
+// as SendCtx does.
+func (c *Cmd) SendAndCheckRespCtx(ctx context.Context, cp CmdParam, exp []byte) error {
+	rsp, err := c.SendCtx(ctx, cp)
 	if err != nil {
 		return err
 	}
@@ -102,46 +200,75 @@ func (c *Cmd) SendAndCheckResp(cp CmdParam, exp []byte) error {
 	if len(exp) == 0 {
 		return nil
 	}
+	if len(rsp) == 0 {
+		return fmt.Errorf("%w %s return parameters", hci.ErrMalformed, cp.Opcode())
+	}
 	// Check the if status is one of the expected value
 	if !bytes.Contains(exp, rsp[0:1]) {
-		return fmt.Errorf("HCI command: '%s' return 0x%02X, expect: [%X] ", cp.Opcode(), rsp[0], exp)
+		return ErrCommandFailed{Opcode: cp.Opcode(), Status: rsp[0]}
 	}
 	return nil
 }
 
+// ErrCommandFailed is returned when a command completes with an
+// unexpected status. It matches the hci.Status it failed with, with
+// errors.Is.
+type ErrCommandFailed struct {
+	Opcode Opcode
+	Status uint8
+}
+
+func (e ErrCommandFailed) Error() string {
+	return fmt.Sprintf("hci: %s (0x%04X) failed: %s", e.Opcode, uint16(e.Opcode), hci.Status(e.Status).String())
+}
+
+func (e ErrCommandFailed) Is(target error) bool {
+	s, ok := target.(hci.Status)
+	return ok && uint8(s) == e.Status
+}
+
 func (c *Cmd) processCmdEvents() {
+	pprof.SetGoroutineLabels(pprof.WithLabels(context.Background(), pprof.Labels("gatt", "hci-cmd")))
+	defer close(c.done)
 	for {
 		select {
+		case <-c.quit:
+			return
 		case status := <-c.statusc:
-			found := false
-			for i, p := range c.sent {
-				if uint16(p.op) == status.CommandOpcode {
-					found = true
-					c.sent = append(c.sent[:i], c.sent[i+1:]...)
-					close(p.done)
-					break
-				}
-			}
-			if !found {
+			if p := c.pending(status.CommandOpcode); p != nil {
+				c.trace("> HCI Command Status #%d: %s %s\n", p.id, p.op, hci.Status(status.Status).String())
+				// Commands answered with a Command Status event have
+				// no return parameters; hand the status to the sender
+				// in their place, so that it can be checked the same way.
+				p.done <- []byte{status.Status}
+			} else {
 				log.Printf("Can't find the cmdPkt for this CommandStatusEP: %v", status)
 			}
 		case comp := <-c.compc:
-			found := false
-			for i, p := range c.sent {
-				if uint16(p.op) == comp.CommandOPCode {
-					found = true
-					c.sent = append(c.sent[:i], c.sent[i+1:]...)
-					p.done <- comp.ReturnParameters
-					break
-				}
-			}
-			if !found {
+			if p := c.pending(comp.CommandOPCode); p != nil {
+				c.trace("> HCI Command Complete #%d: %s [ % X ]\n", p.id, p.op, comp.ReturnParameters)
+				p.done <- comp.ReturnParameters
+			} else {
 				log.Printf("Can't find the cmdPkt for this CommandCompleteEP: %v", comp)
 			}
 		}
 	}
 }
 
+// pending removes, and returns, the first command sent of opcode op still
+// waiting for its event, if any.
+func (c *Cmd) pending(op uint16) *cmdPkt {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, p := range c.sent {
+		if uint16(p.op) == op {
+			c.sent = append(c.sent[:i], c.sent[i+1:]...)
+			return p
+		}
+	}
+	return nil
+}
+
 const (
 	linkCtl     = 0x01
 	linkPolicy  = 0x02
@@ -309,6 +436,18 @@ const (
 	opWriteLEHostSupported              = Opcode(hostCtl<<10 | 0x006D)
 )
 
+// Informational Parameters
+const (
+	opReadLocalVersionInformation = Opcode(infoParam<<10 | 0x0001)
+	opReadLocalSupportedCommands  = Opcode(infoParam<<10 | 0x0002)
+	opReadBDADDR                  = Opcode(infoParam<<10 | 0x0009)
+)
+
+// Status Parameters
+const (
+	opReadRSSI = Opcode(statusParam<<10 | 0x0005)
+)
+
 const (
 	opLESetEventMask                      = Opcode(leCtl<<10 | 0x0001)
 	opLEReadBufferSize                    = Opcode(leCtl<<10 | 0x0002)
@@ -342,6 +481,70 @@ const (
 	opLETestEnd                           = Opcode(leCtl<<10 | 0x001f)
 	opLERemoteConnectionParameterReply    = Opcode(leCtl<<10 | 0x0020)
 	opLERemoteConnectionParameterNegReply = Opcode(leCtl<<10 | 0x0021)
+	opLEReadResolvingListSize             = Opcode(leCtl<<10 | 0x002a)
+	opLEReadMaximumAdvertisingDataLength  = Opcode(leCtl<<10 | 0x003a)
+)
+
+// LE Data Packet Length Extension (Bluetooth 4.2)
+const (
+	opLESetDataLength                   = Opcode(leCtl<<10 | 0x0022)
+	opLEReadSuggestedDefaultDataLength  = Opcode(leCtl<<10 | 0x0023)
+	opLEWriteSuggestedDefaultDataLength = Opcode(leCtl<<10 | 0x0024)
+	opLEReadMaximumDataLength           = Opcode(leCtl<<10 | 0x002f)
+)
+
+// LE 2M and Coded PHYs (Bluetooth 5.0)
+const (
+	opLEReadPHY = Opcode(leCtl<<10 | 0x0030)
+	opLESetPHY  = Opcode(leCtl<<10 | 0x0032)
+)
+
+// Extended advertising (Bluetooth 5.0)
+const (
+	opLESetAdvertisingSetRandomAddress   = Opcode(leCtl<<10 | 0x0035)
+	opLESetExtendedAdvertisingParameters = Opcode(leCtl<<10 | 0x0036)
+	opLESetExtendedAdvertisingData       = Opcode(leCtl<<10 | 0x0037)
+	opLESetExtendedScanResponseData      = Opcode(leCtl<<10 | 0x0038)
+	opLESetExtendedAdvertisingEnable     = Opcode(leCtl<<10 | 0x0039)
+	opLERemoveAdvertisingSet             = Opcode(leCtl<<10 | 0x003c)
+)
+
+// Periodic advertising (Bluetooth 5.0)
+const (
+	opLESetPeriodicAdvertisingParameters    = Opcode(leCtl<<10 | 0x003e)
+	opLESetPeriodicAdvertisingData          = Opcode(leCtl<<10 | 0x003f)
+	opLESetPeriodicAdvertisingEnable        = Opcode(leCtl<<10 | 0x0040)
+	opLESetExtendedScanParameters           = Opcode(leCtl<<10 | 0x0041)
+	opLESetExtendedScanEnable               = Opcode(leCtl<<10 | 0x0042)
+	opLEPeriodicAdvertisingCreateSync       = Opcode(leCtl<<10 | 0x0044)
+	opLEPeriodicAdvertisingCreateSyncCancel = Opcode(leCtl<<10 | 0x0045)
+	opLEPeriodicAdvertisingTerminateSync    = Opcode(leCtl<<10 | 0x0046)
+)
+
+// Isochronous channels (Bluetooth 5.2)
+const (
+	opLEReadBufferSizeV2  = Opcode(leCtl<<10 | 0x0060)
+	opLESetCIGParameters  = Opcode(leCtl<<10 | 0x0062)
+	opLECreateCIS         = Opcode(leCtl<<10 | 0x0064)
+	opLERemoveCIG         = Opcode(leCtl<<10 | 0x0065)
+	opLEAcceptCISRequest  = Opcode(leCtl<<10 | 0x0066)
+	opLERejectCISRequest  = Opcode(leCtl<<10 | 0x0067)
+	opLECreateBIG         = Opcode(leCtl<<10 | 0x0068)
+	opLETerminateBIG      = Opcode(leCtl<<10 | 0x006A)
+	opLEBIGCreateSync     = Opcode(leCtl<<10 | 0x006B)
+	opLEBIGTerminateSync  = Opcode(leCtl<<10 | 0x006C)
+	opLESetupISODataPath  = Opcode(leCtl<<10 | 0x006E)
+	opLERemoveISODataPath = Opcode(leCtl<<10 | 0x006F)
+	opLESetHostFeature    = Opcode(leCtl<<10 | 0x0074)
+)
+
+// LE Power Control (Bluetooth 5.2)
+const (
+	opLEEnhancedReadTransmitPowerLevel  = Opcode(leCtl<<10 | 0x0076)
+	opLEReadRemoteTransmitPowerLevel    = Opcode(leCtl<<10 | 0x0077)
+	opLESetPathLossReportingParameters  = Opcode(leCtl<<10 | 0x0078)
+	opLESetPathLossReportingEnable      = Opcode(leCtl<<10 | 0x0079)
+	opLESetTransmitPowerReportingEnable = Opcode(leCtl<<10 | 0x007A)
 )
 
 var opName = map[Opcode]string{
@@ -485,6 +688,12 @@ var opName = map[Opcode]string{
 	opReadLEHostSupported:               "Read LE Host Supported",
 	opWriteLEHostSupported:              "Write LE Host Supported",
 
+	opReadLocalVersionInformation: "Read Local Version Information",
+	opReadLocalSupportedCommands:  "Read Local Supported Commands",
+	opReadBDADDR:                  "Read BD_ADDR",
+
+	opReadRSSI: "Read RSSI",
+
 	opLESetEventMask:                      "LE Set Event Mask",
 	opLEReadBufferSize:                    "LE Read Buffer Size",
 	opLEReadLocalSupportedFeatures:        "LE Read Local Supported Features",
@@ -517,6 +726,52 @@ var opName = map[Opcode]string{
 	opLETestEnd:                           "LE Test End",
 	opLERemoteConnectionParameterReply:    "LE Remote Connection Parameter Request Reply",
 	opLERemoteConnectionParameterNegReply: "LE Remote Connection Parameter Request Negative Repl",
+	opLEReadResolvingListSize:             "LE Read Resolving List Size",
+	opLEReadMaximumAdvertisingDataLength:  "LE Read Maximum Advertising Data Length",
+
+	opLESetDataLength:                   "LE Set Data Length",
+	opLEReadSuggestedDefaultDataLength:  "LE Read Suggested Default Data Length",
+	opLEWriteSuggestedDefaultDataLength: "LE Write Suggested Default Data Length",
+	opLEReadMaximumDataLength:           "LE Read Maximum Data Length",
+
+	opLEReadPHY: "LE Read PHY",
+	opLESetPHY:  "LE Set PHY",
+
+	opLESetAdvertisingSetRandomAddress:   "LE Set Advertising Set Random Address",
+	opLESetExtendedAdvertisingParameters: "LE Set Extended Advertising Parameters",
+	opLESetExtendedAdvertisingData:       "LE Set Extended Advertising Data",
+	opLESetExtendedScanResponseData:      "LE Set Extended Scan Response Data",
+	opLESetExtendedAdvertisingEnable:     "LE Set Extended Advertising Enable",
+	opLERemoveAdvertisingSet:             "LE Remove Advertising Set",
+
+	opLESetPeriodicAdvertisingParameters:    "LE Set Periodic Advertising Parameters",
+	opLESetPeriodicAdvertisingData:          "LE Set Periodic Advertising Data",
+	opLESetPeriodicAdvertisingEnable:        "LE Set Periodic Advertising Enable",
+	opLESetExtendedScanParameters:           "LE Set Extended Scan Parameters",
+	opLESetExtendedScanEnable:               "LE Set Extended Scan Enable",
+	opLEPeriodicAdvertisingCreateSync:       "LE Periodic Advertising Create Sync",
+	opLEPeriodicAdvertisingCreateSyncCancel: "LE Periodic Advertising Create Sync Cancel",
+	opLEPeriodicAdvertisingTerminateSync:    "LE Periodic Advertising Terminate Sync",
+
+	opLEReadBufferSizeV2:  "LE Read Buffer Size V2",
+	opLESetCIGParameters:  "LE Set CIG Parameters",
+	opLECreateCIS:         "LE Create CIS",
+	opLERemoveCIG:         "LE Remove CIG",
+	opLEAcceptCISRequest:  "LE Accept CIS Request",
+	opLERejectCISRequest:  "LE Reject CIS Request",
+	opLECreateBIG:         "LE Create BIG",
+	opLETerminateBIG:      "LE Terminate BIG",
+	opLEBIGCreateSync:     "LE BIG Create Sync",
+	opLEBIGTerminateSync:  "LE BIG Terminate Sync",
+	opLESetupISODataPath:  "LE Setup ISO Data Path",
+	opLERemoveISODataPath: "LE Remove ISO Data Path",
+	opLESetHostFeature:    "LE Set Host Feature",
+
+	opLEEnhancedReadTransmitPowerLevel:  "LE Enhanced Read Transmit Power Level",
+	opLEReadRemoteTransmitPowerLevel:    "LE Read Remote Transmit Power Level",
+	opLESetPathLossReportingParameters:  "LE Set Path Loss Reporting Parameters",
+	opLESetPathLossReportingEnable:      "LE Set Path Loss Reporting Enable",
+	opLESetTransmitPowerReportingEnable: "LE Set Transmit Power Reporting Enable",
 }
 
 type order struct{ binary.ByteOrder }
@@ -524,12 +779,71 @@ type order struct{ binary.ByteOrder }
 var o = order{binary.LittleEndian}
 
 func (o order) PutUint8(b []byte, v uint8) { b[0] = v }
+func (o order) PutUint24(b []byte, v uint32) {
+	b[0], b[1], b[2] = byte(v), byte(v>>8), byte(v>>16)
+}
 func (o order) PutMAC(b []byte, m [6]byte) {
 	b[0], b[1], b[2], b[3], b[4], b[5] = m[5], m[4], m[3], m[2], m[1], m[0]
 }
 
 // Link Control Commands
 
+// Inquiry (0x0001)
+type Inquiry struct {
+	LAP           uint32 // 24 bits; 0x9E8B33 for the General Inquiry Access Code
+	InquiryLength uint8  // in units of 1.28 s, from 0x01 to 0x30
+	NumResponses  uint8  // 0 for no limit
+}
+
+func (c Inquiry) Opcode() Opcode { return opInquiry }
+func (c Inquiry) Len() int       { return 5 }
+func (c Inquiry) Marshal(b []byte) {
+	o.PutUint24(b[0:], c.LAP)
+	b[3], b[4] = c.InquiryLength, c.NumResponses
+}
+
+// No Return Parameters, Check for Inquiry Complete Event
+type InquiryRP struct{}
+
+// Inquiry Cancel (0x0002)
+type InquiryCancel struct{}
+
+func (c InquiryCancel) Opcode() Opcode   { return opInquiryCancel }
+func (c InquiryCancel) Len() int         { return 0 }
+func (c InquiryCancel) Marshal(b []byte) {}
+
+type InquiryCancelRP struct{ Status uint8 }
+
+// Remote Name Request (0x0019)
+type RemoteNameRequest struct {
+	BDAddr                 [6]byte
+	PageScanRepetitionMode uint8
+	ClockOffset            uint16 // bit 15 set if valid
+}
+
+func (c RemoteNameRequest) Opcode() Opcode { return opRemoteNameReq }
+func (c RemoteNameRequest) Len() int       { return 10 }
+func (c RemoteNameRequest) Marshal(b []byte) {
+	o.PutMAC(b[0:], c.BDAddr)
+	b[6], b[7] = c.PageScanRepetitionMode, 0x00
+	o.PutUint16(b[8:], c.ClockOffset)
+}
+
+// No Return Parameters, Check for Remote Name Request Complete Event
+type RemoteNameRequestRP struct{}
+
+// Remote Name Request Cancel (0x001A)
+type RemoteNameRequestCancel struct{ BDAddr [6]byte }
+
+func (c RemoteNameRequestCancel) Opcode() Opcode   { return opRemoteNameReqCancel }
+func (c RemoteNameRequestCancel) Len() int         { return 6 }
+func (c RemoteNameRequestCancel) Marshal(b []byte) { o.PutMAC(b[0:], c.BDAddr) }
+
+type RemoteNameRequestCancelRP struct {
+	Status uint8
+	BDAddr [6]byte
+}
+
 // Disconnect (0x0006)
 type Disconnect struct {
 	ConnectionHandle uint16
@@ -698,6 +1012,61 @@ func (c WriteLEHostSupported) Marshal(b []byte) { b[0], b[1] = c.LESupportedHost
 
 type WriteLeHostSupportedRP struct{ Status uint8 }
 
+// Informational Parameters
+
+// Read Local Version Information (0x0001)
+type ReadLocalVersionInformation struct{}
+
+func (c ReadLocalVersionInformation) Opcode() Opcode   { return opReadLocalVersionInformation }
+func (c ReadLocalVersionInformation) Len() int         { return 0 }
+func (c ReadLocalVersionInformation) Marshal(b []byte) {}
+
+type ReadLocalVersionInformationRP struct {
+	Status           uint8
+	HCIVersion       uint8
+	HCIRevision      uint16
+	LMPVersion       uint8
+	ManufacturerName uint16
+	LMPSubversion    uint16
+}
+
+// Read Local Supported Commands (0x0002)
+type ReadLocalSupportedCommands struct{}
+
+func (c ReadLocalSupportedCommands) Opcode() Opcode   { return opReadLocalSupportedCommands }
+func (c ReadLocalSupportedCommands) Len() int         { return 0 }
+func (c ReadLocalSupportedCommands) Marshal(b []byte) {}
+
+type ReadLocalSupportedCommandsRP struct {
+	Status            uint8
+	SupportedCommands [64]byte
+}
+
+// Read BD_ADDR (0x0009)
+type ReadBDADDR struct{}
+
+func (c ReadBDADDR) Opcode() Opcode   { return opReadBDADDR }
+func (c ReadBDADDR) Len() int         { return 0 }
+func (c ReadBDADDR) Marshal(b []byte) {}
+
+type ReadBDADDRRP struct {
+	Status uint8
+	BDADDR [6]byte
+}
+
+// Read RSSI (0x0005)
+type ReadRSSI struct{ ConnectionHandle uint16 }
+
+func (c ReadRSSI) Opcode() Opcode   { return opReadRSSI }
+func (c ReadRSSI) Len() int         { return 2 }
+func (c ReadRSSI) Marshal(b []byte) { o.PutUint16(b, c.ConnectionHandle) }
+
+type ReadRSSIRP struct {
+	Status           uint8
+	ConnectionHandle uint16
+	RSSI             int8
+}
+
 // LE Controller Commands
 
 // LE Set Event Mask (0x0001)
@@ -715,7 +1084,7 @@ type LESetEventMaskRP struct {
 type LEReadBufferSize struct{}
 
 func (c LEReadBufferSize) Opcode() Opcode   { return opLEReadBufferSize }
-func (c LEReadBufferSize) Len() int         { return 1 }
+func (c LEReadBufferSize) Len() int         { return 0 }
 func (c LEReadBufferSize) Marshal(b []byte) {}
 
 type LEReadBufferSizeRP struct {
@@ -1181,3 +1550,824 @@ type LERemoteConnectionParameterNegReplyRP struct {
 	Status           uint8
 	ConnectionHandle uint16
 }
+
+// LE Read Resolving List Size (0x002A)
+type LEReadResolvingListSize struct{}
+
+func (c LEReadResolvingListSize) Opcode() Opcode   { return opLEReadResolvingListSize }
+func (c LEReadResolvingListSize) Len() int         { return 0 }
+func (c LEReadResolvingListSize) Marshal(b []byte) {}
+
+type LEReadResolvingListSizeRP struct {
+	Status            uint8
+	ResolvingListSize uint8
+}
+
+// LE Read Maximum Advertising Data Length (0x003A)
+type LEReadMaximumAdvertisingDataLength struct{}
+
+func (c LEReadMaximumAdvertisingDataLength) Opcode() Opcode {
+	return opLEReadMaximumAdvertisingDataLength
+}
+func (c LEReadMaximumAdvertisingDataLength) Len() int         { return 0 }
+func (c LEReadMaximumAdvertisingDataLength) Marshal(b []byte) {}
+
+type LEReadMaximumAdvertisingDataLengthRP struct {
+	Status                       uint8
+	MaximumAdvertisingDataLength uint16
+}
+
+// LE Set Data Length (0x0022)
+type LESetDataLength struct {
+	ConnectionHandle uint16
+	TxOctets         uint16
+	TxTime           uint16
+}
+
+func (c LESetDataLength) Opcode() Opcode { return opLESetDataLength }
+func (c LESetDataLength) Len() int       { return 6 }
+func (c LESetDataLength) Marshal(b []byte) {
+	o.PutUint16(b[0:], c.ConnectionHandle)
+	o.PutUint16(b[2:], c.TxOctets)
+	o.PutUint16(b[4:], c.TxTime)
+}
+
+type LESetDataLengthRP struct {
+	Status           uint8
+	ConnectionHandle uint16
+}
+
+// LE Read Suggested Default Data Length (0x0023)
+type LEReadSuggestedDefaultDataLength struct{}
+
+func (c LEReadSuggestedDefaultDataLength) Opcode() Opcode {
+	return opLEReadSuggestedDefaultDataLength
+}
+func (c LEReadSuggestedDefaultDataLength) Len() int         { return 0 }
+func (c LEReadSuggestedDefaultDataLength) Marshal(b []byte) {}
+
+type LEReadSuggestedDefaultDataLengthRP struct {
+	Status               uint8
+	SuggestedMaxTxOctets uint16
+	SuggestedMaxTxTime   uint16
+}
+
+// LE Write Suggested Default Data Length (0x0024)
+type LEWriteSuggestedDefaultDataLength struct {
+	SuggestedMaxTxOctets uint16
+	SuggestedMaxTxTime   uint16
+}
+
+func (c LEWriteSuggestedDefaultDataLength) Opcode() Opcode {
+	return opLEWriteSuggestedDefaultDataLength
+}
+func (c LEWriteSuggestedDefaultDataLength) Len() int { return 4 }
+func (c LEWriteSuggestedDefaultDataLength) Marshal(b []byte) {
+	o.PutUint16(b[0:], c.SuggestedMaxTxOctets)
+	o.PutUint16(b[2:], c.SuggestedMaxTxTime)
+}
+
+type LEWriteSuggestedDefaultDataLengthRP struct{ Status uint8 }
+
+// LE Read Maximum Data Length (0x002F)
+type LEReadMaximumDataLength struct{}
+
+func (c LEReadMaximumDataLength) Opcode() Opcode   { return opLEReadMaximumDataLength }
+func (c LEReadMaximumDataLength) Len() int         { return 0 }
+func (c LEReadMaximumDataLength) Marshal(b []byte) {}
+
+type LEReadMaximumDataLengthRP struct {
+	Status               uint8
+	SupportedMaxTxOctets uint16
+	SupportedMaxTxTime   uint16
+	SupportedMaxRxOctets uint16
+	SupportedMaxRxTime   uint16
+}
+
+// LE Read PHY (0x0030)
+type LEReadPHY struct{ ConnectionHandle uint16 }
+
+func (c LEReadPHY) Opcode() Opcode   { return opLEReadPHY }
+func (c LEReadPHY) Len() int         { return 2 }
+func (c LEReadPHY) Marshal(b []byte) { o.PutUint16(b, c.ConnectionHandle) }
+
+type LEReadPHYRP struct {
+	Status           uint8
+	ConnectionHandle uint16
+	TxPHY            uint8
+	RxPHY            uint8
+}
+
+// LE Set PHY (0x0032)
+type LESetPHY struct {
+	ConnectionHandle uint16
+	AllPHYs          uint8
+	TxPHYs           uint8
+	RxPHYs           uint8
+	PHYOptions       uint16
+}
+
+func (c LESetPHY) Opcode() Opcode { return opLESetPHY }
+func (c LESetPHY) Len() int       { return 7 }
+func (c LESetPHY) Marshal(b []byte) {
+	o.PutUint16(b[0:], c.ConnectionHandle)
+	o.PutUint8(b[2:], c.AllPHYs)
+	o.PutUint8(b[3:], c.TxPHYs)
+	o.PutUint8(b[4:], c.RxPHYs)
+	o.PutUint16(b[5:], c.PHYOptions)
+}
+
+// No Return Parameters, Check for LE PHY Update Complete Event
+type LESetPHYRP struct{}
+
+// LE Set Advertising Set Random Address (0x0035)
+type LESetAdvertisingSetRandomAddress struct {
+	AdvertisingHandle uint8
+	RandomAddress     [6]byte
+}
+
+func (c LESetAdvertisingSetRandomAddress) Opcode() Opcode {
+	return opLESetAdvertisingSetRandomAddress
+}
+func (c LESetAdvertisingSetRandomAddress) Len() int { return 7 }
+func (c LESetAdvertisingSetRandomAddress) Marshal(b []byte) {
+	o.PutUint8(b[0:], c.AdvertisingHandle)
+	o.PutMAC(b[1:], c.RandomAddress)
+}
+
+type LESetAdvertisingSetRandomAddressRP struct{ Status uint8 }
+
+// LE Set Extended Advertising Parameters (0x0036)
+type LESetExtendedAdvertisingParameters struct {
+	AdvertisingHandle             uint8
+	AdvertisingEventProperties    uint16
+	PrimaryAdvertisingIntervalMin uint32 // 24 bits
+	PrimaryAdvertisingIntervalMax uint32 // 24 bits
+	PrimaryAdvertisingChannelMap  uint8
+	OwnAddressType                uint8
+	PeerAddressType               uint8
+	PeerAddress                   [6]byte
+	AdvertisingFilterPolicy       uint8
+	AdvertisingTxPower            int8 // 0x7F: no preference
+	PrimaryAdvertisingPHY         uint8
+	SecondaryAdvertisingMaxSkip   uint8
+	SecondaryAdvertisingPHY       uint8
+	AdvertisingSID                uint8
+	ScanRequestNotificationEnable uint8
+}
+
+func (c LESetExtendedAdvertisingParameters) Opcode() Opcode {
+	return opLESetExtendedAdvertisingParameters
+}
+func (c LESetExtendedAdvertisingParameters) Len() int { return 25 }
+func (c LESetExtendedAdvertisingParameters) Marshal(b []byte) {
+	o.PutUint8(b[0:], c.AdvertisingHandle)
+	o.PutUint16(b[1:], c.AdvertisingEventProperties)
+	o.PutUint24(b[3:], c.PrimaryAdvertisingIntervalMin)
+	o.PutUint24(b[6:], c.PrimaryAdvertisingIntervalMax)
+	o.PutUint8(b[9:], c.PrimaryAdvertisingChannelMap)
+	o.PutUint8(b[10:], c.OwnAddressType)
+	o.PutUint8(b[11:], c.PeerAddressType)
+	o.PutMAC(b[12:], c.PeerAddress)
+	o.PutUint8(b[18:], c.AdvertisingFilterPolicy)
+	o.PutUint8(b[19:], uint8(c.AdvertisingTxPower))
+	o.PutUint8(b[20:], c.PrimaryAdvertisingPHY)
+	o.PutUint8(b[21:], c.SecondaryAdvertisingMaxSkip)
+	o.PutUint8(b[22:], c.SecondaryAdvertisingPHY)
+	o.PutUint8(b[23:], c.AdvertisingSID)
+	o.PutUint8(b[24:], c.ScanRequestNotificationEnable)
+}
+
+type LESetExtendedAdvertisingParametersRP struct {
+	Status          uint8
+	SelectedTxPower int8
+}
+
+// Operations of LE Set Extended Advertising Data and LE Set Extended
+// Scan Response Data, as the data is fragmented.
+const (
+	ExtAdvIntermediateFragment = 0x00
+	ExtAdvFirstFragment        = 0x01
+	ExtAdvLastFragment         = 0x02
+	ExtAdvCompleteData         = 0x03
+)
+
+// MaxExtAdvFragmentLength is the most data an LE Set Extended
+// Advertising Data, or LE Set Extended Scan Response Data, carries.
+const MaxExtAdvFragmentLength = 251
+
+// LE Set Extended Advertising Data (0x0037)
+type LESetExtendedAdvertisingData struct {
+	AdvertisingHandle  uint8
+	Operation          uint8
+	FragmentPreference uint8
+	AdvertisingData    []byte
+}
+
+func (c LESetExtendedAdvertisingData) Opcode() Opcode { return opLESetExtendedAdvertisingData }
+func (c LESetExtendedAdvertisingData) Len() int       { return 4 + len(c.AdvertisingData) }
+func (c LESetExtendedAdvertisingData) Marshal(b []byte) {
+	o.PutUint8(b[0:], c.AdvertisingHandle)
+	o.PutUint8(b[1:], c.Operation)
+	o.PutUint8(b[2:], c.FragmentPreference)
+	o.PutUint8(b[3:], uint8(len(c.AdvertisingData)))
+	copy(b[4:], c.AdvertisingData)
+}
+
+type LESetExtendedAdvertisingDataRP struct{ Status uint8 }
+
+// LE Set Extended Scan Response Data (0x0038)
+type LESetExtendedScanResponseData struct {
+	AdvertisingHandle  uint8
+	Operation          uint8
+	FragmentPreference uint8
+	ScanResponseData   []byte
+}
+
+func (c LESetExtendedScanResponseData) Opcode() Opcode { return opLESetExtendedScanResponseData }
+func (c LESetExtendedScanResponseData) Len() int       { return 4 + len(c.ScanResponseData) }
+func (c LESetExtendedScanResponseData) Marshal(b []byte) {
+	o.PutUint8(b[0:], c.AdvertisingHandle)
+	o.PutUint8(b[1:], c.Operation)
+	o.PutUint8(b[2:], c.FragmentPreference)
+	o.PutUint8(b[3:], uint8(len(c.ScanResponseData)))
+	copy(b[4:], c.ScanResponseData)
+}
+
+type LESetExtendedScanResponseDataRP struct{ Status uint8 }
+
+// An advertising set, as enabled or disabled by LE Set Extended
+// Advertising Enable.
+type ExtAdvSet struct {
+	AdvertisingHandle            uint8
+	Duration                     uint16 // in units of 10 ms; 0 for no limit
+	MaxExtendedAdvertisingEvents uint8  // 0 for no limit
+}
+
+// LE Set Extended Advertising Enable (0x0039)
+type LESetExtendedAdvertisingEnable struct {
+	Enable uint8
+	Sets   []ExtAdvSet // none disables all the sets
+}
+
+func (c LESetExtendedAdvertisingEnable) Opcode() Opcode { return opLESetExtendedAdvertisingEnable }
+func (c LESetExtendedAdvertisingEnable) Len() int       { return 2 + 4*len(c.Sets) }
+func (c LESetExtendedAdvertisingEnable) Marshal(b []byte) {
+	o.PutUint8(b[0:], c.Enable)
+	o.PutUint8(b[1:], uint8(len(c.Sets)))
+	for i, s := range c.Sets {
+		p := b[2+4*i:]
+		o.PutUint8(p[0:], s.AdvertisingHandle)
+		o.PutUint16(p[1:], s.Duration)
+		o.PutUint8(p[3:], s.MaxExtendedAdvertisingEvents)
+	}
+}
+
+type LESetExtendedAdvertisingEnableRP struct{ Status uint8 }
+
+// LE Remove Advertising Set (0x003C)
+type LERemoveAdvertisingSet struct{ AdvertisingHandle uint8 }
+
+func (c LERemoveAdvertisingSet) Opcode() Opcode   { return opLERemoveAdvertisingSet }
+func (c LERemoveAdvertisingSet) Len() int         { return 1 }
+func (c LERemoveAdvertisingSet) Marshal(b []byte) { b[0] = c.AdvertisingHandle }
+
+type LERemoveAdvertisingSetRP struct{ Status uint8 }
+
+// LE Set Periodic Advertising Parameters (0x003E)
+type LESetPeriodicAdvertisingParameters struct {
+	AdvertisingHandle           uint8
+	PeriodicAdvertisingInterval [2]uint16 // min, max, in units of 1.25 ms
+	PeriodicAdvertisingProps    uint16
+}
+
+func (c LESetPeriodicAdvertisingParameters) Opcode() Opcode {
+	return opLESetPeriodicAdvertisingParameters
+}
+func (c LESetPeriodicAdvertisingParameters) Len() int { return 7 }
+func (c LESetPeriodicAdvertisingParameters) Marshal(b []byte) {
+	o.PutUint8(b[0:], c.AdvertisingHandle)
+	o.PutUint16(b[1:], c.PeriodicAdvertisingInterval[0])
+	o.PutUint16(b[3:], c.PeriodicAdvertisingInterval[1])
+	o.PutUint16(b[5:], c.PeriodicAdvertisingProps)
+}
+
+type LESetPeriodicAdvertisingParametersRP struct{ Status uint8 }
+
+// MaxPeriodicAdvFragmentLength is the most data an LE Set Periodic
+// Advertising Data carries.
+const MaxPeriodicAdvFragmentLength = 252
+
+// LE Set Periodic Advertising Data (0x003F); the operations are those of
+// LE Set Extended Advertising Data.
+type LESetPeriodicAdvertisingData struct {
+	AdvertisingHandle uint8
+	Operation         uint8
+	AdvertisingData   []byte
+}
+
+func (c LESetPeriodicAdvertisingData) Opcode() Opcode { return opLESetPeriodicAdvertisingData }
+func (c LESetPeriodicAdvertisingData) Len() int       { return 3 + len(c.AdvertisingData) }
+func (c LESetPeriodicAdvertisingData) Marshal(b []byte) {
+	o.PutUint8(b[0:], c.AdvertisingHandle)
+	o.PutUint8(b[1:], c.Operation)
+	o.PutUint8(b[2:], uint8(len(c.AdvertisingData)))
+	copy(b[3:], c.AdvertisingData)
+}
+
+type LESetPeriodicAdvertisingDataRP struct{ Status uint8 }
+
+// LE Set Periodic Advertising Enable (0x0040)
+type LESetPeriodicAdvertisingEnable struct {
+	Enable            uint8
+	AdvertisingHandle uint8
+}
+
+func (c LESetPeriodicAdvertisingEnable) Opcode() Opcode { return opLESetPeriodicAdvertisingEnable }
+func (c LESetPeriodicAdvertisingEnable) Len() int       { return 2 }
+func (c LESetPeriodicAdvertisingEnable) Marshal(b []byte) {
+	o.PutUint8(b[0:], c.Enable)
+	o.PutUint8(b[1:], c.AdvertisingHandle)
+}
+
+type LESetPeriodicAdvertisingEnableRP struct{ Status uint8 }
+
+// Scanning parameters of a PHY, as set by LE Set Extended Scan
+// Parameters.
+type ExtScanPHY struct {
+	ScanType     uint8
+	ScanInterval uint16
+	ScanWindow   uint16
+}
+
+// LE Set Extended Scan Parameters (0x0041)
+type LESetExtendedScanParameters struct {
+	OwnAddressType       uint8
+	ScanningFilterPolicy uint8
+	ScanningPHYs         uint8        // bit 0: LE 1M, bit 2: LE Coded
+	PHYs                 []ExtScanPHY // one per bit of ScanningPHYs
+}
+
+func (c LESetExtendedScanParameters) Opcode() Opcode { return opLESetExtendedScanParameters }
+func (c LESetExtendedScanParameters) Len() int       { return 3 + 5*len(c.PHYs) }
+func (c LESetExtendedScanParameters) Marshal(b []byte) {
+	o.PutUint8(b[0:], c.OwnAddressType)
+	o.PutUint8(b[1:], c.ScanningFilterPolicy)
+	o.PutUint8(b[2:], c.ScanningPHYs)
+	for i, p := range c.PHYs {
+		q := b[3+5*i:]
+		o.PutUint8(q[0:], p.ScanType)
+		o.PutUint16(q[1:], p.ScanInterval)
+		o.PutUint16(q[3:], p.ScanWindow)
+	}
+}
+
+type LESetExtendedScanParametersRP struct{ Status uint8 }
+
+// LE Set Extended Scan Enable (0x0042)
+type LESetExtendedScanEnable struct {
+	Enable           uint8
+	FilterDuplicates uint8
+	Duration         uint16 // in units of 10 ms; 0 for no limit
+	Period           uint16 // in units of 1.28 s; 0 for no period
+}
+
+func (c LESetExtendedScanEnable) Opcode() Opcode { return opLESetExtendedScanEnable }
+func (c LESetExtendedScanEnable) Len() int       { return 6 }
+func (c LESetExtendedScanEnable) Marshal(b []byte) {
+	o.PutUint8(b[0:], c.Enable)
+	o.PutUint8(b[1:], c.FilterDuplicates)
+	o.PutUint16(b[2:], c.Duration)
+	o.PutUint16(b[4:], c.Period)
+}
+
+type LESetExtendedScanEnableRP struct{ Status uint8 }
+
+// LE Periodic Advertising Create Sync (0x0044)
+type LEPeriodicAdvertisingCreateSync struct {
+	Options               uint8
+	AdvertisingSID        uint8
+	AdvertiserAddressType uint8
+	AdvertiserAddress     [6]byte
+	Skip                  uint16
+	SyncTimeout           uint16 // in units of 10 ms
+	SyncCTEType           uint8
+}
+
+func (c LEPeriodicAdvertisingCreateSync) Opcode() Opcode { return opLEPeriodicAdvertisingCreateSync }
+func (c LEPeriodicAdvertisingCreateSync) Len() int       { return 14 }
+func (c LEPeriodicAdvertisingCreateSync) Marshal(b []byte) {
+	o.PutUint8(b[0:], c.Options)
+	o.PutUint8(b[1:], c.AdvertisingSID)
+	o.PutUint8(b[2:], c.AdvertiserAddressType)
+	o.PutMAC(b[3:], c.AdvertiserAddress)
+	o.PutUint16(b[9:], c.Skip)
+	o.PutUint16(b[11:], c.SyncTimeout)
+	o.PutUint8(b[13:], c.SyncCTEType)
+}
+
+// LE Periodic Advertising Create Sync Cancel (0x0045)
+type LEPeriodicAdvertisingCreateSyncCancel struct{}
+
+func (c LEPeriodicAdvertisingCreateSyncCancel) Opcode() Opcode {
+	return opLEPeriodicAdvertisingCreateSyncCancel
+}
+func (c LEPeriodicAdvertisingCreateSyncCancel) Len() int         { return 0 }
+func (c LEPeriodicAdvertisingCreateSyncCancel) Marshal(b []byte) {}
+
+type LEPeriodicAdvertisingCreateSyncCancelRP struct{ Status uint8 }
+
+// LE Periodic Advertising Terminate Sync (0x0046)
+type LEPeriodicAdvertisingTerminateSync struct{ SyncHandle uint16 }
+
+func (c LEPeriodicAdvertisingTerminateSync) Opcode() Opcode {
+	return opLEPeriodicAdvertisingTerminateSync
+}
+func (c LEPeriodicAdvertisingTerminateSync) Len() int         { return 2 }
+func (c LEPeriodicAdvertisingTerminateSync) Marshal(b []byte) { o.PutUint16(b, c.SyncHandle) }
+
+type LEPeriodicAdvertisingTerminateSyncRP struct{ Status uint8 }
+
+// LE Read Buffer Size [v2] (0x0060)
+type LEReadBufferSizeV2 struct{}
+
+func (c LEReadBufferSizeV2) Opcode() Opcode   { return opLEReadBufferSizeV2 }
+func (c LEReadBufferSizeV2) Len() int         { return 0 }
+func (c LEReadBufferSizeV2) Marshal(b []byte) {}
+
+type LEReadBufferSizeV2RP struct {
+	Status                   uint8
+	LEACLDataPacketLength    uint16
+	TotalNumLEACLDataPackets uint8
+	ISODataPacketLength      uint16
+	TotalNumISODataPackets   uint8
+}
+
+// CIS configuration, as used by LE Set CIG Parameters.
+type CISParam struct {
+	CISID      uint8
+	MaxSDUMToS uint16
+	MaxSDUSToM uint16
+	PHYMToS    uint8
+	PHYSToM    uint8
+	RTNMToS    uint8
+	RTNSToM    uint8
+}
+
+// LE Set CIG Parameters (0x0062)
+type LESetCIGParameters struct {
+	CIGID                   uint8
+	SDUIntervalMToS         uint32 // 24 bits
+	SDUIntervalSToM         uint32 // 24 bits
+	WorstCaseSCA            uint8
+	Packing                 uint8
+	Framing                 uint8
+	MaxTransportLatencyMToS uint16
+	MaxTransportLatencySToM uint16
+	CIS                     []CISParam
+}
+
+func (c LESetCIGParameters) Opcode() Opcode { return opLESetCIGParameters }
+func (c LESetCIGParameters) Len() int       { return 15 + 9*len(c.CIS) }
+func (c LESetCIGParameters) Marshal(b []byte) {
+	o.PutUint8(b[0:], c.CIGID)
+	o.PutUint24(b[1:], c.SDUIntervalMToS)
+	o.PutUint24(b[4:], c.SDUIntervalSToM)
+	o.PutUint8(b[7:], c.WorstCaseSCA)
+	o.PutUint8(b[8:], c.Packing)
+	o.PutUint8(b[9:], c.Framing)
+	o.PutUint16(b[10:], c.MaxTransportLatencyMToS)
+	o.PutUint16(b[12:], c.MaxTransportLatencySToM)
+	o.PutUint8(b[14:], uint8(len(c.CIS)))
+	for i, cis := range c.CIS {
+		p := b[15+9*i:]
+		o.PutUint8(p[0:], cis.CISID)
+		o.PutUint16(p[1:], cis.MaxSDUMToS)
+		o.PutUint16(p[3:], cis.MaxSDUSToM)
+		o.PutUint8(p[5:], cis.PHYMToS)
+		o.PutUint8(p[6:], cis.PHYSToM)
+		o.PutUint8(p[7:], cis.RTNMToS)
+		o.PutUint8(p[8:], cis.RTNSToM)
+	}
+}
+
+type LESetCIGParametersRP struct {
+	Status            uint8
+	CIGID             uint8
+	ConnectionHandles []uint16
+}
+
+func (rp *LESetCIGParametersRP) Unmarshal(b []byte) error {
+	if len(b) < 3 || len(b) < 3+2*int(b[2]) {
+		return fmt.Errorf("%w LE Set CIG Parameters return parameters", hci.ErrMalformed)
+	}
+	rp.Status, rp.CIGID = b[0], b[1]
+	rp.ConnectionHandles = make([]uint16, b[2])
+	for i := range rp.ConnectionHandles {
+		rp.ConnectionHandles[i] = o.Uint16(b[3+2*i:])
+	}
+	return nil
+}
+
+// LE Create CIS (0x0064)
+type LECreateCIS struct {
+	CISConnectionHandle []uint16
+	ACLConnectionHandle []uint16
+}
+
+func (c LECreateCIS) Opcode() Opcode { return opLECreateCIS }
+func (c LECreateCIS) Len() int       { return 1 + 4*len(c.CISConnectionHandle) }
+func (c LECreateCIS) Marshal(b []byte) {
+	o.PutUint8(b[0:], uint8(len(c.CISConnectionHandle)))
+	for i, h := range c.CISConnectionHandle {
+		o.PutUint16(b[1+4*i:], h)
+		o.PutUint16(b[3+4*i:], c.ACLConnectionHandle[i])
+	}
+}
+
+// No Return Parameters, Check for LE CIS Established Event
+type LECreateCISRP struct{}
+
+// LE Remove CIG (0x0065)
+type LERemoveCIG struct{ CIGID uint8 }
+
+func (c LERemoveCIG) Opcode() Opcode   { return opLERemoveCIG }
+func (c LERemoveCIG) Len() int         { return 1 }
+func (c LERemoveCIG) Marshal(b []byte) { b[0] = c.CIGID }
+
+type LERemoveCIGRP struct {
+	Status uint8
+	CIGID  uint8
+}
+
+// LE Accept CIS Request (0x0066)
+type LEAcceptCISRequest struct{ ConnectionHandle uint16 }
+
+func (c LEAcceptCISRequest) Opcode() Opcode   { return opLEAcceptCISRequest }
+func (c LEAcceptCISRequest) Len() int         { return 2 }
+func (c LEAcceptCISRequest) Marshal(b []byte) { o.PutUint16(b, c.ConnectionHandle) }
+
+// No Return Parameters, Check for LE CIS Established Event
+type LEAcceptCISRequestRP struct{}
+
+// LE Reject CIS Request (0x0067)
+type LERejectCISRequest struct {
+	ConnectionHandle uint16
+	Reason           uint8
+}
+
+func (c LERejectCISRequest) Opcode() Opcode { return opLERejectCISRequest }
+func (c LERejectCISRequest) Len() int       { return 3 }
+func (c LERejectCISRequest) Marshal(b []byte) {
+	o.PutUint16(b[0:], c.ConnectionHandle)
+	b[2] = c.Reason
+}
+
+type LERejectCISRequestRP struct {
+	Status           uint8
+	ConnectionHandle uint16
+}
+
+// LE Create BIG (0x0068)
+type LECreateBIG struct {
+	BIGHandle           uint8
+	AdvertisingHandle   uint8
+	NumBIS              uint8
+	SDUInterval         uint32 // 24 bits
+	MaxSDU              uint16
+	MaxTransportLatency uint16
+	RTN                 uint8
+	PHY                 uint8
+	Packing             uint8
+	Framing             uint8
+	Encryption          uint8
+	BroadcastCode       [16]byte
+}
+
+func (c LECreateBIG) Opcode() Opcode { return opLECreateBIG }
+func (c LECreateBIG) Len() int       { return 31 }
+func (c LECreateBIG) Marshal(b []byte) {
+	o.PutUint8(b[0:], c.BIGHandle)
+	o.PutUint8(b[1:], c.AdvertisingHandle)
+	o.PutUint8(b[2:], c.NumBIS)
+	o.PutUint24(b[3:], c.SDUInterval)
+	o.PutUint16(b[6:], c.MaxSDU)
+	o.PutUint16(b[8:], c.MaxTransportLatency)
+	o.PutUint8(b[10:], c.RTN)
+	o.PutUint8(b[11:], c.PHY)
+	o.PutUint8(b[12:], c.Packing)
+	o.PutUint8(b[13:], c.Framing)
+	o.PutUint8(b[14:], c.Encryption)
+	copy(b[15:], c.BroadcastCode[:])
+}
+
+// No Return Parameters, Check for LE Create BIG Complete Event
+type LECreateBIGRP struct{}
+
+// LE Terminate BIG (0x006A)
+type LETerminateBIG struct {
+	BIGHandle uint8
+	Reason    uint8
+}
+
+func (c LETerminateBIG) Opcode() Opcode   { return opLETerminateBIG }
+func (c LETerminateBIG) Len() int         { return 2 }
+func (c LETerminateBIG) Marshal(b []byte) { b[0], b[1] = c.BIGHandle, c.Reason }
+
+// No Return Parameters, Check for LE Terminate BIG Complete Event
+type LETerminateBIGRP struct{}
+
+// LE BIG Create Sync (0x006B)
+type LEBIGCreateSync struct {
+	BIGHandle      uint8
+	SyncHandle     uint16
+	Encryption     uint8
+	BroadcastCode  [16]byte
+	MSE            uint8
+	BIGSyncTimeout uint16
+	BIS            []uint8
+}
+
+func (c LEBIGCreateSync) Opcode() Opcode { return opLEBIGCreateSync }
+func (c LEBIGCreateSync) Len() int       { return 24 + len(c.BIS) }
+func (c LEBIGCreateSync) Marshal(b []byte) {
+	o.PutUint8(b[0:], c.BIGHandle)
+	o.PutUint16(b[1:], c.SyncHandle)
+	o.PutUint8(b[3:], c.Encryption)
+	copy(b[4:], c.BroadcastCode[:])
+	o.PutUint8(b[20:], c.MSE)
+	o.PutUint16(b[21:], c.BIGSyncTimeout)
+	o.PutUint8(b[23:], uint8(len(c.BIS)))
+	copy(b[24:], c.BIS)
+}
+
+// No Return Parameters, Check for LE BIG Sync Established Event
+type LEBIGCreateSyncRP struct{}
+
+// LE BIG Terminate Sync (0x006C)
+type LEBIGTerminateSync struct{ BIGHandle uint8 }
+
+func (c LEBIGTerminateSync) Opcode() Opcode   { return opLEBIGTerminateSync }
+func (c LEBIGTerminateSync) Len() int         { return 1 }
+func (c LEBIGTerminateSync) Marshal(b []byte) { b[0] = c.BIGHandle }
+
+type LEBIGTerminateSyncRP struct {
+	Status    uint8
+	BIGHandle uint8
+}
+
+// LE Setup ISO Data Path (0x006E)
+type LESetupISODataPath struct {
+	ConnectionHandle   uint16
+	DataPathDirection  uint8
+	DataPathID         uint8
+	CodecID            [5]byte
+	ControllerDelay    uint32 // 24 bits
+	CodecConfiguration []byte
+}
+
+func (c LESetupISODataPath) Opcode() Opcode { return opLESetupISODataPath }
+func (c LESetupISODataPath) Len() int       { return 13 + len(c.CodecConfiguration) }
+func (c LESetupISODataPath) Marshal(b []byte) {
+	o.PutUint16(b[0:], c.ConnectionHandle)
+	o.PutUint8(b[2:], c.DataPathDirection)
+	o.PutUint8(b[3:], c.DataPathID)
+	copy(b[4:], c.CodecID[:])
+	o.PutUint24(b[9:], c.ControllerDelay)
+	o.PutUint8(b[12:], uint8(len(c.CodecConfiguration)))
+	copy(b[13:], c.CodecConfiguration)
+}
+
+type LESetupISODataPathRP struct {
+	Status           uint8
+	ConnectionHandle uint16
+}
+
+// LE Remove ISO Data Path (0x006F)
+type LERemoveISODataPath struct {
+	ConnectionHandle  uint16
+	DataPathDirection uint8
+}
+
+func (c LERemoveISODataPath) Opcode() Opcode { return opLERemoveISODataPath }
+func (c LERemoveISODataPath) Len() int       { return 3 }
+func (c LERemoveISODataPath) Marshal(b []byte) {
+	o.PutUint16(b[0:], c.ConnectionHandle)
+	b[2] = c.DataPathDirection
+}
+
+type LERemoveISODataPathRP struct {
+	Status           uint8
+	ConnectionHandle uint16
+}
+
+// LE Set Host Feature (0x0074)
+type LESetHostFeature struct {
+	BitNumber uint8
+	BitValue  uint8
+}
+
+func (c LESetHostFeature) Opcode() Opcode   { return opLESetHostFeature }
+func (c LESetHostFeature) Len() int         { return 2 }
+func (c LESetHostFeature) Marshal(b []byte) { b[0], b[1] = c.BitNumber, c.BitValue }
+
+type LESetHostFeatureRP struct{ Status uint8 }
+
+// LE Enhanced Read Transmit Power Level (0x0076)
+type LEEnhancedReadTransmitPowerLevel struct {
+	ConnectionHandle uint16
+	PHY              uint8
+}
+
+func (c LEEnhancedReadTransmitPowerLevel) Opcode() Opcode { return opLEEnhancedReadTransmitPowerLevel }
+func (c LEEnhancedReadTransmitPowerLevel) Len() int       { return 3 }
+func (c LEEnhancedReadTransmitPowerLevel) Marshal(b []byte) {
+	o.PutUint16(b[0:], c.ConnectionHandle)
+	b[2] = c.PHY
+}
+
+type LEEnhancedReadTransmitPowerLevelRP struct {
+	Status              uint8
+	ConnectionHandle    uint16
+	PHY                 uint8
+	CurrentTxPowerLevel int8
+	MaxTxPowerLevel     int8
+}
+
+// LE Read Remote Transmit Power Level (0x0077)
+type LEReadRemoteTransmitPowerLevel struct {
+	ConnectionHandle uint16
+	PHY              uint8
+}
+
+func (c LEReadRemoteTransmitPowerLevel) Opcode() Opcode { return opLEReadRemoteTransmitPowerLevel }
+func (c LEReadRemoteTransmitPowerLevel) Len() int       { return 3 }
+func (c LEReadRemoteTransmitPowerLevel) Marshal(b []byte) {
+	o.PutUint16(b[0:], c.ConnectionHandle)
+	b[2] = c.PHY
+}
+
+// No Return Parameters, Check for LE Transmit Power Reporting Event
+type LEReadRemoteTransmitPowerLevelRP struct{}
+
+// LE Set Path Loss Reporting Parameters (0x0078)
+type LESetPathLossReportingParameters struct {
+	ConnectionHandle uint16
+	HighThreshold    uint8
+	HighHysteresis   uint8
+	LowThreshold     uint8
+	LowHysteresis    uint8
+	MinTimeSpent     uint16
+}
+
+func (c LESetPathLossReportingParameters) Opcode() Opcode { return opLESetPathLossReportingParameters }
+func (c LESetPathLossReportingParameters) Len() int       { return 8 }
+func (c LESetPathLossReportingParameters) Marshal(b []byte) {
+	o.PutUint16(b[0:], c.ConnectionHandle)
+	b[2], b[3], b[4], b[5] = c.HighThreshold, c.HighHysteresis, c.LowThreshold, c.LowHysteresis
+	o.PutUint16(b[6:], c.MinTimeSpent)
+}
+
+type LESetPathLossReportingParametersRP struct {
+	Status           uint8
+	ConnectionHandle uint16
+}
+
+// LE Set Path Loss Reporting Enable (0x0079)
+type LESetPathLossReportingEnable struct {
+	ConnectionHandle uint16
+	Enable           uint8
+}
+
+func (c LESetPathLossReportingEnable) Opcode() Opcode { return opLESetPathLossReportingEnable }
+func (c LESetPathLossReportingEnable) Len() int       { return 3 }
+func (c LESetPathLossReportingEnable) Marshal(b []byte) {
+	o.PutUint16(b[0:], c.ConnectionHandle)
+	b[2] = c.Enable
+}
+
+type LESetPathLossReportingEnableRP struct {
+	Status           uint8
+	ConnectionHandle uint16
+}
+
+// LE Set Transmit Power Reporting Enable (0x007A)
+type LESetTransmitPowerReportingEnable struct {
+	ConnectionHandle uint16
+	LocalEnable      uint8
+	RemoteEnable     uint8
+}
+
+func (c LESetTransmitPowerReportingEnable) Opcode() Opcode {
+	return opLESetTransmitPowerReportingEnable
+}
+func (c LESetTransmitPowerReportingEnable) Len() int { return 4 }
+func (c LESetTransmitPowerReportingEnable) Marshal(b []byte) {
+	o.PutUint16(b[0:], c.ConnectionHandle)
+	b[2], b[3] = c.LocalEnable, c.RemoteEnable
+}
+
+type LESetTransmitPowerReportingEnableRP struct {
+	Status           uint8
+	ConnectionHandle uint16
+}
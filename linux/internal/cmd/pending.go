@@ -0,0 +1,22 @@
+package cmd
+
+import "time"
+
+// A Pending is a command sent, whose event is awaited.
+type Pending struct {
+	ID     uint64 // as in the logs and spans
+	Opcode Opcode
+	Sent   time.Time
+}
+
+// Pending returns the commands sent whose events are awaited, oldest
+// first.
+func (c *Cmd) Pending() []Pending {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ps := make([]Pending, 0, len(c.sent))
+	for _, p := range c.sent {
+		ps = append(ps, Pending{ID: p.id, Opcode: p.op, Sent: p.sent})
+	}
+	return ps
+}
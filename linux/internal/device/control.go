@@ -0,0 +1,41 @@
+package device
+
+import (
+	"syscall"
+	"time"
+
+	"github.com/paypal/gatt/linux/internal/socket"
+)
+
+// A Control is the control channel of the HCI sockets: the management
+// interface of the kernel, which reports its HCI devices as they are
+// added, and removed.
+type Control struct {
+	fd int
+}
+
+// NewControl opens the control channel. Its reads fail with
+// syscall.EAGAIN once poll elapses without an event, for the reader to
+// check whether it is to stop.
+func NewControl(poll time.Duration) (*Control, error) {
+	fd, err := socket.Socket(socket.AF_BLUETOOTH, syscall.SOCK_RAW, socket.BTPROTO_HCI)
+	if err != nil {
+		return nil, err
+	}
+	tv := syscall.NsecToTimeval(poll.Nanoseconds())
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	sa := socket.SockaddrHCI{Dev: socket.HCI_DEV_NONE, Channel: socket.HCI_CHANNEL_CONTROL}
+	if err := socket.Bind(fd, &sa); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	return &Control{fd: fd}, nil
+}
+
+// Read reads the next event of the management interface into b.
+func (c *Control) Read(b []byte) (int, error) { return syscall.Read(c.fd, b) }
+
+func (c *Control) Close() error { return syscall.Close(c.fd) }
@@ -1,34 +1,117 @@
 package device
 
 import (
+	"fmt"
 	"io"
 	"os"
+	"sort"
 	"sync"
 	"syscall"
+	"unsafe"
 
 	"github.com/paypal/gatt/linux/internal/socket"
 )
 
 type device struct {
-	fd  int
-	rmu *sync.Mutex
-	wmu *sync.Mutex
+	fd   int
+	sock bool // an HCI socket, rather than a tty
+	rmu  *sync.Mutex
+	wmu  *sync.Mutex
 }
 
-func NewSocket(n int) (io.ReadWriteCloser, error) {
+// NewSocket binds the user channel of the HCI device of index n, taking
+// the device down first if down is set.
+func NewSocket(n int, down bool) (io.ReadWriteCloser, error) {
 	fd, err := socket.Socket(socket.AF_BLUETOOTH, syscall.SOCK_RAW, socket.BTPROTO_HCI)
+	if err != nil {
+		return nil, err
+	}
+	// The user channel gives exclusive access to the device: the kernel
+	// and bluetoothd no longer send it commands. It is refused while the
+	// device is up.
+	var derr error
+	if down {
+		derr = socket.DevDown(fd, n)
+	}
 	sa := socket.SockaddrHCI{Dev: n, Channel: socket.HCI_CHANNEL_USER}
 	if err = socket.Bind(fd, &sa); err != nil {
+		syscall.Close(fd)
+		if derr != nil {
+			return nil, fmt.Errorf("%w (taking hci%d down: %v)", err, n, derr)
+		}
 		return nil, err
 	}
 
 	return &device{
-		fd:  fd,
-		rmu: &sync.Mutex{},
-		wmu: &sync.Mutex{},
+		fd:   fd,
+		sock: true,
+		rmu:  &sync.Mutex{},
+		wmu:  &sync.Mutex{},
 	}, nil
 }
 
+// An Adapter is an HCI device of the kernel.
+type Adapter struct {
+	ID   int     // index, e.g. 0 for hci0
+	Addr [6]byte // public address, zero until the device has been up once
+	Up   bool
+}
+
+func (a Adapter) String() string {
+	state := "down"
+	if a.Up {
+		state = "up"
+	}
+	return fmt.Sprintf("hci%d (%02X:%02X:%02X:%02X:%02X:%02X, %s)", a.ID, a.Addr[0], a.Addr[1], a.Addr[2], a.Addr[3], a.Addr[4], a.Addr[5], state)
+}
+
+// List returns the HCI devices of the kernel, in the order of their
+// indexes.
+func List() ([]Adapter, error) {
+	fd, err := socket.Socket(socket.AF_BLUETOOTH, syscall.SOCK_RAW, socket.BTPROTO_HCI)
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.Close(fd)
+	ids, err := socket.DevList(fd)
+	if err != nil {
+		return nil, err
+	}
+	sort.Ints(ids)
+	as := make([]Adapter, 0, len(ids))
+	for _, id := range ids {
+		a, err := info(fd, id)
+		if err != nil {
+			continue // gone meanwhile
+		}
+		as = append(as, a)
+	}
+	return as, nil
+}
+
+// Get returns the HCI device of index id.
+func Get(id int) (Adapter, error) {
+	fd, err := socket.Socket(socket.AF_BLUETOOTH, syscall.SOCK_RAW, socket.BTPROTO_HCI)
+	if err != nil {
+		return Adapter{}, err
+	}
+	defer syscall.Close(fd)
+	return info(fd, id)
+}
+
+// info returns the HCI device of index id, through fd, an HCI socket.
+func info(fd, id int) (Adapter, error) {
+	addr, flags, err := socket.DevInfo(fd, id)
+	if err != nil {
+		return Adapter{}, err
+	}
+	a := Adapter{ID: id, Up: flags&socket.HCI_UP != 0}
+	for i := range addr {
+		a.Addr[i] = addr[5-i]
+	}
+	return a, nil
+}
+
 func NewDevice(path string) (io.ReadWriteCloser, error) {
 	fd, err := syscall.Open(path, os.O_RDWR, 700)
 	if err != nil {
@@ -53,6 +136,93 @@ func (d device) Write(b []byte) (int, error) {
 	return syscall.Write(d.fd, b)
 }
 
+// ReadBatch reads up to len(bs) packets at once, each into a buffer of its
+// own, and stores their lengths in ns. It returns the number of packets
+// read. On a tty, which carries a byte stream, it reads into bs[0] only.
+func (d device) ReadBatch(bs [][]byte, ns []int) (int, error) {
+	d.rmu.Lock()
+	defer d.rmu.Unlock()
+	if d.sock {
+		n, err := socket.Recvmmsg(d.fd, bs, ns)
+		if err != syscall.ENOSYS {
+			return n, err
+		}
+	}
+	n, err := syscall.Read(d.fd, bs[0])
+	if err != nil {
+		return 0, err
+	}
+	ns[0] = n
+	return 1, nil
+}
+
+// WriteBatch writes each of bs as a packet of its own, with as few system
+// calls as possible: sendmmsg on an HCI socket, which keeps the packet
+// boundaries, and writev on a tty. It returns the number of packets written.
+func (d device) WriteBatch(bs [][]byte) (int, error) {
+	d.wmu.Lock()
+	defer d.wmu.Unlock()
+	if !d.sock {
+		return d.writev(bs)
+	}
+	for sent := 0; sent < len(bs); {
+		n, err := socket.Sendmmsg(d.fd, bs[sent:])
+		if err == syscall.ENOSYS {
+			return d.writeEach(bs[sent:])
+		}
+		if err != nil {
+			return sent, err
+		}
+		sent += n
+	}
+	return len(bs), nil
+}
+
+func (d device) writev(bs [][]byte) (int, error) {
+	iov := make([]syscall.Iovec, 0, len(bs))
+	for _, b := range bs {
+		if len(b) == 0 {
+			continue
+		}
+		v := syscall.Iovec{Base: &b[0]}
+		v.SetLen(len(b))
+		iov = append(iov, v)
+	}
+	if len(iov) == 0 {
+		return len(bs), nil
+	}
+	r, _, e1 := syscall.Syscall(syscall.SYS_WRITEV, uintptr(d.fd), uintptr(unsafe.Pointer(&iov[0])), uintptr(len(iov)))
+	if e1 != 0 {
+		return 0, e1
+	}
+	// A tty may take only part of it; write the rest the slow way.
+	n := int(r)
+	for i, b := range bs {
+		if n >= len(b) {
+			n -= len(b)
+			continue
+		}
+		for b = b[n:]; len(b) > 0; {
+			w, err := syscall.Write(d.fd, b)
+			if err != nil {
+				return i, err
+			}
+			b = b[w:]
+		}
+		n = 0
+	}
+	return len(bs), nil
+}
+
+func (d device) writeEach(bs [][]byte) (int, error) {
+	for i, b := range bs {
+		if _, err := syscall.Write(d.fd, b); err != nil {
+			return i, err
+		}
+	}
+	return len(bs), nil
+}
+
 func (d device) Close() error {
 	return syscall.Close(d.fd)
 }
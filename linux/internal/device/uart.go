@@ -0,0 +1,35 @@
+package device
+
+import (
+	"io"
+	"os"
+	"sync"
+	"syscall"
+)
+
+// NewUART opens the tty at path, to which a controller is attached over
+// the HCI UART transport (H4), and sets it up raw, 8N1, at the baud rate,
+// with RTS/CTS flow control if flow. The packets it carries are a byte
+// stream, which the caller frames.
+func NewUART(path string, baud int, flow bool) (io.ReadWriteCloser, error) {
+	fd, err := syscall.Open(path, os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := setRaw(fd, baud, flow); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	return &device{
+		fd:  fd,
+		rmu: &sync.Mutex{},
+		wmu: &sync.Mutex{},
+	}, nil
+}
+
+func ioctl(fd int, req uintptr, arg uintptr) error {
+	if _, _, e1 := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), req, arg); e1 != 0 {
+		return e1
+	}
+	return nil
+}
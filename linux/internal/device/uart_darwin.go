@@ -0,0 +1,37 @@
+//go:build darwin
+// +build darwin
+
+package device
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+const (
+	cctsOflow = 0x10000
+	crtsIflow = 0x20000
+	fread     = 0x1
+	fwrite    = 0x2
+)
+
+// setRaw sets the tty of fd up raw, 8N1, at the baud rate, and discards
+// what it has buffered.
+func setRaw(fd int, baud int, flow bool) error {
+	var t syscall.Termios
+	if err := ioctl(fd, syscall.TIOCGETA, uintptr(unsafe.Pointer(&t))); err != nil {
+		return err
+	}
+	t.Iflag, t.Oflag, t.Lflag = 0, 0, 0
+	t.Cflag = syscall.CS8 | syscall.CREAD | syscall.CLOCAL
+	if flow {
+		t.Cflag |= cctsOflow | crtsIflow
+	}
+	t.Ispeed, t.Ospeed = uint64(baud), uint64(baud)
+	t.Cc[syscall.VMIN], t.Cc[syscall.VTIME] = 1, 0
+	if err := ioctl(fd, syscall.TIOCSETA, uintptr(unsafe.Pointer(&t))); err != nil {
+		return err
+	}
+	which := fread | fwrite
+	return ioctl(fd, syscall.TIOCFLUSH, uintptr(unsafe.Pointer(&which)))
+}
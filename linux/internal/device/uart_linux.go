@@ -0,0 +1,54 @@
+//go:build linux
+// +build linux
+
+package device
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	crtscts = 0x80000000
+	tcflsh  = 0x540B
+)
+
+var bauds = map[int]uint32{
+	9600:    syscall.B9600,
+	19200:   syscall.B19200,
+	38400:   syscall.B38400,
+	57600:   syscall.B57600,
+	115200:  syscall.B115200,
+	230400:  syscall.B230400,
+	460800:  syscall.B460800,
+	921600:  syscall.B921600,
+	1000000: syscall.B1000000,
+	1500000: syscall.B1500000,
+	2000000: syscall.B2000000,
+	3000000: syscall.B3000000,
+	4000000: syscall.B4000000,
+}
+
+// setRaw sets the tty of fd up raw, 8N1, at the baud rate, and discards
+// what it has buffered.
+func setRaw(fd int, baud int, flow bool) error {
+	speed, ok := bauds[baud]
+	if !ok {
+		return fmt.Errorf("device: unsupported baud rate %d", baud)
+	}
+	var t syscall.Termios
+	if err := ioctl(fd, syscall.TCGETS, uintptr(unsafe.Pointer(&t))); err != nil {
+		return err
+	}
+	t.Iflag, t.Oflag, t.Lflag = 0, 0, 0
+	t.Cflag = syscall.CS8 | syscall.CREAD | syscall.CLOCAL | speed
+	if flow {
+		t.Cflag |= crtscts
+	}
+	t.Cc[syscall.VMIN], t.Cc[syscall.VTIME] = 1, 0
+	if err := ioctl(fd, syscall.TCSETS, uintptr(unsafe.Pointer(&t))); err != nil {
+		return err
+	}
+	return ioctl(fd, tcflsh, syscall.TCIOFLUSH)
+}
@@ -3,9 +3,10 @@ package event
 import (
 	"bytes"
 	"encoding/binary"
-	"errors"
 	"fmt"
 	"log"
+
+	"github.com/paypal/gatt/linux/internal/hci"
 )
 
 type EventHandler interface {
@@ -41,7 +42,7 @@ func (e *Event) HandleEventDefault(h EventHandler) {
 }
 
 func (e *Event) Dispatch(b []byte) error {
-	h := &EventHeader{}
+	var h EventHeader
 	if err := h.Unmarshal(b); err != nil {
 		return err
 	}
@@ -142,6 +143,7 @@ const (
 	ConnectionlessSlaveBroadcastChannelMapChange           = 0x55
 	InquiryResponseNotification                            = 0x56
 	AuthenticatedPayloadTimeoutExpired                     = 0x57
+	VendorSpecific                                         = 0xFF
 )
 
 var eventName = map[EventCode]string{
@@ -219,6 +221,7 @@ var eventName = map[EventCode]string{
 	ConnectionlessSlaveBroadcastChannelMapChange: "Connectionless Slave Broadcast Channel Map Change",
 	InquiryResponseNotification:                  "Inquiry Response Notification",
 	AuthenticatedPayloadTimeoutExpired:           "Authenticated Payload Timeout Expired",
+	VendorSpecific:                               "Vendor Specific",
 }
 
 func (e EventCode) String() string { return eventName[e] }
@@ -226,21 +229,49 @@ func (e EventCode) String() string { return eventName[e] }
 type LEEventCode EventCode
 
 const (
-	LEConnectionComplete               LEEventCode = 0x01
-	LEAdvertisingReport                            = 0x02
-	LEConnectionUpdateComplete                     = 0x03
-	LEReadRemoteUsedFeaturesComplete               = 0x04
-	LELTKRequest                                   = 0x05
-	LERemoteConnectionParameterRequest             = 0x06
+	LEConnectionComplete                 LEEventCode = 0x01
+	LEAdvertisingReport                              = 0x02
+	LEConnectionUpdateComplete                       = 0x03
+	LEReadRemoteUsedFeaturesComplete                 = 0x04
+	LELTKRequest                                     = 0x05
+	LERemoteConnectionParameterRequest               = 0x06
+	LEDataLengthChange                               = 0x07
+	LEPHYUpdateComplete                              = 0x0C
+	LEPeriodicAdvertisingSyncEstablished             = 0x0E
+	LEPeriodicAdvertisingReport                      = 0x0F
+	LEPeriodicAdvertisingSyncLost                    = 0x10
+	LEChannelSelectionAlgorithm                      = 0x14
+	LECISEstablished                                 = 0x19
+	LECISRequest                                     = 0x1A
+	LECreateBIGComplete                              = 0x1B
+	LETerminateBIGComplete                           = 0x1C
+	LEBIGSyncEstablished                             = 0x1D
+	LEBIGSyncLost                                    = 0x1E
+	LEPathLossThreshold                              = 0x20
+	LETransmitPowerReporting                         = 0x21
 )
 
 var leEventName = map[LEEventCode]string{
-	LEConnectionComplete:               "LE Connection Complete",
-	LEAdvertisingReport:                "LE Advertising Report",
-	LEConnectionUpdateComplete:         "LE Connection Update Complete",
-	LEReadRemoteUsedFeaturesComplete:   "LE Read Remote Used Features Complete",
-	LELTKRequest:                       "LE LTK Request",
-	LERemoteConnectionParameterRequest: "LE Remote Connection Parameter Request",
+	LEConnectionComplete:                 "LE Connection Complete",
+	LEAdvertisingReport:                  "LE Advertising Report",
+	LEConnectionUpdateComplete:           "LE Connection Update Complete",
+	LEReadRemoteUsedFeaturesComplete:     "LE Read Remote Used Features Complete",
+	LELTKRequest:                         "LE LTK Request",
+	LERemoteConnectionParameterRequest:   "LE Remote Connection Parameter Request",
+	LEDataLengthChange:                   "LE Data Length Change",
+	LEPHYUpdateComplete:                  "LE PHY Update Complete",
+	LEPeriodicAdvertisingSyncEstablished: "LE Periodic Advertising Sync Established",
+	LEPeriodicAdvertisingReport:          "LE Periodic Advertising Report",
+	LEPeriodicAdvertisingSyncLost:        "LE Periodic Advertising Sync Lost",
+	LEChannelSelectionAlgorithm:          "LE Channel Selection Algorithm",
+	LECISEstablished:                     "LE CIS Established",
+	LECISRequest:                         "LE CIS Request",
+	LECreateBIGComplete:                  "LE Create BIG Complete",
+	LETerminateBIGComplete:               "LE Terminate BIG Complete",
+	LEBIGSyncEstablished:                 "LE BIG Sync Established",
+	LEBIGSyncLost:                        "LE BIG Sync Lost",
+	LEPathLossThreshold:                  "LE Path Loss Threshold",
+	LETransmitPowerReporting:             "LE Transmit Power Reporting",
 }
 
 func (e LEEventCode) String() string { return leEventName[e] }
@@ -252,12 +283,12 @@ type EventHeader struct {
 
 func (h *EventHeader) Unmarshal(b []byte) error {
 	if len(b) < 2 {
-		return errors.New("malformed header")
+		return fmt.Errorf("%w header", hci.ErrMalformed)
 	}
 	h.Code = EventCode(b[0])
 	h.Plen = b[1]
 	if uint8(len(b)) != 2+h.Plen {
-		return errors.New("wrong length")
+		return fmt.Errorf("%w header: wrong length", hci.ErrMalformed)
 	}
 	return nil
 }
@@ -272,14 +303,107 @@ type InquiryCompleteEP struct {
 	Status uint8
 }
 
+func (ep *InquiryCompleteEP) Unmarshal(b []byte) error {
+	return unmarshalFixed(b, ep, "Inquiry Complete")
+}
+
+// An InquiryResponse is a response of the Inquiry Result, Inquiry Result
+// with RSSI, and Extended Inquiry Result events.
+type InquiryResponse struct {
+	BDAddr                 [6]byte // most significant byte first
+	PageScanRepetitionMode uint8
+	ClassOfDevice          uint32 // 24 bits
+	ClockOffset            uint16
+	RSSI                   int8   // 127 if not reported
+	EIR                    []byte // extended inquiry response data, if any
+}
+
+// InquiryResultEP holds the responses of any of the Inquiry Result
+// events, each unmarshaled by its own method.
 type InquiryResultEP struct {
-	NumResponses           uint8
-	BDADDR                 [][6]byte
-	PageScanRepetitionMode []uint8
-	Reserved1              []byte
-	Reserved2              []byte
-	ClassOfDevice          [][3]byte
-	ClockOffset            []uint16
+	Responses []InquiryResponse
+}
+
+// Unmarshal unmarshals an Inquiry Result event, whose parameters are
+// arrays of NumResponses elements each.
+func (ep *InquiryResultEP) Unmarshal(b []byte) error {
+	return ep.unmarshal(b, false, "Inquiry Result")
+}
+
+// UnmarshalWithRSSI unmarshals an Inquiry Result with RSSI event.
+func (ep *InquiryResultEP) UnmarshalWithRSSI(b []byte) error {
+	return ep.unmarshal(b, true, "Inquiry Result with RSSI")
+}
+
+func (ep *InquiryResultEP) unmarshal(b []byte, rssi bool, name string) error {
+	if len(b) < 1 || len(b) != 1+14*int(b[0]) {
+		return fmt.Errorf("%w %s event", hci.ErrMalformed, name)
+	}
+	n := int(b[0])
+	b = b[1:]
+	// The arrays follow those of BD_ADDR, and Page_Scan_Repetition_Mode,
+	// the Reserved one being of a byte, rather than 2, with RSSI.
+	cod, clock := 9*n, 12*n
+	if rssi {
+		cod, clock = 8*n, 11*n
+	}
+	ep.Responses = make([]InquiryResponse, n)
+	for i := range ep.Responses {
+		r := &ep.Responses[i]
+		r.BDAddr = mac(b[6*i:])
+		r.PageScanRepetitionMode = b[6*n+i]
+		r.ClassOfDevice = uint24LE(b[cod+3*i:])
+		r.ClockOffset = uint16LE(b[clock+2*i:])
+		r.RSSI = 127
+		if rssi {
+			r.RSSI = int8(b[13*n+i])
+		}
+	}
+	return nil
+}
+
+// UnmarshalExtended unmarshals an Extended Inquiry Result event.
+func (ep *InquiryResultEP) UnmarshalExtended(b []byte) error {
+	if len(b) != 255 || b[0] != 1 {
+		return fmt.Errorf("%w Extended Inquiry Result event", hci.ErrMalformed)
+	}
+	ep.Responses = []InquiryResponse{{
+		BDAddr:                 mac(b[1:]),
+		PageScanRepetitionMode: b[7],
+		ClassOfDevice:          uint24LE(b[9:]),
+		ClockOffset:            uint16LE(b[12:]),
+		RSSI:                   int8(b[14]),
+		EIR:                    significant(b[15:]),
+	}}
+	return nil
+}
+
+// significant returns the significant part of the extended inquiry
+// response data b, up to the first AD structure of length 0.
+func significant(b []byte) []byte {
+	i := 0
+	for i < len(b) && b[i] != 0 && i+1+int(b[i]) <= len(b) {
+		i += 1 + int(b[i])
+	}
+	return b[:i]
+}
+
+type RemoteNameReqCompleteEP struct {
+	Status     uint8
+	BDAddr     [6]byte // most significant byte first
+	RemoteName string
+}
+
+func (ep *RemoteNameReqCompleteEP) Unmarshal(b []byte) error {
+	if len(b) != 255 {
+		return fmt.Errorf("%w Remote Name Request Complete event", hci.ErrMalformed)
+	}
+	name := b[7:]
+	if i := bytes.IndexByte(name, 0); i >= 0 {
+		name = name[:i]
+	}
+	*ep = RemoteNameReqCompleteEP{Status: b[0], BDAddr: mac(b[1:]), RemoteName: string(name)}
+	return nil
 }
 
 type ConnectionCompleteEP struct {
@@ -303,7 +427,33 @@ type DisconnectionCompleteEP struct {
 }
 
 func (ep *DisconnectionCompleteEP) Unmarshal(b []byte) error {
-	return binary.Read(bytes.NewBuffer(b), binary.LittleEndian, ep)
+	if len(b) != 4 {
+		return fmt.Errorf("%w Disconnection Complete event", hci.ErrMalformed)
+	}
+	*ep = DisconnectionCompleteEP{
+		Status:           b[0],
+		ConnectionHandle: uint16LE(b[1:]),
+		Reason:           b[3],
+	}
+	return nil
+}
+
+type EncryptionChangeEP struct {
+	Status            uint8
+	ConnectionHandle  uint16
+	EncryptionEnabled uint8
+}
+
+func (ep *EncryptionChangeEP) Unmarshal(b []byte) error {
+	if len(b) != 4 {
+		return fmt.Errorf("%w Encryption Change event", hci.ErrMalformed)
+	}
+	*ep = EncryptionChangeEP{
+		Status:            b[0],
+		ConnectionHandle:  uint16LE(b[1:]),
+		EncryptionEnabled: b[3],
+	}
+	return nil
 }
 
 type CommandCompleteEP struct {
@@ -312,15 +462,17 @@ type CommandCompleteEP struct {
 	ReturnParameters     []byte
 }
 
+// Unmarshal decodes the event in place; ReturnParameters shares the
+// memory of b.
 func (ep *CommandCompleteEP) Unmarshal(b []byte) error {
-	buf := bytes.NewBuffer(b)
-	if err := binary.Read(buf, binary.LittleEndian, &ep.NumHCICommandPackets); err != nil {
-		return err
+	if len(b) < 3 {
+		return fmt.Errorf("%w Command Complete event", hci.ErrMalformed)
 	}
-	if err := binary.Read(buf, binary.LittleEndian, &ep.CommandOPCode); err != nil {
-		return err
+	*ep = CommandCompleteEP{
+		NumHCICommandPackets: b[0],
+		CommandOPCode:        uint16LE(b[1:]),
+		ReturnParameters:     b[3:],
 	}
-	ep.ReturnParameters = buf.Bytes()
 	return nil
 }
 
@@ -331,7 +483,15 @@ type CommandStatusEP struct {
 }
 
 func (ep *CommandStatusEP) Unmarshal(b []byte) error {
-	return binary.Read(bytes.NewBuffer(b), binary.LittleEndian, ep)
+	if len(b) != 4 {
+		return fmt.Errorf("%w Command Status event", hci.ErrMalformed)
+	}
+	*ep = CommandStatusEP{
+		Status:               b[0],
+		NumHCICommandPackets: b[1],
+		CommandOpcode:        uint16LE(b[2:]),
+	}
+	return nil
 }
 
 type NumOfCompletedPkt struct {
@@ -345,15 +505,21 @@ type NumberOfCompletedPktsEP struct {
 }
 
 func (ep *NumberOfCompletedPktsEP) Unmarshal(b []byte) error {
+	if len(b) < 1 || len(b) != 1+4*int(b[0]) {
+		return fmt.Errorf("%w Number Of Completed Packets event", hci.ErrMalformed)
+	}
 	ep.NumberOfHandles = b[0]
 	n := int(ep.NumberOfHandles)
-	buf := bytes.NewBuffer(b[1:])
-	ep.Packets = make([]NumOfCompletedPkt, n)
-	for i := 0; i < n; i++ {
-		if err := binary.Read(buf, binary.LittleEndian, &ep.Packets[i]); err != nil {
-			return err
+	if cap(ep.Packets) < n {
+		ep.Packets = make([]NumOfCompletedPkt, n)
+	}
+	ep.Packets = ep.Packets[:n]
+	for i := range ep.Packets {
+		p := b[1+4*i:]
+		ep.Packets[i] = NumOfCompletedPkt{
+			ConnectionHandle:   uint16LE(p) & 0xfff,
+			NumOfCompletedPkts: uint16LE(p[2:]),
 		}
-		ep.Packets[i].ConnectionHandle &= 0xfff
 	}
 	return nil
 }
@@ -373,7 +539,22 @@ type LEConnectionCompleteEP struct {
 }
 
 func (ep *LEConnectionCompleteEP) Unmarshal(b []byte) error {
-	return binary.Read(bytes.NewBuffer(b), binary.LittleEndian, ep)
+	if len(b) != 19 {
+		return fmt.Errorf("%w LE Connection Complete event", hci.ErrMalformed)
+	}
+	*ep = LEConnectionCompleteEP{
+		SubeventCode:        b[0],
+		Status:              b[1],
+		ConnectionHandle:    uint16LE(b[2:]),
+		Role:                b[4],
+		PeerAddressType:     b[5],
+		ConnInterval:        uint16LE(b[12:]),
+		ConnLatency:         uint16LE(b[14:]),
+		SupervisionTimeout:  uint16LE(b[16:]),
+		MasterClockAccuracy: b[18],
+	}
+	copy(ep.PeerAddress[:], b[6:12])
+	return nil
 }
 
 type LEAdvertisingReportEP struct {
@@ -402,7 +583,18 @@ type LEConnectionUpdateCompleteEP struct {
 }
 
 func (ep *LEConnectionUpdateCompleteEP) Unmarshal(b []byte) error {
-	return binary.Read(bytes.NewBuffer(b), binary.LittleEndian, ep)
+	if len(b) != 10 {
+		return fmt.Errorf("%w LE Connection Update Complete event", hci.ErrMalformed)
+	}
+	*ep = LEConnectionUpdateCompleteEP{
+		SubeventCode:       b[0],
+		Status:             b[1],
+		ConnectionHandle:   uint16LE(b[2:]),
+		ConnInterval:       uint16LE(b[4:]),
+		ConnLatency:        uint16LE(b[6:]),
+		SupervisionTimeout: uint16LE(b[8:]),
+	}
+	return nil
 }
 
 type LEReadRemoteUsedFeaturesCompleteEP struct {
@@ -413,7 +605,7 @@ type LEReadRemoteUsedFeaturesCompleteEP struct {
 }
 
 func (ep *LEReadRemoteUsedFeaturesCompleteEP) Unmarshal(b []byte) error {
-	return binary.Read(bytes.NewBuffer(b), binary.LittleEndian, ep)
+	return unmarshalFixed(b, ep, "LE Read Remote Used Features Complete")
 }
 
 type LELTKRequestEP struct {
@@ -424,7 +616,7 @@ type LELTKRequestEP struct {
 }
 
 func (ep *LELTKRequestEP) Unmarshal(b []byte) error {
-	return binary.Read(bytes.NewBuffer(b), binary.LittleEndian, ep)
+	return unmarshalFixed(b, ep, "LE LTK Request")
 }
 
 type LERemoteConnectionParameterRequestEP struct {
@@ -437,5 +629,304 @@ type LERemoteConnectionParameterRequestEP struct {
 }
 
 func (ep *LERemoteConnectionParameterRequestEP) Unmarshal(b []byte) error {
-	return binary.Read(bytes.NewBuffer(b), binary.LittleEndian, ep)
+	return unmarshalFixed(b, ep, "LE Remote Connection Parameter Request")
+}
+
+type LEDataLengthChangeEP struct {
+	SubeventCode     uint8
+	ConnectionHandle uint16
+	MaxTxOctets      uint16
+	MaxTxTime        uint16
+	MaxRxOctets      uint16
+	MaxRxTime        uint16
+}
+
+func (ep *LEDataLengthChangeEP) Unmarshal(b []byte) error {
+	return unmarshalFixed(b, ep, "LE Data Length Change")
+}
+
+type LECISEstablishedEP struct {
+	SubeventCode         uint8
+	Status               uint8
+	ConnectionHandle     uint16
+	CIGSyncDelay         uint32 // 24 bits
+	CISSyncDelay         uint32 // 24 bits
+	TransportLatencyMToS uint32 // 24 bits
+	TransportLatencySToM uint32 // 24 bits
+	PHYMToS              uint8
+	PHYSToM              uint8
+	NSE                  uint8
+	BNMToS               uint8
+	BNSToM               uint8
+	FTMToS               uint8
+	FTSToM               uint8
+	MaxPDUMToS           uint16
+	MaxPDUSToM           uint16
+	ISOInterval          uint16
+}
+
+func (ep *LECISEstablishedEP) Unmarshal(b []byte) error {
+	if len(b) != 29 {
+		return fmt.Errorf("%w LE CIS Established event", hci.ErrMalformed)
+	}
+	*ep = LECISEstablishedEP{
+		SubeventCode:         b[0],
+		Status:               b[1],
+		ConnectionHandle:     uint16LE(b[2:]),
+		CIGSyncDelay:         uint24LE(b[4:]),
+		CISSyncDelay:         uint24LE(b[7:]),
+		TransportLatencyMToS: uint24LE(b[10:]),
+		TransportLatencySToM: uint24LE(b[13:]),
+		PHYMToS:              b[16],
+		PHYSToM:              b[17],
+		NSE:                  b[18],
+		BNMToS:               b[19],
+		BNSToM:               b[20],
+		FTMToS:               b[21],
+		FTSToM:               b[22],
+		MaxPDUMToS:           uint16LE(b[23:]),
+		MaxPDUSToM:           uint16LE(b[25:]),
+		ISOInterval:          uint16LE(b[27:]),
+	}
+	return nil
+}
+
+type LECISRequestEP struct {
+	SubeventCode        uint8
+	ACLConnectionHandle uint16
+	CISConnectionHandle uint16
+	CIGID               uint8
+	CISID               uint8
+}
+
+func (ep *LECISRequestEP) Unmarshal(b []byte) error {
+	return unmarshalFixed(b, ep, "LE CIS Request")
+}
+
+type LECreateBIGCompleteEP struct {
+	SubeventCode        uint8
+	Status              uint8
+	BIGHandle           uint8
+	BIGSyncDelay        uint32 // 24 bits
+	TransportLatencyBIG uint32 // 24 bits
+	PHY                 uint8
+	NSE                 uint8
+	BN                  uint8
+	PTO                 uint8
+	IRC                 uint8
+	MaxPDU              uint16
+	ISOInterval         uint16
+	ConnectionHandles   []uint16
+}
+
+func (ep *LECreateBIGCompleteEP) Unmarshal(b []byte) error {
+	if len(b) < 18 || len(b) != 18+2*int(b[17]) {
+		return fmt.Errorf("%w LE Create BIG Complete event", hci.ErrMalformed)
+	}
+	*ep = LECreateBIGCompleteEP{
+		SubeventCode:        b[0],
+		Status:              b[1],
+		BIGHandle:           b[2],
+		BIGSyncDelay:        uint24LE(b[3:]),
+		TransportLatencyBIG: uint24LE(b[6:]),
+		PHY:                 b[9],
+		NSE:                 b[10],
+		BN:                  b[11],
+		PTO:                 b[12],
+		IRC:                 b[13],
+		MaxPDU:              uint16LE(b[14:]),
+		ISOInterval:         uint16LE(b[16:]),
+		ConnectionHandles:   uint16sLE(b[18:], int(b[17])),
+	}
+	return nil
+}
+
+type LETerminateBIGCompleteEP struct {
+	SubeventCode uint8
+	BIGHandle    uint8
+	Reason       uint8
+}
+
+func (ep *LETerminateBIGCompleteEP) Unmarshal(b []byte) error {
+	return unmarshalFixed(b, ep, "LE Terminate BIG Complete")
+}
+
+type LEBIGSyncEstablishedEP struct {
+	SubeventCode        uint8
+	Status              uint8
+	BIGHandle           uint8
+	TransportLatencyBIG uint32 // 24 bits
+	NSE                 uint8
+	BN                  uint8
+	PTO                 uint8
+	IRC                 uint8
+	MaxPDU              uint16
+	ISOInterval         uint16
+	ConnectionHandles   []uint16
+}
+
+func (ep *LEBIGSyncEstablishedEP) Unmarshal(b []byte) error {
+	if len(b) < 15 || len(b) != 15+2*int(b[14]) {
+		return fmt.Errorf("%w LE BIG Sync Established event", hci.ErrMalformed)
+	}
+	*ep = LEBIGSyncEstablishedEP{
+		SubeventCode:        b[0],
+		Status:              b[1],
+		BIGHandle:           b[2],
+		TransportLatencyBIG: uint24LE(b[3:]),
+		NSE:                 b[6],
+		BN:                  b[7],
+		PTO:                 b[8],
+		IRC:                 b[9],
+		MaxPDU:              uint16LE(b[10:]),
+		ISOInterval:         uint16LE(b[12:]),
+		ConnectionHandles:   uint16sLE(b[15:], int(b[14])),
+	}
+	return nil
+}
+
+type LEBIGSyncLostEP struct {
+	SubeventCode uint8
+	BIGHandle    uint8
+	Reason       uint8
+}
+
+func (ep *LEBIGSyncLostEP) Unmarshal(b []byte) error {
+	return unmarshalFixed(b, ep, "LE BIG Sync Lost")
+}
+
+type LEPHYUpdateCompleteEP struct {
+	SubeventCode     uint8
+	Status           uint8
+	ConnectionHandle uint16
+	TxPHY            uint8
+	RxPHY            uint8
+}
+
+func (ep *LEPHYUpdateCompleteEP) Unmarshal(b []byte) error {
+	return unmarshalFixed(b, ep, "LE PHY Update Complete")
+}
+
+type LEPeriodicAdvertisingSyncEstablishedEP struct {
+	SubeventCode          uint8
+	Status                uint8
+	SyncHandle            uint16
+	AdvertisingSID        uint8
+	AdvertiserAddressType uint8
+	AdvertiserAddress     [6]byte
+	AdvertiserPHY         uint8
+	PeriodicAdvInterval   uint16
+	AdvertiserClockAcc    uint8
+}
+
+func (ep *LEPeriodicAdvertisingSyncEstablishedEP) Unmarshal(b []byte) error {
+	if len(b) != 16 {
+		return fmt.Errorf("%w LE Periodic Advertising Sync Established event", hci.ErrMalformed)
+	}
+	*ep = LEPeriodicAdvertisingSyncEstablishedEP{
+		SubeventCode:          b[0],
+		Status:                b[1],
+		SyncHandle:            uint16LE(b[2:]),
+		AdvertisingSID:        b[4],
+		AdvertiserAddressType: b[5],
+		AdvertiserAddress:     mac(b[6:]),
+		AdvertiserPHY:         b[12],
+		PeriodicAdvInterval:   uint16LE(b[13:]),
+		AdvertiserClockAcc:    b[15],
+	}
+	return nil
+}
+
+type LEPeriodicAdvertisingReportEP struct {
+	SubeventCode uint8
+	SyncHandle   uint16
+	TxPower      int8
+	RSSI         int8
+	CTEType      uint8
+	DataStatus   uint8
+	Data         []byte
+}
+
+func (ep *LEPeriodicAdvertisingReportEP) Unmarshal(b []byte) error {
+	if len(b) < 8 || len(b) != 8+int(b[7]) {
+		return fmt.Errorf("%w LE Periodic Advertising Report event", hci.ErrMalformed)
+	}
+	*ep = LEPeriodicAdvertisingReportEP{
+		SubeventCode: b[0],
+		SyncHandle:   uint16LE(b[1:]),
+		TxPower:      int8(b[3]),
+		RSSI:         int8(b[4]),
+		CTEType:      b[5],
+		DataStatus:   b[6],
+		Data:         b[8:],
+	}
+	return nil
+}
+
+type LEPeriodicAdvertisingSyncLostEP struct {
+	SubeventCode uint8
+	SyncHandle   uint16
+}
+
+func (ep *LEPeriodicAdvertisingSyncLostEP) Unmarshal(b []byte) error {
+	return unmarshalFixed(b, ep, "LE Periodic Advertising Sync Lost")
+}
+
+type LEChannelSelectionAlgorithmEP struct {
+	SubeventCode              uint8
+	ConnectionHandle          uint16
+	ChannelSelectionAlgorithm uint8
+}
+
+func (ep *LEChannelSelectionAlgorithmEP) Unmarshal(b []byte) error {
+	return unmarshalFixed(b, ep, "LE Channel Selection Algorithm")
+}
+
+type LEPathLossThresholdEP struct {
+	SubeventCode     uint8
+	ConnectionHandle uint16
+	CurrentPathLoss  uint8
+	ZoneEntered      uint8
+}
+
+func (ep *LEPathLossThresholdEP) Unmarshal(b []byte) error {
+	return unmarshalFixed(b, ep, "LE Path Loss Threshold")
+}
+
+type LETransmitPowerReportingEP struct {
+	SubeventCode     uint8
+	Status           uint8
+	ConnectionHandle uint16
+	Reason           uint8
+	PHY              uint8
+	TxPowerLevel     int8
+	TxPowerLevelFlag uint8
+	Delta            int8
+}
+
+func (ep *LETransmitPowerReportingEP) Unmarshal(b []byte) error {
+	return unmarshalFixed(b, ep, "LE Transmit Power Reporting")
+}
+
+// unmarshalFixed decodes the parameters b, of the event named name, into
+// ep, whose fields are all of a fixed size, as is the event.
+func unmarshalFixed(b []byte, ep interface{}, name string) error {
+	if len(b) != binary.Size(ep) {
+		return fmt.Errorf("%w %s event", hci.ErrMalformed, name)
+	}
+	return binary.Read(bytes.NewReader(b), binary.LittleEndian, ep)
+}
+
+func uint16LE(b []byte) uint16 { return uint16(b[0]) | uint16(b[1])<<8 }
+// mac returns the address of the 6 bytes of b, least significant first.
+func mac(b []byte) [6]byte { return [6]byte{b[5], b[4], b[3], b[2], b[1], b[0]} }
+
+func uint24LE(b []byte) uint32 { return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 }
+
+func uint16sLE(b []byte, n int) []uint16 {
+	v := make([]uint16, n)
+	for i := range v {
+		v[i] = uint16LE(b[2*i:])
+	}
+	return v
 }
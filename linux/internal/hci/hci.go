@@ -1,5 +1,21 @@
 package hci
 
+import "errors"
+
+var (
+	// ErrUnsupported is returned for packets, events and requests that
+	// are not supported, by gatt or by the controller.
+	ErrUnsupported = errors.New("not supported")
+
+	// ErrMalformed is returned for packets, events and return parameters
+	// that cannot be decoded.
+	ErrMalformed = errors.New("malformed")
+
+	// ErrClosed is returned for commands, and writes, that are pending,
+	// or issued, once the HCI is closed.
+	ErrClosed = errors.New("closed")
+)
+
 type PacketType uint8
 
 // HCI Packet types
@@ -8,5 +24,6 @@ const (
 	TypACLDataPkt            = 0X02
 	TypSCODataPkt            = 0X03
 	TypEventPkt              = 0X04
+	TypISODataPkt            = 0X05
 	TypVendorPkt             = 0XFF
 )
@@ -0,0 +1,73 @@
+package l2cap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/bits"
+	"sync/atomic"
+
+	"github.com/paypal/gatt/linux/internal/cmd"
+	"github.com/paypal/gatt/linux/internal/event"
+)
+
+// NumDataChannels is the number of the data channels of LE, numbered from
+// 0 to 36.
+const NumDataChannels = 37
+
+// A ChannelMap is the set of the data channels a connection hops over:
+// bit n is set if channel n is used.
+type ChannelMap uint64
+
+// Used reports whether the data channel ch is used.
+func (m ChannelMap) Used(ch int) bool { return ch >= 0 && ch < NumDataChannels && m&(1<<uint(ch)) != 0 }
+
+// Count returns the number of the data channels used.
+func (m ChannelMap) Count() int { return bits.OnesCount64(uint64(m) & (1<<NumDataChannels - 1)) }
+
+func (l *L2CAP) handleChannelSelection(b []byte) error {
+	ep := &event.LEChannelSelectionAlgorithmEP{}
+	if err := ep.Unmarshal(b); err != nil {
+		return err
+	}
+	c, found := l.connTable()[ep.ConnectionHandle]
+	if !found {
+		return nil
+	}
+	// 0x00 stands for algorithm #1, and 0x01 for #2.
+	atomic.StoreInt32(&c.csa, int32(ep.ChannelSelectionAlgorithm)+1)
+	return nil
+}
+
+// ChannelSelection returns the channel selection algorithm of the
+// connection: 1, or 2 for that of Bluetooth 5. Algorithm #1 is assumed
+// until the controller reports otherwise, as those prior to Bluetooth 5
+// never do.
+func (c *Conn) ChannelSelection() int {
+	if csa := atomic.LoadInt32(&c.csa); csa != 0 {
+		return int(csa)
+	}
+	return 1
+}
+
+// ChannelMap reads the current channel map of the connection from the
+// controller. It changes as the central classifies the channels, e.g.
+// to avoid the busy ones.
+func (c *Conn) ChannelMap() (ChannelMap, error) {
+	p := cmd.LEReadChannelMap{ConnectionHandle: c.handle}
+	b, err := c.l2c.cmd.Send(p)
+	if err != nil {
+		return 0, err
+	}
+	rp := cmd.LEReadChannelMapRP{}
+	if err := binary.Read(bytes.NewBuffer(b), binary.LittleEndian, &rp); err != nil {
+		return 0, err
+	}
+	if rp.Status != 0x00 {
+		return 0, cmd.ErrCommandFailed{Opcode: p.Opcode(), Status: rp.Status}
+	}
+	var m ChannelMap
+	for i, v := range rp.ChannelMap {
+		m |= ChannelMap(v) << (8 * uint(i))
+	}
+	return m, nil
+}
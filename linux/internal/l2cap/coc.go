@@ -0,0 +1,816 @@
+package l2cap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/paypal/gatt/linux/internal/hci"
+)
+
+// ChannelMTU is the largest SDU the LE credit based connections receive:
+// the least that IPSP allows.
+const ChannelMTU = 1280
+
+const (
+	channelMPS     = 247 // largest K-frame received, fitting a link-layer PDU of 251 bytes
+	channelCredits = 16  // K-frames the peer may send ahead of those read
+	channelBacklog = 8   // channels a listener holds, not accepted yet
+	cidDynamicMax  = 0x007F
+	minChannelMTU  = 23
+	maxChannelMPS  = 65533
+)
+
+// Results of the LE Credit Based Connection Response.
+const (
+	channelSuccess          = 0x0000
+	channelPSMUnsupported   = 0x0002
+	channelNoResources      = 0x0004
+	channelInvalidSourceCID = 0x0009
+	channelSourceCIDInUse   = 0x000A
+	channelUnacceptable     = 0x000B
+)
+
+var channelResults = map[uint16]string{
+	channelPSMUnsupported:   "LE_PSM not supported",
+	channelNoResources:      "no resources available",
+	0x0005:                  "insufficient authentication",
+	0x0006:                  "insufficient authorization",
+	0x0007:                  "insufficient encryption key size",
+	0x0008:                  "insufficient encryption",
+	channelInvalidSourceCID: "invalid Source CID",
+	channelSourceCIDInUse:   "Source CID already allocated",
+	channelUnacceptable:     "unacceptable parameters",
+}
+
+// ErrChannelRefused is returned by OpenChannel when the peer refuses the
+// channel, with the result of its response, e.g. 0x0002 if it serves no
+// channels of the PSM.
+type ErrChannelRefused struct {
+	Result uint16
+}
+
+func (e ErrChannelRefused) Error() string {
+	if s, ok := channelResults[e.Result]; ok {
+		return "l2cap: channel refused: " + s
+	}
+	return fmt.Sprintf("l2cap: channel refused: result 0x%04X", e.Result)
+}
+
+// validPSM reports whether psm is an LE PSM: those up to 0x007F are
+// assigned by the SIG, e.g. 0x0023 to IPSP, and the others dynamically.
+func validPSM(psm uint16) bool { return psm >= 0x0001 && psm <= 0x00FF }
+
+// A ChannelAddr is the address of an end of a Channel: its identifier on
+// the link of the handle, and its PSM.
+type ChannelAddr struct {
+	Handle uint16
+	PSM    uint16
+	CID    uint16
+}
+
+func (a ChannelAddr) Network() string { return "l2cap" }
+
+func (a ChannelAddr) String() string {
+	return fmt.Sprintf("handle 0x%04X psm 0x%04X cid 0x%04X", a.Handle, a.PSM, a.CID)
+}
+
+// channels is the state of the LE credit based connections of a link.
+type channels struct {
+	mu    sync.Mutex
+	chans map[uint16]*Channel // by local CID
+
+	// The K-frame, or SMP PDU, being reassembled, by the goroutine
+	// handing the ACL data of the link over; ch is nil for that of a
+	// channel unknown, dropped, and smp set for an SMP PDU.
+	rx struct {
+		active bool
+		smp    bool
+		ch     *Channel
+		tlen   int
+		got    int
+		pdu    []byte
+	}
+}
+
+// add allocates a local CID for ch, and returns false if none is left.
+func (cs *channels) add(ch *Channel) bool {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if cs.chans == nil {
+		cs.chans = make(map[uint16]*Channel)
+	}
+	for cid := uint16(cidDynamicMin); cid <= cidDynamicMax; cid++ {
+		if _, used := cs.chans[cid]; !used {
+			ch.lcid = cid
+			cs.chans[cid] = ch
+			return true
+		}
+	}
+	return false
+}
+
+func (cs *channels) remove(ch *Channel) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if cs.chans[ch.lcid] == ch {
+		delete(cs.chans, ch.lcid)
+	}
+}
+
+// local returns the channel of the local CID cid, if any.
+func (cs *channels) local(cid uint16) *Channel {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.chans[cid]
+}
+
+// pair returns the channel of the local CID lcid, and the CID rcid of the
+// peer, if any.
+func (cs *channels) pair(lcid, rcid uint16) *Channel {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if ch := cs.chans[lcid]; ch != nil && ch.rcid == rcid {
+		return ch
+	}
+	return nil
+}
+
+// remote returns the channel of the CID cid of the peer, if any.
+func (cs *channels) remote(cid uint16) *Channel {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	for _, ch := range cs.chans {
+		if ch.rcid == cid {
+			return ch
+		}
+	}
+	return nil
+}
+
+// A Channel is an LE credit based connection: a channel of its own over
+// the link of a Conn, opened with OpenChannel, or accepted from a
+// ChannelListener, for the protocols that do not run over ATT, e.g.
+// IPSP, or the Object Transfer Service. It is a net.Conn, which carries
+// SDUs: each Write sends its data as SDUs of at most MTU bytes, and Read
+// reads the next SDU received, the part b cannot hold being left for the
+// next Read. The peer is granted credits for the K-frames it sends as
+// the SDUs are read, so that a slow reader holds it back.
+type Channel struct {
+	conn       *Conn
+	psm        uint16
+	lcid, rcid uint16
+	mtu, mps   uint16 // of the peer: the largest SDU, and K-frame, it receives
+
+	mu        sync.Mutex
+	txCredits int
+	rxCredits int    // K-frames the peer may send
+	sdu       []byte // being reassembled
+	sduLen    int
+	frames    int           // of the SDU being reassembled
+	more      chan struct{} // signaled as credits are received
+	rxc       chan sdu
+
+	readmu  sync.Mutex
+	rest    []byte // of the SDU being read
+	restFrm int    // K-frames of the SDU being read, credited once read
+
+	writemu sync.Mutex
+
+	closeOnce sync.Once
+	closed    chan struct{}
+	err       error // of the reads and writes, set before closed is closed
+
+	rd, wd *deadline
+}
+
+// An sdu is one received, and the number of K-frames it took.
+type sdu struct {
+	b      []byte
+	frames int
+}
+
+func newChannel(c *Conn, psm uint16) *Channel {
+	return &Channel{
+		conn:      c,
+		psm:       psm,
+		rxCredits: channelCredits,
+		more:      make(chan struct{}, 1),
+		rxc:       make(chan sdu, channelCredits),
+		closed:    make(chan struct{}),
+		rd:        newDeadline(),
+		wd:        newDeadline(),
+	}
+}
+
+// OpenChannel opens an LE credit based connection to the PSM psm of the
+// peer, and returns once the peer accepts it, refuses it, with
+// ErrChannelRefused, or ctx is done. The peer is waited for up to the
+// RTX timer of 30 s.
+func (c *Conn) OpenChannel(ctx context.Context, psm uint16) (*Channel, error) {
+	if !validPSM(psm) {
+		return nil, fmt.Errorf("l2cap: invalid LE PSM 0x%04X", psm)
+	}
+	ch := newChannel(c, psm)
+	if !c.coc.add(ch) {
+		return nil, ErrChannelRefused{Result: channelNoResources}
+	}
+	id, rsp := c.sig.request()
+	defer c.sig.cancel(id)
+	if _, err := c.write(cidSignal, []byte{
+		sigLECreditConnReq, id, 0x0A, 0x00,
+		uint8(psm), uint8(psm >> 8),
+		uint8(ch.lcid), uint8(ch.lcid >> 8),
+		uint8(ChannelMTU & 0xFF), uint8(ChannelMTU >> 8),
+		uint8(channelMPS), 0x00,
+		uint8(channelCredits), 0x00,
+	}); err != nil {
+		c.coc.remove(ch)
+		return nil, err
+	}
+	t := time.NewTimer(sigRTX)
+	defer t.Stop()
+	var b []byte
+	select {
+	case b = <-rsp:
+	case <-ctx.Done():
+		c.coc.remove(ch)
+		return nil, ctx.Err()
+	case <-c.closed:
+		return nil, c.disconnected()
+	case <-t.C:
+		c.coc.remove(ch)
+		return nil, errors.New("l2cap: LE credit based connection request timed out")
+	}
+	if b[0] == sigCommandReject {
+		c.coc.remove(ch)
+		return nil, fmt.Errorf("l2cap: LE credit based connection: %w by the peer", hci.ErrUnsupported)
+	}
+	if len(b) != 11 {
+		c.coc.remove(ch)
+		return nil, fmt.Errorf("%w LE credit based connection response", hci.ErrMalformed)
+	}
+	if result := le16(b[9:]); result != channelSuccess {
+		c.coc.remove(ch)
+		return nil, ErrChannelRefused{Result: result}
+	}
+	c.coc.mu.Lock()
+	ch.rcid, ch.mtu, ch.mps = le16(b[1:]), le16(b[3:]), le16(b[5:])
+	c.coc.mu.Unlock()
+	ch.mu.Lock()
+	ch.txCredits = int(le16(b[7:]))
+	ch.mu.Unlock()
+	if ch.rcid < cidDynamicMin || ch.rcid > cidDynamicMax || ch.mtu < minChannelMTU || ch.mps < minChannelMTU || ch.mps > maxChannelMPS {
+		ch.disconnect(fmt.Errorf("%w LE credit based connection response", hci.ErrMalformed))
+		return nil, ch.err
+	}
+	return ch, nil
+}
+
+// A ChannelListener accepts the LE credit based connections the peers
+// of all the links open to its PSM.
+type ChannelListener struct {
+	l       *L2CAP
+	psm     uint16
+	slots   chan struct{} // held by the channels accepted, until Accept
+	acceptc chan *Channel
+	once    sync.Once
+	closed  chan struct{}
+}
+
+// ListenChannels listens to the PSM psm, from SIG assigned, e.g. 0x0023
+// for IPSP, or dynamic, from 0x0080 to 0x00FF. The channels opened by
+// the peers to the PSMs not listened to are refused. Up to 8 channels
+// are held, accepted, until Accept returns them; those opened beyond are
+// refused.
+func (l *L2CAP) ListenChannels(psm uint16) (*ChannelListener, error) {
+	if !validPSM(psm) {
+		return nil, fmt.Errorf("l2cap: invalid LE PSM 0x%04X", psm)
+	}
+	l.listenmu.Lock()
+	defer l.listenmu.Unlock()
+	if _, found := l.listeners[psm]; found {
+		return nil, fmt.Errorf("l2cap: LE PSM 0x%04X already listened to", psm)
+	}
+	ln := &ChannelListener{
+		l:       l,
+		psm:     psm,
+		slots:   make(chan struct{}, channelBacklog),
+		acceptc: make(chan *Channel, channelBacklog),
+		closed:  make(chan struct{}),
+	}
+	if l.listeners == nil {
+		l.listeners = make(map[uint16]*ChannelListener)
+	}
+	l.listeners[psm] = ln
+	return ln, nil
+}
+
+// Accept returns the next channel opened to the PSM of ln. It fails with
+// net.ErrClosed once ln is closed.
+func (ln *ChannelListener) Accept() (*Channel, error) {
+	select {
+	case ch := <-ln.acceptc:
+		<-ln.slots
+		return ch, nil
+	case <-ln.closed:
+		return nil, net.ErrClosed
+	case <-ln.l.quit:
+		return nil, fmt.Errorf("l2cap: accept: %w", hci.ErrClosed)
+	}
+}
+
+// Close stops listening, and closes the channels accepted, not returned
+// by Accept yet.
+func (ln *ChannelListener) Close() error {
+	ln.once.Do(func() {
+		ln.l.listenmu.Lock()
+		delete(ln.l.listeners, ln.psm)
+		ln.l.listenmu.Unlock()
+		close(ln.closed)
+		ln.drain()
+	})
+	return nil
+}
+
+// drain closes the channels accepted, left to ln closed.
+func (ln *ChannelListener) drain() {
+	for {
+		select {
+		case ch := <-ln.acceptc:
+			<-ln.slots
+			go ch.Close()
+		default:
+			return
+		}
+	}
+}
+
+// Addr returns the address listened to, that of its PSM.
+func (ln *ChannelListener) Addr() net.Addr { return ChannelAddr{PSM: ln.psm} }
+
+func (l *L2CAP) listener(psm uint16) *ChannelListener {
+	l.listenmu.Lock()
+	defer l.listenmu.Unlock()
+	return l.listeners[psm]
+}
+
+// handleChannelRequest answers an LE Credit Based Connection Request of
+// the peer of c, accepting it if its PSM is listened to.
+func (l *L2CAP) handleChannelRequest(c *Conn, id uint8, data []byte) error {
+	if len(data) != 10 {
+		return c.rejectSignal(id)
+	}
+	psm, scid := le16(data), le16(data[2:])
+	mtu, mps, credits := le16(data[4:]), le16(data[6:]), le16(data[8:])
+	ln := l.listener(psm)
+	result := uint16(channelSuccess)
+	switch {
+	case ln == nil:
+		result = channelPSMUnsupported
+	case scid < cidDynamicMin || scid > cidDynamicMax:
+		result = channelInvalidSourceCID
+	case c.coc.remote(scid) != nil:
+		result = channelSourceCIDInUse
+	case mtu < minChannelMTU || mps < minChannelMTU || mps > maxChannelMPS:
+		result = channelUnacceptable
+	}
+	var ch *Channel
+	if result == channelSuccess {
+		select {
+		case ln.slots <- struct{}{}:
+			ch = newChannel(c, psm)
+			ch.rcid, ch.mtu, ch.mps, ch.txCredits = scid, mtu, mps, int(credits)
+			if !c.coc.add(ch) {
+				<-ln.slots
+				ch, result = nil, channelNoResources
+			}
+		default:
+			result = channelNoResources
+		}
+	}
+	var dcid uint16
+	if ch != nil {
+		dcid = ch.lcid
+	}
+	if _, err := c.write(cidSignal, []byte{
+		sigLECreditConnRsp, id, 0x0A, 0x00,
+		uint8(dcid), uint8(dcid >> 8),
+		uint8(ChannelMTU & 0xFF), uint8(ChannelMTU >> 8),
+		uint8(channelMPS), 0x00,
+		uint8(channelCredits), 0x00,
+		uint8(result), uint8(result >> 8),
+	}); err != nil || ch == nil {
+		if ch != nil {
+			c.coc.remove(ch)
+			<-ln.slots
+		}
+		return err
+	}
+	ln.acceptc <- ch
+	select {
+	case <-ln.closed: // meanwhile
+		ln.drain()
+	default:
+	}
+	return nil
+}
+
+// handleCredits adds the credits of an LE Flow Control Credit of the
+// peer to its channel.
+func (c *Conn) handleCredits(id uint8, data []byte) error {
+	if len(data) != 4 {
+		return c.rejectSignal(id)
+	}
+	ch := c.coc.remote(le16(data))
+	if ch == nil {
+		return nil
+	}
+	ch.mu.Lock()
+	ch.txCredits += int(le16(data[2:]))
+	overflow := ch.txCredits > 0xFFFF
+	ch.mu.Unlock()
+	if overflow {
+		ch.disconnect(fmt.Errorf("%w LE flow control credit: credits above 65535", hci.ErrMalformed))
+		return nil
+	}
+	select {
+	case ch.more <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// handleChannelDisconnect answers a Disconnection Request of the peer,
+// which closes its channel.
+func (c *Conn) handleChannelDisconnect(id uint8, data []byte) error {
+	if len(data) != 4 {
+		return c.rejectSignal(id)
+	}
+	ch := c.coc.pair(le16(data), le16(data[2:]))
+	if ch == nil {
+		// Invalid CID in request
+		_, err := c.write(cidSignal, append([]byte{sigCommandReject, id, 0x06, 0x00, 0x02, 0x00}, data...))
+		return err
+	}
+	c.coc.remove(ch)
+	ch.shutdown(io.EOF)
+	_, err := c.write(cidSignal, append([]byte{sigDisconnRsp, id, 0x04, 0x00}, data...))
+	return err
+}
+
+// handleDynamic hands the fragment a of ACL data over to the channel it
+// is of, and reports whether it was of a dynamic channel, or the fixed
+// one of the Security Manager Protocol. The fragments are reassembled
+// into K-frames, and SMP PDUs, those of channels unknown being dropped.
+func (c *Conn) handleDynamic(a aclData) bool {
+	rx := &c.coc.rx
+	frag := a.b
+	if a.flags&0x1 == 0 {
+		rx.active = false
+		if len(a.b) < 4 {
+			return false
+		}
+		cid := le16(a.b[2:])
+		if cid != cidSMP && cid < cidDynamicMin {
+			return false
+		}
+		rx.active, rx.smp = true, cid == cidSMP
+		if !rx.smp {
+			rx.ch = c.coc.local(cid)
+		}
+		rx.tlen, rx.got, rx.pdu = int(le16(a.b)), 0, nil
+		frag = a.b[4:]
+	} else if !rx.active {
+		return false
+	}
+	if rx.got+len(frag) > rx.tlen {
+		rx.active, rx.ch, rx.smp = false, nil, false
+		c.malformed()
+		return true
+	}
+	switch {
+	case rx.ch != nil && rx.got == 0 && len(frag) == rx.tlen:
+		rx.ch.receive(frag) // not fragmented: copied into the SDU right away
+	case rx.ch != nil || rx.smp:
+		rx.pdu = append(rx.pdu, frag...)
+	}
+	if rx.got += len(frag); rx.got == rx.tlen {
+		switch {
+		case rx.smp:
+			c.handleSMP(rx.pdu)
+		case rx.ch != nil && rx.pdu != nil:
+			rx.ch.receive(rx.pdu)
+		}
+		rx.active, rx.ch, rx.smp, rx.pdu = false, nil, false, nil
+	}
+	return true
+}
+
+// receive reassembles the K-frame b into the SDU it is part of, and
+// queues the SDU once complete. The channel is disconnected if the peer
+// breaks its limits.
+func (ch *Channel) receive(b []byte) {
+	ch.mu.Lock()
+	var err error
+	switch {
+	case ch.rxCredits == 0:
+		err = fmt.Errorf("%w K-frame: sent without credits", hci.ErrMalformed)
+	case len(b) > channelMPS:
+		err = fmt.Errorf("%w K-frame: %d bytes, above the MPS", hci.ErrMalformed, len(b))
+	case ch.sdu == nil && len(b) < 2:
+		err = fmt.Errorf("%w K-frame: no SDU length", hci.ErrMalformed)
+	}
+	if err == nil {
+		ch.rxCredits--
+		if ch.sdu == nil {
+			ch.sdu, ch.sduLen, ch.frames = make([]byte, 0, le16(b)), int(le16(b)), 0
+			b = b[2:]
+		}
+		if ch.sduLen > ChannelMTU || len(ch.sdu)+len(b) > ch.sduLen {
+			err = fmt.Errorf("%w K-frame: SDU of %d bytes", hci.ErrMalformed, ch.sduLen)
+		}
+	}
+	if err != nil {
+		ch.mu.Unlock()
+		ch.conn.malformed()
+		ch.disconnect(err)
+		return
+	}
+	ch.sdu = append(ch.sdu, b...)
+	ch.frames++
+	if len(ch.sdu) < ch.sduLen {
+		ch.mu.Unlock()
+		return
+	}
+	s := sdu{b: ch.sdu, frames: ch.frames}
+	ch.sdu = nil
+	ch.mu.Unlock()
+	// Never full: each SDU queued holds at least one of the credits.
+	ch.rxc <- s
+}
+
+// Read reads the next SDU received, or the rest of that being read. It
+// returns io.EOF once the peer has closed the channel, and the SDUs it
+// sent before are read.
+func (ch *Channel) Read(b []byte) (int, error) {
+	ch.readmu.Lock()
+	defer ch.readmu.Unlock()
+	if ch.rest == nil {
+		var s sdu
+		select {
+		case s = <-ch.rxc:
+		case <-ch.closed:
+			select {
+			case s = <-ch.rxc:
+			default:
+				return 0, ch.err
+			}
+		case <-ch.conn.closed:
+			return 0, ch.conn.disconnected()
+		case <-ch.rd.wait():
+			return 0, os.ErrDeadlineExceeded
+		}
+		ch.rest, ch.restFrm = s.b, s.frames
+	}
+	n := copy(b, ch.rest)
+	if ch.rest = ch.rest[n:]; len(ch.rest) == 0 {
+		ch.rest = nil
+		ch.credit(ch.restFrm)
+	}
+	return n, nil
+}
+
+// credit grants the peer n credits, for the K-frames read.
+func (ch *Channel) credit(n int) {
+	select {
+	case <-ch.closed:
+		return
+	default:
+	}
+	ch.mu.Lock()
+	ch.rxCredits += n
+	ch.mu.Unlock()
+	c := ch.conn
+	c.sig.mu.Lock()
+	id := c.sig.nextID()
+	c.sig.mu.Unlock()
+	c.write(cidSignal, []byte{
+		sigFlowControlCredit, id, 0x04, 0x00,
+		uint8(ch.lcid), uint8(ch.lcid >> 8),
+		uint8(n), uint8(n >> 8),
+	})
+}
+
+// Write writes b as SDUs of at most MTU bytes, each segmented into
+// K-frames of at most the MPS of the peer, sent as the peer grants
+// credits for them.
+func (ch *Channel) Write(b []byte) (int, error) {
+	ch.writemu.Lock()
+	defer ch.writemu.Unlock()
+	n := 0
+	for len(b) > 0 {
+		s := b
+		if len(s) > int(ch.mtu) {
+			s = s[:ch.mtu]
+		}
+		// The first K-frame of an SDU carries its length.
+		f := append([]byte{uint8(len(s)), uint8(len(s) >> 8)}, s...)
+		for len(f) > 0 {
+			k := f
+			if len(k) > int(ch.mps) {
+				k = k[:ch.mps]
+			}
+			if err := ch.take(); err != nil {
+				return n, err
+			}
+			if _, err := ch.conn.write(int(ch.rcid), k); err != nil {
+				return n, err
+			}
+			f = f[len(k):]
+		}
+		n += len(s)
+		b = b[len(s):]
+	}
+	return n, nil
+}
+
+// take takes a credit to send a K-frame, waiting for the peer to grant
+// one if none is left.
+func (ch *Channel) take() error {
+	for {
+		select {
+		case <-ch.closed:
+			return ch.err
+		default:
+		}
+		ch.mu.Lock()
+		if ch.txCredits > 0 {
+			ch.txCredits--
+			ch.mu.Unlock()
+			return nil
+		}
+		ch.mu.Unlock()
+		select {
+		case <-ch.more:
+		case <-ch.closed:
+			return ch.err
+		case <-ch.conn.closed:
+			return ch.conn.disconnected()
+		case <-ch.wd.wait():
+			return os.ErrDeadlineExceeded
+		}
+	}
+}
+
+// shutdown fails the reads, and writes, of ch with err, and reports
+// whether ch was not shut down already.
+func (ch *Channel) shutdown(err error) bool {
+	first := false
+	ch.closeOnce.Do(func() {
+		ch.err = err
+		close(ch.closed)
+		first = true
+	})
+	return first
+}
+
+// disconnect shuts ch down with err, and requests the peer to disconnect
+// it, without waiting for the response: it is called by the goroutine
+// handling the signaling commands.
+func (ch *Channel) disconnect(err error) {
+	if !ch.shutdown(err) {
+		return
+	}
+	c := ch.conn
+	c.coc.remove(ch)
+	c.sig.mu.Lock()
+	id := c.sig.nextID()
+	c.sig.mu.Unlock()
+	c.write(cidSignal, ch.disconnReq(id))
+}
+
+func (ch *Channel) disconnReq(id uint8) []byte {
+	ch.conn.coc.mu.Lock()
+	defer ch.conn.coc.mu.Unlock()
+	return []byte{
+		sigDisconnReq, id, 0x04, 0x00,
+		uint8(ch.rcid), uint8(ch.rcid >> 8),
+		uint8(ch.lcid), uint8(ch.lcid >> 8),
+	}
+}
+
+// Close disconnects the channel, and waits for the peer to respond, up to
+// the RTX timer of 30 s. The link is left connected.
+func (ch *Channel) Close() error {
+	if !ch.shutdown(net.ErrClosed) {
+		return nil
+	}
+	c := ch.conn
+	c.coc.remove(ch)
+	id, rsp := c.sig.request()
+	defer c.sig.cancel(id)
+	if _, err := c.write(cidSignal, ch.disconnReq(id)); err != nil {
+		return err
+	}
+	t := time.NewTimer(sigRTX)
+	defer t.Stop()
+	select {
+	case <-rsp:
+		return nil
+	case <-c.closed:
+		return nil
+	case <-t.C:
+		return errors.New("l2cap: disconnection request timed out")
+	}
+}
+
+// Conn returns the connection ch is a channel of.
+func (ch *Channel) Conn() *Conn { return ch.conn }
+
+// PSM returns the PSM of the channel.
+func (ch *Channel) PSM() uint16 { return ch.psm }
+
+// MTU returns the largest SDU the peer receives: larger writes are sent
+// as several SDUs.
+func (ch *Channel) MTU() int { return int(ch.mtu) }
+
+// LocalAddr returns the address of the local end of the channel.
+func (ch *Channel) LocalAddr() net.Addr {
+	return ChannelAddr{Handle: ch.conn.handle, PSM: ch.psm, CID: ch.lcid}
+}
+
+// RemoteAddr returns the address of the end of the peer.
+func (ch *Channel) RemoteAddr() net.Addr {
+	return ChannelAddr{Handle: ch.conn.handle, PSM: ch.psm, CID: ch.rcid}
+}
+
+// SetDeadline sets the deadlines of both the reads and the writes.
+func (ch *Channel) SetDeadline(t time.Time) error {
+	ch.rd.set(t)
+	ch.wd.set(t)
+	return nil
+}
+
+// SetReadDeadline sets the time the reads fail after, with
+// os.ErrDeadlineExceeded, or none if t is zero.
+func (ch *Channel) SetReadDeadline(t time.Time) error {
+	ch.rd.set(t)
+	return nil
+}
+
+// SetWriteDeadline sets the time the writes waiting for credits fail
+// after, with os.ErrDeadlineExceeded, or none if t is zero.
+func (ch *Channel) SetWriteDeadline(t time.Time) error {
+	ch.wd.set(t)
+	return nil
+}
+
+// A deadline is that of the reads, or of the writes, of a Channel: c is
+// closed once it passes.
+type deadline struct {
+	mu sync.Mutex
+	t  *time.Timer
+	c  chan struct{}
+}
+
+func newDeadline() *deadline { return &deadline{c: make(chan struct{})} }
+
+func (d *deadline) set(t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.t != nil && !d.t.Stop() {
+		<-d.c // closed by the timer meanwhile
+	}
+	d.t = nil
+	passed := false
+	select {
+	case <-d.c:
+		passed = true
+	default:
+	}
+	if passed && (t.IsZero() || time.Until(t) > 0) {
+		d.c = make(chan struct{})
+	}
+	switch {
+	case t.IsZero():
+	case time.Until(t) > 0:
+		c := d.c
+		d.t = time.AfterFunc(time.Until(t), func() { close(c) })
+	case !passed:
+		close(d.c)
+	}
+}
+
+func (d *deadline) wait() <-chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.c
+}
+
+func le16(b []byte) uint16 { return uint16(b[0]) | uint16(b[1])<<8 }
@@ -0,0 +1,66 @@
+package l2cap
+
+import (
+	"sync/atomic"
+
+	"github.com/paypal/gatt/linux/internal/cmd"
+	"github.com/paypal/gatt/linux/internal/event"
+)
+
+// minDataLength is the payload of the link-layer data PDUs of a
+// connection until the LE Data Packet Length Extension is negotiated.
+const minDataLength = 27
+
+// SetDataLength sets the payload, in bytes, and the time, in µs, of the
+// link-layer data PDUs the connections are set to send, as they are
+// established, and the ACL data packets fragmented to, up to the largest
+// the controller takes, size. A payload of 27 bytes, that of the
+// controllers prior to Bluetooth 4.2, sets none. It must be called before
+// any connection is established.
+func (l *L2CAP) SetDataLength(octets, time uint16, size int) {
+	l.dataOctets, l.dataTime = octets, time
+	if size > minDataLength {
+		l.bufSize = size
+	}
+}
+
+func (l *L2CAP) handleDataLengthChange(b []byte) error {
+	ep := &event.LEDataLengthChangeEP{}
+	if err := ep.Unmarshal(b); err != nil {
+		return err
+	}
+	c, found := l.connTable()[ep.ConnectionHandle]
+	if !found {
+		return nil
+	}
+	l.trace("l2conn: 0x%04X: data length %d/%d bytes", c.handle, ep.MaxTxOctets, ep.MaxRxOctets)
+	atomic.StoreUint32(&c.dlen, uint32(ep.MaxTxOctets)<<16|uint32(ep.MaxRxOctets))
+	return nil
+}
+
+// negotiateDataLength sets the connection to send the link-layer data
+// PDUs set by SetDataLength.
+func (c *Conn) negotiateDataLength() {
+	l := c.l2c
+	if err := c.SetDataLength(l.dataOctets, l.dataTime); err != nil {
+		l.trace("l2conn: 0x%04X: failed to set the data length, %s", c.handle, err)
+	}
+}
+
+// SetDataLength requests the connection to send link-layer data PDUs
+// with a payload of up to octets bytes, from 27 to 251, lasting up to
+// time µs. The peer takes part in the negotiation; the outcome, if any
+// change, is reported by DataLength once the controller reports it.
+func (c *Conn) SetDataLength(octets, time uint16) error {
+	return c.l2c.cmd.SendAndCheckResp(cmd.LESetDataLength{ConnectionHandle: c.handle, TxOctets: octets, TxTime: time}, []byte{0x00})
+}
+
+// DataLength returns the largest payloads of the link-layer data PDUs
+// the connection sends, and receives, in bytes: 27 until the controller
+// reports larger ones negotiated.
+func (c *Conn) DataLength() (tx, rx int) {
+	if d := atomic.LoadUint32(&c.dlen); d != 0 {
+		return int(d >> 16), int(d & 0xFFFF)
+	}
+	return minDataLength, minDataLength
+}
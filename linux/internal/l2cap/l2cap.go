@@ -1,13 +1,19 @@
 package l2cap
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"runtime/pprof"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/paypal/gatt/linux/internal/cmd"
 	"github.com/paypal/gatt/linux/internal/event"
+	"github.com/paypal/gatt/linux/internal/hci"
 )
 
 type l2adv interface {
@@ -15,8 +21,23 @@ type l2adv interface {
 	Stop() error
 	Serving() bool
 	SetServing(bool)
+	Resume() error
 }
 
+// Roles of the local device in a connection.
+const (
+	roleMaster = 0x00
+	roleSlave  = 0x01
+)
+
+// reasonLocalHost is the reason, "connection terminated by local host",
+// of the connections dropped by Close.
+const reasonLocalHost = 0x16
+
+// reasonTimeout is the reason, "connection timeout", of the connections
+// lost to the supervision timeout.
+const reasonTimeout = 0x08
+
 type L2CAP struct {
 	dev     io.ReadWriter
 	cmd     *cmd.Cmd
@@ -28,13 +49,57 @@ type L2CAP struct {
 	bufSize int
 	Adv     l2adv
 
+	// Link-layer data PDUs negotiated for the connections; see
+	// SetDataLength.
+	dataOctets uint16
+	dataTime   uint16
+
+	// ManageParams is set when the parameters of the connections are
+	// managed by the user, with UpdateParams; a connection accepted with
+	// a latency, or an interval above 30 ms, is then left as it is,
+	// rather than requested to be updated to an interval of 10 to 30 ms.
+	ManageParams bool
+
+	// Release, if set, is handed the buffers of the ACL data given to
+	// HandleACL once done with them, for them to be reused.
+	Release func(buf *[]byte)
+
+	// conns holds a map[uint16]*Conn, which is never modified once stored.
+	// Connecting and disconnecting, serialized by connsmu, store a
+	// modified copy instead, so that looking up the connection of each
+	// ACL packet takes no lock.
 	connsmu  *sync.Mutex
 	connsSeq int
-	conns    map[uint16]*Conn
+	conns    atomic.Value
+
+	listenmu  *sync.Mutex
+	listeners map[uint16]*ChannelListener // by LE PSM
+
+	sendc chan []byte
+	stats *stats // of all the connections
+	errmu *sync.Mutex
+	err   error // sticky error of the send queue
+
+	stopping  int32 // set by Shutdown; advertising is not restarted
+	refusing  int32 // set by Refuse; connections are disconnected
+	queued    int64 // packets queued, and not written yet
+	closeOnce *sync.Once
+	quit      chan struct{} // closed by Close
+	sendDone  chan struct{} // closed once sendLoop has returned
+}
+
+// maxBatch is the maximum number of packets written by one drain cycle of
+// the send queue.
+const maxBatch = 16
+
+// A batchWriter writes several packets at once, each being kept as a
+// packet of its own.
+type batchWriter interface {
+	WriteBatch(bs [][]byte) (int, error)
 }
 
 func NewL2CAP(cmd *cmd.Cmd, d io.ReadWriter, l *log.Logger, maxConn int) *L2CAP {
-	return &L2CAP{
+	l2c := &L2CAP{
 		cmd:     cmd,
 		dev:     d,
 		logger:  l,
@@ -47,26 +112,127 @@ func NewL2CAP(cmd *cmd.Cmd, d io.ReadWriter, l *log.Logger, maxConn int) *L2CAP
 
 		connsmu:  &sync.Mutex{},
 		connsSeq: 0,
-		conns:    map[uint16]*Conn{},
+
+		listenmu: &sync.Mutex{},
+
+		sendc: make(chan []byte, maxBatch),
+		stats: newStats(),
+		errmu: &sync.Mutex{},
+
+		closeOnce: &sync.Once{},
+		quit:      make(chan struct{}),
+		sendDone:  make(chan struct{}),
+	}
+	l2c.conns.Store(map[uint16]*Conn{})
+	go l2c.sendLoop()
+	return l2c
+}
+
+// connTable returns the current connection table. It must not be modified.
+func (l *L2CAP) connTable() map[uint16]*Conn {
+	return l.conns.Load().(map[uint16]*Conn)
+}
+
+// updateConn stores a copy of the connection table, with c as the
+// connection of handle h, or without h if c is nil. It returns the number
+// of connections. The caller must hold connsmu.
+func (l *L2CAP) updateConn(h uint16, c *Conn) int {
+	old := l.connTable()
+	m := make(map[uint16]*Conn, len(old)+1)
+	for k, v := range old {
+		m[k] = v
+	}
+	if c != nil {
+		m[h] = c
+	} else {
+		delete(m, h)
+	}
+	l.conns.Store(m)
+	return len(m)
+}
+
+// sendLoop drains the send queue. Whatever has been queued by the time it
+// wakes up, up to maxBatch packets, is handed to the device at once.
+// Once the L2CAP is closed, it writes what is left in the queue, and
+// returns.
+func (l *L2CAP) sendLoop() {
+	pprof.SetGoroutineLabels(pprof.WithLabels(context.Background(), pprof.Labels("gatt", "l2cap-send")))
+	defer close(l.sendDone)
+	bw, _ := l.dev.(batchWriter)
+	batch := make([][]byte, 0, maxBatch)
+	for {
+		select {
+		case b := <-l.sendc:
+			batch = append(batch[:0], b)
+		case <-l.quit:
+			batch = batch[:0]
+		}
+	drain:
+		for len(batch) < maxBatch {
+			select {
+			case b := <-l.sendc:
+				batch = append(batch, b)
+			default:
+				break drain
+			}
+		}
+		if len(batch) == 0 {
+			return
+		}
+		l.writeBatch(bw, batch)
+		atomic.AddInt64(&l.queued, -int64(len(batch)))
 	}
 }
 
+// writeBatch writes a batch of packets to the device, with bw if it is
+// not nil. A failure is recorded as the sticky error of the send queue.
+func (l *L2CAP) writeBatch(bw batchWriter, batch [][]byte) {
+	var err error
+	if bw != nil {
+		_, err = bw.WriteBatch(batch)
+	} else {
+		for _, b := range batch {
+			if _, err = l.dev.Write(b); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		l.trace("l2cap: failed to write, %s", err)
+		l.errmu.Lock()
+		l.err = err
+		l.errmu.Unlock()
+	}
+}
+
+// sendErr returns the error the send queue has failed with, if any.
+// Once it has failed, every later write fails as well.
+func (l *L2CAP) sendErr() error {
+	l.errmu.Lock()
+	defer l.errmu.Unlock()
+	return l.err
+}
+
+// aclData is the header of an ACL data packet, decoded in place. Its
+// payload, b, shares the memory of the packet it was unmarshalled from.
 type aclData struct {
 	handle uint16
 	flags  uint8
 	dlen   uint16
 	b      []byte
+	buf    *[]byte   // b is held in, to release once done with, if pooled
+	at     time.Time // received by the host
 }
 
 func (h *aclData) Unmarshal(b []byte) error {
 	if len(b) < 4 {
-		return fmt.Errorf("malformed acl packet")
+		return fmt.Errorf("%w acl packet", hci.ErrMalformed)
 	}
 	handle := uint16(b[0]) | (uint16(b[1]&0x0f) << 8)
 	flags := b[1] >> 4
 	dlen := uint16(b[2]) | (uint16(b[3]) << 8)
 	if len(b) != 4+int(dlen) {
-		return fmt.Errorf("malformed acl packet")
+		return fmt.Errorf("%w acl packet", hci.ErrMalformed)
 	}
 
 	*h = aclData{handle: handle, flags: flags, dlen: dlen, b: b[4:]}
@@ -78,42 +244,86 @@ func (h *aclData) String() string {
 }
 
 func (l *L2CAP) HandleLEMeta(b []byte) error {
+	if len(b) == 0 {
+		return fmt.Errorf("%w LE meta event", hci.ErrMalformed)
+	}
 	code := event.LEEventCode(b[0])
 	switch code {
 	case event.LEConnectionComplete:
-		l.Adv.SetServing(false)
 		ep := &event.LEConnectionCompleteEP{}
 		if err := ep.Unmarshal(b); err != nil {
 			return err
 		}
+		if ep.Status != 0x00 {
+			// e.g. a connection initiated as the central, and canceled
+			l.trace("l2cap: connection failed: %s", hci.Status(ep.Status).String())
+			return nil
+		}
+		if atomic.LoadInt32(&l.refusing) != 0 {
+			l.refuse(ep.ConnectionHandle)
+			return nil
+		}
+		// Advertising stops once a connection is accepted, as the
+		// peripheral; connecting, as the central, leaves it alone.
+		peripheral := ep.Role == roleSlave
+		if peripheral {
+			l.Adv.SetServing(false)
+		}
 		h := ep.ConnectionHandle
 		c := newConn(l, h, ep, l.connsSeq)
 		l.connsSeq++
 		l.connsmu.Lock()
 		defer l.connsmu.Unlock()
-		if c, found := l.conns[h]; found {
+		select {
+		case <-l.quit:
+			// Closed meanwhile, and too late to be dropped by Close.
+			return nil
+		default:
+		}
+		if c, found := l.connTable()[h]; found {
+			// The controller reuses a handle once disconnected only:
+			// the Disconnection Complete of the connection was lost.
 			l.trace("l2cap: handle 0x%04X is still alived (seq: %d)", h, c.seq)
+			c.reason = reasonLocalHost
+			close(c.closed)
 		}
 
-		l.conns[h] = c
-		l.acceptc <- c
-		if len(l.conns) < l.maxConn {
-			l.Adv.Start()
+		n := l.updateConn(h, c)
+		select {
+		case l.acceptc <- c:
+		case <-l.quit:
+			return nil
+		}
+		if peripheral && n < l.maxConn && atomic.LoadInt32(&l.stopping) == 0 {
+			l.resumeAdv()
 		}
 
-		// FIXME: sloppiness. This call should be called by the package user once we
-		// flesh out the support of L2CAP signaling packets (CID:0x0001,0x0005)
-		if ep.ConnLatency != 0 || ep.ConnInterval > 0x18 {
+		// Unless the user manages the parameters, ask for a short
+		// interval, as gatt always has.
+		if !l.ManageParams && (ep.ConnLatency != 0 || ep.ConnInterval > 0x18) {
 			c.UpdateConnection()
 		}
+		if l.dataOctets > minDataLength {
+			go c.negotiateDataLength()
+		}
 
 	case event.LEConnectionUpdateComplete:
+		return l.handleConnUpdate(b)
+
+	case event.LEChannelSelectionAlgorithm:
+		return l.handleChannelSelection(b)
+
+	case event.LEPHYUpdateComplete:
+		return l.handlePHYUpdate(b)
+
+	case event.LEDataLengthChange:
+		return l.handleDataLengthChange(b)
 
 	case event.LEAdvertisingReport,
 		event.LEReadRemoteUsedFeaturesComplete,
 		event.LELTKRequest,
 		event.LERemoteConnectionParameterRequest:
-		return fmt.Errorf("Unhandled LE event: %s", code)
+		return fmt.Errorf("LE event %s: %w", code, hci.ErrUnsupported)
 	}
 	return nil
 }
@@ -126,57 +336,172 @@ func (l *L2CAP) HandleDisconnectionComplete(b []byte) error {
 	h := ep.ConnectionHandle
 	l.connsmu.Lock()
 	defer l.connsmu.Unlock()
-	c, found := l.conns[h]
+	c, found := l.connTable()[h]
 	if !found {
 		l.trace("l2conn: disconnecting a disconnected 0x%04X connection", h)
 		return nil
 	}
-	delete(l.conns, h)
+	n := l.updateConn(h, nil)
 	l.trace("l2conn: 0x%04X disconnected, seq: %d", h, c.seq)
-	close(c.aclc)
-	if len(l.conns) == l.maxConn-1 {
-		l.Adv.Start()
+	c.reason = ep.Reason
+	close(c.closed)
+	if n < l.maxConn && atomic.LoadInt32(&l.stopping) == 0 {
+		l.resumeAdv()
 	}
 	return nil
 }
 
+// resumeAdv restarts advertising, stopped by the controller as it
+// accepted a connection, unless the user has stopped it since.
+func (l *L2CAP) resumeAdv() {
+	if err := l.Adv.Resume(); err != nil {
+		l.trace("l2cap: resuming advertising: %s", err)
+	}
+}
+
+// Roles returns the number of connections, as the central and as the
+// peripheral.
+func (l *L2CAP) Roles() (central, peripheral int) {
+	for _, c := range l.connTable() {
+		if c.Param.Role == roleMaster {
+			central++
+		} else {
+			peripheral++
+		}
+	}
+	return central, peripheral
+}
+
+// Conn returns the connection of handle h, if it is established.
+func (l *L2CAP) Conn(h uint16) (*Conn, bool) {
+	c, found := l.connTable()[h]
+	return c, found
+}
+
 func (l *L2CAP) HandleNumberOfCompletedPkts(b []byte) error {
 	ep := &event.NumberOfCompletedPktsEP{}
 	if err := ep.Unmarshal(b); err != nil {
 		return err
 	}
 	for _, r := range ep.Packets {
-		for i := 0; i < int(r.NumOfCompletedPkts); i++ {
-			<-l.bufCnt
-		}
+		l.ReleaseBuffers(r.ConnectionHandle, int(r.NumOfCompletedPkts))
 	}
 	return nil
 }
 
-func (l *L2CAP) HandleL2CAP(b []byte) error {
-	a := &aclData{}
+// ReleaseBuffers returns n ACL buffers, completed by the controller for
+// the connection of handle h.
+// It never blocks; completions in excess of the buffers in use, such as
+// those of packets sent by someone else, are ignored.
+func (l *L2CAP) ReleaseBuffers(h uint16, n int) {
+	if c, found := l.connTable()[h]; found {
+		if d := c.stats.completed(time.Now(), n); d != 0 {
+			l.stats.latency(d)
+		}
+	}
+	for i := 0; i < n; i++ {
+		select {
+		case <-l.bufCnt:
+		default:
+			return
+		}
+	}
+}
+
+func (l *L2CAP) HandleL2CAP(b []byte) error { return l.HandleACL(b, nil, time.Now()) }
+
+// HandleACL handles the ACL data b, as HandleL2CAP does, b being held in
+// the pooled buffer buf, if not nil, which is handed to Release once b
+// has been reassembled, or dropped. If it returns an error, buf is left
+// to the caller, for b to be logged. at is when the host received b, as
+// ReadTimed reports it.
+func (l *L2CAP) HandleACL(b []byte, buf *[]byte, at time.Time) error {
+	var a aclData
 	if err := a.Unmarshal(b); err != nil {
 		return err
 	}
-	l.connsmu.Lock()
-	defer l.connsmu.Unlock()
-	if c, found := l.conns[a.handle]; found {
-		c.aclc <- a
+	a.buf, a.at = buf, at
+	c, found := l.connTable()[a.handle]
+	if !found {
+		l.release(buf)
 		return nil
 	}
+	now := time.Now()
+	c.stats.received(now, len(a.b))
+	l.stats.received(now, len(a.b))
+	if b, ok := a.isSignal(); ok {
+		err := l.handleSignal(c, b)
+		if errors.Is(err, hci.ErrMalformed) {
+			c.malformed()
+		}
+		if err == nil {
+			l.release(buf)
+		}
+		return err
+	}
+	if c.handleDynamic(a) {
+		l.release(buf)
+		return nil
+	}
+	select {
+	case c.aclc <- a: // released by the reader
+	case <-c.closed:
+		l.release(buf)
+	}
 	return nil
 }
 
+// release hands buf, the buffer of ACL data done with, to Release.
+func (l *L2CAP) release(buf *[]byte) {
+	if buf != nil && l.Release != nil {
+		l.Release(buf)
+	}
+}
+
+// Stats returns the traffic statistics of all the connections together.
+func (l *L2CAP) Stats() Stats { return l.stats.snapshot(time.Now()) }
+
+// Queued returns the number of the ACL packets queued, not written to the
+// device yet, and that of the buffers of the controller held by those
+// written, whose completion is not reported yet.
+func (l *L2CAP) Queued() (packets, buffers int) {
+	return int(atomic.LoadInt64(&l.queued)), len(l.bufCnt)
+}
+
 func (l *L2CAP) ConnC() chan *Conn {
 	return l.acceptc
 }
 
-func (l *L2CAP) Close() error {
-	l.trace("l2cap: Close()")
-	close(l.acceptc)
-	for _, c := range l.conns {
-		c.Close()
+// Shutdown stops advertising, for good, refuses the connections still
+// being established, and disconnects all the others, with StopAdvertising,
+// Refuse and Disconnect. Close is still to be called.
+func (l *L2CAP) Shutdown(ctx context.Context) error {
+	err := l.StopAdvertising()
+	l.Refuse()
+	if e := l.Disconnect(ctx); e != nil {
+		err = e
 	}
+	return err
+}
+
+// Close stops the send queue, once what it holds has been written, and
+// drops the connections left, whose reads and writes then fail with
+// ErrDisconnected. It does not talk to the controller; see Shutdown.
+// It returns once the send queue has stopped, and may be called more than
+// once.
+func (l *L2CAP) Close() error {
+	l.closeOnce.Do(func() {
+		l.trace("l2cap: Close()")
+		close(l.quit)
+		<-l.sendDone
+		l.connsmu.Lock()
+		defer l.connsmu.Unlock()
+		for h, c := range l.connTable() {
+			l.updateConn(h, nil)
+			c.reason = reasonLocalHost
+			close(c.closed)
+		}
+	})
 	return nil
 }
 
@@ -190,9 +515,20 @@ func (l *L2CAP) trace(fmt string, v ...interface{}) {
 type Conn struct {
 	l2c    *L2CAP
 	handle uint16
-	aclc   chan *aclData
+	aclc   chan aclData
+	closed chan struct{} // closed once disconnected
+	reason uint8         // of the disconnection, set before closed is closed
 	Param  *event.LEConnectionCompleteEP
 	seq    int
+	stats  *stats
+	sig    *signaling
+	csa    int32    // channel selection algorithm, as reported
+	dlen   uint32   // data lengths, tx<<16 | rx, as reported
+	phy    phyState // of the PHY updates
+	turn   turn     // of the PDUs written
+	held   aclData  // start fragment received by Read ahead of its time
+	coc    channels // LE credit based connections
+	smp    smpState // of the Security Manager Protocol
 }
 
 func newConn(l *L2CAP, h uint16, ep *event.LEConnectionCompleteEP, seq int) *Conn {
@@ -201,45 +537,104 @@ func newConn(l *L2CAP, h uint16, ep *event.LEConnectionCompleteEP, seq int) *Con
 		l2c:    l,
 		handle: h,
 		Param:  ep,
-		aclc:   make(chan *aclData),
+		aclc:   make(chan aclData),
+		closed: make(chan struct{}),
 		seq:    seq,
+		stats:  newStats(),
+		sig:    newSignaling(ep),
 	}
 }
 
+// ErrDisconnected is returned by the reads and writes of a connection
+// once it is disconnected. It matches io.EOF, and the hci.Status of its
+// reason, with errors.Is.
+type ErrDisconnected struct {
+	Reason uint8 // HCI error code, e.g. 0x13 when closed by the remote device
+}
+
+func (e ErrDisconnected) Error() string {
+	return fmt.Sprintf("l2cap: disconnected: %s", hci.Status(e.Reason).String())
+}
+
+func (e ErrDisconnected) Is(target error) bool {
+	s, ok := target.(hci.Status)
+	return target == io.EOF || ok && uint8(s) == e.Reason
+}
+
+// Timeout reports whether the connection was lost to the supervision
+// timeout, the peer out of range, rather than closed by either device.
+func (e ErrDisconnected) Timeout() bool { return e.Reason == reasonTimeout }
+
+func (c *Conn) disconnected() error { return ErrDisconnected{Reason: c.reason} }
+
 // write writes the L2CAP payload to the controller.
 // It first prepend the L2CAP header (4-bytes), and diassemble the payload
 // if it is larger than the HCI LE buffer size that the conntroller can support.
+// The packets are queued to the send queue, which writes them to the
+// device asynchronously; a failure is reported by the subsequent writes.
+// Those of the fixed channels are queued ahead of those of the dynamic
+// channels waiting for the link; see turn.
 func (c *Conn) write(cid int, b []byte) (int, error) {
+	select {
+	case <-c.closed:
+		return 0, c.disconnected()
+	default:
+	}
+	if err := c.l2c.sendErr(); err != nil {
+		return 0, err
+	}
+	if !c.turn.acquire(cid < cidDynamicMin, c.closed) {
+		return 0, c.disconnected()
+	}
+	defer c.turn.release()
 	flag := uint8(0) // ACL data continuation flag
 	tlen := len(b)   // Total length of the L2CAP payload
-
-	w := append(
+	n := 4 + tlen    // L2CAP header + L2CAP payload
+	size := c.l2c.bufSize
+
+	// Lay the packets out back to back in a single buffer, as they are
+	// still being written after this returns.
+	nseg := (n + size - 1) / size
+	w := make([]byte, 5*nseg+n)
+	d := append(
 		[]byte{
-			0,    // packet type
-			0, 0, // handle
-			0, 0, // dlen
 			uint8(tlen), uint8(tlen >> 8), // L2CAP header
 			uint8(cid), uint8(cid >> 8), // L2CAP header
 		}, b...)
 
-	n := 4 + tlen // L2CAP header + L2CAP payload
 	for n > 0 {
 		dlen := n
-		if dlen > c.l2c.bufSize {
-			dlen = c.l2c.bufSize
+		if dlen > size {
+			dlen = size
 		}
 		w[0] = 0x02 // packetTypeACL
 		w[1] = uint8(c.handle)
 		w[2] = uint8(c.handle>>8) | flag
 		w[3] = uint8(dlen)
 		w[4] = uint8(dlen >> 8)
+		copy(w[5:], d[:dlen])
 
 		// make sure we don't send more buffers than the controller can handdle
-		c.l2c.bufCnt <- struct{}{}
-
-		c.l2c.dev.Write(w[:5+dlen])
-		w = w[dlen:] // advance the pointer to the next segment, if any.
-		flag = 0x10  // the rest of iterations handle continued segments, if any.
+		t := time.Now()
+		select {
+		case c.l2c.bufCnt <- struct{}{}:
+		case <-c.closed:
+			return 0, c.disconnected()
+		}
+		now := time.Now()
+		c.stats.sent(now, dlen, now.Sub(t))
+		c.l2c.stats.sent(now, dlen, now.Sub(t))
+
+		atomic.AddInt64(&c.l2c.queued, 1)
+		select {
+		case c.l2c.sendc <- w[:5+dlen]:
+		case <-c.l2c.quit:
+			atomic.AddInt64(&c.l2c.queued, -1)
+			return 0, fmt.Errorf("l2cap: write: %w", hci.ErrClosed)
+		}
+		w = w[5+dlen:] // advance the pointer to the next segment, if any.
+		d = d[dlen:]
+		flag = 0x10 // the rest of iterations handle continued segments, if any.
 		n -= dlen
 	}
 
@@ -258,33 +653,108 @@ func (c *Conn) UpdateConnection() (int, error) {
 	return c.write(0x05, b)
 }
 
+// Read reads the next PDU of the connection, reassembled from its
+// fragments. PDUs that do not reassemble, such as continuations of none,
+// or fragments exceeding the length of their PDU, are dropped, and
+// counted in Stats as malformed. A PDU larger than b is dropped as well,
+// and reported with io.ErrShortBuffer.
 func (c *Conn) Read(b []byte) (int, error) {
-	a, ok := <-c.aclc
-	if !ok {
-		return 0, io.EOF
+	n, _, err := c.ReadTimed(b)
+	return n, err
+}
+
+// ReadTimed reads the next PDU of the connection, as Read does, and
+// reports when the host received it: when the device was read its last
+// fragment from, on the monotonic clock, for the times of the PDUs to be
+// compared, whatever delays the layers above add to delivering them.
+func (c *Conn) ReadTimed(b []byte) (int, time.Time, error) {
+	for {
+		n, at, err := c.read(b)
+		if !errors.Is(err, hci.ErrMalformed) {
+			return n, at, err
+		}
+		c.l2c.trace("l2conn: 0x%04X: %s", c.handle, err)
+		c.malformed()
 	}
+}
 
-	tlen := int(uint16(a.b[0]) | uint16(a.b[1])<<8)
-	if tlen > len(b) {
-		return 0, io.ErrShortBuffer
+// read reassembles the next PDU into b, and reports when its last
+// fragment was received. A fragment starting a PDU while another is
+// being reassembled is held for the next call.
+func (c *Conn) read(b []byte) (int, time.Time, error) {
+	a, ok := c.held, true
+	if c.held.b == nil {
+		a, ok = c.recv()
+	}
+	c.held = aclData{}
+	if !ok {
+		return 0, time.Time{}, c.disconnected()
 	}
+	// Each fragment is released once copied, or dropped; the last as
+	// read returns.
+	defer func() { c.l2c.release(a.buf) }()
+	if a.flags&0x1 != 0 || len(a.b) < 4 {
+		return 0, time.Time{}, fmt.Errorf("%w l2cap pdu: no start fragment", hci.ErrMalformed)
+	}
+	tlen := int(uint16(a.b[0]) | uint16(a.b[1])<<8)
 	d := a.b[4:] // skip L2CAP header
-	copy(b, d)
-	n := len(d)
+	if len(d) > tlen {
+		return 0, time.Time{}, fmt.Errorf("%w l2cap pdu: %d bytes of %d", hci.ErrMalformed, len(d), tlen)
+	}
+	short := tlen > len(b)
+	n := copy(b, d)
+	m := len(d) // reassembled so far, less what b could not hold
 
 	// Keep receiving and reassemble continued L2CAP segments
-	for n != tlen {
-		if a, ok = <-c.aclc; !ok || (a.flags&0x1) == 0 {
-			return n, io.ErrUnexpectedEOF
+	for m != tlen {
+		c.l2c.release(a.buf)
+		if a, ok = c.recv(); !ok {
+			return n, time.Time{}, io.ErrUnexpectedEOF
 		}
-		copy(b[n:], a.b)
-		n += len(a.b)
+		if a.flags&0x1 == 0 {
+			c.held, a.buf = a, nil
+			return 0, time.Time{}, fmt.Errorf("%w l2cap pdu: %d bytes of %d", hci.ErrMalformed, m, tlen)
+		}
+		if m+len(a.b) > tlen {
+			return 0, time.Time{}, fmt.Errorf("%w l2cap pdu: %d bytes of %d", hci.ErrMalformed, m+len(a.b), tlen)
+		}
+		n += copy(b[n:], a.b)
+		m += len(a.b)
+	}
+	if short {
+		return 0, time.Time{}, io.ErrShortBuffer
+	}
+	return n, a.at, nil
+}
+
+// malformed counts a PDU of the connection dropped as malformed.
+func (c *Conn) malformed() {
+	c.stats.malformed()
+	c.l2c.stats.malformed()
+}
+
+// recv receives the next ACL packet; ok is false once disconnected.
+func (c *Conn) recv() (a aclData, ok bool) {
+	select {
+	case a = <-c.aclc:
+		return a, true
+	case <-c.closed:
+		return a, false
 	}
-	return n, nil
 }
 
+// Stats returns the traffic statistics of the connection.
+func (c *Conn) Stats() Stats { return c.stats.snapshot(time.Now()) }
+
 func (c *Conn) Write(b []byte) (int, error) {
-	return c.write(0x04, b)
+	return c.write(cidATT, b)
+}
+
+// WriteChannel writes the PDU b on the channel cid of the link, for the
+// channels layered on it, e.g. the LE credit based connections. The PDUs
+// of a dynamic channel give way, on the link, to those of ATT.
+func (c *Conn) WriteChannel(cid uint16, b []byte) (int, error) {
+	return c.write(int(cid), b)
 }
 
 // Close disconnects the connection by sending HCI disconnect command to the device.
@@ -292,9 +762,7 @@ func (c *Conn) Close() error {
 	l := c.l2c
 	h := c.handle
 	l.trace("l2conn: disconnct 0x%04X, seq: %d", c.handle, c.seq)
-	l.connsmu.Lock()
-	defer l.connsmu.Unlock()
-	cc, found := l.conns[h]
+	cc, found := l.connTable()[h]
 	if !found {
 		l.trace("l2conn: 0x%04X already disconnected", h)
 		return nil
@@ -302,8 +770,9 @@ func (c *Conn) Close() error {
 		l.trace("l2conn: 0x%04X seq mismatch %d/%d", h, c.seq, cc.seq)
 		return nil
 	}
-	if err, _ := l.cmd.Send(cmd.Disconnect{ConnectionHandle: h, Reason: 0x13}); err != nil {
+	if err := l.cmd.SendAndCheckResp(cmd.Disconnect{ConnectionHandle: h, Reason: 0x13}, []byte{0x00}); err != nil {
 		l.trace("l2conn: failed to disconnect, %s", err)
+		return err
 	}
 	return nil
 }
@@ -0,0 +1,71 @@
+package l2cap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sync"
+
+	"github.com/paypal/gatt/linux/internal/cmd"
+	"github.com/paypal/gatt/linux/internal/event"
+)
+
+// phyState holds the function the PHY updates of a connection are
+// delivered to.
+type phyState struct {
+	mu       sync.Mutex
+	onUpdate func(status, tx, rx uint8)
+}
+
+func (l *L2CAP) handlePHYUpdate(b []byte) error {
+	ep := &event.LEPHYUpdateCompleteEP{}
+	if err := ep.Unmarshal(b); err != nil {
+		return err
+	}
+	c, found := l.connTable()[ep.ConnectionHandle]
+	if !found {
+		return nil
+	}
+	c.phy.mu.Lock()
+	f := c.phy.onUpdate
+	c.phy.mu.Unlock()
+	if f != nil {
+		f(ep.Status, ep.TxPHY, ep.RxPHY)
+	}
+	return nil
+}
+
+// ReadPHY reads the PHYs the connection transmits, and receives, on:
+// 0x01 for 1M, 0x02 for 2M, and 0x03 for Coded.
+func (c *Conn) ReadPHY() (tx, rx uint8, err error) {
+	p := cmd.LEReadPHY{ConnectionHandle: c.handle}
+	b, err := c.l2c.cmd.Send(p)
+	if err != nil {
+		return 0, 0, err
+	}
+	rp := cmd.LEReadPHYRP{}
+	if err := binary.Read(bytes.NewBuffer(b), binary.LittleEndian, &rp); err != nil {
+		return 0, 0, err
+	}
+	if rp.Status != 0x00 {
+		return 0, 0, cmd.ErrCommandFailed{Opcode: p.Opcode(), Status: rp.Status}
+	}
+	return rp.TxPHY, rp.RxPHY, nil
+}
+
+// SetPHY requests the connection to switch to the PHYs preferred, as the
+// bits of tx and rx: bit 0 for 1M, 1 for 2M, and 2 for Coded, with the
+// coding of options. The controllers of both ends settle on the PHYs;
+// the update, if any, is delivered to the OnPHYUpdate function.
+func (c *Conn) SetPHY(tx, rx uint8, options uint16) error {
+	return c.l2c.cmd.SendAndCheckResp(cmd.LESetPHY{ConnectionHandle: c.handle, TxPHYs: tx, RxPHYs: rx, PHYOptions: options}, []byte{0x00})
+}
+
+// OnPHYUpdate sets the function the PHY updates of the connection are
+// delivered to, with their status, and the PHYs switched to, as those of
+// ReadPHY. It is called from the goroutine reading the HCI: it must not
+// block.
+func (c *Conn) OnPHYUpdate(f func(status, tx, rx uint8)) {
+	c.phy.mu.Lock()
+	defer c.phy.mu.Unlock()
+	c.phy.onUpdate = f
+}
@@ -0,0 +1,30 @@
+package l2cap
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/paypal/gatt/linux/internal/cmd"
+)
+
+// RSSIUnavailable is the RSSI the controller reads when it has not
+// measured any yet.
+const RSSIUnavailable = 127
+
+// ReadRSSI reads the RSSI the controller last received the peer of the
+// connection with, in dBm, from -127 to 20, or RSSIUnavailable.
+func (c *Conn) ReadRSSI() (int8, error) {
+	p := cmd.ReadRSSI{ConnectionHandle: c.handle}
+	b, err := c.l2c.cmd.Send(p)
+	if err != nil {
+		return 0, err
+	}
+	rp := cmd.ReadRSSIRP{}
+	if err := binary.Read(bytes.NewBuffer(b), binary.LittleEndian, &rp); err != nil {
+		return 0, err
+	}
+	if rp.Status != 0x00 {
+		return 0, cmd.ErrCommandFailed{Opcode: p.Opcode(), Status: rp.Status}
+	}
+	return rp.RSSI, nil
+}
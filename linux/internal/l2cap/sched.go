@@ -0,0 +1,82 @@
+package l2cap
+
+import "sync"
+
+// cidDynamicMin is the first of the channels allocated dynamically on an
+// LE link, e.g. those of the LE credit based connections.
+const cidDynamicMin = 0x0040
+
+// A turn schedules the PDUs written on a link, one at a time, so that the
+// fragments of one are never interleaved with those of another. The PDUs
+// of the fixed channels, ATT and signaling, small and waited for, take the
+// turn ahead of those of the dynamic channels, which carry bulk data: an
+// ATT PDU waits at most for the fragments left of the bulk PDU being
+// written, not for all those queued behind it.
+type turn struct {
+	mu   sync.Mutex
+	busy bool
+	high []chan struct{} // waiting for the turn, from the fixed channels
+	low  []chan struct{} // waiting for the turn, from the dynamic channels
+}
+
+// acquire waits for the turn, and returns false, without it, if closed is
+// closed first.
+func (t *turn) acquire(high bool, closed <-chan struct{}) bool {
+	t.mu.Lock()
+	if !t.busy {
+		t.busy = true
+		t.mu.Unlock()
+		return true
+	}
+	c := make(chan struct{})
+	if high {
+		t.high = append(t.high, c)
+	} else {
+		t.low = append(t.low, c)
+	}
+	t.mu.Unlock()
+
+	select {
+	case <-c:
+		return true
+	case <-closed:
+	}
+	t.mu.Lock()
+	var waiting bool
+	if t.high, waiting = dequeue(t.high, c); !waiting {
+		t.low, waiting = dequeue(t.low, c)
+	}
+	t.mu.Unlock()
+	if !waiting {
+		// Handed the turn meanwhile; pass it on.
+		t.release()
+	}
+	return false
+}
+
+// release hands the turn to the next PDU, of the fixed channels first.
+func (t *turn) release() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var c chan struct{}
+	switch {
+	case len(t.high) > 0:
+		c, t.high = t.high[0], t.high[1:]
+	case len(t.low) > 0:
+		c, t.low = t.low[0], t.low[1:]
+	default:
+		t.busy = false
+		return
+	}
+	close(c)
+}
+
+// dequeue removes c from q, and reports whether it was there.
+func dequeue(q []chan struct{}, c chan struct{}) ([]chan struct{}, bool) {
+	for i, cc := range q {
+		if cc == c {
+			return append(q[:i], q[i+1:]...), true
+		}
+	}
+	return q, false
+}
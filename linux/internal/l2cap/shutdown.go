@@ -0,0 +1,75 @@
+package l2cap
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/paypal/gatt/linux/internal/cmd"
+)
+
+// reasonPowerOff is the reason the connections refused are disconnected
+// with: Remote Device Terminated Connection due to Power Off.
+const reasonPowerOff = 0x15
+
+// StopAdvertising stops advertising, for good: it is no longer resumed as
+// the connections come and go.
+func (l *L2CAP) StopAdvertising() error {
+	atomic.StoreInt32(&l.stopping, 1)
+	if l.Adv != nil && l.Adv.Serving() {
+		return l.Adv.Stop()
+	}
+	return nil
+}
+
+// Refuse makes the connections established from now on disconnected
+// right away, rather than accepted, e.g. those initiated by a central as
+// advertising stopped.
+func (l *L2CAP) Refuse() { atomic.StoreInt32(&l.refusing, 1) }
+
+// refuse disconnects the connection of handle h, established as the
+// connections are refused, without waiting for the controller.
+func (l *L2CAP) refuse(h uint16) {
+	l.trace("l2conn: 0x%04X refused", h)
+	go l.cmd.SendAndCheckResp(cmd.Disconnect{ConnectionHandle: h, Reason: reasonPowerOff}, []byte{0x00})
+}
+
+// drainPoll is how often Drain checks the send queue.
+var drainPoll = time.Millisecond
+
+// Drain waits until the packets queued by the writes of the connections
+// have been written to the device, or ctx is done.
+func (l *L2CAP) Drain(ctx context.Context) error {
+	t := time.NewTicker(drainPoll)
+	defer t.Stop()
+	for atomic.LoadInt64(&l.queued) > 0 {
+		select {
+		case <-t.C:
+		case <-l.quit:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Disconnect disconnects all the connections, and waits until the
+// controller has reported each disconnected, or ctx is done.
+func (l *L2CAP) Disconnect(ctx context.Context) error {
+	var err error
+	cs := l.connTable()
+	for _, c := range cs {
+		if e := c.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	for _, c := range cs {
+		select {
+		case <-c.closed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return err
+}
@@ -0,0 +1,307 @@
+package l2cap
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/paypal/gatt/linux/internal/cmd"
+	"github.com/paypal/gatt/linux/internal/event"
+	"github.com/paypal/gatt/linux/internal/hci"
+)
+
+// Channels of an LE link.
+const (
+	cidATT    = 0x0004
+	cidSignal = 0x0005
+)
+
+// Commands of the LE signaling channel handled.
+const (
+	sigCommandReject      = 0x01
+	sigDisconnReq         = 0x06
+	sigDisconnRsp         = 0x07
+	sigConnParamUpdateReq = 0x12
+	sigConnParamUpdateRsp = 0x13
+	sigLECreditConnReq    = 0x14
+	sigLECreditConnRsp    = 0x15
+	sigFlowControlCredit  = 0x16
+)
+
+// sigRTX is how long a signaling request waits for its response, and a
+// request accepted by the central for the connection to be updated: the
+// RTX timer of the L2CAP.
+var sigRTX = 30 * time.Second
+
+// ErrParamsRejected is returned by UpdateParams when the central rejects
+// the parameters requested.
+var ErrParamsRejected = errors.New("l2cap: connection parameters rejected")
+
+// ConnParams are the parameters of a connection.
+type ConnParams struct {
+	IntervalMin        uint16 // in units of 1.25 ms, from 7.5 ms to 4 s
+	IntervalMax        uint16 // in units of 1.25 ms, no less than IntervalMin
+	Latency            uint16 // number of connection events the peripheral may skip
+	SupervisionTimeout uint16 // in units of 10 ms, from 100 ms to 32 s
+}
+
+// signaling is the state of the LE signaling channel of a connection.
+type signaling struct {
+	mu       sync.Mutex
+	params   ConnParams            // current; the interval as both bounds
+	id       uint8                 // of the last command sent
+	waiting  map[uint8]chan []byte // responses awaited, by identifier
+	updated  chan uint8            // status of the LE Connection Update Complete event
+	onUpdate func(p ConnParams) (ConnParams, bool)
+	onSignal func() bool
+	busy     sync.Mutex // held by UpdateParams
+}
+
+func newSignaling(ep *event.LEConnectionCompleteEP) *signaling {
+	return &signaling{
+		params: ConnParams{
+			IntervalMin:        ep.ConnInterval,
+			IntervalMax:        ep.ConnInterval,
+			Latency:            ep.ConnLatency,
+			SupervisionTimeout: ep.SupervisionTimeout,
+		},
+		updated: make(chan uint8, 1),
+	}
+}
+
+// isSignal reports whether a is a complete packet of the LE signaling
+// channel, and returns its payload.
+func (a *aclData) isSignal() ([]byte, bool) {
+	if a.flags&0x1 != 0 || len(a.b) < 4 {
+		return nil, false
+	}
+	n := int(uint16(a.b[0]) | uint16(a.b[1])<<8)
+	cid := uint16(a.b[2]) | uint16(a.b[3])<<8
+	return a.b[4:], cid == cidSignal && n == len(a.b)-4
+}
+
+// handleSignal handles the signaling commands of c.
+func (l *L2CAP) handleSignal(c *Conn, b []byte) error {
+	if len(b) < 4 || len(b) != 4+int(uint16(b[2])|uint16(b[3])<<8) {
+		return fmt.Errorf("%w signaling command", hci.ErrMalformed)
+	}
+	c.sig.mu.Lock()
+	accept := c.sig.onSignal
+	c.sig.mu.Unlock()
+	if accept != nil && !accept() {
+		return nil
+	}
+	code, id, data := b[0], b[1], b[4:]
+	switch code {
+	case sigConnParamUpdateReq:
+		if c.Param.Role != roleMaster || len(data) != 8 {
+			return c.rejectSignal(id)
+		}
+		p := ConnParams{
+			IntervalMin:        uint16(data[0]) | uint16(data[1])<<8,
+			IntervalMax:        uint16(data[2]) | uint16(data[3])<<8,
+			Latency:            uint16(data[4]) | uint16(data[5])<<8,
+			SupervisionTimeout: uint16(data[6]) | uint16(data[7])<<8,
+		}
+		c.sig.mu.Lock()
+		f := c.sig.onUpdate
+		c.sig.mu.Unlock()
+		ok := true
+		if f != nil {
+			p, ok = f(p)
+		}
+		result := byte(0x00)
+		if !ok {
+			result = 0x01
+		}
+		if _, err := c.write(cidSignal, []byte{sigConnParamUpdateRsp, id, 0x02, 0x00, result, 0x00}); err != nil || !ok {
+			return err
+		}
+		return l.cmd.SendAndCheckResp(c.connUpdate(p), []byte{0x00})
+	case sigLECreditConnReq:
+		return l.handleChannelRequest(c, id, data)
+	case sigFlowControlCredit:
+		return c.handleCredits(id, data)
+	case sigDisconnReq:
+		return c.handleChannelDisconnect(id, data)
+	case sigConnParamUpdateRsp, sigLECreditConnRsp, sigDisconnRsp, sigCommandReject:
+		c.sig.mu.Lock()
+		rsp := c.sig.waiting[id]
+		delete(c.sig.waiting, id)
+		c.sig.mu.Unlock()
+		if rsp != nil {
+			rsp <- append([]byte{code}, data...)
+		}
+		return nil
+	default:
+		return c.rejectSignal(id)
+	}
+}
+
+// rejectSignal answers the signaling request id with a Command Reject,
+// command not understood.
+func (c *Conn) rejectSignal(id uint8) error {
+	_, err := c.write(cidSignal, []byte{sigCommandReject, id, 0x02, 0x00, 0x00, 0x00})
+	return err
+}
+
+// nextID returns the identifier of a new signaling command. The caller
+// must hold mu.
+func (s *signaling) nextID() uint8 {
+	s.id++
+	if s.id == 0 {
+		s.id = 1 // 0x00 is an invalid identifier
+	}
+	return s.id
+}
+
+// request returns the identifier of a new signaling request, and the
+// channel its response, or a Command Reject, is delivered on, its code
+// first. cancel is to be called once the response is no longer awaited.
+func (s *signaling) request() (uint8, chan []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id, rsp := s.nextID(), make(chan []byte, 1)
+	if s.waiting == nil {
+		s.waiting = make(map[uint8]chan []byte)
+	}
+	s.waiting[id] = rsp
+	return id, rsp
+}
+
+// cancel stops waiting for the response to the request id.
+func (s *signaling) cancel(id uint8) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.waiting, id)
+}
+
+func (c *Conn) connUpdate(p ConnParams) cmd.LEConnUpdate {
+	return cmd.LEConnUpdate{
+		ConnectionHandle:   c.handle,
+		ConnIntervalMin:    p.IntervalMin,
+		ConnIntervalMax:    p.IntervalMax,
+		ConnLatency:        p.Latency,
+		SupervisionTimeout: p.SupervisionTimeout,
+	}
+}
+
+// handleConnUpdate records the parameters of an LE Connection Update
+// Complete event.
+func (l *L2CAP) handleConnUpdate(b []byte) error {
+	ep := &event.LEConnectionUpdateCompleteEP{}
+	if err := ep.Unmarshal(b); err != nil {
+		return err
+	}
+	c, found := l.connTable()[ep.ConnectionHandle]
+	if !found {
+		return nil
+	}
+	c.sig.mu.Lock()
+	if ep.Status == 0x00 {
+		c.sig.params = ConnParams{
+			IntervalMin:        ep.ConnInterval,
+			IntervalMax:        ep.ConnInterval,
+			Latency:            ep.ConnLatency,
+			SupervisionTimeout: ep.SupervisionTimeout,
+		}
+	}
+	c.sig.mu.Unlock()
+	select {
+	case <-c.sig.updated: // stale
+	default:
+	}
+	c.sig.updated <- ep.Status
+	return nil
+}
+
+// Params returns the current parameters of the connection, the
+// interval being reported as both bounds.
+func (c *Conn) Params() ConnParams {
+	c.sig.mu.Lock()
+	defer c.sig.mu.Unlock()
+	return c.sig.params
+}
+
+// OnParamsRequest sets the function that answers the Connection
+// Parameter Update Requests of the peripheral, as the central. It
+// returns the parameters to update the connection with, and whether the
+// request is accepted. Requests are all accepted, as they are, if f is
+// nil, the default.
+func (c *Conn) OnParamsRequest(f func(p ConnParams) (ConnParams, bool)) {
+	c.sig.mu.Lock()
+	defer c.sig.mu.Unlock()
+	c.sig.onUpdate = f
+}
+
+// OnSignal sets a function called as each signaling command of the
+// connection is received, which drops it, unanswered, by returning false,
+// e.g. to limit their rate. It is called from the goroutine reading the
+// HCI: it must not block.
+func (c *Conn) OnSignal(f func() bool) {
+	c.sig.mu.Lock()
+	defer c.sig.mu.Unlock()
+	c.sig.onSignal = f
+}
+
+// UpdateParams updates the connection to the parameters p, and returns
+// once the controller reports it updated. As the central, it updates the
+// connection itself; as the peripheral, it requests the central to, with
+// a Connection Parameter Update Request, which the central may reject.
+// The central is waited for up to the RTX timer of 30 s. Only one update
+// is carried out at a time.
+func (c *Conn) UpdateParams(p ConnParams) error {
+	c.sig.busy.Lock()
+	defer c.sig.busy.Unlock()
+	select {
+	case <-c.sig.updated: // stale
+	default:
+	}
+	t := time.NewTimer(sigRTX)
+	defer t.Stop()
+
+	if c.Param.Role == roleMaster {
+		if err := c.l2c.cmd.SendAndCheckResp(c.connUpdate(p), []byte{0x00}); err != nil {
+			return err
+		}
+	} else {
+		id, rsp := c.sig.request()
+		defer c.sig.cancel(id)
+
+		if _, err := c.write(cidSignal, []byte{
+			sigConnParamUpdateReq, id, 0x08, 0x00,
+			uint8(p.IntervalMin), uint8(p.IntervalMin >> 8),
+			uint8(p.IntervalMax), uint8(p.IntervalMax >> 8),
+			uint8(p.Latency), uint8(p.Latency >> 8),
+			uint8(p.SupervisionTimeout), uint8(p.SupervisionTimeout >> 8),
+		}); err != nil {
+			return err
+		}
+		select {
+		case b := <-rsp:
+			switch {
+			case b[0] == sigCommandReject:
+				return fmt.Errorf("l2cap: connection parameter update request: %w by the central", hci.ErrUnsupported)
+			case len(b) < 2 || b[1] != 0x00:
+				return ErrParamsRejected
+			}
+		case <-c.closed:
+			return c.disconnected()
+		case <-t.C:
+			return errors.New("l2cap: connection parameter update request timed out")
+		}
+	}
+
+	select {
+	case status := <-c.sig.updated:
+		if status != 0x00 {
+			return cmd.ErrCommandFailed{Opcode: cmd.LEConnUpdate{}.Opcode(), Status: status}
+		}
+		return nil
+	case <-c.closed:
+		return c.disconnected()
+	case <-t.C:
+		return errors.New("l2cap: connection not updated in time")
+	}
+}
@@ -0,0 +1,118 @@
+package l2cap
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/paypal/gatt/linux/internal/cmd"
+	"github.com/paypal/gatt/linux/internal/event"
+)
+
+// cidSMP is the fixed channel of the Security Manager Protocol.
+const cidSMP = 0x0006
+
+const (
+	smpPairingFailed       = 0x05 // opcode
+	smpPairingNotSupported = 0x05 // reason
+)
+
+// smpState holds the function the SMP PDUs of a connection are delivered
+// to, and the encryption being started, if any.
+type smpState struct {
+	mu        sync.Mutex
+	onPDU     func(b []byte)
+	encrypted chan event.EncryptionChangeEP // of the encryption being started
+}
+
+// OnSMP sets the function the PDUs of the Security Manager Protocol of the
+// connection are delivered to, for it to be paired over. It is called
+// from the goroutine handing the ACL data of the link over: it must not
+// block; b is its own. Without one, the pairings the peer requests are
+// refused as not supported.
+func (c *Conn) OnSMP(f func(b []byte)) {
+	c.smp.mu.Lock()
+	defer c.smp.mu.Unlock()
+	c.smp.onPDU = f
+}
+
+// WriteSMP writes the SMP PDU b.
+func (c *Conn) WriteSMP(b []byte) error {
+	_, err := c.write(cidSMP, b)
+	return err
+}
+
+// handleSMP delivers the SMP PDU b to the OnSMP function, if any.
+func (c *Conn) handleSMP(b []byte) {
+	c.smp.mu.Lock()
+	f := c.smp.onPDU
+	c.smp.mu.Unlock()
+	if f != nil {
+		f(b)
+		return
+	}
+	if len(b) > 0 && b[0] != smpPairingFailed {
+		c.WriteSMP([]byte{smpPairingFailed, smpPairingNotSupported})
+	}
+}
+
+// StartEncryption encrypts the link, of which the device is the central,
+// with the long term key ltk, identified by rand and ediv, least
+// significant byte first. It returns once the controller reports the link
+// encrypted, or failing to, or ctx is done.
+func (c *Conn) StartEncryption(ctx context.Context, ltk [16]byte, rand uint64, ediv uint16) error {
+	done := make(chan event.EncryptionChangeEP, 1)
+	c.smp.mu.Lock()
+	if c.smp.encrypted != nil {
+		c.smp.mu.Unlock()
+		return errors.New("l2cap: encryption already being started")
+	}
+	c.smp.encrypted = done
+	c.smp.mu.Unlock()
+	defer func() {
+		c.smp.mu.Lock()
+		c.smp.encrypted = nil
+		c.smp.mu.Unlock()
+	}()
+	p := cmd.LEStartEncryption{ConnectionHandle: c.handle, RandomNumber: rand, EncryptedDiversifier: ediv, LongTermKey: ltk}
+	if err := c.l2c.cmd.SendAndCheckRespCtx(ctx, p, []byte{0x00}); err != nil {
+		return err
+	}
+	select {
+	case ep := <-done:
+		if ep.Status != 0x00 {
+			return cmd.ErrCommandFailed{Opcode: p.Opcode(), Status: ep.Status}
+		}
+		if ep.EncryptionEnabled == 0x00 {
+			return errors.New("l2cap: link left unencrypted")
+		}
+		return nil
+	case <-c.closed:
+		return c.disconnected()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// HandleEncryptionChange hands the Encryption Change event b over to the
+// StartEncryption waiting for it, if any.
+func (l *L2CAP) HandleEncryptionChange(b []byte) error {
+	ep := &event.EncryptionChangeEP{}
+	if err := ep.Unmarshal(b); err != nil {
+		return err
+	}
+	c, found := l.connTable()[ep.ConnectionHandle]
+	if !found {
+		return nil
+	}
+	c.smp.mu.Lock()
+	done := c.smp.encrypted
+	c.smp.mu.Unlock()
+	if done != nil {
+		select {
+		case done <- *ep:
+		default:
+		}
+	}
+	return nil
+}
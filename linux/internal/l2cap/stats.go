@@ -0,0 +1,148 @@
+package l2cap
+
+import (
+	"sync"
+	"time"
+)
+
+// Stats are the traffic statistics of a connection, or of all of them.
+type Stats struct {
+	TxBytes   uint64
+	TxPackets uint64
+	RxBytes   uint64
+	RxPackets uint64
+
+	// Rolling throughput, in bytes per second.
+	TxRate float64
+	RxRate float64
+
+	// QueueWait is the average time an outgoing packet waits for a free
+	// controller buffer.
+	QueueWait time.Duration
+
+	// Latency is the average time from an outgoing packet being queued to
+	// the controller reporting it completed, which roughly is the time it
+	// takes the link to carry it.
+	Latency time.Duration
+
+	// Malformed is the number of incoming PDUs dropped as malformed,
+	// e.g. fragments not adding up to the length of their PDU.
+	Malformed uint64
+}
+
+const (
+	rateWindow = time.Second
+	rateWeight = 0.25 // weight of the latest window in the rolling rate
+	timeWeight = 8    // the averages of durations move by 1/timeWeight
+	maxPending = 1024 // queue times kept for the latency
+)
+
+// meter measures a rolling rate, averaged over windows of rateWindow.
+type meter struct {
+	start time.Time // of the current window
+	n     uint64    // counted in the current window
+	rate  float64
+}
+
+func (m *meter) add(now time.Time, n int) {
+	m.roll(now)
+	m.n += uint64(n)
+}
+
+func (m *meter) roll(now time.Time) {
+	if m.start.IsZero() {
+		m.start = now
+		return
+	}
+	for d := now.Sub(m.start); d >= rateWindow; d = now.Sub(m.start) {
+		m.rate += rateWeight * (float64(m.n)/rateWindow.Seconds() - m.rate)
+		m.n = 0
+		m.start = m.start.Add(rateWindow)
+		if d > 10*rateWindow { // idle for long; forget about it.
+			m.rate, m.start = 0, now
+		}
+	}
+}
+
+func (m *meter) value(now time.Time) float64 {
+	m.roll(now)
+	return m.rate
+}
+
+func average(avg, d time.Duration) time.Duration {
+	if avg == 0 {
+		return d
+	}
+	return avg + (d-avg)/timeWeight
+}
+
+type stats struct {
+	mu     sync.Mutex
+	s      Stats
+	tx, rx meter
+	queued []time.Time // queue times of the packets not completed yet
+}
+
+func newStats() *stats { return &stats{} }
+
+func (s *stats) sent(now time.Time, n int, wait time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.s.TxBytes += uint64(n)
+	s.s.TxPackets++
+	s.s.QueueWait = average(s.s.QueueWait, wait)
+	s.tx.add(now, n)
+	if len(s.queued) < maxPending {
+		s.queued = append(s.queued, now.Add(-wait))
+	}
+}
+
+func (s *stats) received(now time.Time, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.s.RxBytes += uint64(n)
+	s.s.RxPackets++
+	s.rx.add(now, n)
+}
+
+func (s *stats) malformed() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.s.Malformed++
+}
+
+// completed accounts for n packets completed by the controller, and
+// returns their average latency.
+func (s *stats) completed(now time.Time, n int) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n > len(s.queued) {
+		n = len(s.queued)
+	}
+	if n == 0 {
+		return 0
+	}
+	var sum time.Duration
+	for _, t := range s.queued[:n] {
+		sum += now.Sub(t)
+	}
+	s.queued = s.queued[:copy(s.queued, s.queued[n:])]
+	d := sum / time.Duration(n)
+	s.s.Latency = average(s.s.Latency, d)
+	return d
+}
+
+func (s *stats) latency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.s.Latency = average(s.s.Latency, d)
+}
+
+func (s *stats) snapshot(now time.Time) Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.s
+	st.TxRate = s.tx.value(now)
+	st.RxRate = s.rx.value(now)
+	return st
+}
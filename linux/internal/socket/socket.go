@@ -30,6 +30,10 @@ const (
 	HCI_CHANNEL_CONTROL = 3
 )
 
+// HCI_DEV_NONE is the device the sockets of the channels of no device,
+// such as the control channel, are bound to.
+const HCI_DEV_NONE = 0xFFFF
+
 type _Socklen uint32
 
 type Sockaddr interface {
@@ -129,3 +133,60 @@ type HCIFilter struct {
 func SetsockoptFilter(fd int, f *HCIFilter) (err error) {
 	return setsockopt(fd, SOL_HCI, HCI_FILTER, unsafe.Pointer(f), unsafe.Sizeof(*f))
 }
+
+// HCI ioctls
+const HCIDEVDOWN = 0x400448CA
+
+// DevDown takes the HCI device of index dev down, as hciconfig hciN down
+// does, through fd, an HCI socket not bound to a channel yet. The kernel
+// refuses HCI_CHANNEL_USER on a device that is up.
+func DevDown(fd, dev int) error {
+	_, _, e1 := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), HCIDEVDOWN, uintptr(dev))
+	if e1 != 0 {
+		return e1
+	}
+	return nil
+}
+
+// HCI device ioctls, which read into their argument.
+const (
+	HCIGETDEVLIST = 0x800448D2
+	HCIGETDEVINFO = 0x800448D3
+
+	HCI_MAX_DEV = 16
+	HCI_UP      = 1 << 0 // of the flags of a device
+)
+
+// DevList returns the indexes of the HCI devices, through fd, an HCI
+// socket.
+func DevList(fd int) ([]int, error) {
+	// struct hci_dev_list_req, followed by HCI_MAX_DEV struct hci_dev_req
+	// of 8 bytes, aligned to 4.
+	b := make([]byte, 4+8*HCI_MAX_DEV)
+	b[0], b[1] = HCI_MAX_DEV, 0
+	if _, _, e1 := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), HCIGETDEVLIST, uintptr(unsafe.Pointer(&b[0]))); e1 != 0 {
+		return nil, e1
+	}
+	n := int(b[0]) | int(b[1])<<8
+	ids := make([]int, 0, n)
+	for i := 0; i < n && i < HCI_MAX_DEV; i++ {
+		ids = append(ids, int(b[4+8*i])|int(b[5+8*i])<<8)
+	}
+	return ids, nil
+}
+
+// DevInfo returns the address of the HCI device of index dev, as the
+// kernel stores it, least significant byte first, and its flags, through
+// fd, an HCI socket.
+func DevInfo(fd, dev int) (addr [6]byte, flags uint32, err error) {
+	// struct hci_dev_info: dev_id at 0, name[8] at 2, bdaddr at 10,
+	// flags at 16, and more, 92 bytes in all.
+	b := make([]byte, 128)
+	b[0], b[1] = byte(dev), byte(dev>>8)
+	if _, _, e1 := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), HCIGETDEVINFO, uintptr(unsafe.Pointer(&b[0]))); e1 != 0 {
+		return addr, 0, e1
+	}
+	copy(addr[:], b[10:16])
+	flags = uint32(b[16]) | uint32(b[17])<<8 | uint32(b[18])<<16 | uint32(b[19])<<24
+	return addr, flags, nil
+}
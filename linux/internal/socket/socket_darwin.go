@@ -2,5 +2,13 @@
 
 package socket
 
+import "syscall"
+
 // For compile time compatibility
 const AF_BLUETOOTH = 0
+
+// For compile time compatibility
+func Sendmmsg(fd int, bs [][]byte) (int, error) { return 0, syscall.ENOSYS }
+
+// For compile time compatibility
+func Recvmmsg(fd int, bs [][]byte, ns []int) (int, error) { return 0, syscall.ENOSYS }
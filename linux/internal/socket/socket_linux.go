@@ -2,6 +2,98 @@
 
 package socket
 
-import "syscall"
+import (
+	"runtime"
+	"syscall"
+	"unsafe"
+)
 
 const AF_BLUETOOTH = syscall.AF_BLUETOOTH
+
+// sysSendmmsg is the number of the sendmmsg system call, which package
+// syscall defines for some architectures only. It is 0 where unknown.
+var sysSendmmsg = map[string]uintptr{
+	"386":   345,
+	"amd64": 307,
+	"arm":   374,
+	"arm64": 269,
+}[runtime.GOARCH]
+
+type mmsghdr struct {
+	hdr syscall.Msghdr
+	len uint32
+	_   [unsafe.Sizeof(uintptr(0)) - 4]byte
+}
+
+// Sendmmsg sends each of bs as a packet of its own, in a single system
+// call. It returns the number of packets sent, which may be less than
+// len(bs). It returns ENOSYS if sendmmsg is not known on this platform.
+func Sendmmsg(fd int, bs [][]byte) (int, error) {
+	if sysSendmmsg == 0 {
+		return 0, syscall.ENOSYS
+	}
+	// The empty packets are skipped, and counted as sent; idx holds the
+	// index in bs of each of the others.
+	iov := make([]syscall.Iovec, 0, len(bs))
+	idx := make([]int, 0, len(bs))
+	for i, b := range bs {
+		if len(b) == 0 {
+			continue
+		}
+		v := syscall.Iovec{Base: &b[0]}
+		v.SetLen(len(b))
+		iov = append(iov, v)
+		idx = append(idx, i)
+	}
+	if len(iov) == 0 {
+		return len(bs), nil
+	}
+	msgs := make([]mmsghdr, len(iov))
+	for i := range msgs {
+		msgs[i].hdr.Iov = &iov[i]
+		msgs[i].hdr.Iovlen = 1
+	}
+	n, _, e1 := syscall.Syscall6(sysSendmmsg, uintptr(fd), uintptr(unsafe.Pointer(&msgs[0])), uintptr(len(msgs)), 0, 0, 0)
+	if e1 != 0 {
+		return 0, e1
+	}
+	if int(n) < len(idx) {
+		return idx[n], nil
+	}
+	return len(bs), nil
+}
+
+const msgWaitForOne = 0x10000 // MSG_WAITFORONE
+
+// Recvmmsg receives up to len(bs) packets in a single system call, each
+// into a buffer of its own, and stores their lengths in ns. It blocks
+// until at least one packet is available, and returns the number of
+// packets received. A zero-length buffer ends the batch: the packets are
+// received into the buffers before it only.
+func Recvmmsg(fd int, bs [][]byte, ns []int) (int, error) {
+	for i, b := range bs {
+		if len(b) == 0 {
+			bs = bs[:i]
+			break
+		}
+	}
+	if len(bs) == 0 {
+		return 0, nil
+	}
+	iov := make([]syscall.Iovec, len(bs))
+	msgs := make([]mmsghdr, len(bs))
+	for i, b := range bs {
+		iov[i].Base = &b[0]
+		iov[i].SetLen(len(b))
+		msgs[i].hdr.Iov = &iov[i]
+		msgs[i].hdr.Iovlen = 1
+	}
+	n, _, e1 := syscall.Syscall6(syscall.SYS_RECVMMSG, uintptr(fd), uintptr(unsafe.Pointer(&msgs[0])), uintptr(len(msgs)), msgWaitForOne, 0, 0)
+	if e1 != 0 {
+		return 0, e1
+	}
+	for i := 0; i < int(n); i++ {
+		ns[i] = int(msgs[i].len)
+	}
+	return int(n), nil
+}
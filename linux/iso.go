@@ -0,0 +1,573 @@
+package linux
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/paypal/gatt/linux/internal/cmd"
+	"github.com/paypal/gatt/linux/internal/event"
+	"github.com/paypal/gatt/linux/internal/hci"
+)
+
+// Parameters of the isochronous channel commands, re-exported so that
+// users outside of this package can fill them in.
+type (
+	CIGParameters     = cmd.LESetCIGParameters
+	CISParameters     = cmd.CISParam
+	BIGParameters     = cmd.LECreateBIG
+	BIGSyncParameters = cmd.LEBIGCreateSync
+	ISODataPath       = cmd.LESetupISODataPath
+)
+
+// ISO data path directions.
+const (
+	ISODataPathInput  = 0x00 // Host to Controller
+	ISODataPathOutput = 0x01 // Controller to Host
+)
+
+// Packet boundary flags of an ISO data packet.
+const (
+	ISOFirstFragment = 0x00
+	ISOContinuation  = 0x01
+	ISOCompleteSDU   = 0x02
+	ISOLastFragment  = 0x03
+)
+
+const (
+	isoLEEventMask      = 0x3F << 24 // LE subevents 0x19 - 0x1E
+	isoTimeout          = 5 * time.Second
+	isoDataLoadHdrLen   = 4
+	isoRejectLimitedRes = 0x0D // Connection Rejected due to Limited Resources
+)
+
+var errISONotEnabled = fmt.Errorf("iso: not enabled, or %w by the controller", hci.ErrUnsupported)
+
+// ISOPacket is a single HCI ISO data packet. Fragments of an SDU are
+// delivered as they arrive; Seq, SDULength and Status are only valid for
+// the first fragment or a complete SDU.
+type ISOPacket struct {
+	Handle    uint16
+	PB        uint8
+	HasTS     bool
+	Timestamp uint32
+	Seq       uint16
+	SDULength uint16
+	Status    uint8
+	Data      []byte
+}
+
+func (p *ISOPacket) Unmarshal(b []byte) error {
+	if len(b) < 4 {
+		return fmt.Errorf("%w iso packet", hci.ErrMalformed)
+	}
+	hdr := uint16(b[0]) | uint16(b[1])<<8
+	dlen := int(uint16(b[2])|uint16(b[3])<<8) & 0x3fff
+	if len(b) != 4+dlen {
+		return fmt.Errorf("%w iso packet", hci.ErrMalformed)
+	}
+	*p = ISOPacket{
+		Handle: hdr & 0x0fff,
+		PB:     uint8(hdr>>12) & 0x3,
+		HasTS:  hdr&(1<<14) != 0,
+	}
+	b = b[4:]
+	if p.HasTS {
+		if len(b) < 4 {
+			return fmt.Errorf("%w iso packet", hci.ErrMalformed)
+		}
+		p.Timestamp = binary.LittleEndian.Uint32(b)
+		b = b[4:]
+	}
+	if p.PB == ISOFirstFragment || p.PB == ISOCompleteSDU {
+		if len(b) < isoDataLoadHdrLen {
+			return fmt.Errorf("%w iso packet", hci.ErrMalformed)
+		}
+		p.Seq = uint16(b[0]) | uint16(b[1])<<8
+		l := uint16(b[2]) | uint16(b[3])<<8
+		p.SDULength, p.Status = l&0x0fff, uint8(l>>14)
+		b = b[isoDataLoadHdrLen:]
+	}
+	p.Data = b
+	return nil
+}
+
+func (p *ISOPacket) String() string {
+	return fmt.Sprintf("ISO Data: handle %d pb %d seq %d dlen %d", p.Handle, p.PB, p.Seq, len(p.Data))
+}
+
+// An ISOHandler handles the ISO data packets received from the controller.
+type ISOHandler interface {
+	HandleISO(p *ISOPacket)
+}
+
+// The ISOHandlerFunc type is an adapter to allow the use of ordinary
+// functions as ISOHandlers.
+type ISOHandlerFunc func(p *ISOPacket)
+
+func (f ISOHandlerFunc) HandleISO(p *ISOPacket) { f(p) }
+
+type isoState struct {
+	mu       sync.Mutex
+	handler  ISOHandler
+	onCISReq func(acl, cis uint16) bool
+	bufSize  int
+	bufCnt   chan struct{}
+	handles  map[uint16]bool
+	cis      map[uint16]chan *event.LECISEstablishedEP
+	big      map[uint8]chan *event.LECreateBIGCompleteEP
+	bigSync  map[uint8]chan *event.LEBIGSyncEstablishedEP
+	handlesC map[uint8][]uint16 // handles of each CIG or BIG
+}
+
+func newISOState() *isoState {
+	return &isoState{
+		handles:  map[uint16]bool{},
+		cis:      map[uint16]chan *event.LECISEstablishedEP{},
+		big:      map[uint8]chan *event.LECreateBIGCompleteEP{},
+		bigSync:  map[uint8]chan *event.LEBIGSyncEstablishedEP{},
+		handlesC: map[uint8][]uint16{},
+	}
+}
+
+func (s *isoState) isISO(h uint16) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.handles[h]
+}
+
+func (s *isoState) addHandles(h []uint16) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, hh := range h {
+		s.handles[hh] = true
+	}
+}
+
+func (s *isoState) removeHandles(h []uint16) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, hh := range h {
+		delete(s.handles, hh)
+	}
+}
+
+// EnableISO reads the ISO buffer size of the controller and unmasks the
+// isochronous LE events; if the controller supports CISes, it also sets
+// their host support, see SetHostFeature. It must be called, after Start,
+// before any other ISO call, and before any connection is established.
+func (h HCI) EnableISO() error {
+	b, err := h.cmd.Send(cmd.LEReadBufferSizeV2{})
+	if err != nil {
+		return err
+	}
+	rp := cmd.LEReadBufferSizeV2RP{}
+	if err := binary.Read(bytes.NewBuffer(b), binary.LittleEndian, &rp); err != nil {
+		return err
+	}
+	if rp.Status != 0x00 {
+		return cmd.ErrCommandFailed{Opcode: cmd.LEReadBufferSizeV2{}.Opcode(), Status: rp.Status}
+	}
+	if rp.ISODataPacketLength == 0 || rp.TotalNumISODataPackets == 0 {
+		return errISONotEnabled
+	}
+	if h.Capabilities().LEFeatures&(leCISCentral|leCISPeripheral) != 0 {
+		if err := h.SetHostFeature(HostFeatureCIS, true); err != nil {
+			return err
+		}
+	}
+	if err := h.unmaskLE(isoLEEventMask); err != nil {
+		return err
+	}
+	h.iso.mu.Lock()
+	defer h.iso.mu.Unlock()
+	h.iso.bufSize = int(rp.ISODataPacketLength)
+	h.iso.bufCnt = make(chan struct{}, rp.TotalNumISODataPackets)
+	return nil
+}
+
+// HandleISO registers the handler of the incoming ISO data packets.
+func (h HCI) HandleISO(f ISOHandler) {
+	h.iso.mu.Lock()
+	defer h.iso.mu.Unlock()
+	h.iso.handler = f
+}
+
+// HandleCISRequest registers a function deciding whether a CIS requested
+// by a remote central is accepted. Without one, requests are rejected.
+func (h HCI) HandleCISRequest(f func(acl, cis uint16) bool) {
+	h.iso.mu.Lock()
+	defer h.iso.mu.Unlock()
+	h.iso.onCISReq = f
+}
+
+// SetCIGParameters creates or reconfigures a CIG, and returns the
+// connection handles assigned to its CISes.
+func (h HCI) SetCIGParameters(p CIGParameters) ([]uint16, error) {
+	if err := checkCIG(p); err != nil {
+		return nil, err
+	}
+	b, err := h.cmd.Send(p)
+	if err != nil {
+		return nil, err
+	}
+	rp := cmd.LESetCIGParametersRP{}
+	if err := rp.Unmarshal(b); err != nil {
+		return nil, err
+	}
+	if rp.Status != 0x00 {
+		return nil, cmd.ErrCommandFailed{Opcode: p.Opcode(), Status: rp.Status}
+	}
+	h.iso.addHandles(rp.ConnectionHandles)
+	h.iso.mu.Lock()
+	h.iso.handlesC[p.CIGID] = rp.ConnectionHandles
+	h.iso.mu.Unlock()
+	return rp.ConnectionHandles, nil
+}
+
+// RemoveCIG removes a CIG whose CISes are all disconnected.
+func (h HCI) RemoveCIG(id uint8) error {
+	if err := h.cmd.SendAndCheckResp(cmd.LERemoveCIG{CIGID: id}, expSuccess); err != nil {
+		return err
+	}
+	h.iso.releaseGroup(id)
+	return nil
+}
+
+// CreateCIS establishes the CISes, each over its paired ACL connection,
+// and waits until all of them are established.
+func (h HCI) CreateCIS(cis, acl []uint16) error {
+	if len(cis) != len(acl) {
+		return errors.New("iso: CIS and ACL handles are not paired")
+	}
+	cs := make([]chan *event.LECISEstablishedEP, len(cis))
+	h.iso.mu.Lock()
+	for i, hh := range cis {
+		cs[i] = make(chan *event.LECISEstablishedEP, 1)
+		h.iso.cis[hh] = cs[i]
+	}
+	h.iso.mu.Unlock()
+	defer func() {
+		h.iso.mu.Lock()
+		defer h.iso.mu.Unlock()
+		for _, hh := range cis {
+			delete(h.iso.cis, hh)
+		}
+	}()
+
+	err := h.cmd.SendAndCheckResp(cmd.LECreateCIS{CISConnectionHandle: cis, ACLConnectionHandle: acl}, expSuccess)
+	if err != nil {
+		return err
+	}
+	for i, c := range cs {
+		select {
+		case ep := <-c:
+			if ep.Status != 0x00 {
+				return fmt.Errorf("iso: CIS 0x%04X: %w", cis[i], cmd.ErrCommandFailed{Opcode: cmd.LECreateCIS{}.Opcode(), Status: ep.Status})
+			}
+		case <-time.After(isoTimeout):
+			return fmt.Errorf("iso: CIS 0x%04X timed out", cis[i])
+		}
+	}
+	return nil
+}
+
+// CreateBIG creates a BIG on an advertising set, and returns the
+// connection handles of its BISes.
+func (h HCI) CreateBIG(p BIGParameters) ([]uint16, error) {
+	if err := checkBIG(p); err != nil {
+		return nil, err
+	}
+	c := make(chan *event.LECreateBIGCompleteEP, 1)
+	h.iso.mu.Lock()
+	h.iso.big[p.BIGHandle] = c
+	h.iso.mu.Unlock()
+	defer func() {
+		h.iso.mu.Lock()
+		defer h.iso.mu.Unlock()
+		delete(h.iso.big, p.BIGHandle)
+	}()
+
+	if err := h.cmd.SendAndCheckResp(p, expSuccess); err != nil {
+		return nil, err
+	}
+	select {
+	case ep := <-c:
+		if ep.Status != 0x00 {
+			return nil, cmd.ErrCommandFailed{Opcode: p.Opcode(), Status: ep.Status}
+		}
+		h.iso.addHandles(ep.ConnectionHandles)
+		h.iso.mu.Lock()
+		h.iso.handlesC[p.BIGHandle] = ep.ConnectionHandles
+		h.iso.mu.Unlock()
+		return ep.ConnectionHandles, nil
+	case <-time.After(isoTimeout):
+		return nil, errors.New("iso: create BIG timed out")
+	}
+}
+
+// TerminateBIG terminates a BIG created by CreateBIG.
+func (h HCI) TerminateBIG(big uint8) error {
+	// Completion is reported by the LE Terminate BIG Complete event, which
+	// carries nothing the caller needs to wait for.
+	if err := h.cmd.SendAndCheckResp(cmd.LETerminateBIG{BIGHandle: big, Reason: 0x16}, expSuccess); err != nil {
+		return err
+	}
+	h.iso.releaseGroup(big)
+	return nil
+}
+
+// BIGCreateSync synchronizes to a BIG, and returns the connection handles
+// of the BISes it has synchronized to.
+func (h HCI) BIGCreateSync(p BIGSyncParameters) ([]uint16, error) {
+	c := make(chan *event.LEBIGSyncEstablishedEP, 1)
+	h.iso.mu.Lock()
+	h.iso.bigSync[p.BIGHandle] = c
+	h.iso.mu.Unlock()
+	defer func() {
+		h.iso.mu.Lock()
+		defer h.iso.mu.Unlock()
+		delete(h.iso.bigSync, p.BIGHandle)
+	}()
+
+	if err := h.cmd.SendAndCheckResp(p, expSuccess); err != nil {
+		return nil, err
+	}
+	select {
+	case ep := <-c:
+		if ep.Status != 0x00 {
+			return nil, cmd.ErrCommandFailed{Opcode: p.Opcode(), Status: ep.Status}
+		}
+		h.iso.addHandles(ep.ConnectionHandles)
+		h.iso.mu.Lock()
+		h.iso.handlesC[p.BIGHandle] = ep.ConnectionHandles
+		h.iso.mu.Unlock()
+		return ep.ConnectionHandles, nil
+	case <-time.After(isoTimeout):
+		return nil, errors.New("iso: BIG sync timed out")
+	}
+}
+
+// BIGTerminateSync stops synchronizing to a BIG.
+func (h HCI) BIGTerminateSync(big uint8) error {
+	if err := h.cmd.SendAndCheckResp(cmd.LEBIGTerminateSync{BIGHandle: big}, expSuccess); err != nil {
+		return err
+	}
+	h.iso.releaseGroup(big)
+	return nil
+}
+
+// SetupISODataPath sets up the data path of a CIS or BIS.
+func (h HCI) SetupISODataPath(p ISODataPath) error {
+	return h.cmd.SendAndCheckResp(p, expSuccess)
+}
+
+// RemoveISODataPath removes the data paths of a CIS or BIS. The direction
+// is a bit mask: bit 0 for input, bit 1 for output.
+func (h HCI) RemoveISODataPath(handle uint16, dir uint8) error {
+	return h.cmd.SendAndCheckResp(cmd.LERemoveISODataPath{ConnectionHandle: handle, DataPathDirection: dir}, expSuccess)
+}
+
+// WriteISO sends an SDU over a CIS or BIS. The SDU is fragmented if it
+// is larger than the ISO buffer size of the controller. It waits for the
+// controller to free a buffer for each fragment, and fails with
+// ErrClosed once the HCI is closed.
+func (h HCI) WriteISO(handle, seq uint16, sdu []byte) error {
+	h.iso.mu.Lock()
+	size, cnt := h.iso.bufSize, h.iso.bufCnt
+	h.iso.mu.Unlock()
+	if cnt == nil {
+		return errISONotEnabled
+	}
+	if len(sdu) > 0x0fff {
+		return fmt.Errorf("iso: SDU too long (%d bytes)", len(sdu))
+	}
+
+	// The data load header (sequence number and SDU length) precedes the
+	// SDU, and is carried by the first fragment.
+	d := append([]byte{uint8(seq), uint8(seq >> 8), uint8(len(sdu)), uint8(len(sdu) >> 8)}, sdu...)
+	for first := true; first || len(d) > 0; first = false {
+		dlen := len(d)
+		if dlen > size {
+			dlen = size
+		}
+		var pb uint16
+		switch last := dlen == len(d); {
+		case first && last:
+			pb = ISOCompleteSDU
+		case first:
+			pb = ISOFirstFragment
+		case last:
+			pb = ISOLastFragment
+		default:
+			pb = ISOContinuation
+		}
+		hdr := handle&0x0fff | pb<<12
+		w := append([]byte{
+			byte(ptypeISODataPkt),
+			uint8(hdr), uint8(hdr >> 8),
+			uint8(dlen), uint8(dlen >> 8),
+		}, d[:dlen]...)
+
+		// make sure we don't send more buffers than the controller can handdle
+		select {
+		case cnt <- struct{}{}:
+		case <-h.readDone:
+			return fmt.Errorf("iso: write: %w", ErrClosed)
+		}
+
+		if _, err := h.out.Write(w); err != nil {
+			return err
+		}
+		d = d[dlen:]
+	}
+	return nil
+}
+
+func (s *isoState) releaseGroup(id uint8) {
+	s.mu.Lock()
+	hs := s.handlesC[id]
+	delete(s.handlesC, id)
+	s.mu.Unlock()
+	s.removeHandles(hs)
+}
+
+func (s *isoState) releaseBuffers(n int) {
+	s.mu.Lock()
+	cnt := s.bufCnt
+	s.mu.Unlock()
+	for i := 0; i < n && cnt != nil; i++ {
+		select {
+		case <-cnt:
+		default:
+			return
+		}
+	}
+}
+
+func (h HCI) handleISO(b []byte) error {
+	p := &ISOPacket{}
+	if err := p.Unmarshal(b); err != nil {
+		return err
+	}
+	h.iso.mu.Lock()
+	f := h.iso.handler
+	h.iso.mu.Unlock()
+	if f != nil {
+		h.call("iso", func() { f.HandleISO(p) })
+	}
+	return nil
+}
+
+// handleLEMeta takes the isochronous, periodic advertising and power
+// control LE subevents, and the LTK requests, and hands the rest to the
+// L2CAP.
+func (h HCI) handleLEMeta(b []byte) error {
+	if len(b) == 0 {
+		return fmt.Errorf("%w LE meta event", hci.ErrMalformed)
+	}
+	switch event.LEEventCode(b[0]) {
+	case event.LECISEstablished:
+		ep := &event.LECISEstablishedEP{}
+		if err := ep.Unmarshal(b); err != nil {
+			return err
+		}
+		h.iso.mu.Lock()
+		c := h.iso.cis[ep.ConnectionHandle]
+		h.iso.mu.Unlock()
+		if c != nil {
+			c <- ep
+		}
+	case event.LECISRequest:
+		ep := &event.LECISRequestEP{}
+		if err := ep.Unmarshal(b); err != nil {
+			return err
+		}
+		h.iso.mu.Lock()
+		f := h.iso.onCISReq
+		h.iso.mu.Unlock()
+		accept := false
+		if f != nil {
+			h.call("CIS request", func() { accept = f(ep.ACLConnectionHandle, ep.CISConnectionHandle) })
+		}
+		if !accept {
+			_, err := h.cmd.Send(cmd.LERejectCISRequest{ConnectionHandle: ep.CISConnectionHandle, Reason: isoRejectLimitedRes})
+			return err
+		}
+		h.iso.addHandles([]uint16{ep.CISConnectionHandle})
+		return h.cmd.SendAndCheckResp(cmd.LEAcceptCISRequest{ConnectionHandle: ep.CISConnectionHandle}, expSuccess)
+	case event.LECreateBIGComplete:
+		ep := &event.LECreateBIGCompleteEP{}
+		if err := ep.Unmarshal(b); err != nil {
+			return err
+		}
+		h.iso.mu.Lock()
+		c := h.iso.big[ep.BIGHandle]
+		h.iso.mu.Unlock()
+		if c != nil {
+			c <- ep
+		}
+	case event.LEBIGSyncEstablished:
+		ep := &event.LEBIGSyncEstablishedEP{}
+		if err := ep.Unmarshal(b); err != nil {
+			return err
+		}
+		h.iso.mu.Lock()
+		c := h.iso.bigSync[ep.BIGHandle]
+		h.iso.mu.Unlock()
+		if c != nil {
+			c <- ep
+		}
+	case event.LEBIGSyncLost:
+		ep := &event.LEBIGSyncLostEP{}
+		if err := ep.Unmarshal(b); err != nil {
+			return err
+		}
+		h.iso.releaseGroup(ep.BIGHandle)
+	case event.LETerminateBIGComplete:
+	case event.LEPathLossThreshold:
+		return h.handlePathLoss(b)
+	case event.LETransmitPowerReporting:
+		return h.handleTxPowerReport(b)
+	case event.LELTKRequest:
+		return h.handleLTKRequest(b)
+	case event.LEPeriodicAdvertisingSyncEstablished, event.LEPeriodicAdvertisingReport, event.LEPeriodicAdvertisingSyncLost:
+		return h.handlePeriodic(b)
+	case event.LEConnectionComplete:
+		if err := h.l2c.HandleLEMeta(b); err != nil {
+			return err
+		}
+		// A connection initiated completes as the central, or fails,
+		// e.g. once canceled; the directed advertising timing out fails
+		// as the peripheral.
+		if len(b) > 4 && (b[1] != 0x00 && b[1] != statusAdvTimeout || b[4] == 0x00) {
+			h.initiated(b[1])
+		}
+	default:
+		if r, ok := h.ranger.ranger(b[0]); ok {
+			return h.handleRanging(r, b)
+		}
+		return h.l2c.HandleLEMeta(b)
+	}
+	return nil
+}
+
+// handleNumberOfCompletedPkts returns the buffers of ISO handles to the
+// ISO credits, and the rest to the L2CAP.
+func (h HCI) handleNumberOfCompletedPkts(b []byte) error {
+	ep := &event.NumberOfCompletedPktsEP{}
+	if err := ep.Unmarshal(b); err != nil {
+		return err
+	}
+	for _, r := range ep.Packets {
+		if h.iso.isISO(r.ConnectionHandle) {
+			h.iso.releaseBuffers(int(r.NumOfCompletedPkts))
+			continue
+		}
+		h.l2c.ReleaseBuffers(r.ConnectionHandle, int(r.NumOfCompletedPkts))
+	}
+	return nil
+}
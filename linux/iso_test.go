@@ -0,0 +1,169 @@
+package linux
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/paypal/gatt/linux/internal/cmd"
+	"github.com/paypal/gatt/linux/internal/hci"
+)
+
+func TestISOPacketUnmarshal(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		b    []byte
+		want ISOPacket
+		err  error
+	}{
+		{
+			name: "complete SDU",
+			b:    []byte{0x60, 0x20, 0x07, 0x00, 0x05, 0x00, 0x03, 0x00, 'i', 's', 'o'},
+			want: ISOPacket{Handle: 0x060, PB: ISOCompleteSDU, Seq: 5, SDULength: 3, Data: []byte("iso")},
+		},
+		{
+			name: "first fragment, timestamped, invalid",
+			b:    []byte{0x60, 0x40, 0x0A, 0x00, 0x78, 0x56, 0x34, 0x12, 0x05, 0x00, 0x08, 0x40, 'i', 's'},
+			want: ISOPacket{Handle: 0x060, PB: ISOFirstFragment, HasTS: true, Timestamp: 0x12345678, Seq: 5, SDULength: 8, Status: 1, Data: []byte("is")},
+		},
+		{
+			name: "continuation",
+			b:    []byte{0x60, 0x10, 0x02, 0x00, 'o', ' '},
+			want: ISOPacket{Handle: 0x060, PB: ISOContinuation, Data: []byte("o ")},
+		},
+		{
+			name: "last fragment",
+			b:    []byte{0x60, 0x30, 0x01, 0x00, '!'},
+			want: ISOPacket{Handle: 0x060, PB: ISOLastFragment, Data: []byte("!")},
+		},
+		{name: "short header", b: []byte{0x60, 0x20, 0x00}, err: hci.ErrMalformed},
+		{name: "length mismatch", b: []byte{0x60, 0x10, 0x03, 0x00, 'i', 's'}, err: hci.ErrMalformed},
+		{name: "truncated timestamp", b: []byte{0x60, 0x50, 0x02, 0x00, 0x78, 0x56}, err: hci.ErrMalformed},
+		{name: "no data load header", b: []byte{0x60, 0x20, 0x02, 0x00, 0x05, 0x00}, err: hci.ErrMalformed},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var p ISOPacket
+			err := p.Unmarshal(tt.b)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Unmarshal = %v, want %v", err, tt.err)
+			}
+			if tt.err == nil && !reflect.DeepEqual(p, tt.want) {
+				t.Errorf("Unmarshal = %+v, want %+v", p, tt.want)
+			}
+		})
+	}
+}
+
+// newISOTest returns an HCI of ISO enabled, the controller having n ISO
+// buffers of size bytes.
+func newISOTest(t *testing.T, size uint16, n uint8) (*HCI, *fakeDevice) {
+	h, d := newTestHCI(new(uint64))
+	d.mu.Lock()
+	d.rsp = map[cmd.Opcode][]byte{cmd.LEReadBufferSizeV2{}.Opcode(): {0xFB, 0x00, 0x08, byte(size), byte(size >> 8), n}}
+	d.mu.Unlock()
+	if err := h.EnableISO(); err != nil {
+		t.Fatal(err)
+	}
+	return h, d
+}
+
+func TestWriteISO(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		size uint16 // of the ISO buffers
+		sdu  string
+		want [][]byte
+	}{
+		{
+			name: "complete",
+			size: 64,
+			sdu:  "iso",
+			want: [][]byte{{0x60, 0x20, 0x07, 0x00, 0x05, 0x00, 0x03, 0x00, 'i', 's', 'o'}},
+		},
+		{
+			name: "fragmented",
+			size: 6,
+			sdu:  "isochronous",
+			want: [][]byte{
+				{0x60, 0x00, 0x06, 0x00, 0x05, 0x00, 0x0B, 0x00, 'i', 's'},
+				{0x60, 0x10, 0x06, 0x00, 'o', 'c', 'h', 'r', 'o', 'n'},
+				{0x60, 0x30, 0x03, 0x00, 'o', 'u', 's'},
+			},
+		},
+		{
+			name: "filling a buffer",
+			size: 6,
+			sdu:  "ab",
+			want: [][]byte{{0x60, 0x20, 0x06, 0x00, 0x05, 0x00, 0x02, 0x00, 'a', 'b'}},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			h, d := newISOTest(t, tt.size, 8)
+			defer h.Close()
+			if err := h.WriteISO(0x0060, 5, []byte(tt.sdu)); err != nil {
+				t.Fatal(err)
+			}
+			if got := d.sentISO(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sent\n\t% X\nwant\n\t% X", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteISOCredits(t *testing.T) {
+	h, d := newISOTest(t, 64, 2)
+	defer h.Close()
+	h.iso.addHandles([]uint16{0x0060})
+	for i := 0; i < 2; i++ {
+		if err := h.WriteISO(0x0060, uint16(i), []byte("iso")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	done := make(chan error, 1)
+	go func() { done <- h.WriteISO(0x0060, 2, []byte("iso")) }()
+	select {
+	case err := <-done:
+		t.Fatalf("WriteISO with no buffer left = %v, want it to wait", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// The buffers of an ACL connection are not those of the ISO data.
+	d.rc <- []byte{0x04, 0x13, 0x05, 0x01, 0x40, 0x00, 0x01, 0x00}
+	select {
+	case err := <-done:
+		t.Fatalf("WriteISO after the ACL buffers completed = %v, want it to wait", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	d.rc <- []byte{0x04, 0x13, 0x05, 0x01, 0x60, 0x00, 0x01, 0x00} // Number Of Completed Packets
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("WriteISO not done once a buffer completed")
+	}
+	if got := d.sentISO(); len(got) != 3 || !bytes.Equal(got[2][4:6], []byte{0x02, 0x00}) {
+		t.Errorf("sent % X, want 3 SDUs", got)
+	}
+}
+
+func TestWriteISOClosed(t *testing.T) {
+	h, _ := newISOTest(t, 64, 1)
+	if err := h.WriteISO(0x0060, 0, []byte("iso")); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- h.WriteISO(0x0060, 1, []byte("iso")) }()
+	h.Close()
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrClosed) {
+			t.Errorf("WriteISO = %v, want ErrClosed", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("WriteISO still waiting for a buffer once closed")
+	}
+}
@@ -1,13 +1,21 @@
 package linux
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"runtime/pprof"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/paypal/gatt/linux/internal/cmd"
 	"github.com/paypal/gatt/linux/internal/device"
 	"github.com/paypal/gatt/linux/internal/event"
+	"github.com/paypal/gatt/linux/internal/hci"
 	"github.com/paypal/gatt/linux/internal/l2cap"
 )
 
@@ -19,111 +27,497 @@ const (
 	ptypeACLDataPkt            = 0X02
 	ptypeSCODataPkt            = 0X03
 	ptypeEventPkt              = 0X04
+	ptypeISODataPkt            = 0X05
 	ptypeVendorPkt             = 0XFF
 )
 
 type HCI struct {
 	dev    io.ReadWriteCloser
+	out    io.Writer // dev, as written to, captured if snooping
+	snoop  *snooper  // nil unless snooping
 	logger *log.Logger
 	cmd    *cmd.Cmd
 	evt    *event.Event
 	l2c    *l2cap.L2CAP
+	iso    *isoState
+	sco    *scoState
+	power  *powerState
+	masks  *eventMasks
+	disp   *dispatcher
+	scan   *advRing
+	roles  *roles
+	caps   *capsState
+	vendor *vendorState
+	accept *acceptList
+	ranger *rangingState
+	period *periodicState
+
+	inquiry       *inquiryState
+	shutdownHooks *shutdownHooks
+
+	malformed *uint64 // packets dropped as malformed, updated atomically
+
+	closing  *closeState
+	readDone chan struct{} // closed once mainLoop has returned
+
+	rbufSize int
+	rbatch   int
+
+	resetSeq     []cmdSeq
+	scanInterval uint16
+	scanWindow   uint16
+	advOpts      []Option
+	ltk          func(handle uint16, rand uint64, ediv uint16) (ltk [16]byte, ok bool)
+	errf         func(err error)
+	dataLength   int
+	patchram     string
 }
 
 func (h HCI) Cmd() *cmd.Cmd       { return h.cmd }
 func (h HCI) Event() *event.Event { return h.evt }
 func (h HCI) L2CAP() *l2cap.L2CAP { return h.l2c }
 
+// NewHCI opens an HCI device, selected automatically, and returns nil if
+// none can be opened. It is a shorthand for
+//
+//	OpenHCI(Logger(l), MaxConnections(maxConn))
 func NewHCI(l *log.Logger, maxConn int) *HCI {
-	d, err := device.NewSocket(1)
+	h, _ := OpenHCI(Logger(l), MaxConnections(maxConn))
+	return h
+}
+
+// OpenHCI opens an HCI device, configured with the options specified.
+func OpenHCI(opts ...HCIOption) (*HCI, error) {
+	c := defaultHCIConfig()
+	for _, opt := range opts {
+		opt(&c)
+	}
+	if err := c.check(); err != nil {
+		return nil, err
+	}
+	if c.transport != nil {
+		return newHCI(c.transport, c), nil
+	}
+	if c.uart != "" {
+		d, err := device.NewUART(c.uart, c.baud, c.flow)
+		if err != nil {
+			return nil, err
+		}
+		return newHCI(newH4(d), c), nil
+	}
+	if c.addr != ([6]byte{}) {
+		id, err := selectAdapter(c.addr)
+		if err != nil {
+			return nil, err
+		}
+		c.id = id
+	}
+	if c.id >= 0 {
+		d, err := device.NewSocket(c.id, c.down)
+		if errors.Is(err, syscall.ENODEV) {
+			return nil, noAdapter(fmt.Sprintf("hci%d", c.id))
+		}
+		if err != nil {
+			return nil, err
+		}
+		return newHCI(d, c), nil
+	}
+	d, err := device.NewSocket(1, c.down)
 	if err != nil {
-		d, err = device.NewSocket(0)
+		d, err = device.NewSocket(0, c.down)
+		if errors.Is(err, syscall.ENODEV) {
+			return nil, noAdapter("hci1, nor hci0")
+		}
 		if err != nil {
-			return nil
+			return nil, err
 		}
 	}
-	c := cmd.NewCmd(d, l)
-	l2c := l2cap.NewL2CAP(c, d, l, maxConn)
+	return newHCI(d, c), nil
+}
+
+// newHCI sets up the layers on top of d, which is either an HCI socket, a
+// tty framed by h4, or, in tests, a fake device.
+func newHCI(d io.ReadWriteCloser, cfg hciConfig) *HCI {
+	l := cfg.logger
+	var out io.ReadWriter = d
+	var s *snooper
+	if cfg.snoop != nil {
+		s = &snooper{w: cfg.snoop}
+		out = snoopWriter{d, s}
+	}
+	c := cmd.NewCmd(out, l)
+	l2c := l2cap.NewL2CAP(c, out, l, cfg.maxConn)
 	e := event.NewEvent(l)
 	h := &HCI{
-		dev: d,
-		cmd: c,
-		evt: e,
-		l2c: l2c,
+		dev:    d,
+		out:    out,
+		snoop:  s,
+		logger: l,
+		cmd:    c,
+		evt:    e,
+		l2c:    l2c,
+		iso:    newISOState(),
+		sco:    &scoState{},
+		power:  newPowerState(),
+		masks:  &eventMasks{bits: defaultEventMask, le: defaultLEEventMask, extra: cfg.events, leExtra: cfg.leEvents},
+		scan:   newAdvRing(),
+		roles:  &roles{conns: l2c.Roles},
+		caps:   &capsState{},
+		vendor: &vendorState{},
+		accept: &acceptList{},
+		ranger: newRangingState(),
+		period: newPeriodicState(),
+
+		inquiry:       newInquiryState(),
+		shutdownHooks: &shutdownHooks{},
+
+		malformed: new(uint64),
+
+		closing:  &closeState{done: make(chan struct{})},
+		readDone: make(chan struct{}),
+
+		rbufSize: cfg.rbufSize,
+		rbatch:   cfg.rbatch,
+
+		resetSeq:     cfg.resetSeq,
+		scanInterval: cfg.scanInterval,
+		scanWindow:   cfg.scanWindow,
+		advOpts:      cfg.advOpts,
+		ltk:          cfg.ltk,
+		errf:         cfg.errf,
+		dataLength:   cfg.dataLength,
+		patchram:     cfg.patchram,
+	}
+	h.disp = newDispatcher(cfg.dispatch.workers(), h.handle)
+	l2c.Release = releasePacket
+	if s != nil {
+		s.report = h.report
 	}
 
-	e.HandleEvent(event.LEMeta, event.HandlerFunc(l2c.HandleLEMeta))
-	e.HandleEvent(event.DisconnectionComplete, event.HandlerFunc(l2c.HandleDisconnectionComplete))
-	e.HandleEvent(event.NumberOfCompletedPkts, event.HandlerFunc(l2c.HandleNumberOfCompletedPkts))
+	e.HandleEvent(event.LEMeta, event.HandlerFunc(h.handleLEMeta))
+	e.HandleEvent(event.DisconnectionComplete, event.HandlerFunc(h.handleDisconnectionComplete))
+	e.HandleEvent(event.EncryptionChange, event.HandlerFunc(l2c.HandleEncryptionChange))
+	e.HandleEvent(event.NumberOfCompletedPkts, event.HandlerFunc(h.handleNumberOfCompletedPkts))
 	e.HandleEvent(event.CommandComplete, event.HandlerFunc(c.HandleComplete))
 	e.HandleEvent(event.CommandStatus, event.HandlerFunc(c.HandleStatus))
+	e.HandleEvent(event.VendorSpecific, event.HandlerFunc(h.handleVendorEvent))
+	e.HandleEvent(event.InquiryComplete, event.HandlerFunc(h.handleInquiryComplete))
+	e.HandleEvent(event.InquiryResult, event.HandlerFunc(h.handleInquiryResult((*event.InquiryResultEP).Unmarshal)))
+	e.HandleEvent(event.InquiryResultWithRssi, event.HandlerFunc(h.handleInquiryResult((*event.InquiryResultEP).UnmarshalWithRSSI)))
+	e.HandleEvent(event.ExtendedInquiryResult, event.HandlerFunc(h.handleInquiryResult((*event.InquiryResultEP).UnmarshalExtended)))
+	e.HandleEvent(event.RemoteNameReqComplete, event.HandlerFunc(h.handleRemoteNameComplete))
 
 	return h
 }
 
+// SetSpanHook sets a function called as each HCI command is sent; the
+// function it returns is called once the command completes, with the
+// error it failed with, if any. The span of a command is named after it,
+// and the correlation ID its log lines carry, e.g. "hci: Reset #1". It
+// must be set before Start.
+func (h HCI) SetSpanHook(f func(name string) (end func(err error))) {
+	h.cmd.SetSpanHook(f)
+}
+
+// closeTimeout bounds how long Close waits for the HCI to shut down.
+const closeTimeout = 5 * time.Second
+
+// closeState is the outcome of the shutdown of an HCI, shared by its
+// copies.
+type closeState struct {
+	reading int32 // set once mainLoop is started, or can no longer be
+	readErr error // mainLoop returned with, set before readDone is closed
+	once    sync.Once
+	done    chan struct{} // closed once shut down
+	err     error
+}
+
+// Close shuts the HCI down, like Shutdown, waiting for up to 5 seconds.
 func (h HCI) Close() error {
-	return h.dev.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+	defer cancel()
+	return h.Shutdown(ctx)
+}
+
+// Shutdown stops scanning and advertising, refuses new connections,
+// drains the PDUs queued, disconnects the connections, stops the L2CAP,
+// and the commands, and closes the device, in that order; see
+// ShutdownStage, and OnShutdown to take part in it. It returns once the
+// packets queued have been written, the commands pending have failed with ErrClosed, and all the
+// goroutines of the HCI have returned, or once ctx is done, in which
+// case it returns ctx.Err().
+//
+// Should the controller stop responding, the connections are dropped
+// without waiting for it when ctx is done; some goroutines may then
+// still be running as Shutdown returns.
+//
+// Shutdown may be called more than once; later calls wait for the first
+// one to complete, and return the same error.
+func (h HCI) Shutdown(ctx context.Context) error {
+	cs := h.closing
+	cs.once.Do(func() {
+		go func() {
+			cs.err = h.shutdown(ctx)
+			close(cs.done)
+		}()
+	})
+	select {
+	case <-cs.done:
+		return cs.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (h HCI) shutdown(ctx context.Context) error {
+	// Leave the controller idle, while it still listens: once reading
+	// has failed, none of its answers could be read.
+	idle := make(chan struct{})
+	go func() {
+		defer close(idle)
+		select {
+		case <-h.readDone:
+			return
+		default:
+		}
+		for _, s := range []struct {
+			stage ShutdownStage
+			f     func()
+		}{
+			{StopRadio, func() {
+				if h.scan.isEnabled() || h.roles.isScanning() {
+					h.StopScan()
+				}
+				h.l2c.StopAdvertising()
+			}},
+			{RefuseConns, h.l2c.Refuse},
+			{DrainATT, func() { h.l2c.Drain(ctx) }},
+			{DisconnectLinks, func() { h.l2c.Disconnect(ctx) }},
+		} {
+			if ctx.Err() != nil {
+				return
+			}
+			h.reach(ctx, s.stage)
+			s.f()
+		}
+	}()
+	select {
+	case <-idle:
+	case <-ctx.Done():
+	}
+
+	// Then tear the layers down, from the top.
+	h.reach(ctx, StopL2CAP)
+	h.l2c.Close()
+	h.reach(ctx, StopCmds)
+	h.cmd.Close()
+	h.reach(ctx, CloseDevice)
+	err := h.dev.Close()
+	if atomic.CompareAndSwapInt32(&h.closing.reading, 0, 1) {
+		// Never started; clean up after mainLoop in its place.
+		h.scan.close()
+		h.disp.stop()
+		close(h.readDone)
+	}
+	for _, done := range []chan struct{}{h.readDone, h.disp.done, idle} {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return err
+}
+
+// Done returns a channel closed once the HCI stops reading from the
+// device: once shut down, or once the device fails, e.g. as its USB
+// dongle is unplugged.
+func (h HCI) Done() <-chan struct{} { return h.readDone }
+
+// Err returns the error reading from the device failed with, once Done
+// is closed, and nil before.
+func (h HCI) Err() error {
+	select {
+	case <-h.readDone:
+		return h.closing.readErr
+	default:
+		return nil
+	}
 }
 
 func (h HCI) Start() error {
-	go h.mainLoop()
-	return h.ResetDevice()
+	return h.StartCtx(context.Background())
 }
 
+// StartCtx starts the HCI, like Start, giving up on resetting the device
+// once ctx is done, e.g. as the controller is stuck; it then returns
+// ctx.Err(), and the HCI is to be closed. The patch of the Patchram
+// option, if any, is downloaded first.
+func (h HCI) StartCtx(ctx context.Context) error {
+	h.startReading()
+	if h.patchram != "" {
+		if err := h.loadPatchram(ctx, h.patchram); err != nil {
+			return err
+		}
+	}
+	return h.ResetDeviceCtx(ctx)
+}
+
+// startReading starts mainLoop, unless it has been started already, or
+// the HCI has been shut down.
+func (h HCI) startReading() {
+	if atomic.CompareAndSwapInt32(&h.closing.reading, 0, 1) {
+		go h.mainLoop()
+	}
+}
+
+const (
+	defaultReadBufferSize = 4096
+	defaultReadBatch      = 8
+)
+
+// SetReadBuffer sets the size of the buffer each packet is read into, and
+// the number of packets that may be read at once, with a single system
+// call, from an HCI socket. Zero leaves a setting unchanged. It must be
+// called before Start.
+func (h *HCI) SetReadBuffer(size, batch int) {
+	if size > 0 {
+		h.rbufSize = size
+	}
+	if batch > 0 {
+		h.rbatch = batch
+	}
+}
+
+// A batchReader reads several packets at once, each into a buffer of its
+// own, and returns the number of packets read.
+type batchReader interface {
+	ReadBatch(bs [][]byte, ns []int) (int, error)
+}
+
+// singleReader reads a packet at a time.
+type singleReader struct{ io.Reader }
+
+func (r singleReader) ReadBatch(bs [][]byte, ns []int) (int, error) {
+	n, err := r.Read(bs[0])
+	ns[0] = n
+	return 1, err
+}
+
+// mainLoop reads packets from the device. Each packet is copied, once, into
+// a buffer of its own, which is handed over to handlePacket. The parsers
+// of the layers above decode their headers in place and slice the payload
+// out of that buffer rather than copying it, so the buffer lives as long as
+// the last of those slices; it is never reused. Advertising reports, while
+// scanning, are the exception: they are decoded right out of the read
+// buffer into the ring ReadAdvReports drains.
 func (h HCI) mainLoop() {
-	b := make([]byte, 4096)
+	pprof.SetGoroutineLabels(pprof.WithLabels(context.Background(), pprof.Labels("gatt", "hci-read")))
+	defer close(h.readDone)
+	defer h.disp.stop()
+	defer h.scan.close()
+	br, ok := h.dev.(batchReader)
+	if !ok || h.rbatch == 1 {
+		br = singleReader{h.dev}
+	}
+	bs := make([][]byte, h.rbatch)
+	ns := make([]int, h.rbatch)
+	for i := range bs {
+		bs[i] = make([]byte, h.rbufSize)
+	}
 	for {
-		n, err := h.dev.Read(b)
+		k, err := br.ReadBatch(bs, ns)
 		if err != nil {
 			log.Printf("Failed to Read: %s", err)
+			h.closing.readErr = err
 			return
 		}
-		if n == 0 {
-			log.Printf("Dev Read 0 byte. fd had been closed")
-			return
+		// The packets of a batch are received together; their time,
+		// read once, carries the monotonic clock up to the callbacks.
+		at := time.Now()
+		for i := 0; i < k; i++ {
+			n := ns[i]
+			if n == 0 {
+				log.Printf("Dev Read 0 byte. fd had been closed")
+				h.closing.readErr = io.EOF
+				return
+			}
+			if h.snoop != nil {
+				h.snoop.capture(bs[i][:n], true)
+			}
+			if b := bs[i][:n]; h.scan.isAdvReport(b) {
+				if !h.scan.put(b) {
+					h.reject(fmt.Errorf("%w LE Advertising Report event", hci.ErrMalformed), b)
+				}
+				continue
+			}
+			h.disp.dispatch(readPacket(bs[i][:n], at))
 		}
-		p := make([]byte, n)
-		copy(p, b)
-		go h.handlePacket(p)
 	}
 }
 
-func (h HCI) handlePacket(b []byte) {
-	t, b := PacketType(b[0]), b[1:]
+func (h HCI) handlePacket(b []byte) { h.handle(packet{b: b, at: time.Now()}) }
+
+// handle handles the packet pk. Its buffer, if pooled, is handed over to
+// the L2CAP, along with the ACL data it holds, unless malformed.
+func (h HCI) handle(pk packet) {
+	b := pk.b
+	if len(b) == 0 {
+		h.reject(fmt.Errorf("%w empty packet", hci.ErrMalformed), b)
+		pk.release()
+		return
+	}
+	t, p := PacketType(b[0]), b[1:]
 	var err error
 	switch t {
 	case ptypeCommandPkt:
-		err = h.handleCmd(b)
+		err = h.handleCmd(p)
 	case ptypeACLDataPkt:
-		err = h.l2c.HandleL2CAP(b)
+		err = h.l2c.HandleACL(p, pk.buf, pk.at)
 	case ptypeSCODataPkt:
-		err = h.handleSCO(b)
+		err = h.handleSCO(p)
 	case ptypeEventPkt:
-		err = h.evt.Dispatch(b)
+		err = h.evt.Dispatch(p)
+	case ptypeISODataPkt:
+		err = h.handleISO(p)
 	case ptypeVendorPkt:
 		err = h.handleVendor(b)
 	default:
-		log.Fatalf("Unknown Event: 0x%02X [ % X ]\n", t, b)
+		err = fmt.Errorf("%w packet of type 0x%02X", hci.ErrMalformed, uint8(t))
 	}
-	if err != nil {
-		log.Printf("hci: %s, [ % X]", err, b)
+	if errors.Is(err, hci.ErrMalformed) {
+		h.reject(err, b)
+	} else if err != nil {
+		log.Printf("hci: %s, [ % X]", err, p)
+	}
+	if t != ptypeACLDataPkt || err != nil {
+		pk.release()
 	}
 }
 
-func (h HCI) handleCmd(b []byte) error {
-	// This is most likely command generated by Linux kernel.
-	// In this case, we need to find a way to tell kernel not to touch the device.
-	op := uint16(b[0]) | uint16(b[1])<<8
-	log.Printf("unmanaged cmd: %s(0x%04X)\n", cmd.Opcode(op), op)
-	return nil
+// reject logs, and counts, the packet b, dropped as malformed.
+func (h HCI) reject(err error, b []byte) {
+	atomic.AddUint64(h.malformed, 1)
+	log.Printf("hci: %s, [ % X]", err, b)
 }
 
-func (h HCI) handleSCO(b []byte) error {
-	return fmt.Errorf("SCO packet not supported")
+// Malformed returns the number of packets received from the controller
+// so far, and dropped as malformed. Those of the L2CAP PDUs of each
+// connection, reassembled from them, are counted in its statistics.
+func (h HCI) Malformed() uint64 {
+	return atomic.LoadUint64(h.malformed)
 }
 
-func (h HCI) handleVendor(b []byte) error {
-	return fmt.Errorf("Vendor packet not supported")
+func (h HCI) handleCmd(b []byte) error {
+	// Controllers send no commands to the host, and, over the user
+	// channel, the kernel sends the device none either: one read is
+	// that of a raw socket sharing the device, or of a fake.
+	if len(b) < 2 {
+		return fmt.Errorf("%w command packet", hci.ErrMalformed)
+	}
+	op := uint16(b[0]) | uint16(b[1])<<8
+	log.Printf("unmanaged cmd: %s(0x%04X)\n", cmd.Opcode(op), op)
+	return nil
 }
 
 type cmdSeq struct {
@@ -151,23 +545,144 @@ var bcmResetSeq = []cmdSeq{
 	}, expSuccess},
 }
 
+// defaultEventMask unmasks the events gatt handles, and others of
+// BR/EDR.
+const defaultEventMask = 0x3DBFF807FFFBFFFF
+
+// defaultLEEventMask unmasks the LE events of subevents 0x01 - 0x05, the
+// LE Data Length Change event (0x07), the LE PHY Update Complete event
+// (0x0C), and the LE Channel Selection Algorithm event (0x14).
+const defaultLEEventMask = 0x000000000008085F
+
+// defaultResetSeq is followed by the event masks; see setEventMasks.
 var defaultResetSeq = []cmdSeq{
 	{cmd.Reset{}, expSuccess},
-	{cmd.SetEventMask{EventMask: 0x3dbff807fffbffff}, expSuccess},
 	// {cmd.SetEventFlt{0x0, 0x00, 0x00}, expSuccess},
-	{cmd.LESetEventMask{LEEventMask: 0x000000000000001F}, expSuccess},
+}
+
+// handleDisconnectionComplete drops the state of the connection
+// disconnected, and hands the event to the L2CAP.
+func (h HCI) handleDisconnectionComplete(b []byte) error {
+	ep := &event.DisconnectionCompleteEP{}
+	if err := ep.Unmarshal(b); err != nil {
+		return err
+	}
+	h.power.forget(ep.ConnectionHandle)
+	h.ranger.forget(ep.ConnectionHandle)
+	return h.l2c.HandleDisconnectionComplete(b)
+}
+
+// eventMasks are the event masks set, shared by the features unmasking
+// their events.
+type eventMasks struct {
+	mu   sync.Mutex
+	bits uint64 // of the events
+	le   uint64 // of the LE events
+
+	// Unmasked by EnableEvents, or the Events option, and set again as
+	// the device is reset, unlike those of the features.
+	extra, leExtra uint64
+}
+
+// unmaskLE unmasks the LE events of bits, along with those unmasked
+// already.
+func (h HCI) unmaskLE(bits uint64) error {
+	h.masks.mu.Lock()
+	defer h.masks.mu.Unlock()
+	if err := h.cmd.SendAndCheckResp(cmd.LESetEventMask{LEEventMask: h.masks.le | bits}, expSuccess); err != nil {
+		return err
+	}
+	h.masks.le |= bits
+	return nil
+}
+
+// EnableEvents unmasks the events of mask, and the LE events of le, along
+// with those unmasked already, so that the subsystems of the application,
+// e.g. an SMP implementation, receive the events they rely on, such as
+// the Encryption Change event (bit 7 of mask), and handle them with the
+// handlers they register on the Event of the HCI. The bits are those of
+// the Set Event Mask, and LE Set Event Mask, commands; the masks are sent
+// to the controller at once, and again as the device is reset. See also
+// the Events option.
+func (h HCI) EnableEvents(mask, le uint64) error {
+	h.masks.mu.Lock()
+	defer h.masks.mu.Unlock()
+	if mask&^h.masks.bits != 0 {
+		if err := h.cmd.SendAndCheckResp(cmd.SetEventMask{EventMask: h.masks.bits | mask}, expSuccess); err != nil {
+			return err
+		}
+		h.masks.bits |= mask
+	}
+	if le&^h.masks.le != 0 {
+		if err := h.cmd.SendAndCheckResp(cmd.LESetEventMask{LEEventMask: h.masks.le | le}, expSuccess); err != nil {
+			return err
+		}
+		h.masks.le |= le
+	}
+	h.masks.extra |= mask
+	h.masks.leExtra |= le
+	return nil
+}
+
+// EventMasks returns the event mask, and the LE event mask, set.
+func (h HCI) EventMasks() (mask, le uint64) {
+	h.masks.mu.Lock()
+	defer h.masks.mu.Unlock()
+	return h.masks.bits, h.masks.le
+}
+
+// setEventMasks sets the event masks of the device, once reset: the
+// defaults, along with those of EnableEvents.
+func (h HCI) setEventMasks(ctx context.Context) error {
+	h.masks.mu.Lock()
+	defer h.masks.mu.Unlock()
+	bits, le := defaultEventMask|h.masks.extra, uint64(defaultLEEventMask)|h.masks.leExtra
+	if err := h.cmd.SendAndCheckRespCtx(ctx, cmd.SetEventMask{EventMask: bits}, expSuccess); err != nil {
+		return err
+	}
+	if err := h.cmd.SendAndCheckRespCtx(ctx, cmd.LESetEventMask{LEEventMask: le}, expSuccess); err != nil {
+		return err
+	}
+	h.masks.bits, h.masks.le = bits, le
+	return nil
 }
 
 func (h HCI) ResetDevice() error {
+	return h.ResetDeviceCtx(context.Background())
+}
+
+// ResetDeviceCtx resets the device, like ResetDevice, giving up once ctx
+// is done, in which case it returns ctx.Err(), and the device is left
+// partly set up.
+func (h HCI) ResetDeviceCtx(ctx context.Context) error {
 	for _, s := range defaultResetSeq {
-		if err := h.Cmd().SendAndCheckResp(s.cp, s.exp); err != nil {
+		if err := h.Cmd().SendAndCheckRespCtx(ctx, s.cp, s.exp); err != nil {
 			return err
 		}
 	}
-	for _, s := range bcmResetSeq {
-		if err := h.Cmd().SendAndCheckResp(s.cp, s.exp); err != nil {
+	if err := h.setEventMasks(ctx); err != nil {
+		return err
+	}
+	h.readSupportedCommands(ctx)
+	for _, s := range h.setupSeq(ctx) {
+		// The commands the controller does not support are skipped, be
+		// it as it reports, or as it rejects them.
+		if !h.supportsCommand(s.cp.Opcode()) {
+			continue
+		}
+		err := h.Cmd().SendAndCheckRespCtx(ctx, s.cp, s.exp)
+		if errors.Is(err, StatusUnknownCommand) {
+			log.Printf("hci: %s not supported by the controller, skipped", s.cp.Opcode())
+			continue
+		}
+		if err != nil {
 			return err
 		}
 	}
-	return nil
+	h.readSupportedStates(ctx)
+	h.readCapabilities(ctx)
+	h.setDataLength(ctx)
+	h.restoreAcceptList(ctx)
+	h.period.reset()
+	return ctx.Err()
 }
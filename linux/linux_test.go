@@ -0,0 +1,265 @@
+package linux
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/paypal/gatt/linux/internal/cmd"
+)
+
+func TestClose(t *testing.T) {
+	gb := runtime.NumGoroutine()
+	h, d := newTestHCI(new(uint64))
+	h.scan.setEnabled(true)
+	d.rc <- connCompletePkt
+	c := <-h.l2c.ConnC()
+	read := make(chan error, 1)
+	go func() {
+		_, err := c.Read(make([]byte, 64))
+		read <- err
+	}()
+
+	if err := h.Close(); err != nil {
+		t.Fatalf("Close = %v", err)
+	}
+	if err := <-read; !errors.As(err, new(ErrDisconnected)) {
+		t.Errorf("Read = %v, want ErrDisconnected", err)
+	}
+	if _, err := h.ReadAdvReports(make([]AdvReport, 1)); err == nil {
+		t.Error("ReadAdvReports succeeded after Close")
+	}
+	if _, err := h.cmd.Send(cmd.Reset{}); !errors.Is(err, ErrClosed) {
+		t.Errorf("Send = %v, want ErrClosed", err)
+	}
+	if err := h.Close(); err != nil {
+		t.Errorf("second Close = %v", err)
+	}
+	if g := settledGoroutines(gb); g > gb {
+		t.Errorf("goroutines: %d before, %d after Close", gb, g)
+	}
+}
+
+func TestDeviceFailure(t *testing.T) {
+	h, d := newTestHCI(new(uint64))
+	defer h.Close()
+	if err := h.Err(); err != nil {
+		t.Errorf("Err = %v before the device failed", err)
+	}
+	d.Close() // as the dongle is unplugged
+	select {
+	case <-h.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Done not closed once the device failed")
+	}
+	if err := h.Err(); err != io.EOF {
+		t.Errorf("Err = %v, want %v", err, io.EOF)
+	}
+}
+
+func TestShutdownNotStarted(t *testing.T) {
+	gb := runtime.NumGoroutine()
+	h := newHCI(newFakeDevice(), defaultHCIConfig())
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := h.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown = %v", err)
+	}
+	if g := settledGoroutines(gb); g > gb {
+		t.Errorf("goroutines: %d before, %d after Shutdown", gb, g)
+	}
+}
+
+func TestShutdownStages(t *testing.T) {
+	h, d := newTestHCI(new(uint64))
+	d.rc <- connCompletePkt
+	<-h.l2c.ConnC()
+
+	var stages []ShutdownStage
+	for s := StopRadio; s <= CloseDevice; s++ {
+		s := s
+		h.OnShutdown(s, func(ctx context.Context) error {
+			stages = append(stages, s)
+			return nil
+		})
+	}
+	// A central connecting as advertising stops is refused.
+	refused := func() bool {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		for _, b := range d.cmds {
+			if cmd.Opcode(uint16(b[1])|uint16(b[2])<<8) == (cmd.Disconnect{}).Opcode() && b[4] == 0x41 && b[6] == 0x15 {
+				return true
+			}
+		}
+		return false
+	}
+	h.OnShutdown(DrainATT, func(ctx context.Context) error {
+		pkt := append([]byte(nil), connCompletePkt...)
+		pkt[5] = 0x41
+		d.rc <- pkt
+		for !refused() && ctx.Err() == nil {
+			time.Sleep(time.Millisecond)
+		}
+		return nil
+	})
+	errs := make(chan error, 1)
+	h.errf = func(err error) { errs <- err }
+	h.OnShutdown(StopCmds, func(ctx context.Context) error { return errors.New("flush failed") })
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := h.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown = %v", err)
+	}
+	if !refused() {
+		t.Error("connection established during the shutdown not refused")
+	}
+	want := []ShutdownStage{StopRadio, RefuseConns, DrainATT, DisconnectLinks, StopL2CAP, StopCmds, CloseDevice}
+	if fmt.Sprint(stages) != fmt.Sprint(want) {
+		t.Errorf("stages reached: %v, want %v", stages, want)
+	}
+	select {
+	case err := <-errs:
+		if !strings.Contains(err.Error(), "stop commands: flush failed") {
+			t.Errorf("reported %v", err)
+		}
+	default:
+		t.Error("error of a shutdown hook not reported")
+	}
+}
+
+// stuckDevice is a controller that never answers commands.
+type stuckDevice struct{ *fakeDevice }
+
+func (stuckDevice) Write(b []byte) (int, error) { return len(b), nil }
+
+func TestStartCtx(t *testing.T) {
+	h := newHCI(stuckDevice{newFakeDevice()}, defaultHCIConfig())
+	defer h.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := h.StartCtx(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("StartCtx = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if _, err := h.cmd.SendCtx(ctx, cmd.Reset{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("SendCtx = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestCommandIDs(t *testing.T) {
+	var buf bytes.Buffer
+	cfg := defaultHCIConfig()
+	cfg.logger = log.New(&buf, "", 0)
+	h := newHCI(newFakeDevice(), cfg)
+	var mu sync.Mutex
+	var spans []string
+	h.SetSpanHook(func(name string) func(error) {
+		mu.Lock()
+		spans = append(spans, name)
+		mu.Unlock()
+		return func(error) {}
+	})
+	h.startReading()
+
+	var wg sync.WaitGroup
+	for _, cp := range []cmd.CmdParam{cmd.Reset{}, cmd.LESetScanEnable{}, cmd.LEReadSupportedStates{}} {
+		wg.Add(1)
+		go func(cp cmd.CmdParam) {
+			defer wg.Done()
+			h.cmd.Send(cp)
+		}(cp)
+	}
+	wg.Wait()
+	h.Close()
+
+	if len(spans) != 3 {
+		t.Fatalf("spans %q, want 3", spans)
+	}
+	for _, s := range spans {
+		i := strings.LastIndex(s, " #")
+		op, id := strings.TrimPrefix(s[:i], "hci: "), s[i+2:]
+		for _, want := range []string{
+			fmt.Sprintf("< HCI Command #%s: %s ", id, op),
+			fmt.Sprintf("> HCI Command Complete #%s: %s ", id, op),
+		} {
+			if !strings.Contains(buf.String(), want) {
+				t.Errorf("span %q: no log line %q in:\n%s", s, want, buf.String())
+			}
+		}
+	}
+}
+
+func TestEnableEvents(t *testing.T) {
+	d := newFakeDevice()
+	cfg := defaultHCIConfig()
+	Events(0, 1<<40)(&cfg) // LE Subrate Change
+	h := newHCI(d, cfg)
+	h.l2c.Adv = fakeAdv{}
+	defer h.Close()
+	if err := h.StartCtx(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if mask, le := h.EventMasks(); mask != defaultEventMask || le != defaultLEEventMask|1<<40 {
+		t.Errorf("EventMasks() = 0x%X, 0x%X, want 0x%X, 0x%X", mask, le, uint64(defaultEventMask), uint64(defaultLEEventMask|1<<40))
+	}
+
+	d.sent()
+	const encryptionChange = 1 << 7
+	if err := h.EnableEvents(encryptionChange|1<<62, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.EnableEvents(encryptionChange, 0); err != nil { // unmasked already
+		t.Fatal(err)
+	}
+	waitSent(t, d, "Set Event Mask 255")
+	if mask, _ := h.EventMasks(); mask != defaultEventMask|1<<62 {
+		t.Errorf("event mask 0x%X, want 0x%X", mask, uint64(defaultEventMask|1<<62))
+	}
+
+	// Reset again, the masks stay unmasked.
+	if err := h.ResetDevice(); err != nil {
+		t.Fatal(err)
+	}
+	if mask, le := h.EventMasks(); mask != defaultEventMask|1<<62 || le != defaultLEEventMask|1<<40 {
+		t.Errorf("EventMasks() once reset = 0x%X, 0x%X", mask, le)
+	}
+}
+
+func TestRawAdvReports(t *testing.T) {
+	h, d := newTestHCI(new(uint64))
+	defer h.Close()
+	h.scan.setEnabled(true)
+	rs := make([]AdvReport, 1)
+	d.rc <- advReportPkt
+	if _, err := h.ReadAdvReports(rs); err != nil {
+		t.Fatal(err)
+	}
+	if rs[0].Raw != nil || !rs[0].Time.IsZero() {
+		t.Errorf("report out of the raw mode = %x at %v, want neither", rs[0].Raw, rs[0].Time)
+	}
+
+	h.SetRawAdvReports(true)
+	before := time.Now()
+	d.rc <- advReportPkt
+	if _, err := h.ReadAdvReports(rs); err != nil {
+		t.Fatal(err)
+	}
+	if want := advReportPkt[5:]; !bytes.Equal(rs[0].Raw, want) {
+		t.Errorf("raw report = %x, want %x", rs[0].Raw, want)
+	}
+	if rs[0].Time.Before(before) {
+		t.Errorf("raw report read at %v, before it was sent, at %v", rs[0].Time, before)
+	}
+	if got := string(rs[0].AdvertisingData()); got != string(advReportPkt[14:32]) {
+		t.Errorf("data of the raw report = %q, want it decoded as well", got)
+	}
+}
@@ -0,0 +1,256 @@
+package linux
+
+import (
+	"io"
+	"log"
+
+	"github.com/paypal/gatt/internal/handler"
+	"github.com/paypal/gatt/linux/internal/cmd"
+	"github.com/paypal/gatt/linux/internal/event"
+)
+
+// hciConfig is what an HCI is opened with.
+type hciConfig struct {
+	id           int
+	logger       *log.Logger
+	maxConn      int
+	resetSeq     []cmdSeq
+	rbufSize     int
+	rbatch       int
+	scanInterval uint16
+	scanWindow   uint16
+	advOpts      []Option
+	ltk          func(handle uint16, rand uint64, ediv uint16) (ltk [16]byte, ok bool)
+	errf         func(err error)
+	dataLength   int
+	events       uint64
+	leEvents     uint64
+	snoop        io.Writer
+	addr         [6]byte
+	uart         string
+	baud         int
+	flow         bool
+	patchram     string
+	transport    io.ReadWriteCloser
+	dispatch     DispatchMode
+	down         bool
+}
+
+func defaultHCIConfig() hciConfig {
+	return hciConfig{
+		id:           -1,
+		maxConn:      1,
+		rbufSize:     defaultReadBufferSize,
+		rbatch:       defaultReadBatch,
+		scanInterval: 0x0010, // 10 ms
+		scanWindow:   0x0010, // 10 ms
+	}
+}
+
+// An HCIOption configures an HCI as it is opened.
+// See OpenHCI.
+type HCIOption func(*hciConfig)
+
+// DeviceID sets the index of the HCI device to open, e.g. 0 for hci0.
+// A negative index, the default, selects hci1 if it can be opened, and
+// hci0 otherwise. A device missing fails with an ErrNoAdapter listing
+// those found; see also Adapters.
+func DeviceID(n int) HCIOption {
+	return func(c *hciConfig) { c.id = n }
+}
+
+// DeviceAddr selects the HCI device to open by its public address, as
+// listed by Adapters, rather than by its index; DeviceID is then ignored.
+// If zero, the default, the device is selected by DeviceID.
+func DeviceAddr(addr [6]byte) HCIOption {
+	return func(c *hciConfig) { c.addr = addr }
+}
+
+// TakeDown, if down is set, takes the HCI device down, as hciconfig
+// hciN down does, before binding its user channel, which the kernel
+// refuses while the device is up: the kernel, and bluetoothd, let go of
+// it. Otherwise, the default, a device up fails to open with an error
+// matching syscall.EBUSY. It is ignored with UART and Transport.
+func TakeDown(down bool) HCIOption {
+	return func(c *hciConfig) { c.down = down }
+}
+
+// UART sets the path of the tty, e.g. /dev/ttyAMA0, or that of a USB-CDC
+// adapter, to which the controller is attached, to be driven over the HCI
+// UART transport (H4) rather than an HCI socket, at the baud rate, with
+// RTS/CTS flow control if flow. It needs no Bluetooth driver in the
+// kernel; DeviceID is then ignored.
+func UART(path string, baud int, flow bool) HCIOption {
+	return func(c *hciConfig) { c.uart, c.baud, c.flow = path, baud, flow }
+}
+
+// Transport sets the transport the HCI exchanges the packets with the
+// controller over, in place of opening a device: each Write carries a
+// packet, its packet type first, as with the UART transport, and each
+// Read returns one. Tests inject a scripted controller, such as that of
+// package hcitest, to exercise the stack without hardware. If set,
+// DeviceID, DeviceAddr and UART are ignored.
+func Transport(rwc io.ReadWriteCloser) HCIOption {
+	return func(c *hciConfig) { c.transport = rwc }
+}
+
+// Logger sets the logger the HCI traces its traffic to.
+// If nil, the default, nothing is traced.
+func Logger(l *log.Logger) HCIOption {
+	return func(c *hciConfig) { c.logger = l }
+}
+
+// MaxConnections sets the maximum number of concurrent connections.
+// The default is 1.
+func MaxConnections(n int) HCIOption {
+	return func(c *hciConfig) { c.maxConn = n }
+}
+
+// A Command is a raw HCI command.
+type Command struct {
+	Opcode uint16 // OGF in the upper 6 bits, OCF in the lower 10
+	Params []byte
+}
+
+// rawCmd sends a Command as it is.
+type rawCmd struct {
+	op uint16
+	p  []byte
+}
+
+func (c rawCmd) Opcode() cmd.Opcode { return cmd.Opcode(c.op) }
+func (c rawCmd) Len() int           { return len(c.p) }
+func (c rawCmd) Marshal(b []byte)   { copy(b, c.p) }
+
+// ResetSequence sets the commands sent to set the controller up once it
+// has been reset, each of which is expected to succeed.
+// If nil, the default, the sequence is that registered for the
+// manufacturer of the controller; see RegisterResetSequence. An empty
+// sequence sends none.
+func ResetSequence(cmds []Command) HCIOption {
+	return func(c *hciConfig) {
+		if cmds == nil {
+			c.resetSeq = nil
+			return
+		}
+		c.resetSeq = commandSeq(cmds)
+	}
+}
+
+// ReadBuffer sets the size of the buffer each packet is read into, and the
+// number of packets read at once. Zero leaves a setting to its default.
+// See also HCI.SetReadBuffer.
+func ReadBuffer(size, batch int) HCIOption {
+	return func(c *hciConfig) {
+		if size > 0 {
+			c.rbufSize = size
+		}
+		if batch > 0 {
+			c.rbatch = batch
+		}
+	}
+}
+
+// Dispatch sets how the packets read from the device are spread over the
+// workers handling them; PerConnection by default. Ordered guarantees the
+// events, and the ACL data, of each connection are handled in the order
+// the controller sent them, should an application depend on it.
+func Dispatch(m DispatchMode) HCIOption {
+	return func(c *hciConfig) { c.dispatch = m }
+}
+
+// ScanParameters sets the scan interval and window, in units of 0.625 ms,
+// used by Scan. Both default to 10 ms.
+func ScanParameters(interval, window uint16) HCIOption {
+	return func(c *hciConfig) {
+		c.scanInterval = interval
+		c.scanWindow = window
+	}
+}
+
+// AdvertisingDefaults sets the options advertisers created by
+// HCI.NewAdvertiser start with.
+func AdvertisingDefaults(opts ...Option) HCIOption {
+	return func(c *hciConfig) { c.advOpts = opts }
+}
+
+// LongTermKeys sets the security policy of encrypted links: f returns the
+// long term key of the connection of handle h, as identified by rand and
+// ediv, if it is known. Encryption requested by a central is refused
+// when f is nil, the default, or when it returns false.
+func LongTermKeys(f func(h uint16, rand uint64, ediv uint16) (ltk [16]byte, ok bool)) HCIOption {
+	return func(c *hciConfig) { c.ltk = f }
+}
+
+// DataLength sets the payload, in bytes, of the link-layer data PDUs the
+// connections are set to send as they are established, from 27 to 251,
+// so that the ATT PDUs are not cut into 27-byte ones over the air. It is
+// capped by what the controller supports, and negotiated with the peer.
+// Zero, the default, sets the largest the controller supports; 27 sets
+// none, as with the controllers prior to Bluetooth 4.2.
+func DataLength(octets int) HCIOption {
+	return func(c *hciConfig) { c.dataLength = octets }
+}
+
+// Events unmasks the events of mask, and the LE events of le, along with
+// those gatt unmasks, as the device is reset, as EnableEvents does once
+// it is started.
+func Events(mask, le uint64) HCIOption {
+	return func(c *hciConfig) { c.events, c.leEvents = mask, le }
+}
+
+// HandlerErrors sets where the errors of the HCI go, such as the panic
+// of the ISO handler, a HandlerPanic, rather than the log.
+func HandlerErrors(f func(err error)) HCIOption {
+	return func(c *hciConfig) { c.errf = f }
+}
+
+// A HandlerPanic is the error a handler of the application panicking is
+// reported as, its panic recovered.
+type HandlerPanic = handler.Panic
+
+// call calls f, which calls the handler of the application named name,
+// as handler.Call does, reporting a panic to the HandlerErrors function.
+func (h HCI) call(name string, f func()) bool {
+	return handler.Call(name, f, h.errf)
+}
+
+// report reports err to the HandlerErrors function, or logs it.
+func (h HCI) report(err error) {
+	if h.errf == nil {
+		log.Print(err)
+	} else {
+		h.errf(err)
+	}
+}
+
+// NewAdvertiser returns an advertiser set with the AdvertisingDefaults
+// of the HCI.
+func (h HCI) NewAdvertiser() *advertiser {
+	a := NewAdvertiser(h.cmd)
+	a.roles = h.roles
+	a.caps = h.caps
+	for _, opt := range h.advOpts {
+		opt(a)
+	}
+	return a
+}
+
+// handleLTKRequest answers an LE Long Term Key Request with the key
+// returned by the LongTermKeys policy, if any.
+func (h HCI) handleLTKRequest(b []byte) error {
+	ep := &event.LELTKRequestEP{}
+	if err := ep.Unmarshal(b); err != nil {
+		return err
+	}
+	if h.ltk != nil {
+		var ltk [16]byte
+		var ok bool
+		if h.call("long term key", func() { ltk, ok = h.ltk(ep.ConnectionHandle, ep.RandomNumber, ep.EncryptionDiversifier) }) && ok {
+			_, err := h.cmd.Send(cmd.LELTKReply{ConnectionHandle: ep.ConnectionHandle, LongTermKey: ltk})
+			return err
+		}
+	}
+	_, err := h.cmd.Send(cmd.LELTKNegReply{ConnectionHandle: ep.ConnectionHandle})
+	return err
+}
@@ -0,0 +1,210 @@
+package linux
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/paypal/gatt/linux/internal/cmd"
+)
+
+// waitACL waits for an L2CAP payload to be written, and returns it.
+func waitACL(t *testing.T, d *fakeDevice) []byte {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if acl := d.sentACL(); len(acl) > 0 {
+			return acl[0]
+		}
+	}
+	t.Fatal("no ACL data written")
+	return nil
+}
+
+// connParamUpdateReq is a Connection Parameter Update Request of the
+// peripheral, for an interval of 7.5 to 15 ms, and a timeout of 2 s.
+var connParamUpdateReq = []byte{
+	0x02,       // ACL data
+	0x40, 0x20, // handle, first flushable
+	0x10, 0x00, // data length
+	0x0C, 0x00, 0x05, 0x00, // L2CAP header: length, LE signaling channel
+	0x12, 0x07, 0x08, 0x00, // request, identifier, length
+	0x06, 0x00, 0x0C, 0x00, 0x00, 0x00, 0xC8, 0x00,
+}
+
+func TestConnParamUpdateRequest(t *testing.T) {
+	h, d := newTestHCI(new(uint64))
+	defer h.Close()
+	central := append([]byte(nil), connCompletePkt...)
+	central[7] = 0x00 // master
+	d.rc <- central
+	c := <-h.l2c.ConnC()
+	d.sent()
+
+	d.rc <- connParamUpdateReq
+	if rsp := waitACL(t, d); !bytes.Equal(rsp, []byte{0x13, 0x07, 0x02, 0x00, 0x00, 0x00}) {
+		t.Errorf("response: got % X, want it accepted", rsp)
+	}
+	waitSent(t, d, "LE Connection Update 64")
+
+	c.OnParamsRequest(func(p ConnParams) (ConnParams, bool) { return p, false })
+	d.rc <- connParamUpdateReq
+	if rsp := waitACL(t, d); !bytes.Equal(rsp, []byte{0x13, 0x07, 0x02, 0x00, 0x01, 0x00}) {
+		t.Errorf("response: got % X, want it rejected", rsp)
+	}
+	waitSent(t, d)
+}
+
+func TestOnSignal(t *testing.T) {
+	h, d := newTestHCI(new(uint64))
+	defer h.Close()
+	central := append([]byte(nil), connCompletePkt...)
+	central[7] = 0x00 // master
+	d.rc <- central
+	c := <-h.l2c.ConnC()
+	d.sent()
+
+	signals := make(chan struct{}, 1)
+	c.OnSignal(func() bool {
+		signals <- struct{}{}
+		return false
+	})
+	d.rc <- connParamUpdateReq
+	select {
+	case <-signals:
+	case <-time.After(time.Second):
+		t.Fatal("signaling command not passed to OnSignal")
+	}
+	waitSent(t, d)
+	if acl := d.sentACL(); len(acl) != 0 {
+		t.Errorf("dropped request answered: % X", acl)
+	}
+}
+
+func TestUpdateParamsAsPeripheral(t *testing.T) {
+	h, d := newTestHCI(new(uint64))
+	defer h.Close()
+	d.rc <- connCompletePkt
+	c := <-h.l2c.ConnC()
+
+	want := ConnParams{IntervalMin: 0x06, IntervalMax: 0x0C, Latency: 0, SupervisionTimeout: 0xC8}
+	for _, accept := range []bool{true, false} {
+		errc := make(chan error, 1)
+		go func() { errc <- c.UpdateParams(want) }()
+		req := waitACL(t, d)
+		if len(req) != 12 || req[0] != 0x12 || !bytes.Equal(req[4:], []byte{0x06, 0x00, 0x0C, 0x00, 0x00, 0x00, 0xC8, 0x00}) {
+			t.Fatalf("request: got % X", req)
+		}
+		result := byte(0x00)
+		if !accept {
+			result = 0x01
+		}
+		d.rc <- []byte{0x02, 0x40, 0x20, 0x0A, 0x00, 0x06, 0x00, 0x05, 0x00, 0x13, req[1], 0x02, 0x00, result, 0x00}
+		if accept {
+			d.rc <- []byte{
+				0x04, 0x3E, 0x0A, // LE Meta event
+				0x03, 0x00, // LE Connection Update Complete, success
+				0x40, 0x00, // handle
+				0x0C, 0x00, // interval
+				0x00, 0x00, // latency
+				0xC8, 0x00, // supervision timeout
+			}
+		}
+		err := <-errc
+		switch {
+		case accept && err != nil:
+			t.Errorf("UpdateParams: %v", err)
+		case !accept && !errors.Is(err, ErrParamsRejected):
+			t.Errorf("UpdateParams: got %v, want ErrParamsRejected", err)
+		}
+	}
+	if p := c.Params(); p != (ConnParams{IntervalMin: 0x0C, IntervalMax: 0x0C, SupervisionTimeout: 0xC8}) {
+		t.Errorf("Params: got %+v", p)
+	}
+}
+
+func TestChannels(t *testing.T) {
+	h, d := newTestHCI(new(uint64))
+	defer h.Close()
+	d.rc <- connCompletePkt
+	c := <-h.l2c.ConnC()
+	if n := c.ChannelSelection(); n != 1 {
+		t.Errorf("ChannelSelection before the event: got %d, want 1", n)
+	}
+	d.rc <- []byte{0x04, 0x3E, 0x04, 0x14, 0x40, 0x00, 0x01} // LE Channel Selection Algorithm, #2
+	for deadline := time.Now().Add(time.Second); c.ChannelSelection() != 2; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("ChannelSelection: algorithm #2 not reported")
+		}
+	}
+
+	// All the channels but 0, 9 and 36.
+	d.mu.Lock()
+	d.rsp = map[cmd.Opcode][]byte{(cmd.LEReadChannelMap{}).Opcode(): {0x40, 0x00, 0xFE, 0xFD, 0xFF, 0xFF, 0x0F}}
+	d.mu.Unlock()
+	m, err := c.ChannelMap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Count() != 34 || m.Used(0) || m.Used(9) || m.Used(36) || !m.Used(1) || !m.Used(35) {
+		t.Errorf("ChannelMap: got 0x%010X", uint64(m))
+	}
+}
+
+func TestReadRSSI(t *testing.T) {
+	h, d := newTestHCI(new(uint64))
+	defer h.Close()
+	d.rc <- connCompletePkt
+	c := <-h.l2c.ConnC()
+	d.mu.Lock()
+	d.rsp = map[cmd.Opcode][]byte{(cmd.ReadRSSI{}).Opcode(): {0x40, 0x00, 0xC6}}
+	d.mu.Unlock()
+	if rssi, err := c.ReadRSSI(); err != nil || rssi != -58 {
+		t.Errorf("ReadRSSI = %d, %v; want -58", rssi, err)
+	}
+	waitSent(t, d, "Read RSSI 64")
+}
+
+func TestWritePriority(t *testing.T) {
+	h, d := newTestHCI(new(uint64))
+	defer h.Close()
+	d.rc <- connCompletePkt
+	c := <-h.l2c.ConnC()
+
+	// Take all the buffers of the controller.
+	for i := 0; i < 14; i++ {
+		if _, err := c.Write([]byte{0x01, 0x00}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pdu := func(b byte) []byte { return bytes.Repeat([]byte{b}, 60) } // of 3 fragments
+	errc := make(chan error, 3)
+	write := func(f func() (int, error)) {
+		go func() {
+			_, err := f()
+			errc <- err
+		}()
+		time.Sleep(20 * time.Millisecond)
+	}
+	write(func() (int, error) { return c.WriteChannel(0x40, pdu(0xA1)) })
+	write(func() (int, error) { return c.WriteChannel(0x40, pdu(0xA2)) })
+	write(func() (int, error) { return c.Write([]byte{0x1B, 0x0E, 0x00, 0x01}) })
+
+	d.rc <- []byte{0x04, 0x13, 0x05, 0x01, 0x40, 0x00, 0x0E, 0x00} // Number Of Completed Packets
+	for i := 0; i < 3; i++ {
+		if err := <-errc; err != nil {
+			t.Fatal(err)
+		}
+	}
+	var got []byte
+	for deadline := time.Now().Add(time.Second); len(got) < 14+7 && time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		for _, b := range d.sentACL() {
+			got = append(got, b[0])
+		}
+	}
+	// The ATT PDU waits for the fragments of the first bulk PDU only.
+	want := append(bytes.Repeat([]byte{0x01}, 14), 0xA1, 0xA1, 0xA1, 0x1B, 0xA2, 0xA2, 0xA2)
+	if !bytes.Equal(got, want) {
+		t.Errorf("PDUs written in the order % X, want % X", got, want)
+	}
+}
@@ -0,0 +1,95 @@
+package linux
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/paypal/gatt/linux/internal/cmd"
+)
+
+// Vendor commands of Broadcom controllers downloading a patch to RAM.
+const (
+	opBCMDownloadMinidriver = 0xFC2E
+	opBCMLaunchRAM          = 0xFC4E
+)
+
+// The delays the controller takes to start the minidriver, and to launch
+// the patch, before it answers again.
+var (
+	minidriverDelay = 50 * time.Millisecond
+	launchDelay     = 250 * time.Millisecond
+)
+
+// Patchram sets the path of the firmware patch, in the .hcd format of
+// Broadcom, e.g. BCM43430A1.hcd, downloaded to the RAM of the controller
+// as the HCI starts, ahead of resetting it: many BCM43xx radios need it
+// for LE to work reliably. If empty, the default, none is downloaded.
+func Patchram(path string) HCIOption {
+	return func(c *hciConfig) { c.patchram = path }
+}
+
+// parseHCD returns the commands of the .hcd patch b: each its opcode,
+// least significant byte first, the length of its parameters, and those.
+func parseHCD(b []byte) ([]Command, error) {
+	var cmds []Command
+	for len(b) > 0 {
+		if len(b) < 3 || len(b) < 3+int(b[2]) {
+			return nil, fmt.Errorf("command %d truncated", len(cmds))
+		}
+		n := 3 + int(b[2])
+		cmds = append(cmds, Command{Opcode: binary.LittleEndian.Uint16(b), Params: b[3:n]})
+		b = b[n:]
+	}
+	return cmds, nil
+}
+
+// loadPatchram downloads the patch of the Patchram option to the
+// controller: once reset, the minidriver is started, the commands of the
+// patch, writing it to RAM, and launching it, are sent in turn, each
+// expected to succeed, and the controller is left to restart.
+func (h HCI) loadPatchram(ctx context.Context, path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("patchram: %w", err)
+	}
+	cmds, err := parseHCD(b)
+	if err != nil {
+		return fmt.Errorf("patchram %s: %w", path, err)
+	}
+	if err := h.cmd.SendAndCheckRespCtx(ctx, cmd.Reset{}, expSuccess); err != nil {
+		return fmt.Errorf("patchram: %w", err)
+	}
+	if _, err := h.SendCommand(ctx, Command{Opcode: opBCMDownloadMinidriver}); err != nil {
+		return fmt.Errorf("patchram: %w", err)
+	}
+	if err := sleepCtx(ctx, minidriverDelay); err != nil {
+		return err
+	}
+	for _, c := range cmds {
+		if _, err := h.SendCommand(ctx, c); err != nil {
+			return fmt.Errorf("patchram %s: %w", path, err)
+		}
+		if c.Opcode == opBCMLaunchRAM {
+			if err := sleepCtx(ctx, launchDelay); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// sleepCtx waits for d, or for ctx to be done, in which case it returns
+// ctx.Err().
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
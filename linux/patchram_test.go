@@ -0,0 +1,53 @@
+package linux
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPatchram(t *testing.T) {
+	defer func(m, l time.Duration) { minidriverDelay, launchDelay = m, l }(minidriverDelay, launchDelay)
+	minidriverDelay, launchDelay = 0, 0
+
+	path := filepath.Join(t.TempDir(), "BCM43430A1.hcd")
+	hcd := []byte{
+		0x4C, 0xFC, 0x06, 0x00, 0x00, 0x21, 0x00, 0xAA, 0xBB, // Write RAM
+		0x4E, 0xFC, 0x04, 0xFF, 0xFF, 0xFF, 0xFF, // Launch RAM
+	}
+	if err := ioutil.WriteFile(path, hcd, 0644); err != nil {
+		t.Fatal(err)
+	}
+	d := newFakeDevice()
+	cfg := defaultHCIConfig()
+	Patchram(path)(&cfg)
+	h := newHCI(d, cfg)
+	defer h.Close()
+	if err := h.StartCtx(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	sent := d.sent()
+	var ops []uint16
+	for _, b := range sent[:5] {
+		ops = append(ops, uint16(b[1])|uint16(b[2])<<8)
+	}
+	// The patch is downloaded ahead of the reset of the device.
+	if want := []uint16{0x0C03, 0xFC2E, 0xFC4C, 0xFC4E, 0x0C03}; !reflect.DeepEqual(ops, want) {
+		t.Errorf("sent % 04X, want % 04X", ops, want)
+	}
+	if got := sent[2][4:]; !reflect.DeepEqual(got, hcd[3:9]) {
+		t.Errorf("Write RAM parameters % X, want % X", got, hcd[3:9])
+	}
+
+	if err := ioutil.WriteFile(path, hcd[:5], 0644); err != nil {
+		t.Fatal(err)
+	}
+	h = newHCI(newFakeDevice(), cfg)
+	defer h.Close()
+	if err := h.StartCtx(context.Background()); err == nil {
+		t.Error("StartCtx with a truncated patch succeeded")
+	}
+}
@@ -0,0 +1,451 @@
+package linux
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/paypal/gatt/linux/internal/cmd"
+	"github.com/paypal/gatt/linux/internal/event"
+)
+
+const (
+	periodicLEEventMask     = 0x07 << 13  // LE subevents 0x0E - 0x10
+	periodicAdvInterval     = 0x0000A0    // of the advertising set carrying the sync info: 100 ms
+	periodicDataIncomplete  = 0x01        // data status of a report: more to come
+	periodicDataTruncated   = 0x02        // data status of a report: no more to come
+	statusCanceledByHost    = 0x44        // Operation Cancelled by Host
+	periodicMaxDataLength   = 1650        // of the specification, if the controller tells none
+	periodicSyncScanTimeout = time.Minute // bounds establishing a sync with no deadline
+)
+
+// PeriodicAdvertising is the configuration of a periodic advertising
+// train, broadcast by StartPeriodicAdvertising.
+type PeriodicAdvertising struct {
+	// Handle identifies the advertising set of the train, from 1 to
+	// 0xEF: the set 0 is that of the advertiser.
+	Handle uint8
+
+	// SID is the Advertising SID of the set, from 0 to 15, which the
+	// receivers tell the trains of the device apart by.
+	SID uint8
+
+	// IntervalMin and IntervalMax bound the interval of the train, in
+	// units of 1.25 ms, from 6 (7.5 ms).
+	IntervalMin, IntervalMax uint16
+
+	// Data is the data broadcast in each periodic event, up to the
+	// MaxAdvDataLength of the Capabilities.
+	Data []byte
+}
+
+// A PeriodicSync is a periodic advertising train synchronized to.
+type PeriodicSync struct {
+	Handle        uint16 // of the sync
+	SID           uint8
+	Address       [6]byte
+	AddressType   uint8
+	PHY           uint8  // of the train: 1 for LE 1M, 2 for LE 2M, 3 for LE Coded
+	Interval      uint16 // of the train, in units of 1.25 ms
+	ClockAccuracy uint8  // of the advertiser: 0 for 500 ppm down to 7 for 20 ppm
+}
+
+// A PeriodicReport is the data of a periodic advertising event,
+// reassembled from the reports of the controller.
+type PeriodicReport struct {
+	Handle    uint16 // of the sync
+	TxPower   int8   // in dBm; 127 if not available
+	RSSI      int8   // in dBm; 127 if not available
+	Truncated bool   // the controller failed to receive the rest of Data
+	Data      []byte
+}
+
+// PeriodicSyncParameters are those of CreatePeriodicSync.
+type PeriodicSyncParameters struct {
+	// SID, Address and AddressType, AddrPublic or AddrRandom, identify
+	// the train synchronized to.
+	SID         uint8
+	Address     [6]byte
+	AddressType uint8
+
+	// Skip is the number of periodic events that may be skipped once
+	// synchronized, from 0 to 0x01F3.
+	Skip uint16
+
+	// Timeout is the time the sync is kept without receiving the train,
+	// from 100 ms to 163.84 s, before it is lost.
+	Timeout time.Duration
+
+	// Report is called, from a goroutine of the HCI, with the data of
+	// each periodic event.
+	Report func(r PeriodicReport)
+
+	// Lost, if set, is called, from a goroutine of the HCI, with the
+	// handle of the sync once it is lost.
+	Lost func(handle uint16)
+}
+
+type periodicSync struct {
+	report func(r PeriodicReport)
+	lost   func(handle uint16)
+	data   []byte // of the event being reassembled
+}
+
+type periodicState struct {
+	mu      sync.Mutex
+	pending chan *event.LEPeriodicAdvertisingSyncEstablishedEP // of the sync being established
+	syncs   map[uint16]*periodicSync                           // by handle
+	sets    map[uint8]bool                                     // periodic advertising sets, by handle
+}
+
+func newPeriodicState() *periodicState {
+	return &periodicState{syncs: map[uint16]*periodicSync{}, sets: map[uint8]bool{}}
+}
+
+// reset drops the trains and syncs, which the controller drops as it is
+// reset.
+func (s *periodicState) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.syncs, s.sets = map[uint16]*periodicSync{}, map[uint8]bool{}
+}
+
+// checkPeriodic returns an error if the controller supports no periodic
+// advertising, or the longest data it takes otherwise.
+func (h HCI) checkPeriodic() (int, error) {
+	c := h.Capabilities()
+	if c.LEFeatures&lePeriodicAdvertising == 0 {
+		return 0, unsupported("periodic advertising")
+	}
+	if c.MaxAdvDataLength > 0 {
+		return c.MaxAdvDataLength, nil
+	}
+	return periodicMaxDataLength, nil
+}
+
+// StartPeriodicAdvertising broadcasts the periodic advertising train of
+// p, along with the non-connectable extended advertising of its set,
+// which the receivers find the train by. Controllers without the LE
+// Periodic Advertising feature fail it with ErrUnsupported. As with
+// ExtendedAdvertising, the controller then takes no legacy advertising,
+// or scanning, command until it is reset.
+func (h HCI) StartPeriodicAdvertising(p PeriodicAdvertising) error {
+	max, err := h.checkPeriodic()
+	if err != nil {
+		return err
+	}
+	for _, err := range []error{
+		checkRange("Handle", int(p.Handle), 1, 0xEF),
+		checkRange("SID", int(p.SID), 0, 15),
+		checkRange("IntervalMin", int(p.IntervalMin), 6, 0xFFFF),
+		checkRange("IntervalMax", int(p.IntervalMax), int(p.IntervalMin), 0xFFFF),
+		checkRange("Data length", len(p.Data), 0, max),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	h.period.mu.Lock()
+	defer h.period.mu.Unlock()
+	if h.period.sets[p.Handle] {
+		return fmt.Errorf("hci: periodic advertising set %d already started", p.Handle)
+	}
+	steps := []cmd.CmdParam{
+		cmd.LESetExtendedAdvertisingParameters{
+			AdvertisingHandle:             p.Handle,
+			AdvertisingEventProperties:    0x0000, // neither connectable, nor scannable
+			PrimaryAdvertisingIntervalMin: periodicAdvInterval,
+			PrimaryAdvertisingIntervalMax: periodicAdvInterval,
+			PrimaryAdvertisingChannelMap:  0x07,
+			OwnAddressType:                AddrPublic,
+			AdvertisingTxPower:            extAdvNoTxPref,
+			PrimaryAdvertisingPHY:         phyLE1M,
+			SecondaryAdvertisingPHY:       phyLE1M,
+			AdvertisingSID:                p.SID,
+		},
+		cmd.LESetPeriodicAdvertisingParameters{
+			AdvertisingHandle:           p.Handle,
+			PeriodicAdvertisingInterval: [2]uint16{p.IntervalMin, p.IntervalMax},
+		},
+	}
+	steps = append(steps, periodicData(p.Handle, p.Data)...)
+	steps = append(steps,
+		cmd.LESetPeriodicAdvertisingEnable{Enable: 1, AdvertisingHandle: p.Handle},
+		cmd.LESetExtendedAdvertisingEnable{Enable: 1, Sets: []cmd.ExtAdvSet{{AdvertisingHandle: p.Handle}}},
+	)
+	for _, c := range steps {
+		if err := h.cmd.SendAndCheckResp(c, expSuccess); err != nil {
+			h.cmd.SendAndCheckResp(cmd.LERemoveAdvertisingSet{AdvertisingHandle: p.Handle}, expSuccess)
+			return err
+		}
+	}
+	h.period.sets[p.Handle] = true
+	return nil
+}
+
+// periodicData returns the commands setting the periodic advertising data
+// of the set of handle to b, fragmented as the commands take no more than
+// cmd.MaxPeriodicAdvFragmentLength bytes each.
+func periodicData(handle uint8, b []byte) []cmd.CmdParam {
+	var cs []cmd.CmdParam
+	op := uint8(cmd.ExtAdvFirstFragment)
+	for {
+		n := len(b)
+		if n > cmd.MaxPeriodicAdvFragmentLength {
+			n = cmd.MaxPeriodicAdvFragmentLength
+		}
+		switch last := n == len(b); {
+		case last && op == cmd.ExtAdvFirstFragment:
+			op = cmd.ExtAdvCompleteData
+		case last:
+			op = cmd.ExtAdvLastFragment
+		}
+		cs = append(cs, cmd.LESetPeriodicAdvertisingData{AdvertisingHandle: handle, Operation: op, AdvertisingData: b[:n]})
+		if b = b[n:]; len(b) == 0 {
+			return cs
+		}
+		op = cmd.ExtAdvIntermediateFragment
+	}
+}
+
+// SetPeriodicAdvertisingData sets the data of the train of the set of
+// handle, from the next periodic event on. The controller takes
+// fragmented data only while the train is disabled: data longer than a
+// single command has it disabled meanwhile, and periodic events missed.
+func (h HCI) SetPeriodicAdvertisingData(handle uint8, data []byte) error {
+	max, err := h.checkPeriodic()
+	if err != nil {
+		return err
+	}
+	if err := checkRange("Data length", len(data), 0, max); err != nil {
+		return err
+	}
+	h.period.mu.Lock()
+	defer h.period.mu.Unlock()
+	if !h.period.sets[handle] {
+		return fmt.Errorf("hci: periodic advertising set %d not started", handle)
+	}
+	steps := periodicData(handle, data)
+	if len(steps) > 1 {
+		steps = append([]cmd.CmdParam{cmd.LESetPeriodicAdvertisingEnable{AdvertisingHandle: handle}}, steps...)
+		steps = append(steps, cmd.LESetPeriodicAdvertisingEnable{Enable: 1, AdvertisingHandle: handle})
+	}
+	for _, c := range steps {
+		if err := h.cmd.SendAndCheckResp(c, expSuccess); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StopPeriodicAdvertising stops the train of the set of handle, and
+// removes the set.
+func (h HCI) StopPeriodicAdvertising(handle uint8) error {
+	h.period.mu.Lock()
+	defer h.period.mu.Unlock()
+	if !h.period.sets[handle] {
+		return nil
+	}
+	for _, c := range []cmd.CmdParam{
+		cmd.LESetPeriodicAdvertisingEnable{AdvertisingHandle: handle},
+		cmd.LESetExtendedAdvertisingEnable{Sets: []cmd.ExtAdvSet{{AdvertisingHandle: handle}}},
+		cmd.LERemoveAdvertisingSet{AdvertisingHandle: handle},
+	} {
+		if err := h.cmd.SendAndCheckResp(c, expSuccess); err != nil {
+			return err
+		}
+	}
+	delete(h.period.sets, handle)
+	return nil
+}
+
+// CreatePeriodicSync synchronizes to the periodic advertising train of p,
+// scanning for it with the extended scanning commands, and returns the
+// sync once established; Report is called with the data of the train from
+// then on, until TerminatePeriodicSync is called, or the sync is lost.
+// Without a deadline, ctx is given a minute. A single sync is established
+// at a time; legacy scanning, which the controller does not take along
+// with the periodic advertising commands, must be stopped.
+func (h HCI) CreatePeriodicSync(ctx context.Context, p PeriodicSyncParameters) (PeriodicSync, error) {
+	if _, err := h.checkPeriodic(); err != nil {
+		return PeriodicSync{}, err
+	}
+	for _, err := range []error{
+		checkRange("SID", int(p.SID), 0, 15),
+		checkRange("AddressType", int(p.AddressType), AddrPublic, AddrRandom),
+		checkRange("Skip", int(p.Skip), 0, 0x01F3),
+		checkRange("Timeout in ms", int(p.Timeout/time.Millisecond), 100, 163840),
+	} {
+		if err != nil {
+			return PeriodicSync{}, err
+		}
+	}
+	if p.Report == nil {
+		return PeriodicSync{}, errors.New("hci: periodic sync without a Report function")
+	}
+	if h.roles.isScanning() {
+		return PeriodicSync{}, errors.New("hci: periodic sync while scanning with the legacy commands")
+	}
+	if err := h.unmaskLE(periodicLEEventMask); err != nil {
+		return PeriodicSync{}, err
+	}
+	c := make(chan *event.LEPeriodicAdvertisingSyncEstablishedEP, 1)
+	h.period.mu.Lock()
+	if h.period.pending != nil {
+		h.period.mu.Unlock()
+		return PeriodicSync{}, errors.New("hci: periodic sync already being established")
+	}
+	h.period.pending = c
+	h.period.mu.Unlock()
+	defer func() {
+		h.period.mu.Lock()
+		defer h.period.mu.Unlock()
+		h.period.pending = nil
+	}()
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, periodicSyncScanTimeout)
+		defer cancel()
+	}
+
+	if err := h.cmd.SendAndCheckResp(cmd.LEPeriodicAdvertisingCreateSync{
+		AdvertisingSID:        p.SID,
+		AdvertiserAddressType: p.AddressType,
+		AdvertiserAddress:     p.Address,
+		Skip:                  p.Skip,
+		SyncTimeout:           uint16(p.Timeout / (10 * time.Millisecond)),
+	}, expSuccess); err != nil {
+		return PeriodicSync{}, err
+	}
+	if err := h.setExtScan(true); err != nil {
+		h.cmd.SendAndCheckResp(cmd.LEPeriodicAdvertisingCreateSyncCancel{}, expSuccess)
+		return PeriodicSync{}, err
+	}
+	defer h.setExtScan(false)
+	select {
+	case ep := <-c:
+		return h.established(ep, p)
+	case <-ctx.Done():
+	}
+	// Canceled, the controller completes the sync with Operation
+	// Cancelled by Host, unless it was just established.
+	if err := h.cmd.SendAndCheckResp(cmd.LEPeriodicAdvertisingCreateSyncCancel{}, expSuccess); err != nil {
+		return PeriodicSync{}, err
+	}
+	select {
+	case ep := <-c:
+		if ep.Status == statusCanceledByHost {
+			return PeriodicSync{}, ctx.Err()
+		}
+		return h.established(ep, p)
+	case <-time.After(time.Second):
+		return PeriodicSync{}, ctx.Err()
+	}
+}
+
+// established records the sync of ep, unless it failed.
+func (h HCI) established(ep *event.LEPeriodicAdvertisingSyncEstablishedEP, p PeriodicSyncParameters) (PeriodicSync, error) {
+	if ep.Status != 0x00 {
+		return PeriodicSync{}, cmd.ErrCommandFailed{Opcode: cmd.LEPeriodicAdvertisingCreateSync{}.Opcode(), Status: ep.Status}
+	}
+	h.period.mu.Lock()
+	h.period.syncs[ep.SyncHandle] = &periodicSync{report: p.Report, lost: p.Lost}
+	h.period.mu.Unlock()
+	return PeriodicSync{
+		Handle:        ep.SyncHandle,
+		SID:           ep.AdvertisingSID,
+		Address:       ep.AdvertiserAddress,
+		AddressType:   ep.AdvertiserAddressType,
+		PHY:           ep.AdvertiserPHY,
+		Interval:      ep.PeriodicAdvInterval,
+		ClockAccuracy: ep.AdvertiserClockAcc,
+	}, nil
+}
+
+// setExtScan enables, or disables, passive extended scanning on the LE 1M
+// PHY, for the train to be found.
+func (h HCI) setExtScan(on bool) error {
+	if !on {
+		return h.cmd.SendAndCheckResp(cmd.LESetExtendedScanEnable{}, expSuccess)
+	}
+	if err := h.cmd.SendAndCheckResp(cmd.LESetExtendedScanParameters{
+		ScanningPHYs: 0x01,
+		PHYs:         []cmd.ExtScanPHY{{ScanInterval: h.scanInterval, ScanWindow: h.scanWindow}},
+	}, expSuccess); err != nil {
+		return err
+	}
+	return h.cmd.SendAndCheckResp(cmd.LESetExtendedScanEnable{Enable: 1}, expSuccess)
+}
+
+// TerminatePeriodicSync stops synchronizing to the train of the sync of
+// handle.
+func (h HCI) TerminatePeriodicSync(handle uint16) error {
+	if err := h.cmd.SendAndCheckResp(cmd.LEPeriodicAdvertisingTerminateSync{SyncHandle: handle}, expSuccess); err != nil {
+		return err
+	}
+	h.period.mu.Lock()
+	defer h.period.mu.Unlock()
+	delete(h.period.syncs, handle)
+	return nil
+}
+
+// handlePeriodic handles the periodic advertising LE subevents.
+func (h HCI) handlePeriodic(b []byte) error {
+	switch event.LEEventCode(b[0]) {
+	case event.LEPeriodicAdvertisingSyncEstablished:
+		ep := &event.LEPeriodicAdvertisingSyncEstablishedEP{}
+		if err := ep.Unmarshal(b); err != nil {
+			return err
+		}
+		h.period.mu.Lock()
+		c := h.period.pending
+		h.period.mu.Unlock()
+		if c != nil {
+			select {
+			case c <- ep:
+			default:
+			}
+		}
+	case event.LEPeriodicAdvertisingReport:
+		ep := &event.LEPeriodicAdvertisingReportEP{}
+		if err := ep.Unmarshal(b); err != nil {
+			return err
+		}
+		h.period.mu.Lock()
+		s := h.period.syncs[ep.SyncHandle]
+		if s == nil {
+			h.period.mu.Unlock()
+			return nil
+		}
+		s.data = append(s.data, ep.Data...)
+		if ep.DataStatus == periodicDataIncomplete {
+			h.period.mu.Unlock()
+			return nil
+		}
+		r := PeriodicReport{
+			Handle:    ep.SyncHandle,
+			TxPower:   ep.TxPower,
+			RSSI:      ep.RSSI,
+			Truncated: ep.DataStatus == periodicDataTruncated,
+			Data:      s.data,
+		}
+		s.data = nil
+		h.period.mu.Unlock()
+		h.call("periodic report", func() { s.report(r) })
+	case event.LEPeriodicAdvertisingSyncLost:
+		ep := &event.LEPeriodicAdvertisingSyncLostEP{}
+		if err := ep.Unmarshal(b); err != nil {
+			return err
+		}
+		h.period.mu.Lock()
+		s := h.period.syncs[ep.SyncHandle]
+		delete(h.period.syncs, ep.SyncHandle)
+		h.period.mu.Unlock()
+		if s != nil && s.lost != nil {
+			h.call("periodic sync lost", func() { s.lost(ep.SyncHandle) })
+		}
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package linux
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/paypal/gatt/linux/internal/hci"
+)
+
+func TestPeriodicAdvertising(t *testing.T) {
+	h, d := newTestHCI(new(uint64))
+	defer h.Close()
+	data := bytes.Repeat([]byte{'p'}, 300)
+	p := PeriodicAdvertising{Handle: 1, SID: 3, IntervalMin: 80, IntervalMax: 80, Data: data}
+	if err := h.StartPeriodicAdvertising(p); !errors.Is(err, hci.ErrUnsupported) {
+		t.Errorf("StartPeriodicAdvertising without the feature = %v, want ErrUnsupported", err)
+	}
+	h.caps.mu.Lock()
+	h.caps.caps.LEFeatures |= leExtendedAdvertising | lePeriodicAdvertising
+	h.caps.mu.Unlock()
+	if err := h.StartPeriodicAdvertising(PeriodicAdvertising{Handle: 0, IntervalMin: 80, IntervalMax: 80}); err == nil {
+		t.Error("StartPeriodicAdvertising of the set of the advertiser succeeded")
+	}
+
+	if err := h.StartPeriodicAdvertising(p); err != nil {
+		t.Fatal(err)
+	}
+	waitSent(t, d,
+		"LE Set Extended Advertising Parameters 1",
+		"LE Set Periodic Advertising Parameters 1",
+		"LE Set Periodic Advertising Data 1",
+		"LE Set Periodic Advertising Data 1",
+		"LE Set Periodic Advertising Enable 1",
+		"LE Set Extended Advertising Enable 1",
+	)
+	if err := h.SetPeriodicAdvertisingData(1, []byte("short")); err != nil {
+		t.Fatal(err)
+	}
+	waitSent(t, d, "LE Set Periodic Advertising Data 1")
+	if err := h.StopPeriodicAdvertising(1); err != nil {
+		t.Fatal(err)
+	}
+	waitSent(t, d,
+		"LE Set Periodic Advertising Enable 0",
+		"LE Set Extended Advertising Enable 0",
+		"LE Remove Advertising Set 1",
+	)
+}
+
+func TestPeriodicSync(t *testing.T) {
+	h, d := newTestHCI(new(uint64))
+	defer h.Close()
+	h.caps.mu.Lock()
+	h.caps.caps.LEFeatures |= lePeriodicAdvertising
+	h.caps.mu.Unlock()
+	reports := make(chan PeriodicReport, 1)
+	lost := make(chan uint16, 1)
+	p := PeriodicSyncParameters{
+		SID:     3,
+		Address: [6]byte{1, 2, 3, 4, 5, 6},
+		Timeout: time.Second,
+		Report:  func(r PeriodicReport) { reports <- r },
+		Lost:    func(handle uint16) { lost <- handle },
+	}
+
+	go func() {
+		waitSent(t, d,
+			"LE Set Event Mask 95",
+			"LE Periodic Advertising Create Sync 0",
+			"LE Set Extended Scan Parameters 0",
+			"LE Set Extended Scan Enable 1",
+		)
+		d.rc <- []byte{0x04, 0x3E, 0x10, 0x0E, 0x00, 0x01, 0x00, 3, 0x00, 6, 5, 4, 3, 2, 1, 0x01, 0x50, 0x00, 0x00}
+	}()
+	s, err := h.CreatePeriodicSync(context.Background(), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Handle != 1 || s.SID != 3 || s.Address != p.Address || s.Interval != 0x50 {
+		t.Errorf("sync = %+v, want that of the train", s)
+	}
+	waitSent(t, d, "LE Set Extended Scan Enable 0")
+
+	// The data of an event, reported in two fragments, is delivered once.
+	d.rc <- []byte{0x04, 0x3E, 0x0A, 0x0F, 0x01, 0x00, 0x7F, 0xC4, 0xFF, 0x01, 2, 'a', 'b'}
+	d.rc <- []byte{0x04, 0x3E, 0x09, 0x0F, 0x01, 0x00, 0x7F, 0xC4, 0xFF, 0x00, 1, 'c'}
+	select {
+	case r := <-reports:
+		if r.Handle != 1 || r.RSSI != -60 || string(r.Data) != "abc" || r.Truncated {
+			t.Errorf("report = %+v, want the data abc", r)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("report not delivered")
+	}
+	d.rc <- []byte{0x04, 0x3E, 0x03, 0x10, 0x01, 0x00}
+	select {
+	case handle := <-lost:
+		if handle != 1 {
+			t.Errorf("lost sync 0x%04X, want 0x0001", handle)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("sync loss not delivered")
+	}
+}
+
+func TestPeriodicSyncCanceled(t *testing.T) {
+	h, d := newTestHCI(new(uint64))
+	defer h.Close()
+	h.caps.mu.Lock()
+	h.caps.caps.LEFeatures |= lePeriodicAdvertising
+	h.caps.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	go func() {
+		waitSent(t, d,
+			"LE Set Event Mask 95",
+			"LE Periodic Advertising Create Sync 0",
+			"LE Set Extended Scan Parameters 0",
+			"LE Set Extended Scan Enable 1",
+			"LE Periodic Advertising Create Sync Cancel",
+		)
+		d.rc <- []byte{0x04, 0x3E, 0x10, 0x0E, statusCanceledByHost, 0x00, 0x00, 3, 0x00, 6, 5, 4, 3, 2, 1, 0x01, 0x50, 0x00, 0x00}
+	}()
+	_, err := h.CreatePeriodicSync(ctx, PeriodicSyncParameters{SID: 3, Timeout: time.Second, Report: func(PeriodicReport) {}})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("CreatePeriodicSync = %v, want the deadline exceeded", err)
+	}
+}
@@ -0,0 +1,19 @@
+package linux
+
+// PHYs preferred by the SetPHY of a connection, which may be combined.
+const (
+	PreferPHY1M    = 1 << 0
+	PreferPHY2M    = 1 << 1
+	PreferPHYCoded = 1 << 2
+)
+
+// Codings of the Coded PHY preferred by the SetPHY of a connection.
+const (
+	PHYCodingAny = 0x0000
+	PHYCodingS2  = 0x0001
+	PHYCodingS8  = 0x0002
+)
+
+// PHYCoded is the PHY reported by the ReadPHY, and the PHY updates, of a
+// connection on the Coded PHY, of either coding.
+const PHYCoded = 0x03
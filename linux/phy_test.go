@@ -0,0 +1,40 @@
+package linux
+
+import (
+	"testing"
+	"time"
+
+	"github.com/paypal/gatt/linux/internal/cmd"
+)
+
+func TestPHY(t *testing.T) {
+	h, d := newTestHCI(new(uint64))
+	defer h.Close()
+	d.mu.Lock()
+	d.rsp = map[cmd.Opcode][]byte{(cmd.LEReadPHY{}).Opcode(): {0x40, 0x00, 0x01, 0x01}}
+	d.mu.Unlock()
+	d.rc <- connCompletePkt
+	c := <-h.l2c.ConnC()
+
+	if tx, rx, err := c.ReadPHY(); err != nil || tx != PHY1M || rx != PHY1M {
+		t.Fatalf("ReadPHY = %d, %d, %v; want 1M, 1M", tx, rx, err)
+	}
+
+	type update struct{ status, tx, rx uint8 }
+	d.sent()
+	updates := make(chan update, 1)
+	c.OnPHYUpdate(func(status, tx, rx uint8) { updates <- update{status, tx, rx} })
+	if err := c.SetPHY(PreferPHY2M, PreferPHY2M|PreferPHYCoded, PHYCodingS8); err != nil {
+		t.Fatalf("SetPHY = %v", err)
+	}
+	waitSent(t, d, "LE Set PHY 64")
+	d.rc <- []byte{0x04, 0x3E, 0x06, 0x0C, 0x00, 0x40, 0x00, 0x02, 0x03} // LE PHY Update Complete
+	select {
+	case u := <-updates:
+		if u != (update{0x00, PHY2M, PHYCoded}) {
+			t.Errorf("update = %+v, want 2M, Coded", u)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("PHY update not delivered")
+	}
+}
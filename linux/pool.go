@@ -0,0 +1,49 @@
+package linux
+
+import (
+	"sync"
+	"time"
+)
+
+// maxPooledPacket is the size of the buffers pooled: ACL data packets of
+// up to 1021 bytes of data, the most controllers send, fit, their packet
+// type and header first.
+const maxPooledPacket = 1 + 4 + 1021
+
+// packetBufs pools the buffers of the ACL data packets read from the
+// devices, for the notifications of peers not to cost an allocation
+// each. The events are copied into buffers of their own, as their
+// handlers may keep them, e.g. the return parameters of commands.
+var packetBufs = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, maxPooledPacket)
+		return &b
+	},
+}
+
+// A packet is one read from the device, at at. buf is the pooled buffer
+// b is held in, if any, released once the packet is done with.
+type packet struct {
+	b   []byte
+	buf *[]byte
+	at  time.Time
+}
+
+// readPacket returns a copy of b, read from the device at at, in a pooled
+// buffer if it is ACL data that fits.
+func readPacket(b []byte, at time.Time) packet {
+	if len(b) == 0 || PacketType(b[0]) != ptypeACLDataPkt || len(b) > maxPooledPacket {
+		return packet{b: append([]byte(nil), b...), at: at}
+	}
+	buf := packetBufs.Get().(*[]byte)
+	return packet{b: (*buf)[:copy(*buf, b)], buf: buf, at: at}
+}
+
+// release releases the buffer of pk, if pooled, for it to be reused.
+func (pk packet) release() { releasePacket(pk.buf) }
+
+func releasePacket(buf *[]byte) {
+	if buf != nil {
+		packetBufs.Put(buf)
+	}
+}
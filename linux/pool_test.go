@@ -0,0 +1,79 @@
+package linux
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestPooledACL(t *testing.T) {
+	var n uint64
+	h, d := newTestHCI(&n)
+	defer h.Close()
+	h.SetDropPolicy(WaitWhenFull) // the burst outruns the reader
+	d.rc <- connCompletePkt
+	c := <-h.l2c.ConnC()
+	defer func() { d.rc <- []byte{0x04, 0x05, 0x04, 0x00, 0x40, 0x00, 0x13} }() // Disconnection Complete
+
+	// The buffers are reused as the packets go, without overwriting
+	// those not read yet.
+	go func() {
+		for i := 0; i < 500; i++ {
+			if i%50 == 0 {
+				d.rc <- []byte{0x02, 0x40, 0x20, 0x09, 0x00, 0x01} // malformed: dropped
+			}
+			d.rc <- notificationPkt(bytes.Repeat([]byte{byte(i)}, 1+i%200))
+		}
+	}()
+	buf := make([]byte, 512)
+	for i := 0; i < 500; i++ {
+		m, err := c.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := notificationPkt(bytes.Repeat([]byte{byte(i)}, 1+i%200))[9:]; !bytes.Equal(buf[:m], want) {
+			t.Fatalf("notification %d = [% X], want [% X]", i, buf[:m], want)
+		}
+	}
+	if got := h.Malformed(); got != 10 {
+		t.Errorf("Malformed() = %d, want 10", got)
+	}
+
+	if pk := readPacket([]byte{0x04, 0x0E, 0x01, 0x00}, time.Now()); pk.buf != nil {
+		t.Error("event read into a pooled buffer")
+	}
+	long := make([]byte, maxPooledPacket+1)
+	long[0] = 0x02
+	if pk := readPacket(long, time.Now()); pk.buf != nil {
+		t.Error("ACL data too long read into a pooled buffer")
+	}
+}
+
+func TestReadTimed(t *testing.T) {
+	h, d := newTestHCI(new(uint64))
+	defer h.Close()
+	d.rc <- connCompletePkt
+	c := <-h.l2c.ConnC()
+	defer func() { d.rc <- []byte{0x04, 0x05, 0x04, 0x00, 0x40, 0x00, 0x13} }() // Disconnection Complete
+
+	// A PDU is received when its last fragment is.
+	pdu := notificationPkt([]byte("value"))[5:]
+	start := append([]byte{0x02, 0x40, 0x20, 6, 0x00}, pdu[:6]...)
+	cont := append([]byte{0x02, 0x40, 0x10, byte(len(pdu) - 6), 0x00}, pdu[6:]...)
+	t0 := time.Now().Add(-time.Second)
+	go func() {
+		h.handle(packet{b: start, at: t0})
+		h.handle(packet{b: cont, at: t0.Add(time.Millisecond)})
+	}()
+	b := make([]byte, 64)
+	n, at, err := c.ReadTimed(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b[:n], pdu[4:]) {
+		t.Errorf("ReadTimed = [% X], want [% X]", b[:n], pdu[4:])
+	}
+	if want := t0.Add(time.Millisecond); !at.Equal(want) {
+		t.Errorf("ReadTimed at %v, want %v, that of the last fragment", at, want)
+	}
+}
@@ -0,0 +1,314 @@
+package linux
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/paypal/gatt/linux/internal/cmd"
+	"github.com/paypal/gatt/linux/internal/event"
+)
+
+// PHYs the transmit power levels are read for.
+const (
+	PHY1M      = 0x01
+	PHY2M      = 0x02
+	PHYCodedS8 = 0x03
+	PHYCodedS2 = 0x04
+)
+
+// Reasons of a TxPowerReport.
+const (
+	TxPowerLocalChanged  = 0x00 // the local transmit power level changed
+	TxPowerRemoteChanged = 0x01 // the remote transmit power level changed
+	TxPowerRemoteRead    = 0x02 // ReadRemoteTxPower completed
+)
+
+// TxPowerUnavailable is the level of a TxPowerReport when the transmit
+// power level is not available, or not managed.
+const TxPowerUnavailable = 0x7F
+
+// A PathLossZone is the zone the path loss of a connection is in, relative
+// to the thresholds it is monitored with.
+type PathLossZone uint8
+
+const (
+	PathLossLow    PathLossZone = 0x00
+	PathLossMiddle PathLossZone = 0x01
+	PathLossHigh   PathLossZone = 0x02
+)
+
+func (z PathLossZone) String() string {
+	switch z {
+	case PathLossLow:
+		return "low"
+	case PathLossMiddle:
+		return "middle"
+	case PathLossHigh:
+		return "high"
+	}
+	return fmt.Sprintf("zone 0x%02X", uint8(z))
+}
+
+// PathLossThresholds are the thresholds, in dB, the path loss of a
+// connection is monitored with. The high zone is entered above
+// High+HighHysteresis, and left below High-HighHysteresis; the low zone
+// likewise around Low. A zone is entered only once the path loss has
+// stayed in it for MinTime connection events.
+type PathLossThresholds struct {
+	High, HighHysteresis uint8
+	Low, LowHysteresis   uint8
+	MinTime              uint16
+}
+
+// A TxPowerReport reports the transmit power level, in dBm, of either end
+// of a connection, on a PHY, and its change since the previous report.
+type TxPowerReport struct {
+	Handle uint16
+	Reason uint8
+	PHY    uint8
+	Level  int8
+	Flag   uint8 // bit 0: at the minimum level; bit 1: at the maximum
+	Delta  int8
+}
+
+const (
+	powerLEEventMask = 0x3 << 31 // LE subevents 0x20 - 0x21
+	powerTimeout     = 5 * time.Second
+
+	lePowerControlRequest = 1 << 33 // LE Power Control Request feature
+	lePathLossMonitoring  = 1 << 35 // LE Path Loss Monitoring feature
+)
+
+type powerState struct {
+	mu       sync.Mutex
+	features uint64
+	pathLoss map[uint16]func(handle uint16, pathLoss uint8, zone PathLossZone)
+	reports  func(r TxPowerReport)
+	remote   map[uint16]chan *event.LETransmitPowerReportingEP
+}
+
+func newPowerState() *powerState {
+	return &powerState{
+		pathLoss: map[uint16]func(handle uint16, pathLoss uint8, zone PathLossZone){},
+		remote:   map[uint16]chan *event.LETransmitPowerReportingEP{},
+	}
+}
+
+// supports returns an error unless the controller has reported feature f.
+func (s *powerState) supports(f uint64, what string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.features&f == 0 {
+		return unsupported(what)
+	}
+	return nil
+}
+
+// forget drops the state of a connection once it is disconnected.
+func (s *powerState) forget(handle uint16) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.pathLoss, handle)
+}
+
+// EnablePowerControl checks that the controller supports LE Power Control
+// or Path Loss Monitoring (Bluetooth 5.2), and unmasks their LE events. It
+// must be called, after Start, before any other power control call.
+//
+// Once LE Power Control is supported, the controllers at both ends of a
+// link adjust their transmit power on their own, as the signal strength
+// they receive varies; the calls here only read, and report, the levels
+// they settle on.
+func (h HCI) EnablePowerControl() error {
+	b, err := h.cmd.Send(cmd.LEReadLocalSupportedFeatures{})
+	if err != nil {
+		return err
+	}
+	rp := cmd.LEReadLocalSupportedFeaturesRP{}
+	if err := binary.Read(bytes.NewBuffer(b), binary.LittleEndian, &rp); err != nil {
+		return err
+	}
+	if rp.Status != 0x00 {
+		return cmd.ErrCommandFailed{Opcode: cmd.LEReadLocalSupportedFeatures{}.Opcode(), Status: rp.Status}
+	}
+	if rp.LEFeatures&(lePowerControlRequest|lePathLossMonitoring) == 0 {
+		return unsupported("LE power control")
+	}
+	if err := h.unmaskLE(powerLEEventMask); err != nil {
+		return err
+	}
+	h.power.mu.Lock()
+	defer h.power.mu.Unlock()
+	h.power.features = rp.LEFeatures
+	return nil
+}
+
+// ReadTxPower reads the current, and maximum, transmit power levels of the
+// local end of a connection on a PHY, in dBm.
+func (h HCI) ReadTxPower(handle uint16, phy uint8) (cur, max int8, err error) {
+	if err := h.power.supports(lePowerControlRequest, "LE power control"); err != nil {
+		return 0, 0, err
+	}
+	c := cmd.LEEnhancedReadTransmitPowerLevel{ConnectionHandle: handle, PHY: phy}
+	b, err := h.cmd.Send(c)
+	if err != nil {
+		return 0, 0, err
+	}
+	rp := cmd.LEEnhancedReadTransmitPowerLevelRP{}
+	if err := binary.Read(bytes.NewBuffer(b), binary.LittleEndian, &rp); err != nil {
+		return 0, 0, err
+	}
+	if rp.Status != 0x00 {
+		return 0, 0, cmd.ErrCommandFailed{Opcode: c.Opcode(), Status: rp.Status}
+	}
+	return rp.CurrentTxPowerLevel, rp.MaxTxPowerLevel, nil
+}
+
+// ReadRemoteTxPower reads the transmit power level of the remote end of a
+// connection on a PHY, and waits for the controller to report it.
+func (h HCI) ReadRemoteTxPower(handle uint16, phy uint8) (TxPowerReport, error) {
+	if err := h.power.supports(lePowerControlRequest, "LE power control"); err != nil {
+		return TxPowerReport{}, err
+	}
+	c := make(chan *event.LETransmitPowerReportingEP, 1)
+	h.power.mu.Lock()
+	if h.power.remote[handle] != nil {
+		h.power.mu.Unlock()
+		return TxPowerReport{}, fmt.Errorf("hci: remote transmit power of 0x%04X already being read", handle)
+	}
+	h.power.remote[handle] = c
+	h.power.mu.Unlock()
+	defer func() {
+		h.power.mu.Lock()
+		defer h.power.mu.Unlock()
+		delete(h.power.remote, handle)
+	}()
+
+	p := cmd.LEReadRemoteTransmitPowerLevel{ConnectionHandle: handle, PHY: phy}
+	if err := h.cmd.SendAndCheckResp(p, expSuccess); err != nil {
+		return TxPowerReport{}, err
+	}
+	select {
+	case ep := <-c:
+		if ep.Status != 0x00 {
+			return TxPowerReport{}, cmd.ErrCommandFailed{Opcode: p.Opcode(), Status: ep.Status}
+		}
+		return txPowerReport(ep), nil
+	case <-time.After(powerTimeout):
+		return TxPowerReport{}, errors.New("hci: read remote transmit power timed out")
+	}
+}
+
+// ReportTxPower enables, or disables, the reports of the changes of the
+// transmit power levels of the local, and remote, ends of a connection,
+// delivered to the function registered by HandleTxPowerReports.
+func (h HCI) ReportTxPower(handle uint16, local, remote bool) error {
+	if err := h.power.supports(lePowerControlRequest, "LE power control"); err != nil {
+		return err
+	}
+	l, r := uint8(0x00), uint8(0x00)
+	if local {
+		l = 0x01
+	}
+	if remote {
+		r = 0x01
+	}
+	return h.cmd.SendAndCheckResp(cmd.LESetTransmitPowerReportingEnable{ConnectionHandle: handle, LocalEnable: l, RemoteEnable: r}, expSuccess)
+}
+
+// HandleTxPowerReports registers the function the transmit power reports
+// enabled by ReportTxPower are delivered to.
+func (h HCI) HandleTxPowerReports(f func(r TxPowerReport)) {
+	h.power.mu.Lock()
+	defer h.power.mu.Unlock()
+	h.power.reports = f
+}
+
+// MonitorPathLoss monitors the path loss of a connection, the difference
+// between the transmit power of the remote end and the signal strength
+// received, against thresholds, and calls f, with the path loss in dB, as
+// it enters a zone. Monitoring stops once the connection is disconnected.
+func (h HCI) MonitorPathLoss(handle uint16, t PathLossThresholds, f func(handle uint16, pathLoss uint8, zone PathLossZone)) error {
+	if err := checkPathLoss(t); err != nil {
+		return err
+	}
+	if err := h.power.supports(lePathLossMonitoring, "path loss monitoring"); err != nil {
+		return err
+	}
+	if err := h.cmd.SendAndCheckResp(cmd.LESetPathLossReportingParameters{
+		ConnectionHandle: handle,
+		HighThreshold:    t.High,
+		HighHysteresis:   t.HighHysteresis,
+		LowThreshold:     t.Low,
+		LowHysteresis:    t.LowHysteresis,
+		MinTimeSpent:     t.MinTime,
+	}, expSuccess); err != nil {
+		return err
+	}
+	h.power.mu.Lock()
+	h.power.pathLoss[handle] = f
+	h.power.mu.Unlock()
+	if err := h.cmd.SendAndCheckResp(cmd.LESetPathLossReportingEnable{ConnectionHandle: handle, Enable: 1}, expSuccess); err != nil {
+		h.power.forget(handle)
+		return err
+	}
+	return nil
+}
+
+// StopPathLoss stops monitoring the path loss of a connection.
+func (h HCI) StopPathLoss(handle uint16) error {
+	h.power.forget(handle)
+	return h.cmd.SendAndCheckResp(cmd.LESetPathLossReportingEnable{ConnectionHandle: handle, Enable: 0}, expSuccess)
+}
+
+func (h HCI) handlePathLoss(b []byte) error {
+	ep := &event.LEPathLossThresholdEP{}
+	if err := ep.Unmarshal(b); err != nil {
+		return err
+	}
+	h.power.mu.Lock()
+	f := h.power.pathLoss[ep.ConnectionHandle]
+	h.power.mu.Unlock()
+	if f != nil {
+		h.call("path loss", func() { f(ep.ConnectionHandle, ep.CurrentPathLoss, PathLossZone(ep.ZoneEntered)) })
+	}
+	return nil
+}
+
+func (h HCI) handleTxPowerReport(b []byte) error {
+	ep := &event.LETransmitPowerReportingEP{}
+	if err := ep.Unmarshal(b); err != nil {
+		return err
+	}
+	h.power.mu.Lock()
+	c, f := h.power.remote[ep.ConnectionHandle], h.power.reports
+	h.power.mu.Unlock()
+	if ep.Reason == TxPowerRemoteRead {
+		if c != nil {
+			select {
+			case c <- ep:
+			default: // already reported
+			}
+		}
+		return nil
+	}
+	if f != nil && ep.Status == 0x00 {
+		h.call("transmit power report", func() { f(txPowerReport(ep)) })
+	}
+	return nil
+}
+
+func txPowerReport(ep *event.LETransmitPowerReportingEP) TxPowerReport {
+	return TxPowerReport{
+		Handle: ep.ConnectionHandle,
+		Reason: ep.Reason,
+		PHY:    ep.PHY,
+		Level:  ep.TxPowerLevel,
+		Flag:   ep.TxPowerLevelFlag,
+		Delta:  ep.Delta,
+	}
+}
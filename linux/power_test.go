@@ -0,0 +1,96 @@
+package linux
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/paypal/gatt/linux/internal/cmd"
+)
+
+// setFeatures makes the controller of h report the LE features f.
+func setFeatures(d *fakeDevice, f uint64) {
+	op := (cmd.LEReadLocalSupportedFeatures{}).Opcode()
+	d.mu.Lock()
+	d.rsp = map[cmd.Opcode][]byte{op: make([]byte, 8)}
+	binary.LittleEndian.PutUint64(d.rsp[op], f)
+	d.mu.Unlock()
+}
+
+func TestPowerControl(t *testing.T) {
+	h, d := newTestHCI(new(uint64))
+	defer h.Close()
+
+	setFeatures(d, 1<<0)
+	if err := h.EnablePowerControl(); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("EnablePowerControl without the feature: got %v, want ErrUnsupported", err)
+	}
+	if _, _, err := h.ReadTxPower(0x40, PHY1M); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("ReadTxPower once not enabled: got %v, want ErrUnsupported", err)
+	}
+
+	setFeatures(d, lePowerControlRequest|lePathLossMonitoring)
+	if err := h.EnablePowerControl(); err != nil {
+		t.Fatal(err)
+	}
+	waitSent(t, d, "LE Read Local Supported Features", "LE Read Local Supported Features", "LE Set Event Mask 95")
+	if h.masks.le != defaultLEEventMask|powerLEEventMask {
+		t.Errorf("LE event mask 0x%X, want 0x%X", h.masks.le, uint64(defaultLEEventMask|powerLEEventMask))
+	}
+
+	// LE Transmit Power Reporting, read remote completed, at 4 dBm.
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		d.rc <- []byte{0x04, 0x3E, 0x09, 0x21, 0x00, 0x40, 0x00, TxPowerRemoteRead, PHY1M, 0x04, 0x00, 0x00}
+	}()
+	r, err := h.ReadRemoteTxPower(0x40, PHY1M)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Handle != 0x40 || r.Level != 4 {
+		t.Errorf("ReadRemoteTxPower: got %+v", r)
+	}
+
+	reports := make(chan TxPowerReport, 1)
+	h.HandleTxPowerReports(func(r TxPowerReport) { reports <- r })
+	d.rc <- []byte{0x04, 0x3E, 0x09, 0x21, 0x00, 0x40, 0x00, TxPowerLocalChanged, PHY1M, 0xFA, 0x00, 0xF6}
+	select {
+	case r := <-reports:
+		if r.Level != -6 || r.Delta != -10 {
+			t.Errorf("report: got %+v, want level -6, and delta -10", r)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("transmit power report not delivered")
+	}
+
+	var e ErrInvalidParameter
+	if err := h.MonitorPathLoss(0x40, PathLossThresholds{High: 40, Low: 30, LowHysteresis: 6, HighHysteresis: 6}, nil); !errors.As(err, &e) {
+		t.Errorf("MonitorPathLoss with overlapping zones: got %v, want an ErrInvalidParameter", err)
+	}
+	d.sent()
+	zones := make(chan PathLossZone, 1)
+	t0 := PathLossThresholds{High: 60, HighHysteresis: 5, Low: 30, LowHysteresis: 5, MinTime: 2}
+	if err := h.MonitorPathLoss(0x40, t0, func(handle uint16, loss uint8, z PathLossZone) { zones <- z }); err != nil {
+		t.Fatal(err)
+	}
+	waitSent(t, d, "LE Set Path Loss Reporting Parameters 64", "LE Set Path Loss Reporting Enable 64")
+	d.rc <- []byte{0x04, 0x3E, 0x05, 0x20, 0x40, 0x00, 70, uint8(PathLossHigh)}
+	select {
+	case z := <-zones:
+		if z != PathLossHigh {
+			t.Errorf("entered the %v zone, want high", z)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("zone change not delivered")
+	}
+
+	// Monitoring stops once disconnected.
+	d.rc <- []byte{0x04, 0x05, 0x04, 0x00, 0x40, 0x00, 0x13}
+	d.rc <- []byte{0x04, 0x3E, 0x05, 0x20, 0x40, 0x00, 20, uint8(PathLossLow)}
+	select {
+	case z := <-zones:
+		t.Errorf("entered the %v zone once disconnected", z)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,90 @@
+package linux
+
+import (
+	"context"
+	"sync"
+
+	"github.com/paypal/gatt/linux/internal/cmd"
+)
+
+// Company identifiers of the manufacturers of controllers, as assigned by
+// the Bluetooth SIG, and reported by the controllers in their version
+// information; see Capabilities.
+const (
+	ManufacturerIntel    = 0x0002
+	ManufacturerCSR      = 0x000A
+	ManufacturerBroadcom = 0x000F
+	ManufacturerRealtek  = 0x005D
+	ManufacturerCypress  = 0x0131
+)
+
+// genericResetSeq sets up the controllers of the manufacturers with no
+// sequence registered: it only enables LE on those supporting BR/EDR as
+// well, and the LE-only ones rejecting the command do not matter.
+var genericResetSeq = []cmdSeq{
+	{cmd.WriteLEHostSupported{LESupportedHost: 1, SimultaneousLEHost: 0}, nil},
+}
+
+// resetSeqs are the sequences the controllers are set up with, once
+// reset, by manufacturer.
+var resetSeqs = struct {
+	mu   sync.Mutex
+	seqs map[uint16][]cmdSeq
+}{seqs: map[uint16][]cmdSeq{
+	ManufacturerBroadcom: bcmResetSeq,
+	ManufacturerCypress:  bcmResetSeq, // formerly Broadcom's
+}}
+
+// RegisterResetSequence registers the commands sent to set up the
+// controllers of the manufacturer, e.g. ManufacturerIntel, once they
+// have been reset, each of which is expected to succeed, in place of
+// those registered before, if any. A nil sequence drops the manufacturer
+// from the registry; an empty one sends none.
+//
+// The sequence of Broadcom, and of Cypress, is registered by default; the
+// controllers of other manufacturers, unless registered, only have LE
+// enabled, as some reject the commands Broadcom takes. The sequence is
+// looked up by the manufacturer the controller reports as the HCI is
+// reset, unless the ResetSequence option sets one.
+func RegisterResetSequence(manufacturer uint16, cmds []Command) {
+	resetSeqs.mu.Lock()
+	defer resetSeqs.mu.Unlock()
+	if cmds == nil {
+		delete(resetSeqs.seqs, manufacturer)
+		return
+	}
+	resetSeqs.seqs[manufacturer] = commandSeq(cmds)
+}
+
+// commandSeq returns the sequence of the raw commands cmds, each of which
+// is expected to succeed.
+func commandSeq(cmds []Command) []cmdSeq {
+	seq := make([]cmdSeq, len(cmds))
+	for i, c := range cmds {
+		seq[i] = cmdSeq{rawCmd{c.Opcode, c.Params}, expSuccess}
+	}
+	return seq
+}
+
+// setupSeq returns the sequence the controller is to be set up with: that
+// of the ResetSequence option, or that registered for its manufacturer,
+// whose version information is kept for the Capabilities.
+func (h HCI) setupSeq(ctx context.Context) []cmdSeq {
+	var v cmd.ReadLocalVersionInformationRP
+	ok := h.read(ctx, cmd.ReadLocalVersionInformation{}, &v)
+	h.caps.mu.Lock()
+	h.caps.version = v
+	h.caps.mu.Unlock()
+	if h.resetSeq != nil {
+		return h.resetSeq
+	}
+	if !ok {
+		return genericResetSeq
+	}
+	resetSeqs.mu.Lock()
+	defer resetSeqs.mu.Unlock()
+	if seq, found := resetSeqs.seqs[v.ManufacturerName]; found {
+		return seq
+	}
+	return genericResetSeq
+}
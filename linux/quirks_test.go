@@ -0,0 +1,50 @@
+package linux
+
+import (
+	"context"
+	"testing"
+
+	"github.com/paypal/gatt/linux/internal/cmd"
+)
+
+func TestResetSequenceByManufacturer(t *testing.T) {
+	RegisterResetSequence(ManufacturerRealtek, []Command{{Opcode: 0xFC61}})
+	defer RegisterResetSequence(ManufacturerRealtek, nil)
+
+	spm, leHost := cmd.WriteSimplePairingMode{}.Opcode(), cmd.WriteLEHostSupported{}.Opcode()
+	for _, tt := range []struct {
+		manufacturer byte
+		opts         []HCIOption
+		want         cmd.Opcode // sent, if not zero
+		unwanted     cmd.Opcode // not sent, if not zero
+	}{
+		{ManufacturerBroadcom, nil, spm, 0},
+		{ManufacturerIntel, nil, leHost, spm},
+		{ManufacturerRealtek, nil, 0xFC61, leHost},
+		{ManufacturerIntel, []HCIOption{ResetSequence([]Command{})}, 0, leHost},
+	} {
+		d := newFakeDevice()
+		d.rsp = map[cmd.Opcode][]byte{
+			cmd.ReadLocalVersionInformation{}.Opcode(): {0x09, 0x00, 0x00, 0x09, tt.manufacturer, 0x00, 0x00, 0x00},
+		}
+		cfg := defaultHCIConfig()
+		for _, opt := range tt.opts {
+			opt(&cfg)
+		}
+		h := newHCI(d, cfg)
+		if err := h.StartCtx(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		sent := map[cmd.Opcode]bool{0: true}
+		for _, b := range d.sent() {
+			sent[cmd.Opcode(uint16(b[1])|uint16(b[2])<<8)] = true
+		}
+		if !sent[tt.want] || tt.unwanted != 0 && sent[tt.unwanted] {
+			t.Errorf("manufacturer 0x%04X: 0x%04X sent: %t, 0x%04X sent: %t", tt.manufacturer, uint16(tt.want), sent[tt.want], uint16(tt.unwanted), sent[tt.unwanted])
+		}
+		if c := h.Capabilities(); c.Manufacturer != int(tt.manufacturer) || c.HCIVersion != 9 {
+			t.Errorf("Capabilities: Manufacturer 0x%04X, HCIVersion %d; want 0x%04X, 9", c.Manufacturer, c.HCIVersion, tt.manufacturer)
+		}
+		h.Close()
+	}
+}
@@ -0,0 +1,185 @@
+package linux
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// A RangingMeasurement is the distance to the peer of a connection, as
+// estimated by a Ranger.
+type RangingMeasurement struct {
+	Handle   uint16    // of the connection
+	Distance float64   // in meters
+	Accuracy float64   // the standard deviation of Distance, in meters; zero if unknown
+	Time     time.Time // when the procedure measuring it completed
+}
+
+// A Ranger implements a ranging procedure of the controller, estimating
+// the distance to the peers of the connections, e.g. the LE Channel
+// Sounding of Bluetooth 6.0, or the round-trip time measurements of a
+// vendor. It is set with SetRanger, and implemented out of the package:
+// the HCI only hands it the commands it issues, and the events of its
+// procedure.
+type Ranger interface {
+	// LEEvents returns the LE subevent codes of the procedure, e.g. 0x31
+	// for the LE CS Subevent Result; SetRanger unmasks them, and they
+	// are handed to HandleEvent from then on.
+	LEEvents() []uint8
+
+	// Start starts ranging with the peer of the connection of handle,
+	// issuing the commands of the procedure with send, which completes
+	// them as SendCommand does.
+	Start(ctx context.Context, send func(ctx context.Context, c Command) ([]byte, error), handle uint16) error
+
+	// Stop stops ranging over the connection of handle.
+	Stop(ctx context.Context, send func(ctx context.Context, c Command) ([]byte, error), handle uint16) error
+
+	// HandleEvent handles an LE Meta event of the procedure, of
+	// parameters b, its subevent code first, and calls report with the
+	// measurements it completes, if any. b may not be kept.
+	HandleEvent(b []byte, report func(m RangingMeasurement)) error
+}
+
+// A VendorRanger is a Ranger whose procedure reports by Vendor Specific
+// events: they are handed to HandleVendorEvent first, of parameters b,
+// and to the HandleVendor function only if not handled.
+type VendorRanger interface {
+	Ranger
+	HandleVendorEvent(b []byte, report func(m RangingMeasurement)) (handled bool, err error)
+}
+
+type rangingState struct {
+	mu      sync.Mutex
+	r       Ranger
+	events  map[uint8]bool                        // LE subevent codes of r
+	reports map[uint16]func(m RangingMeasurement) // of the connections ranged, by handle
+}
+
+func newRangingState() *rangingState {
+	return &rangingState{reports: map[uint16]func(m RangingMeasurement){}}
+}
+
+// forget drops the state of a connection once it is disconnected.
+func (s *rangingState) forget(handle uint16) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.reports, handle)
+}
+
+// ranger returns the Ranger, and whether it handles the LE subevent of
+// code.
+func (s *rangingState) ranger(code uint8) (Ranger, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.r, s.events[code]
+}
+
+// SetRanger sets the Ranger implementing the ranging procedure of the
+// controller, and unmasks its LE events. It must be called, after Start,
+// before StartRanging; nil drops the Ranger, once no connection is
+// ranged.
+func (h HCI) SetRanger(r Ranger) error {
+	events := map[uint8]bool{}
+	var mask uint64
+	if r != nil {
+		for _, code := range r.LEEvents() {
+			if err := checkRange("LE subevent code", int(code), 1, 64); err != nil {
+				return err
+			}
+			events[code] = true
+			mask |= uint64(1) << (code - 1)
+		}
+	}
+	h.ranger.mu.Lock()
+	defer h.ranger.mu.Unlock()
+	if len(h.ranger.reports) > 0 {
+		return fmt.Errorf("hci: setting the ranger while ranging %d connections", len(h.ranger.reports))
+	}
+	if mask != 0 {
+		if err := h.unmaskLE(mask); err != nil {
+			return err
+		}
+	}
+	h.ranger.r, h.ranger.events = r, events
+	return nil
+}
+
+// StartRanging starts ranging with the peer of the connection of handle,
+// with the procedure of the Ranger, which calls f, from a goroutine of the
+// HCI, with each measurement, until StopRanging is called, or the
+// connection is disconnected. It fails with ErrUnsupported if no Ranger
+// is set.
+func (h HCI) StartRanging(ctx context.Context, handle uint16, f func(m RangingMeasurement)) error {
+	h.ranger.mu.Lock()
+	r := h.ranger.r
+	if r == nil {
+		h.ranger.mu.Unlock()
+		return unsupported("ranging")
+	}
+	if _, found := h.ranger.reports[handle]; found {
+		h.ranger.mu.Unlock()
+		return fmt.Errorf("hci: already ranging connection 0x%04X", handle)
+	}
+	h.ranger.reports[handle] = f
+	h.ranger.mu.Unlock()
+	if err := r.Start(ctx, h.SendCommand, handle); err != nil {
+		h.ranger.forget(handle)
+		return err
+	}
+	return nil
+}
+
+// StopRanging stops ranging over the connection of handle.
+func (h HCI) StopRanging(ctx context.Context, handle uint16) error {
+	h.ranger.mu.Lock()
+	r := h.ranger.r
+	_, found := h.ranger.reports[handle]
+	h.ranger.mu.Unlock()
+	if !found {
+		return nil
+	}
+	h.ranger.forget(handle)
+	return r.Stop(ctx, h.SendCommand, handle)
+}
+
+// reportRanging delivers the measurement m to the function of the
+// connection it is of, if still ranged.
+func (h HCI) reportRanging(m RangingMeasurement) {
+	h.ranger.mu.Lock()
+	f := h.ranger.reports[m.Handle]
+	h.ranger.mu.Unlock()
+	if f != nil {
+		h.call("ranging", func() { f(m) })
+	}
+}
+
+// handleRanging hands an LE Meta event of the procedure of the Ranger,
+// of parameters b, to it.
+func (h HCI) handleRanging(r Ranger, b []byte) error {
+	var err error
+	h.call("ranger", func() { err = r.HandleEvent(b, h.reportRanging) })
+	if err != nil {
+		return fmt.Errorf("ranging: %w", err)
+	}
+	return nil
+}
+
+// handleVendorRanging hands a Vendor Specific event, of parameters b, to
+// the Ranger, if a VendorRanger, and reports whether it handled it.
+func (h HCI) handleVendorRanging(b []byte) (bool, error) {
+	h.ranger.mu.Lock()
+	r, ok := h.ranger.r.(VendorRanger)
+	h.ranger.mu.Unlock()
+	if !ok {
+		return false, nil
+	}
+	var handled bool
+	var err error
+	h.call("ranger", func() { handled, err = r.HandleVendorEvent(b, h.reportRanging) })
+	if err != nil {
+		return true, fmt.Errorf("ranging: %w", err)
+	}
+	return handled, nil
+}
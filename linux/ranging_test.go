@@ -0,0 +1,86 @@
+package linux
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeRanger ranges with a vendor command, and reports the distances, in
+// cm, of the LE subevent 0x31, or of the Vendor Specific events of
+// subevent 0x42: handle, distance.
+type fakeRanger struct{}
+
+func (fakeRanger) LEEvents() []uint8 { return []uint8{0x31} }
+
+func (fakeRanger) Start(ctx context.Context, send func(ctx context.Context, c Command) ([]byte, error), handle uint16) error {
+	_, err := send(ctx, Command{Opcode: 0xFC42, Params: []byte{byte(handle), byte(handle >> 8), 1}})
+	return err
+}
+
+func (fakeRanger) Stop(ctx context.Context, send func(ctx context.Context, c Command) ([]byte, error), handle uint16) error {
+	_, err := send(ctx, Command{Opcode: 0xFC42, Params: []byte{byte(handle), byte(handle >> 8), 0}})
+	return err
+}
+
+func (fakeRanger) HandleEvent(b []byte, report func(m RangingMeasurement)) error {
+	if len(b) != 4 {
+		return errors.New("malformed")
+	}
+	report(RangingMeasurement{Handle: uint16(b[1]) | uint16(b[2])<<8, Distance: float64(b[3]) / 100})
+	return nil
+}
+
+func (r fakeRanger) HandleVendorEvent(b []byte, report func(m RangingMeasurement)) (bool, error) {
+	if len(b) == 0 || b[0] != 0x42 {
+		return false, nil
+	}
+	return true, r.HandleEvent(b, report)
+}
+
+func TestRanging(t *testing.T) {
+	h, d := newTestHCI(new(uint64))
+	defer h.Close()
+	if err := h.StartRanging(context.Background(), 0x40, nil); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("StartRanging without a Ranger = %v, want ErrUnsupported", err)
+	}
+	if err := h.SetRanger(fakeRanger{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, le := h.EventMasks(); le&(1<<0x30) == 0 {
+		t.Errorf("LE event mask 0x%016X, want the subevent 0x31 unmasked", le)
+	}
+	d.sent()
+	ms := make(chan RangingMeasurement, 2)
+	if err := h.StartRanging(context.Background(), 0x40, func(m RangingMeasurement) { ms <- m }); err != nil {
+		t.Fatal(err)
+	}
+	if sent := d.sent(); len(sent) != 1 || sent[0][1] != 0x42 || sent[0][6] != 1 {
+		t.Errorf("commands sent starting = % X, want the vendor command of the Ranger", sent)
+	}
+	d.rc <- []byte{0x04, 0x3E, 0x04, 0x31, 0x40, 0x00, 150}
+	d.rc <- []byte{0x04, 0xFF, 0x04, 0x42, 0x40, 0x00, 75}
+	for _, want := range []float64{1.5, 0.75} {
+		select {
+		case m := <-ms:
+			if m.Handle != 0x40 || m.Distance != want {
+				t.Errorf("measurement = %+v, want %.2f m to 0x0040", m, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("measurement not delivered")
+		}
+	}
+	if err := h.SetRanger(nil); err == nil {
+		t.Error("SetRanger while ranging succeeded")
+	}
+	if err := h.StopRanging(context.Background(), 0x40); err != nil {
+		t.Fatal(err)
+	}
+	d.rc <- []byte{0x04, 0x3E, 0x04, 0x31, 0x40, 0x00, 150}
+	select {
+	case m := <-ms:
+		t.Errorf("measurement %+v delivered once stopped", m)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,76 @@
+package linux
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/paypal/gatt/linux/internal/hci"
+)
+
+// btsnoopHCI is the datalink of the captures of the un-encapsulated HCI,
+// the packet type told by the flags of the records.
+const btsnoopHCI = 1001
+
+// Replay feeds the packets received from the controller, as recorded in
+// the capture r, in the btsnoop format, such as those of the Snoop
+// option, or of Android, to the HCI, in order, as if read from the
+// controller: the events, advertising reports included, and the ACL data,
+// reassembled by the L2CAP. The packets sent are skipped. Each packet is
+// handled before the next is fed, so that the regressions in the parsing
+// of the events, and in the reassembly, of the traces users submit are
+// reproduced deterministically, with the HCI opened over a Transport, and
+// not started. The connections are to be accepted, and read, from another
+// goroutine, as the data is handed over to them. It returns the number of
+// packets fed, and the error the capture is malformed with, if it is.
+func (h HCI) Replay(r io.Reader) (int, error) {
+	hdr := make([]byte, 16)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return 0, fmt.Errorf("btsnoop: header: %w", err)
+	}
+	if !bytes.Equal(hdr[:8], []byte("btsnoop\x00")) {
+		return 0, errors.New("btsnoop: not a btsnoop capture")
+	}
+	if v := binary.BigEndian.Uint32(hdr[8:]); v != btsnoopVersion {
+		return 0, fmt.Errorf("btsnoop: version %d", v)
+	}
+	link := binary.BigEndian.Uint32(hdr[12:])
+	if link != btsnoopH4 && link != btsnoopHCI {
+		return 0, fmt.Errorf("btsnoop: datalink %d", link)
+	}
+	n := 0
+	rec := make([]byte, 24)
+	for i := 0; ; i++ {
+		if _, err := io.ReadFull(r, rec); err != nil {
+			if err == io.EOF {
+				return n, nil
+			}
+			return n, fmt.Errorf("btsnoop: record %d: %w", i, err)
+		}
+		b := make([]byte, binary.BigEndian.Uint32(rec[4:]))
+		if _, err := io.ReadFull(r, b); err != nil {
+			return n, fmt.Errorf("btsnoop: record %d: %w", i, io.ErrUnexpectedEOF)
+		}
+		flags := binary.BigEndian.Uint32(rec[8:])
+		if flags&btsnoopReceived == 0 || len(b) == 0 {
+			continue
+		}
+		if link == btsnoopHCI {
+			t := ptypeACLDataPkt
+			if flags&btsnoopCmdEvt != 0 {
+				t = ptypeEventPkt
+			}
+			b = append([]byte{byte(t)}, b...)
+		}
+		if h.scan.isAdvReport(b) {
+			if !h.scan.put(b) {
+				h.reject(fmt.Errorf("%w LE Advertising Report event", hci.ErrMalformed), b)
+			}
+		} else {
+			h.handlePacket(b)
+		}
+		n++
+	}
+}
@@ -0,0 +1,292 @@
+package linux
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sync"
+
+	"github.com/paypal/gatt/linux/internal/cmd"
+	"github.com/paypal/gatt/linux/internal/hci"
+)
+
+// LE states, numbered as the bits of the LE_States returned by LE Read
+// Supported States, combining those gatt drives the controller into:
+// connectable advertising, scanning, initiating, and the connection
+// roles.
+const (
+	stateAdvPassiveScan        = 10
+	stateAdvActiveScan         = 14
+	statePassiveScanInit       = 22
+	stateActiveScanInit        = 23
+	statePassiveScanCentral    = 24
+	stateActiveScanCentral     = 25
+	statePassiveScanPeripheral = 26
+	stateActiveScanPeripheral  = 27
+	stateInitCentral           = 28
+	stateAdvInit               = 32
+	stateAdvCentral            = 35
+	stateAdvPeripheral         = 38
+	stateInitPeripheral        = 41
+)
+
+// roles coordinates the states the controller is driven into, so that a
+// device may serve as the peripheral, while scanning, and connecting as
+// the central. Controllers support only some combinations of those
+// states, as reported by LE Read Supported States; one that is not is
+// refused with Command Disallowed, or, by some controllers, silently ends
+// the state already running.
+//
+// Connect, short lived, makes way for itself: scanning and advertising,
+// if they cannot run along, are paused while the connection is
+// initiated, and resumed once it completes, or fails; those a legacy
+// controller refuses to initiate along with, though it reports it can,
+// are then paused as well, from the refusal on. Scanning and
+// advertising, long lived, do not pause each other, nor make way for
+// the connections: starting one the controller cannot run along with
+// the others fails with ErrUnsupported.
+type roles struct {
+	mu     sync.Mutex
+	states uint64 // LE states supported; zero if unknown, assumed to be all
+
+	scanning   bool // started by Scan, and not stopped since
+	scanActive bool
+	scanDup    bool
+	scanPaused bool
+
+	scanAcceptList bool // see FilterScanByAcceptList
+
+	adv       *advertiser // the one started last
+	advPaused bool
+
+	initiating bool
+	connDone   chan uint8 // the status the connection initiated completes with, if waited for
+
+	conns func() (central, peripheral int) // number of connections
+}
+
+func (r *roles) supports(state uint) bool {
+	return r.states == 0 || r.states&(1<<state) != 0
+}
+
+// scanState returns the state of scanning, actively or not, along with
+// the other one.
+func scanState(active bool, passive, activ uint) uint {
+	if active {
+		return activ
+	}
+	return passive
+}
+
+func unsupported(what string) error {
+	return fmt.Errorf("hci: %s: %w by the controller", what, hci.ErrUnsupported)
+}
+
+// readSupportedStates reads the LE states supported by the controller.
+// They are left unknown if it cannot tell.
+func (h HCI) readSupportedStates(ctx context.Context) {
+	b, err := h.cmd.SendCtx(ctx, cmd.LEReadSupportedStates{})
+	if err != nil {
+		return
+	}
+	rp := cmd.LEReadSupportedStatesRP{}
+	if err := binary.Read(bytes.NewBuffer(b), binary.LittleEndian, &rp); err != nil || rp.Status != 0x00 {
+		return
+	}
+	h.roles.mu.Lock()
+	h.roles.states = binary.LittleEndian.Uint64(rp.LEStates[:])
+	h.roles.mu.Unlock()
+}
+
+func (r *roles) isScanning() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.scanning
+}
+
+// checkScan checks that the controller can scan along with the states
+// it is in, but initiating. r.mu is held.
+func (r *roles) checkScan(active bool) error {
+	central, peripheral := r.conns()
+	switch {
+	case r.adv != nil && r.adv.Serving() && !r.supports(scanState(active, stateAdvPassiveScan, stateAdvActiveScan)):
+		return unsupported("scanning while advertising")
+	case central > 0 && !r.supports(scanState(active, statePassiveScanCentral, stateActiveScanCentral)):
+		return unsupported("scanning while connected as the central")
+	case peripheral > 0 && !r.supports(scanState(active, statePassiveScanPeripheral, stateActiveScanPeripheral)):
+		return unsupported("scanning while connected as the peripheral")
+	}
+	return nil
+}
+
+// checkAdv checks that the controller can advertise along with the
+// states it is in, but initiating. r.mu is held.
+func (r *roles) checkAdv() error {
+	central, peripheral := r.conns()
+	switch {
+	case r.scanning && !r.scanPaused && !r.supports(scanState(r.scanActive, stateAdvPassiveScan, stateAdvActiveScan)):
+		return unsupported("advertising while scanning")
+	case central > 0 && !r.supports(stateAdvCentral):
+		return unsupported("advertising while connected as the central")
+	case peripheral > 0 && !r.supports(stateAdvPeripheral):
+		return unsupported("advertising while connected as the peripheral")
+	}
+	return nil
+}
+
+// checkInit checks that the controller can initiate a connection along
+// with the connections it has. r.mu is held.
+func (r *roles) checkInit() error {
+	central, peripheral := r.conns()
+	switch {
+	case r.initiating:
+		return fmt.Errorf("%w: a connection is being initiated already", ErrControllerBusy)
+	case central > 0 && !r.supports(stateInitCentral):
+		return unsupported("connecting while connected as the central")
+	case peripheral > 0 && !r.supports(stateInitPeripheral):
+		return unsupported("connecting while connected as the peripheral")
+	}
+	return nil
+}
+
+// startAdv enables the advertising of a, unless a connection is being
+// initiated, and it cannot run along; it is then enabled once the
+// connection completes.
+func (r *roles) startAdv(a *advertiser) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.adv = a
+	if r.initiating && !r.supports(stateAdvInit) {
+		r.advPaused = true
+		return nil
+	}
+	if err := r.checkAdv(); err != nil {
+		a.SetServing(false)
+		return err
+	}
+	return a.enable()
+}
+
+// stopAdv forgets the advertising of a, if it was paused.
+func (r *roles) stopAdv(a *advertiser) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.adv == a {
+		r.advPaused = false
+	}
+}
+
+// initiate pauses scanning and advertising, if they cannot run along
+// with initiating a connection, and marks the connection as initiated.
+// r.mu is held.
+func (h HCI) initiate() error {
+	r := h.roles
+	if err := r.checkInit(); err != nil {
+		return err
+	}
+	if err := h.pauseForInit(false); err != nil {
+		return err
+	}
+	r.initiating = true
+	return nil
+}
+
+// pauseForInit pauses scanning and advertising, if running, and if the
+// controller cannot run them along with initiating a connection, or, if
+// all, whether it reports it can or not. r.mu is held.
+func (h HCI) pauseForInit(all bool) error {
+	r := h.roles
+	if r.scanning && !r.scanPaused && (all || !r.supports(scanState(r.scanActive, statePassiveScanInit, stateActiveScanInit))) {
+		if err := h.disableScan(); err != nil {
+			return err
+		}
+		r.scanPaused = true
+	}
+	if r.adv != nil && r.adv.Serving() && !r.advPaused && (all || !r.supports(stateAdvInit)) {
+		if err := r.adv.disable(); err != nil {
+			h.resume()
+			return err
+		}
+		r.advPaused = true
+	}
+	return nil
+}
+
+// disallowedInit handles the controller refusing to initiate a connection
+// with Command Disallowed, as legacy ones do while scanning or advertising
+// even though they report, or could not tell, they can: it marks the
+// states running as unsupported along with initiating, and pauses them.
+// It reports whether any was, the connection then worth initiating again.
+// r.mu is held.
+func (h HCI) disallowedInit() bool {
+	r := h.roles
+	scan := r.scanning && !r.scanPaused
+	adv := r.adv != nil && r.adv.Serving() && !r.advPaused
+	if !scan && !adv {
+		return false
+	}
+	if r.states == 0 {
+		r.states = ^uint64(0)
+	}
+	if scan {
+		r.states &^= 1 << scanState(r.scanActive, statePassiveScanInit, stateActiveScanInit)
+	}
+	if adv {
+		r.states &^= 1 << stateAdvInit
+	}
+	return h.pauseForInit(true) == nil
+}
+
+// initiated resumes what initiate paused, once the connection initiated
+// has completed, or failed, with status. It is called by the worker
+// handling LE Connection Complete, which must not wait on the commands
+// resuming them: they are sent by a goroutine of their own.
+func (h HCI) initiated(status uint8) {
+	r := h.roles
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.initiating {
+		return
+	}
+	r.initiating = false
+	if r.connDone != nil {
+		r.connDone <- status
+		r.connDone = nil
+	}
+	go func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if !r.initiating { // else, still paused by the connection initiated since
+			h.resume()
+		}
+	}()
+}
+
+// resume resumes scanning and advertising, if paused, and if they can
+// run along with the connections now established. r.mu is held.
+func (h HCI) resume() {
+	r := h.roles
+	if r.scanPaused {
+		r.scanPaused = false
+		err := r.checkScan(r.scanActive)
+		if err == nil {
+			err = h.enableScan(r.scanActive, r.scanDup)
+		}
+		if err != nil {
+			r.scanning = false
+			h.report(fmt.Errorf("hci: resuming scanning: %w", err))
+		}
+	}
+	if r.advPaused {
+		r.advPaused = false
+		err := r.checkAdv()
+		if err == nil {
+			err = r.adv.enable()
+		}
+		if err != nil {
+			r.adv.SetServing(false)
+			h.report(fmt.Errorf("hci: resuming advertising: %w", err))
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package linux
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/paypal/gatt/linux/internal/cmd"
+)
+
+// setStates makes the controller of h support all the LE states, but
+// those specified.
+func setStates(h *HCI, d *fakeDevice, but ...uint) {
+	states := ^uint64(0)
+	for _, s := range but {
+		states &^= 1 << s
+	}
+	d.mu.Lock()
+	d.rsp = map[cmd.Opcode][]byte{(cmd.LEReadSupportedStates{}).Opcode(): make([]byte, 8)}
+	binary.LittleEndian.PutUint64(d.rsp[(cmd.LEReadSupportedStates{}).Opcode()], states)
+	d.mu.Unlock()
+	h.readSupportedStates(context.Background())
+	d.sent()
+}
+
+// waitSent waits for the commands want, given as their opcode, followed
+// by their first parameter, if any, to be written, in this order.
+func waitSent(t *testing.T, d *fakeDevice, want ...string) {
+	t.Helper()
+	var got []string
+	wait := time.Second
+	if len(want) == 0 {
+		wait = 50 * time.Millisecond // for none to be sent
+	}
+	for deadline := time.Now().Add(wait); time.Now().Before(deadline) && (len(want) == 0 || len(got) < len(want)); {
+		for _, b := range d.sent() {
+			s := cmd.Opcode(uint16(b[1]) | uint16(b[2])<<8).String()
+			if len(b) > 4 {
+				s += fmt.Sprintf(" %d", b[4])
+			}
+			got = append(got, s)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("commands sent:\n\t%s\nwant:\n\t%s", strings.Join(got, "\n\t"), strings.Join(want, "\n\t"))
+	}
+}
+
+const (
+	scanOn  = "LE Set Scan Enable 1"
+	scanOff = "LE Set Scan Enable 0"
+	advOn   = "LE Set Advertising Enable 1"
+	advOff  = "LE Set Advertising Enable 0"
+)
+
+func TestConnectPausesScanningAndAdvertising(t *testing.T) {
+	h, d := newTestHCI(new(uint64))
+	defer h.Close()
+	setStates(h, d, statePassiveScanInit, stateAdvInit)
+	a := h.NewAdvertiser()
+	h.l2c.Adv = a
+	if err := a.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Scan(false, true); err != nil {
+		t.Fatal(err)
+	}
+	d.sent()
+
+	if err := h.Connect([6]byte{1, 2, 3, 4, 5, 6}, AddrPublic, ConnParams{}); err != nil {
+		t.Fatal(err)
+	}
+	waitSent(t, d, scanOff, advOff, "LE Create Connection 96")
+	if err := h.Connect([6]byte{1, 2, 3, 4, 5, 6}, AddrPublic, ConnParams{}); err == nil {
+		t.Error("second Connect succeeded")
+	}
+
+	central := append([]byte(nil), connCompletePkt...)
+	central[7] = 0x00 // master
+	d.rc <- central
+	<-h.l2c.ConnC()
+	waitSent(t, d, "LE Set Scan Parameters 0", scanOn, advOn)
+}
+
+func TestScanWhileAdvertisingUnsupported(t *testing.T) {
+	h, d := newTestHCI(new(uint64))
+	defer h.Close()
+	setStates(h, d, stateAdvActiveScan)
+	a := h.NewAdvertiser()
+	if err := a.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Scan(true, true); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("active Scan = %v, want ErrUnsupported", err)
+	}
+	if err := h.Scan(false, true); err != nil {
+		t.Errorf("passive Scan = %v", err)
+	}
+}
+
+func TestAdvertisingNotResumedOnceStopped(t *testing.T) {
+	h, d := newTestHCI(new(uint64))
+	defer h.Close()
+	a := h.NewAdvertiser()
+	h.l2c.Adv = a
+	if err := a.Start(); err != nil {
+		t.Fatal(err)
+	}
+	d.rc <- connCompletePkt
+	c := <-h.l2c.ConnC()
+	if err := a.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	d.sent()
+
+	d.rc <- []byte{0x04, 0x05, 0x04, 0x00, 0x40, 0x00, 0x13} // Disconnection Complete
+	if _, err := c.Read(make([]byte, 64)); err == nil {
+		t.Fatal("Read succeeded once disconnected")
+	}
+	waitSent(t, d)
+}
+
+func TestConnectDisallowedWhileScanning(t *testing.T) {
+	h, d := newTestHCI(new(uint64))
+	defer h.Close()
+	if err := h.Scan(false, true); err != nil {
+		t.Fatal(err)
+	}
+	d.sent()
+
+	// The controller could not tell its states, and refuses to initiate
+	// while scanning.
+	d.mu.Lock()
+	d.status = map[cmd.Opcode][]uint8{(cmd.LECreateConn{}).Opcode(): {statusCommandDisallowed}}
+	d.mu.Unlock()
+	if err := h.Connect([6]byte{1, 2, 3, 4, 5, 6}, AddrPublic, ConnParams{}); err != nil {
+		t.Fatal(err)
+	}
+	waitSent(t, d, "LE Create Connection 96", scanOff, "LE Create Connection 96")
+
+	d.rc <- centralComplete(0x00)
+	<-h.l2c.ConnC()
+	waitSent(t, d, "LE Set Scan Parameters 0", scanOn)
+
+	// From then on, scanning makes way as the connection is initiated.
+	if err := h.Connect([6]byte{1, 2, 3, 4, 5, 7}, AddrPublic, ConnParams{}); err != nil {
+		t.Fatal(err)
+	}
+	waitSent(t, d, scanOff, "LE Create Connection 96")
+}
@@ -0,0 +1,63 @@
+package linux
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// An AdvPayload is the advertising data, and the scan response data, of
+// one of the advertisements rotated by Rotate.
+type AdvPayload struct {
+	AdvertisingData  []byte
+	ScanResponseData []byte
+}
+
+// Rotate emulates several advertisers, e.g. beacons, with a controller
+// that advertises a single set at a time: it advertises the payloads ps
+// in turn, switching to the next every period, until ctx is done. Each
+// switch is offset by a random delay of up to jitter either way, so that
+// the rotation does not fall into step with that of another device, and
+// collide with it for good. The payloads share the advertising
+// parameters, and the address, of a; period must be no shorter than the
+// maximum advertising interval, for each to go out at least once.
+//
+// Rotate is called once advertising is started. It returns ctx.Err(), or
+// the error of a switch, and leaves a advertising its own data again.
+func (a *advertiser) Rotate(ctx context.Context, ps []AdvPayload, period, jitter time.Duration) error {
+	a.servingmu.RLock()
+	min := time.Duration(a.advertisingIntervalMax) * 625 * time.Microsecond
+	a.servingmu.RUnlock()
+	if err := a.checkRotation(ps, period, jitter, min); err != nil {
+		return err
+	}
+	defer a.restoreData()
+
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	t := time.NewTimer(0)
+	defer t.Stop()
+	for i := 0; ; i = (i + 1) % len(ps) {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+		if err := a.setData(ps[i].AdvertisingData, ps[i].ScanResponseData); err != nil {
+			return err
+		}
+		d := period
+		if jitter > 0 {
+			d += time.Duration(r.Int63n(2*int64(jitter)+1)) - jitter
+		}
+		t.Reset(d)
+	}
+}
+
+// restoreData sets the data of a back, once rotated out.
+func (a *advertiser) restoreData() {
+	a.servingmu.RLock()
+	ad := append(append([]byte(nil), a.advertisingPacket...), a.manufacturerData...)
+	sr := a.scanResponsePacket
+	a.servingmu.RUnlock()
+	a.setData(ad, sr)
+}
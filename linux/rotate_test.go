@@ -0,0 +1,61 @@
+package linux
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/paypal/gatt/linux/internal/cmd"
+)
+
+func TestRotate(t *testing.T) {
+	h, d := newTestHCI(new(uint64))
+	defer h.Close()
+	a := h.NewAdvertiser()
+	a.Option(AdvertisingIntervalMin(0x20), AdvertisingIntervalMax(0x20), AdvertisingPacket([]byte{'o'}))
+	if err := a.Start(); err != nil {
+		t.Fatal(err)
+	}
+	d.sent()
+
+	ps := []AdvPayload{
+		{AdvertisingData: []byte{'a'}, ScanResponseData: []byte{'A'}},
+		{AdvertisingData: []byte{'b'}},
+	}
+	var e ErrInvalidParameter
+	if err := a.Rotate(context.Background(), ps, 10*time.Millisecond, 0); !errors.As(err, &e) {
+		t.Errorf("Rotate every 10 ms, advertising every 20 ms: got %v, want an ErrInvalidParameter", err)
+	}
+	if err := a.Rotate(context.Background(), ps, 40*time.Millisecond, 30*time.Millisecond); !errors.As(err, &e) {
+		t.Errorf("Rotate with a jitter above half the period: got %v, want an ErrInvalidParameter", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 80*time.Millisecond)
+	defer cancel()
+	if err := a.Rotate(ctx, ps, 20*time.Millisecond, 5*time.Millisecond); err != context.DeadlineExceeded {
+		t.Errorf("Rotate: got %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// The data of each payload, in turn, then that of a again.
+	var got []string
+	for _, b := range d.sent() {
+		var s string
+		switch cmd.Opcode(uint16(b[1]) | uint16(b[2])<<8) {
+		case (cmd.LESetAdvertisingData{}).Opcode():
+			s = "ad "
+		case (cmd.LESetScanResponseData{}).Opcode():
+			s = "sr "
+		default:
+			t.Errorf("unexpected command % X", b)
+			continue
+		}
+		got = append(got, fmt.Sprintf("%s%q", s, b[5:5+b[4]]))
+	}
+	want := `ad "a", sr "A", ad "b", sr "", ad "a", sr "A"`
+	if s := strings.Join(got, ", "); len(got) < 8 || !strings.HasPrefix(s, want) || !strings.HasSuffix(s, `ad "o", sr ""`) {
+		t.Errorf("commands sent:\n\t%s\nwant:\n\t%s, ..., ad \"o\", sr \"\"", s, want)
+	}
+}
@@ -0,0 +1,252 @@
+package linux
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/paypal/gatt/linux/internal/cmd"
+)
+
+// advRingSize is the number of advertising reports buffered while scanning.
+const advRingSize = 256
+
+// An AdvReport is an advertising report received while scanning.
+type AdvReport struct {
+	EventType   uint8
+	AddressType uint8   // AddrPublic, AddrRandom, or an identity address type
+	Address     [6]byte // as sent by the controller, least significant byte first
+	RSSI        int8
+	DataLen     uint8
+	Data        [31]byte
+
+	// Time and Raw are set in the raw mode only; see SetRawAdvReports.
+	Time time.Time // when the event was read from the controller
+	Raw  []byte    // the report, as in the event, undecoded
+}
+
+// AdvertisingData returns the advertising, or scan response, data.
+func (r *AdvReport) AdvertisingData() []byte { return r.Data[:r.DataLen] }
+
+// advRing buffers the advertising reports until they are read. It is fed
+// by the read loop directly, out of the read buffer, so that the reports,
+// which dominate the traffic while scanning, bypass the dispatcher: no
+// copy of the packet, no goroutine hop and no allocation. Once full, the
+// oldest reports are overwritten.
+type advRing struct {
+	enabled int32
+	raw     int32
+	mu      sync.Mutex
+	cond    *sync.Cond
+	buf     [advRingSize]AdvReport
+	head    int // index of the oldest report
+	n       int // number of reports buffered
+	dropped uint64
+	closed  bool
+}
+
+func newAdvRing() *advRing {
+	r := &advRing{}
+	r.cond = sync.NewCond(&r.mu)
+	return r
+}
+
+func (r *advRing) setEnabled(on bool) {
+	v := int32(0)
+	if on {
+		v = 1
+	}
+	atomic.StoreInt32(&r.enabled, v)
+}
+
+func (r *advRing) isEnabled() bool { return atomic.LoadInt32(&r.enabled) == 1 }
+
+func (r *advRing) setRaw(on bool) {
+	v := int32(0)
+	if on {
+		v = 1
+	}
+	atomic.StoreInt32(&r.raw, v)
+}
+
+func (r *advRing) isRaw() bool { return atomic.LoadInt32(&r.raw) == 1 }
+
+// isAdvReport reports whether b is an LE Advertising Report event packet,
+// while scanning.
+func (r *advRing) isAdvReport(b []byte) bool {
+	return r.isEnabled() && len(b) > 3 &&
+		PacketType(b[0]) == ptypeEventPkt && b[1] == 0x3E && b[3] == 0x02
+}
+
+// put decodes the reports of an LE Advertising Report event packet into
+// the ring, and reports whether the packet is well formed. The reports of
+// a malformed packet are decoded up to the first malformed one. In the
+// raw mode, each report is copied as well, and stamped with the time.
+func (r *advRing) put(b []byte) bool {
+	if int(b[2]) != len(b)-3 || len(b) < 5 {
+		return false
+	}
+	var now time.Time
+	raw := r.isRaw()
+	if raw {
+		now = time.Now()
+	}
+	b = b[4:] // packet type, event header, subevent code
+	num := int(b[0])
+	b = b[1:]
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	defer r.cond.Signal()
+	for i := 0; i < num; i++ {
+		if len(b) < 10 || int(b[8]) > 31 || len(b) < 10+int(b[8]) {
+			return false
+		}
+		if r.n == len(r.buf) {
+			r.head = (r.head + 1) % len(r.buf)
+			r.n--
+			r.dropped++
+		}
+		a := &r.buf[(r.head+r.n)%len(r.buf)]
+		dlen := int(b[8])
+		a.EventType = b[0]
+		a.AddressType = b[1]
+		copy(a.Address[:], b[2:8])
+		a.DataLen = uint8(dlen)
+		copy(a.Data[:], b[9:9+dlen])
+		a.RSSI = int8(b[9+dlen])
+		a.Time, a.Raw = now, nil
+		if raw {
+			a.Raw = append([]byte(nil), b[:10+dlen]...)
+		}
+		r.n++
+		b = b[10+dlen:]
+	}
+	return len(b) == 0
+}
+
+// read moves the buffered reports into rs, blocking until there is at
+// least one, or the ring is closed.
+func (r *advRing) read(rs []AdvReport) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for r.n == 0 && !r.closed {
+		r.cond.Wait()
+	}
+	if r.n == 0 {
+		return 0, io.EOF
+	}
+	k := 0
+	for ; k < len(rs) && r.n > 0; k++ {
+		rs[k] = r.buf[r.head]
+		r.head = (r.head + 1) % len(r.buf)
+		r.n--
+	}
+	return k, nil
+}
+
+func (r *advRing) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	r.cond.Broadcast()
+}
+
+// Scan starts scanning for advertisements. The reports are read with
+// ReadAdvReports. An active scan also requests the scan responses.
+//
+// While a connection is initiated, by a controller that cannot scan at
+// the same time, scanning starts once the connection completes. Scan
+// fails with ErrUnsupported if the controller cannot scan while
+// advertising, or while connected, as it is.
+func (h HCI) Scan(active, filterDuplicates bool) error {
+	r := h.roles
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.checkScan(active); err != nil {
+		return err
+	}
+	r.scanning, r.scanActive, r.scanDup = true, active, filterDuplicates
+	if r.initiating && !r.supports(scanState(active, statePassiveScanInit, stateActiveScanInit)) {
+		r.scanPaused = true
+		return nil
+	}
+	if err := h.enableScan(active, filterDuplicates); err != nil {
+		r.scanning = false
+		return err
+	}
+	return nil
+}
+
+// enableScan enables scanning; h.roles.mu is held.
+func (h HCI) enableScan(active, filterDuplicates bool) error {
+	typ, dup, policy := uint8(0x00), uint8(0x00), uint8(0x00)
+	if active {
+		typ = 0x01
+	}
+	if filterDuplicates {
+		dup = 0x01
+	}
+	if h.roles.scanAcceptList {
+		policy = 0x01
+	}
+	h.scan.setEnabled(true)
+	if err := h.cmd.SendAndCheckResp(cmd.LESetScanParameters{
+		LEScanType:           typ,
+		LEScanInterval:       h.scanInterval,
+		LEScanWindow:         h.scanWindow,
+		ScanningFilterPolicy: policy,
+	}, expSuccess); err != nil {
+		h.scan.setEnabled(false)
+		return err
+	}
+	if err := h.cmd.SendAndCheckResp(cmd.LESetScanEnable{LEScanEnable: 1, FilterDuplicates: dup}, expSuccess); err != nil {
+		h.scan.setEnabled(false)
+		return err
+	}
+	return nil
+}
+
+// StopScan stops scanning. Reports already buffered may still be read.
+func (h HCI) StopScan() error {
+	r := h.roles
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.scanning = false
+	if r.scanPaused {
+		r.scanPaused = false
+		return nil
+	}
+	return h.disableScan()
+}
+
+func (h HCI) disableScan() error {
+	h.scan.setEnabled(false)
+	return h.cmd.SendAndCheckResp(cmd.LESetScanEnable{LEScanEnable: 0}, expSuccess)
+}
+
+// ReadAdvReports reads the advertising reports received so far into rs,
+// and returns how many were read. It blocks until there is at least one.
+// At most a few hundred reports are kept; when rs is not read fast enough
+// the oldest ones are dropped, and counted by DroppedAdvReports.
+// It returns io.EOF once the HCI is closed.
+func (h HCI) ReadAdvReports(rs []AdvReport) (int, error) {
+	return h.scan.read(rs)
+}
+
+// SetRawAdvReports sets whether the advertising reports are read in the
+// raw mode, for sniffers and protocol analysis: each one then carries the
+// time its event was read, and the report itself, as the controller sent
+// it: event type, address type, address, data length, data and RSSI. The
+// HCI reports neither the channel an advertisement was received on, nor
+// the time the controller received it. Each report then costs an
+// allocation.
+func (h HCI) SetRawAdvReports(on bool) { h.scan.setRaw(on) }
+
+// DroppedAdvReports returns the number of advertising reports dropped so
+// far, because they were not read in time.
+func (h HCI) DroppedAdvReports() uint64 {
+	h.scan.mu.Lock()
+	defer h.scan.mu.Unlock()
+	return h.scan.dropped
+}
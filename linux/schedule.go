@@ -0,0 +1,86 @@
+package linux
+
+import (
+	"context"
+	"time"
+)
+
+// An AdvSlot is one of the payloads of a schedule, and the time it is
+// advertised for, each time its turn comes.
+type AdvSlot struct {
+	AdvPayload
+	Duration time.Duration
+}
+
+// An AdvSlotReport reports a turn of a slot of a schedule.
+type AdvSlotReport struct {
+	Slot  int           // index of the slot in the schedule
+	Start time.Time     // at which the controller took its payload
+	OnAir time.Duration // from Start until the next payload was taken
+
+	// Events is the number of advertising events the payload went out
+	// in, estimated from OnAir, as controllers report none: the mean
+	// spacing of the events is taken to be the middle of the advertising
+	// interval, plus 5 ms, the mean of the random delay the controller
+	// adds to each.
+	Events int
+}
+
+// advDelay is the mean of the random delay, of up to 10 ms, added to the
+// interval of each advertising event.
+const advDelay = 5 * time.Millisecond
+
+// Schedule advertises the payloads of slots in turn, each for its
+// Duration, until ctx is done, for campaigns comparing how well
+// different payloads are discovered. Unlike Rotate, it keeps to the
+// schedule: the switches are timed from the start of the schedule,
+// rather than from one another, so that the time the controller takes
+// to switch does not add up, and there is no jitter. f, if not nil, is
+// called with the report of each turn as it ends, from the goroutine of
+// Schedule. The payloads share the advertising parameters, and the
+// address, of a; each Duration must be no shorter than the maximum
+// advertising interval.
+//
+// Schedule is called once advertising is started. It returns ctx.Err(),
+// or the error of a switch, and leaves a advertising its own data again.
+func (a *advertiser) Schedule(ctx context.Context, slots []AdvSlot, f func(r AdvSlotReport)) error {
+	a.servingmu.RLock()
+	min := time.Duration(a.advertisingIntervalMin) * 625 * time.Microsecond
+	max := time.Duration(a.advertisingIntervalMax) * 625 * time.Microsecond
+	a.servingmu.RUnlock()
+	if err := a.checkSchedule(slots, max); err != nil {
+		return err
+	}
+	defer a.restoreData()
+
+	spacing := (min+max)/2 + advDelay
+	next := time.Now()
+	var cur *AdvSlotReport
+	end := func(now time.Time) {
+		if cur == nil || f == nil {
+			return
+		}
+		cur.OnAir = now.Sub(cur.Start)
+		cur.Events = int(cur.OnAir / spacing)
+		f(*cur)
+	}
+	t := time.NewTimer(0)
+	defer t.Stop()
+	for i := 0; ; i = (i + 1) % len(slots) {
+		select {
+		case <-ctx.Done():
+			end(time.Now())
+			return ctx.Err()
+		case <-t.C:
+		}
+		s := slots[i]
+		if err := a.setData(s.AdvertisingData, s.ScanResponseData); err != nil {
+			return err
+		}
+		now := time.Now()
+		end(now)
+		cur = &AdvSlotReport{Slot: i, Start: now}
+		next = next.Add(s.Duration)
+		t.Reset(time.Until(next))
+	}
+}
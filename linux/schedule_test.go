@@ -0,0 +1,66 @@
+package linux
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/paypal/gatt/linux/internal/cmd"
+)
+
+func TestSchedule(t *testing.T) {
+	h, d := newTestHCI(new(uint64))
+	defer h.Close()
+	a := h.NewAdvertiser()
+	a.Option(AdvertisingIntervalMin(0x20), AdvertisingIntervalMax(0x20), AdvertisingPacket([]byte{'o'}))
+	if err := a.Start(); err != nil {
+		t.Fatal(err)
+	}
+	d.sent()
+
+	var e ErrInvalidParameter
+	short := []AdvSlot{{AdvPayload{AdvertisingData: []byte{'a'}}, 10 * time.Millisecond}}
+	if err := a.Schedule(context.Background(), short, nil); !errors.As(err, &e) {
+		t.Errorf("Schedule of 10 ms, advertising every 20 ms: got %v, want an ErrInvalidParameter", err)
+	}
+
+	slots := []AdvSlot{
+		{AdvPayload{AdvertisingData: []byte{'a'}}, 30 * time.Millisecond},
+		{AdvPayload{AdvertisingData: []byte{'b'}}, 60 * time.Millisecond},
+	}
+	var reports []AdvSlotReport
+	ctx, cancel := context.WithTimeout(context.Background(), 170*time.Millisecond)
+	defer cancel()
+	if err := a.Schedule(ctx, slots, func(r AdvSlotReport) { reports = append(reports, r) }); err != context.DeadlineExceeded {
+		t.Errorf("Schedule: got %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// a for 30 ms, b for 60 ms, then a, and b again, cut short.
+	if len(reports) != 4 {
+		t.Fatalf("got %d reports, want 4: %+v", len(reports), reports)
+	}
+	for i, r := range reports[:3] {
+		want := slots[i%2].Duration
+		if r.Slot != i%2 || r.OnAir < want-10*time.Millisecond || r.OnAir > want+10*time.Millisecond {
+			t.Errorf("report %d: slot %d on air %v, want slot %d on air %v", i, r.Slot, r.OnAir, i%2, want)
+		}
+		if spacing := 20*time.Millisecond + advDelay; r.Events != int(r.OnAir/spacing) {
+			t.Errorf("report %d: %d events, want %d", i, r.Events, int(r.OnAir/spacing))
+		}
+	}
+	// The switches keep to the schedule, however long each took.
+	if got := reports[3].Start.Sub(reports[0].Start); got < 115*time.Millisecond || got > 130*time.Millisecond {
+		t.Errorf("fourth turn started %v after the first, want 120 ms", got)
+	}
+
+	var data []byte
+	for _, b := range d.sent() {
+		if cmd.Opcode(uint16(b[1])|uint16(b[2])<<8) == (cmd.LESetAdvertisingData{}).Opcode() {
+			data = append(data, b[5])
+		}
+	}
+	if string(data) != "ababo" {
+		t.Errorf("advertised %q, want %q", data, "ababo")
+	}
+}
@@ -0,0 +1,91 @@
+package linux
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/paypal/gatt/linux/internal/hci"
+)
+
+// Packet status flags of a SCO data packet received, if enabled with
+// the Erroneous Data Reporting of the controller.
+const (
+	SCOCorrect       = 0x00
+	SCOInvalid       = 0x01
+	SCONoData        = 0x02
+	SCOPartiallyLost = 0x03
+)
+
+// SCOPacket is a single HCI SCO data packet, of a SCO or eSCO link,
+// e.g. the audio of a hands-free call.
+type SCOPacket struct {
+	Handle uint16
+	Status uint8 // packet status flag
+	Data   []byte
+}
+
+func (p *SCOPacket) Unmarshal(b []byte) error {
+	if len(b) < 3 || len(b) != 3+int(b[2]) {
+		return fmt.Errorf("%w sco packet", hci.ErrMalformed)
+	}
+	hdr := uint16(b[0]) | uint16(b[1])<<8
+	*p = SCOPacket{Handle: hdr & 0x0fff, Status: uint8(hdr>>12) & 0x3, Data: b[3:]}
+	return nil
+}
+
+func (p *SCOPacket) String() string {
+	return fmt.Sprintf("SCO Data: handle %d status %d dlen %d", p.Handle, p.Status, len(p.Data))
+}
+
+// A SCOHandler handles the SCO data packets received from the controller.
+type SCOHandler interface {
+	HandleSCO(p *SCOPacket)
+}
+
+// The SCOHandlerFunc type is an adapter to allow the use of ordinary
+// functions as SCOHandlers.
+type SCOHandlerFunc func(p *SCOPacket)
+
+func (f SCOHandlerFunc) HandleSCO(p *SCOPacket) { f(p) }
+
+type scoState struct {
+	mu      sync.Mutex
+	handler SCOHandler
+}
+
+// HandleSCO registers the handler of the incoming SCO data packets, for
+// the applications passing the audio of SCO links through; f may keep
+// the packets. If nil, the default, they are dropped as unsupported.
+func (h HCI) HandleSCO(f SCOHandler) {
+	h.sco.mu.Lock()
+	defer h.sco.mu.Unlock()
+	h.sco.handler = f
+}
+
+// WriteSCO sends data over the SCO link of handle, in a single packet.
+// It is up to the caller to pace the packets, as the controller expects
+// them, and to fit them in its SCO buffers.
+func (h HCI) WriteSCO(handle uint16, data []byte) error {
+	if len(data) > 0xff {
+		return fmt.Errorf("sco: packet too long (%d bytes)", len(data))
+	}
+	hdr := handle & 0x0fff
+	w := append([]byte{byte(ptypeSCODataPkt), uint8(hdr), uint8(hdr >> 8), uint8(len(data))}, data...)
+	_, err := h.out.Write(w)
+	return err
+}
+
+func (h HCI) handleSCO(b []byte) error {
+	h.sco.mu.Lock()
+	f := h.sco.handler
+	h.sco.mu.Unlock()
+	if f == nil {
+		return fmt.Errorf("SCO packet: %w", hci.ErrUnsupported)
+	}
+	p := &SCOPacket{}
+	if err := p.Unmarshal(b); err != nil {
+		return err
+	}
+	h.call("sco", func() { f.HandleSCO(p) })
+	return nil
+}
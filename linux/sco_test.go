@@ -0,0 +1,26 @@
+package linux
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestHandleSCO(t *testing.T) {
+	h, d := newTestHCI(new(uint64))
+	defer h.Close()
+	c := make(chan *SCOPacket, 1)
+	h.HandleSCO(SCOHandlerFunc(func(p *SCOPacket) { c <- p }))
+	d.rc <- []byte{0x03, 0x2A, 0x30, 0x03, 0x01, 0x02, 0x03} // handle 0x02A, partially lost
+	select {
+	case p := <-c:
+		if p.Handle != 0x02A || p.Status != SCOPartiallyLost || !bytes.Equal(p.Data, []byte{1, 2, 3}) {
+			t.Errorf("HandleSCO got %+v", p)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("SCO packet not handed to HandleSCO")
+	}
+	if err := h.WriteSCO(0x02A, make([]byte, 256)); err == nil {
+		t.Error("WriteSCO of 256 bytes succeeded")
+	}
+}
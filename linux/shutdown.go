@@ -0,0 +1,100 @@
+package linux
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// A ShutdownStage is a stage of the shutdown of an HCI. Shutdown carries
+// the stages out in their order, from the top of the stack down, each
+// once the previous one has completed.
+type ShutdownStage int
+
+const (
+	// StopRadio stops scanning and advertising.
+	StopRadio ShutdownStage = iota
+
+	// RefuseConns disconnects the connections established from then on,
+	// e.g. those a central initiated as advertising stopped.
+	RefuseConns
+
+	// DrainATT waits for the PDUs queued on the connections, ATT and
+	// others, to be written to the controller.
+	DrainATT
+
+	// DisconnectLinks disconnects the connections, and waits for the
+	// controller to report them disconnected.
+	DisconnectLinks
+
+	// StopL2CAP stops the send queue, and drops the connections left.
+	StopL2CAP
+
+	// StopCmds fails the commands pending with ErrClosed, and stops
+	// sending new ones.
+	StopCmds
+
+	// CloseDevice closes the device, and waits for the goroutines of the
+	// HCI, reading from it, and handling its events, to return.
+	CloseDevice
+
+	numShutdownStages
+)
+
+var shutdownStageNames = [...]string{
+	StopRadio:       "stop radio",
+	RefuseConns:     "refuse connections",
+	DrainATT:        "drain ATT",
+	DisconnectLinks: "disconnect links",
+	StopL2CAP:       "stop L2CAP",
+	StopCmds:        "stop commands",
+	CloseDevice:     "close device",
+}
+
+func (s ShutdownStage) String() string {
+	if s < 0 || s >= numShutdownStages {
+		return fmt.Sprintf("ShutdownStage(%d)", int(s))
+	}
+	return shutdownStageNames[s]
+}
+
+// shutdownHooks are the functions called ahead of the stages of the
+// shutdown.
+type shutdownHooks struct {
+	mu    sync.Mutex
+	hooks [numShutdownStages][]func(ctx context.Context) error
+}
+
+// OnShutdown registers f, to be called as the shutdown of the HCI reaches
+// stage, before the HCI carries it out, so that the modules of the
+// application take part in it: e.g. a module notifies the centrals of its
+// state ahead of DisconnectLinks, and one that persists what it scanned
+// flushes it ahead of StopRadio. The functions of a stage are called in
+// the order they were registered, with the context of Shutdown, which
+// they heed. Their errors, and panics, are reported to the HandlerErrors
+// function, without holding the shutdown up.
+//
+// The functions of the stages up to DisconnectLinks are skipped once the
+// context is done, as are the stages themselves; those of the stages
+// after are called regardless, for the HCI to be torn down still.
+func (h HCI) OnShutdown(stage ShutdownStage, f func(ctx context.Context) error) {
+	if stage < 0 || stage >= numShutdownStages {
+		panic(fmt.Sprintf("linux: OnShutdown of %v", stage))
+	}
+	h.shutdownHooks.mu.Lock()
+	defer h.shutdownHooks.mu.Unlock()
+	h.shutdownHooks.hooks[stage] = append(h.shutdownHooks.hooks[stage], f)
+}
+
+// reach calls the functions registered for stage.
+func (h HCI) reach(ctx context.Context, stage ShutdownStage) {
+	h.shutdownHooks.mu.Lock()
+	fs := h.shutdownHooks.hooks[stage]
+	h.shutdownHooks.mu.Unlock()
+	for _, f := range fs {
+		var err error
+		if h.call("shutdown "+stage.String(), func() { err = f(ctx) }) && err != nil {
+			h.report(fmt.Errorf("hci: shutdown %s: %w", stage, err))
+		}
+	}
+}
@@ -0,0 +1,371 @@
+package linux
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/paypal/gatt/linux/internal/cmd"
+	"github.com/paypal/gatt/linux/internal/l2cap"
+)
+
+// SMP commands, as in the Core specification, Vol 3, Part H, 3.3.
+const (
+	smpPairingRequest      = 0x01
+	smpPairingResponse     = 0x02
+	smpPairingConfirm      = 0x03
+	smpPairingRandom       = 0x04
+	smpPairingFailed       = 0x05
+	smpIdentityInformation = 0x08
+	smpIdentityAddress     = 0x09
+	smpSecurityRequest     = 0x0B
+	smpPairingPublicKey    = 0x0C
+	smpPairingDHKeyCheck   = 0x0D
+)
+
+const (
+	smpNoInputNoOutput = 0x03 // IO capability
+	smpBonding         = 0x01 // AuthReq bits
+	smpSC              = 0x08
+	smpIdKey           = 0x02 // key distribution bit
+	smpMaxKeySize      = 16
+
+	// smpTimeout is the time a pairing fails after, as the Security
+	// Manager Timer of the specification.
+	smpTimeout = 30 * time.Second
+)
+
+// smpPairingReq is the Pairing Request sent: no input, nor output, no OOB
+// data, bonding with LE Secure Connections, and the identity of the
+// peer asked for.
+var smpPairingReq = []byte{smpPairingRequest, smpNoInputNoOutput, 0x00, smpBonding | smpSC, smpMaxKeySize, 0x00, smpIdKey}
+
+// PairingKeys are the keys of a pairing, least significant byte first, as
+// on the air.
+type PairingKeys struct {
+	// LTK is the long term key generated, encrypting the link.
+	LTK [16]byte
+
+	// IRK and IdentityAddr, of IdentityAddrType, are the Identity
+	// Resolving Key, and identity address, of the peer, if Identity is
+	// set, the peer having distributed them.
+	Identity         bool
+	IRK              [16]byte
+	IdentityAddr     [6]byte
+	IdentityAddrType uint8
+}
+
+// Pair pairs with the peer of the connection c, of which the device is
+// the central, by LE Secure Connections, as Just Works: the keys are
+// safe from eavesdroppers, not from a man in the middle, which no IO
+// capability guards against. It encrypts the link with the long term key
+// generated, and returns it, along with the identity of the peer, if it
+// distributes it. Legacy pairing is not supported: peers without LE
+// Secure Connections, or keys of 16 bytes, are failed with an SMPReason,
+// as is the pairing failed by the peer. It gives up after 30 seconds, as
+// the specification says, or once ctx is done.
+//
+// Peers whose private address the controller resolved, of address type
+// AddrPublicIdentity or AddrRandomIdentity, are refused: the keys are
+// derived from the addresses on the air, and the private address of
+// the peer is not reported along with its identity.
+func (h HCI) Pair(ctx context.Context, c *l2cap.Conn) (PairingKeys, error) {
+	if c.Param.Role != 0x00 {
+		return PairingKeys{}, errors.New("smp: pairing is initiated by the central")
+	}
+	if t := c.Param.PeerAddressType; t != AddrPublic && t != AddrRandom {
+		return PairingKeys{}, fmt.Errorf("smp: pairing with a peer of resolved identity address, of type 0x%02X, not supported", t)
+	}
+	local, err := h.readBDADDR(ctx)
+	if err != nil {
+		return PairingKeys{}, err
+	}
+	// The connections are initiated with the public address.
+	return pair(ctx, c, smpAddr{AddrPublic, local}, smpAddr{c.Param.PeerAddressType, c.Param.PeerAddress})
+}
+
+// readBDADDR reads the public address of the controller.
+func (h HCI) readBDADDR(ctx context.Context) ([6]byte, error) {
+	p := cmd.ReadBDADDR{}
+	b, err := h.cmd.SendCtx(ctx, p)
+	if err != nil {
+		return [6]byte{}, err
+	}
+	rp := cmd.ReadBDADDRRP{}
+	if err := binary.Read(bytes.NewBuffer(b), binary.LittleEndian, &rp); err != nil {
+		return [6]byte{}, err
+	}
+	if rp.Status != 0x00 {
+		return [6]byte{}, cmd.ErrCommandFailed{Opcode: p.Opcode(), Status: rp.Status}
+	}
+	return rp.BDADDR, nil
+}
+
+// smpConn is the part of an HCI connection paired over.
+type smpConn interface {
+	OnSMP(f func(b []byte))
+	WriteSMP(b []byte) error
+	StartEncryption(ctx context.Context, ltk [16]byte, rand uint64, ediv uint16) error
+}
+
+// smpAddr is an address as paired with: its type, 0 for public, 1 for
+// random, and its bytes, least significant first.
+type smpAddr struct {
+	typ uint8
+	b   [6]byte
+}
+
+// bytes returns a as the pairing functions take it, in 56 bits, most
+// significant byte first.
+func (a smpAddr) bytes() []byte { return append([]byte{a.typ}, reversed(a.b[:])...) }
+
+// pairing is a pairing in progress, as the initiator, the PDUs of the
+// responder being delivered to pdus.
+type pairing struct {
+	c    smpConn
+	pdus chan []byte
+}
+
+// pair pairs, as Pair does, with the peer, of address ra, of the
+// connection c, over which the device is of address ia.
+func pair(ctx context.Context, c smpConn, ia, ra smpAddr) (PairingKeys, error) {
+	ctx, cancel := context.WithTimeout(ctx, smpTimeout)
+	defer cancel()
+	// The responder sends three PDUs at most unprompted: those
+	// distributing its keys.
+	p := &pairing{c: c, pdus: make(chan []byte, 8)}
+	c.OnSMP(func(b []byte) {
+		select {
+		case p.pdus <- b:
+		default:
+		}
+	})
+	defer c.OnSMP(nil)
+	return p.run(ctx, ia, ra)
+}
+
+func (p *pairing) run(ctx context.Context, ia, ra smpAddr) (PairingKeys, error) {
+	if err := p.c.WriteSMP(smpPairingReq); err != nil {
+		return PairingKeys{}, err
+	}
+	rsp, err := p.recv(ctx, smpPairingResponse, 7)
+	if err != nil {
+		return PairingKeys{}, err
+	}
+	switch {
+	case rsp[3]&smpSC == 0:
+		return PairingKeys{}, p.fail(0x03) // Authentication Requirements
+	case rsp[4] != smpMaxKeySize:
+		return PairingKeys{}, p.fail(0x06) // Encryption Key Size
+	}
+
+	// Public keys, exchanged as X, then Y, least significant byte first.
+	sk, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return PairingKeys{}, err
+	}
+	pka := sk.PublicKey().Bytes()[1:]
+	if err := p.c.WriteSMP(append([]byte{smpPairingPublicKey}, append(reversed(pka[:32]), reversed(pka[32:])...)...)); err != nil {
+		return PairingKeys{}, err
+	}
+	b, err := p.recv(ctx, smpPairingPublicKey, 65)
+	if err != nil {
+		return PairingKeys{}, err
+	}
+	pkb := append(reversed(b[1:33]), reversed(b[33:])...)
+	pk, err := ecdh.P256().NewPublicKey(append([]byte{0x04}, pkb...))
+	if err != nil || bytes.Equal(pkb, pka) {
+		return PairingKeys{}, p.fail(0x0B) // DHKey Check Failed: not a key of the curve, or ours reflected
+	}
+	dhkey, err := sk.ECDH(pk)
+	if err != nil {
+		return PairingKeys{}, p.fail(0x0B)
+	}
+
+	// Just Works: the confirm value of the responder, then the nonces.
+	b, err = p.recv(ctx, smpPairingConfirm, 17)
+	if err != nil {
+		return PairingKeys{}, err
+	}
+	cb := reversed(b[1:])
+	na := make([]byte, 16)
+	if _, err := rand.Read(na); err != nil {
+		return PairingKeys{}, err
+	}
+	if err := p.c.WriteSMP(append([]byte{smpPairingRandom}, reversed(na)...)); err != nil {
+		return PairingKeys{}, err
+	}
+	if b, err = p.recv(ctx, smpPairingRandom, 17); err != nil {
+		return PairingKeys{}, err
+	}
+	nb := reversed(b[1:])
+	if c := smpF4(pkb[:32], pka[:32], nb, 0); !bytes.Equal(c[:], cb) {
+		return PairingKeys{}, p.fail(0x04) // Confirm Value Failed
+	}
+
+	// Authentication stage 2: the DHKey checks.
+	mackey, ltk := smpF5(dhkey, na, nb, ia.bytes(), ra.bytes())
+	var r [16]byte
+	ea := smpF6(mackey[:], na, nb, r[:], reversed(smpPairingReq[1:4]), ia.bytes(), ra.bytes())
+	if err := p.c.WriteSMP(append([]byte{smpPairingDHKeyCheck}, reversed(ea[:])...)); err != nil {
+		return PairingKeys{}, err
+	}
+	if b, err = p.recv(ctx, smpPairingDHKeyCheck, 17); err != nil {
+		return PairingKeys{}, err
+	}
+	if eb := smpF6(mackey[:], nb, na, r[:], reversed(rsp[1:4]), ra.bytes(), ia.bytes()); !bytes.Equal(eb[:], reversed(b[1:])) {
+		return PairingKeys{}, p.fail(0x0B) // DHKey Check Failed
+	}
+
+	var keys PairingKeys
+	copy(keys.LTK[:], reversed(ltk[:]))
+	if err := p.c.StartEncryption(ctx, keys.LTK, 0, 0); err != nil {
+		return PairingKeys{}, err
+	}
+	// The keys distributed by the responder, over the link encrypted.
+	if rsp[6]&smpIdKey == 0 {
+		return keys, nil
+	}
+	if b, err = p.recv(ctx, smpIdentityInformation, 17); err != nil {
+		return PairingKeys{}, err
+	}
+	copy(keys.IRK[:], b[1:])
+	if b, err = p.recv(ctx, smpIdentityAddress, 8); err != nil {
+		return PairingKeys{}, err
+	}
+	keys.Identity, keys.IdentityAddrType = true, b[1]
+	copy(keys.IdentityAddr[:], b[2:])
+	return keys, nil
+}
+
+// recv receives the next PDU of the responder, which is to be the command
+// op, of n bytes, Security Requests aside. It returns the SMPReason of the
+// Pairing Failed command instead, if the responder failed the pairing.
+func (p *pairing) recv(ctx context.Context, op byte, n int) ([]byte, error) {
+	for {
+		select {
+		case b := <-p.pdus:
+			switch {
+			case len(b) == 0 || b[0] == smpSecurityRequest:
+				continue
+			case b[0] == smpPairingFailed && len(b) == 2:
+				return nil, SMPReason(b[1])
+			case b[0] != op:
+				return nil, p.fail(0x08) // Unspecified Reason
+			case len(b) != n:
+				return nil, p.fail(0x0A) // Invalid Parameters
+			}
+			return b, nil
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return nil, fmt.Errorf("smp: pairing timed out: %w", ctx.Err())
+			}
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// fail fails the pairing, for the reason r, and returns r.
+func (p *pairing) fail(r SMPReason) error {
+	p.c.WriteSMP([]byte{smpPairingFailed, byte(r)})
+	return r
+}
+
+// The pairing functions of LE Secure Connections, as in the Core
+// specification, Vol 3, Part H, 2.2; their arguments, and results, are
+// most significant byte first.
+
+// smpF4 computes confirm values.
+func smpF4(u, v, x []byte, z byte) [16]byte {
+	return aesCMAC(x, append(append(append([]byte(nil), u...), v...), z))
+}
+
+// smpF5 generates the MacKey, and the LTK, of the DHKey w.
+func smpF5(w, n1, n2, a1, a2 []byte) (mackey, ltk [16]byte) {
+	salt := []byte{0x6C, 0x88, 0x83, 0x91, 0xAA, 0xF5, 0xA5, 0x38, 0x60, 0x37, 0x0B, 0xDB, 0x5A, 0x60, 0x83, 0xBE}
+	t := aesCMAC(salt, w)
+	m := func(counter byte) []byte {
+		b := append([]byte{counter}, "btle"...)
+		b = append(append(append(append(b, n1...), n2...), a1...), a2...)
+		return append(b, 0x01, 0x00) // Length, of 256 bits
+	}
+	return aesCMAC(t[:], m(0)), aesCMAC(t[:], m(1))
+}
+
+// smpF6 computes the DHKey check values.
+func smpF6(w, n1, n2, r, iocap, a1, a2 []byte) [16]byte {
+	var m []byte
+	for _, b := range [][]byte{n1, n2, r, iocap, a1, a2} {
+		m = append(m, b...)
+	}
+	return aesCMAC(w, m)
+}
+
+// aesCMAC returns the AES-CMAC of m, under the key k, of 16 bytes, as in
+// RFC 4493.
+func aesCMAC(k, m []byte) [16]byte {
+	c, err := aes.NewCipher(k)
+	if err != nil {
+		panic(err) // the keys are all 16 bytes
+	}
+	var x, last [16]byte
+	c.Encrypt(x[:], x[:])
+	k1 := cmacSubkey(x)
+	k2 := cmacSubkey(k1)
+	n := (len(m) + 15) / 16
+	if n == 0 {
+		n = 1
+	}
+	rest := m[16*(n-1):]
+	copy(last[:], rest)
+	sub := k1
+	if len(rest) < 16 {
+		last[len(rest)], sub = 0x80, k2
+	}
+	x = [16]byte{}
+	for i := 0; i < n; i++ {
+		b := last[:]
+		if i < n-1 {
+			b = m[16*i : 16*i+16]
+		}
+		for j := range x {
+			x[j] ^= b[j]
+			if i == n-1 {
+				x[j] ^= sub[j]
+			}
+		}
+		c.Encrypt(x[:], x[:])
+	}
+	return x
+}
+
+// cmacSubkey derives a subkey of AES-CMAC from l, shifting it left by a
+// bit.
+func cmacSubkey(l [16]byte) [16]byte {
+	var k [16]byte
+	for i := range k {
+		k[i] = l[i] << 1
+		if i < 15 {
+			k[i] |= l[i+1] >> 7
+		}
+	}
+	if l[0]&0x80 != 0 {
+		k[15] ^= 0x87
+	}
+	return k
+}
+
+// reversed returns a copy of b, its bytes in the reverse order.
+func reversed(b []byte) []byte {
+	r := make([]byte, len(b))
+	for i, c := range b {
+		r[len(b)-1-i] = c
+	}
+	return r
+}
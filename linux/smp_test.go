@@ -0,0 +1,259 @@
+package linux
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/paypal/gatt/linux/internal/cmd"
+	"github.com/paypal/gatt/linux/internal/l2cap"
+)
+
+func unhex(s string) []byte {
+	b, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestAESCMAC(t *testing.T) {
+	// RFC 4493, 4.
+	k := unhex("2b7e1516 28aed2a6 abf71588 09cf4f3c")
+	m := unhex("6bc1bee2 2e409f96 e93d7e11 7393172a ae2d8a57 1e03ac9c 9eb76fac 45af8e51 30c81c46 a35ce411 e5fbc119 1a0a52ef f69f2445 df4f9b17 ad2b417b e66c3710")
+	for _, tt := range []struct {
+		n    int
+		want string
+	}{
+		{0, "bb1d6929 e9593728 7fa37d12 9b756746"},
+		{16, "070a16b4 6b4d4144 f79bdd9d d04a287c"},
+		{40, "dfa66747 de9ae630 30ca3261 1497c827"},
+		{64, "51f0bebf 7e3b9d92 fc497417 79363cfe"},
+	} {
+		if got := aesCMAC(k, m[:tt.n]); !bytes.Equal(got[:], unhex(tt.want)) {
+			t.Errorf("AES-CMAC of %d bytes = %x, want %s", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestSMPFunctions(t *testing.T) {
+	// Core specification, Vol 3, Part H, D.2 to D.4.
+	u := unhex("20b003d2 f297be2c 5e2c83a7 e9f9a5b9 eff49111 acf4fddb cc030148 0e359de6")
+	v := unhex("55188b3d 32f6bb9a 900afcfb eed4e72a 59cb9ac2 f19d7cfb 6b4fdd49 f47fc5fd")
+	n1 := unhex("d5cb8454 d177733e ffffb2ec 712baeab")
+	n2 := unhex("a6e8e7cc 25a75f6e 216583f7 ff3dc4cf")
+	a1, a2 := unhex("00561237 37bfce"), unhex("00a71370 2dcfc1")
+	if got, want := smpF4(u, v, n1, 0), unhex("f2c916f1 07a9bd1c f1eda1be a974872d"); !bytes.Equal(got[:], want) {
+		t.Errorf("f4 = %x, want %x", got, want)
+	}
+	w := unhex("ec0234a3 57c8ad05 341010a6 0a397d9b 99796b13 b4f866f1 868d34f3 73bfa698")
+	mackey, ltk := smpF5(w, n1, n2, a1, a2)
+	if want := unhex("2965f176 a1084a02 fd3f6a20 ce636e20"); !bytes.Equal(mackey[:], want) {
+		t.Errorf("f5 MacKey = %x, want %x", mackey, want)
+	}
+	if want := unhex("69867911 69d7cd23 980522b5 94750a38"); !bytes.Equal(ltk[:], want) {
+		t.Errorf("f5 LTK = %x, want %x", ltk, want)
+	}
+	r := unhex("12a3343b b453bb54 08da42d2 0c2d0fc8")
+	if got, want := smpF6(mackey[:], n1, n2, r, unhex("010102"), a1, a2), unhex("e3c47398 9cd0e8c5 d26c0b09 da958f61"); !bytes.Equal(got[:], want) {
+		t.Errorf("f6 = %x, want %x", got, want)
+	}
+}
+
+// smpPeer is the responder of a pairing, over a fake device.
+type smpPeer struct {
+	t    *testing.T
+	d    *fakeDevice
+	sent [][]byte
+}
+
+// next waits for the initiator to write an SMP PDU, and returns it.
+func (p *smpPeer) next() []byte {
+	p.t.Helper()
+	for deadline := time.Now().Add(time.Second); len(p.sent) == 0 && time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		p.sent = append(p.sent, p.d.sentACL()...)
+	}
+	if len(p.sent) == 0 {
+		p.t.Fatal("no SMP PDU written")
+	}
+	b := p.sent[0]
+	p.sent = p.sent[1:]
+	return b
+}
+
+func (p *smpPeer) send(b ...byte) { p.d.rc <- l2capPkt(0x0006, b...) }
+
+// newPairingTest returns an HCI connected, as the central, to the peer
+// 66:55:44:33:22:11, over a controller of address 06:05:04:03:02:01.
+func newPairingTest(t *testing.T) (*HCI, *l2cap.Conn, *smpPeer) {
+	h, d := newTestHCI(new(uint64))
+	h.l2c.SetDataLength(27, 328, 251) // the Public Keys unfragmented
+	d.mu.Lock()
+	d.rsp = map[cmd.Opcode][]byte{(cmd.ReadBDADDR{}).Opcode(): {0x01, 0x02, 0x03, 0x04, 0x05, 0x06}}
+	d.mu.Unlock()
+	pkt := append([]byte(nil), connCompletePkt...)
+	pkt[7] = 0x00 // master
+	d.rc <- pkt
+	return h, <-h.l2c.ConnC(), &smpPeer{t: t, d: d}
+}
+
+func TestPair(t *testing.T) {
+	h, c, p := newPairingTest(t)
+	defer h.Close()
+	type result struct {
+		keys PairingKeys
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		keys, err := h.Pair(context.Background(), c)
+		done <- result{keys, err}
+	}()
+
+	if b := p.next(); !bytes.Equal(b, smpPairingReq) {
+		t.Fatalf("Pairing Request = % X, want % X", b, smpPairingReq)
+	}
+	rsp := []byte{smpPairingResponse, smpNoInputNoOutput, 0x00, smpBonding | smpSC, 16, 0x00, smpIdKey}
+	p.send(rsp...)
+	b := p.next()
+	if len(b) != 65 || b[0] != smpPairingPublicKey {
+		t.Fatalf("Pairing Public Key = % X", b)
+	}
+	pka := append(reversed(b[1:33]), reversed(b[33:])...)
+	sk, _ := ecdh.P256().GenerateKey(rand.Reader)
+	pkb := sk.PublicKey().Bytes()[1:]
+	p.send(append([]byte{smpPairingPublicKey}, append(reversed(pkb[:32]), reversed(pkb[32:])...)...)...)
+	pk, err := ecdh.P256().NewPublicKey(append([]byte{0x04}, pka...))
+	if err != nil {
+		t.Fatalf("public key of the initiator: %v", err)
+	}
+	dhkey, _ := sk.ECDH(pk)
+
+	nb := make([]byte, 16)
+	rand.Read(nb)
+	cb := smpF4(pkb[:32], pka[:32], nb, 0)
+	p.send(append([]byte{smpPairingConfirm}, reversed(cb[:])...)...)
+	b = p.next()
+	if len(b) != 17 || b[0] != smpPairingRandom {
+		t.Fatalf("Pairing Random = % X", b)
+	}
+	na := reversed(b[1:])
+	p.send(append([]byte{smpPairingRandom}, reversed(nb)...)...)
+
+	a := smpAddr{AddrPublic, [6]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06}}.bytes()
+	bb := smpAddr{AddrPublic, [6]byte{0x11, 0x22, 0x33, 0x44, 0x55, 0x66}}.bytes()
+	mackey, ltk := smpF5(dhkey, na, nb, a, bb)
+	var r [16]byte
+	ea := smpF6(mackey[:], na, nb, r[:], []byte{smpBonding | smpSC, 0x00, smpNoInputNoOutput}, a, bb)
+	if b = p.next(); !bytes.Equal(b, append([]byte{smpPairingDHKeyCheck}, reversed(ea[:])...)) {
+		t.Fatalf("Pairing DHKey Check = % X, want %X", b, ea)
+	}
+	eb := smpF6(mackey[:], nb, na, r[:], []byte{smpBonding | smpSC, 0x00, smpNoInputNoOutput}, bb, a)
+	p.send(append([]byte{smpPairingDHKeyCheck}, reversed(eb[:])...)...)
+
+	var start []byte
+	for deadline := time.Now().Add(time.Second); start == nil && time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		for _, b := range p.d.sent() {
+			if cmd.Opcode(uint16(b[1])|uint16(b[2])<<8) == (cmd.LEStartEncryption{}).Opcode() {
+				start = b
+			}
+		}
+	}
+	if start == nil {
+		t.Fatal("LE Start Encryption not sent")
+	}
+	if want := reversed(ltk[:]); !bytes.Equal(start[len(start)-16:], want) {
+		t.Errorf("LE Start Encryption with the LTK % X, want % X", start[len(start)-16:], want)
+	}
+	p.d.rc <- []byte{0x04, 0x08, 0x04, 0x00, 0x40, 0x00, 0x01} // Encryption Change, on
+	irk := unhex("000102030405060708090a0b0c0d0e0f")
+	p.send(append([]byte{smpIdentityInformation}, irk...)...)
+	p.send(smpIdentityAddress, AddrRandom, 0xA1, 0xA2, 0xA3, 0xA4, 0xA5, 0xC6)
+
+	select {
+	case res := <-done:
+		if res.err != nil {
+			t.Fatalf("Pair = %v", res.err)
+		}
+		want := PairingKeys{Identity: true, IdentityAddr: [6]byte{0xA1, 0xA2, 0xA3, 0xA4, 0xA5, 0xC6}, IdentityAddrType: AddrRandom}
+		copy(want.LTK[:], reversed(ltk[:]))
+		copy(want.IRK[:], irk)
+		if res.keys != want {
+			t.Errorf("Pair = %+v, want %+v", res.keys, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Pair not done")
+	}
+}
+
+func TestPairFailed(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		rsp  []byte
+		want SMPReason
+		sent []byte // Pairing Failed, by the initiator
+	}{
+		{"legacy", []byte{smpPairingResponse, smpNoInputNoOutput, 0x00, smpBonding, 16, 0x00, 0x00}, 0x03, []byte{smpPairingFailed, 0x03}},
+		{"key size", []byte{smpPairingResponse, smpNoInputNoOutput, 0x00, smpBonding | smpSC, 7, 0x00, 0x00}, 0x06, []byte{smpPairingFailed, 0x06}},
+		{"by the peer", []byte{smpPairingFailed, 0x05}, 0x05, nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			h, c, p := newPairingTest(t)
+			defer h.Close()
+			done := make(chan error, 1)
+			go func() {
+				_, err := h.Pair(context.Background(), c)
+				done <- err
+			}()
+			p.next()
+			p.send(tt.rsp...)
+			select {
+			case err := <-done:
+				var r SMPReason
+				if !errors.As(err, &r) || r != tt.want {
+					t.Errorf("Pair = %v, want %v", err, tt.want)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("Pair not done")
+			}
+			if tt.sent != nil {
+				if b := p.next(); !bytes.Equal(b, tt.sent) {
+					t.Errorf("sent % X, want % X", b, tt.sent)
+				}
+			}
+		})
+	}
+}
+
+func TestPairResolvedIdentity(t *testing.T) {
+	h, d := newTestHCI(new(uint64))
+	defer h.Close()
+	pkt := append([]byte(nil), connCompletePkt...)
+	pkt[7] = 0x00 // master
+	pkt[8] = AddrRandomIdentity
+	d.rc <- pkt
+	if _, err := h.Pair(context.Background(), <-h.l2c.ConnC()); err == nil {
+		t.Fatal("Pair with a resolved identity address succeeded")
+	}
+	if b := d.sentACL(); len(b) != 0 {
+		t.Errorf("sent % X, want nothing", b)
+	}
+}
+
+func TestPairingRefused(t *testing.T) {
+	h, d := newTestHCI(new(uint64))
+	defer h.Close()
+	d.rc <- connCompletePkt
+	<-h.l2c.ConnC()
+	p := &smpPeer{t: t, d: d}
+	p.send(smpPairingRequest, smpNoInputNoOutput, 0x00, smpBonding|smpSC, 16, 0x00, 0x00)
+	if b := p.next(); !bytes.Equal(b, []byte{smpPairingFailed, 0x05}) {
+		t.Errorf("sent % X, want Pairing Failed, Pairing Not Supported", b)
+	}
+}
@@ -0,0 +1,98 @@
+package linux
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Snoop sets a writer the HCI captures every packet it exchanges with the
+// controller to, in the btsnoop format Wireshark opens, as the HCI UART
+// (H4) datalink: the commands and the ACL and ISO data written, and the
+// events and data read, advertising reports included. Once a write to w
+// fails, capturing stops, and the error is reported to the HandlerErrors
+// function. If nil, the default, nothing is captured.
+//
+//	f, err := os.Create("hci.btsnoop")
+//	...
+//	h, err := linux.OpenHCI(linux.Snoop(f))
+func Snoop(w io.Writer) HCIOption {
+	return func(c *hciConfig) { c.snoop = w }
+}
+
+// The btsnoop format: a header, then a record per packet, all big-endian.
+const (
+	btsnoopVersion  = 1
+	btsnoopH4       = 1002 // the datalink of the HCI UART, the packet type first
+	btsnoopReceived = 1 << 0
+	btsnoopCmdEvt   = 1 << 1
+
+	// btsnoopEpoch is the Unix epoch, in microseconds since midnight,
+	// January 1st, 0 AD, the epoch of the timestamps of the records.
+	btsnoopEpoch = 0x00DCDDB30F2F8000
+)
+
+// A snooper captures packets to a writer, in the btsnoop format.
+type snooper struct {
+	mu     sync.Mutex
+	w      io.Writer
+	header bool // written
+	failed bool
+	report func(err error)
+}
+
+// capture records the packet b, received from the controller, or sent to
+// it.
+func (s *snooper) capture(b []byte, received bool) {
+	if len(b) == 0 {
+		return
+	}
+	var flags uint32
+	if received {
+		flags |= btsnoopReceived
+	}
+	if t := PacketType(b[0]); t == ptypeCommandPkt || t == ptypeEventPkt {
+		flags |= btsnoopCmdEvt
+	}
+	rec := make([]byte, 24, 24+len(b))
+	binary.BigEndian.PutUint32(rec[0:], uint32(len(b))) // original length
+	binary.BigEndian.PutUint32(rec[4:], uint32(len(b))) // included length
+	binary.BigEndian.PutUint32(rec[8:], flags)
+	binary.BigEndian.PutUint32(rec[12:], 0) // cumulative drops
+	binary.BigEndian.PutUint64(rec[16:], uint64(time.Now().UnixNano()/1e3+btsnoopEpoch))
+	rec = append(rec, b...)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failed {
+		return
+	}
+	if !s.header {
+		hdr := make([]byte, 16)
+		copy(hdr, "btsnoop\x00")
+		binary.BigEndian.PutUint32(hdr[8:], btsnoopVersion)
+		binary.BigEndian.PutUint32(hdr[12:], btsnoopH4)
+		rec = append(hdr, rec...)
+		s.header = true
+	}
+	if _, err := s.w.Write(rec); err != nil {
+		s.failed = true
+		s.report(fmt.Errorf("hci: snoop: %w", err))
+	}
+}
+
+// snoopWriter captures the packets written to the device.
+type snoopWriter struct {
+	io.ReadWriter
+	s *snooper
+}
+
+func (w snoopWriter) Write(b []byte) (int, error) {
+	n, err := w.ReadWriter.Write(b)
+	if err == nil {
+		w.s.capture(b, false)
+	}
+	return n, err
+}
@@ -0,0 +1,103 @@
+package linux
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/paypal/gatt/linux/internal/cmd"
+)
+
+func TestSnoop(t *testing.T) {
+	var buf bytes.Buffer
+	cfg := defaultHCIConfig()
+	cfg.snoop = &buf
+	h := newHCI(newFakeDevice(), cfg)
+	h.startReading()
+	if _, err := h.cmd.Send(cmd.Reset{}); err != nil {
+		t.Fatal(err)
+	}
+	h.Close()
+
+	b := buf.Bytes()
+	if want := []byte("btsnoop\x00\x00\x00\x00\x01\x00\x00\x03\xEA"); !bytes.HasPrefix(b, want) {
+		t.Fatalf("header % X, want % X", b[:16], want)
+	}
+	b = b[16:]
+	for _, want := range []struct {
+		flags uint32
+		pkt   []byte
+	}{
+		{btsnoopCmdEvt, []byte{0x01, 0x03, 0x0C, 0x00}},                                     // Reset
+		{btsnoopCmdEvt | btsnoopReceived, []byte{0x04, 0x0E, 0x04, 0x01, 0x03, 0x0C, 0x00}}, // Command Complete
+	} {
+		if len(b) < 24 {
+			t.Fatalf("record of % X missing", want.pkt)
+		}
+		n := binary.BigEndian.Uint32(b[4:])
+		flags := binary.BigEndian.Uint32(b[8:])
+		ts := binary.BigEndian.Uint64(b[16:])
+		pkt := b[24 : 24+n]
+		if flags != want.flags || !bytes.Equal(pkt, want.pkt) || ts < btsnoopEpoch {
+			t.Errorf("record: flags %d, % X, at %d, want flags %d, % X", flags, pkt, ts, want.flags, want.pkt)
+		}
+		b = b[24+n:]
+	}
+	if len(b) > 0 {
+		t.Errorf("% X left over", b)
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(b []byte) (int, error) { return 0, errors.New("disk full") }
+
+func TestSnoopFailure(t *testing.T) {
+	var errs []error
+	s := &snooper{w: failingWriter{}, report: func(err error) { errs = append(errs, err) }}
+	s.capture([]byte{0x01, 0x03, 0x0C, 0x00}, false)
+	s.capture([]byte{0x01, 0x03, 0x0C, 0x00}, false)
+	if len(errs) != 1 {
+		t.Errorf("reported %v, want the failure once", errs)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	var buf bytes.Buffer
+	s := &snooper{w: &buf}
+	s.capture(connCompletePkt, true)
+	s.capture([]byte{0x01, 0x03, 0x0C, 0x00}, false) // sent: skipped
+	s.capture([]byte{0x02, 0x40, 0x20, 0x07, 0x00, 0x07, 0x00, 0x04, 0x00, 0x1B, 0x0D, 0x00}, true)
+	s.capture([]byte{0x02, 0x40, 0x10, 0x04, 0x00, 'g', 'a', 't', 't'}, true) // continuation
+	s.capture([]byte{0x04, 0x05, 0x04, 0x00, 0x40, 0x00, 0x13}, true)         // Disconnection Complete
+	capture := buf.Bytes()
+
+	h := newHCI(newFakeDevice(), defaultHCIConfig())
+	defer h.Close()
+	h.l2c.Adv = fakeAdv{}
+	type result struct {
+		n   int
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		n, err := h.Replay(bytes.NewReader(capture))
+		done <- result{n, err}
+	}()
+	c := <-h.l2c.ConnC()
+	b := make([]byte, 64)
+	m, err := c.Read(b)
+	if want := []byte{0x1B, 0x0D, 0x00, 'g', 'a', 't', 't'}; err != nil || !bytes.Equal(b[:m], want) {
+		t.Errorf("Read() = % X, %v, want % X, reassembled", b[:m], err, want)
+	}
+	if r := <-done; r.err != nil || r.n != 4 {
+		t.Fatalf("Replay() = %d, %v, want 4 packets", r.n, r.err)
+	}
+
+	h = newHCI(newFakeDevice(), defaultHCIConfig())
+	defer h.Close()
+	if _, err := h.Replay(bytes.NewReader(capture[:20])); err == nil {
+		t.Error("Replay of a truncated capture succeeded")
+	}
+}
@@ -0,0 +1,176 @@
+package linux
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/paypal/gatt/internal/param"
+)
+
+// MaxAdvertisingPacketLength is the maximum length, in bytes, of the
+// advertising data, and of the scan response data.
+const MaxAdvertisingPacketLength = 31
+
+// ErrInvalidParameter is the error of a parameter out of the range the
+// specification allows, caught before the command is sent. It is the
+// gatt.ErrInvalidParameter.
+type ErrInvalidParameter = param.ErrInvalid
+
+// checks returns the first error of errs, if any.
+func checks(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkRange returns an ErrInvalidParameter if v is out of [min, max],
+// wrapped with the prefix of the HCI.
+func checkRange(name string, v, min, max int) error {
+	if err := param.CheckRange(name, v, min, max); err != nil {
+		return fmt.Errorf("hci: %w", err)
+	}
+	return nil
+}
+
+func (c hciConfig) check() error {
+	var baud error
+	if c.uart != "" {
+		baud = checkRange("UART baud rate", c.baud, 1200, 4000000)
+	}
+	return checks(
+		baud,
+		checkRange("MaxConnections", c.maxConn, 1, 0xEFF),
+		checkRange("ScanParameters interval", int(c.scanInterval), 0x0004, 0x4000),
+		checkRange("ScanParameters window", int(c.scanWindow), 0x0004, int(c.scanInterval)),
+	)
+}
+
+func (a *advertiser) check() error {
+	max, err := a.maxDataLength()
+	if err != nil {
+		return err
+	}
+	return checks(
+		checkRange("AdvertisingIntervalMin", int(a.advertisingIntervalMin), 0x0020, 0x4000),
+		checkRange("AdvertisingIntervalMax", int(a.advertisingIntervalMax), int(a.advertisingIntervalMin), 0x4000),
+		checkRange("AdvertisingChannelMap", int(a.advertisingChannelMap), 0x01, 0x07),
+		a.checkData("len(AdvertisingPacket)+len(ManufacturerData)", "len(ScanResponsePacket)",
+			len(a.advertisingPacket)+len(a.manufacturerData), len(a.scanResponsePacket), max),
+	)
+}
+
+// checkData checks the length of the advertising data, ad, and that of
+// the scan response data, sr, named adParam and srParam, against max:
+// each, or both together if a is extended, and advertises them as one.
+func (a *advertiser) checkData(adParam, srParam string, ad, sr, max int) error {
+	if a.extended {
+		return checkRange(adParam+"+"+srParam, ad+sr, 0, max)
+	}
+	return checks(checkRange(adParam, ad, 0, max), checkRange(srParam, sr, 0, max))
+}
+
+func checkConnParams(p ConnParams) error {
+	// The supervision timeout, in units of 10 ms, must exceed twice the
+	// interval, in units of 1.25 ms, times the latency plus one.
+	minTimeout := (1+int(p.Latency))*int(p.IntervalMax)/4 + 1
+	if minTimeout < 0x000A {
+		minTimeout = 0x000A
+	}
+	return checks(
+		checkRange("ConnParams.IntervalMin", int(p.IntervalMin), 0x0006, 0x0C80),
+		checkRange("ConnParams.IntervalMax", int(p.IntervalMax), int(p.IntervalMin), 0x0C80),
+		checkRange("ConnParams.Latency", int(p.Latency), 0x0000, 0x01F3),
+		checkRange("ConnParams.SupervisionTimeout", int(p.SupervisionTimeout), minTimeout, 0x0C80),
+	)
+}
+
+func checkCIG(p CIGParameters) error {
+	err := checks(
+		checkRange("CIGParameters.SDUIntervalMToS", int(p.SDUIntervalMToS), 0x0000FF, 0x0FFFFF),
+		checkRange("CIGParameters.SDUIntervalSToM", int(p.SDUIntervalSToM), 0x0000FF, 0x0FFFFF),
+		checkRange("CIGParameters.WorstCaseSCA", int(p.WorstCaseSCA), 0, 7),
+		checkRange("CIGParameters.Packing", int(p.Packing), 0, 1),
+		checkRange("CIGParameters.Framing", int(p.Framing), 0, 1),
+		checkRange("CIGParameters.MaxTransportLatencyMToS", int(p.MaxTransportLatencyMToS), 0x0005, 0x0FA0),
+		checkRange("CIGParameters.MaxTransportLatencySToM", int(p.MaxTransportLatencySToM), 0x0005, 0x0FA0),
+		checkRange("len(CIGParameters.CIS)", len(p.CIS), 1, 0x1F),
+	)
+	for i, c := range p.CIS {
+		if err != nil {
+			break
+		}
+		f := fmt.Sprintf("CIGParameters.CIS[%d].", i)
+		err = checks(
+			checkRange(f+"CISID", int(c.CISID), 0, 0xEF),
+			checkRange(f+"MaxSDUMToS", int(c.MaxSDUMToS), 0, 0x0FFF),
+			checkRange(f+"MaxSDUSToM", int(c.MaxSDUSToM), 0, 0x0FFF),
+			checkRange(f+"PHYMToS", int(c.PHYMToS), 0x01, 0x07),
+			checkRange(f+"PHYSToM", int(c.PHYSToM), 0x01, 0x07),
+		)
+	}
+	return err
+}
+
+func checkBIG(p BIGParameters) error {
+	return checks(
+		checkRange("BIGParameters.BIGHandle", int(p.BIGHandle), 0, 0xEF),
+		checkRange("BIGParameters.AdvertisingHandle", int(p.AdvertisingHandle), 0, 0xEF),
+		checkRange("BIGParameters.NumBIS", int(p.NumBIS), 1, 0x1F),
+		checkRange("BIGParameters.SDUInterval", int(p.SDUInterval), 0x0000FF, 0x0FFFFF),
+		checkRange("BIGParameters.MaxSDU", int(p.MaxSDU), 1, 0x0FFF),
+		checkRange("BIGParameters.MaxTransportLatency", int(p.MaxTransportLatency), 0x0005, 0x0FA0),
+		checkRange("BIGParameters.RTN", int(p.RTN), 0, 0x1E),
+		checkRange("BIGParameters.PHY", int(p.PHY), 0x01, 0x07),
+		checkRange("BIGParameters.Packing", int(p.Packing), 0, 1),
+		checkRange("BIGParameters.Framing", int(p.Framing), 0, 1),
+		checkRange("BIGParameters.Encryption", int(p.Encryption), 0, 1),
+	)
+}
+
+func checkPathLoss(t PathLossThresholds) error {
+	// The zones must not overlap: the low zone, with its hysteresis, ends
+	// below the high one.
+	return checks(
+		checkRange("PathLossThresholds.High", int(t.High), int(t.Low), 0xFF),
+		checkRange("PathLossThresholds.LowHysteresis", int(t.LowHysteresis), 0, int(t.High)-int(t.Low)),
+		checkRange("PathLossThresholds.HighHysteresis", int(t.HighHysteresis), 0, int(t.High)-int(t.Low)-int(t.LowHysteresis)),
+	)
+}
+
+func (a *advertiser) checkRotation(ps []AdvPayload, period, jitter, min time.Duration) error {
+	max, err := a.maxDataLength()
+	if err != nil {
+		return err
+	}
+	errs := []error{
+		checkRange("len(AdvPayloads)", len(ps), 1, math.MaxInt32),
+		checkRange("Rotate period, in ms", int(period/time.Millisecond), int(min/time.Millisecond), math.MaxInt32),
+		checkRange("Rotate jitter, in ms", int(jitter/time.Millisecond), 0, int(period/2/time.Millisecond)),
+	}
+	for _, p := range ps {
+		errs = append(errs, a.checkData("len(AdvPayload.AdvertisingData)", "len(AdvPayload.ScanResponseData)",
+			len(p.AdvertisingData), len(p.ScanResponseData), max))
+	}
+	return checks(errs...)
+}
+
+// checkSchedule checks the slots of Schedule, which must last no shorter
+// than min each.
+func (a *advertiser) checkSchedule(slots []AdvSlot, min time.Duration) error {
+	max, err := a.maxDataLength()
+	if err != nil {
+		return err
+	}
+	errs := []error{checkRange("len(AdvSlots)", len(slots), 1, math.MaxInt32)}
+	for _, s := range slots {
+		errs = append(errs,
+			checkRange("AdvSlot.Duration, in ms", int(s.Duration/time.Millisecond), int(min/time.Millisecond), math.MaxInt32),
+			a.checkData("len(AdvSlot.AdvertisingData)", "len(AdvSlot.ScanResponseData)",
+				len(s.AdvertisingData), len(s.ScanResponseData), max))
+	}
+	return checks(errs...)
+}
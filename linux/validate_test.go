@@ -0,0 +1,45 @@
+package linux
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	a := NewAdvertiser(nil)
+	AdvertisingIntervalMin(0x0010)(a)
+	cig := CIGParameters{
+		SDUIntervalMToS:         10000,
+		SDUIntervalSToM:         10000,
+		MaxTransportLatencyMToS: 10,
+		MaxTransportLatencySToM: 10,
+		CIS:                     []CISParameters{{MaxSDUMToS: 40, PHYMToS: 0x02, PHYSToM: 0x00}},
+	}
+	_, errOpen := OpenHCI(ScanParameters(0x0010, 0x0020))
+	cases := []struct {
+		name  string
+		err   error
+		param string // of the ErrInvalidParameter; empty if valid
+	}{
+		{"conn params", checkConnParams(DefaultConnParams), ""},
+		{"interval", checkConnParams(ConnParams{IntervalMin: 0x0028, IntervalMax: 0x0018, SupervisionTimeout: 0x01F4}), "ConnParams.IntervalMax"},
+		{"timeout", checkConnParams(ConnParams{IntervalMin: 0x0018, IntervalMax: 0x0C80, Latency: 4, SupervisionTimeout: 0x01F4}), "ConnParams.SupervisionTimeout"},
+		{"advertising interval", a.check(), "AdvertisingIntervalMin"},
+		{"CIS", checkCIG(cig), "CIGParameters.CIS[0].PHYSToM"},
+		{"scan window", errOpen, "ScanParameters window"},
+	}
+	for _, tt := range cases {
+		var e ErrInvalidParameter
+		switch {
+		case tt.param == "" && tt.err != nil:
+			t.Errorf("%s: %v", tt.name, tt.err)
+		case tt.param != "" && !errors.As(tt.err, &e):
+			t.Errorf("%s: got %v, want ErrInvalidParameter", tt.name, tt.err)
+		case tt.param != "" && e.Param != tt.param:
+			t.Errorf("%s: got %v, want an error of %s", tt.name, tt.err, tt.param)
+		case tt.param != "" && !strings.HasPrefix(tt.err.Error(), "hci: "+tt.param+" = "):
+			t.Errorf("%s: got %q, want it prefixed with %q", tt.name, tt.err, "hci: ")
+		}
+	}
+}
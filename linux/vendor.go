@@ -0,0 +1,75 @@
+package linux
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/paypal/gatt/linux/internal/cmd"
+	"github.com/paypal/gatt/linux/internal/hci"
+)
+
+type vendorState struct {
+	mu sync.Mutex
+	f  func(b []byte) error
+}
+
+// HandleVendor registers the function the vendor specific packets of the
+// controller are delivered to, e.g. the firmware status, or diagnostics,
+// of Broadcom and Realtek radios: those of the vendor packet type, and
+// the Vendor Specific events, each whole, its packet type (0xFF, or 0x04
+// for an event) first. f may keep b. The errors it returns are logged.
+// If nil, the default, those packets are dropped as unsupported.
+func (h HCI) HandleVendor(f func(b []byte) error) {
+	h.vendor.mu.Lock()
+	defer h.vendor.mu.Unlock()
+	h.vendor.f = f
+}
+
+// handleVendor hands the packet b, of the vendor packet type, or a
+// Vendor Specific event, to the HandleVendor function.
+func (h HCI) handleVendor(b []byte) error {
+	h.vendor.mu.Lock()
+	f := h.vendor.f
+	h.vendor.mu.Unlock()
+	if f == nil {
+		return fmt.Errorf("vendor packet: %w", hci.ErrUnsupported)
+	}
+	var err error
+	h.call("vendor", func() { err = f(b) })
+	if err != nil {
+		return fmt.Errorf("vendor packet: %w", err)
+	}
+	return nil
+}
+
+// handleVendorEvent hands a Vendor Specific event, of parameters b, to
+// the Ranger, if it handles them, or to the HandleVendor function.
+func (h HCI) handleVendorEvent(b []byte) error {
+	if handled, err := h.handleVendorRanging(b); handled {
+		return err
+	}
+	return h.handleVendor(append([]byte{byte(ptypeEventPkt), 0xFF, byte(len(b))}, b...))
+}
+
+// SendCommand sends the raw command c, e.g. a vendor specific one reading
+// the temperature of the chip, or setting its BD_ADDR, and waits for the
+// controller to complete it, or for ctx to be done. It returns the return
+// parameters of the Command Complete event, their status first, or the
+// status alone for the commands answered with a Command Status event.
+// If the status is not success, it returns them along with an
+// ErrCommandFailed, for those of the vendor commands that do not lead
+// with a status to be read still.
+func (h HCI) SendCommand(ctx context.Context, c Command) ([]byte, error) {
+	if err := checkRange("Command.Params length", len(c.Params), 0, 0xFF); err != nil {
+		return nil, err
+	}
+	rp, err := h.cmd.SendCtx(ctx, rawCmd{c.Opcode, c.Params})
+	if err != nil {
+		return nil, err
+	}
+	if len(rp) > 0 && rp[0] != 0x00 {
+		return rp, cmd.ErrCommandFailed{Opcode: cmd.Opcode(c.Opcode), Status: rp[0]}
+	}
+	return rp, nil
+}
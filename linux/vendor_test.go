@@ -0,0 +1,62 @@
+package linux
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/paypal/gatt/linux/internal/cmd"
+)
+
+func TestHandleVendor(t *testing.T) {
+	h, d := newTestHCI(new(uint64))
+	defer h.Close()
+	c := make(chan []byte, 2)
+	h.HandleVendor(func(b []byte) error {
+		c <- b
+		return nil
+	})
+	for _, p := range [][]byte{
+		{0xFF, 0x01, 0x02},             // vendor packet
+		{0x04, 0xFF, 0x02, 0xAA, 0xBB}, // Vendor Specific event
+	} {
+		d.rc <- p
+		select {
+		case b := <-c:
+			if !bytes.Equal(b, p) {
+				t.Errorf("HandleVendor got [% X], want [% X]", b, p)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("[% X] not handed to HandleVendor", p)
+		}
+	}
+}
+
+func TestSendCommand(t *testing.T) {
+	h, d := newTestHCI(new(uint64))
+	defer h.Close()
+	const op = 0xFC01 // vendor specific
+	d.rsp = map[cmd.Opcode][]byte{op: {0x2A}}
+	rp, err := h.SendCommand(context.Background(), Command{Opcode: op, Params: []byte{0x11, 0x22}})
+	if err != nil || !bytes.Equal(rp, []byte{0x00, 0x2A}) {
+		t.Errorf("SendCommand() = [% X], %v, want [00 2A]", rp, err)
+	}
+	sent := d.sent()
+	if want := []byte{0x01, 0x01, 0xFC, 0x02, 0x11, 0x22}; len(sent) != 1 || !bytes.Equal(sent[0], want) {
+		t.Errorf("sent %X, want [% X]", sent, want)
+	}
+
+	d.status = map[cmd.Opcode][]uint8{op: {0x01}}
+	rp, err = h.SendCommand(context.Background(), Command{Opcode: op})
+	var failed ErrCommandFailed
+	if !errors.As(err, &failed) || failed.Status != 0x01 || !bytes.Equal(rp, []byte{0x01, 0x2A}) {
+		t.Errorf("SendCommand() = [% X], %v, want [01 2A], status 0x01", rp, err)
+	}
+
+	var invalid ErrInvalidParameter
+	if _, err := h.SendCommand(context.Background(), Command{Opcode: op, Params: make([]byte, 256)}); !errors.As(err, &invalid) {
+		t.Errorf("SendCommand() of 256 bytes = %v, want an ErrInvalidParameter", err)
+	}
+}
@@ -0,0 +1,100 @@
+package gatt
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// Loopback connects a central, in process, to the server, as if over the
+// air, so that its services are tested without radio hardware: those
+// added with AddService, along with svcs, built with NewService, and
+// added by the first call, are laid out as Serve would, and served to the
+// central through the ATT PDUs of a real connection, of remote address
+// addr, the Connect and Disconnect callbacks called as usual. It returns
+// a Client of the central; closing its Conn disconnects both ends. The
+// server must not be serving. See also the gatttest package.
+func (s *Server) Loopback(addr Addr, svcs ...*Service) (*Client, error) {
+	if err := s.prepare(svcs); err != nil {
+		return nil, err
+	}
+	pa, pb := newPipe()
+	s.attach(pa, addr)
+	return NewServer(Name("")).Attach(pb, PublicAddr(s.addr))
+}
+
+// Attach serves a connection, of remote address addr, whose ATT PDUs are
+// carried by rwc, one per Read or Write, as those of a connection of the
+// HCI are, e.g. by a fake peer, scripted by a test. It returns a Client
+// of the peer; closing its Conn, or rwc failing, disconnects. The server
+// must not be serving. See also Loopback, and the gatttest package.
+func (s *Server) Attach(rwc io.ReadWriteCloser, addr Addr) (*Client, error) {
+	if err := s.prepare(nil); err != nil {
+		return nil, err
+	}
+	return s.attach(rwc, addr), nil
+}
+
+// prepare lays the services out, along with svcs, unless they have been
+// already, for connections to be attached.
+func (s *Server) prepare(svcs []*Service) error {
+	if s.serving {
+		return errors.New("gatt: cannot attach connections to a server running")
+	}
+	if err := s.validate(); err != nil {
+		return err
+	}
+	if s.handles == nil {
+		s.services = append(s.services, svcs...)
+		return s.setServices()
+	}
+	return nil
+}
+
+func (s *Server) attach(rwc io.ReadWriteCloser, addr Addr) *Client {
+	c := newConn(s, rwc, addr)
+	go func() {
+		s.connected(c)
+		c.loop()
+		s.disconnected(c)
+	}()
+	return &Client{c: c}
+}
+
+// pipeEnd is an end of an in-memory link, which keeps the boundaries of
+// the packets written.
+type pipeEnd struct {
+	r      <-chan []byte
+	w      chan<- []byte
+	closed chan struct{}
+	once   *sync.Once
+}
+
+func newPipe() (*pipeEnd, *pipeEnd) {
+	a, b := make(chan []byte, 16), make(chan []byte, 16)
+	closed, once := make(chan struct{}), &sync.Once{}
+	return &pipeEnd{r: a, w: b, closed: closed, once: once}, &pipeEnd{r: b, w: a, closed: closed, once: once}
+}
+
+func (p *pipeEnd) Read(b []byte) (int, error) {
+	select {
+	case r := <-p.r:
+		return copy(b, r), nil
+	case <-p.closed:
+		return 0, io.EOF
+	}
+}
+
+func (p *pipeEnd) Write(b []byte) (int, error) {
+	select {
+	case p.w <- append([]byte(nil), b...):
+		return len(b), nil
+	case <-p.closed:
+		return 0, io.ErrClosedPipe
+	}
+}
+
+func (p *pipeEnd) Close() error {
+	p.once.Do(func() { close(p.closed) })
+	return nil
+}
@@ -0,0 +1,242 @@
+package gatt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// A Manager runs several Devices in one process, one per adapter, e.g.
+// the 3 or 4 dongles of a gateway, each an independent stack, under a
+// name of its own. It scans with them all at once, and spreads the
+// connections it initiates, as the central, across them.
+type Manager struct {
+	mu      sync.Mutex
+	devices map[string]*managed
+}
+
+// managed is a Device of a Manager, and its load.
+type managed struct {
+	name       string
+	d          Device
+	conns      int  // established, of either role
+	connecting bool // a Connect of the Manager is running
+	quit       chan struct{}
+}
+
+// NewManager returns a Manager of no device.
+func NewManager() *Manager {
+	return &Manager{devices: make(map[string]*managed)}
+}
+
+// Open creates a Device, initializes it with opts, e.g. with the ID of
+// its adapter, and adds it under name.
+func (m *Manager) Open(ctx context.Context, name string, opts DeviceOptions) (Device, error) {
+	d := NewDevice()
+	if err := d.Init(ctx, opts); err != nil {
+		return nil, fmt.Errorf("gatt: device %s: %w", name, err)
+	}
+	if err := m.Add(name, d); err != nil {
+		d.Stop(ctx)
+		return nil, err
+	}
+	return d, nil
+}
+
+// Add adds the Device d, initialized, under name, which must not be that
+// of another device of the Manager.
+func (m *Manager) Add(name string, d Device) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, found := m.devices[name]; found {
+		return fmt.Errorf("gatt: device %s added already", name)
+	}
+	md := &managed{name: name, d: d, quit: make(chan struct{})}
+	m.devices[name] = md
+	c := make(chan ConnEvent, 16)
+	d.SubscribeConns(c, BlockSend)
+	go m.count(md, c)
+	return nil
+}
+
+// count counts the connections of md, until it is removed.
+func (m *Manager) count(md *managed, c chan ConnEvent) {
+	for {
+		select {
+		case e := <-c:
+			m.mu.Lock()
+			if e.Connected {
+				md.conns++
+			} else if md.conns > 0 {
+				md.conns--
+			}
+			m.mu.Unlock()
+		case <-md.quit:
+			return
+		}
+	}
+}
+
+// Device returns the device added under name, if any.
+func (m *Manager) Device(name string) (Device, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	md, found := m.devices[name]
+	if !found {
+		return nil, false
+	}
+	return md.d, true
+}
+
+// Names returns the names of the devices, sorted.
+func (m *Manager) Names() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make([]string, 0, len(m.devices))
+	for name := range m.devices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Remove stops the device added under name, and removes it.
+func (m *Manager) Remove(ctx context.Context, name string) error {
+	m.mu.Lock()
+	md, found := m.devices[name]
+	delete(m.devices, name)
+	m.mu.Unlock()
+	if !found {
+		return fmt.Errorf("gatt: no device %s", name)
+	}
+	close(md.quit)
+	return md.d.Stop(ctx)
+}
+
+// Stop stops all the devices, and removes them. It returns the first
+// error they failed to stop with, if any.
+func (m *Manager) Stop(ctx context.Context) error {
+	var err error
+	for _, name := range m.Names() {
+		if e := m.Remove(ctx, name); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// Scan scans with all the devices, calling f with each advertisement,
+// and the name of the device that received it, until ctx is done. The
+// calls of f are serialized. It returns ctx.Err(), or the first error a
+// device failed to scan with, which stops the others.
+func (m *Manager) Scan(ctx context.Context, opts ScanOptions, f func(name string, a *Advertisement)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		fmu   sync.Mutex
+		errmu sync.Mutex
+		err   error
+		wg    sync.WaitGroup
+	)
+	for _, md := range m.snapshot() {
+		wg.Add(1)
+		go func(md *managed) {
+			defer wg.Done()
+			e := md.d.Scan(ctx, opts, func(a *Advertisement) {
+				fmu.Lock()
+				defer fmu.Unlock()
+				f(md.name, a)
+			})
+			if e != nil && !errors.Is(e, context.Canceled) && !errors.Is(e, context.DeadlineExceeded) {
+				errmu.Lock()
+				if err == nil {
+					err = fmt.Errorf("gatt: device %s: %w", md.name, e)
+				}
+				errmu.Unlock()
+				cancel()
+			}
+		}(md)
+	}
+	wg.Wait()
+	if err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// Connect connects, as the central, to the peripheral of address addr,
+// as Device.Connect does, with the device least loaded: one not
+// initiating a connection already, if any, with the fewest connections.
+// Should it fail, but for ctx being done, the next device least loaded
+// is tried, and so on. It returns the connection, and the name of the
+// device it was established with, or the error the last device failed
+// with.
+func (m *Manager) Connect(ctx context.Context, addr Addr, opts ConnectOptions) (Conn, string, error) {
+	tried := make(map[string]bool)
+	err := errors.New("gatt: no device to connect with")
+	for {
+		md := m.leastLoaded(tried)
+		if md == nil {
+			return nil, "", err
+		}
+		tried[md.name] = true
+		var c Conn
+		c, err = md.d.Connect(ctx, addr, opts)
+		m.mu.Lock()
+		md.connecting = false
+		m.mu.Unlock()
+		if err == nil {
+			return c, md.name, nil
+		}
+		err = fmt.Errorf("gatt: device %s: %w", md.name, err)
+		if ctx.Err() != nil {
+			return nil, "", err
+		}
+	}
+}
+
+// leastLoaded returns the device least loaded, but those tried, marked as
+// connecting, or nil if none is left.
+func (m *Manager) leastLoaded(tried map[string]bool) *managed {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var best *managed
+	for name, md := range m.devices {
+		if tried[name] {
+			continue
+		}
+		if best == nil || lessLoaded(md, best) {
+			best = md
+		}
+	}
+	if best != nil {
+		best.connecting = true
+	}
+	return best
+}
+
+// lessLoaded reports whether a is less loaded than b, ties broken by name, for
+// the choice to be deterministic.
+func lessLoaded(a, b *managed) bool {
+	if a.connecting != b.connecting {
+		return !a.connecting
+	}
+	if a.conns != b.conns {
+		return a.conns < b.conns
+	}
+	return a.name < b.name
+}
+
+// snapshot returns the devices, sorted by name.
+func (m *Manager) snapshot() []*managed {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mds := make([]*managed, 0, len(m.devices))
+	for _, md := range m.devices {
+		mds = append(mds, md)
+	}
+	sort.Slice(mds, func(i, j int) bool { return mds[i].name < mds[j].name })
+	return mds
+}
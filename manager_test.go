@@ -0,0 +1,156 @@
+package gatt
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDevice is a Device scanning advs, and connecting, or failing with
+// err, with the connections reported on the channel subscribed.
+type fakeDevice struct {
+	advs []*Advertisement
+	err  error
+
+	mu       sync.Mutex
+	c        chan ConnEvent
+	connects int
+	stopped  bool
+}
+
+type fakeConn struct{ Conn }
+
+func (d *fakeDevice) Init(ctx context.Context, opts DeviceOptions) error { return nil }
+func (d *fakeDevice) AddService(svc *Service) error                      { return nil }
+func (d *fakeDevice) Advertise(ctx context.Context, opts AdvertiseOptions) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (d *fakeDevice) Scan(ctx context.Context, opts ScanOptions, f func(a *Advertisement)) error {
+	for _, a := range d.advs {
+		f(a)
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (d *fakeDevice) Connect(ctx context.Context, addr Addr, opts ConnectOptions) (Conn, error) {
+	d.mu.Lock()
+	d.connects++
+	c := d.c
+	d.mu.Unlock()
+	if d.err != nil {
+		return nil, d.err
+	}
+	cn := fakeConn{}
+	c <- ConnEvent{Conn: cn, Connected: true}
+	return cn, nil
+}
+
+func (d *fakeDevice) SubscribeConns(c chan ConnEvent, p SubscriptionPolicy) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.c = c
+}
+
+func (d *fakeDevice) SubscribePairings(c chan PairingEvent, p SubscriptionPolicy) {}
+
+func (d *fakeDevice) Stop(ctx context.Context) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.stopped = true
+	return nil
+}
+
+func TestManagerScan(t *testing.T) {
+	addr := func(b byte) Addr { return PublicAddr(BDAddr{net.HardwareAddr{1, 2, 3, 4, 5, b}}) }
+	m := NewManager()
+	m.Add("hci0", &fakeDevice{advs: []*Advertisement{{Addr: addr(1)}, {Addr: addr(2)}}})
+	m.Add("hci1", &fakeDevice{advs: []*Advertisement{{Addr: addr(3)}}})
+	if err := m.Add("hci1", &fakeDevice{}); err == nil {
+		t.Error("Add of a name added already succeeded")
+	}
+	if got, want := m.Names(), []string{"hci0", "hci1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Names() = %v, want %v", got, want)
+	}
+
+	var got []string
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := m.Scan(ctx, ScanOptions{}, func(name string, a *Advertisement) {
+		got = append(got, name+" "+a.Addr.String())
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Scan() = %v, want %v", err, context.DeadlineExceeded)
+	}
+	sort.Strings(got)
+	want := []string{
+		"hci0 " + addr(1).String(),
+		"hci0 " + addr(2).String(),
+		"hci1 " + addr(3).String(),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("advertisements = %v, want %v", got, want)
+	}
+}
+
+func TestManagerConnect(t *testing.T) {
+	ctx := context.Background()
+	d0, d1, d2 := &fakeDevice{}, &fakeDevice{}, &fakeDevice{err: errors.New("busy")}
+	m := NewManager()
+	m.Add("hci0", d0)
+	m.Add("hci1", d1)
+	m.Add("hci2", d2)
+
+	// hci2 fails each time, so the connections alternate between the
+	// others, once counted.
+	var names []string
+	for i := 0; i < 4; i++ {
+		_, name, err := m.Connect(ctx, Addr{}, ConnectOptions{})
+		if err != nil {
+			t.Fatalf("Connect() = %v", err)
+		}
+		names = append(names, name)
+		waitFor(t, func() bool {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			return m.devices[name].conns == (i/2)+1
+		})
+	}
+	if want := []string{"hci0", "hci1", "hci0", "hci1"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("devices = %v, want %v", names, want)
+	}
+	if d2.connects != 2 {
+		t.Errorf("hci2 tried %d times, want 2", d2.connects)
+	}
+
+	m.Remove(ctx, "hci0")
+	m.Remove(ctx, "hci1")
+	if _, _, err := m.Connect(ctx, Addr{}, ConnectOptions{}); err == nil || err.Error() != "gatt: device hci2: busy" {
+		t.Errorf("Connect() = %v, want the error of hci2", err)
+	}
+	m.Stop(ctx)
+	if !d0.stopped || !d1.stopped || !d2.stopped {
+		t.Error("devices not stopped")
+	}
+	if _, found := m.Device("hci2"); found {
+		t.Error("device found once stopped")
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		if cond() {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("condition not met")
+}
@@ -0,0 +1,21 @@
+// Package mesh implements the Bluetooth Mesh provisioning bearers
+// (PB-ADV and PB-GATT) and the proxy protocol over GATT.
+//
+// This package provides the bearer layer only: segmentation and
+// reassembly of provisioning and proxy PDUs, and the GATT services
+// that carry them. The provisioning protocol itself (key exchange,
+// authentication, distribution of provisioning data) and the mesh
+// network layer are left to the caller.
+//
+// To act as a proxy gateway, register the proxy service with a server:
+//
+//	srv := gatt.NewServer(gatt.Name("mesh-proxy"))
+//	p := mesh.AddProxyService(srv, mesh.HandlerFunc(
+//		func(c gatt.Conn, typ mesh.PDUType, pdu []byte) {
+//			// forward network PDUs to the advertising bearer
+//		}))
+//	go srv.AdvertiseAndServe()
+//	// later: p.Send(c, mesh.NetworkPDU, pdu)
+//
+// This package is work in progress. We expect the APIs to change.
+package mesh
@@ -0,0 +1,45 @@
+package mesh
+
+import "testing"
+
+// FuzzMesh feeds the PDUs received over the bearers to their parsers:
+// each as a PB-ADV AD structure, reassembled into a provisioning
+// transaction, and as a proxy PDU, reassembled into a message. Each input
+// is a sequence of PDUs, each preceded by its length.
+func FuzzMesh(f *testing.F) {
+	pdu := make([]byte, 100)
+	for i := range pdu {
+		pdu[i] = byte(i)
+	}
+	ads, _ := SegmentTransaction(0x01020304, 0x80, pdu)
+	for _, pdus := range [][][]byte{
+		ads,
+		{ads[1], ads[0], ads[1], ads[2]}, // out of order, retransmitted
+		{LinkOpen(0x01020304, [16]byte{}), LinkAck(0x01020304), TransactionAck(0x01020304, 0x80)},
+		Segment(ProvisioningPDU, pdu, 20),
+		{{0x07, typePBADV, 0, 0, 0, 1, 0, 0x03}}, // the shortest PDU
+		{{}, {0x00, typePBADV}},
+	} {
+		var b []byte
+		for _, p := range pdus {
+			b = append(append(b, byte(len(p))), p...)
+		}
+		f.Add(b)
+	}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		var tr Transaction
+		var r Reassembler
+		for len(b) > 0 {
+			n := int(b[0])
+			if b = b[1:]; n > len(b) {
+				n = len(b)
+			}
+			p := b[:n]
+			if ad, err := ParsePBADV(p); err == nil {
+				tr.Push(ad)
+			}
+			r.Push(p)
+			b = b[n:]
+		}
+	})
+}
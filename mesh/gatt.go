@@ -0,0 +1,175 @@
+package mesh
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/paypal/gatt"
+)
+
+// Mesh GATT services and characteristics.
+var (
+	ProvisioningServiceUUID = gatt.UUID16(0x1827)
+	ProxyServiceUUID        = gatt.UUID16(0x1828)
+
+	provisioningDataInUUID  = gatt.UUID16(0x2ADB)
+	provisioningDataOutUUID = gatt.UUID16(0x2ADC)
+	proxyDataInUUID         = gatt.UUID16(0x2ADD)
+	proxyDataOutUUID        = gatt.UUID16(0x2ADE)
+)
+
+// A Handler handles complete PDUs received over a GATT bearer.
+type Handler interface {
+	HandlePDU(c gatt.Conn, typ PDUType, pdu []byte)
+}
+
+// HandlerFunc is an adapter to allow the use of
+// ordinary functions as Handlers.
+type HandlerFunc func(c gatt.Conn, typ PDUType, pdu []byte)
+
+// HandlePDU calls f(c, typ, pdu).
+func (f HandlerFunc) HandlePDU(c gatt.Conn, typ PDUType, pdu []byte) {
+	f(c, typ, pdu)
+}
+
+// ErrNotSubscribed is returned by Bearer.Send if the proxy client
+// has not enabled notifications on the Data Out characteristic.
+var ErrNotSubscribed = errors.New("mesh: client is not subscribed to data out")
+
+// A Bearer is a GATT bearer: either the Mesh Provisioning Service
+// (PB-GATT) or the Mesh Proxy Service.
+type Bearer struct {
+	svc     *gatt.Service
+	h       Handler
+	allowed func(PDUType) bool
+
+	mu    sync.Mutex
+	conns map[gatt.Conn]*bearerConn
+}
+
+type bearerConn struct {
+	r Reassembler
+	n gatt.Notifier
+}
+
+// AddProvisioningService adds the Mesh Provisioning Service to srv.
+// Provisioning PDUs written by the provisioner are passed to h.
+// AddProvisioningService must be called before srv is started.
+func AddProvisioningService(srv *gatt.Server, h Handler) *Bearer {
+	return addBearer(srv, ProvisioningServiceUUID, provisioningDataInUUID, provisioningDataOutUUID, h,
+		func(t PDUType) bool { return t == ProvisioningPDU })
+}
+
+// AddProxyService adds the Mesh Proxy Service to srv.
+// Network PDUs, mesh beacons and proxy configuration messages
+// written by the proxy client are passed to h.
+// AddProxyService must be called before srv is started.
+func AddProxyService(srv *gatt.Server, h Handler) *Bearer {
+	return addBearer(srv, ProxyServiceUUID, proxyDataInUUID, proxyDataOutUUID, h,
+		func(t PDUType) bool { return t != ProvisioningPDU })
+}
+
+func addBearer(srv *gatt.Server, svcu, inu, outu gatt.UUID, h Handler, allowed func(PDUType) bool) *Bearer {
+	b := &Bearer{
+		svc:     srv.AddService(svcu),
+		h:       h,
+		allowed: allowed,
+		conns:   make(map[gatt.Conn]*bearerConn),
+	}
+	b.svc.AddCharacteristic(inu).HandleWriteFunc(b.serveWrite)
+	b.svc.AddCharacteristic(outu).HandleNotifyFunc(b.serveNotify)
+	return b
+}
+
+// Service returns the underlying GATT service.
+func (b *Bearer) Service() *gatt.Service { return b.svc }
+
+// Send sends pdu to the client connected on c, segmenting
+// it as required by the client's notification capacity.
+func (b *Bearer) Send(c gatt.Conn, typ PDUType, pdu []byte) error {
+	var n gatt.Notifier
+	b.mu.Lock()
+	if bc, ok := b.conns[c]; ok {
+		n = bc.n
+	}
+	b.mu.Unlock()
+	if n == nil {
+		return ErrNotSubscribed
+	}
+	if n.Done() {
+		b.Forget(c)
+		return ErrNotSubscribed
+	}
+	for _, seg := range Segment(typ, pdu, n.Cap()) {
+		if _, err := n.Write(seg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Forget discards any state kept for c. It should be
+// called when the client disconnects.
+func (b *Bearer) Forget(c gatt.Conn) {
+	b.mu.Lock()
+	delete(b.conns, c)
+	b.mu.Unlock()
+}
+
+func (b *Bearer) conn(c gatt.Conn) *bearerConn {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	bc, ok := b.conns[c]
+	if !ok {
+		bc = &bearerConn{}
+		b.conns[c] = bc
+	}
+	return bc
+}
+
+func (b *Bearer) serveWrite(r gatt.Request, data []byte) byte {
+	bc := b.conn(r.Conn)
+	typ, pdu, done, err := bc.r.Push(data)
+	if err != nil {
+		// The mesh profile requires the bearer to be closed;
+		// leave that decision to the handler's owner and just
+		// drop the message.
+		return gatt.StatusUnexpectedError
+	}
+	if done && b.allowed(typ) && b.h != nil {
+		b.h.HandlePDU(r.Conn, typ, pdu)
+	}
+	return gatt.StatusSuccess
+}
+
+func (b *Bearer) serveNotify(r gatt.Request, n gatt.Notifier) {
+	bc := b.conn(r.Conn)
+	b.mu.Lock()
+	bc.n = n
+	b.mu.Unlock()
+}
+
+// ProvisioningAdvertisingPacket returns advertising data for an
+// unprovisioned device offering PB-GATT: the Mesh Provisioning
+// Service UUID and its service data (device UUID and OOB information).
+func ProvisioningAdvertisingPacket(dev [16]byte, oob uint16) []byte {
+	data := append(dev[:], byte(oob>>8), byte(oob))
+	return serviceAdvertisingPacket(0x1827, data)
+}
+
+// ProxyAdvertisingPacket returns advertising data for a proxy
+// node advertising with its network ID.
+func ProxyAdvertisingPacket(networkID [8]byte) []byte {
+	data := append([]byte{0x00}, networkID[:]...) // identification type: network ID
+	return serviceAdvertisingPacket(0x1828, data)
+}
+
+func serviceAdvertisingPacket(u uint16, data []byte) []byte {
+	lo, hi := byte(u), byte(u>>8)
+	b := []byte{
+		0x02, 0x01, 0x06, // flags: general discoverable, LE only
+		0x03, 0x03, lo, hi, // complete list of 16-bit service UUIDs
+		byte(len(data) + 3), 0x16, lo, hi, // service data, 16-bit UUID
+	}
+	return append(b, data...)
+}
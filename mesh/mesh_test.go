@@ -0,0 +1,101 @@
+package mesh
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFCS(t *testing.T) {
+	// SABM frame on DLCI 0, from 3GPP TS 27.010.
+	if got := fcs([]byte{0x03, 0x3F, 0x01}); got != 0x1C {
+		t.Errorf("fcs: got %#02x want 0x1c", got)
+	}
+}
+
+func TestProxySegmentReassemble(t *testing.T) {
+	msg := make([]byte, 50)
+	for i := range msg {
+		msg[i] = byte(i)
+	}
+	for _, size := range []int{2, 20, 51, 52, 100} {
+		var r Reassembler
+		segs := Segment(NetworkPDU, msg, size)
+		for i, seg := range segs {
+			if len(seg) > size {
+				t.Errorf("size %d: segment %d has length %d", size, i, len(seg))
+			}
+			typ, got, done, err := r.Push(seg)
+			if err != nil {
+				t.Fatalf("size %d: Push(%x): %v", size, seg, err)
+			}
+			if done != (i == len(segs)-1) {
+				t.Fatalf("size %d: segment %d: done %t", size, i, done)
+			}
+			if done && (typ != NetworkPDU || !bytes.Equal(got, msg)) {
+				t.Errorf("size %d: got %v %x want %v %x", size, typ, got, NetworkPDU, msg)
+			}
+		}
+	}
+}
+
+func TestProxyUnexpectedSegment(t *testing.T) {
+	var r Reassembler
+	if _, _, _, err := r.Push([]byte{sarLast<<6 | byte(NetworkPDU), 1}); err == nil {
+		t.Errorf("last segment without first: expected error")
+	}
+	r.Push([]byte{sarFirst<<6 | byte(NetworkPDU), 1})
+	if _, _, _, err := r.Push([]byte{sarLast<<6 | byte(MeshBeacon), 2}); err == nil {
+		t.Errorf("segment with mismatched type: expected error")
+	}
+}
+
+func TestTransactionSegmentReassemble(t *testing.T) {
+	for _, n := range []int{1, maxStartData, maxStartData + 1, 65} {
+		pdu := bytes.Repeat([]byte{0xA5}, n)
+		ads, err := SegmentTransaction(0x01020304, 7, pdu)
+		if err != nil {
+			t.Fatalf("SegmentTransaction(%d bytes): %v", n, err)
+		}
+		var tr Transaction
+		// Deliver in reverse order, with a retransmission, to exercise reassembly.
+		ads = append(ads, ads[0])
+		for i := len(ads) - 1; i >= 0; i-- {
+			if len(ads[i]) > 31 {
+				t.Errorf("%d bytes: AD structure %d too long: %d", n, i, len(ads[i]))
+			}
+			p, err := ParsePBADV(ads[i])
+			if err != nil {
+				t.Fatalf("ParsePBADV(%x): %v", ads[i], err)
+			}
+			if p.LinkID != 0x01020304 || p.Transaction != 7 {
+				t.Errorf("ParsePBADV(%x): link %x tn %d", ads[i], p.LinkID, p.Transaction)
+			}
+			got, done, err := tr.Push(p)
+			if err != nil {
+				t.Fatalf("%d bytes: Push: %v", n, err)
+			}
+			if done {
+				if !bytes.Equal(got, pdu) {
+					t.Errorf("%d bytes: got %x want %x", n, got, pdu)
+				}
+				break
+			}
+		}
+	}
+}
+
+func TestParsePBADVShort(t *testing.T) {
+	for _, ad := range [][]byte{
+		{},
+		{0x00, typePBADV, 0, 0, 0, 0, 0, 0},
+		{0x06, typePBADV, 0, 0, 0, 0, 0},
+		{0x07, typePBADV, 0, 0, 0, 0, 0},
+	} {
+		if _, err := ParsePBADV(ad); err != errShortPBADV {
+			t.Errorf("ParsePBADV(%x): got %v want %v", ad, err, errShortPBADV)
+		}
+	}
+	if _, err := ParsePBADV([]byte{0x07, typePBADV, 0, 0, 0, 1, 0, 0x03}); err != nil {
+		t.Errorf("ParsePBADV of the shortest PDU: %v", err)
+	}
+}
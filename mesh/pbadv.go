@@ -0,0 +1,243 @@
+package mesh
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Advertising data types used by the mesh advertising bearer.
+const (
+	typePBADV       = 0x29
+	typeMeshMessage = 0x2A
+	typeMeshBeacon  = 0x2B
+)
+
+// Generic provisioning control format (GPCF) values.
+const (
+	gpcfTransactionStart        = 0x00
+	gpcfTransactionAck          = 0x01
+	gpcfTransactionContinuation = 0x02
+	gpcfBearerControl           = 0x03
+)
+
+// Bearer control opcodes.
+const (
+	bearerLinkOpen  = 0x00
+	bearerLinkAck   = 0x01
+	bearerLinkClose = 0x02
+)
+
+// Link close reasons.
+const (
+	LinkCloseSuccess = 0x00
+	LinkCloseTimeout = 0x01
+	LinkCloseFail    = 0x02
+)
+
+// A PB-ADV PDU is carried in a single AD structure of at most 31 bytes:
+// length (1), AD type (1), link ID (4), transaction number (1), and a
+// generic provisioning PDU of up to 24 bytes.
+const (
+	maxGenericPDU       = 24
+	maxStartData        = maxGenericPDU - 4 // SegN|GPCF, TotalLength, FCS
+	maxContinuationData = maxGenericPDU - 1 // SegIndex|GPCF
+	maxSegments         = 64
+)
+
+var (
+	errShortPBADV      = errors.New("mesh: short PB-ADV PDU")
+	errNotPBADV        = errors.New("mesh: not a PB-ADV AD structure")
+	errTooLong         = errors.New("mesh: provisioning PDU too long")
+	errBadFCS          = errors.New("mesh: provisioning PDU FCS mismatch")
+	errUnexpectedSeg   = errors.New("mesh: unexpected transaction segment")
+	errWrongSegmentLen = errors.New("mesh: segment length does not match total length")
+)
+
+// A PBADV is a decoded PB-ADV PDU.
+type PBADV struct {
+	LinkID      uint32
+	Transaction uint8
+	GPCF        uint8
+	Header      uint8  // upper 6 bits of the first octet: SegN, SegIndex, or the bearer opcode
+	Payload     []byte // remainder of the generic provisioning PDU
+}
+
+// ParsePBADV decodes a PB-ADV AD structure, including its length and type octets.
+func ParsePBADV(ad []byte) (PBADV, error) {
+	if len(ad) < 2 || int(ad[0])+1 > len(ad) {
+		return PBADV{}, errShortPBADV
+	}
+	if ad[1] != typePBADV {
+		return PBADV{}, errNotPBADV
+	}
+	// Type, Link ID, Transaction Number, and the first octet of the
+	// generic provisioning PDU.
+	if ad[0] < 1+4+1+1 {
+		return PBADV{}, errShortPBADV
+	}
+	b := ad[2 : ad[0]+1]
+	return PBADV{
+		LinkID:      binary.BigEndian.Uint32(b),
+		Transaction: b[4],
+		GPCF:        b[5] & 0x03,
+		Header:      b[5] >> 2,
+		Payload:     b[6:],
+	}, nil
+}
+
+func pbadv(link uint32, tn uint8, gp []byte) []byte {
+	b := make([]byte, 2+4+1, 2+4+1+len(gp))
+	b[0] = byte(len(b) - 1 + len(gp))
+	b[1] = typePBADV
+	binary.BigEndian.PutUint32(b[2:], link)
+	b[6] = tn
+	return append(b, gp...)
+}
+
+// LinkOpen returns the PB-ADV Link Open message a provisioner
+// sends to the unprovisioned device dev.
+func LinkOpen(link uint32, dev [16]byte) []byte {
+	return pbadv(link, 0, append([]byte{bearerLinkOpen<<2 | gpcfBearerControl}, dev[:]...))
+}
+
+// LinkAck returns the PB-ADV Link Ack message.
+func LinkAck(link uint32) []byte {
+	return pbadv(link, 0, []byte{bearerLinkAck<<2 | gpcfBearerControl})
+}
+
+// LinkClose returns the PB-ADV Link Close message. See the LinkClose* constants.
+func LinkClose(link uint32, reason uint8) []byte {
+	return pbadv(link, 0, []byte{bearerLinkClose<<2 | gpcfBearerControl, reason})
+}
+
+// TransactionAck returns the PB-ADV Transaction Acknowledgment message.
+func TransactionAck(link uint32, tn uint8) []byte {
+	return pbadv(link, tn, []byte{gpcfTransactionAck})
+}
+
+// SegmentTransaction splits the provisioning PDU pdu into
+// PB-ADV AD structures, one per advertisement.
+func SegmentTransaction(link uint32, tn uint8, pdu []byte) ([][]byte, error) {
+	segn := 0
+	if len(pdu) > maxStartData {
+		segn = (len(pdu) - maxStartData + maxContinuationData - 1) / maxContinuationData
+	}
+	if segn >= maxSegments {
+		return nil, errTooLong
+	}
+	n := len(pdu)
+	if n > maxStartData {
+		n = maxStartData
+	}
+	start := []byte{byte(segn)<<2 | gpcfTransactionStart, byte(len(pdu) >> 8), byte(len(pdu)), fcs(pdu)}
+	ads := [][]byte{pbadv(link, tn, append(start, pdu[:n]...))}
+	rest := pdu[n:]
+	for i := 1; len(rest) > 0; i++ {
+		n := len(rest)
+		if n > maxContinuationData {
+			n = maxContinuationData
+		}
+		ads = append(ads, pbadv(link, tn, append([]byte{byte(i)<<2 | gpcfTransactionContinuation}, rest[:n]...)))
+		rest = rest[n:]
+	}
+	return ads, nil
+}
+
+// A Transaction reassembles a segmented provisioning PDU
+// received over PB-ADV. The zero value is ready to use.
+type Transaction struct {
+	tn    uint8
+	total int
+	fcs   byte
+	segs  [][]byte
+	got   int
+}
+
+// Push adds a transaction start or continuation PDU.
+// When all segments have been received and the FCS checks,
+// Push returns the provisioning PDU and done set to true.
+// Retransmitted segments are ignored.
+func (t *Transaction) Push(p PBADV) (pdu []byte, done bool, err error) {
+	switch p.GPCF {
+	case gpcfTransactionStart:
+		if len(p.Payload) < 3 {
+			return nil, false, errShortPBADV
+		}
+		if t.segs != nil && t.tn == p.Transaction {
+			if t.segs[0] != nil {
+				return nil, false, nil // retransmission
+			}
+		} else {
+			t.tn = p.Transaction
+			t.segs = make([][]byte, int(p.Header)+1)
+			t.got = 0
+		}
+		t.total = int(binary.BigEndian.Uint16(p.Payload))
+		t.fcs = p.Payload[2]
+		t.segs[0] = append([]byte(nil), p.Payload[3:]...)
+		t.got++
+	case gpcfTransactionContinuation:
+		i := int(p.Header)
+		if t.segs == nil || t.tn != p.Transaction || i == 0 || i >= len(t.segs) {
+			return nil, false, errUnexpectedSeg
+		}
+		if t.segs[i] != nil {
+			return nil, false, nil // retransmission
+		}
+		t.segs[i] = append([]byte(nil), p.Payload...)
+		t.got++
+	default:
+		return nil, false, fmt.Errorf("mesh: not a transaction segment: GPCF %d", p.GPCF)
+	}
+	if t.got < len(t.segs) || t.segs[0] == nil {
+		return nil, false, nil
+	}
+	for _, s := range t.segs {
+		pdu = append(pdu, s...)
+	}
+	t.segs = nil
+	if len(pdu) != t.total {
+		return nil, false, errWrongSegmentLen
+	}
+	if fcs(pdu) != t.fcs {
+		return nil, false, errBadFCS
+	}
+	return pdu, true, nil
+}
+
+// fcsTable is the CRC table for the 3GPP TS 27.010 frame check
+// sequence (reversed polynomial 0xE0) used by PB-ADV.
+var fcsTable = func() (t [256]byte) {
+	for i := range t {
+		c := byte(i)
+		for j := 0; j < 8; j++ {
+			if c&1 != 0 {
+				c = c>>1 ^ 0xE0
+			} else {
+				c >>= 1
+			}
+		}
+		t[i] = c
+	}
+	return t
+}()
+
+func fcs(b []byte) byte {
+	f := byte(0xFF)
+	for _, c := range b {
+		f = fcsTable[f^c]
+	}
+	return 0xFF - f
+}
+
+// MessageAD wraps a mesh network PDU in a Mesh Message AD structure
+// for transmission over the advertising bearer.
+func MessageAD(pdu []byte) []byte {
+	return append([]byte{byte(len(pdu) + 1), typeMeshMessage}, pdu...)
+}
+
+// BeaconAD wraps a mesh beacon in a Mesh Beacon AD structure.
+func BeaconAD(beacon []byte) []byte {
+	return append([]byte{byte(len(beacon) + 1), typeMeshBeacon}, beacon...)
+}
@@ -0,0 +1,132 @@
+package mesh
+
+import (
+	"errors"
+	"time"
+)
+
+// A PDUType is the message type carried in a proxy PDU.
+type PDUType uint8
+
+// Proxy PDU message types.
+const (
+	NetworkPDU         PDUType = 0x00
+	MeshBeacon         PDUType = 0x01
+	ProxyConfiguration PDUType = 0x02
+	ProvisioningPDU    PDUType = 0x03
+)
+
+func (t PDUType) String() string {
+	switch t {
+	case NetworkPDU:
+		return "Network PDU"
+	case MeshBeacon:
+		return "Mesh Beacon"
+	case ProxyConfiguration:
+		return "Proxy Configuration"
+	case ProvisioningPDU:
+		return "Provisioning PDU"
+	}
+	return "RFU"
+}
+
+// Segmentation and reassembly (SAR) field values.
+const (
+	sarComplete     = 0x00
+	sarFirst        = 0x01
+	sarContinuation = 0x02
+	sarLast         = 0x03
+)
+
+// sarTimeout is the time allowed between the first and the last
+// segment of a proxy PDU, as mandated by the mesh profile.
+const sarTimeout = 20 * time.Second
+
+var (
+	errEmptyPDU      = errors.New("mesh: empty proxy PDU")
+	errUnexpectedSAR = errors.New("mesh: unexpected proxy PDU segment")
+	errSARTimeout    = errors.New("mesh: proxy PDU reassembly timed out")
+)
+
+// Segment splits msg into proxy PDUs of at most size bytes each,
+// including the one byte proxy PDU header. size is typically the
+// capacity of the Notifier or the ATT MTU minus 3.
+// Segment panics if size is less than 2.
+func Segment(typ PDUType, msg []byte, size int) [][]byte {
+	if size < 2 {
+		panic("mesh: proxy PDU size too small")
+	}
+	hdr := func(sar byte) byte { return sar<<6 | byte(typ)&0x3f }
+	max := size - 1
+	if len(msg) <= max {
+		return [][]byte{append([]byte{hdr(sarComplete)}, msg...)}
+	}
+	var segs [][]byte
+	for sar := byte(sarFirst); len(msg) > 0; sar = sarContinuation {
+		n := max
+		if len(msg) <= max {
+			n = len(msg)
+			sar = sarLast
+		}
+		segs = append(segs, append([]byte{hdr(sar)}, msg[:n]...))
+		msg = msg[n:]
+	}
+	return segs
+}
+
+// A Reassembler reassembles segmented proxy PDUs. The zero value
+// is ready to use. A Reassembler is not safe for concurrent use.
+type Reassembler struct {
+	typ     PDUType
+	buf     []byte
+	started time.Time
+	busy    bool
+}
+
+// Push adds a proxy PDU. When a complete message has been received,
+// Push returns it with done set to true. Push returns an error, and
+// discards any partially reassembled message, if segments arrive out
+// of order or the SAR timeout expires.
+func (r *Reassembler) Push(b []byte) (typ PDUType, msg []byte, done bool, err error) {
+	if len(b) == 0 {
+		r.reset()
+		return 0, nil, false, errEmptyPDU
+	}
+	sar, typ, data := b[0]>>6, PDUType(b[0]&0x3f), b[1:]
+	if r.busy && time.Since(r.started) > sarTimeout {
+		r.reset()
+		return 0, nil, false, errSARTimeout
+	}
+	switch sar {
+	case sarComplete:
+		if r.busy {
+			r.reset()
+			return 0, nil, false, errUnexpectedSAR
+		}
+		return typ, append([]byte(nil), data...), true, nil
+	case sarFirst:
+		if r.busy {
+			r.reset()
+			return 0, nil, false, errUnexpectedSAR
+		}
+		r.typ, r.busy, r.started = typ, true, time.Now()
+		r.buf = append(r.buf[:0], data...)
+		return 0, nil, false, nil
+	}
+	if !r.busy || typ != r.typ {
+		r.reset()
+		return 0, nil, false, errUnexpectedSAR
+	}
+	r.buf = append(r.buf, data...)
+	if sar == sarContinuation {
+		return 0, nil, false, nil
+	}
+	msg = append([]byte(nil), r.buf...)
+	r.reset()
+	return typ, msg, true, nil
+}
+
+func (r *Reassembler) reset() {
+	r.buf = r.buf[:0]
+	r.busy = false
+}
@@ -1,18 +1,90 @@
 package gatt
 
 import (
+	"context"
 	"errors"
+	"runtime/pprof"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// AlignNotifications sets whether the notifications, and indications,
+// sent to a peripheral that skips connection events, as its slave latency
+// lets it, are held until just ahead of the next event it wakes up for,
+// rather than handed to the controller as they are written: those written
+// in the meantime then go out together, in the same event, and the
+// peripheral wakes up no more often than it wants to. The events are
+// reckoned from the connection parameters, and from the data last
+// received from the peripheral, which it sent awake. Writes of the
+// NotifyBlock policy block for as long as the notification is held, up
+// to the interval times the latency plus one. It is off by default, and
+// has no effect as the peripheral.
+// See also Server.NewServer and Server.Option.
+func AlignNotifications(on bool) option {
+	return func(s *Server) option {
+		prev := s.alignNotify
+		s.alignNotify = on
+		return AlignNotifications(prev)
+	}
+}
+
+// wakeDelay returns how long to hold a notification sent at now, for it
+// to reach the controller half an interval ahead of the next event the
+// peripheral wakes up for, if the connection is aligned with it.
+func (c *conn) wakeDelay(now time.Time) time.Duration {
+	if !c.central || !c.server.alignNotify {
+		return 0
+	}
+	p := c.Params()
+	if p.Latency == 0 || p.IntervalMax == 0 {
+		return 0
+	}
+	period := time.Duration(p.Latency+1) * p.IntervalMax
+	anchor := time.Unix(0, atomic.LoadInt64(&c.activity.rx)).Add(-p.IntervalMax / 2)
+	since := now.Sub(anchor) % period
+	if since < 0 {
+		since += period
+	}
+	return (period - since) % period
+}
+
+// awaitWake holds a notification for wakeDelay, and reports whether the
+// connection is still open.
+func (c *conn) awaitWake() bool {
+	d := c.wakeDelay(time.Now())
+	if d == 0 {
+		return true
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-c.done:
+		return false
+	}
+}
+
 type notifier struct {
 	conn   *conn
 	char   *Characteristic
 	maxlen int
 	donemu sync.RWMutex
 	done   bool
+
+	// Used by the NotifyLatest and NotifyQueue policies only.
+	pendingmu sync.Mutex
+	pending   [][]byte // values not sent yet, oldest first
+	spare     [][]byte // buffers of the values sent, to be reused
+	sending   bool     // a goroutine is draining pending
+	err       error    // error of the last send, reported by the next Write
 }
 
+// notifyQueueLen is the number of values a notifier of the NotifyQueue
+// policy holds, while its link is busy.
+const notifyQueueLen = 32
+
 func newNotifier(c *conn, cc *Characteristic, maxlen int) *notifier {
 	return &notifier{conn: c, char: cc, maxlen: maxlen}
 }
@@ -21,9 +93,68 @@ func (n *notifier) Write(data []byte) (int, error) {
 	if n.Done() {
 		return 0, errors.New("central stopped notifications")
 	}
+	switch n.char.npolicy {
+	case NotifyLatest:
+		return n.writeQueued(data, 1)
+	case NotifyQueue:
+		return n.writeQueued(data, notifyQueueLen)
+	}
 	return n.conn.sendNotification(n.char, data)
 }
 
+// writeQueued queues data, to be sent after the values not sent yet,
+// dropping the oldest of them if max are, and makes sure a goroutine is
+// sending them.
+func (n *notifier) writeQueued(data []byte, max int) (int, error) {
+	n.pendingmu.Lock()
+	defer n.pendingmu.Unlock()
+	if err := n.err; err != nil {
+		n.err = nil
+		return 0, err
+	}
+	if len(n.pending) == max {
+		n.spare = append(n.spare, n.pending[0][:0])
+		n.pending = n.pending[:copy(n.pending, n.pending[1:])]
+	}
+	var b []byte
+	if k := len(n.spare); k > 0 {
+		b, n.spare = n.spare[k-1], n.spare[:k-1]
+	}
+	n.pending = append(n.pending, append(b, data...))
+	if !n.sending {
+		n.sending = true
+		go n.drain()
+	}
+	return len(data), nil
+}
+
+func (n *notifier) drain() {
+	pprof.SetGoroutineLabels(pprof.WithLabels(context.Background(), pprof.Labels("gatt", "notify", "peer", n.conn.remoteAddr.String())))
+	var b []byte
+	for {
+		n.pendingmu.Lock()
+		if b != nil {
+			// Reuse the buffer of the value sent last, so that Write
+			// keeps storing values without allocating.
+			n.spare = append(n.spare, b[:0])
+		}
+		if len(n.pending) == 0 || n.Done() {
+			n.sending = false
+			n.pendingmu.Unlock()
+			return
+		}
+		b = n.pending[0]
+		n.pending = n.pending[:copy(n.pending, n.pending[1:])]
+		n.pendingmu.Unlock()
+
+		if _, err := n.conn.sendNotification(n.char, b); err != nil {
+			n.pendingmu.Lock()
+			n.err = err
+			n.pendingmu.Unlock()
+		}
+	}
+}
+
 func (n *notifier) Cap() int {
 	return n.maxlen
 }
@@ -0,0 +1,128 @@
+package gatt
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestNotifyLatest(t *testing.T) {
+	h := &testHandler{readc: make(chan []byte), writec: make(chan []byte)}
+	c := newConn(NewServer(Name("")), h, Addr{})
+	char := &Characteristic{valuen: 0x0d}
+	char.SetNotifyPolicy(NotifyLatest)
+	n := newNotifier(c, char, int(c.mtu)-3)
+
+	n.Write([]byte("1"))
+	// Wait until "1" is being sent, and the link is busy.
+	for {
+		n.pendingmu.Lock()
+		taken := len(n.pending) == 0
+		n.pendingmu.Unlock()
+		if taken {
+			break
+		}
+		runtime.Gosched()
+	}
+	for _, s := range []string{"2", "3", "4"} {
+		if _, err := n.Write([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, want := range []string{"1", "4"} {
+		b := <-h.writec
+		if got := string(b[3:]); got != want {
+			t.Errorf("notified %q, want %q", got, want)
+		}
+	}
+	select {
+	case b := <-h.writec:
+		t.Errorf("unexpected notification % X", b)
+	default:
+	}
+}
+
+func TestNotifyQueue(t *testing.T) {
+	srv := NewServer(Name(""))
+	char := &Characteristic{valuen: 0x0d}
+	char.SetNotifyPolicy(NotifyQueue)
+	slow := &testHandler{readc: make(chan []byte), writec: make(chan []byte)}
+	fast := &testHandler{readc: make(chan []byte), writec: make(chan []byte)}
+	var ns []*notifier
+	for _, h := range []*testHandler{slow, fast} {
+		c := newConn(srv, h, Addr{})
+		ns = append(ns, newNotifier(c, char, int(c.mtu)-3))
+	}
+
+	// The slow central reads none of its notifications, yet the fast
+	// one gets all of them, in order.
+	for i := 0; i < 20; i++ {
+		for _, n := range ns {
+			if _, err := n.Write([]byte{byte(i)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	for i := 0; i < 20; i++ {
+		if b := <-fast.writec; b[3] != byte(i) {
+			t.Fatalf("fast central notified %d, want %d", b[3], i)
+		}
+	}
+
+	// Wait until 0 is being sent to the slow central, then overflow its
+	// queue: the oldest values are dropped.
+	for {
+		ns[0].pendingmu.Lock()
+		taken := len(ns[0].pending) == 19
+		ns[0].pendingmu.Unlock()
+		if taken {
+			break
+		}
+		runtime.Gosched()
+	}
+	for i := 20; i < 50; i++ {
+		ns[0].Write([]byte{byte(i)})
+	}
+	want := []byte{0}
+	for i := 50 - notifyQueueLen; i < 50; i++ {
+		want = append(want, byte(i))
+	}
+	for _, w := range want {
+		if b := <-slow.writec; b[3] != w {
+			t.Fatalf("slow central notified %d, want %d", b[3], w)
+		}
+	}
+}
+
+func TestWakeDelay(t *testing.T) {
+	c := newConn(NewServer(Name(""), AlignNotifications(true)), discardConn{}, Addr{})
+	c.central = true
+	params := ConnParams{IntervalMin: 50 * time.Millisecond, IntervalMax: 50 * time.Millisecond, Latency: 3}
+	c.params = func() ConnParams { return params }
+	rx := time.Unix(100, 0)
+	c.activity.rx = rx.UnixNano()
+
+	// The peripheral wakes up every 200ms from rx: notifications are
+	// held until 25ms ahead of those events.
+	for _, tt := range []struct{ at, want time.Duration }{
+		{0, 175 * time.Millisecond},
+		{100 * time.Millisecond, 75 * time.Millisecond},
+		{175 * time.Millisecond, 0},
+		{180 * time.Millisecond, 195 * time.Millisecond},
+		{1000 * time.Millisecond, 175 * time.Millisecond},
+	} {
+		if got := c.wakeDelay(rx.Add(tt.at)); got != tt.want {
+			t.Errorf("%v after the data received: held for %v, want %v", tt.at, got, tt.want)
+		}
+	}
+
+	params.Latency = 0
+	if got := c.wakeDelay(rx); got != 0 {
+		t.Errorf("without latency: held for %v", got)
+	}
+	params.Latency, c.central = 3, false
+	if got := c.wakeDelay(rx); got != 0 {
+		t.Errorf("as the peripheral: held for %v", got)
+	}
+}
@@ -0,0 +1,34 @@
+package gatt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Pair pairs with the peer of c, of which the device is the central, by
+// LE Secure Connections, as Just Works, and encrypts the link: the keys
+// are safe from eavesdroppers, though not from a man in the middle, the
+// device having no IO capabilities to guard against one. It returns the
+// bond of the peer, under its identity address, if it distributed one,
+// its address otherwise, and puts it in the KeyStore of the device, if
+// any. Peers without LE Secure Connections, whose legacy pairing is not
+// supported, fail with a linux.SMPReason, as do the pairings the peer
+// fails. The outcome is delivered to the subscriptions of
+// SubscribePairings too. The HCI devices of Linux only pair.
+func Pair(ctx context.Context, c Conn) (Bond, error) {
+	cc, ok := c.(*conn)
+	if !ok || cc.pair == nil {
+		return Bond{}, errors.New("gatt: pairing not supported on this platform")
+	}
+	b, err := cc.pair(ctx)
+	if err != nil {
+		b, err = Bond{}, fmt.Errorf("gatt: pairing with %s: %w", cc.remoteAddr, err)
+	} else if ks := cc.server.keyStore; ks != nil {
+		if perr := ks.Put(b); perr != nil {
+			err = fmt.Errorf("gatt: keeping the bond of %s: %w", b.Addr, perr)
+		}
+	}
+	cc.server.publishPairing(PairingEvent{Conn: c, Bond: b, Err: err})
+	return b, err
+}
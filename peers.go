@@ -0,0 +1,324 @@
+package gatt
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// defaultRSSIHistory is the number of RSSI samples a Peer keeps, by
+// default.
+const defaultRSSIHistory = 32
+
+// An RSSISample is the RSSI a peer was received with, in dBm, and when.
+type RSSISample struct {
+	Time time.Time
+	RSSI int
+}
+
+// A Peer is a remote device, as observed by a PeerRegistry, scanning and
+// connecting, under one identity across the rotations of its resolvable
+// private address. Its methods may be called concurrently.
+//
+// A peer seen under resolvable private addresses before it bonded is
+// observed as several peers, until it is observed bonded, e.g. as it
+// connects: those are then merged into one, which the methods of each
+// report from then on.
+type Peer struct {
+	r *PeerRegistry
+
+	// Guarded by r.mu.
+	merged   *Peer // into which the peer was merged, if any
+	addr     Addr
+	addrs    []Addr
+	bonded   bool
+	lastSeen time.Time
+	rssi     []RSSISample
+	adv      *Advertisement
+	conn     Conn
+}
+
+// live returns the peer p was merged into, if any, or p. r.mu is held.
+func (p *Peer) live() *Peer {
+	for p.merged != nil {
+		p = p.merged
+	}
+	return p
+}
+
+// Addr returns the identity address of the peer, if bonded, or the
+// address it was first observed with otherwise.
+func (p *Peer) Addr() Addr {
+	p.r.mu.Lock()
+	defer p.r.mu.Unlock()
+	return p.live().addr
+}
+
+// Addrs returns the addresses the peer was observed with.
+func (p *Peer) Addrs() []Addr {
+	p.r.mu.Lock()
+	defer p.r.mu.Unlock()
+	return append([]Addr(nil), p.live().addrs...)
+}
+
+// Bonded reports whether the peer is bonded, as per the KeyStore of the
+// registry.
+func (p *Peer) Bonded() bool {
+	p.r.mu.Lock()
+	defer p.r.mu.Unlock()
+	return p.live().bonded
+}
+
+// LastSeen returns when the peer was last observed, advertising or
+// connecting.
+func (p *Peer) LastSeen() time.Time {
+	p.r.mu.Lock()
+	defer p.r.mu.Unlock()
+	return p.live().lastSeen
+}
+
+// RSSI returns the last RSSI samples of the advertisements of the peer,
+// oldest first.
+func (p *Peer) RSSI() []RSSISample {
+	p.r.mu.Lock()
+	defer p.r.mu.Unlock()
+	return append([]RSSISample(nil), p.live().rssi...)
+}
+
+// Advertisement returns the last advertisement of the peer, or nil if it
+// was only observed connecting.
+func (p *Peer) Advertisement() *Advertisement {
+	p.r.mu.Lock()
+	defer p.r.mu.Unlock()
+	return p.live().adv
+}
+
+// Conn returns the connection of the peer, or nil if it is not
+// connected.
+func (p *Peer) Conn() Conn {
+	p.r.mu.Lock()
+	defer p.r.mu.Unlock()
+	return p.live().conn
+}
+
+// addAddr records that p was observed with a, unless it was already.
+func (p *Peer) addAddr(a Addr) {
+	for _, b := range p.addrs {
+		if b.same(a) {
+			return
+		}
+	}
+	p.addrs = append(p.addrs, a)
+}
+
+// A PeerRegistry tracks the peers observed while scanning, as set by the
+// Peers field of ScanOptions, and connecting, as set by TrackPeers, each
+// as one Peer, rather than by their addresses, which change as the
+// resolvable private ones rotate: those of the bonded peers are resolved
+// with the IRKs of the bonds of its KeyStore. It is safe for concurrent
+// use.
+type PeerRegistry struct {
+	mu      sync.Mutex
+	ks      KeyStore
+	history int
+	byAddr  map[string]*Peer
+	peers   []*Peer // in the order they were first observed
+}
+
+// NewPeerRegistry returns a PeerRegistry resolving the addresses of the
+// peers with the bonds of ks, if not nil, keeping the last history RSSI
+// samples of each peer, or 32 if zero.
+func NewPeerRegistry(ks KeyStore, history int) *PeerRegistry {
+	if history < 1 {
+		history = defaultRSSIHistory
+	}
+	return &PeerRegistry{ks: ks, history: history, byAddr: map[string]*Peer{}}
+}
+
+// Peers returns the peers observed so far, in the order they were first
+// observed.
+func (r *PeerRegistry) Peers() []*Peer {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*Peer(nil), r.peers...)
+}
+
+// Lookup returns the peer observed with the address a, or, for the
+// identity address of a bonded peer, resolved to it, or nil if none was.
+func (r *PeerRegistry) Lookup(a Addr) *Peer {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if p, found := r.byAddr[peerKey(a)]; found {
+		return p.live()
+	}
+	return nil
+}
+
+// peerKey returns the key of the peers of address a, telling the public
+// addresses from the random ones, as Addr.same does.
+func peerKey(a Addr) string {
+	k := "p"
+	if a.Type.Random() {
+		k = "r"
+	}
+	return k + string(a.HardwareAddr)
+}
+
+// observe records the advertisement a, received at t.
+func (r *PeerRegistry) observe(a *Advertisement, t time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, err := r.resolve(a.Addr, false)
+	p.lastSeen, p.adv = t, a
+	p.rssi = append(p.rssi, RSSISample{Time: t, RSSI: a.RSSI})
+	if n := len(p.rssi) - r.history; n > 0 {
+		p.rssi = append(p.rssi[:0], p.rssi[n:]...)
+	}
+	return err
+}
+
+// connected records that c connected, or, if not, disconnected, at t.
+// The bond of the peer is looked up again, as it may have bonded since
+// it was last observed.
+func (r *PeerRegistry) connected(c Conn, on bool, t time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, err := r.resolve(c.RemoteAddr(), on)
+	p.lastSeen = t
+	switch {
+	case on:
+		p.conn = c
+	case p.conn == c:
+		p.conn = nil
+	}
+	return err
+}
+
+// resolve returns the peer of address a, observed for the first time if
+// it was not before. The bond of the peer is looked up on its first
+// observation, or again if recheck is set and it was not bonded; once
+// found, the peer is merged into that of the identity address of the
+// bond. r.mu is held.
+func (r *PeerRegistry) resolve(a Addr, recheck bool) (*Peer, error) {
+	k := peerKey(a)
+	p, seen := r.byAddr[k]
+	if seen {
+		p = p.live()
+		if p.bonded || !recheck {
+			return p, nil
+		}
+	}
+	var b Bond
+	var found bool
+	var err error
+	if r.ks != nil {
+		b, found, err = bondOf(r.ks, a)
+	}
+	if !found {
+		if !seen {
+			p = r.add(a)
+			p.addrs = []Addr{a}
+			r.byAddr[k] = p
+		}
+		if err != nil {
+			err = fmt.Errorf("gatt: looking up the bond of %s: %w", a, err)
+		}
+		return p, err
+	}
+	id := peerKey(b.Addr)
+	q, known := r.byAddr[id]
+	if known {
+		q = q.live()
+	} else {
+		q = r.add(b.Addr)
+		r.byAddr[id] = q
+	}
+	q.bonded = true
+	if seen && p != q {
+		r.merge(q, p)
+	}
+	// The other peers observed under the private addresses of the bond
+	// are merged too, rather than once each connects.
+	if b.IRK != ([16]byte{}) {
+		for _, o := range append([]*Peer(nil), r.peers...) {
+			if o != q && !o.bonded && resolvesAny(b.IRK, o.addrs) {
+				r.merge(q, o)
+			}
+		}
+	}
+	q.addAddr(a)
+	r.byAddr[k] = q
+	return q, nil
+}
+
+// resolvesAny reports whether any of addrs is a resolvable private address
+// of irk.
+func resolvesAny(irk [16]byte, addrs []Addr) bool {
+	for _, a := range addrs {
+		if a.Type == AddrResolvablePrivate && resolves(irk, a.BDAddr) {
+			return true
+		}
+	}
+	return false
+}
+
+// add adds a new peer, of address a. r.mu is held.
+func (r *PeerRegistry) add(a Addr) *Peer {
+	p := &Peer{r: r, addr: a}
+	r.peers = append(r.peers, p)
+	return p
+}
+
+// merge merges the observations of from into p, which from forwards to
+// from then on. r.mu is held.
+func (r *PeerRegistry) merge(p, from *Peer) {
+	for _, a := range from.addrs {
+		p.addAddr(a)
+	}
+	p.rssi = append(p.rssi, from.rssi...)
+	sort.SliceStable(p.rssi, func(i, j int) bool { return p.rssi[i].Time.Before(p.rssi[j].Time) })
+	if n := len(p.rssi) - r.history; n > 0 {
+		p.rssi = append(p.rssi[:0], p.rssi[n:]...)
+	}
+	if from.lastSeen.After(p.lastSeen) {
+		p.lastSeen = from.lastSeen
+		if from.adv != nil {
+			p.adv = from.adv
+		}
+	}
+	if p.conn == nil {
+		p.conn = from.conn
+	}
+	from.merged = p
+	for i, q := range r.peers {
+		if q == from {
+			r.peers = append(r.peers[:i], r.peers[i+1:]...)
+			break
+		}
+	}
+}
+
+// TrackPeers sets the PeerRegistry the connections are recorded in, as
+// they connect and disconnect, the bond of each peer looked up again as
+// it connects.
+// See also Server.NewServer.
+// TrackPeers cannot be used with Server.Option.
+func TrackPeers(r *PeerRegistry) option {
+	return func(s *Server) option {
+		prev := s.peers
+		s.peers = r
+		return TrackPeers(prev)
+	}
+}
+
+// trackPeer records that c connected, or, if not, disconnected, in the
+// PeerRegistry of s, if any.
+func (s *Server) trackPeer(c Conn, on bool) {
+	if s.peers == nil {
+		return
+	}
+	if err := s.peers.connected(c, on, time.Now()); err != nil {
+		s.report(err)
+	}
+}
@@ -0,0 +1,85 @@
+package gatt
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPeerRegistry(t *testing.T) {
+	irk := [16]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	rpa1 := RandomAddr(resolvablePrivateAddr(irk, [3]byte{0x01, 0x02, 0x43}))
+	rpa2 := RandomAddr(resolvablePrivateAddr(irk, [3]byte{0x04, 0x05, 0x46}))
+	id := PublicAddr(BDAddr{net.HardwareAddr{0x11, 0x22, 0x33, 0x44, 0x55, 0x66}})
+	other := RandomAddr(BDAddr{net.HardwareAddr{0x01, 0x02, 0x03, 0x04, 0x05, 0xC6}})
+	t0 := time.Unix(1700000000, 0)
+	at := func(i int) time.Time { return t0.Add(time.Duration(i) * time.Second) }
+
+	// Unbonded, the addresses are those of as many peers.
+	ks := NewFileKeyStore(filepath.Join(t.TempDir(), "bonds.json"), nil)
+	r := NewPeerRegistry(ks, 2)
+	for i, a := range []Addr{rpa1, rpa2, other} {
+		if err := r.observe(&Advertisement{Addr: a, RSSI: -40 - i}, at(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(r.Peers()); n != 3 {
+		t.Fatalf("%d peers observed unbonded, want 3", n)
+	}
+	early := r.Lookup(rpa1)
+
+	// Once bonded, the addresses resolve to the identity, as the peer
+	// connects, and the peers observed before are merged.
+	if err := ks.Put(Bond{Addr: id, IRK: irk}); err != nil {
+		t.Fatal(err)
+	}
+	c := &conn{remoteAddr: rpa2}
+	if err := r.connected(c, true, at(3)); err != nil {
+		t.Fatal(err)
+	}
+	p := r.Lookup(rpa2)
+	if !p.Bonded() || !p.Addr().same(id) || p.Conn() != Conn(c) {
+		t.Errorf("peer connected: bonded %t, Addr %s, Conn %v; want bonded, %s, connected", p.Bonded(), p.Addr(), p.Conn(), id)
+	}
+	if err := r.observe(&Advertisement{Addr: rpa1, RSSI: -50}, at(4)); err != nil {
+		t.Fatal(err)
+	}
+	if r.Lookup(rpa1) != p || r.Lookup(id) != p {
+		t.Error("addresses of the bonded peer not merged into one peer")
+	}
+	if !early.Addr().same(p.Addr()) || !early.Bonded() {
+		t.Error("peer observed before the bond does not report the merged one")
+	}
+	if n := len(r.Peers()); n != 2 {
+		t.Errorf("%d peers once merged, want 2", n)
+	}
+	if got, want := p.RSSI(), []RSSISample{{at(1), -41}, {at(4), -50}}; len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("RSSI = %v, want the last 2 samples, %v", got, want)
+	}
+	if p.LastSeen() != at(4) || p.Advertisement().RSSI != -50 || len(p.Addrs()) != 2 {
+		t.Errorf("LastSeen %v, RSSI of the advertisement %d, Addrs %v", p.LastSeen(), p.Advertisement().RSSI, p.Addrs())
+	}
+	if err := r.connected(c, false, at(5)); err != nil {
+		t.Fatal(err)
+	}
+	if p.Conn() != nil {
+		t.Error("peer still connected once disconnected")
+	}
+}
+
+func TestTrackPeers(t *testing.T) {
+	r := NewPeerRegistry(nil, 0)
+	a := PublicAddr(BDAddr{net.HardwareAddr{0x11, 0x22, 0x33, 0x44, 0x55, 0x66}})
+	connected := make(chan Conn, 1)
+	s := NewServer(Name(""), TrackPeers(r), Connect(func(c Conn) { connected <- c }))
+	cl, err := s.Loopback(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := <-connected
+	if p := r.Lookup(a); p == nil || p.Conn() != c {
+		t.Errorf("peer of the connection = %v, want it tracked, connected", p)
+	}
+	cl.Conn().Close()
+}
@@ -0,0 +1,45 @@
+package gatt
+
+import (
+	"errors"
+	"fmt"
+)
+
+// A PHY is a physical layer of LE a connection transmits, or receives,
+// on. Those but PHY1M come with Bluetooth 5.0, and may not be supported
+// by either end.
+type PHY int
+
+const (
+	PHY1M    PHY = 1 // 1 Msym/s, of all the controllers
+	PHY2M    PHY = 2 // 2 Msym/s, for throughput
+	PHYCoded PHY = 3 // 1 Msym/s, coded, for range
+)
+
+func (p PHY) String() string {
+	switch p {
+	case PHY1M:
+		return "1M"
+	case PHY2M:
+		return "2M"
+	case PHYCoded:
+		return "Coded"
+	}
+	return fmt.Sprintf("PHY(%d)", int(p))
+}
+
+var errPHYs = errors.New("gatt: PHYs not managed on this platform")
+
+// PHYUpdate sets a function called as the PHYs a connection transmits,
+// tx, and receives, rx, on change, as requested by Conn.SetPHY, or by the
+// peer. The updates failed are reported to the HandlerErrors function.
+// f is called from the goroutine reading the HCI: it must not block.
+// See also Server.NewServer.
+// PHYUpdate cannot be used with Server.Option.
+func PHYUpdate(f func(c Conn, tx, rx PHY)) option {
+	return func(s *Server) option {
+		prev := s.phyUpdate
+		s.phyUpdate = f
+		return PHYUpdate(prev)
+	}
+}
@@ -0,0 +1,157 @@
+package provision
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"github.com/paypal/gatt"
+)
+
+// ErrNoService is returned by NewClient when the accessory does not serve
+// the provisioning service.
+var ErrNoService = errors.New("provision: service not served by the accessory")
+
+// clientMTU is the ATT MTU a Client asks for: the longest credentials
+// take a write of 121 bytes.
+const clientMTU = 185
+
+// A Client is the configuring side of the provisioning: the client of the
+// provisioning service of an accessory, over a session encrypted with it.
+type Client struct {
+	cl                      *gatt.Client
+	session, config, status *gatt.RemoteCharacteristic
+	s                       *session
+}
+
+// NewClient discovers the provisioning service of the accessory connected
+// to on c, and establishes a session with it, of the secret that secret
+// returns for c.
+func NewClient(ctx context.Context, c gatt.Conn, secret Secret) (*Client, error) {
+	cl, err := gatt.NewClient(c)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := cl.ExchangeMTU(ctx, clientMTU); err != nil {
+		return nil, err
+	}
+	svcs, err := cl.DiscoverServices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p := &Client{cl: cl}
+	for _, s := range svcs {
+		if !s.UUID.Equal(ServiceUUID) {
+			continue
+		}
+		for _, ch := range s.Characteristics {
+			switch {
+			case ch.UUID.Equal(sessionUUID):
+				p.session = ch
+			case ch.UUID.Equal(configUUID):
+				p.config = ch
+			case ch.UUID.Equal(statusUUID):
+				p.status = ch
+			}
+		}
+	}
+	if p.session == nil || p.config == nil || p.status == nil {
+		return nil, ErrNoService
+	}
+	k, err := secret(c)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	if err := cl.Write(ctx, p.session.ValueHandle, nonce, false); err != nil {
+		return nil, fmt.Errorf("provision: starting the session: %w", err)
+	}
+	theirs, err := cl.Read(ctx, p.session.ValueHandle)
+	if err != nil {
+		return nil, fmt.Errorf("provision: starting the session: %w", err)
+	}
+	if len(theirs) != nonceSize {
+		return nil, errors.New("provision: malformed nonce of the accessory")
+	}
+	if p.s, err = newSession(k, nonce, theirs); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Status reads the state of the provisioning of the accessory, and, if
+// Failed, why.
+func (p *Client) Status(ctx context.Context) (State, Reason, error) {
+	v, err := p.cl.Read(ctx, p.status.ValueHandle)
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(v) != 2 {
+		return 0, 0, errors.New("provision: malformed status")
+	}
+	return State(v[0]), Reason(v[1]), nil
+}
+
+// SendCredentials hands cr to the accessory, without having it apply
+// them.
+func (p *Client) SendCredentials(ctx context.Context, cr Credentials) error {
+	if err := cr.check(); err != nil {
+		return err
+	}
+	return p.send(ctx, append([]byte{opCredentials}, marshalCredentials(cr)...))
+}
+
+// Apply has the accessory join the network of the credentials last
+// sent. It returns as soon as the accessory starts connecting.
+func (p *Client) Apply(ctx context.Context) error {
+	return p.send(ctx, []byte{opApply})
+}
+
+func (p *Client) send(ctx context.Context, m []byte) error {
+	return p.cl.Write(ctx, p.config.ValueHandle, p.s.seal(m), false)
+}
+
+// Provision hands cr to the accessory, has it apply them, and waits for it
+// to join the network, returning the Reason it failed with otherwise.
+func (p *Client) Provision(ctx context.Context, cr Credentials) error {
+	states := make(chan []byte, 8)
+	err := p.cl.Subscribe(ctx, p.status, func(v []byte) {
+		select {
+		case states <- append([]byte(nil), v...):
+		default:
+			// Dropped; the state is read again as the others arrive.
+		}
+	})
+	if err != nil {
+		return err
+	}
+	defer p.cl.Unsubscribe(context.Background(), p.status)
+	if err := p.SendCredentials(ctx, cr); err != nil {
+		return err
+	}
+	if err := p.Apply(ctx); err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-states:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		// The notifications only hint at the state, read as they
+		// arrive, for none to be missed.
+		s, r, err := p.Status(ctx)
+		switch {
+		case err != nil:
+			return err
+		case s == Connected:
+			return nil
+		case s == Failed:
+			return r
+		}
+	}
+}
@@ -0,0 +1,33 @@
+// Package provision implements the handover of the credentials of a Wi-Fi
+// network to an accessory, over BLE: the provisioning service the
+// accessory serves, and the client of the phone, or the gateway, that
+// configures it.
+//
+// The credentials are exchanged encrypted, under a key of the session,
+// derived from a secret the two ends share, e.g. the long term key of the
+// pairing, mixed with a nonce of each end. The accessory reports its
+// progress, from receiving the credentials to joining the network, as the
+// state of the service, read or notified.
+//
+// The accessory serves the service of a Provisioner, and joins the
+// network with the credentials it is handed:
+//
+//	p, err := provision.NewProvisioner(provision.ApplierFunc(
+//		func(ctx context.Context, cr provision.Credentials) error {
+//			// join cr.SSID; return once connected, or failed
+//		}), provision.Options{Secret: provision.BondSecret(ks)})
+//	d := gatt.NewDevice()
+//	d.Init(ctx, gatt.DeviceOptions{KeyStore: ks, Disconnect: p.Disconnected})
+//	for _, svc := range p.Services() {
+//		d.AddService(svc)
+//	}
+//
+// The phone pairs with the accessory, connects to it, and hands it the
+// credentials, waiting for it to join the network:
+//
+//	c, err := d.Connect(ctx, accessory, gatt.ConnectOptions{})
+//	cl, err := provision.NewClient(ctx, c, provision.BondSecret(ks))
+//	err = cl.Provision(ctx, provision.Credentials{SSID: "home", Passphrase: "secret"})
+//
+// This package is work in progress. We expect the APIs to change.
+package provision
@@ -0,0 +1,109 @@
+package provision
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/paypal/gatt"
+)
+
+func loopback(t *testing.T, p *Provisioner) gatt.Conn {
+	cl, err := gatt.NewServer().Loopback(gatt.PublicAddr(gatt.BDAddr{HardwareAddr: []byte{1, 2, 3, 4, 5, 6}}), p.Services()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cl.Conn().Close() })
+	return cl.Conn()
+}
+
+func TestProvision(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	joined := make(chan Credentials, 2)
+	p, err := NewProvisioner(ApplierFunc(func(ctx context.Context, cr Credentials) error {
+		joined <- cr
+		if cr.Passphrase != "secret" {
+			return ReasonAuthFailed
+		}
+		return nil
+	}), Options{Secret: StaticSecret([]byte("1234"))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewClient(ctx, loopback(t, p), StaticSecret([]byte("1234")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, _, err := c.Status(ctx); err != nil || s != Idle {
+		t.Fatalf("Status = %v, %v; want idle", s, err)
+	}
+	if err := c.Apply(ctx); !isStatus(err, statusInvalidState) {
+		t.Errorf("Apply without credentials = %v, want invalid state", err)
+	}
+
+	err = c.Provision(ctx, Credentials{SSID: "home", Passphrase: "wrong"})
+	if !errors.Is(err, ReasonAuthFailed) {
+		t.Errorf("Provision with a wrong passphrase = %v, want ReasonAuthFailed", err)
+	}
+	if err := c.Provision(ctx, Credentials{SSID: "home", Passphrase: "secret"}); err != nil {
+		t.Fatal(err)
+	}
+	if cr := <-joined; cr.SSID != "home" {
+		t.Errorf("applied %+v, want the home network", cr)
+	}
+	if s, r := p.State(); s != Connected || r != ReasonNone {
+		t.Errorf("State = %v, %v; want connected", s, r)
+	}
+
+	// A message replayed is refused.
+	m := c.s.seal([]byte{opApply})
+	c.s.seq--
+	if err := c.cl.Write(ctx, c.config.ValueHandle, m, false); !isStatus(err, statusInvalidState) {
+		t.Errorf("apply once connected = %v, want invalid state", err)
+	}
+	if err := c.cl.Write(ctx, c.config.ValueHandle, m, false); !isStatus(err, statusBadMessage) {
+		t.Errorf("apply replayed = %v, want bad message", err)
+	}
+}
+
+func TestProvisionWrongSecret(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	p, err := NewProvisioner(ApplierFunc(func(ctx context.Context, cr Credentials) error {
+		t.Error("credentials of a wrong secret applied")
+		return nil
+	}), Options{Secret: StaticSecret([]byte("1234"))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewClient(ctx, loopback(t, p), StaticSecret([]byte("4321")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SendCredentials(ctx, Credentials{SSID: "home"}); !isStatus(err, statusBadMessage) {
+		t.Errorf("SendCredentials = %v, want bad message", err)
+	}
+	if s, _ := p.State(); s != Idle {
+		t.Errorf("State = %v, want idle", s)
+	}
+}
+
+func TestParseCredentials(t *testing.T) {
+	cr := Credentials{SSID: "home", Passphrase: "secret"}
+	b := marshalCredentials(cr)
+	if got, ok := parseCredentials(append(b, 0x7F, 1, 0)); !ok || got != cr {
+		t.Errorf("parseCredentials = %+v, %v; want %+v", got, ok, cr)
+	}
+	for _, b := range [][]byte{b[:len(b)-1], {fieldPassphrase, 0}, {fieldSSID}} {
+		if _, ok := parseCredentials(b); ok {
+			t.Errorf("parseCredentials(% X) succeeded", b)
+		}
+	}
+}
+
+func isStatus(err error, status byte) bool {
+	var e *gatt.ATTError
+	return errors.As(err, &e) && e.Status == status
+}
@@ -0,0 +1,367 @@
+package provision
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/paypal/gatt"
+)
+
+// Service and characteristics of the provisioning service.
+var (
+	ServiceUUID = gatt.MustParseUUID("8d4c0001-5c3b-4f5e-9a47-6b2f3c1d0e80")
+
+	sessionUUID = gatt.MustParseUUID("8d4c0002-5c3b-4f5e-9a47-6b2f3c1d0e80")
+	configUUID  = gatt.MustParseUUID("8d4c0003-5c3b-4f5e-9a47-6b2f3c1d0e80")
+	statusUUID  = gatt.MustParseUUID("8d4c0004-5c3b-4f5e-9a47-6b2f3c1d0e80")
+)
+
+// A State is a state of the provisioning of the accessory.
+type State byte
+
+// States of the provisioning: Idle, until the credentials are received,
+// then Connecting, as they are applied, until Connected, or Failed. New
+// credentials may be received in any state but Connecting.
+const (
+	Idle                State = 0x00
+	CredentialsReceived State = 0x01
+	Connecting          State = 0x02
+	Connected           State = 0x03
+	Failed              State = 0x04
+)
+
+func (s State) String() string {
+	switch s {
+	case Idle:
+		return "idle"
+	case CredentialsReceived:
+		return "credentials received"
+	case Connecting:
+		return "connecting"
+	case Connected:
+		return "connected"
+	case Failed:
+		return "failed"
+	}
+	return fmt.Sprintf("state 0x%02X", byte(s))
+}
+
+// A Reason is why the accessory failed to join the network. An Applier
+// returns one, or an error wrapping one, to report it to the client;
+// other errors are reported as ReasonOther.
+type Reason byte
+
+// Reasons of the failures.
+const (
+	ReasonNone            Reason = 0x00
+	ReasonOther           Reason = 0x01
+	ReasonAuthFailed      Reason = 0x02 // e.g. a wrong passphrase
+	ReasonNetworkNotFound Reason = 0x03
+	ReasonTimeout         Reason = 0x04
+)
+
+func (r Reason) Error() string {
+	switch r {
+	case ReasonNone:
+		return "provision: no failure"
+	case ReasonOther:
+		return "provision: failed to join the network"
+	case ReasonAuthFailed:
+		return "provision: failed to authenticate with the network"
+	case ReasonNetworkNotFound:
+		return "provision: network not found"
+	case ReasonTimeout:
+		return "provision: timed out joining the network"
+	}
+	return fmt.Sprintf("provision: failure 0x%02X", byte(r))
+}
+
+// Credentials are those of the Wi-Fi network handed to the accessory.
+type Credentials struct {
+	SSID       string // of 1 to 32 bytes
+	Passphrase string // of up to 64 bytes; empty for an open network
+}
+
+func (cr Credentials) check() error {
+	if len(cr.SSID) < 1 || len(cr.SSID) > 32 {
+		return fmt.Errorf("provision: %w", gatt.ErrInvalidParameter{Param: "SSID length", Value: len(cr.SSID), Min: 1, Max: 32})
+	}
+	if len(cr.Passphrase) > 64 {
+		return fmt.Errorf("provision: %w", gatt.ErrInvalidParameter{Param: "Passphrase length", Value: len(cr.Passphrase), Min: 0, Max: 64})
+	}
+	return nil
+}
+
+// An Applier joins the network of the credentials, e.g. by configuring
+// wpa_supplicant, returning once it is connected, or has failed.
+type Applier interface {
+	Apply(ctx context.Context, cr Credentials) error
+}
+
+// ApplierFunc is an adapter to allow the use of
+// ordinary functions as Appliers.
+type ApplierFunc func(ctx context.Context, cr Credentials) error
+
+// Apply calls f(ctx, cr).
+func (f ApplierFunc) Apply(ctx context.Context, cr Credentials) error {
+	return f(ctx, cr)
+}
+
+// Options configure a Provisioner.
+type Options struct {
+	// Secret returns the secret shared with each client, e.g.
+	// BondSecret; it must be set.
+	Secret Secret
+
+	// Timeout bounds the time the Applier is given to join the
+	// network, failing it with ReasonTimeout. It defaults to 30s.
+	Timeout time.Duration
+}
+
+const defaultTimeout = 30 * time.Second
+
+// Operations of the messages written to the configuration
+// characteristic, their first byte, and the fields of the credentials,
+// type, length and value, which follow opCredentials.
+const (
+	opCredentials = 0x01
+	opApply       = 0x02
+
+	fieldSSID       = 0x01
+	fieldPassphrase = 0x02
+)
+
+// Statuses of the writes to the service.
+const (
+	statusInsufficientAuthn = 0x05 // Insufficient Authentication
+	statusInvalidLength     = 0x0D // Invalid Attribute Value Length
+	statusInvalidState      = 0x80 // application error: not in a state to take the write
+	statusBadMessage        = 0x81 // application error: not authenticated, or malformed
+)
+
+// A Provisioner is the accessory side of the provisioning: the service
+// taking the credentials of a network from the clients, over sessions
+// encrypted per connection, and joining it with its Applier.
+//
+// A client writes its nonce to the session characteristic, and reads
+// that of the accessory back, the key of the session derived from both
+// and their Secret. It then writes the credentials to the configuration
+// characteristic, and has them applied, each message encrypted, following
+// the state of the accessory, which the status characteristic reads, and
+// notifies, as its State and Reason, one byte each.
+type Provisioner struct {
+	a    Applier
+	opts Options
+	svcs []*gatt.Service
+
+	mu        sync.Mutex
+	sessions  map[gatt.Conn]*session
+	notifiers []gatt.Notifier
+	state     State
+	reason    Reason
+	cr        Credentials // as last received
+}
+
+// NewProvisioner declares the provisioning service of an accessory
+// joining the networks it is handed with a.
+func NewProvisioner(a Applier, opts Options) (*Provisioner, error) {
+	if opts.Secret == nil {
+		return nil, errors.New("provision: no Secret set")
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+	p := &Provisioner{a: a, opts: opts, sessions: make(map[gatt.Conn]*session)}
+	svc, err := gatt.NewService(ServiceUUID).
+		AddCharacteristic(sessionUUID).
+		SetReadHandler(gatt.ReadHandlerFunc(p.serveSessionRead)).
+		SetWriteHandler(gatt.WriteHandlerFunc(p.serveSessionWrite)).
+		AddCharacteristic(configUUID).
+		SetWriteHandler(gatt.WriteHandlerFunc(p.serveConfig)).
+		AddCharacteristic(statusUUID).
+		SetReadHandler(gatt.ReadHandlerFunc(func(resp gatt.ReadResponseWriter, req *gatt.ReadRequest) {
+			resp.Write(p.status())
+		})).
+		EnableNotify(gatt.NotifyHandlerFunc(func(r gatt.Request, n gatt.Notifier) {
+			p.mu.Lock()
+			p.notifiers = append(p.notifiers, n)
+			p.mu.Unlock()
+		})).
+		SetNotifyPolicy(gatt.NotifyQueue).
+		Build()
+	if err != nil {
+		return nil, err
+	}
+	p.svcs = []*gatt.Service{svc}
+	return p, nil
+}
+
+// Services returns the services of the provisioner, to be added to the
+// device before it starts advertising.
+func (p *Provisioner) Services() []*gatt.Service { return p.svcs }
+
+// Disconnected drops the session of c, if any. It is to be called as c is
+// torn down, e.g. as the Disconnect option of the device.
+func (p *Provisioner) Disconnected(c gatt.Conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.sessions, c)
+}
+
+// State returns the state of the provisioning, and, if Failed, why.
+func (p *Provisioner) State() (State, Reason) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.state, p.reason
+}
+
+// Credentials returns the credentials last received, if any.
+func (p *Provisioner) Credentials() Credentials {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.cr
+}
+
+func (p *Provisioner) status() []byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return []byte{byte(p.state), byte(p.reason)}
+}
+
+// setState sets the state, and notifies the subscribed clients of it.
+// p.mu is held.
+func (p *Provisioner) setState(s State, r Reason) {
+	p.state, p.reason = s, r
+	live := p.notifiers[:0]
+	for _, n := range p.notifiers {
+		if !n.Done() {
+			live = append(live, n)
+		}
+	}
+	p.notifiers = live
+	for _, n := range live {
+		n.Write([]byte{byte(s), byte(r)})
+	}
+}
+
+func (p *Provisioner) serveSessionWrite(req gatt.Request, data []byte) byte {
+	if len(data) != nonceSize {
+		return statusInvalidLength
+	}
+	secret, err := p.opts.Secret(req.Conn)
+	if err != nil {
+		return statusInsufficientAuthn
+	}
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return gatt.StatusUnexpectedError
+	}
+	s, err := newSession(secret, data, nonce)
+	if err != nil {
+		return gatt.StatusUnexpectedError
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sessions[req.Conn] = s
+	return gatt.StatusSuccess
+}
+
+func (p *Provisioner) serveSessionRead(resp gatt.ReadResponseWriter, req *gatt.ReadRequest) {
+	p.mu.Lock()
+	s := p.sessions[req.Conn]
+	p.mu.Unlock()
+	if s == nil {
+		resp.SetStatus(statusInvalidState)
+		return
+	}
+	resp.Write(s.nonce)
+}
+
+func (p *Provisioner) serveConfig(req gatt.Request, data []byte) byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := p.sessions[req.Conn]
+	if s == nil {
+		return statusInsufficientAuthn
+	}
+	m, err := s.open(data)
+	if err != nil || len(m) == 0 {
+		return statusBadMessage
+	}
+	switch m[0] {
+	case opCredentials:
+		cr, ok := parseCredentials(m[1:])
+		if !ok {
+			return statusBadMessage
+		}
+		if p.state == Connecting {
+			return statusInvalidState
+		}
+		p.cr = cr
+		p.setState(CredentialsReceived, ReasonNone)
+	case opApply:
+		if p.state != CredentialsReceived {
+			return statusInvalidState
+		}
+		p.setState(Connecting, ReasonNone)
+		go p.apply(p.cr)
+	default:
+		return statusBadMessage
+	}
+	return gatt.StatusSuccess
+}
+
+// apply joins the network of cr, and reports the outcome.
+func (p *Provisioner) apply(cr Credentials) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.opts.Timeout)
+	defer cancel()
+	err := p.a.Apply(ctx, cr)
+	r := ReasonNone
+	switch {
+	case err == nil:
+	case errors.As(err, &r):
+	case errors.Is(err, context.DeadlineExceeded):
+		r = ReasonTimeout
+	default:
+		r = ReasonOther
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if r == ReasonNone {
+		p.setState(Connected, ReasonNone)
+		return
+	}
+	p.setState(Failed, r)
+}
+
+// marshalCredentials returns the fields of cr.
+func marshalCredentials(cr Credentials) []byte {
+	b := []byte{fieldSSID, byte(len(cr.SSID))}
+	b = append(b, cr.SSID...)
+	b = append(b, fieldPassphrase, byte(len(cr.Passphrase)))
+	return append(b, cr.Passphrase...)
+}
+
+// parseCredentials parses the fields of credentials, skipping those of
+// unknown types.
+func parseCredentials(b []byte) (Credentials, bool) {
+	var cr Credentials
+	for len(b) > 0 {
+		if len(b) < 2 || len(b) < 2+int(b[1]) {
+			return Credentials{}, false
+		}
+		v := string(b[2 : 2+b[1]])
+		switch b[0] {
+		case fieldSSID:
+			cr.SSID = v
+		case fieldPassphrase:
+			cr.Passphrase = v
+		}
+		b = b[2+b[1]:]
+	}
+	return cr, cr.check() == nil
+}
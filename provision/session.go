@@ -0,0 +1,120 @@
+package provision
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/paypal/gatt"
+)
+
+// ErrNoSecret is returned by the Secrets which share no secret with the
+// peer, e.g. as it is not bonded.
+var ErrNoSecret = errors.New("provision: no secret shared with the peer")
+
+// A Secret returns the secret shared with the peer of c, which the key of
+// the session is derived from. Both ends must return the same one.
+type Secret func(c gatt.Conn) ([]byte, error)
+
+// BondSecret returns the Secret of the long term key of the bond of ks of
+// the peer, as established as the two ends paired.
+func BondSecret(ks gatt.KeyStore) Secret {
+	return func(c gatt.Conn) ([]byte, error) {
+		b, found, err := gatt.BondOf(ks, c.RemoteAddr())
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: %s not bonded", ErrNoSecret, c.RemoteAddr())
+		}
+		return b.LTK[:], nil
+	}
+}
+
+// StaticSecret returns the Secret of every peer, e.g. the proof of
+// possession code printed on the accessory, for those provisioned before
+// they can pair.
+func StaticSecret(secret []byte) Secret {
+	secret = append([]byte(nil), secret...)
+	return func(c gatt.Conn) ([]byte, error) {
+		if len(secret) == 0 {
+			return nil, ErrNoSecret
+		}
+		return secret, nil
+	}
+}
+
+// nonceSize is the size of the nonce each end draws for a session.
+const nonceSize = 16
+
+// keyLabel tells the keys of the sessions apart from any other use of the
+// secret.
+const keyLabel = "gatt provision session"
+
+var errBadMessage = errors.New("provision: message failed to authenticate")
+
+// A session encrypts the messages to the accessory with AES-128-GCM, under
+// the key of HMAC-SHA256 of the secret, over the label and the nonces of
+// the client and of the accessory, in that order. A message is the
+// sequence number of the session, 4 bytes little endian, authenticated,
+// then the ciphertext; the sequence numbers increase from 1, for the
+// messages not to be replayed.
+type session struct {
+	aead  cipher.AEAD
+	nonce []byte // of the accessory, read by the client
+	seq   uint32 // of the last message sent, or received
+}
+
+func newSession(secret, client, accessory []byte) (*session, error) {
+	m := hmac.New(sha256.New, secret)
+	m.Write([]byte(keyLabel))
+	m.Write(client)
+	m.Write(accessory)
+	block, err := aes.NewCipher(m.Sum(nil)[:16])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &session{aead: aead, nonce: accessory}, nil
+}
+
+// gcmNonce returns the nonce of the cipher of the message of sequence
+// number seq.
+func gcmNonce(seq uint32) []byte {
+	n := make([]byte, 12)
+	binary.LittleEndian.PutUint32(n[8:], seq)
+	return n
+}
+
+// seal returns the next message, of plaintext p.
+func (s *session) seal(p []byte) []byte {
+	s.seq++
+	b := make([]byte, 4, 4+len(p)+s.aead.Overhead())
+	binary.LittleEndian.PutUint32(b, s.seq)
+	return s.aead.Seal(b, gcmNonce(s.seq), p, b[:4])
+}
+
+// open returns the plaintext of the message b, failing with errBadMessage
+// if it does not authenticate, or is not newer than the last one.
+func (s *session) open(b []byte) ([]byte, error) {
+	if len(b) < 4+s.aead.Overhead() {
+		return nil, errBadMessage
+	}
+	seq := binary.LittleEndian.Uint32(b)
+	if seq <= s.seq {
+		return nil, errBadMessage
+	}
+	p, err := s.aead.Open(nil, gcmNonce(seq), b[4:], b[:4])
+	if err != nil {
+		return nil, errBadMessage
+	}
+	s.seq = seq
+	return p, nil
+}
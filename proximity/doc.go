@@ -0,0 +1,28 @@
+// Package proximity implements the Find Me and Proximity profiles: the
+// Immediate Alert, Link Loss and Tx Power services, for the asset tags
+// that are found, and the client of those services, for the phones, or
+// gateways, that find them.
+//
+// A tag serves the services of a Reporter, and alerts as the monitor
+// asks it to, or as the link to the monitor is lost:
+//
+//	r, err := proximity.NewReporter(proximity.AlerterFunc(
+//		func(c gatt.Conn, l proximity.Level) {
+//			// beep, or blink, at level l; stop at NoAlert
+//		}), 0)
+//	d := gatt.NewDevice()
+//	d.Init(ctx, gatt.DeviceOptions{Disconnect: r.Disconnected})
+//	for _, svc := range r.Services() {
+//		d.AddService(svc)
+//	}
+//
+// The monitor connects to the tag, sets the level it alerts at as the
+// link is lost, and has it alert to be found:
+//
+//	c, err := d.Connect(ctx, tag, gatt.ConnectOptions{})
+//	m, err := proximity.NewMonitor(ctx, c)
+//	m.SetLinkLossAlert(ctx, proximity.HighAlert)
+//	m.Alert(ctx, proximity.MildAlert)
+//
+// This package is work in progress. We expect the APIs to change.
+package proximity
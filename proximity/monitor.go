@@ -0,0 +1,83 @@
+package proximity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/paypal/gatt"
+)
+
+// ErrNoService is returned by the methods of a Monitor when the tag does
+// not serve the service they use.
+var ErrNoService = errors.New("proximity: service not served by the tag")
+
+// A Monitor is the finding side of the Find Me and Proximity profiles:
+// the client of the services of a tag, the Find Me Locator and the
+// Proximity Monitor.
+type Monitor struct {
+	cl                       *gatt.Client
+	alert, linkLoss, txPower *gatt.RemoteCharacteristic
+}
+
+// NewMonitor discovers the services of the tag connected to on c. Those
+// the tag does not serve are reported by the methods using them.
+func NewMonitor(ctx context.Context, c gatt.Conn) (*Monitor, error) {
+	cl, err := gatt.NewClient(c)
+	if err != nil {
+		return nil, err
+	}
+	svcs, err := cl.DiscoverServices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	m := &Monitor{cl: cl}
+	for _, s := range svcs {
+		for _, ch := range s.Characteristics {
+			switch {
+			case s.UUID.Equal(ImmediateAlertServiceUUID) && ch.UUID.Equal(alertLevelUUID):
+				m.alert = ch
+			case s.UUID.Equal(LinkLossServiceUUID) && ch.UUID.Equal(alertLevelUUID):
+				m.linkLoss = ch
+			case s.UUID.Equal(TxPowerServiceUUID) && ch.UUID.Equal(txPowerLevelUUID):
+				m.txPower = ch
+			}
+		}
+	}
+	return m, nil
+}
+
+// Alert has the tag alert at level l, or stop alerting, with NoAlert,
+// through its Immediate Alert service.
+func (m *Monitor) Alert(ctx context.Context, l Level) error {
+	if m.alert == nil {
+		return fmt.Errorf("%w: immediate alert", ErrNoService)
+	}
+	return m.cl.Write(ctx, m.alert.ValueHandle, []byte{byte(l)}, true)
+}
+
+// SetLinkLossAlert sets the level the tag alerts at as the link is lost,
+// through its Link Loss service.
+func (m *Monitor) SetLinkLossAlert(ctx context.Context, l Level) error {
+	if m.linkLoss == nil {
+		return fmt.Errorf("%w: link loss", ErrNoService)
+	}
+	return m.cl.Write(ctx, m.linkLoss.ValueHandle, []byte{byte(l)}, false)
+}
+
+// TxPower returns the power the tag transmits at, in dBm, through its Tx
+// Power service. Less the RSSI of the connection, it is the path loss,
+// which hints at the distance to the tag.
+func (m *Monitor) TxPower(ctx context.Context) (int, error) {
+	if m.txPower == nil {
+		return 0, fmt.Errorf("%w: tx power", ErrNoService)
+	}
+	v, err := m.cl.Read(ctx, m.txPower.ValueHandle)
+	if err != nil {
+		return 0, err
+	}
+	if len(v) != 1 {
+		return 0, errors.New("proximity: malformed tx power level")
+	}
+	return int(int8(v[0])), nil
+}
@@ -0,0 +1,70 @@
+package proximity
+
+import (
+	"testing"
+
+	"github.com/paypal/gatt"
+)
+
+// fakeConn stands in for the connections, which the reporter only tells
+// apart.
+type fakeConn struct {
+	gatt.Conn
+	id int
+}
+
+type alert struct {
+	c gatt.Conn
+	l Level
+}
+
+func TestReporter(t *testing.T) {
+	var alerts []alert
+	r, err := NewReporter(AlerterFunc(func(c gatt.Conn, l Level) { alerts = append(alerts, alert{c, l}) }), -4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Services()) != 3 {
+		t.Fatalf("got %d services, want 3", len(r.Services()))
+	}
+	if _, err := NewReporter(nil, 30); err == nil {
+		t.Error("NewReporter at 30 dBm: got no error")
+	}
+
+	a, b := &fakeConn{id: 1}, &fakeConn{id: 2}
+	ra, rb := gatt.Request{Conn: a}, gatt.Request{Conn: b}
+
+	cases := []struct {
+		data   []byte
+		status byte
+	}{
+		{data: []byte{0x01}, status: gatt.StatusSuccess},
+		{data: []byte{0x03}, status: statusOutOfRange},
+		{data: []byte{0x01, 0x00}, status: statusInvalidLength},
+	}
+	for _, tt := range cases {
+		if s := r.serveImmediateAlert(ra, tt.data); s != tt.status {
+			t.Errorf("immediate alert % X: got status 0x%02X, want 0x%02X", tt.data, s, tt.status)
+		}
+	}
+	if len(alerts) != 1 || alerts[0].l != MildAlert {
+		t.Fatalf("alerts: got %v, want a mild one", alerts)
+	}
+
+	// Lost while alerting, without a link loss alert: the alert stops.
+	r.Disconnected(a)
+	if len(alerts) != 2 || alerts[1].l != NoAlert {
+		t.Fatalf("alerts: got %v, want the mild one stopped", alerts)
+	}
+
+	if s := r.serveLinkLossWrite(rb, []byte{byte(HighAlert)}); s != gatt.StatusSuccess {
+		t.Fatalf("link loss: got status 0x%02X", s)
+	}
+	if l := r.LinkLossAlert(); l != HighAlert {
+		t.Errorf("LinkLossAlert: got %d, want HighAlert", l)
+	}
+	r.Disconnected(b)
+	if len(alerts) != 3 || alerts[2].l != HighAlert {
+		t.Errorf("alerts: got %v, want a high one as the link is lost", alerts)
+	}
+}
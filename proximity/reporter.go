@@ -0,0 +1,164 @@
+package proximity
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/paypal/gatt"
+)
+
+// Services and characteristics of the profiles.
+var (
+	ImmediateAlertServiceUUID = gatt.UUID16(0x1802)
+	LinkLossServiceUUID       = gatt.UUID16(0x1803)
+	TxPowerServiceUUID        = gatt.UUID16(0x1804)
+
+	alertLevelUUID   = gatt.UUID16(0x2A06)
+	txPowerLevelUUID = gatt.UUID16(0x2A07)
+)
+
+// A Level is an alert level.
+type Level byte
+
+// Alert levels.
+const (
+	NoAlert   Level = 0x00
+	MildAlert Level = 0x01
+	HighAlert Level = 0x02
+)
+
+// Statuses of the writes of an alert level.
+const (
+	statusInvalidLength = 0x0D // Invalid Attribute Value Length
+	statusOutOfRange    = 0xFF // Out of Range
+)
+
+// An Alerter alerts the user, e.g. by beeping, or blinking, at a level,
+// for a connection, connected or lost. NoAlert stops alerting.
+type Alerter interface {
+	Alert(c gatt.Conn, l Level)
+}
+
+// AlerterFunc is an adapter to allow the use of
+// ordinary functions as Alerters.
+type AlerterFunc func(c gatt.Conn, l Level)
+
+// Alert calls f(c, l).
+func (f AlerterFunc) Alert(c gatt.Conn, l Level) {
+	f(c, l)
+}
+
+// A Reporter is the tag side of the Find Me and Proximity profiles: the
+// Immediate Alert, Link Loss and Tx Power services.
+type Reporter struct {
+	a       Alerter
+	txPower int
+	svcs    []*gatt.Service
+
+	mu       sync.Mutex
+	linkLoss Level // as last written
+	alerting map[gatt.Conn]bool
+}
+
+// NewReporter declares the services of a tag alerting with a, and
+// transmitting at txPower dBm, from -100 to 20.
+func NewReporter(a Alerter, txPower int) (*Reporter, error) {
+	if txPower < -100 || txPower > 20 {
+		return nil, fmt.Errorf("proximity: %w", gatt.ErrInvalidParameter{Param: "txPower", Value: txPower, Min: -100, Max: 20})
+	}
+	r := &Reporter{a: a, txPower: txPower, alerting: make(map[gatt.Conn]bool)}
+	ias, err := gatt.NewService(ImmediateAlertServiceUUID).
+		AddCharacteristic(alertLevelUUID).
+		SetWriteHandler(gatt.WriteHandlerFunc(r.serveImmediateAlert)).
+		Build()
+	if err != nil {
+		return nil, err
+	}
+	lls, err := gatt.NewService(LinkLossServiceUUID).
+		AddCharacteristic(alertLevelUUID).
+		SetReadHandler(gatt.ReadHandlerFunc(r.serveLinkLossRead)).
+		SetWriteHandler(gatt.WriteHandlerFunc(r.serveLinkLossWrite)).
+		Build()
+	if err != nil {
+		return nil, err
+	}
+	tps, err := gatt.NewService(TxPowerServiceUUID).
+		AddCharacteristic(txPowerLevelUUID).
+		SetReadHandler(gatt.ReadHandlerFunc(func(resp gatt.ReadResponseWriter, req *gatt.ReadRequest) {
+			resp.Write([]byte{byte(int8(r.txPower))})
+		})).
+		Build()
+	if err != nil {
+		return nil, err
+	}
+	r.svcs = []*gatt.Service{ias, lls, tps}
+	return r, nil
+}
+
+// Services returns the services of the reporter, to be added to the
+// device before it starts advertising.
+func (r *Reporter) Services() []*gatt.Service { return r.svcs }
+
+// Disconnected stops the alert of the Immediate Alert service for c, if
+// any, and alerts at the level of the Link Loss service, unless it is
+// NoAlert. It is to be called as c is torn down, e.g. as the Disconnect
+// option of the device, unless it was torn down locally, rather than
+// lost.
+func (r *Reporter) Disconnected(c gatt.Conn) {
+	r.mu.Lock()
+	l, alerting := r.linkLoss, r.alerting[c]
+	delete(r.alerting, c)
+	r.mu.Unlock()
+	switch {
+	case l != NoAlert:
+		r.a.Alert(c, l)
+	case alerting:
+		r.a.Alert(c, NoAlert)
+	}
+}
+
+// LinkLossAlert returns the level the Link Loss service alerts at.
+func (r *Reporter) LinkLossAlert() Level {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.linkLoss
+}
+
+// level returns the alert level of data, or the status a write of data
+// is answered with.
+func level(data []byte) (Level, byte) {
+	if len(data) != 1 {
+		return NoAlert, statusInvalidLength
+	}
+	if l := Level(data[0]); l <= HighAlert {
+		return l, gatt.StatusSuccess
+	}
+	return NoAlert, statusOutOfRange
+}
+
+func (r *Reporter) serveImmediateAlert(req gatt.Request, data []byte) byte {
+	l, status := level(data)
+	if status != gatt.StatusSuccess {
+		return status
+	}
+	r.mu.Lock()
+	r.alerting[req.Conn] = l != NoAlert
+	r.mu.Unlock()
+	r.a.Alert(req.Conn, l)
+	return gatt.StatusSuccess
+}
+
+func (r *Reporter) serveLinkLossRead(resp gatt.ReadResponseWriter, req *gatt.ReadRequest) {
+	resp.Write([]byte{byte(r.LinkLossAlert())})
+}
+
+func (r *Reporter) serveLinkLossWrite(req gatt.Request, data []byte) byte {
+	l, status := level(data)
+	if status != gatt.StatusSuccess {
+		return status
+	}
+	r.mu.Lock()
+	r.linkLoss = l
+	r.mu.Unlock()
+	return gatt.StatusSuccess
+}
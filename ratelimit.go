@@ -0,0 +1,97 @@
+package gatt
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is reported, wrapped, to the HandlerErrors function as a
+// peer exceeding a RateLimit is disconnected.
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// A RateLimit limits the PDUs a peer sends: Burst of them at once, and
+// Rate per second, on average, after. Burst is Rate, rounded up, if zero.
+// The zero RateLimit imposes no limit.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// LimitRequests limits the ATT requests, and commands, each peer sends to
+// the server to l. A peer exceeding the limit, likely hostile, or stuck
+// in a loop, is disconnected, sparing the battery, and the CPU, of the
+// device; the requests it sent beyond the limit are dropped, unanswered.
+// The PDUs the peer sends as a server itself, responses, notifications,
+// and indications, are not limited.
+// See also Server.NewServer.
+// LimitRequests cannot be used with Server.Option.
+func LimitRequests(l RateLimit) option {
+	return func(s *Server) option {
+		prev := s.requestLimit
+		s.requestLimit = l
+		return LimitRequests(prev)
+	}
+}
+
+// LimitSignaling limits the L2CAP signaling commands each peer sends,
+// e.g. the Connection Parameter Update Requests of a peripheral, to l,
+// as LimitRequests does the ATT requests. It applies to the connections
+// of the HCI only.
+// See also Server.NewServer.
+// LimitSignaling cannot be used with Server.Option.
+func LimitSignaling(l RateLimit) option {
+	return func(s *Server) option {
+		prev := s.signalingLimit
+		s.signalingLimit = l
+		return LimitSignaling(prev)
+	}
+}
+
+// limiter is a token bucket, enforcing a RateLimit.
+type limiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newLimiter returns a limiter enforcing l, or nil if l imposes no limit.
+func newLimiter(l RateLimit) *limiter {
+	if l.Rate <= 0 {
+		return nil
+	}
+	burst := float64(l.Burst)
+	if l.Burst <= 0 {
+		burst = math.Ceil(l.Rate)
+	}
+	return &limiter{rate: l.Rate, burst: burst, tokens: burst}
+}
+
+// allow reports whether a PDU received at now is within the limit, and
+// takes it into account if so.
+func (b *limiter) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.last.IsZero() {
+		b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// exceeded reports the peer exceeding the limit of what it sent, once,
+// and disconnects it.
+func (c *conn) exceeded(what string) {
+	c.limitOnce.Do(func() {
+		c.server.report(fmt.Errorf("gatt: %v: %w of %s; disconnecting", c.remoteAddr, ErrRateLimited, what))
+		go c.Close()
+	})
+}
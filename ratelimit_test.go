@@ -0,0 +1,71 @@
+package gatt
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	if b := newLimiter(RateLimit{}); b != nil {
+		t.Fatal("newLimiter of the zero RateLimit is not nil")
+	}
+	b := newLimiter(RateLimit{Rate: 10, Burst: 3})
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		if !b.allow(now) {
+			t.Fatalf("PDU %d of the burst not allowed", i)
+		}
+	}
+	if b.allow(now) {
+		t.Fatal("PDU beyond the burst allowed")
+	}
+	if b.allow(now.Add(50 * time.Millisecond)) {
+		t.Error("PDU allowed after half a period")
+	}
+	if !b.allow(now.Add(100 * time.Millisecond)) {
+		t.Error("PDU not allowed after a period")
+	}
+	if !b.allow(now.Add(time.Hour)) || !b.allow(now.Add(time.Hour)) || !b.allow(now.Add(time.Hour)) || b.allow(now.Add(time.Hour)) {
+		t.Error("idle limiter not refilled to its burst, and no more")
+	}
+}
+
+func TestLimitRequests(t *testing.T) {
+	errc := make(chan error, 1)
+	disconnected := make(chan struct{})
+	s := NewServer(
+		Name("limited"),
+		LimitRequests(RateLimit{Rate: 0.001, Burst: 2}),
+		HandlerErrors(func(err error) { errc <- err }),
+		Disconnect(func(c Conn) { close(disconnected) }),
+	)
+	cl, err := s.Loopback(Addr{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for i := 0; i < 2; i++ {
+		if _, err := cl.Read(ctx, 1); err != nil {
+			t.Fatalf("Read %d = %v", i, err)
+		}
+	}
+	if _, err := cl.Read(ctx, 1); err == nil {
+		t.Error("Read beyond the limit answered")
+	}
+	select {
+	case err := <-errc:
+		if !errors.Is(err, ErrRateLimited) {
+			t.Errorf("reported %v, want ErrRateLimited", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("exceeding the limit not reported")
+	}
+	select {
+	case <-disconnected:
+	case <-time.After(time.Second):
+		t.Fatal("peer exceeding the limit not disconnected")
+	}
+}
@@ -0,0 +1,53 @@
+package gatt
+
+import (
+	"io"
+	"time"
+)
+
+// RecordATT sets a function to which every ATT PDU of the connections is
+// handed, raw, as it is received, or sent, whichever role the device
+// holds: unlike those traced by TraceATT, the PDUs of the Client are
+// included. It is meant for capturing the sessions with peers, e.g. with
+// a gatttest.Recorder, to be replayed by tests. f is called from the
+// goroutines reading and writing the connections; it must not block, nor
+// keep pdu.
+// See also Server.NewServer.
+// RecordATT cannot be used with Server.Option.
+func RecordATT(f func(c Conn, sent bool, pdu []byte)) option {
+	return func(s *Server) option {
+		prev := s.recordATT
+		s.recordATT = f
+		return RecordATT(prev)
+	}
+}
+
+// recorder hands the PDUs read from, and written to, the link of c to f.
+type recorder struct {
+	io.ReadWriteCloser
+	c *conn
+	f func(c Conn, sent bool, pdu []byte)
+}
+
+func (r recorder) Read(b []byte) (int, error) {
+	n, _, err := r.ReadTimed(b)
+	return n, err
+}
+
+// ReadTimed reads as Read does, keeping the time the link tells the PDU
+// was received at.
+func (r recorder) ReadTimed(b []byte) (int, time.Time, error) {
+	n, at, err := readTimed(r.ReadWriteCloser, b)
+	if err == nil {
+		r.f(r.c, false, b[:n])
+	}
+	return n, at, err
+}
+
+func (r recorder) Write(b []byte) (int, error) {
+	n, err := r.ReadWriteCloser.Write(b)
+	if err == nil {
+		r.f(r.c, true, b)
+	}
+	return n, err
+}
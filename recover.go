@@ -0,0 +1,41 @@
+package gatt
+
+import (
+	"log"
+
+	"github.com/paypal/gatt/internal/handler"
+)
+
+// A HandlerPanic is the error reported when a handler, or a callback,
+// provided by the application panics. The panic is recovered; a request
+// being handled is answered with StatusUnexpectedError. The linux package
+// reports the panics of its handlers as a HandlerPanic too.
+type HandlerPanic = handler.Panic
+
+// HandlerErrors sets a function to be called with the errors of the
+// handlers and callbacks provided by the application, such as a
+// HandlerPanic, and of the procedures carried out on its behalf, such as
+// the negotiation of a ConnPolicy. If nil, they are logged.
+// See also Server.NewServer and Server.Option.
+func HandlerErrors(f func(err error)) option {
+	return func(s *Server) option {
+		prev := s.handlerErrors
+		s.handlerErrors = f
+		return HandlerErrors(prev)
+	}
+}
+
+// call calls f, which calls the handler of the application named name,
+// as handler.Call does, reporting a panic to the HandlerErrors function.
+func (s *Server) call(name string, f func()) bool {
+	return handler.Call(name, f, s.handlerErrors)
+}
+
+// report reports err to the HandlerErrors function, or logs it.
+func (s *Server) report(err error) {
+	if s.handlerErrors == nil {
+		log.Print(err)
+	} else {
+		s.handlerErrors(err)
+	}
+}
@@ -0,0 +1,38 @@
+package gatt
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestHandlerPanic(t *testing.T) {
+	var errs []error
+	srv := NewServer(Name(""), HandlerErrors(func(err error) { errs = append(errs, err) }))
+	svc := srv.AddService(UUID16(0x180D))
+	svc.AddCharacteristic(UUID16(0x2A37)).HandleReadFunc(
+		func(resp ReadResponseWriter, req *ReadRequest) { panic("read") })
+	svc.AddCharacteristic(UUID16(0x2A38)).HandleWriteFunc(
+		func(r Request, data []byte) byte { panic("write") })
+	srv.setServices()
+	c := newConn(srv, &testHandler{}, Addr{})
+
+	// Handles: 1-9 GAP and GATT services, 10 service, 11-12 read
+	// characteristic, 13-14 write characteristic.
+	cases := []struct {
+		req, rsp []byte
+	}{
+		{req: []byte{attOpReadReq, 0x0C, 0x00}, rsp: []byte{attOpError, attOpReadReq, 0x0C, 0x00, attEcodeUnlikely}},
+		{req: []byte{attOpWriteReq, 0x0E, 0x00, 0x01}, rsp: []byte{attOpError, attOpWriteReq, 0x0E, 0x00, attEcodeUnlikely}},
+	}
+	for _, tt := range cases {
+		if rsp := c.handleReq(tt.req); !bytes.Equal(rsp, tt.rsp) {
+			t.Errorf("handleReq(% X): got % X, want % X", tt.req, rsp, tt.rsp)
+		}
+	}
+	if len(errs) != 2 {
+		t.Fatalf("got %d handler errors, want 2", len(errs))
+	}
+	if p, ok := errs[0].(*HandlerPanic); !ok || p.Value != "read" || p.Handler != "read 2a37" {
+		t.Errorf("got %#v, want the panic of the read handler", errs[0])
+	}
+}
@@ -0,0 +1,208 @@
+package gatt
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// A Relay re-exposes the services of a peripheral, connected to as the
+// central, as services of the local device, so that the centrals out of
+// the range of the peripheral reach it through the device, as a gateway.
+//
+// Each characteristic is declared anew, with the properties of the remote
+// one, and gets a handle of the local device: the requests of the local
+// centrals are translated to the handles of the peripheral, and
+// forwarded to it, and its errors are forwarded back. Notifications, and
+// indications, are subscribed to on the peripheral once the first local
+// central subscribes, forwarded to every central subscribed, as
+// notifications, queued for each at the pace of its own link, and
+// unsubscribed from once none is left. The Generic
+// Access and Generic Attribute services are not relayed.
+type Relay struct {
+	client   *Client
+	services []*Service
+
+	syncmu     sync.Mutex // held while subscribing, or unsubscribing
+	mu         sync.Mutex
+	notifiers  map[*RemoteCharacteristic][]Notifier
+	subscribed map[*RemoteCharacteristic]bool
+}
+
+// NewRelay discovers the services of the peer of c, and declares those
+// relaying them, to be added to the local device, or server, before it
+// starts advertising. Failures to subscribe to, or unsubscribe from, the
+// peer are reported to the HandlerErrors function of the server of c.
+func NewRelay(ctx context.Context, c Conn) (*Relay, error) {
+	cl, err := NewClient(c)
+	if err != nil {
+		return nil, err
+	}
+	rss, err := cl.DiscoverServices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r := &Relay{
+		client:     cl,
+		notifiers:  make(map[*RemoteCharacteristic][]Notifier),
+		subscribed: make(map[*RemoteCharacteristic]bool),
+	}
+	for _, rs := range rss {
+		if rs.UUID.Equal(gatAttrGAPUUID) || rs.UUID.Equal(gatAttrGATTUUID) {
+			continue
+		}
+		svc, err := r.declare(ctx, rs)
+		if err != nil {
+			return nil, err
+		}
+		if svc != nil {
+			r.services = append(r.services, svc)
+		}
+	}
+	return r, nil
+}
+
+// Services returns the services relaying those of the peer.
+func (r *Relay) Services() []*Service { return r.services }
+
+// declare declares the service relaying rs, or returns nil if none of
+// its characteristics can be relayed.
+func (r *Relay) declare(ctx context.Context, rs *RemoteService) (*Service, error) {
+	b := NewService(rs.UUID)
+	n := 0
+	for _, rc := range rs.Characteristics {
+		if rc.Properties&(charRead|charWrite|charWriteNR|charNotify|charIndicate) == 0 {
+			continue
+		}
+		cb := b.AddCharacteristic(rc.UUID)
+		n++
+		if rc.Properties&charRead != 0 {
+			cb.SetReadHandler(r.reader(rc))
+		}
+		if rc.Properties&(charWrite|charWriteNR) != 0 {
+			cb.SetWriteHandler(r.writer(rc))
+		}
+		if rc.Properties&(charNotify|charIndicate) != 0 {
+			cb.EnableNotify(r.notify(rc)).SetNotifyPolicy(NotifyQueue)
+		}
+		for _, d := range rc.Descriptors {
+			if d.UUID.Equal(gattAttrClientCharacteristicConfigUUID) {
+				continue
+			}
+			v, err := r.client.Read(ctx, d.Handle)
+			var e *ATTError
+			if errors.As(err, &e) {
+				continue // e.g. needs authentication; left out
+			}
+			if err != nil {
+				return nil, err
+			}
+			cb.AddDescriptor(d.UUID, v)
+		}
+	}
+	if n == 0 {
+		return nil, nil
+	}
+	return b.Build()
+}
+
+// relayStatus returns the status a local request is answered with, for the
+// error the peer answered the forwarded one with.
+func relayStatus(err error) byte {
+	var e *ATTError
+	if errors.As(err, &e) {
+		return e.Status
+	}
+	return StatusUnexpectedError
+}
+
+func (r *Relay) reader(rc *RemoteCharacteristic) ReadHandler {
+	return ReadHandlerFunc(func(resp ReadResponseWriter, req *ReadRequest) {
+		v, err := r.client.readAt(context.Background(), rc.ValueHandle, req.Offset)
+		if err != nil {
+			resp.SetStatus(relayStatus(err))
+			return
+		}
+		if len(v) > req.Cap {
+			v = v[:req.Cap]
+		}
+		resp.Write(v)
+	})
+}
+
+func (r *Relay) writer(rc *RemoteCharacteristic) WriteHandler {
+	noResponse := rc.Properties&charWrite == 0
+	return WriteHandlerFunc(func(req Request, data []byte) byte {
+		if err := r.client.Write(context.Background(), rc.ValueHandle, data, noResponse); err != nil {
+			return relayStatus(err)
+		}
+		return StatusSuccess
+	})
+}
+
+func (r *Relay) notify(rc *RemoteCharacteristic) NotifyHandler {
+	return NotifyHandlerFunc(func(req Request, n Notifier) {
+		r.mu.Lock()
+		r.notifiers[rc] = append(live(r.notifiers[rc]), n)
+		r.mu.Unlock()
+		r.sync(rc)
+	})
+}
+
+// forward forwards the value v, notified by the peer, to the centrals
+// subscribed to rc, and unsubscribes from it once none is left.
+func (r *Relay) forward(rc *RemoteCharacteristic, v []byte) {
+	r.mu.Lock()
+	ns := live(r.notifiers[rc])
+	r.notifiers[rc] = ns
+	if len(ns) == 0 && r.subscribed[rc] {
+		// Not from the goroutine serving the connection, which
+		// delivers the response.
+		go r.sync(rc)
+	}
+	r.mu.Unlock()
+	for _, n := range ns {
+		b := v
+		if len(b) > n.Cap() {
+			b = b[:n.Cap()]
+		}
+		n.Write(b)
+	}
+}
+
+// sync subscribes to rc, or unsubscribes from it, as the local centrals
+// are subscribed to it, or not.
+func (r *Relay) sync(rc *RemoteCharacteristic) {
+	r.syncmu.Lock()
+	defer r.syncmu.Unlock()
+	r.mu.Lock()
+	want, have := len(live(r.notifiers[rc])) > 0, r.subscribed[rc]
+	r.mu.Unlock()
+	if want == have {
+		return
+	}
+	var err error
+	if want {
+		err = r.client.Subscribe(context.Background(), rc, func(v []byte) { r.forward(rc, v) })
+	} else {
+		err = r.client.Unsubscribe(context.Background(), rc)
+	}
+	if err != nil {
+		r.client.c.server.report(err)
+		return
+	}
+	r.mu.Lock()
+	r.subscribed[rc] = want
+	r.mu.Unlock()
+}
+
+// live returns the notifiers of ns not done yet.
+func live(ns []Notifier) []Notifier {
+	var l []Notifier
+	for _, n := range ns {
+		if !n.Done() {
+			l = append(l, n)
+		}
+	}
+	return l
+}
@@ -0,0 +1,146 @@
+package gatt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// link connects a connection of server a to one of server b, serves
+// both, and returns them.
+func link(t *testing.T, a, b *Server) (*conn, *conn) {
+	pa, pb := newPipe()
+	ca, cb := newConn(a, pa, Addr{}), newConn(b, pb, Addr{})
+	go ca.loop()
+	go cb.loop()
+	t.Cleanup(func() { pa.Close() })
+	return ca, cb
+}
+
+func TestRelay(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The peripheral, with a heart rate measurement, and a control point.
+	var mu sync.Mutex
+	var written []byte
+	notifiers := make(chan Notifier, 1)
+	periph := NewServer(Name(""))
+	svc, err := NewService(UUID16(0x180D)).
+		AddCharacteristic(UUID16(0x2A37)).
+		SetReadHandler(ReadHandlerFunc(func(resp ReadResponseWriter, req *ReadRequest) {
+			resp.Write([]byte("beat")[req.Offset:])
+		})).
+		EnableNotify(NotifyHandlerFunc(func(r Request, n Notifier) { notifiers <- n })).
+		AddDescriptor(UUID16(0x2901), []byte("heart rate")).
+		AddCharacteristic(UUID16(0x2A39)).
+		SetWriteHandler(WriteHandlerFunc(func(r Request, data []byte) byte {
+			mu.Lock()
+			defer mu.Unlock()
+			written = append([]byte(nil), data...)
+			if len(data) == 0 {
+				return attEcodeInvalAttrValueLen
+			}
+			return StatusSuccess
+		})).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	periph.services = append(periph.services, svc)
+	periph.setServices()
+
+	// The gateway, with a service of its own ahead of those relayed, so
+	// that their handles differ from those of the peripheral.
+	gw := NewServer(Name(""))
+	gw.AddService(UUID16(0x180F)).AddCharacteristic(UUID16(0x2A19)).HandleReadFunc(
+		func(resp ReadResponseWriter, req *ReadRequest) { resp.Write([]byte{100}) })
+	_, up := link(t, periph, gw)
+	r, err := NewRelay(ctx, up)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Services()) != 1 || !r.Services()[0].UUID().Equal(UUID16(0x180D)) {
+		t.Fatalf("relayed %v, want the heart rate service", r.Services())
+	}
+	gw.services = append(gw.services, r.Services()...)
+	gw.setServices()
+
+	// The central, out of the range of the peripheral.
+	_, down := link(t, gw, NewServer(Name("")))
+	cl, err := NewClient(down)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svcs, err := cl.DiscoverServices(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hr *RemoteService
+	for _, s := range svcs {
+		if s.UUID.Equal(UUID16(0x180D)) {
+			hr = s
+		}
+	}
+	if hr == nil || len(hr.Characteristics) != 2 {
+		t.Fatalf("discovered %+v, want the heart rate service, and its 2 characteristics", svcs)
+	}
+	m, cp := hr.Characteristics[0], hr.Characteristics[1]
+	if len(m.Descriptors) != 2 || m.cccd() == 0 {
+		t.Fatalf("measurement descriptors: %+v, want a user description and a cccd", m.Descriptors)
+	}
+	if v, err := cl.Read(ctx, m.Descriptors[1].Handle); err != nil || string(v) != "heart rate" {
+		t.Errorf("user description: got %q, %v", v, err)
+	}
+
+	if v, err := cl.Read(ctx, m.ValueHandle); err != nil || string(v) != "beat" {
+		t.Errorf("Read: got %q, %v", v, err)
+	}
+	if err := cl.Write(ctx, cp.ValueHandle, []byte{0x01}, false); err != nil {
+		t.Errorf("Write: %v", err)
+	}
+	mu.Lock()
+	if !bytes.Equal(written, []byte{0x01}) {
+		t.Errorf("written to the peripheral: % X", written)
+	}
+	mu.Unlock()
+	var e *ATTError
+	if err := cl.Write(ctx, cp.ValueHandle, nil, false); !errors.As(err, &e) || e.Status != attEcodeInvalAttrValueLen {
+		t.Errorf("Write of nothing: got %v, want the error of the peripheral", err)
+	}
+
+	values := make(chan []byte, 1)
+	if err := cl.Subscribe(ctx, m, func(v []byte) { values <- append([]byte(nil), v...) }); err != nil {
+		t.Fatal(err)
+	}
+	var n Notifier
+	select {
+	case n = <-notifiers:
+	case <-ctx.Done():
+		t.Fatal("the relay did not subscribe to the peripheral")
+	}
+	n.Write([]byte{0x00, 72})
+	select {
+	case v := <-values:
+		if !bytes.Equal(v, []byte{0x00, 72}) {
+			t.Errorf("notified % X", v)
+		}
+	case <-ctx.Done():
+		t.Fatal("notification not relayed")
+	}
+
+	if err := cl.Unsubscribe(ctx, m); err != nil {
+		t.Fatal(err)
+	}
+	n.Write([]byte{0x00, 73}) // unsubscribes the relay
+	for !n.Done() {
+		select {
+		case <-ctx.Done():
+			t.Fatal("the relay did not unsubscribe from the peripheral")
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package gatt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// A RetryPolicy retries the requests of a Client failing with transient
+// conditions: the peer short of resources, or of an unlikely error, and,
+// if Reconnect is set, the link dropping mid-request, to the supervision
+// timeout. It applies to the operations given a context of WithRetry.
+type RetryPolicy struct {
+	// Attempts is the number of times a request is issued, the first
+	// included; a single one if zero.
+	Attempts int
+
+	// Backoff is the delay before the first retry, doubled at each
+	// retry, up to MaxBackoff; 100 ms and 2 s if zero.
+	Backoff, MaxBackoff time.Duration
+
+	// Statuses are the ATT error codes retried; Insufficient Resources,
+	// 0x11, and Unlikely Error, 0x0E, if nil.
+	Statuses []byte
+
+	// Reconnect, if set, connects to the peer again, once the link is
+	// lost to the supervision timeout mid-request; the request is then
+	// retried over the new connection, which the Client uses from then
+	// on, the handlers of its subscriptions included. The peer keeps the
+	// subscriptions of bonded clients only; see Bonds.
+	Reconnect func(ctx context.Context) (Conn, error)
+}
+
+// Defaults of the RetryPolicy.
+const (
+	defaultRetryBackoff    = 100 * time.Millisecond
+	defaultRetryMaxBackoff = 2 * time.Second
+)
+
+type retryKey struct{}
+
+// WithRetry returns a copy of ctx carrying p: the requests of the
+// operations of a Client given it are retried as per p. Each request of
+// an operation, such as each of the Read Blob Requests of Read, is
+// retried in turn, not the operation as a whole.
+func WithRetry(ctx context.Context, p RetryPolicy) context.Context {
+	if p.Backoff == 0 {
+		p.Backoff = defaultRetryBackoff
+	}
+	if p.MaxBackoff == 0 {
+		p.MaxBackoff = defaultRetryMaxBackoff
+	}
+	if p.Statuses == nil {
+		p.Statuses = []byte{attEcodeInsuffResources, attEcodeUnlikely}
+	}
+	return context.WithValue(ctx, retryKey{}, &p)
+}
+
+// retries reports whether the request that failed with err is retried,
+// once the link is back if lost.
+func (p *RetryPolicy) retries(err error, lost bool) bool {
+	if lost {
+		return p.Reconnect != nil
+	}
+	var e *ATTError
+	if !errors.As(err, &e) {
+		return false
+	}
+	for _, s := range p.Statuses {
+		if s == e.Status {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns the delay before the retry i, from 1 on.
+func (p *RetryPolicy) backoff(i int) time.Duration {
+	d := p.Backoff
+	for ; i > 1 && d < p.MaxBackoff; i-- {
+		d *= 2
+	}
+	if d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d
+}
+
+// linkLost reports whether err is that of a request over a link lost to
+// the supervision timeout, as told by the Timeout method of the error
+// the connection was closed with, that of the platform.
+func linkLost(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var t interface{ Timeout() bool }
+	return errors.As(err, &t) && t.Timeout()
+}
+
+// request issues the ATT request req, as attRequest does, over the
+// connection of cl, retrying it as per the RetryPolicy of ctx, if any.
+func (cl *Client) request(ctx context.Context, req []byte, rspOp byte) ([]byte, error) {
+	c := cl.conn()
+	rsp, err := c.attRequest(ctx, req, rspOp)
+	p, _ := ctx.Value(retryKey{}).(*RetryPolicy)
+	if p == nil {
+		return rsp, err
+	}
+	for i := 1; err != nil && i < p.Attempts; i++ {
+		lost := linkLost(err)
+		if !p.retries(err, lost) {
+			break
+		}
+		t := time.NewTimer(p.backoff(i))
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return nil, ctx.Err()
+		}
+		if lost {
+			if c, err = cl.reconnect(ctx, c, p); err != nil {
+				return nil, err
+			}
+		}
+		rsp, err = c.attRequest(ctx, req, rspOp)
+	}
+	return rsp, err
+}
+
+// reconnect replaces old, the connection of cl lost, with that p
+// reconnects, unless another request has already, and returns it.
+func (cl *Client) reconnect(ctx context.Context, old *conn, p *RetryPolicy) (*conn, error) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	if cl.c != old {
+		return cl.c, nil
+	}
+	nc, err := p.Reconnect(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("gatt: reconnecting to %s: %w", old.remoteAddr, err)
+	}
+	c, ok := nc.(*conn)
+	if !ok {
+		nc.Close()
+		return nil, fmt.Errorf("gatt: %T is not a connection of gatt", nc)
+	}
+	old.subsmu.Lock()
+	c.subsmu.Lock()
+	for h, f := range old.subs {
+		c.subs[h] = f
+	}
+	c.subsmu.Unlock()
+	old.subsmu.Unlock()
+	cl.c = c
+	return c, nil
+}
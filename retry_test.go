@@ -0,0 +1,123 @@
+package gatt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// droppedLink is a link lost to the supervision timeout as soon as a
+// request is written to it.
+type droppedLink struct {
+	lost chan struct{}
+	once sync.Once
+}
+
+type linkTimeout struct{}
+
+func (linkTimeout) Error() string { return "link timeout" }
+func (linkTimeout) Timeout() bool { return true }
+
+func (l *droppedLink) Read(b []byte) (int, error) {
+	<-l.lost
+	return 0, linkTimeout{}
+}
+
+func (l *droppedLink) Write(b []byte) (int, error) {
+	l.once.Do(func() { close(l.lost) })
+	return len(b), nil
+}
+
+func (l *droppedLink) Close() error {
+	l.once.Do(func() { close(l.lost) })
+	return nil
+}
+
+func TestRetry(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var mu sync.Mutex
+	failures := 0
+	s := NewServer(Name(""))
+	svc, err := NewService(UUID16(0x180F)).
+		AddCharacteristic(UUID16(0x2A19)).
+		SetReadHandler(ReadHandlerFunc(func(resp ReadResponseWriter, req *ReadRequest) {
+			mu.Lock()
+			defer mu.Unlock()
+			if failures > 0 {
+				failures--
+				resp.SetStatus(attEcodeInsuffResources)
+				return
+			}
+			resp.Write([]byte("full"))
+		})).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl, err := s.Loopback(Addr{}, svc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svcs, err := cl.DiscoverServices(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := svcs[len(svcs)-1].Characteristics[0].ValueHandle
+	fail := func(n int) {
+		mu.Lock()
+		failures = n
+		mu.Unlock()
+	}
+
+	fail(1)
+	var e *ATTError
+	if _, err := cl.Read(ctx, h); !errors.As(err, &e) || e.Status != attEcodeInsuffResources {
+		t.Errorf("Read() without retries = %v, want an ATTError of status 0x%02X", err, attEcodeInsuffResources)
+	}
+	fail(2)
+	rctx := WithRetry(ctx, RetryPolicy{Attempts: 3, Backoff: time.Millisecond})
+	if v, err := cl.Read(rctx, h); err != nil || !bytes.Equal(v, []byte("full")) {
+		t.Errorf("Read() retried = %q, %v, want \"full\"", v, err)
+	}
+	fail(3)
+	if _, err := cl.Read(rctx, h); !errors.As(err, &e) {
+		t.Errorf("Read() beyond the attempts = %v, want an ATTError", err)
+	}
+	fail(1)
+	if _, err := cl.Read(WithRetry(ctx, RetryPolicy{Attempts: 3, Statuses: []byte{attEcodeUnlikely}}), h); !errors.As(err, &e) {
+		t.Errorf("Read() of a status not retried = %v, want an ATTError", err)
+	}
+	fail(0)
+
+	// The link drops mid-request, and is connected again.
+	dropped, err := NewServer(Name("")).Attach(&droppedLink{lost: make(chan struct{})}, Addr{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dropped.Read(rctx, h); !linkLost(err) {
+		t.Errorf("Read() over a link lost, without Reconnect = %v, want the link lost", err)
+	}
+	dropped, err = NewServer(Name("")).Attach(&droppedLink{lost: make(chan struct{})}, Addr{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reconnected, err := s.Loopback(Addr{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := RetryPolicy{
+		Attempts:  2,
+		Backoff:   time.Millisecond,
+		Reconnect: func(ctx context.Context) (Conn, error) { return reconnected.Conn(), nil },
+	}
+	if v, err := dropped.Read(WithRetry(ctx, p), h); err != nil || !bytes.Equal(v, []byte("full")) {
+		t.Errorf("Read() reconnecting = %q, %v, want \"full\"", v, err)
+	}
+	if dropped.Conn() != reconnected.Conn() {
+		t.Error("Client not switched to the connection reconnected")
+	}
+}
@@ -0,0 +1,139 @@
+package gatt
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// A ScanRecord is an Advertisement recorded by a ScanStore, with the time
+// it was received.
+type ScanRecord struct {
+	Time time.Time
+	Advertisement
+}
+
+// A ScanQuery selects the ScanRecords of a ScanStore. Its zero fields
+// select them all.
+type ScanQuery struct {
+	Addr    Addr      // of the advertiser, of either type of random address
+	Service UUID      // listed by the advertisement
+	Since   time.Time // received at or after
+	Until   time.Time // received before
+
+	// Limit, if positive, keeps the last Limit records selected.
+	Limit int
+}
+
+// Match reports whether the query selects r, but for its Limit, for the
+// stores that filter the records themselves.
+func (q ScanQuery) Match(r ScanRecord) bool {
+	if len(q.Addr.HardwareAddr) > 0 && !q.Addr.same(r.Addr) {
+		return false
+	}
+	if q.Service.Len() > 0 && !r.HasService(q.Service) {
+		return false
+	}
+	if !q.Since.IsZero() && r.Time.Before(q.Since) {
+		return false
+	}
+	return q.Until.IsZero() || r.Time.Before(q.Until)
+}
+
+// A ScanStore records the advertisements received while scanning, as set
+// by the Store field of ScanOptions, for presence analytics, e.g. which
+// devices were around, and when, to query them later.
+//
+// MemoryScanStore keeps the last ones in memory. Stores that persist
+// them, e.g. in bbolt, or SQLite, implement ScanStore out of the package,
+// so that gatt does not depend on their drivers.
+type ScanStore interface {
+	// Record records r. It is called from the goroutine delivering the
+	// advertisements: it must not block.
+	Record(r ScanRecord) error
+
+	// Query returns the records selected by q, in the order they were
+	// received.
+	Query(q ScanQuery) ([]ScanRecord, error)
+}
+
+// A MemoryScanStore is a ScanStore keeping the last records in a ring.
+// It is safe for concurrent use.
+type MemoryScanStore struct {
+	mu   sync.Mutex
+	ring []ScanRecord
+	next int  // index of the record to be overwritten next
+	full bool // the ring has wrapped around
+}
+
+// NewMemoryScanStore returns a MemoryScanStore keeping the last n records.
+func NewMemoryScanStore(n int) *MemoryScanStore {
+	if n < 1 {
+		n = 1
+	}
+	return &MemoryScanStore{ring: make([]ScanRecord, n)}
+}
+
+// Record records r, in place of the oldest record once the store is full.
+func (m *MemoryScanStore) Record(r ScanRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ring[m.next] = r
+	m.next++
+	if m.next == len(m.ring) {
+		m.next, m.full = 0, true
+	}
+	return nil
+}
+
+// Query returns the records selected by q, in the order they were
+// received.
+func (m *MemoryScanStore) Query(q ScanQuery) ([]ScanRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var rs []ScanRecord
+	if m.full {
+		rs = matching(rs, m.ring[m.next:], q)
+	}
+	rs = matching(rs, m.ring[:m.next], q)
+	if q.Limit > 0 && len(rs) > q.Limit {
+		rs = rs[len(rs)-q.Limit:]
+	}
+	return rs, nil
+}
+
+// matching appends the records of rs selected by q to dst.
+func matching(dst, rs []ScanRecord, q ScanQuery) []ScanRecord {
+	for _, r := range rs {
+		if q.Match(r) {
+			dst = append(dst, r)
+		}
+	}
+	return dst
+}
+
+// recording returns f, recording the advertisements in the Store, and
+// the Peers, of the options, if any, before they are handed to f. The
+// errors of the store, and of the registry, are reported to report.
+func (o ScanOptions) recording(f func(a *Advertisement), report func(err error)) func(a *Advertisement) {
+	st, ps := o.Store, o.Peers
+	if st == nil && ps == nil {
+		return f
+	}
+	return func(a *Advertisement) {
+		now := time.Now()
+		if st != nil {
+			if err := st.Record(ScanRecord{Time: now, Advertisement: *a}); err != nil {
+				report(fmt.Errorf("gatt: recording %v: %w", a.Addr, err))
+			}
+		}
+		if ps != nil {
+			if err := ps.observe(a, now); err != nil {
+				report(err)
+			}
+		}
+		if f != nil {
+			f(a)
+		}
+	}
+}
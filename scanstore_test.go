@@ -0,0 +1,77 @@
+package gatt
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestMemoryScanStore(t *testing.T) {
+	hr, _ := serviceAdvertisingPacket([]UUID{UUID16(0x180D)})
+	a := PublicAddr(BDAddr{net.HardwareAddr{0x01, 0x02, 0x03, 0x04, 0x05, 0x06}})
+	b := RandomAddr(BDAddr{net.HardwareAddr{0x01, 0x02, 0x03, 0x04, 0x05, 0xC6}})
+	t0 := time.Now()
+	at := func(i int) time.Time { return t0.Add(time.Duration(i) * time.Second) }
+
+	m := NewMemoryScanStore(4)
+	for i := 0; i < 6; i++ {
+		r := ScanRecord{Time: at(i), Advertisement: Advertisement{Addr: a, RSSI: -i}}
+		if i%2 == 1 {
+			r.Addr, r.Data = b, hr
+		}
+		m.Record(r)
+	}
+	for _, tt := range []struct {
+		name string
+		q    ScanQuery
+		want []int // RSSIs, negated
+	}{
+		{"all", ScanQuery{}, []int{2, 3, 4, 5}}, // the first two overwritten
+		{"addr", ScanQuery{Addr: a}, []int{2, 4}},
+		{"service", ScanQuery{Service: UUID16(0x180D)}, []int{3, 5}},
+		{"window", ScanQuery{Since: at(3), Until: at(5)}, []int{3, 4}},
+		{"limit", ScanQuery{Limit: 3}, []int{3, 4, 5}},
+		{"none", ScanQuery{Addr: a, Service: UUID16(0x180D)}, nil},
+	} {
+		rs, err := m.Query(tt.q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []int
+		for _, r := range rs {
+			got = append(got, -r.RSSI)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+type failingStore struct{ ScanStore }
+
+func (failingStore) Record(r ScanRecord) error { return errors.New("disk full") }
+
+func TestScanRecording(t *testing.T) {
+	m := NewMemoryScanStore(8)
+	var seen int
+	f := ScanOptions{Store: m}.recording(func(a *Advertisement) { seen++ }, func(err error) { t.Error(err) })
+	f(&Advertisement{RSSI: -40})
+	if rs, _ := m.Query(ScanQuery{}); len(rs) != 1 || rs[0].RSSI != -40 || rs[0].Time.IsZero() || seen != 1 {
+		t.Errorf("recorded %+v, and handed %d advertisements over", rs, seen)
+	}
+
+	var reported error
+	f = ScanOptions{Store: failingStore{}}.recording(func(a *Advertisement) { seen++ }, func(err error) { reported = err })
+	f(&Advertisement{})
+	if reported == nil || seen != 2 {
+		t.Errorf("failing store: reported %v, handed %d advertisements over; want an error, and 2", reported, seen)
+	}
+}
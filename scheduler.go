@@ -0,0 +1,288 @@
+package gatt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// A PollTarget is a peripheral a Scheduler polls: it connects to it,
+// syncs its data, and disconnects, every Interval.
+type PollTarget struct {
+	Addr     Addr
+	Interval time.Duration // from the start of a poll to that of the next
+
+	// Priority orders the targets due at once, when slots run short:
+	// the highest first, then the longest overdue.
+	Priority int
+}
+
+// SchedulerOptions are the options of a Scheduler.
+type SchedulerOptions struct {
+	// Slots is the number of connections held at once, e.g. the
+	// MaxConnections of the device, less those kept for other uses;
+	// 1 if zero.
+	Slots int
+
+	// Connect are the options of the connections.
+	Connect ConnectOptions
+
+	// Timeout bounds each poll, from connecting to the end of Sync;
+	// 30 s if zero.
+	Timeout time.Duration
+
+	// Sync syncs the data of the peripheral connected to on c, e.g.
+	// reads the measurements logged since the last poll. The connection
+	// is closed once it returns; ctx is done once the Timeout elapses.
+	Sync func(ctx context.Context, c Conn) error
+
+	// Backoff is how long a target is left alone once a poll fails,
+	// doubled at each failure in a row, up to MaxBackoff, and to its
+	// Interval, if longer; 5 s and 5 min if zero.
+	Backoff, MaxBackoff time.Duration
+
+	// Polled, if set, is called once each poll ends, with the error it
+	// failed with, if any.
+	Polled func(addr Addr, err error)
+}
+
+// Defaults of the SchedulerOptions.
+const (
+	defaultPollTimeout = 30 * time.Second
+	defaultBackoff     = 5 * time.Second
+	defaultMaxBackoff  = 5 * time.Minute
+)
+
+// A PollStatus is the state of a target of a Scheduler.
+type PollStatus struct {
+	PollTarget
+	Next     time.Time // when it is due
+	Last     time.Time // when the last poll succeeded, if any did
+	Failures int       // polls failed in a row
+	Err      error     // of the last poll failed, if the last failed
+	Polling  bool
+}
+
+// A Scheduler polls a set of peripherals larger than the connections the
+// device holds at once, the core loop of the gateways collecting the
+// data of sensors: it rotates a few connection slots across them, each
+// at its own interval, the most urgent first, backing off of those
+// failing.
+type Scheduler struct {
+	d    Device
+	opts SchedulerOptions
+
+	mu      sync.Mutex
+	targets map[string]*PollStatus // by address
+	wake    chan struct{}
+}
+
+// NewScheduler returns a Scheduler polling with d, initialized, of no
+// target.
+func NewScheduler(d Device, opts SchedulerOptions) (*Scheduler, error) {
+	if opts.Slots == 0 {
+		opts.Slots = 1
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = defaultPollTimeout
+	}
+	if opts.Backoff == 0 {
+		opts.Backoff = defaultBackoff
+	}
+	if opts.MaxBackoff == 0 {
+		opts.MaxBackoff = defaultMaxBackoff
+	}
+	if opts.Sync == nil {
+		return nil, errors.New("gatt: SchedulerOptions.Sync not set")
+	}
+	if err := checkRange("SchedulerOptions.Slots", opts.Slots, 1, 0xEFF); err != nil {
+		return nil, err
+	}
+	if err := checkDuration("SchedulerOptions.Backoff", opts.Backoff, time.Millisecond, opts.MaxBackoff); err != nil {
+		return nil, err
+	}
+	return &Scheduler{
+		d:       d,
+		opts:    opts,
+		targets: make(map[string]*PollStatus),
+		wake:    make(chan struct{}, 1),
+	}, nil
+}
+
+// Add adds the target t, due at once, or updates its Interval and
+// Priority, if added already.
+func (s *Scheduler) Add(t PollTarget) error {
+	if err := t.Addr.check(); err != nil {
+		return err
+	}
+	if err := checkDuration("PollTarget.Interval", t.Interval, time.Millisecond, math.MaxInt64); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	if st, found := s.targets[t.Addr.String()]; found {
+		st.PollTarget = t
+	} else {
+		s.targets[t.Addr.String()] = &PollStatus{PollTarget: t, Next: time.Now()}
+	}
+	s.mu.Unlock()
+	s.signal()
+	return nil
+}
+
+// Remove removes the target of address a; a poll of it running carries
+// on.
+func (s *Scheduler) Remove(a Addr) {
+	s.mu.Lock()
+	delete(s.targets, a.String())
+	s.mu.Unlock()
+	s.signal()
+}
+
+// Status returns the state of the targets, sorted by when they are due.
+func (s *Scheduler) Status() []PollStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sts := make([]PollStatus, 0, len(s.targets))
+	for _, st := range s.targets {
+		sts = append(sts, *st)
+	}
+	sort.Slice(sts, func(i, j int) bool { return sts[i].Next.Before(sts[j].Next) })
+	return sts
+}
+
+// signal wakes Run up, for it to reconsider the targets.
+func (s *Scheduler) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run polls the targets, as they are due, Slots at a time, until ctx is
+// done. It waits for the polls running to end, and returns ctx.Err().
+func (s *Scheduler) Run(ctx context.Context) error {
+	slots := make(chan struct{}, s.opts.Slots)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	t := time.NewTimer(0)
+	defer t.Stop()
+	for {
+		var next time.Time
+		for _, st := range s.due(time.Now(), s.opts.Slots-len(slots), &next) {
+			slots <- struct{}{}
+			wg.Add(1)
+			go func(st *PollStatus, a Addr) {
+				defer wg.Done()
+				defer func() { <-slots }()
+				s.done(st, a, s.poll(ctx, a))
+			}(st, st.Addr)
+		}
+		if !t.Stop() {
+			select {
+			case <-t.C:
+			default:
+			}
+		}
+		if !next.IsZero() {
+			t.Reset(time.Until(next))
+		}
+		select {
+		case <-t.C:
+		case <-s.wake:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// due marks as polling, and returns, up to n targets due at now, by
+// priority, then by how long overdue; next is set to when the next of
+// those left is due, if any.
+func (s *Scheduler) due(now time.Time, n int, next *time.Time) []*PollStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var due []*PollStatus
+	for _, st := range s.targets {
+		switch {
+		case st.Polling:
+		case !st.Next.After(now):
+			due = append(due, st)
+		case next.IsZero() || st.Next.Before(*next):
+			*next = st.Next
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if due[i].Priority != due[j].Priority {
+			return due[i].Priority > due[j].Priority
+		}
+		return due[i].Next.Before(due[j].Next)
+	})
+	if len(due) > n {
+		// Those left wait for a slot, which wakes Run up.
+		due = due[:n]
+	}
+	for _, st := range due {
+		st.Polling = true
+	}
+	return due
+}
+
+// poll connects to the peripheral of address a, syncs it, and
+// disconnects.
+func (s *Scheduler) poll(ctx context.Context, a Addr) error {
+	ctx, cancel := context.WithTimeout(ctx, s.opts.Timeout)
+	defer cancel()
+	c, err := s.d.Connect(ctx, a, s.opts.Connect)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if err := s.opts.Sync(ctx, c); err != nil {
+		return fmt.Errorf("gatt: sync of %s: %w", a, err)
+	}
+	return nil
+}
+
+// done schedules the next poll of st, of address a, once one ended with
+// err, and reports it.
+func (s *Scheduler) done(st *PollStatus, a Addr, err error) {
+	now := time.Now()
+	s.mu.Lock()
+	st.Polling = false
+	if err == nil {
+		st.Next = st.Next.Add(st.Interval)
+		if st.Next.Before(now) {
+			st.Next = now
+		}
+		st.Last, st.Failures, st.Err = now, 0, nil
+	} else {
+		st.Failures++
+		st.Err = err
+		st.Next = now.Add(s.backoff(st))
+	}
+	s.mu.Unlock()
+	s.signal()
+	if f := s.opts.Polled; f != nil {
+		f(a, err)
+	}
+}
+
+// backoff returns how long st is left alone, having failed.
+func (s *Scheduler) backoff(st *PollStatus) time.Duration {
+	max := s.opts.MaxBackoff
+	if st.Interval > max {
+		max = st.Interval
+	}
+	d := s.opts.Backoff
+	for i := 1; i < st.Failures && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
@@ -0,0 +1,85 @@
+package gatt
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// pollDevice connects to all the peripherals but those failing, recording
+// the order of the connections.
+type pollDevice struct {
+	Device
+
+	mu    sync.Mutex
+	order []string
+	fail  map[string]bool
+}
+
+type pollConn struct{ Conn }
+
+func (pollConn) Close() error { return nil }
+
+func (d *pollDevice) Connect(ctx context.Context, addr Addr, opts ConnectOptions) (Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.order = append(d.order, addr.String())
+	if d.fail[addr.String()] {
+		return nil, errors.New("connection timed out")
+	}
+	return pollConn{}, nil
+}
+
+func TestScheduler(t *testing.T) {
+	addr := func(b byte) Addr { return PublicAddr(BDAddr{net.HardwareAddr{1, 2, 3, 4, 5, b}}) }
+	d := &pollDevice{fail: map[string]bool{addr(3).String(): true}}
+	var synced int
+	s, err := NewScheduler(d, SchedulerOptions{
+		Backoff:    40 * time.Millisecond,
+		MaxBackoff: 80 * time.Millisecond,
+		Sync: func(ctx context.Context, c Conn) error {
+			synced++ // a single slot: serialized
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(PollTarget{Addr: addr(1), Interval: 0}); err == nil {
+		t.Error("Add of a zero Interval succeeded")
+	}
+	s.Add(PollTarget{Addr: addr(1), Interval: 20 * time.Millisecond})
+	s.Add(PollTarget{Addr: addr(2), Interval: 20 * time.Millisecond, Priority: 1})
+	s.Add(PollTarget{Addr: addr(3), Interval: 20 * time.Millisecond, Priority: 2})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	if err := s.Run(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Run() = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.order) < 3 || d.order[0] != addr(3).String() || d.order[1] != addr(2).String() || d.order[2] != addr(1).String() {
+		t.Fatalf("polled %v, want by priority first", d.order)
+	}
+	polls := make(map[string]int)
+	for _, a := range d.order {
+		polls[a]++
+	}
+	// Every 20 ms for 300 ms; the failing one after 40, 80, 80... ms.
+	if polls[addr(1).String()] < 5 || polls[addr(3).String()] > 6 {
+		t.Errorf("polls %v, want the failing target backed off", polls)
+	}
+	if synced != len(d.order)-polls[addr(3).String()] {
+		t.Errorf("synced %d times, want %d", synced, len(d.order)-polls[addr(3).String()])
+	}
+	for _, st := range s.Status() {
+		if failing := st.Addr.same(addr(3)); failing != (st.Err != nil) || failing != (st.Failures > 0) {
+			t.Errorf("%s: %d failures, error %v", st.Addr, st.Failures, st.Err)
+		}
+	}
+}
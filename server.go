@@ -1,8 +1,11 @@
 package gatt
 
 import (
+	"context"
 	"errors"
 	"net"
+	"sync"
+	"time"
 )
 
 // MaxEIRPacketLength is the maximum allowed AdvertisingPacket
@@ -19,25 +22,61 @@ var ErrEIRPacketTooLong = errors.New("max packet length is 31")
 type Server struct {
 	name           string
 	hci            string
+	accept         func(a Addr) bool
 	connect        func(c Conn)
 	disconnect     func(c Conn)
 	receiveRSSI    func(c Conn, rssi int)
 	closed         func(error)
 	stateChange    func(newState string)
 	maxConnections int
+	maxMTU         int
+	layoutPath     string
+	connPolicy     *ConnPolicy
+	lossWarning    func(c Conn, silent time.Duration)
+	lossPercent    int
+
+	appearance      uint16
+	preferredParams ConnParams
+	dbChanged       bool     // since the centrals may have discovered it
+	gap             *Service // the default Generic Access service, if served
 
 	advertiseServices  []UUID
 	advertisingPacket  []byte
 	scanResponsePacket []byte
 	manufacturerData   []byte
+	extendedAdv        bool // the lengths of the packets are checked by the HCI
 
 	addr     BDAddr
 	services []*Service
 	handles  *handleRange
 	serving  bool
 	quit     chan struct{}
+	stopped  chan struct{} // closed once the HCI is closed
 	inited   chan struct{}
 	err      error
+	stats    func() ConnStats
+	span     func(op string) (end func(err error))
+
+	alignNotify bool
+
+	traceATT    func(format string, v ...interface{})
+	traceRedact func(u UUID) bool
+	recordATT   func(c Conn, sent bool, pdu []byte)
+	phyUpdate   func(c Conn, tx, rx PHY)
+
+	requestLimit   RateLimit
+	signalingLimit RateLimit
+
+	attHandlers map[byte]ATTHandler // by opcode
+
+	keyStore KeyStore
+	peers    *PeerRegistry
+
+	subsmu      sync.Mutex
+	connSubs    []connSub
+	pairingSubs []pairingSub
+
+	handlerErrors func(err error)
 
 	adv advertiser
 }
@@ -46,13 +85,21 @@ type Server struct {
 // See also Server.Options.
 // See http://dave.cheney.net/2014/10/17/functional-options-for-friendly-apis for more discussion.
 func NewServer(opts ...option) *Server {
-	s := &Server{maxConnections: 1, inited: make(chan struct{})}
+	s := &Server{maxConnections: 1, maxMTU: defaultMaxMTU, appearance: AppearanceGenericComputer, inited: make(chan struct{})}
 	for _, opt := range opts {
 		opt(s)
 	}
 	return s
 }
 
+// Stats returns the traffic statistics of all the connections together.
+func (s *Server) Stats() ConnStats {
+	if s.stats == nil {
+		return ConnStats{}
+	}
+	return s.stats()
+}
+
 // AddService registers a new Service with the server.
 // All services must be added before starting the server.
 func (s *Server) AddService(u UUID) *Service {
@@ -87,6 +134,9 @@ func (s *Server) AdvertiseAndServe() error {
 	if s.serving {
 		return errors.New("a server is already running")
 	}
+	if err := s.validate(); err != nil {
+		return err
+	}
 	if err := s.start(); err != nil {
 		return err
 	}
@@ -102,6 +152,9 @@ func (s *Server) Serve() error {
 	if s.serving {
 		return errors.New("a server is already running")
 	}
+	if err := s.validate(); err != nil {
+		return err
+	}
 	if err := s.start(); err != nil {
 		return err
 	}
@@ -116,11 +169,25 @@ func (s *Server) setServices() error {
 	if s.serving {
 		return errors.New("cannot set services while serving")
 	}
-	s.handles = generateHandles(s.name, s.services, uint16(1)) // ble handles start at 1
-	return nil
+	svcs := append(s.defaultServices(), s.services...)
+	if s.layoutPath == "" {
+		s.handles = generateHandles(svcs, uint16(1)) // ble handles start at 1
+		s.dbChanged = true                           // as far as the server can tell
+		return nil
+	}
+	l, err := loadHandleLayout(s.layoutPath, 1)
+	if err != nil {
+		return err
+	}
+	s.handles = l.generateHandles(svcs)
+	hash, found := l.m[dbHashKey]
+	s.dbChanged = !found || hash != dbHash(s.handles)
+	l.m[dbHashKey] = dbHash(s.handles)
+	return l.save(s.layoutPath)
 }
 
-// Close stops a Server.
+// Close stops a Server. It returns once the device, and its connections,
+// have been closed.
 func (s *Server) Close() error {
 	if !s.serving {
 		return errors.New("not serving")
@@ -128,6 +195,9 @@ func (s *Server) Close() error {
 	s.adv.Stop()
 	s.serving = false
 	close(s.quit)
+	if s.stopped != nil {
+		<-s.stopped
+	}
 	return nil
 }
 
@@ -181,6 +251,23 @@ func Connect(f func(c Conn)) option {
 	}
 }
 
+// AcceptConn sets a function deciding whether a central connecting to
+// the server is accepted, e.g. by an allow-list of addresses, or a rate
+// limit. It is called with the address of the central as soon as the
+// connection is established, before any of its requests is served; a
+// connection it rejects, or panics on, is disconnected right away, and
+// is reported neither to Connect nor to Disconnect. It is called from
+// the goroutine accepting the connections, and must return promptly.
+// If nil, the default, every central is accepted.
+// See also Server.NewServer and Server.Option.
+func AcceptConn(f func(a Addr) bool) option {
+	return func(s *Server) option {
+		prev := s.accept
+		s.accept = f
+		return AcceptConn(prev)
+	}
+}
+
 // Disconnect sets a function to be called when a device disconnects from the server.
 // See also Server.NewServer and Server.Option.
 func Disconnect(f func(c Conn)) option {
@@ -191,7 +278,8 @@ func Disconnect(f func(c Conn)) option {
 	}
 }
 
-// ReceiveRSSI sets a function to be called when an RSSI measurement is received for a connection.
+// ReceiveRSSI sets a function to be called when an RSSI measurement is received for a connection,
+// as read by its UpdateRSSI method.
 // See also Server.NewServer and Server.Option.
 func ReceiveRSSI(f func(c Conn, rssi int)) option {
 	return func(s *Server) option {
@@ -237,12 +325,66 @@ func MaxConnections(n int) option {
 	}
 }
 
+// MaxMTU sets the largest ATT MTU accepted from centrals, from 23 to
+// 517 bytes. The default is 256.
+// See also Server.NewServer.
+// MaxMTU cannot be used with Server.Option.
+func MaxMTU(n int) option {
+	return func(s *Server) option {
+		prev := s.maxMTU
+		s.maxMTU = n
+		return MaxMTU(prev)
+	}
+}
+
+// HandleLayout sets the path of a file that records the handles assigned
+// to the services and characteristics, so that they keep their handles
+// across restarts, even as services and characteristics are added or
+// removed. The file is created if it does not exist, and updated as the
+// server starts.
+// See also Server.NewServer.
+// HandleLayout cannot be used with Server.Option.
+func HandleLayout(path string) option {
+	return func(s *Server) option {
+		prev := s.layoutPath
+		s.layoutPath = path
+		return HandleLayout(prev)
+	}
+}
+
+// Spans sets a function called as each ATT request and HCI command
+// starts; the function it returns is called once it completes, with the
+// error it failed with, if any. It lets the server be traced, e.g. with
+// OpenTelemetry:
+//
+//	gatt.Spans(func(op string) func(error) {
+//		_, span := tracer.Start(ctx, op)
+//		return func(err error) {
+//			if err != nil {
+//				span.RecordError(err)
+//			}
+//			span.End()
+//		}
+//	})
+//
+// The spans of HCI commands are named after the command, and the
+// correlation ID the lines of the HCI log carry, e.g. "hci: Reset #1".
+// See also Server.NewServer.
+// Spans cannot be used with Server.Option.
+func Spans(f func(op string) (end func(err error))) option {
+	return func(s *Server) option {
+		prev := s.span
+		s.span = f
+		return Spans(prev)
+	}
+}
+
 // AdvertisingPacket sets a custom advertising packet.
 // If nil, the advertising data will constructed to advertise
 // as many services as possible. The AdvertisingPacket must be no
-// longer than MaxAdvertisingPacketLength.
+// longer than MaxEIRPacketLength.
 // If ManufacturerData is also set, their total length must be no
-// longer than MaxAdvertisingPacketLength.
+// longer than MaxEIRPacketLength.
 // See also Server.NewServer and Server.Option.
 func AdvertisingPacket(b []byte) option {
 	return func(s *Server) option {
@@ -268,7 +410,7 @@ func AdvertiseServices(u []UUID) option {
 // ScanResponsePacket sets a custom scan response packet.
 // If nil, the scan response packet will set to return the server
 // name, truncated if necessary. The ScanResponsePacket must be no
-// longer than MaxAdvertisingPacketLength.
+// longer than MaxEIRPacketLength.
 // See also Server.NewServer and Server.Option.
 func ScanResponsePacket(b []byte) option {
 	return func(s *Server) option {
@@ -282,7 +424,7 @@ func ScanResponsePacket(b []byte) option {
 // ManufacturerData sets custom manufacturer data.
 // If set, it will be appended to the advertising data.
 // The combined length of the AdvertisingPacket and ManufacturerData
-// must be no longer than MaxAdvertisingPacketLength.
+// must be no longer than MaxEIRPacketLength.
 // See also Server.NewServer and Server.Option.
 func ManufacturerData(b []byte) option {
 	return func(s *Server) option {
@@ -306,19 +448,99 @@ type Conn interface {
 	// LocalAddr returns the address of the connected device (central).
 	LocalAddr() BDAddr
 
-	// LocalAddr returns the address of the local device (peripheral).
-	RemoteAddr() BDAddr
+	// RemoteAddr returns the address of the peer device, with its type.
+	RemoteAddr() Addr
 
 	// Close disconnects the connection.
 	Close() error
 
-	// RSSI returns the last RSSI measurement, or -1 if there have not been any.
+	// RSSI returns the last RSSI measurement, in dBm, as read by
+	// UpdateRSSI, or -1 if there have not been any.
 	RSSI() int
 
-	// UpdateRSSI requests an RSSI update and blocks until one has been received.
-	// TODO: Implement.
+	// UpdateRSSI reads the RSSI the peer is currently received with, in
+	// dBm, from the controller, and blocks until it is read. The
+	// measurement is also delivered to the ReceiveRSSI function of the
+	// server, if any. It fails with ErrNoRSSI if the controller has not
+	// measured any yet.
 	UpdateRSSI() (rssi int, err error)
 
 	// MTU returns the current connection mtu.
 	MTU() int
+
+	// Channels returns the channel selection algorithm of the connection,
+	// and reads its current channel map, for RF debugging.
+	Channels() (ConnChannels, error)
+
+	// Params returns the current parameters of the connection, or zero
+	// values if the platform does not report them.
+	Params() ConnParams
+
+	// SetClass switches the connection to a class of the ConnPolicy of
+	// the server, whose parameters are then negotiated. It returns
+	// immediately; failures to negotiate them are reported to the
+	// HandlerErrors function.
+	SetClass(class string) error
+
+	// Wake switches an idle connection back to the parameters of its
+	// class, ahead of a burst of traffic, and returns once they are in
+	// place, or their negotiation failed, or ctx is done. See the
+	// IdleAfter field of ConnPolicy.
+	Wake(ctx context.Context) error
+
+	// PHY reads the PHYs the connection transmits, and receives, on.
+	PHY() (tx, rx PHY, err error)
+
+	// SetPHY requests the connection to switch to the PHYs tx and rx,
+	// e.g. PHY2M for throughput, or PHYCoded for range, which the peer
+	// may refuse. It returns once the request is taken; the PHYUpdate
+	// function of the server is called as the PHYs change.
+	SetPHY(tx, rx PHY) error
+}
+
+// ConnChannels are the data channels a connection hops over.
+type ConnChannels struct {
+	// Algorithm is the channel selection algorithm: 1, or 2 for that of
+	// Bluetooth 5, which spreads the traffic more evenly over the
+	// channels.
+	Algorithm int
+
+	// Map has bit n set if the data channel n, from 0 to 36, is used.
+	Map uint64
+}
+
+// A StatsReporter reports the traffic statistics of a connection, as the
+// Conns of the platforms counting them do:
+//
+//	if r, ok := c.(gatt.StatsReporter); ok {
+//		log.Print(r.Stats())
+//	}
+type StatsReporter interface {
+	Stats() ConnStats
+}
+
+// ConnStats are the traffic statistics of a connection, as counted
+// at the L2CAP layer.
+type ConnStats struct {
+	TxBytes   uint64
+	TxPackets uint64
+	RxBytes   uint64
+	RxPackets uint64
+
+	// Rolling throughput, in bytes per second.
+	TxRate float64
+	RxRate float64
+
+	// QueueWait is the average time an outgoing packet waits for a free
+	// controller buffer.
+	QueueWait time.Duration
+
+	// Latency is the average time from an outgoing packet being queued to
+	// the controller reporting it completed. It is a rough estimate of the
+	// round trip over the link, and grows as the link degrades.
+	Latency time.Duration
+
+	// Malformed is the number of incoming PDUs dropped as malformed,
+	// e.g. fragments not adding up to the length of their PDU.
+	Malformed uint64
 }
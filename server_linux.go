@@ -1,9 +1,9 @@
 package gatt
 
 import (
+	"context"
 	"errors"
 	"log"
-	"net"
 	"time"
 
 	"github.com/paypal/gatt/linux"
@@ -17,6 +17,8 @@ type advertiser interface {
 	Stop() error
 	AdvertiseService() error
 	Option(...linux.Option) linux.Option
+	Rotate(ctx context.Context, ps []linux.AdvPayload, period, jitter time.Duration) error
+	Schedule(ctx context.Context, slots []linux.AdvSlot, f func(r linux.AdvSlotReport)) error
 }
 
 // setDefaultAdvertisement builds advertisement data from the
@@ -27,16 +29,23 @@ func (s *Server) setDefaultAdvertisement() error {
 		linux.AdvertisingIntervalMin(0x00f4),
 		linux.AdvertisingChannelMap(0x7),
 	}
-	if len(s.advertisingPacket) == 0 {
+	ad, sr := s.advertisingPacket, s.scanResponsePacket
+	if len(ad) == 0 {
 		u := []UUID{}
 		for _, svc := range s.services {
 			u = append(u, svc.uuid)
 		}
-		ad, _ := serviceAdvertisingPacket(u)
+		ad, _ = serviceAdvertisingPacket(u)
 		opts = append(opts, linux.AdvertisingPacket(ad))
 	}
-	if len(s.scanResponsePacket) == 0 {
-		opts = append(opts, linux.ScanResponsePacket(nameScanResponsePacket(s.name)))
+	if len(sr) == 0 {
+		sr = nameScanResponsePacket(s.name)
+		opts = append(opts, linux.ScanResponsePacket(sr))
+	}
+	if !s.extendedAdv {
+		if err := checkAdvertising(ad, sr, s.manufacturerData); err != nil {
+			return err
+		}
 	}
 	s.adv.Option(opts...)
 	return s.adv.AdvertiseService()
@@ -71,34 +80,48 @@ func (s *Server) setManufacturerData(b []byte) {
 func (s *Server) start() error {
 	var logger *log.Logger
 	h := linux.NewHCI(logger, s.maxConnections)
-	a := linux.NewAdvertiser(h.Cmd())
+	a := h.NewAdvertiser()
 	l := h.L2CAP()
 	l.Adv = a
+	l.ManageParams = s.paramsPolicy() != nil
+	if s.span != nil {
+		h.SetSpanHook(s.span)
+	}
 
 	if err := s.setServices(); err != nil {
 		return err
 	}
 
 	s.quit = make(chan struct{})
+	s.stopped = make(chan struct{})
 	s.adv = a
+	s.stats = func() ConnStats { return ConnStats(l.Stats()) }
 
 	go func() {
 		for {
 			select {
 			case l2c := <-l.ConnC():
-				remoteAddr := BDAddr{net.HardwareAddr(l2c.Param.PeerAddress[:])}
+				remoteAddr := addrOf(l2c.Param.PeerAddress, l2c.Param.PeerAddressType)
+				if !s.accepts(remoteAddr) {
+					l2c.Close()
+					continue
+				}
 				c := newConn(s, l2c, remoteAddr)
+				c.stats = func() ConnStats { return ConnStats(l2c.Stats()) }
+				c.channels = channelsOf(l2c)
+				c.readRSSI = rssiOf(l2c)
+				c.pair = pairOf(h.Pair, l2c, remoteAddr)
+				c.managePHY(l2c)
+				c.limitSignaling(l2c)
+				c.manageParams(l2c, l2c.Param.Role == 0x00)
 				go func() {
-					if s.connect != nil {
-						s.connect(c)
-					}
+					s.connected(c)
 					c.loop()
-					if s.disconnect != nil {
-						s.disconnect(c)
-					}
+					s.disconnected(c)
 				}()
 			case <-s.quit:
 				h.Close()
+				close(s.stopped)
 				if s.closed != nil {
 					s.closed(s.err)
 				}
@@ -115,9 +138,17 @@ func (s *Server) start() error {
 			s.err = errors.New("device does not respond")
 			s.Close()
 		})
-		for _ = range time.Tick(time.Second * 10) {
-			h.Cmd().SendAndCheckResp(cmd.LEReadBufferSize{}, []byte{0x00})
-			t.Reset(time.Second * 30)
+		defer t.Stop()
+		tick := time.NewTicker(time.Second * 10)
+		defer tick.Stop()
+		for {
+			select {
+			case <-tick.C:
+				h.Cmd().SendAndCheckResp(cmd.LEReadBufferSize{}, []byte{0x00})
+				t.Reset(time.Second * 30)
+			case <-s.quit:
+				return
+			}
 		}
 	}()
 	return s.setDefaultAdvertisement()
@@ -14,7 +14,7 @@ type Service struct {
 func (s *Service) AddCharacteristic(u UUID) *Characteristic {
 	// TODO: write test for this panic
 	for _, char := range s.chars {
-		if uuidEqual(char.uuid, u) {
+		if char.uuid.Equal(u) {
 			panic("service already contains a characteristic with uuid " + u.String())
 		}
 	}
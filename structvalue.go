@@ -0,0 +1,73 @@
+package gatt
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/paypal/gatt/value"
+)
+
+// ReadStruct returns a ReadHandler serving the struct get returns, or a
+// pointer to one, encoded by value.Marshal, as its tags tell: e.g.
+//
+//	type config struct {
+//		Interval uint16
+//		Limit    uint32 `value:"24,be"`
+//	}
+//	c.HandleRead(gatt.ReadStruct(func(r gatt.Request) interface{} { return cfg }))
+//
+// Values that cannot be encoded are answered with StatusUnexpectedError.
+func ReadStruct(get func(r Request) interface{}) ReadHandler {
+	return ReadHandlerFunc(func(resp ReadResponseWriter, req *ReadRequest) {
+		b, err := value.Marshal(get(req.Request))
+		switch {
+		case err != nil:
+			resp.SetStatus(StatusUnexpectedError)
+		case req.Offset > len(b):
+			resp.SetStatus(StatusInvalidOffset)
+		default:
+			b = b[req.Offset:]
+			if len(b) > req.Cap {
+				b = b[:req.Cap]
+			}
+			resp.Write(b)
+		}
+	})
+}
+
+// WriteStruct returns a WriteHandler decoding each value written, by
+// value.Unmarshal, into a new struct of the type v points to, and calling
+// set with a pointer to it. Values that do not fit the struct are
+// rejected with an Invalid Attribute Value Length error, before set is
+// called. It panics if the struct cannot be laid out.
+func WriteStruct(v interface{}, set func(r Request, v interface{}) (status byte)) WriteHandler {
+	t := reflect.TypeOf(v)
+	if t == nil || t.Kind() != reflect.Ptr {
+		panic(fmt.Sprintf("gatt: WriteStruct of a non-pointer %T", v))
+	}
+	if _, err := value.Marshal(reflect.New(t.Elem()).Interface()); err != nil {
+		panic(err)
+	}
+	return WriteHandlerFunc(func(r Request, data []byte) byte {
+		p := reflect.New(t.Elem()).Interface()
+		if err := value.Unmarshal(data, p); err != nil {
+			return attEcodeInvalAttrValueLen
+		}
+		return set(r, p)
+	})
+}
+
+// ReadStruct reads the value of the attribute of handle h, and decodes it
+// into the struct v points to, by value.Unmarshal. Values that do not fit
+// the struct fail with an error matching value.ErrMalformed.
+func (cl *Client) ReadStruct(ctx context.Context, h uint16, v interface{}) error {
+	b, err := cl.Read(ctx, h)
+	if err != nil {
+		return err
+	}
+	if err := value.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("gatt: attribute 0x%04X: %w", h, err)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package gatt
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestStructHandlers(t *testing.T) {
+	type config struct {
+		Interval uint16
+		Limit    uint32 `value:"24,be"`
+	}
+	cfg := config{Interval: 0x0102, Limit: 0x030405}
+	rh := ReadStruct(func(r Request) interface{} { return &cfg })
+	for _, tt := range []struct {
+		offset, cap int
+		want        []byte
+		status      byte
+	}{
+		{0, 22, []byte{0x02, 0x01, 0x03, 0x04, 0x05}, StatusSuccess},
+		{2, 2, []byte{0x03, 0x04}, StatusSuccess},
+		{6, 22, nil, StatusInvalidOffset},
+	} {
+		resp := newReadResponseWriter(tt.cap)
+		rh.ServeRead(resp, &ReadRequest{Cap: tt.cap, Offset: tt.offset})
+		if !bytes.Equal(resp.bytes(), tt.want) || resp.status != tt.status {
+			t.Errorf("read at %d, of up to %d: got % X, status 0x%02X, want % X, 0x%02X",
+				tt.offset, tt.cap, resp.bytes(), resp.status, tt.want, tt.status)
+		}
+	}
+
+	wh := WriteStruct(new(config), func(r Request, v interface{}) byte {
+		cfg = *v.(*config)
+		return StatusSuccess
+	})
+	if s := wh.ServeWrite(Request{}, []byte{0x10, 0x00, 0x00, 0x00, 0x20}); s != StatusSuccess || cfg != (config{0x10, 0x20}) {
+		t.Errorf("write: got status 0x%02X, %+v", s, cfg)
+	}
+	if s := wh.ServeWrite(Request{}, []byte{0x10}); s != attEcodeInvalAttrValueLen || cfg != (config{0x10, 0x20}) {
+		t.Errorf("write of a byte: got status 0x%02X, %+v", s, cfg)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("WriteStruct of a map: did not panic")
+		}
+	}()
+	WriteStruct(new(map[int]int), nil)
+}
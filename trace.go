@@ -0,0 +1,345 @@
+package gatt
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// TraceATT sets a function, such as log.Printf, to which the ATT PDUs
+// exchanged with the centrals are logged, decoded: the requests received,
+// the responses, notifications and indications sent, and the
+// confirmations received, with their opcodes, handles, the UUIDs of the
+// attributes, and values, e.g.
+//
+//	att <- 01:02:03:04:05:06 (public): Read Request handle=0x0003 (2a00)
+//	att -> 01:02:03:04:05:06 (public): Read Response value=67 61 74 74 "gatt"
+//
+// The values of the attributes, characteristics or descriptors, whose UUID
+// redact reports true for, if not nil, are left out, e.g. those of
+// passwords or keys. The PDUs of the device as the client are not traced.
+//
+// It is meant for diagnosing interoperability issues with the centrals;
+// decoding every PDU slows the server down.
+// See also Server.NewServer.
+// TraceATT cannot be used with Server.Option.
+func TraceATT(logf func(format string, v ...interface{}), redact func(u UUID) bool) option {
+	return func(s *Server) option {
+		prev, prevRedact := s.traceATT, s.traceRedact
+		s.traceATT, s.traceRedact = logf, redact
+		return TraceATT(prev, prevRedact)
+	}
+}
+
+// attOpNames are the names of the ATT opcodes, as traced.
+var attOpNames = map[byte]string{
+	attOpError:           "Error Response",
+	attOpMtuReq:          "Exchange MTU Request",
+	attOpMtuResp:         "Exchange MTU Response",
+	attOpFindInfoReq:     "Find Information Request",
+	attOpFindInfoResp:    "Find Information Response",
+	attOpFindByTypeReq:   "Find By Type Value Request",
+	attOpFindByTypeResp:  "Find By Type Value Response",
+	attOpReadByTypeReq:   "Read By Type Request",
+	attOpReadByTypeResp:  "Read By Type Response",
+	attOpReadReq:         "Read Request",
+	attOpReadResp:        "Read Response",
+	attOpReadBlobReq:     "Read Blob Request",
+	attOpReadBlobResp:    "Read Blob Response",
+	attOpReadMultiReq:    "Read Multiple Request",
+	attOpReadMultiResp:   "Read Multiple Response",
+	attOpReadByGroupReq:  "Read By Group Type Request",
+	attOpReadByGroupResp: "Read By Group Type Response",
+	attOpWriteReq:        "Write Request",
+	attOpWriteResp:       "Write Response",
+	attOpWriteCmd:        "Write Command",
+	attOpPrepWriteReq:    "Prepare Write Request",
+	attOpPrepWriteResp:   "Prepare Write Response",
+	attOpExecWriteReq:    "Execute Write Request",
+	attOpExecWriteResp:   "Execute Write Response",
+	attOpHandleNotify:    "Handle Value Notification",
+	attOpHandleInd:       "Handle Value Indication",
+	attOpHandleCnf:       "Handle Value Confirmation",
+	attOpSignedWriteCmd:  "Signed Write Command",
+}
+
+// attEcodeNames are the names of the ATT error codes, as traced.
+var attEcodeNames = map[byte]string{
+	attEcodeInvalidHandle:     "Invalid Handle",
+	attEcodeReadNotPerm:       "Read Not Permitted",
+	attEcodeWriteNotPerm:      "Write Not Permitted",
+	attEcodeInvalidPDU:        "Invalid PDU",
+	attEcodeAuthentication:    "Insufficient Authentication",
+	attEcodeReqNotSupp:        "Request Not Supported",
+	attEcodeInvalidOffset:     "Invalid Offset",
+	attEcodeAuthorization:     "Insufficient Authorization",
+	attEcodePrepQueueFull:     "Prepare Queue Full",
+	attEcodeAttrNotFound:      "Attribute Not Found",
+	attEcodeAttrNotLong:       "Attribute Not Long",
+	attEcodeInsuffEncrKeySize: "Insufficient Encryption Key Size",
+	attEcodeInvalAttrValueLen: "Invalid Attribute Value Length",
+	attEcodeUnlikely:          "Unlikely Error",
+	attEcodeInsuffEnc:         "Insufficient Encryption",
+	attEcodeUnsuppGrpType:     "Unsupported Group Type",
+	attEcodeInsuffResources:   "Insufficient Resources",
+}
+
+// traceATT logs the PDU b, received from the central if in, or sent to
+// it, if the server traces them; req is the request b responds to, if
+// any.
+func (c *conn) traceATT(in bool, b, req []byte) {
+	s := c.server
+	if s.traceATT == nil || len(b) == 0 {
+		return
+	}
+	dir := "->"
+	if in {
+		dir = "<-"
+	}
+	pdu := s.decodeATT(b, req)
+	s.call("trace att", func() { s.traceATT("att %s %v: %s", dir, c.remoteAddr, pdu) })
+}
+
+// decodeATT returns the PDU b decoded, for humans; req is the request b
+// responds to, if any, which tells the attribute the value of a Read
+// Response is that of. Those of the PDUs that are malformed, as those
+// received may be, are dumped as they are.
+func (s *Server) decodeATT(b, req []byte) string {
+	d := attDecoder{s: s}
+	op, p := b[0], b[1:]
+	if name, ok := attOpNames[op]; ok {
+		d.WriteString(name)
+	} else {
+		fmt.Fprintf(&d, "Opcode 0x%02X", op)
+	}
+	if !d.decode(op, p, req) {
+		d.Reset()
+		fmt.Fprintf(&d, "%s, malformed: % X", attOpNames[op], b)
+	}
+	return d.String()
+}
+
+// An attDecoder writes the decoded parameters of a PDU.
+type attDecoder struct {
+	strings.Builder
+	s *Server
+}
+
+// decode writes the parameters p of a PDU of opcode op, and reports
+// whether they are well formed.
+func (d *attDecoder) decode(op byte, p, req []byte) bool {
+	switch op {
+	case attOpError:
+		if len(p) != 4 {
+			return false
+		}
+		name, ok := attOpNames[p[0]]
+		if !ok {
+			name = fmt.Sprintf("0x%02X", p[0])
+		}
+		fmt.Fprintf(d, " request=%q handle=", name)
+		d.handle(p[1:])
+		fmt.Fprintf(d, " error=0x%02X", p[3])
+		if name, ok := attEcodeNames[p[3]]; ok {
+			fmt.Fprintf(d, " (%s)", name)
+		}
+	case attOpMtuReq, attOpMtuResp:
+		if len(p) != 2 {
+			return false
+		}
+		fmt.Fprintf(d, " mtu=%d", binary.LittleEndian.Uint16(p))
+	case attOpFindInfoReq:
+		if len(p) != 4 {
+			return false
+		}
+		d.handles(p)
+	case attOpFindByTypeReq:
+		if len(p) < 6 {
+			return false
+		}
+		d.handles(p)
+		fmt.Fprintf(d, " type=%v value=", uuidFromLE(p[4:6]))
+		d.value(p[6:], false)
+	case attOpReadByTypeReq, attOpReadByGroupReq:
+		if len(p) != 4+2 && len(p) != 4+16 {
+			return false
+		}
+		d.handles(p)
+		fmt.Fprintf(d, " type=%v", uuidFromLE(p[4:]))
+	case attOpFindInfoResp:
+		if len(p) < 1 || p[0] != 0x01 && p[0] != 0x02 {
+			return false
+		}
+		n := 2 + 2
+		if p[0] == 0x02 {
+			n = 2 + 16
+		}
+		return d.list(p[1:], n, func(e []byte) {
+			fmt.Fprintf(d, " 0x%04X=%v", binary.LittleEndian.Uint16(e), uuidFromLE(e[2:]))
+		})
+	case attOpFindByTypeResp:
+		return d.list(p, 4, func(e []byte) { d.handles(e) })
+	case attOpReadByTypeResp:
+		if len(p) < 1 || p[0] < 2 {
+			return false
+		}
+		return d.list(p[1:], int(p[0]), func(e []byte) {
+			d.WriteByte(' ')
+			d.handle(e)
+			d.WriteString(" value=")
+			d.value(e[2:], d.redacts(e))
+		})
+	case attOpReadByGroupResp:
+		if len(p) < 1 || p[0] != 4+2 && p[0] != 4+16 {
+			return false
+		}
+		return d.list(p[1:], int(p[0]), func(e []byte) {
+			d.handles(e)
+			fmt.Fprintf(d, " uuid=%v", uuidFromLE(e[4:]))
+		})
+	case attOpReadReq:
+		if len(p) != 2 {
+			return false
+		}
+		d.WriteString(" handle=")
+		d.handle(p)
+	case attOpReadBlobReq:
+		if len(p) != 4 {
+			return false
+		}
+		d.WriteString(" handle=")
+		d.handle(p)
+		fmt.Fprintf(d, " offset=%d", binary.LittleEndian.Uint16(p[2:]))
+	case attOpReadResp, attOpReadBlobResp:
+		// Left out if the attribute read is unknown.
+		redact := d.s.traceRedact != nil
+		if len(req) >= 3 {
+			redact = d.redacts(req[1:])
+		}
+		d.WriteString(" value=")
+		d.value(p, redact)
+	case attOpReadMultiReq:
+		if len(p) < 4 || len(p)%2 != 0 {
+			return false
+		}
+		return d.list(p, 2, func(e []byte) {
+			d.WriteByte(' ')
+			d.handle(e)
+		})
+	case attOpReadMultiResp:
+		redact := d.s.traceRedact != nil && len(req) < 1+4
+		for i := 1; i+2 <= len(req); i += 2 {
+			redact = redact || d.redacts(req[i:])
+		}
+		d.WriteString(" values=")
+		d.value(p, redact)
+	case attOpWriteReq, attOpWriteCmd, attOpHandleNotify, attOpHandleInd:
+		if len(p) < 2 {
+			return false
+		}
+		d.WriteString(" handle=")
+		d.handle(p)
+		d.WriteString(" value=")
+		d.value(p[2:], d.redacts(p))
+	case attOpSignedWriteCmd:
+		if len(p) < 2+12 {
+			return false
+		}
+		d.WriteString(" handle=")
+		d.handle(p)
+		d.WriteString(" value=")
+		d.value(p[2:len(p)-12], d.redacts(p))
+		fmt.Fprintf(d, " signature=% X", p[len(p)-12:])
+	case attOpPrepWriteReq, attOpPrepWriteResp:
+		if len(p) < 4 {
+			return false
+		}
+		d.WriteString(" handle=")
+		d.handle(p)
+		fmt.Fprintf(d, " offset=%d value=", binary.LittleEndian.Uint16(p[2:]))
+		d.value(p[4:], d.redacts(p))
+	case attOpExecWriteReq:
+		if len(p) != 1 {
+			return false
+		}
+		fmt.Fprintf(d, " flags=0x%02X", p[0])
+	case attOpWriteResp, attOpExecWriteResp, attOpHandleCnf:
+		return len(p) == 0
+	default:
+		if len(p) > 0 {
+			fmt.Fprintf(d, " % X", p)
+		}
+	}
+	return true
+}
+
+// handle writes the handle starting b, with the UUID of its attribute,
+// if any.
+func (d *attDecoder) handle(b []byte) {
+	n := binary.LittleEndian.Uint16(b)
+	fmt.Fprintf(d, "0x%04X", n)
+	if d.s.handles == nil {
+		return
+	}
+	if h, ok := d.s.handles.At(n); ok && h.uuid.Len() > 0 {
+		fmt.Fprintf(d, " (%v)", h.uuid)
+	}
+}
+
+// handles writes the handle range starting b.
+func (d *attDecoder) handles(b []byte) {
+	start, end := readHandleRange(b)
+	fmt.Fprintf(d, " handles=0x%04X-0x%04X", start, end)
+}
+
+// list writes the entries of n bytes of b, with f, and reports whether b
+// holds a whole number of them, at least one.
+func (d *attDecoder) list(b []byte, n int, f func(e []byte)) bool {
+	if n == 0 || len(b) == 0 || len(b)%n != 0 {
+		return false
+	}
+	for ; len(b) > 0; b = b[n:] {
+		f(b[:n])
+	}
+	return true
+}
+
+// value writes v, in hex, and quoted if it is printable text, unless
+// redact is set.
+func (d *attDecoder) value(v []byte, redact bool) {
+	if redact {
+		fmt.Fprintf(d, "<redacted, %d bytes>", len(v))
+		return
+	}
+	fmt.Fprintf(d, "% X", v)
+	if len(v) > 0 && printable(v) {
+		fmt.Fprintf(d, " %q", v)
+	}
+}
+
+// printable reports whether b is printable ASCII text.
+func printable(b []byte) bool {
+	for _, c := range b {
+		if c < 0x20 || c > 0x7E {
+			return false
+		}
+	}
+	return true
+}
+
+// redacts reports whether the value of the attribute of the handle
+// starting b is to be left out of the traces; it is, if the redact
+// function of the server panics.
+func (d *attDecoder) redacts(b []byte) bool {
+	s := d.s
+	if s.traceRedact == nil || s.handles == nil {
+		return false
+	}
+	h, ok := s.handles.At(binary.LittleEndian.Uint16(b))
+	if !ok {
+		return false
+	}
+	redact := true
+	s.call("trace redact", func() { redact = s.traceRedact(h.uuid) })
+	return redact
+}
@@ -0,0 +1,85 @@
+package gatt
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTraceATT(t *testing.T) {
+	secret := MustParseUUID("16fe0d80-c111-11e3-b8c8-0002a5d5c51b")
+	var lines []string
+	srv := NewServer(Name("gatt"), TraceATT(
+		func(format string, v ...interface{}) { lines = append(lines, fmt.Sprintf(format, v...)) },
+		func(u UUID) bool { return u.Equal(secret) },
+	))
+	svc := srv.AddService(MustParseUUID("09fc95c0-c111-11e3-9904-0002a5d5c51b"))
+	svc.AddCharacteristic(secret).HandleReadFunc(func(resp ReadResponseWriter, req *ReadRequest) {
+		resp.Write([]byte("hunter2"))
+	})
+	srv.setServices()
+	c := newConn(srv, discardConn{}, Addr{})
+	defer c.close()
+
+	// The handle of the value of the Device Name, and that of secret.
+	var name, value uint16
+	for _, h := range srv.handles.hh {
+		if h.typ == typCharacteristicValue && h.uuid.Equal(gattAttrDeviceNameUUID) {
+			name = h.n
+		}
+		if h.typ == typCharacteristicValue && h.uuid.Equal(secret) {
+			value = h.n
+		}
+	}
+	for _, tt := range []struct {
+		req  []byte
+		want []string
+	}{
+		{
+			[]byte{attOpMtuReq, 0x17, 0x00},
+			[]string{"<- : Exchange MTU Request mtu=23", "-> : Exchange MTU Response mtu=23"},
+		},
+		{
+			[]byte{attOpReadReq, byte(name), byte(name >> 8)},
+			[]string{
+				fmt.Sprintf("<- : Read Request handle=0x%04X (2a00)", name),
+				`-> : Read Response value=67 61 74 74 "gatt"`,
+			},
+		},
+		{
+			[]byte{attOpReadReq, byte(value), byte(value >> 8)},
+			[]string{
+				fmt.Sprintf("<- : Read Request handle=0x%04X (%v)", value, secret),
+				"-> : Read Response value=<redacted, 7 bytes>",
+			},
+		},
+		{
+			[]byte{attOpReadByTypeReq, 0x01, 0x00, 0xFF, 0xFF, 0x00, 0x2A},
+			[]string{
+				"<- : Read By Type Request handles=0x0001-0xFFFF type=2a00",
+				fmt.Sprintf(`-> : Read By Type Response 0x%04X (2a00) value=67 61 74 74 "gatt"`, name),
+			},
+		},
+		{
+			[]byte{attOpWriteReq, byte(value), byte(value >> 8), 'p', 'w'},
+			[]string{
+				fmt.Sprintf("<- : Write Request handle=0x%04X (%v) value=<redacted, 2 bytes>", value, secret),
+				fmt.Sprintf(`-> : Error Response request="Write Request" handle=0x%04X (%v) error=0x03 (Write Not Permitted)`, value, secret),
+			},
+		},
+		{
+			[]byte{attOpReadReq, 0x01},
+			[]string{"<- : Read Request, malformed: 0A 01", `-> : Error Response request="Read Request" handle=0x0000 error=0x04 (Invalid PDU)`},
+		},
+	} {
+		lines = nil
+		c.serveReq(tt.req)
+		for i := range lines {
+			lines[i] = strings.Replace(lines[i], "att ", "", 1)
+			lines[i] = strings.Replace(lines[i], Addr{}.String(), "", 1)
+		}
+		if got := strings.Join(lines, "\n"); got != strings.Join(tt.want, "\n") {
+			t.Errorf("% X traced:\n%s\nwant:\n%s", tt.req, got, strings.Join(tt.want, "\n"))
+		}
+	}
+}
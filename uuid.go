@@ -24,14 +24,24 @@ func UUID16(i uint16) UUID {
 
 // ParseUUID parses a standard-format UUID string, such
 // as "1800" or "34DA3AD1-7110-41A1-B1EF-4430F509CDE7".
+// The dashes of a 128-bit UUID are optional, but if present,
+// they must be in their canonical positions.
 func ParseUUID(s string) (UUID, error) {
-	s = strings.Replace(s, "-", "", -1)
+	in := s
+	if len(s) == 36 {
+		for i, c := range s {
+			if (i == 8 || i == 13 || i == 18 || i == 23) != (c == '-') {
+				return UUID{}, fmt.Errorf("invalid UUID %q: dashes must be at positions 8, 13, 18 and 23", s)
+			}
+		}
+		s = strings.Replace(s, "-", "", -1)
+	}
 	b, err := hex.DecodeString(s)
 	if err != nil {
-		return UUID{}, err
+		return UUID{}, fmt.Errorf("invalid UUID %q: %v", in, err)
 	}
 	if err := lenErr(len(b)); err != nil {
-		return UUID{}, err
+		return UUID{}, fmt.Errorf("invalid UUID %q: %v", in, err)
 	}
 	return UUID{b}, nil
 }
@@ -52,7 +62,7 @@ func lenErr(n int) error {
 	case 2, 16:
 		return nil
 	}
-	return fmt.Errorf("UUIDs must have length 2 or 16, got %d", n)
+	return fmt.Errorf("UUIDs must have length 2 or 16 bytes (4 or 32 hex digits), got %d", n)
 }
 
 // Len returns the length of the UUID, in bytes.
@@ -61,9 +71,53 @@ func (u UUID) Len() int {
 	return len(u.b)
 }
 
-// String hex-encodes a UUID.
+// String returns the canonical form of a UUID: 4 lowercase hex digits
+// for a 16-bit UUID, and 32, grouped by dashes as 8-4-4-4-12, for a
+// 128-bit one.
 func (u UUID) String() string {
-	return fmt.Sprintf("%x", u.b)
+	if u.Len() != 16 {
+		return fmt.Sprintf("%x", u.b)
+	}
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u.b[:4], u.b[4:6], u.b[6:8], u.b[8:10], u.b[10:])
+}
+
+// baseUUID is the Bluetooth Base UUID, 00000000-0000-1000-8000-00805F9B34FB,
+// which 16-bit UUIDs are shorthands for: the 16 bits replace bytes 2 and 3.
+var baseUUID = []byte{
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x10, 0x00,
+	0x80, 0x00, 0x00, 0x80, 0x5F, 0x9B, 0x34, 0xFB,
+}
+
+// Is16Bit reports whether u is a 16-bit UUID, or a 128-bit one derived
+// from the Bluetooth Base UUID, which may be shortened to 16 bits.
+func (u UUID) Is16Bit() bool {
+	switch u.Len() {
+	case 2:
+		return true
+	case 16:
+		return bytes.Equal(u.b[:2], baseUUID[:2]) && bytes.Equal(u.b[4:], baseUUID[4:])
+	}
+	return false
+}
+
+// short returns u, shortened to 16 bits if possible.
+func (u UUID) short() UUID {
+	if u.Len() == 16 && u.Is16Bit() {
+		return UUID{u.b[2:4]}
+	}
+	return u
+}
+
+// Equal reports whether u and v are the same UUID. A 16-bit UUID
+// equals its 128-bit form.
+func (u UUID) Equal(v UUID) bool {
+	return bytes.Equal(u.short().b, v.short().b)
+}
+
+// uuidFromLE returns the UUID of b, a UUID in the little-endian order
+// of the wire.
+func uuidFromLE(b []byte) UUID {
+	return UUID{reverse(b)}
 }
 
 // reverseBytes returns a reversed copy of u's bytes.
@@ -75,15 +129,11 @@ func (u UUID) reverseBytes() []byte {
 	return reverse(u.b)
 }
 
-func uuidEqual(u, v UUID) bool {
-	return bytes.Equal(u.b, v.b)
-}
-
 // reverse returns a reversed copy of u.
 func reverse(u []byte) []byte {
 	l := len(u)
 	b := make([]byte, l)
-	for i := 0; i < l/2+1; i++ {
+	for i := 0; i < (l+1)/2; i++ {
 		b[i], b[l-i-1] = u[l-i-1], u[i]
 	}
 	return b
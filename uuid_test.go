@@ -6,7 +6,7 @@ import (
 )
 
 func TestUUID16(t *testing.T) {
-	if want, got := (UUID{[]byte{0x18, 0x00}}), UUID16(0x1800); !uuidEqual(want, got) {
+	if want, got := (UUID{[]byte{0x18, 0x00}}), UUID16(0x1800); !want.Equal(got) {
 		t.Errorf("UUID16: got %x, want %x", got, want)
 	}
 }
@@ -52,3 +52,54 @@ func BenchmarkReverseBytes128(b *testing.B) {
 		u.reverseBytes()
 	}
 }
+
+func TestParseUUID(t *testing.T) {
+	cases := []struct {
+		s    string
+		want string // canonical form; empty if s is invalid
+	}{
+		{s: "1800", want: "1800"},
+		{s: "2A00", want: "2a00"},
+		{s: "34DA3AD1-7110-41A1-B1EF-4430F509CDE7", want: "34da3ad1-7110-41a1-b1ef-4430f509cde7"},
+		{s: "34da3ad1711041a1b1ef4430f509cde7", want: "34da3ad1-7110-41a1-b1ef-4430f509cde7"},
+		{s: ""},
+		{s: "180"},
+		{s: "18-00"},
+		{s: "180g"},
+		{s: "34DA3AD17-110-41A1-B1EF-4430F509CDE7"},
+		{s: "34da3ad1711041a1b1ef4430f509cd"},
+	}
+	for _, tt := range cases {
+		u, err := ParseUUID(tt.s)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("ParseUUID(%q): got %v, want error", tt.s, u)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseUUID(%q): %v", tt.s, err)
+			continue
+		}
+		if got := u.String(); got != tt.want {
+			t.Errorf("ParseUUID(%q).String(): got %q, want %q", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestUUIDEqual(t *testing.T) {
+	long := MustParseUUID("0000180d-0000-1000-8000-00805f9b34fb")
+	if !long.Is16Bit() {
+		t.Errorf("%v.Is16Bit(): got false, want true", long)
+	}
+	if !UUID16(0x180D).Equal(long) || !long.Equal(UUID16(0x180D)) {
+		t.Errorf("%v and its 128-bit form are not equal", UUID16(0x180D))
+	}
+	if UUID16(0x180E).Equal(long) {
+		t.Errorf("%v equals %v", UUID16(0x180E), long)
+	}
+	other := MustParseUUID("34DA3AD1-7110-41A1-B1EF-4430F509CDE7")
+	if other.Is16Bit() {
+		t.Errorf("%v.Is16Bit(): got true, want false", other)
+	}
+}
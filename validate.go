@@ -0,0 +1,87 @@
+package gatt
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/paypal/gatt/internal/param"
+)
+
+// ErrInvalidParameter is returned when an option, or a field of the
+// options of a call, is out of its legal range. It is reported as the
+// API is called, rather than left for the controller to reject with an
+// opaque status. The linux package reports its parameters with it too.
+type ErrInvalidParameter = param.ErrInvalid
+
+// checkRange returns an ErrInvalidParameter if v is out of [min, max].
+func checkRange(name string, v, min, max int) error {
+	if err := param.CheckRange(name, v, min, max); err != nil {
+		return invalid(err)
+	}
+	return nil
+}
+
+// checkDuration returns an ErrInvalidParameter if d is out of
+// [min, max].
+func checkDuration(param string, d, min, max time.Duration) error {
+	if d < min || d > max {
+		return invalid(ErrInvalidParameter{Param: param, Value: d, Min: min, Max: max})
+	}
+	return nil
+}
+
+// invalid wraps the ErrInvalidParameter err with the prefix of gatt.
+func invalid(err error) error { return fmt.Errorf("gatt: %w", err) }
+
+// Legal range of the ATT MTU, and the largest one accepted by default.
+const (
+	minMTU        = 23
+	maxMTU        = 517
+	defaultMaxMTU = 256
+)
+
+// checkAdvertising checks the lengths of the advertising packet, with
+// the manufacturer data appended, and of the scan response packet.
+func checkAdvertising(adv, scanRsp, mfr []byte) error {
+	if err := checkRange("len(AdvertisingPacket)", len(adv), 0, MaxEIRPacketLength); err != nil {
+		return err
+	}
+	if err := checkRange("len(AdvertisingPacket)+len(ManufacturerData)", len(adv)+len(mfr), 0, MaxEIRPacketLength); err != nil {
+		return err
+	}
+	return checkRange("len(ScanResponsePacket)", len(scanRsp), 0, MaxEIRPacketLength)
+}
+
+// validate checks the options of the server, before it starts.
+func (s *Server) validate() error {
+	if err := checkRange("MaxConnections", s.maxConnections, 1, 0xEFF); err != nil {
+		return err
+	}
+	if err := checkRange("MaxMTU", s.maxMTU, minMTU, maxMTU); err != nil {
+		return err
+	}
+	if s.preferredParams != (ConnParams{}) {
+		if err := s.preferredParams.check("PreferredConnParams"); err != nil {
+			return err
+		}
+	}
+	if s.connPolicy != nil {
+		if err := s.connPolicy.check(); err != nil {
+			return err
+		}
+	}
+	if s.lossPercent != 0 {
+		if err := checkRange("LinkLossWarning percent", s.lossPercent, 1, 99); err != nil {
+			return err
+		}
+	}
+	for _, u := range s.advertiseServices {
+		if err := lenErr(u.Len()); err != nil {
+			return fmt.Errorf("gatt: AdvertiseServices: %v", err)
+		}
+	}
+	if err := s.checkATTHandlers(); err != nil {
+		return err
+	}
+	return checkAdvertising(s.advertisingPacket, s.scanResponsePacket, s.manufacturerData)
+}
@@ -0,0 +1,50 @@
+package gatt
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	long := make([]byte, MaxEIRPacketLength+1)
+	cases := []struct {
+		name  string
+		err   error
+		param string // of the ErrInvalidParameter; empty if valid
+	}{
+		{"server", NewServer().validate(), ""},
+		{"max connections", NewServer(MaxConnections(0)).validate(), "MaxConnections"},
+		{"max MTU", NewServer(MaxMTU(600)).validate(), "MaxMTU"},
+		{"advertising packet", NewServer(AdvertisingPacket(long)).validate(), "len(AdvertisingPacket)"},
+		{"manufacturer data", NewServer(AdvertisingPacket(long[:20]), ManufacturerData(long[:20])).validate(), "len(AdvertisingPacket)+len(ManufacturerData)"},
+		{"scan response", AdvertiseOptions{ScanResponsePacket: long}.check(), "len(ScanResponsePacket)"},
+		{"schedule", AdvertiseOptions{Schedule: []AdvSlot{{AdvPayload: AdvPayload{AdvertisingPacket: long}}}}.check(), "len(AdvertisingPacket)"},
+		{"connect", ConnectOptions{IntervalMin: 10 * time.Millisecond, SupervisionTimeout: time.Second}.check(), ""},
+		{"interval", ConnectOptions{IntervalMax: 5 * time.Second}.check(), "IntervalMax"},
+		{"latency", ConnectOptions{Latency: 500}.check(), "Latency"},
+		{"supervision timeout", ConnectOptions{SupervisionTimeout: 50 * time.Millisecond}.check(), "SupervisionTimeout"},
+	}
+	for _, tt := range cases {
+		var e ErrInvalidParameter
+		switch {
+		case tt.param == "" && tt.err != nil:
+			t.Errorf("%s: %v", tt.name, tt.err)
+		case tt.param != "" && !errors.As(tt.err, &e):
+			t.Errorf("%s: got %v, want ErrInvalidParameter", tt.name, tt.err)
+		case tt.param != "" && e.Param != tt.param:
+			t.Errorf("%s: got %v, want an error of %s", tt.name, tt.err, tt.param)
+		case tt.param != "" && !strings.HasPrefix(tt.err.Error(), "gatt: "+tt.param+" = "):
+			t.Errorf("%s: got %q, want it prefixed with %q", tt.name, tt.err, "gatt: ")
+		}
+	}
+
+	if err := (AdvertiseOptions{AdvertiseServices: []UUID{{}}}).check(); err == nil {
+		t.Error("AdvertiseOptions with an empty UUID: got no error")
+	}
+	both := AdvertiseOptions{Rotation: []AdvPayload{{}}, Schedule: []AdvSlot{{Duration: time.Second}}}
+	if err := both.check(); err == nil {
+		t.Error("AdvertiseOptions with a Rotation and a Schedule: got no error")
+	}
+}
@@ -0,0 +1,32 @@
+// Package value encodes and decodes the values of characteristics in the
+// formats of the GATT Specification Supplement: the IEEE-11073 SFLOAT and
+// FLOAT numbers of the medical devices, 24-bit integers, UTF-8 strings,
+// the Date Time, Heart Rate Measurement and Battery Level
+// characteristics, and the structs of custom profiles.
+//
+// Servers encode the values they are read, or notify:
+//
+//	m := value.HeartRateMeasurement{BPM: 72, RRIntervals: []time.Duration{830 * time.Millisecond}}
+//	b, err := m.MarshalBinary()
+//	n.Write(b)
+//
+// and clients decode those they read, or are notified of:
+//
+//	var m value.HeartRateMeasurement
+//	err := m.UnmarshalBinary(b)
+//
+// The values of custom profiles are laid out as Go structs, whose tags
+// tell the widths and byte order of their fields, by Marshal and
+// Unmarshal:
+//
+//	type Reading struct {
+//		Counter uint32  `value:"24"`
+//		Temp    float64 `value:"sfloat"`
+//	}
+//
+// Values that cannot be decoded, as those of a peer may be, are reported
+// with an error matching ErrMalformed, and those that cannot be encoded
+// with one matching ErrRange.
+//
+// This package is work in progress. We expect the APIs to change.
+package value
@@ -0,0 +1,188 @@
+package value
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// A DateTime is the value of the Date Time characteristic (0x2A08). Its
+// year, month and day are unknown if zero.
+type DateTime struct {
+	Year                 int // 1582 to 9999
+	Month                time.Month
+	Day                  int
+	Hour, Minute, Second int
+}
+
+// DateTimeOf returns the DateTime of t, in its location.
+func DateTimeOf(t time.Time) DateTime {
+	return DateTime{t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second()}
+}
+
+// Time returns the time d is, in loc, and reports whether its date is
+// known.
+func (d DateTime) Time(loc *time.Location) (time.Time, bool) {
+	if d.Year == 0 || d.Month == 0 || d.Day == 0 {
+		return time.Time{}, false
+	}
+	return time.Date(d.Year, d.Month, d.Day, d.Hour, d.Minute, d.Second, 0, loc), true
+}
+
+// valid reports whether the fields of d are in their ranges.
+func (d DateTime) valid() bool {
+	return (d.Year == 0 || 1582 <= d.Year && d.Year <= 9999) &&
+		0 <= d.Month && d.Month <= 12 && 0 <= d.Day && d.Day <= 31 &&
+		0 <= d.Hour && d.Hour <= 23 && 0 <= d.Minute && d.Minute <= 59 && 0 <= d.Second && d.Second <= 59
+}
+
+// MarshalBinary encodes d, in 7 bytes.
+func (d DateTime) MarshalBinary() ([]byte, error) {
+	if !d.valid() {
+		return nil, fmt.Errorf("%w: date time %+v", ErrRange, d)
+	}
+	return []byte{
+		byte(d.Year), byte(d.Year >> 8), byte(d.Month), byte(d.Day),
+		byte(d.Hour), byte(d.Minute), byte(d.Second),
+	}, nil
+}
+
+// UnmarshalBinary decodes b into d.
+func (d *DateTime) UnmarshalBinary(b []byte) error {
+	if len(b) != 7 {
+		return fmt.Errorf("%w: date time of %d bytes", ErrMalformed, len(b))
+	}
+	v := DateTime{
+		int(binary.LittleEndian.Uint16(b)), time.Month(b[2]), int(b[3]),
+		int(b[4]), int(b[5]), int(b[6]),
+	}
+	if !v.valid() {
+		return fmt.Errorf("%w: date time % X", ErrMalformed, b)
+	}
+	*d = v
+	return nil
+}
+
+// A HeartRateMeasurement is the value of the Heart Rate Measurement
+// characteristic (0x2A37), of the Heart Rate service.
+type HeartRateMeasurement struct {
+	BPM int // in beats per minute, up to 65535
+
+	// SensorContact tells whether the sensor detects its contact with
+	// the skin, and ContactDetected whether it does.
+	SensorContact, ContactDetected bool
+
+	// EnergyExpended, in kilojoules since it was last reset, is sent if
+	// HasEnergyExpended is set.
+	EnergyExpended    int
+	HasEnergyExpended bool
+
+	// RRIntervals are the intervals between the last beats, of a
+	// resolution of 1/1024 s, up to 64 s.
+	RRIntervals []time.Duration
+}
+
+// Flags of the Heart Rate Measurement.
+const (
+	hrmUint16         = 1 << 0
+	hrmContactDetect  = 1 << 1
+	hrmContactSupport = 1 << 2
+	hrmEnergyExpended = 1 << 3
+	hrmRRIntervals    = 1 << 4
+)
+
+// rrUnit is the unit of the RR-intervals.
+const rrUnit = time.Second / 1024
+
+// MarshalBinary encodes m: its heart rate in a single byte, if it fits.
+func (m HeartRateMeasurement) MarshalBinary() ([]byte, error) {
+	if m.BPM < 0 || m.BPM > 0xFFFF {
+		return nil, fmt.Errorf("%w: heart rate of %d bpm", ErrRange, m.BPM)
+	}
+	b := []byte{0}
+	if m.BPM > 0xFF {
+		b[0] |= hrmUint16
+		b = append(b, byte(m.BPM), byte(m.BPM>>8))
+	} else {
+		b = append(b, byte(m.BPM))
+	}
+	if m.SensorContact {
+		b[0] |= hrmContactSupport
+		if m.ContactDetected {
+			b[0] |= hrmContactDetect
+		}
+	}
+	if m.HasEnergyExpended {
+		if m.EnergyExpended < 0 || m.EnergyExpended > 0xFFFF {
+			return nil, fmt.Errorf("%w: energy expended of %d kJ", ErrRange, m.EnergyExpended)
+		}
+		b[0] |= hrmEnergyExpended
+		b = append(b, byte(m.EnergyExpended), byte(m.EnergyExpended>>8))
+	}
+	if len(m.RRIntervals) > 0 {
+		b[0] |= hrmRRIntervals
+	}
+	for _, rr := range m.RRIntervals {
+		n := (rr + rrUnit/2) / rrUnit
+		if n < 0 || n > 0xFFFF {
+			return nil, fmt.Errorf("%w: RR-interval of %v", ErrRange, rr)
+		}
+		b = append(b, byte(n), byte(n>>8))
+	}
+	return b, nil
+}
+
+// UnmarshalBinary decodes b into m.
+func (m *HeartRateMeasurement) UnmarshalBinary(b []byte) error {
+	malformed := fmt.Errorf("%w: heart rate measurement % X", ErrMalformed, b)
+	if len(b) < 2 {
+		return malformed
+	}
+	flags := b[0]
+	var v HeartRateMeasurement
+	if flags&hrmUint16 != 0 {
+		if len(b) < 3 {
+			return malformed
+		}
+		v.BPM, b = int(binary.LittleEndian.Uint16(b[1:])), b[3:]
+	} else {
+		v.BPM, b = int(b[1]), b[2:]
+	}
+	v.SensorContact = flags&hrmContactSupport != 0
+	v.ContactDetected = v.SensorContact && flags&hrmContactDetect != 0
+	if flags&hrmEnergyExpended != 0 {
+		if len(b) < 2 {
+			return malformed
+		}
+		v.EnergyExpended, v.HasEnergyExpended, b = int(binary.LittleEndian.Uint16(b)), true, b[2:]
+	}
+	if flags&hrmRRIntervals == 0 && len(b) > 0 || len(b)%2 != 0 {
+		return malformed
+	}
+	for ; len(b) > 0; b = b[2:] {
+		v.RRIntervals = append(v.RRIntervals, time.Duration(binary.LittleEndian.Uint16(b))*rrUnit)
+	}
+	*m = v
+	return nil
+}
+
+// A BatteryLevel is the value of the Battery Level characteristic
+// (0x2A19), of the Battery service: the charge left, in percent.
+type BatteryLevel uint8
+
+// MarshalBinary encodes l, in a byte.
+func (l BatteryLevel) MarshalBinary() ([]byte, error) {
+	if l > 100 {
+		return nil, fmt.Errorf("%w: battery level of %d%%", ErrRange, l)
+	}
+	return []byte{byte(l)}, nil
+}
+
+// UnmarshalBinary decodes b into l.
+func (l *BatteryLevel) UnmarshalBinary(b []byte) error {
+	if len(b) != 1 || b[0] > 100 {
+		return fmt.Errorf("%w: battery level % X", ErrMalformed, b)
+	}
+	*l = BatteryLevel(b[0])
+	return nil
+}
@@ -0,0 +1,328 @@
+package value
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Marshal encodes v, a struct, or a pointer to one, as the value of a
+// characteristic of a custom profile: its exported fields, in order, with
+// no padding, as their tags tell. Those of nested structs are laid out in
+// place. Without a tag, integers take the width of their type, and are
+// little-endian, as GATT values are; bools take a byte, floats are
+// IEEE-754, and arrays of bytes are laid out as they are. Strings, UTF-8,
+// and byte slices span the rest of the value, and must come last.
+//
+// The tag of a field, under the key "value", is a list of options,
+// separated by commas:
+//
+//	be      big-endian, rather than little-endian
+//	8...64  the width of an integer, in bits, a multiple of 8
+//	sfloat  a float as an IEEE-11073 SFLOAT, of 16 bits
+//	float   a float as an IEEE-11073 FLOAT, of 32 bits
+//	-       the field is left out
+//
+// e.g.
+//
+//	type Reading struct {
+//		Flags   uint8
+//		Counter uint32  `value:"24"`
+//		Temp    float64 `value:"sfloat"`
+//		Label   string
+//	}
+//
+// Values that the width of their field cannot hold fail with ErrRange;
+// types that cannot be laid out with an error matching neither.
+func Marshal(v interface{}) ([]byte, error) {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	fs, err := layoutOf(rv.Type())
+	if err != nil {
+		return nil, err
+	}
+	var b []byte
+	for _, f := range fs {
+		if b, err = f.append(b, rv.FieldByIndex(f.index)); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// Unmarshal decodes b, laid out as Marshal lays out the struct v points
+// to, into it. Values that are too short, or too long, for the struct,
+// or that hold invalid UTF-8 strings, fail with ErrMalformed.
+func Unmarshal(b []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("value: Unmarshal of a non-pointer %T", v)
+	}
+	rv = rv.Elem()
+	fs, err := layoutOf(rv.Type())
+	if err != nil {
+		return err
+	}
+	in := b
+	for _, f := range fs {
+		n := f.size
+		if n == 0 {
+			n = len(b)
+		}
+		if len(b) < n {
+			return fmt.Errorf("%w: %d bytes for %v", ErrMalformed, len(in), rv.Type())
+		}
+		if err := f.decode(b[:n], rv.FieldByIndex(f.index)); err != nil {
+			return err
+		}
+		b = b[n:]
+	}
+	if len(b) > 0 {
+		return fmt.Errorf("%w: %d bytes for %v", ErrMalformed, len(in), rv.Type())
+	}
+	return nil
+}
+
+// A field is one of the fields of a struct, as laid out.
+type field struct {
+	index []int
+	name  string
+	kind  fieldKind
+	size  int // in bytes; 0 for the rest of the value
+	be    bool
+}
+
+type fieldKind int
+
+const (
+	kindUint fieldKind = iota
+	kindInt
+	kindBool
+	kindIEEE
+	kindSFloat
+	kindFloat
+	kindBytes  // an array of bytes, or a slice spanning the rest
+	kindString // spanning the rest
+)
+
+// layouts caches the fields of the struct types laid out, or the error
+// laying them out failed with.
+var layouts sync.Map
+
+type layout struct {
+	fields []field
+	err    error
+}
+
+// layoutOf returns the fields of the struct type t, flattened.
+func layoutOf(t reflect.Type) ([]field, error) {
+	if l, ok := layouts.Load(t); ok {
+		return l.(layout).fields, l.(layout).err
+	}
+	var fs []field
+	err := fieldsOf(t, nil, &fs)
+	for i, f := range fs {
+		if err == nil && f.size == 0 && i < len(fs)-1 {
+			err = fmt.Errorf("value: %v.%s spans the rest of the value, but is not last", t, f.name)
+		}
+	}
+	layouts.Store(t, layout{fs, err})
+	return fs, err
+}
+
+// fieldsOf appends the fields of t, a struct type nested at index, to
+// fs.
+func fieldsOf(t reflect.Type, index []int, fs *[]field) error {
+	if t.Kind() != reflect.Struct {
+		return fmt.Errorf("value: %v is not a struct", t)
+	}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("value")
+		if sf.PkgPath != "" || tag == "-" {
+			continue
+		}
+		idx := append(append([]int(nil), index...), i)
+		if sf.Type.Kind() == reflect.Struct {
+			if err := fieldsOf(sf.Type, idx, fs); err != nil {
+				return err
+			}
+			continue
+		}
+		f, err := fieldOf(sf, tag)
+		if err != nil {
+			return fmt.Errorf("value: %v.%s: %v", t, sf.Name, err)
+		}
+		f.index = idx
+		*fs = append(*fs, f)
+	}
+	return nil
+}
+
+// fieldOf returns the field of sf, of tag tag.
+func fieldOf(sf reflect.StructField, tag string) (field, error) {
+	f := field{name: sf.Name}
+	t := sf.Type
+	switch t.Kind() {
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uint:
+		f.kind, f.size = kindUint, int(t.Size())
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Int:
+		f.kind, f.size = kindInt, int(t.Size())
+	case reflect.Bool:
+		f.kind, f.size = kindBool, 1
+	case reflect.Float32, reflect.Float64:
+		f.kind, f.size = kindIEEE, int(t.Size())
+	case reflect.String:
+		f.kind = kindString
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() != reflect.Uint8 {
+			return f, fmt.Errorf("%v is neither of bytes, nor a struct", t)
+		}
+		f.kind = kindBytes
+		if t.Kind() == reflect.Array {
+			f.size = t.Len()
+		}
+	default:
+		return f, fmt.Errorf("%v cannot be laid out", t)
+	}
+	if tag == "" {
+		return f, nil
+	}
+	for _, opt := range strings.Split(tag, ",") {
+		switch {
+		case opt == "be":
+			f.be = true
+		case opt == "sfloat" && f.kind == kindIEEE:
+			f.kind, f.size = kindSFloat, 2
+		case opt == "float" && f.kind == kindIEEE:
+			f.kind, f.size = kindFloat, 4
+		default:
+			bits, err := strconv.Atoi(opt)
+			if err != nil || f.kind != kindUint && f.kind != kindInt && f.kind != kindBool {
+				return f, fmt.Errorf("option %q does not apply to %v", opt, t)
+			}
+			if bits%8 != 0 || bits < 8 || bits > 64 {
+				return f, fmt.Errorf("width of %d bits, not a multiple of 8, up to 64", bits)
+			}
+			f.size = bits / 8
+		}
+	}
+	return f, nil
+}
+
+// append appends v, of the field, to b.
+func (f field) append(b []byte, v reflect.Value) ([]byte, error) {
+	var n uint64
+	switch f.kind {
+	case kindUint:
+		n = v.Uint()
+		if f.size < 8 && n >= 1<<(8*f.size) {
+			return b, fmt.Errorf("%w: %s = %d, of %d bits", ErrRange, f.name, n, 8*f.size)
+		}
+	case kindInt:
+		i := v.Int()
+		if bits := 8 * f.size; f.size < 8 && (i < -1<<(bits-1) || i >= 1<<(bits-1)) {
+			return b, fmt.Errorf("%w: %s = %d, of %d bits", ErrRange, f.name, i, bits)
+		}
+		n = uint64(i)
+	case kindBool:
+		if v.Bool() {
+			n = 1
+		}
+	case kindIEEE:
+		if f.size == 4 {
+			n = uint64(math.Float32bits(float32(v.Float())))
+		} else {
+			n = math.Float64bits(v.Float())
+		}
+	case kindSFloat:
+		return AppendSFloat(b, v.Float())
+	case kindFloat:
+		return AppendFloat(b, v.Float())
+	case kindBytes:
+		if v.Kind() == reflect.Array {
+			return append(b, bytesOf(v)...), nil
+		}
+		return append(b, v.Bytes()...), nil
+	case kindString:
+		return append(b, v.String()...), nil
+	}
+	return f.appendUint(b, n), nil
+}
+
+// appendUint appends the f.size low bytes of n to b, in the byte order of
+// the field.
+func (f field) appendUint(b []byte, n uint64) []byte {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], n)
+	p := buf[:f.size]
+	if f.be {
+		for i := len(p) - 1; i >= 0; i-- {
+			b = append(b, p[i])
+		}
+		return b
+	}
+	return append(b, p...)
+}
+
+// decode decodes b, of the size of the field, into v.
+func (f field) decode(b []byte, v reflect.Value) error {
+	var n uint64
+	for i := range b {
+		if f.be {
+			n = n<<8 | uint64(b[i])
+		} else {
+			n |= uint64(b[i]) << (8 * i)
+		}
+	}
+	switch f.kind {
+	case kindUint:
+		v.SetUint(n)
+	case kindInt:
+		shift := 64 - 8*uint(f.size)
+		v.SetInt(int64(n<<shift) >> shift)
+	case kindBool:
+		v.SetBool(n != 0)
+	case kindIEEE:
+		if f.size == 4 {
+			v.SetFloat(float64(math.Float32frombits(uint32(n))))
+		} else {
+			v.SetFloat(math.Float64frombits(n))
+		}
+	case kindSFloat:
+		x, err := SFloat(b)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(x)
+	case kindFloat:
+		x, err := Float(b)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(x)
+	case kindBytes:
+		if v.Kind() == reflect.Array {
+			reflect.Copy(v, reflect.ValueOf(b))
+		} else {
+			v.SetBytes(append([]byte(nil), b...))
+		}
+	case kindString:
+		if !utf8.Valid(b) {
+			return fmt.Errorf("%w: %s, invalid UTF-8 string %q", ErrMalformed, f.name, b)
+		}
+		v.SetString(string(b))
+	}
+	return nil
+}
+
+// bytesOf returns the bytes of v, an array of bytes.
+func bytesOf(v reflect.Value) []byte {
+	b := make([]byte, v.Len())
+	reflect.Copy(reflect.ValueOf(b), v)
+	return b
+}
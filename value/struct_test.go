@@ -0,0 +1,76 @@
+package value
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type reading struct {
+	Flags   uint8
+	Counter uint32  `value:"24"`
+	Delta   int16   `value:"be"`
+	Temp    float64 `value:"sfloat"`
+	Pos     struct{ X, Y int8 }
+	ID      [2]byte
+	On      bool
+	skipped int
+	Ignored int `value:"-"`
+	Label   string
+}
+
+func TestStruct(t *testing.T) {
+	r := reading{Flags: 0x80, Counter: 0x123456, Delta: -2, Temp: 36.6, ID: [2]byte{0xAB, 0xCD}, On: true, Label: "gatt"}
+	r.Pos.X, r.Pos.Y = -1, 2
+	b, err := Marshal(&r)
+	want := []byte{0x80, 0x56, 0x34, 0x12, 0xFF, 0xFE, 0x6E, 0xF1, 0xFF, 0x02, 0xAB, 0xCD, 0x01, 'g', 'a', 't', 't'}
+	if err != nil || !bytes.Equal(b, want) {
+		t.Fatalf("Marshal(%+v) = % X, %v, want % X", r, b, err, want)
+	}
+	var got reading
+	if err := Unmarshal(b, &got); err != nil || !reflect.DeepEqual(got, r) {
+		t.Errorf("Unmarshal(% X) = %+v, %v, want %+v", b, got, err, r)
+	}
+
+	// Signed integers narrower than their type are sign-extended.
+	var n struct {
+		V int32 `value:"24"`
+	}
+	if err := Unmarshal([]byte{0xFE, 0xFF, 0xFF}, &n); err != nil || n.V != -2 {
+		t.Errorf("Unmarshal of a 24-bit -2 = %d, %v", n.V, err)
+	}
+	n.V = 1 << 23
+	if _, err := Marshal(n); !errors.Is(err, ErrRange) {
+		t.Errorf("Marshal of 1<<23 in 24 bits: got %v, want ErrRange", err)
+	}
+
+	for _, b := range [][]byte{want[:5], append(want[:13:13], 0xC3)} {
+		if err := Unmarshal(b, &got); !errors.Is(err, ErrMalformed) {
+			t.Errorf("Unmarshal(% X): got %v, want ErrMalformed", b, err)
+		}
+	}
+	var fixed struct{ A, B uint16 }
+	if err := Unmarshal([]byte{1, 0, 2, 0, 3}, &fixed); !errors.Is(err, ErrMalformed) {
+		t.Errorf("Unmarshal of a byte too many: got %v, want ErrMalformed", err)
+	}
+
+	for _, v := range []interface{}{
+		struct{ S, T string }{},
+		struct{ M map[int]int }{},
+		struct {
+			F float32 `value:"12"`
+		}{},
+		struct {
+			U uint8 `value:"12"`
+		}{},
+		42,
+	} {
+		if _, err := Marshal(v); err == nil || errors.Is(err, ErrRange) || errors.Is(err, ErrMalformed) {
+			t.Errorf("Marshal(%T): got %v, want an error of layout", v, err)
+		}
+	}
+	if err := Unmarshal(want, got); err == nil {
+		t.Error("Unmarshal into a non-pointer: got no error")
+	}
+}
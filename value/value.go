@@ -0,0 +1,159 @@
+package value
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	// ErrMalformed is returned for values that cannot be decoded, e.g. of
+	// the wrong length.
+	ErrMalformed = errors.New("value: malformed")
+
+	// ErrRange is returned for values that the format cannot hold.
+	ErrRange = errors.New("value: out of range")
+)
+
+// SFloat decodes b, an IEEE-11073 16-bit SFLOAT: a mantissa of 12 bits,
+// and an exponent, of base 10, of 4 bits. NaN, NRes (not at this
+// resolution) and the reserved values decode as NaN; the infinities as
+// such.
+func SFloat(b []byte) (float64, error) {
+	if len(b) != 2 {
+		return 0, fmt.Errorf("%w: SFLOAT of %d bytes", ErrMalformed, len(b))
+	}
+	return decodeFloat(uint32(b[0])|uint32(b[1])<<8, 12, 4), nil
+}
+
+// AppendSFloat appends v, as an SFLOAT, to b, with the most precise
+// exponent that holds it; NaN and the infinities are encoded as such.
+// It fails with ErrRange if v is too large, in magnitude.
+func AppendSFloat(b []byte, v float64) ([]byte, error) {
+	n, ok := encodeFloat(v, 12, 4)
+	if !ok {
+		return b, fmt.Errorf("%w: SFLOAT of %v", ErrRange, v)
+	}
+	return append(b, byte(n), byte(n>>8)), nil
+}
+
+// Float decodes b, an IEEE-11073 32-bit FLOAT: a mantissa of 24 bits,
+// and an exponent, of base 10, of 8 bits. The special values decode as
+// those of SFloat.
+func Float(b []byte) (float64, error) {
+	if len(b) != 4 {
+		return 0, fmt.Errorf("%w: FLOAT of %d bytes", ErrMalformed, len(b))
+	}
+	return decodeFloat(uint32(b[0])|uint32(b[1])<<8|uint32(b[2])<<16|uint32(b[3])<<24, 24, 8), nil
+}
+
+// AppendFloat appends v, as a FLOAT, to b. See AppendSFloat.
+func AppendFloat(b []byte, v float64) ([]byte, error) {
+	n, ok := encodeFloat(v, 24, 8)
+	if !ok {
+		return b, fmt.Errorf("%w: FLOAT of %v", ErrRange, v)
+	}
+	return append(b, byte(n), byte(n>>8), byte(n>>16), byte(n>>24)), nil
+}
+
+// decodeFloat returns the value of n, of a mantissa of mbits, and an
+// exponent of ebits above it. The mantissas at the ends of the range
+// are the special values: NaN, NRes and a reserved one at the negative
+// end, NaN and +Inf at the positive end, and -Inf.
+func decodeFloat(n uint32, mbits, ebits uint) float64 {
+	m := signExtend(n&(1<<mbits-1), mbits)
+	e := signExtend(n>>mbits&(1<<ebits-1), ebits)
+	max := int32(1)<<(mbits-1) - 1
+	switch m {
+	case max, -max - 1, -max: // NaN, NRes, reserved
+		return math.NaN()
+	case max - 1:
+		return math.Inf(1)
+	case -(max - 1):
+		return math.Inf(-1)
+	}
+	if e < 0 {
+		return float64(m) / math.Pow10(int(-e))
+	}
+	return float64(m) * math.Pow10(int(e))
+}
+
+// encodeFloat returns v, with a mantissa of mbits, and an exponent of
+// ebits above it, and reports whether it holds it.
+func encodeFloat(v float64, mbits, ebits uint) (uint32, bool) {
+	max := int64(1)<<(mbits-1) - 1
+	var m, e int64
+	switch {
+	case math.IsNaN(v):
+		m = max
+	case math.IsInf(v, 1):
+		m = max - 1
+	case math.IsInf(v, -1):
+		m = -(max - 1)
+	default:
+		emin, emax := -int64(1)<<(ebits-1), int64(1)<<(ebits-1)-1
+		for e = emin; ; e++ {
+			if e > emax {
+				return 0, false
+			}
+			if f := math.Round(v * math.Pow10(int(-e))); math.Abs(f) <= float64(max-2) {
+				m = int64(f)
+				break
+			}
+		}
+		if m == 0 {
+			e = 0
+		}
+		// The shortest mantissa, e.g. 1e2 rather than 100e0.
+		for m != 0 && m%10 == 0 && e < emax {
+			m, e = m/10, e+1
+		}
+	}
+	return uint32(m)&(1<<mbits-1) | uint32(e)&(1<<ebits-1)<<mbits, true
+}
+
+// signExtend returns the signed value of the n bits of v.
+func signExtend(v uint32, n uint) int32 {
+	return int32(v<<(32-n)) >> (32 - n)
+}
+
+// Uint24 decodes b, an unsigned integer of 24 bits, little-endian.
+func Uint24(b []byte) (uint32, error) {
+	if len(b) != 3 {
+		return 0, fmt.Errorf("%w: uint24 of %d bytes", ErrMalformed, len(b))
+	}
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16, nil
+}
+
+// AppendUint24 appends v, as an unsigned integer of 24 bits, to b.
+func AppendUint24(b []byte, v uint32) ([]byte, error) {
+	if v >= 1<<24 {
+		return b, fmt.Errorf("%w: uint24 of %d", ErrRange, v)
+	}
+	return append(b, byte(v), byte(v>>8), byte(v>>16)), nil
+}
+
+// String decodes b, a UTF-8 string, which spans the whole value; the
+// NUL bytes some devices terminate it with are dropped.
+func String(b []byte) (string, error) {
+	if !utf8.Valid(b) {
+		return "", fmt.Errorf("%w: invalid UTF-8 string %q", ErrMalformed, b)
+	}
+	return strings.TrimRight(string(b), "\x00"), nil
+}
+
+// AppendString appends s, as a UTF-8 string, to b, truncated to max
+// bytes, such as what a Read Response holds, without splitting a
+// character.
+func AppendString(b []byte, s string, max int) []byte {
+	if len(s) > max {
+		i := max
+		for i > 0 && !utf8.RuneStart(s[i]) {
+			i--
+		}
+		s = s[:i]
+	}
+	return append(b, s...)
+}
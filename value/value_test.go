@@ -0,0 +1,130 @@
+package value
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSFloat(t *testing.T) {
+	for _, tt := range []struct {
+		v, want float64 // want, as rounded
+		b       []byte
+	}{
+		{36.6, 36.6, []byte{0x6E, 0xF1}}, // 366e-1
+		{-1.5, -1.5, []byte{0xF1, 0xFF}}, // -15e-1
+		{0, 0, []byte{0x00, 0x00}},
+		{1e2, 1e2, []byte{0x01, 0x20}},
+		{1234567, 1235000, []byte{0xD3, 0x34}}, // 1235e3
+		{math.Inf(1), math.Inf(1), []byte{0xFE, 0x07}},
+		{math.Inf(-1), math.Inf(-1), []byte{0x02, 0x08}},
+	} {
+		b, err := AppendSFloat(nil, tt.v)
+		if err != nil || !bytes.Equal(b, tt.b) {
+			t.Errorf("AppendSFloat(%v) = % X, %v, want % X", tt.v, b, err, tt.b)
+		}
+		if v, err := SFloat(tt.b); err != nil || v != tt.want {
+			t.Errorf("SFloat(% X) = %v, %v, want %v", tt.b, v, err, tt.want)
+		}
+	}
+	for _, b := range [][]byte{{0xFF, 0x07}, {0x00, 0x08}, {0x01, 0x08}} { // NaN, NRes, reserved
+		if v, err := SFloat(b); err != nil || !math.IsNaN(v) {
+			t.Errorf("SFloat(% X) = %v, %v, want NaN", b, v, err)
+		}
+	}
+	if _, err := AppendSFloat(nil, 1e12); !errors.Is(err, ErrRange) {
+		t.Errorf("AppendSFloat(1e12): got %v, want ErrRange", err)
+	}
+	if _, err := SFloat([]byte{0x00}); !errors.Is(err, ErrMalformed) {
+		t.Errorf("SFloat of a byte: got %v, want ErrMalformed", err)
+	}
+}
+
+func TestFloat(t *testing.T) {
+	// 36.6 °C, as a Temperature Measurement of the Health Thermometer
+	// service holds it.
+	b, err := AppendFloat(nil, 36.6)
+	if want := []byte{0x6E, 0x01, 0x00, 0xFF}; err != nil || !bytes.Equal(b, want) {
+		t.Errorf("AppendFloat(36.6) = % X, %v, want % X", b, err, want)
+	}
+	if v, err := Float(b); err != nil || v != 36.6 {
+		t.Errorf("Float(% X) = %v, %v, want 36.6", b, v, err)
+	}
+	for _, v := range []float64{-273.15, 1e-20, 2.5e10} {
+		b, err := AppendFloat(nil, v)
+		if got, _ := Float(b); err != nil || got != v {
+			t.Errorf("Float(AppendFloat(%v)) = %v, %v", v, got, err)
+		}
+	}
+}
+
+func TestUint24AndString(t *testing.T) {
+	b, err := AppendUint24(nil, 0x123456)
+	if v, _ := Uint24(b); err != nil || v != 0x123456 || !bytes.Equal(b, []byte{0x56, 0x34, 0x12}) {
+		t.Errorf("AppendUint24(0x123456) = % X, %v, decoded as %#x", b, err, v)
+	}
+	if _, err := AppendUint24(nil, 1<<24); !errors.Is(err, ErrRange) {
+		t.Errorf("AppendUint24(1<<24): got %v, want ErrRange", err)
+	}
+
+	// Truncated before the 2 bytes of é, rather than through them.
+	if b := AppendString(nil, "café", 4); string(b) != "caf" {
+		t.Errorf("AppendString(café, 4) = %q, want %q", b, "caf")
+	}
+	if s, err := String([]byte("gatt\x00")); err != nil || s != "gatt" {
+		t.Errorf("String(gatt\\x00) = %q, %v", s, err)
+	}
+	if _, err := String([]byte{0xC3}); !errors.Is(err, ErrMalformed) {
+		t.Errorf("String of a truncated character: got %v, want ErrMalformed", err)
+	}
+}
+
+func TestRecords(t *testing.T) {
+	dt := DateTimeOf(time.Date(2026, time.October, 15, 9, 30, 5, 0, time.UTC))
+	b, err := dt.MarshalBinary()
+	if want := []byte{0xEA, 0x07, 10, 15, 9, 30, 5}; err != nil || !bytes.Equal(b, want) {
+		t.Errorf("%+v: MarshalBinary = % X, %v, want % X", dt, b, err, want)
+	}
+	var got DateTime
+	if err := got.UnmarshalBinary(b); err != nil || got != dt {
+		t.Errorf("UnmarshalBinary(% X) = %+v, %v, want %+v", b, got, err, dt)
+	}
+	if _, ok := (DateTime{Hour: 9}).Time(time.UTC); ok {
+		t.Error("Time of an unknown date: reported as known")
+	}
+	if err := got.UnmarshalBinary([]byte{0xEA, 0x07, 13, 15, 9, 30, 5}); !errors.Is(err, ErrMalformed) {
+		t.Errorf("UnmarshalBinary of month 13: got %v, want ErrMalformed", err)
+	}
+
+	for _, m := range []HeartRateMeasurement{
+		{BPM: 72},
+		{BPM: 300, SensorContact: true, ContactDetected: true},
+		{BPM: 60, EnergyExpended: 120, HasEnergyExpended: true, RRIntervals: []time.Duration{1024 * rrUnit, 830 * rrUnit}},
+	} {
+		b, err := m.MarshalBinary()
+		var got HeartRateMeasurement
+		if err == nil {
+			err = got.UnmarshalBinary(b)
+		}
+		if err != nil || !reflect.DeepEqual(got, m) {
+			t.Errorf("%+v encoded as % X, decoded as %+v, %v", m, b, got, err)
+		}
+	}
+	var m HeartRateMeasurement
+	for _, b := range [][]byte{{0x00}, {0x01, 0x48}, {0x08, 0x48, 0x78}, {0x10, 0x48, 0x00}, {0x00, 0x48, 0x00, 0x04}} {
+		if err := m.UnmarshalBinary(b); !errors.Is(err, ErrMalformed) {
+			t.Errorf("UnmarshalBinary(% X): got %v, want ErrMalformed", b, err)
+		}
+	}
+
+	var l BatteryLevel
+	if err := l.UnmarshalBinary([]byte{85}); err != nil || l != 85 {
+		t.Errorf("UnmarshalBinary(85) = %d, %v", l, err)
+	}
+	if _, err := BatteryLevel(101).MarshalBinary(); !errors.Is(err, ErrRange) {
+		t.Errorf("MarshalBinary of 101%%: got %v, want ErrRange", err)
+	}
+}